@@ -0,0 +1,639 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/alerts"
+	"github.com/druarnfield/diffbox/internal/api"
+	"github.com/druarnfield/diffbox/internal/aria2"
+	"github.com/druarnfield/diffbox/internal/config"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/gpu"
+	"github.com/druarnfield/diffbox/internal/models"
+	"github.com/druarnfield/diffbox/internal/queue"
+	"github.com/druarnfield/diffbox/internal/scratch"
+	"github.com/druarnfield/diffbox/internal/setup"
+	"github.com/druarnfield/diffbox/internal/storage"
+	"github.com/druarnfield/diffbox/internal/tracing"
+	"github.com/druarnfield/diffbox/internal/worker"
+	"github.com/druarnfield/diffbox/internal/workflow"
+)
+
+// app is a running diffbox: the API, the model downloader, the workers
+// and the dispatch loop between them. It runs on whichever queue and
+// aria2 it's given, so the end to end tests can use in-process fakes.
+type app struct {
+	handler http.Handler
+	hub     *api.WebSocketHub
+	api     *api.Server
+	meter   *gpu.Meter
+	// draining stops dispatch once shutdown begins
+	draining atomic.Bool
+	// closers stop background work, run newest first by close
+	closers []func()
+}
+
+// newApp wires up and starts everything except the HTTP listener. The
+// workers and the startup model download start in the background.
+func newApp(cfg *config.Config, database *db.DB, q queue.Queue, aria2Client aria2.RPC) (*app, error) {
+	a := &app{}
+
+	// Directories picked in the setup wizard apply from the next start
+	setupManager, err := setup.Load(context.Background(), database)
+	if err != nil {
+		return nil, err
+	}
+	if err := setup.ApplyDirs(cfg, setupManager.State()); err != nil {
+		return nil, fmt.Errorf("apply setup directories: %w", err)
+	}
+
+	// GPU telemetry ring buffer (a history of GPUHistorySize per-GPU samples)
+	gpuMonitor := gpu.NewMonitor(gpu.Query, cfg.GPUSampleInterval, cfg.GPUHistorySize)
+
+	// Headroom alerts read the latest GPU samples rather than querying again
+	alertMonitor := alerts.NewMonitor(alerts.Thresholds{
+		DiskFreePct: cfg.AlertDiskFreePct,
+		VRAMFreePct: cfg.AlertVRAMFreePct,
+	}, []string{cfg.OutputsDir, cfg.ModelsDir}, models.DiskUsage, gpuMonitor.Latest)
+
+	// Prefer a token saved through the settings page over the environment
+	hfToken, err := database.GetConfig(context.Background(), "token:huggingface")
+	if err != nil || hfToken == "" {
+		hfToken = os.Getenv("HF_TOKEN")
+	}
+	if cfg.HFEndpoint != models.DefaultHFEndpoint {
+		log.Printf("Using HuggingFace mirror %s", cfg.HFEndpoint)
+	}
+	models.SetHFEndpoint(cfg.HFEndpoint)
+	models.SetHFMirrors(cfg.HFMirrors)
+
+	workflows, err := workflow.Load(cfg.WorkflowsDir)
+	if err != nil {
+		return nil, fmt.Errorf("load custom workflows from %s: %w", cfg.WorkflowsDir, err)
+	}
+	for _, def := range workflows.List() {
+		log.Printf("Registered custom workflow %s (%s)", def.Type, def.Name)
+		for _, m := range def.Models {
+			models.RegisterModels(models.ModelFile{Name: m.Name, URL: m.URL, Mirrors: m.Mirrors, Size: m.Size, SHA256: m.SHA256, Workflow: def.Type})
+		}
+	}
+
+	models.SetSelection(setupManager.State().Selection())
+	// Files moved upstream keep the URL they were remapped to
+	remapped, err := database.ListModelURLs(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("load remapped model URLs: %w", err)
+	}
+	models.SetRemappedURLs(remapped)
+
+	downloader := models.NewDownloader(aria2Client, storage.NewLocal(cfg.ModelsDir), hfToken)
+	downloader.SetGIDStore(downloadGIDs{database})
+	if cfg.VerifyModelsRemote {
+		downloader.Verifier().SetRemoteLookup(models.NewHFLookup(hfToken))
+	}
+	if len(cfg.HFMirrors) > 0 {
+		log.Printf("Probing mirrors %s (%s)", strings.Join(cfg.HFMirrors, ", "), cfg.MirrorSelection)
+		downloader.SetMirrorSelector(models.NewMirrorSelector(models.NewHTTPProbe(hfToken), cfg.MirrorSelection))
+	}
+	downloader.SetCallbacks(func(rec models.DownloadRecord) {
+		err := database.RecordDownload(context.Background(), &db.DownloadRecord{
+			Name:       rec.Name,
+			URL:        rec.URL,
+			Mirror:     rec.Mirror,
+			Workflow:   rec.Workflow,
+			Status:     rec.Status,
+			Size:       rec.Size,
+			DurationMs: rec.Duration.Milliseconds(),
+			AvgSpeed:   rec.AvgSpeed,
+			Retries:    rec.Retries,
+			Error:      rec.Error,
+			FinishedAt: rec.FinishedAt,
+		})
+		if err != nil {
+			log.Printf("Failed to record download history for %s: %v", rec.Name, err)
+		}
+	})
+
+	workerManager := worker.NewManager(cfg)
+	if cfg.TestMode || cfg.Simulate {
+		workerManager.SetLauncher(worker.MockLauncher)
+	}
+
+	router, wsHub, apiServer := api.NewRouter(cfg, database, q, aria2Client, gpuMonitor, alertMonitor, setupManager, downloader, workerManager, workflows)
+	// Pipelines waiting on jobs the last run left interrupted move on now
+	// rather than when someone next looks at them
+	apiServer.ReconcilePipelines(context.Background())
+	downloader.SetDiskSpacePolicy(cfg.DiskSpaceCheck, wsHub.BroadcastDiskSpace)
+	workerManager.SetEnvLogCallback(func(status worker.EnvStatus, line string) {
+		wsHub.BroadcastPythonEnv(api.PythonEnvUpdate{EnvStatus: status, Line: line})
+	})
+	workerManager.SetJobLogCallback(func(jobID, line string) {
+		wsHub.BroadcastJobLog(api.JobLog{JobID: jobID, Line: line})
+	})
+
+	gpuCtx, stopGPU := context.WithCancel(context.Background())
+	a.closers = append(a.closers, stopGPU)
+	energyMeter := gpu.NewMeter()
+	go gpuMonitor.Run(gpuCtx, func(samples []gpu.Sample) {
+		wsHub.BroadcastGPUSamples(samples)
+		energyMeter.Record(samples)
+	})
+
+	alertMonitor.OnAlert(wsHub.BroadcastAlert)
+	if cfg.AlertWebhookURL != "" {
+		alertMonitor.OnAlert(alerts.Webhook(cfg.AlertWebhookURL, nil))
+	}
+	alertCtx, stopAlerts := context.WithCancel(context.Background())
+	a.closers = append(a.closers, stopAlerts)
+	go alertMonitor.Run(alertCtx, cfg.AlertInterval)
+
+	// Download missing models in background (non-blocking). Runs are
+	// serialized, since rerunning setup starts another one.
+	var downloadMu sync.Mutex
+	downloadModels := func() {
+		downloadMu.Lock()
+		defer downloadMu.Unlock()
+		// Pick up downloads from before a restart and clear out those of
+		// files no longer needed, before anything new is queued
+		downloader.Reconcile()
+		if cfg.LazyModelDownloads || cfg.TestMode || cfg.Simulate {
+			// Only report what's on disk; jobs fetch their own models
+			log.Println("Lazy model downloads, test mode or simulation enabled, skipping startup download")
+			downloader.Verifier().Verify(models.RequiredModels())
+			return
+		}
+		log.Println("Starting model download check...")
+		if err := downloader.CheckAndDownload(); err != nil {
+			log.Printf("Model download failed: %v", err)
+			log.Println("Server will continue running, but workflows may fail without models")
+		} else {
+			log.Println("All models ready!")
+		}
+	}
+
+	// Nothing is downloaded until the first-run setup has picked the
+	// workflows and variant, unless this is a headless deployment or an
+	// existing install that already has models
+	setupManager.OnComplete(func(state setup.State) {
+		models.SetSelection(state.Selection())
+		if token, err := database.GetConfig(context.Background(), "token:huggingface"); err == nil && token != "" {
+			downloader.SetHFToken(token)
+		}
+		go downloadModels()
+	})
+	switch {
+	case setupManager.State().Completed || cfg.LazyModelDownloads || cfg.TestMode || cfg.Simulate:
+		go downloadModels()
+	case cfg.SkipSetup || setup.HasModels(cfg.ModelsDir):
+		log.Println("Setup: skipping the first-run wizard with every workflow at full precision")
+		if err := setupManager.Complete(context.Background(), setup.State{Workflows: models.BuiltinWorkflows, Variant: models.VariantFull}); err != nil {
+			return nil, err
+		}
+	default:
+		log.Println("Setup: waiting for first-run setup (/api/setup) before downloading models")
+	}
+
+	// Start Python workers in the background, since installing their
+	// dependencies on first boot takes a while (they'll wait for models
+	// when processing jobs). If they can't start the API keeps serving,
+	// so the failure shows in /readyz and the Python environment status.
+	go func() {
+		if err := workerManager.Start(); err != nil {
+			log.Printf("ERROR - Failed to start workers, jobs will stay queued: %v", err)
+		}
+	}()
+	a.closers = append(a.closers, workerManager.Stop)
+
+	// Archived files are restored on demand even with auto-archive off
+	if cfg.ModelArchiveDir != "" {
+		downloader.SetArchiveDir(cfg.ModelArchiveDir)
+	}
+	if cfg.ModelArchiveDir != "" && cfg.ModelArchiveAfterDays > 0 {
+		archiveCtx, stopArchive := context.WithCancel(context.Background())
+		a.closers = append(a.closers, stopArchive)
+		go runModelArchiver(archiveCtx, database, downloader, cfg)
+	}
+
+	if cfg.RequestLogDays > 0 {
+		// Wait for the last entries to be written before the database
+		// closes
+		logCtx, stopLog := context.WithCancel(context.Background())
+		logDone := make(chan struct{})
+		go func() {
+			apiServer.RunRequestLog(logCtx)
+			close(logDone)
+		}()
+		a.closers = append(a.closers, func() {
+			stopLog()
+			<-logDone
+		})
+	}
+	// Concat jobs run in the server and are cancelled with it
+	a.closers = append(a.closers, apiServer.Close)
+
+	if cfg.IdleUnloadTimeout > 0 {
+		idleCtx, stopIdle := context.WithCancel(context.Background())
+		a.closers = append(a.closers, stopIdle)
+		go workerManager.RunIdleUnload(idleCtx, cfg.IdleUnloadTimeout)
+	}
+
+	jobTraces := tracing.NewJobTracker()
+
+	scratchDirs := scratch.NewManager(cfg.ScratchDir, cfg.ScratchGracePeriod)
+	if err := scratchDirs.Sweep(); err != nil {
+		log.Printf("Failed to clean scratch directory: %v", err)
+	}
+	a.closers = append(a.closers, scratchDirs.Stop)
+	limiter := worker.NewLimiter(cfg.ConcurrencyLimits)
+	// Jobs wait in the backlog until a worker is free, then go out in
+	// the database's queue order so reordering takes effect
+	backlog := worker.NewBacklog()
+
+	// dispatchJob hands a job to the worker pool, failing it if the
+	// workers can't take it
+	dispatchJob := func(ctx context.Context, job *worker.JobRequest) {
+		ctx, span := tracing.Start(ctx, "worker.dispatch", tracing.JobIDKey.String(job.ID))
+		defer span.End()
+
+		dir, err := scratchDirs.Create(job.ID)
+		if err != nil {
+			log.Printf("Job %s running without a scratch dir: %v", job.ID, err)
+		}
+		job.ScratchDir = dir
+
+		log.Printf("Dispatching job %s from queue to worker", job.ID)
+		err = workerManager.SubmitJob(job)
+		if err != nil {
+			log.Printf("Job %s dispatch failed, retrying in 1s: %v", job.ID, err)
+			time.Sleep(1 * time.Second)
+			err = workerManager.SubmitJob(job)
+			if err != nil {
+				log.Printf("Job %s dispatch retry failed, marking as failed: %v", job.ID, err)
+				limiter.Release(job.ID)
+				scratchDirs.Release(job.ID)
+				backlog.Wake()
+				// Mark job as failed in database
+				tracing.End(span, err)
+				if dbErr := database.FailJob(ctx, job.ID, fmt.Sprintf("dispatch failed: %v", err)); dbErr != nil {
+					log.Printf("Failed to mark job %s as failed in DB: %v", job.ID, dbErr)
+				}
+				// Broadcast failure to WebSocket
+				wsHub.BroadcastJobError(api.JobError{
+					JobID: job.ID,
+					Error: fmt.Sprintf("Failed to dispatch job: %v", err),
+				})
+				return
+			}
+		}
+		jobTraces.StartJob(ctx, job.ID, job.Type)
+		if err := database.RecordJobEvent(ctx, job.ID, db.EventDispatched, ""); err != nil {
+			log.Printf("Failed to record dispatch of job %s: %v", job.ID, err)
+		}
+		recordModelUse(ctx, database, job.Type)
+	}
+
+	// dispatchNext dispatches the first queued job that a worker and its
+	// type's concurrency limit allow. It reports whether it dispatched one.
+	dispatchNext := func() bool {
+		if a.draining.Load() {
+			return false
+		}
+		ids, err := queueOrder(context.Background(), database, cfg.FairScheduling)
+		if err != nil {
+			log.Printf("Failed to load queue order: %v", err)
+			return false
+		}
+		for _, id := range ids {
+			job, ok := backlog.Get(id)
+			if !ok || !limiter.TryAcquire(id, job.Type) {
+				continue
+			}
+			ctx, job, _ := backlog.Take(id)
+			if err := database.MarkJobDispatched(ctx, id); err != nil {
+				log.Printf("Failed to mark job %s as dispatched: %v", id, err)
+			}
+			dispatchJob(ctx, job)
+			return true
+		}
+		return false
+	}
+
+	go func() {
+		<-workerManager.Ready()
+		for range backlog.Ready() {
+			for backlog.Len() > 0 && workerManager.IdleWorkers() > 0 {
+				if !dispatchNext() {
+					break
+				}
+			}
+		}
+	}()
+
+	// waitForModels parks a job in the waiting_models state until its
+	// workflow's models are downloaded, then dispatches it
+	waitForModels := func(ctx context.Context, workflow string, job *worker.JobRequest) {
+		log.Printf("Job %s waiting for %s models", job.ID, workflow)
+		if err := database.UpdateJobStatus(ctx, job.ID, "waiting_models"); err != nil {
+			log.Printf("Failed to mark job %s as waiting for models: %v", job.ID, err)
+		}
+		if err := database.RecordJobEvent(ctx, job.ID, db.EventWaitingModels, workflow); err != nil {
+			log.Printf("Failed to record model wait of job %s: %v", job.ID, err)
+		}
+
+		err := downloader.EnsureWorkflow(workflow, func(progress float64) {
+			if err := database.UpdateJobProgress(ctx, job.ID, progress, "Waiting for models"); err != nil {
+				log.Printf("Failed to update job progress in DB: %v", err)
+			}
+			wsHub.BroadcastJobProgress(api.JobProgress{
+				JobID:    job.ID,
+				Progress: progress,
+				Stage:    "Waiting for models",
+			})
+		})
+		if err != nil {
+			log.Printf("Job %s failed waiting for models: %v", job.ID, err)
+			if dbErr := database.FailJob(ctx, job.ID, fmt.Sprintf("model download failed: %v", err)); dbErr != nil {
+				log.Printf("Failed to mark job %s as failed in DB: %v", job.ID, dbErr)
+			}
+			wsHub.BroadcastJobError(api.JobError{
+				JobID: job.ID,
+				Error: fmt.Sprintf("Model download failed: %v", err),
+			})
+			return
+		}
+
+		// Reset progress while still waiting, so it doesn't count as running
+		if err := database.UpdateJobProgress(ctx, job.ID, 0, ""); err != nil {
+			log.Printf("Failed to reset progress of job %s: %v", job.ID, err)
+		}
+		if err := database.UpdateJobStatus(ctx, job.ID, "pending"); err != nil {
+			log.Printf("Failed to requeue job %s after model download: %v", job.ID, err)
+		}
+		backlog.Add(ctx, job)
+	}
+
+	// queueJob holds a job in the backlog until a worker is free. A job
+	// whose models are archived, or in lazy mode missing, waits while
+	// they are restored or downloaded, then joins the backlog on its own,
+	// so the copy doesn't hold up other jobs. Simulated workers need no
+	// models.
+	queueJob := func(ctx context.Context, job *worker.JobRequest) {
+		workflow := models.WorkflowForJobType(job.Type)
+		if !cfg.Simulate && (downloader.WorkflowArchived(workflow) ||
+			cfg.LazyModelDownloads && !downloader.WorkflowReady(workflow)) {
+			go waitForModels(ctx, workflow, job)
+			return
+		}
+		backlog.Add(ctx, job)
+	}
+
+	// Start queue consumer to dispatch jobs to workers
+	go func() {
+		// Jobs stay queued until there are workers to take them
+		<-workerManager.Ready()
+
+		// Jobs still queued when the last run stopped go back in the
+		// backlog, keeping their order; a restored job redelivered by
+		// the queue is skipped
+		restored := make(map[string]bool)
+		queued, err := database.ListQueuedJobs(context.Background())
+		if err != nil {
+			log.Printf("Failed to load jobs queued before the restart: %v", err)
+		}
+		for _, dbJob := range queued {
+			var params map[string]interface{}
+			if err := json.Unmarshal([]byte(dbJob.Params), &params); err != nil {
+				log.Printf("Failed to parse params of queued job %s: %v", dbJob.ID, err)
+				continue
+			}
+			// Stored params name library images; workers take the bytes
+			if err := apiServer.ResolveInputs(context.Background(), dbJob.Type, params); err != nil {
+				log.Printf("Failed to load inputs of queued job %s: %v", dbJob.ID, err)
+				if err := database.FailJob(context.Background(), dbJob.ID, "input image missing after restart: "+err.Error()); err != nil {
+					log.Printf("Failed to mark job %s as failed in DB: %v", dbJob.ID, err)
+				}
+				continue
+			}
+			job := &worker.JobRequest{
+				ID:     dbJob.ID,
+				Type:   dbJob.Type,
+				Params: params,
+				Stages: workflows.Stages(dbJob.Type),
+			}
+			if def := workflows.Get(dbJob.Type); def != nil {
+				job.Workflow = def.Spec()
+			}
+			restored[job.ID] = true
+			queueJob(context.Background(), job)
+		}
+		if len(restored) > 0 {
+			log.Printf("Requeued %d jobs from the previous run", len(restored))
+		}
+
+		log.Println("Starting queue consumer...")
+		err = q.Consume("jobs", "workers", "dispatcher", func(id string, data map[string]interface{}) error {
+			// Parse job data
+			jobID, _ := data["id"].(string)
+			if restored[jobID] {
+				return nil
+			}
+			jobType, _ := data["type"].(string)
+			params, _ := data["params"].(map[string]interface{})
+
+			// Rejoin the trace started when the job was submitted
+			ctx := tracing.Extract(context.Background(), data["trace"])
+			if enqueuedAt, ok := data["enqueued_at"].(float64); ok {
+				tracing.RecordQueueWait(ctx, jobID, time.UnixMilli(int64(enqueuedAt)))
+			}
+			job := &worker.JobRequest{
+				ID:     jobID,
+				Type:   jobType,
+				Params: params,
+				Stages: workflows.Stages(jobType),
+			}
+			if def := workflows.Get(jobType); def != nil {
+				job.Workflow = def.Spec()
+			}
+
+			queueJob(ctx, job)
+			return nil
+		})
+		if err != nil {
+			log.Printf("Queue consumer error: %v", err)
+		}
+	}()
+
+	// Wire up worker callbacks to WebSocket hub and database
+	previews := newPreviewThrottle()
+	etas := newJobETAs(database)
+	workerManager.SetCallbacks(
+		// Progress callback
+		func(progress worker.ProgressUpdate) {
+			// Update database
+			jobTraces.Stage(progress.JobID, progress.Stage)
+			// A job is metered from its first progress report
+			energyMeter.Start(progress.JobID)
+			if err := database.UpdateJobProgress(context.Background(), progress.JobID, progress.Progress, progress.Stage); err != nil {
+				log.Printf("Failed to update job progress in DB: %v", err)
+			}
+			if progress.StageID != "" {
+				if err := database.RecordJobStage(context.Background(), progress.JobID, progress.StageID, progress.StageProgress); err != nil {
+					log.Printf("Failed to record stage of job %s: %v", progress.JobID, err)
+				}
+			}
+			// Keep the latest preview frame out of the jobs table, storing
+			// at most one a second since workers can send one per step
+			if progress.Preview != "" && previews.Allow(progress.JobID) {
+				preview, err := base64.StdEncoding.DecodeString(progress.Preview)
+				if err != nil {
+					preview = []byte(progress.Preview)
+				}
+				if err := database.SaveJobPreview(context.Background(), progress.JobID, preview); err != nil {
+					log.Printf("Failed to save job preview in DB: %v", err)
+				}
+			}
+			update := api.JobProgress{
+				JobID:         progress.JobID,
+				Progress:      progress.Progress,
+				Stage:         progress.Stage,
+				Preview:       progress.Preview,
+				StageID:       progress.StageID,
+				StageProgress: progress.StageProgress,
+			}
+			if remaining, ok := etas.Update(context.Background(), progress.JobID, progress.Progress); ok {
+				update.ETASeconds = int64(remaining.Seconds())
+			}
+			// Broadcast to WebSocket
+			wsHub.BroadcastJobProgress(update)
+		},
+		// Complete callback
+		func(result worker.JobResult) {
+			// Update database
+			jobTraces.EndJob(result.JobID, "")
+			previews.Forget(result.JobID)
+			etas.Forget(result.JobID)
+			limiter.Release(result.JobID)
+			scratchDirs.Release(result.JobID)
+			backlog.Wake()
+			recordJobDuration(context.Background(), database, result.JobID)
+			result.Output.Path = apiServer.FinalizeOutput(result.JobID, result.Output.Path)
+			if err := database.CompleteJob(context.Background(), result.JobID, result.Output.Path); err != nil {
+				log.Printf("Failed to complete job in DB: %v", err)
+			}
+			recordOutputSize(context.Background(), database, result.JobID, result.Output.Path)
+			recordEnergy(context.Background(), database, energyMeter, result.JobID)
+			apiServer.RecordRepro(context.Background(), result.JobID, result.Output.Seed)
+			apiServer.RecordBenchmarkResult(context.Background(), result.JobID, "")
+			apiServer.AdvancePipeline(context.Background(), result.JobID, "")
+			// Broadcast to WebSocket
+			wsHub.BroadcastJobComplete(api.JobComplete{
+				JobID: result.JobID,
+				Output: api.JobOutput{
+					Type:   "output",
+					Path:   result.Output.Path,
+					Frames: result.Output.Frames,
+				},
+			})
+		},
+		// Error callback
+		func(result worker.JobResult) {
+			// Update database
+			jobTraces.EndJob(result.JobID, result.Error)
+			previews.Forget(result.JobID)
+			etas.Forget(result.JobID)
+			limiter.Release(result.JobID)
+			scratchDirs.Release(result.JobID)
+			backlog.Wake()
+			if err := database.FailJob(context.Background(), result.JobID, result.Error); err != nil {
+				log.Printf("Failed to mark job as failed in DB: %v", err)
+			}
+			recordEnergy(context.Background(), database, energyMeter, result.JobID)
+			apiServer.RecordBenchmarkResult(context.Background(), result.JobID, result.Error)
+			apiServer.AdvancePipeline(context.Background(), result.JobID, result.Error)
+			// Broadcast to WebSocket
+			wsHub.BroadcastJobError(api.JobError{
+				JobID: result.JobID,
+				Error: result.Error,
+			})
+		},
+	)
+	// Jobs a worker had when it died never report back, so stop charging
+	// them for GPU time they aren't using and fail them. At shutdown they
+	// have already been marked interrupted.
+	workerManager.SetExitCallback(func(workerID int, jobs []string, err error) {
+		stopping := workerManager.Stopping()
+		for _, id := range jobs {
+			recordEnergy(context.Background(), database, energyMeter, id)
+			if stopping {
+				continue
+			}
+			msg := fmt.Sprintf("worker exited: %v", err)
+			if err == nil {
+				msg = "worker exited"
+			}
+			jobTraces.EndJob(id, msg)
+			previews.Forget(id)
+			etas.Forget(id)
+			limiter.Release(id)
+			scratchDirs.Release(id)
+			backlog.Wake()
+			if err := database.FailJob(context.Background(), id, msg); err != nil {
+				log.Printf("Failed to mark job as failed in DB: %v", err)
+			}
+			apiServer.RecordBenchmarkResult(context.Background(), id, msg)
+			apiServer.AdvancePipeline(context.Background(), id, msg)
+			wsHub.BroadcastJobError(api.JobError{
+				JobID: id,
+				Error: msg,
+			})
+		}
+	})
+
+	a.handler, a.hub, a.api, a.meter = router, wsHub, apiServer, energyMeter
+	return a, nil
+}
+
+// close stops the workers and background loops
+func (a *app) close() {
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		a.closers[i]()
+	}
+}
+
+// downloadGIDs keeps the downloader's GIDs in the database
+type downloadGIDs struct{ db *db.DB }
+
+func (g downloadGIDs) Track(model models.ModelFile, gid string) error {
+	return g.db.TrackDownload(context.Background(), &db.TrackedDownload{
+		Name:     model.Name,
+		GID:      gid,
+		URL:      model.URL,
+		Workflow: model.Workflow,
+	})
+}
+
+func (g downloadGIDs) Untrack(name string) error {
+	return g.db.UntrackDownload(context.Background(), name)
+}
+
+func (g downloadGIDs) Tracked() (map[string]string, error) {
+	downloads, err := g.db.ListTrackedDownloads(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	gids := make(map[string]string, len(downloads))
+	for _, d := range downloads {
+		gids[d.Name] = d.GID
+	}
+	return gids, nil
+}
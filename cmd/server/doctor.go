@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/druarnfield/diffbox/internal/config"
+	"github.com/druarnfield/diffbox/internal/doctor"
+)
+
+// runDoctor checks the environment instead of starting the server and
+// returns the exit code
+func runDoctor() int {
+	// Read, not Load, so missing directories are reported rather than
+	// created
+	cfg, err := config.Read()
+	if err != nil {
+		fmt.Printf("[FAIL] config  %v\n", err)
+		return 1
+	}
+
+	if !doctor.Report(os.Stdout, doctor.Run(context.Background(), doctor.Checks(cfg))) {
+		return 1
+	}
+	return 0
+}
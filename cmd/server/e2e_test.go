@@ -0,0 +1,1160 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/api"
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/auth"
+	"github.com/druarnfield/diffbox/internal/config"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/inputs"
+	"github.com/druarnfield/diffbox/internal/logtail"
+	"github.com/druarnfield/diffbox/internal/models"
+	"github.com/druarnfield/diffbox/internal/paramtpl"
+	"github.com/druarnfield/diffbox/internal/pipeline"
+	"github.com/druarnfield/diffbox/internal/upload"
+	"github.com/druarnfield/diffbox/internal/video"
+	"github.com/druarnfield/diffbox/internal/worker"
+	"github.com/gorilla/websocket"
+)
+
+// Test mode spawns the running binary as the mock worker, which for these
+// tests is the test binary itself
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == worker.MockWorkerCommand {
+		os.Exit(runMockWorker())
+	}
+	os.Exit(m.Run())
+}
+
+// e2eTimeout bounds each wait for the server to reach a state
+const e2eTimeout = 20 * time.Second
+
+// harness is a diffbox in test mode behind an httptest server, with a
+// WebSocket connected to it
+type harness struct {
+	t      *testing.T
+	cfg    *config.Config
+	db     *db.DB
+	server *httptest.Server
+	ws     *websocket.Conn
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	return newHarnessIn(t, t.TempDir())
+}
+
+// newHarnessIn starts the harness with its data, models and outputs under
+// dir, so a test can prepare them as a previous run would have left them
+func newHarnessIn(t *testing.T, dir string) *harness {
+	t.Helper()
+	t.Setenv("DIFFBOX_TEST_MODE", "true")
+	t.Setenv("DIFFBOX_AUTH_ENABLED", "false")
+	t.Setenv("DIFFBOX_DATA_DIR", filepath.Join(dir, "data"))
+	t.Setenv("DIFFBOX_MODELS_DIR", filepath.Join(dir, "models"))
+	t.Setenv("DIFFBOX_OUTPUTS_DIR", filepath.Join(dir, "outputs"))
+	t.Setenv("DIFFBOX_STATIC_DIR", filepath.Join(dir, "static"))
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	database, err := db.New(filepath.Join(cfg.DataDir, "diffbox.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	q, aria2Client, stopServices := startServices(cfg)
+	a, err := newApp(cfg, database, q, aria2Client)
+	if err != nil {
+		t.Fatalf("start app: %v", err)
+	}
+	server := httptest.NewServer(a.handler)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("connect WebSocket: %v", err)
+	}
+
+	t.Cleanup(func() {
+		ws.Close()
+		server.Close()
+		a.close()
+		stopServices()
+		database.Close()
+	})
+	return &harness{t: t, cfg: cfg, db: database, server: server, ws: ws}
+}
+
+// post sends a JSON request and decodes the response into out
+func (h *harness) post(path string, body, out interface{}) int {
+	h.t.Helper()
+	return h.do(http.MethodPost, path, nil, body, out)
+}
+
+// do sends a JSON request with extra headers and decodes the response
+// into out
+func (h *harness) do(method, path string, header http.Header, body, out interface{}) int {
+	h.t.Helper()
+	data, _ := json.Marshal(body)
+	req, err := http.NewRequest(method, h.server.URL+path, bytes.NewReader(data))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+// submitI2V queues an I2V job and returns its ID
+func (h *harness) submitI2V(prompt string) string {
+	h.t.Helper()
+	return h.submitI2VIn("", prompt)
+}
+
+// submitI2VIn is submitI2V within a session
+func (h *harness) submitI2VIn(sessionID, prompt string) string {
+	h.t.Helper()
+	header := http.Header{}
+	if sessionID != "" {
+		header.Set(api.SessionHeader, sessionID)
+	}
+	var job api.JobResponse
+	status := h.do(http.MethodPost, "/api/workflows/i2v", header, i2vRequest(prompt), &job)
+	if status != http.StatusOK || job.ID == "" {
+		h.t.Fatalf("submit I2V: status %d, job %+v", status, job)
+	}
+	return job.ID
+}
+
+// i2vRequest is an I2V submission with the smallest valid input image
+func i2vRequest(prompt string) map[string]interface{} {
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, upload.MinImageDimension, upload.MinImageDimension)))
+	return map[string]interface{}{
+		"prompt":      prompt,
+		"input_image": base64.StdEncoding.EncodeToString(img.Bytes()),
+		"seed":        7,
+	}
+}
+
+// waitForJob reads WebSocket messages until jobID finishes, returning the
+// message types seen for it in order
+func (h *harness) waitForJob(jobID string) []api.WSMessage {
+	h.t.Helper()
+	h.ws.SetReadDeadline(time.Now().Add(e2eTimeout))
+	var seen []api.WSMessage
+	for {
+		var msg api.WSMessage
+		if err := h.ws.ReadJSON(&msg); err != nil {
+			h.t.Fatalf("waiting for job %s over WebSocket: %v (saw %d messages)", jobID, err, len(seen))
+		}
+		var ref struct {
+			JobID string `json:"job_id"`
+		}
+		json.Unmarshal(msg.Data, &ref)
+		if ref.JobID != jobID {
+			continue
+		}
+		seen = append(seen, msg)
+		if msg.Type == "job:complete" || msg.Type == "job:error" {
+			return seen
+		}
+	}
+}
+
+// job fetches a job through the API
+func (h *harness) job(jobID string) api.Job {
+	h.t.Helper()
+	resp, err := http.Get(h.server.URL + "/api/jobs/" + jobID)
+	if err != nil {
+		h.t.Fatalf("get job: %v", err)
+	}
+	defer resp.Body.Close()
+	var job api.Job
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		h.t.Fatalf("decode job: %v", err)
+	}
+	return job
+}
+
+// events lists the recorded lifecycle events of a job
+func (h *harness) events(jobID string) []string {
+	h.t.Helper()
+	events, err := h.db.ListJobEvents(context.Background(), jobID)
+	if err != nil {
+		h.t.Fatalf("list events: %v", err)
+	}
+	var names []string
+	for _, e := range events {
+		names = append(names, e.Event)
+	}
+	return names
+}
+
+func TestEndToEndJob(t *testing.T) {
+	h := newHarness(t)
+	jobID := h.submitI2V("a lighthouse at dusk")
+
+	messages := h.waitForJob(jobID)
+	var stages []string
+	for _, msg := range messages[:len(messages)-1] {
+		var progress api.JobProgress
+		json.Unmarshal(msg.Data, &progress)
+		if msg.Type == "job:progress" {
+			stages = append(stages, progress.Stage)
+		}
+	}
+	if last := messages[len(messages)-1]; last.Type != "job:complete" {
+		t.Fatalf("job ended with %s: %s", last.Type, last.Data)
+	}
+	if strings.Join(stages, ",") != "Loading models,Sampling,Decoding" {
+		t.Errorf("progress stages over WebSocket = %v", stages)
+	}
+
+	job := h.job(jobID)
+	if job.Status != "completed" || job.Output == nil {
+		t.Fatalf("job after completion: %+v", job)
+	}
+	if filepath.Dir(job.Output.Path) != h.cfg.OutputsDir {
+		t.Errorf("output %s is outside the outputs dir", job.Output.Path)
+	}
+	if _, err := os.Stat(job.Output.Path); err != nil {
+		t.Errorf("output file: %v", err)
+	}
+	if job.Params["width"] != float64(832) {
+		t.Errorf("stored params lack the resolved defaults: %v", job.Params)
+	}
+	if ref, _ := job.Params["input_image"].(string); !strings.HasPrefix(ref, inputs.RefPrefix) {
+		t.Errorf("stored input_image = %.40q, want a library reference", ref)
+	}
+
+	events := strings.Join(h.events(jobID), ",")
+	for _, want := range []string{"queued", "dispatched", "completed"} {
+		if !strings.Contains(events, want) {
+			t.Errorf("events %s lack %s", events, want)
+		}
+	}
+}
+
+func TestEndToEndJobStages(t *testing.T) {
+	h := newHarness(t)
+	jobID := h.submitI2V("a lighthouse at dusk")
+
+	last := 0.0
+	for _, msg := range h.waitForJob(jobID) {
+		if msg.Type != "job:progress" {
+			continue
+		}
+		var progress api.JobProgress
+		json.Unmarshal(msg.Data, &progress)
+		if progress.StageID == "" {
+			t.Errorf("progress %q has no stage ID", progress.Stage)
+		}
+		if progress.Progress < last {
+			t.Errorf("overall progress went back from %v to %v at %s", last, progress.Progress, progress.StageID)
+		}
+		last = progress.Progress
+	}
+
+	var got []string
+	var weight float64
+	for _, stage := range h.job(jobID).Stages {
+		got = append(got, stage.Name+":"+stage.Status)
+		weight += stage.Weight
+		if stage.Status == "done" && (stage.Progress != 1 || stage.StartedAt == "") {
+			t.Errorf("done stage %+v", stage)
+		}
+	}
+	want := "load_models:done,encode:skipped,denoise:done,decode:done,encode_video:skipped"
+	if strings.Join(got, ",") != want {
+		t.Errorf("stages = %v, want %s", got, want)
+	}
+	if weight < 0.999 || weight > 1.001 {
+		t.Errorf("stage weights add up to %v", weight)
+	}
+}
+
+func TestEndToEndCameraWarning(t *testing.T) {
+	h := newHarness(t)
+
+	var job api.JobResponse
+	if code := h.post("/api/workflows/i2v", i2vRequest("still"), &job); code != http.StatusOK || len(job.Warnings) != 0 {
+		t.Fatalf("submit without camera motion: status %d, warnings %v", code, job.Warnings)
+	}
+	h.waitForJob(job.ID)
+
+	req := i2vRequest("panning")
+	req["camera_direction"] = "pan-left"
+	job = api.JobResponse{}
+	if code := h.post("/api/workflows/i2v", req, &job); code != http.StatusOK {
+		t.Fatalf("submit with camera motion: status %d", code)
+	}
+	if len(job.Warnings) != 1 || !strings.Contains(job.Warnings[0], "camera motion") {
+		t.Errorf("warnings = %v", job.Warnings)
+	}
+	h.waitForJob(job.ID)
+}
+
+func TestEndToEndOneSidedResolution(t *testing.T) {
+	h := newHarness(t)
+
+	req := i2vRequest("tall")
+	req["height"] = 832
+	var job api.JobResponse
+	if code := h.post("/api/workflows/i2v", req, &job); code != http.StatusOK {
+		t.Fatalf("submit with only a height: status %d", code)
+	}
+	h.waitForJob(job.ID)
+	if params := h.job(job.ID).Params; params["width"] != float64(480) || params["height"] != float64(832) {
+		t.Errorf("size = %vx%v, want 480x832", params["width"], params["height"])
+	}
+}
+
+func TestEndToEndModelOverrides(t *testing.T) {
+	h := newHarness(t)
+
+	req := i2vRequest("override")
+	req["models"] = map[string]string{"unet_name": "other.safetensors"}
+	var apiErr apierr.Error
+	if code := h.post("/api/workflows/i2v", req, &apiErr); code != http.StatusBadRequest || !strings.Contains(apiErr.FieldErrors["models"], "unet_name") {
+		t.Errorf("unknown loader input: status %d, %+v", code, apiErr)
+	}
+
+	req["models"] = map[string]string{"ckpt_name": "other.safetensors"}
+	var job api.JobResponse
+	if code := h.post("/api/workflows/i2v", req, &job); code != http.StatusOK {
+		t.Fatalf("submit with an override: status %d", code)
+	}
+	h.waitForJob(job.ID)
+	if models, _ := h.job(job.ID).Params["models"].(map[string]interface{}); models["ckpt_name"] != "other.safetensors" {
+		t.Errorf("job models = %v", h.job(job.ID).Params["models"])
+	}
+}
+
+func TestEndToEndRequeueAfterRestart(t *testing.T) {
+	// Leave two jobs queued and one started, as a stopped server would
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := db.New(filepath.Join(dir, "data", "diffbox.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, _ := json.Marshal(i2vRequest("left in the queue"))
+	for _, id := range []string{"queued-1", "queued-2", "started"} {
+		job := &db.Job{ID: id, Type: "i2v", Status: "pending", Params: string(params)}
+		if err := previous.CreateJob(context.Background(), job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	previous.MarkJobDispatched(context.Background(), "started")
+	if _, err := previous.RecoverJobs(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	previous.Close()
+
+	h := newHarnessIn(t, dir)
+	deadline := time.Now().Add(e2eTimeout)
+	for _, id := range []string{"queued-1", "queued-2"} {
+		for job := h.job(id); job.Status != "completed"; job = h.job(id) {
+			if time.Now().After(deadline) {
+				t.Fatalf("requeued job %s: status %s", id, job.Status)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	if job := h.job("started"); job.Status != "interrupted" {
+		t.Errorf("started job: status %s, want interrupted", job.Status)
+	}
+}
+
+func TestEndToEndPipelineAfterRestart(t *testing.T) {
+	// A pipeline whose first step was running when the server stopped
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := db.New(filepath.Join(dir, "data", "diffbox.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := previous.CreateJob(ctx, &db.Job{ID: "clip", Type: "i2v", Status: "running", Params: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	spec, _ := json.Marshal(pipeline.Spec{Steps: []pipeline.Step{
+		{ID: "a", Type: "i2v", Params: map[string]interface{}{}},
+		{ID: "b", Type: "i2v", Needs: []string{"a"}, Params: map[string]interface{}{}},
+	}})
+	p := &db.Pipeline{ID: "p", Spec: string(spec), Steps: []*db.PipelineStep{
+		{StepID: "a", Type: "i2v", JobID: "clip", Status: pipeline.StepQueued},
+		{StepID: "b", Type: "i2v", Status: pipeline.StepWaiting},
+	}}
+	if err := previous.CreatePipeline(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := previous.RecoverJobs(ctx); err != nil {
+		t.Fatal(err)
+	}
+	previous.Close()
+
+	// Settled at startup, before anyone reads the pipeline
+	h := newHarnessIn(t, dir)
+	p, err = h.db.GetPipeline(ctx, "p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Steps[0].Status != pipeline.StepFailed || p.Steps[1].Status != pipeline.StepSkipped {
+		t.Errorf("steps after restart: %s, %s", p.Steps[0].Status, p.Steps[1].Status)
+	}
+}
+
+func TestEndToEndJobFailure(t *testing.T) {
+	h := newHarness(t)
+	jobID := h.submitI2V("please " + worker.MockFailMarker)
+
+	messages := h.waitForJob(jobID)
+	last := messages[len(messages)-1]
+	if last.Type != "job:error" || !strings.Contains(string(last.Data), "mock failure") {
+		t.Fatalf("expected a job error, got %s: %s", last.Type, last.Data)
+	}
+
+	job := h.job(jobID)
+	if job.Status != "failed" || !strings.Contains(job.Error, "mock failure") {
+		t.Errorf("job after failure: status %s, error %q", job.Status, job.Error)
+	}
+}
+
+func TestEndToEndPurgeRemovesFiles(t *testing.T) {
+	h := newHarness(t)
+	jobID := h.submitI2V("purge me")
+	h.waitForJob(jobID)
+
+	thumbnail := filepath.Join(h.cfg.ThumbnailsDir, jobID+".jpg")
+	if err := os.WriteFile(thumbnail, []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status := h.post("/api/jobs/"+jobID+"/archive", nil, nil); status != http.StatusOK {
+		t.Fatalf("archive job: status %d", status)
+	}
+
+	var purged api.PurgeJobsResponse
+	if status := h.post("/api/jobs/purge", api.PurgeJobsRequest{IDs: []string{jobID}, DeleteFiles: true}, &purged); status != http.StatusOK {
+		t.Fatalf("purge: status %d", status)
+	}
+	if len(purged.Purged) != 1 || purged.FilesRemoved < 2 {
+		t.Errorf("expected the output and thumbnail removed, got %+v", purged)
+	}
+	if _, err := os.Stat(thumbnail); !os.IsNotExist(err) {
+		t.Errorf("thumbnail survived the purge: %v", err)
+	}
+}
+
+func TestEndToEndWorkerCrash(t *testing.T) {
+	h := newHarness(t)
+	jobID := h.submitI2V("please " + worker.MockCrashMarker)
+
+	messages := h.waitForJob(jobID)
+	last := messages[len(messages)-1]
+	if last.Type != "job:error" || !strings.Contains(string(last.Data), "worker exited") {
+		t.Fatalf("expected a job error, got %s: %s", last.Type, last.Data)
+	}
+	if job := h.job(jobID); job.Status != "failed" || !strings.Contains(job.Error, "worker exited") {
+		t.Errorf("job after crash: status %s, error %q", job.Status, job.Error)
+	}
+}
+
+func TestEndToEndUnmatchedRoutes(t *testing.T) {
+	h := newHarness(t)
+
+	var apiErr apierr.Error
+	if status := h.do(http.MethodGet, "/api/no-such-thing", nil, nil, &apiErr); status != http.StatusNotFound || apiErr.Code != apierr.CodeNotFound {
+		t.Errorf("unknown route: status %d, %+v", status, apiErr)
+	}
+	apiErr = apierr.Error{}
+	if status := h.do(http.MethodDelete, "/api/health", nil, nil, &apiErr); status != http.StatusMethodNotAllowed || apiErr.Code != apierr.CodeMethodNotAllowed {
+		t.Errorf("wrong method: status %d, %+v", status, apiErr)
+	}
+}
+
+func TestEndToEndAdminBootstrap(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+	if err := h.db.CreateUser(ctx, &db.User{ID: "viewer", Name: "admin", Role: "viewer", TokenHash: "viewer-hash"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A viewer already named "admin" keeps their token and role
+	for _, token := range []string{"first-token", "second-token"} {
+		if err := ensureAdminUser(h.db, token); err != nil {
+			t.Fatalf("ensure admin with %s: %v", token, err)
+		}
+		admin, err := h.db.GetUserByTokenHash(ctx, auth.HashToken(token))
+		if err != nil || admin == nil || admin.Role != "admin" || admin.Name != "admin-2" {
+			t.Fatalf("admin for %s: %+v, %v", token, admin, err)
+		}
+	}
+	if viewer, _ := h.db.GetUserByTokenHash(ctx, "viewer-hash"); viewer == nil || viewer.Role != "viewer" {
+		t.Errorf("viewer named admin was changed: %+v", viewer)
+	}
+	if users, _ := h.db.ListUsers(ctx); len(users) != 2 {
+		t.Errorf("expected the rotation to reuse the admin user, got %d users", len(users))
+	}
+}
+
+func TestEndToEndQueuesJobs(t *testing.T) {
+	h := newHarness(t)
+	// One mock worker runs the jobs one after another
+	first := h.submitI2V("first")
+	second := h.submitI2V("second")
+
+	for _, id := range []string{first, second} {
+		if msgs := h.waitForJob(id); msgs[len(msgs)-1].Type != "job:complete" {
+			t.Errorf("job %s ended with %s", id, msgs[len(msgs)-1].Type)
+		}
+		if job := h.job(id); job.Status != "completed" {
+			t.Errorf("job %s is %s", id, job.Status)
+		}
+	}
+}
+
+func TestEndToEndSession(t *testing.T) {
+	h := newHarness(t)
+	var session api.Session
+	if status := h.post("/api/sessions", map[string]string{"name": "dusk tests"}, &session); status != http.StatusCreated {
+		t.Fatalf("create session: status %d", status)
+	}
+
+	inSession := h.submitI2VIn(session.ID, "in the session")
+	outside := h.submitI2V("outside the session")
+	for _, id := range []string{inSession, outside} {
+		h.waitForJob(id)
+	}
+
+	// Resubmitting keeps the original's session
+	var resubmitted api.JobResponse
+	if status := h.post("/api/jobs/"+inSession+"/resubmit", map[string]interface{}{"seed": 8}, &resubmitted); status != http.StatusOK {
+		t.Fatalf("resubmit: status %d", status)
+	}
+	h.waitForJob(resubmitted.ID)
+
+	var detail api.SessionDetail
+	h.do(http.MethodGet, "/api/sessions/"+session.ID, nil, nil, &detail)
+	if len(detail.Jobs) != 2 || detail.Jobs[0].ID != inSession || detail.Jobs[1].ID != resubmitted.ID {
+		t.Fatalf("session jobs = %+v", detail.Jobs)
+	}
+	if detail.JobCounts["completed"] != 2 {
+		t.Errorf("job counts = %v", detail.JobCounts)
+	}
+
+	var archived api.Session
+	if status := h.post("/api/sessions/"+session.ID+"/archive", nil, &archived); status != http.StatusOK || archived.ArchivedAt == "" {
+		t.Fatalf("archive session: status %d, %+v", status, archived)
+	}
+	if job := h.job(inSession); job.ArchivedAt == "" {
+		t.Error("session job not archived with its session")
+	}
+	if job := h.job(outside); job.ArchivedAt != "" {
+		t.Error("job outside the session was archived")
+	}
+
+	// Archived sessions take no new jobs
+	header := http.Header{api.SessionHeader: {session.ID}}
+	if status := h.do(http.MethodPost, "/api/workflows/i2v", header, i2vRequest("late"), nil); status != http.StatusConflict {
+		t.Errorf("submitting to an archived session: status %d", status)
+	}
+}
+
+func TestEndToEndSetup(t *testing.T) {
+	h := newHarness(t)
+	t.Cleanup(func() { models.SetSelection(models.Selection{}) })
+
+	var status api.SetupStatus
+	h.do(http.MethodGet, "/api/setup", nil, nil, &status)
+	if status.Completed || len(status.Workflows) != len(models.BuiltinWorkflows) {
+		t.Fatalf("fresh setup = %+v", status)
+	}
+
+	// The harness pins the directories through the environment
+	locked := api.SetupRequest{Workflows: []string{"qwen"}, ModelsDir: filepath.Join(t.TempDir(), "models")}
+	if code := h.post("/api/setup", locked, nil); code != http.StatusBadRequest {
+		t.Errorf("changing a pinned directory: status %d", code)
+	}
+
+	req := api.SetupRequest{Workflows: []string{"qwen"}, Variant: models.VariantQuantized}
+	if code := h.post("/api/setup", req, &status); code != http.StatusOK || !status.Completed || status.Variant != models.VariantQuantized {
+		t.Fatalf("complete setup: status %d, %+v", code, status)
+	}
+
+	// Disabled workflows take no jobs
+	if code := h.post("/api/workflows/i2v", i2vRequest("disabled"), nil); code != http.StatusConflict {
+		t.Errorf("submitting to a disabled workflow: status %d", code)
+	}
+
+	var aliases []models.Alias
+	h.do(http.MethodGet, "/api/models/aliases", nil, nil, &aliases)
+	for _, alias := range aliases {
+		if alias.Name == "qwen-edit" && alias.File != "qwen_image_edit_2511_fp8mixed.safetensors" {
+			t.Errorf("qwen-edit alias = %s, want the fp8 file", alias.File)
+		}
+	}
+}
+
+func TestEndToEndTemplates(t *testing.T) {
+	h := newHarness(t)
+
+	preset := api.Preset{
+		Name:     "portrait",
+		Workflow: "i2v",
+		Params:   map[string]interface{}{"prompt": "{{subject}} in the style of {{style}}", "num_frames": 33},
+		Variables: []paramtpl.Variable{
+			{Name: "subject"},
+			{Name: "style", Default: "watercolor"},
+		},
+	}
+	if code := h.post("/api/presets", preset, &preset); code != http.StatusCreated {
+		t.Fatalf("create preset: status %d", code)
+	}
+
+	// Placeholders must be declared
+	undeclared := api.Preset{Name: "loose", Workflow: "i2v", Params: map[string]interface{}{"prompt": "{{who}}"}}
+	if code := h.post("/api/presets", undeclared, nil); code != http.StatusBadRequest {
+		t.Errorf("preset with an undeclared variable: status %d", code)
+	}
+
+	req := i2vRequest("")
+	delete(req, "prompt")
+	req["preset_id"] = preset.ID
+	if code := h.post("/api/workflows/i2v", req, nil); code != http.StatusBadRequest {
+		t.Errorf("submission missing a required variable: status %d", code)
+	}
+
+	req["variables"] = map[string]interface{}{"subject": "a fox"}
+	var job api.JobResponse
+	if code := h.post("/api/workflows/i2v", req, &job); code != http.StatusOK {
+		t.Fatalf("submit from preset: status %d", code)
+	}
+	h.waitForJob(job.ID)
+	params := h.job(job.ID).Params
+	if params["prompt"] != "a fox in the style of watercolor" || params["num_frames"] != float64(33) {
+		t.Errorf("job params = %v", params)
+	}
+
+	// Variables work without a preset too, and keep their type when they
+	// are a whole value
+	req = i2vRequest("{{subject}}, {{mood}}")
+	req["num_frames"] = "{{frames}}"
+	req["variables"] = map[string]interface{}{"subject": "a heron", "mood": "misty", "frames": 49}
+	if code := h.post("/api/workflows/i2v", req, &job); code != http.StatusOK {
+		t.Fatalf("submit with variables: status %d", code)
+	}
+	h.waitForJob(job.ID)
+	params = h.job(job.ID).Params
+	if params["prompt"] != "a heron, misty" || params["num_frames"] != float64(49) {
+		t.Errorf("job params = %v", params)
+	}
+
+	// Without variables or a preset, braces are literal text
+	req = i2vRequest("a sign reading {{style}}, no variables here")
+	if code := h.post("/api/workflows/i2v", req, &job); code != http.StatusOK {
+		t.Fatalf("submit with literal braces: status %d", code)
+	}
+	h.waitForJob(job.ID)
+	if prompt := h.job(job.ID).Params["prompt"]; prompt != "a sign reading {{style}}, no variables here" {
+		t.Errorf("literal prompt = %v", prompt)
+	}
+}
+
+func TestEndToEndBenchmark(t *testing.T) {
+	h := newHarness(t)
+
+	if code := h.post("/api/admin/benchmark", api.BenchmarkRequest{Workflows: []string{"svi"}}, nil); code != http.StatusBadRequest {
+		t.Errorf("benchmark of a workflow without one: status %d", code)
+	}
+
+	var runs [2]api.BenchmarkRun
+	for i := range runs {
+		var run api.BenchmarkRun
+		req := api.BenchmarkRequest{Label: "run " + strconv.Itoa(i), Workflows: []string{"i2v"}}
+		if code := h.post("/api/admin/benchmark", req, &run); code != http.StatusAccepted {
+			t.Fatalf("start benchmark: status %d", code)
+		}
+		if run.Status != "running" || len(run.Results) != 1 || run.Results[0].JobID == "" {
+			t.Fatalf("started run = %+v", run)
+		}
+		h.waitForJob(run.Results[0].JobID)
+		if label := h.job(run.Results[0].JobID).Label; label != "Benchmark i2v-480p" {
+			t.Errorf("benchmark job label = %q", label)
+		}
+		if code := h.do(http.MethodGet, "/api/admin/benchmarks/"+run.ID, nil, nil, &runs[i]); code != http.StatusOK {
+			t.Fatalf("get benchmark: status %d", code)
+		}
+	}
+
+	first, second := runs[0], runs[1]
+	if first.Status != "completed" || first.Results[0].Status != "completed" || first.Results[0].BaselineRunID != "" {
+		t.Errorf("first run = %+v", first)
+	}
+	if second.Results[0].BaselineRunID != first.ID || second.Results[0].ChangePct == nil {
+		t.Errorf("second run result = %+v, want a baseline from %s", second.Results[0], first.ID)
+	}
+
+	var list []api.BenchmarkRun
+	h.do(http.MethodGet, "/api/admin/benchmarks", nil, nil, &list)
+	if len(list) != 2 || list[0].ID != second.ID || list[0].Environment.Version == "" {
+		t.Errorf("benchmark list = %+v", list)
+	}
+}
+
+func TestEndToEndConcat(t *testing.T) {
+	h := newHarness(t)
+	clip := h.submitI2V("first clip")
+	h.waitForJob(clip)
+
+	for name, req := range map[string]api.ConcatRequest{
+		"one clip":    {JobIDs: []string{clip}},
+		"unknown job": {JobIDs: []string{clip, "missing"}},
+		"bad codec":   {JobIDs: []string{clip, clip}, Encoding: &video.Encoding{Codec: "av1"}},
+	} {
+		if code := h.post("/api/outputs/concat", req, nil); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", name, code)
+		}
+	}
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		var apiErr apierr.Error
+		if code := h.post("/api/outputs/concat", api.ConcatRequest{JobIDs: []string{clip, clip}}, &apiErr); code != http.StatusServiceUnavailable || apiErr.Code != apierr.CodeFFmpegMissing {
+			t.Errorf("concat without ffmpeg: status %d, code %s", code, apiErr.Code)
+		}
+		t.Skip("ffmpeg not installed")
+	}
+
+	// The mock worker's videos are stubs, so join real ones
+	var ids []string
+	for i, seconds := range []string{"2", "3"} {
+		path := filepath.Join(h.cfg.OutputsDir, "clip"+strconv.Itoa(i)+".mp4")
+		out, err := exec.Command("ffmpeg", "-y", "-loglevel", "error", "-f", "lavfi",
+			"-i", "testsrc2=size=160x96:rate=16", "-t", seconds, "-pix_fmt", "yuv420p", path).CombinedOutput()
+		if err != nil {
+			t.Fatalf("make clip: %v: %s", err, out)
+		}
+		id := "clip-" + strconv.Itoa(i)
+		if err := h.db.CreateJob(context.Background(), &db.Job{ID: id, Type: "i2v", Status: "pending", Params: "{}"}); err != nil {
+			t.Fatal(err)
+		}
+		h.db.CompleteJob(context.Background(), id, path)
+		ids = append(ids, id)
+	}
+
+	var job api.JobResponse
+	if code := h.post("/api/outputs/concat", api.ConcatRequest{JobIDs: ids, Crossfade: 0.5}, &job); code != http.StatusAccepted {
+		t.Fatalf("concat: status %d", code)
+	}
+	h.waitForJob(job.ID)
+	joined := h.job(job.ID)
+	if joined.Status != "completed" || joined.Type != api.ConcatJobType || joined.Output == nil {
+		t.Fatalf("concat job = %+v", joined)
+	}
+	clipInfo, err := video.Probe(context.Background(), joined.Output.Path)
+	if err != nil {
+		t.Fatalf("probe joined video: %v", err)
+	}
+	if clipInfo.Duration < 4.3 || clipInfo.Duration > 4.7 {
+		t.Errorf("joined video is %.2fs, want 4.5s", clipInfo.Duration)
+	}
+}
+
+func TestEndToEndPipeline(t *testing.T) {
+	h := newHarness(t)
+
+	// Refused outright: YAML with a workflow that doesn't exist, a cycle,
+	// and a pipeline whose only step its workflow refuses
+	resp, err := http.Post(h.server.URL+"/api/pipelines", "application/yaml",
+		strings.NewReader("steps:\n  - id: a\n    type: upscale\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var apiErr apierr.Error
+	json.NewDecoder(resp.Body).Decode(&apiErr)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || apiErr.FieldErrors["steps[0].type"] == "" {
+		t.Errorf("unknown workflow: status %d, %+v", resp.StatusCode, apiErr)
+	}
+	cycle := map[string]interface{}{"steps": []map[string]interface{}{
+		{"id": "a", "type": "i2v", "needs": []string{"b"}},
+		{"id": "b", "type": "i2v", "needs": []string{"a"}},
+	}}
+	if code := h.post("/api/pipelines", cycle, nil); code != http.StatusBadRequest {
+		t.Errorf("cycle: status %d, want 400", code)
+	}
+	refused := map[string]interface{}{"steps": []map[string]interface{}{
+		{"id": "a", "type": "i2v", "params": map[string]interface{}{"prompt": "no image"}},
+	}}
+	if code := h.post("/api/pipelines", refused, &apiErr); code != http.StatusBadRequest || apiErr.FieldErrors["input_image"] == "" {
+		t.Errorf("refused step: status %d, %+v", code, apiErr)
+	}
+
+	follow := i2vRequest("after {{steps.clip.job_id}}")
+	spec := map[string]interface{}{
+		"name": "two clips",
+		"steps": []map[string]interface{}{
+			{"id": "clip", "type": "i2v", "params": i2vRequest("first clip")},
+			{"id": "follow", "type": "i2v", "params": follow},
+			{"id": "broken", "type": "i2v", "params": i2vRequest("please " + worker.MockFailMarker)},
+			{"id": "never", "type": "i2v", "needs": []string{"broken"}, "params": i2vRequest("never runs")},
+		},
+	}
+	var p api.Pipeline
+	if code := h.post("/api/pipelines", spec, &p); code != http.StatusAccepted {
+		t.Fatalf("create pipeline: status %d", code)
+	}
+	var statuses []string
+	for _, st := range p.Steps {
+		statuses = append(statuses, st.Status)
+	}
+	if p.Status != "running" || strings.Join(statuses, ",") != "queued,waiting,queued,waiting" {
+		t.Fatalf("created pipeline = %+v", p)
+	}
+
+	deadline := time.Now().Add(e2eTimeout)
+	for p.Status == "running" {
+		if time.Now().After(deadline) {
+			t.Fatalf("pipeline still running: %+v", p)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if code := h.do(http.MethodGet, "/api/pipelines/"+p.ID, nil, nil, &p); code != http.StatusOK {
+			t.Fatalf("get pipeline: status %d", code)
+		}
+	}
+
+	steps := make(map[string]api.PipelineStep)
+	for _, st := range p.Steps {
+		steps[st.ID] = st
+	}
+	if p.Status != "failed" || steps["clip"].Status != "completed" || steps["follow"].Status != "completed" ||
+		steps["broken"].Status != "failed" || steps["never"].Status != "skipped" || steps["never"].JobID != "" {
+		t.Errorf("finished pipeline = %+v", p)
+	}
+	if prompt := h.job(steps["follow"].JobID).Params["prompt"]; prompt != "after "+steps["clip"].JobID {
+		t.Errorf("follow-up prompt = %v, want the first clip's job ID", prompt)
+	}
+	// Only the step nothing depends on counts as the pipeline's output
+	if len(p.Outputs) != 1 || steps["follow"].Output == nil || p.Outputs[0].Path != steps["follow"].Output.Path {
+		t.Errorf("pipeline outputs = %+v", p.Outputs)
+	}
+
+	var list []api.Pipeline
+	h.do(http.MethodGet, "/api/pipelines", nil, nil, &list)
+	if len(list) != 1 || list[0].ID != p.ID {
+		t.Errorf("pipeline list = %+v", list)
+	}
+}
+
+func TestEndToEndDashboard(t *testing.T) {
+	h := newHarness(t)
+	jobID := h.submitI2V("dashboard")
+
+	// Wherever the job is by now, the snapshot accounts for it
+	var dash api.DashboardResponse
+	if code := h.do(http.MethodGet, "/api/dashboard", nil, nil, &dash); code != http.StatusOK {
+		t.Fatalf("get dashboard: status %d", code)
+	}
+	seen := slices.Contains(dash.Queue.Running, jobID) ||
+		slices.ContainsFunc(dash.Queue.Jobs, func(j api.QueuedJob) bool { return j.ID == jobID }) ||
+		slices.ContainsFunc(dash.Jobs, func(j api.DashboardJob) bool { return j.ID == jobID })
+	if !seen && h.job(jobID).Status != "completed" {
+		t.Errorf("dashboard lacks unfinished job %s: %+v", jobID, dash)
+	}
+	if dash.QueueDepth != len(dash.Queue.Jobs) || len(dash.Workers) != h.cfg.WorkerCount || dash.GeneratedAt == "" {
+		t.Errorf("dashboard = %+v", dash)
+	}
+
+	h.waitForJob(jobID)
+	h.do(http.MethodGet, "/api/dashboard", nil, nil, &dash)
+	if len(dash.Jobs) != 0 || dash.QueueDepth != 0 || len(dash.Queue.Running) != 0 || dash.Downloads == nil {
+		t.Errorf("dashboard after the job = %+v", dash)
+	}
+}
+
+func TestEndToEndStats(t *testing.T) {
+	h := newHarness(t)
+	jobID := h.submitI2V("stats")
+	h.waitForJob(jobID)
+
+	var stats api.StatsResponse
+	if code := h.do(http.MethodGet, "/api/stats?days=7", nil, nil, &stats); code != http.StatusOK {
+		t.Fatalf("get stats: status %d", code)
+	}
+	if stats.Days != 7 || stats.Totals.Jobs != 1 || stats.Totals.Completed != 1 || len(stats.ByType) != 1 || stats.ByType[0].Type != "i2v" {
+		t.Errorf("stats = %+v", stats)
+	}
+	// No GPU is sampled in mock mode, so nothing is metered
+	if job := h.job(jobID); job.GPUSeconds != nil || stats.Totals.MeteredJobs != 0 {
+		t.Errorf("expected no metering without GPU samples, got %+v", stats.Totals)
+	}
+
+	if code := h.do(http.MethodGet, "/api/stats?days=0", nil, nil, nil); code != http.StatusBadRequest {
+		t.Errorf("days=0: status %d", code)
+	}
+}
+
+func TestEndToEndRemapModel(t *testing.T) {
+	h := newHarness(t)
+	defer models.SetRemappedURLs(nil)
+
+	// Names can hold slashes
+	name := "dolphin-mistral-24b/special_tokens_map.json"
+	moved := "https://huggingface.co/new-org/Dolphin/resolve/main/special_tokens_map.json"
+	var resp api.RemapModelResponse
+	if code := h.do(http.MethodPatch, "/api/models/required/"+name, nil, api.RemapModelRequest{URL: moved}, &resp); code != http.StatusOK {
+		t.Fatalf("remap: status %d", code)
+	}
+	if resp.Name != name || resp.URL != moved || resp.PreviousURL == moved || resp.PreviousURL == "" || resp.Moved {
+		t.Errorf("remap = %+v", resp)
+	}
+	if urls, err := h.db.ListModelURLs(context.Background()); err != nil || urls[name] != moved {
+		t.Errorf("remap not saved: %v %v", urls, err)
+	}
+	var downloads []api.DownloadStatus
+	h.do(http.MethodGet, "/api/downloads", nil, nil, &downloads)
+	if !slices.ContainsFunc(downloads, func(d api.DownloadStatus) bool { return d.Name == name && d.URL == moved }) {
+		t.Errorf("downloads don't list the new URL: %+v", downloads)
+	}
+
+	// An empty URL restores the manifest's
+	if code := h.do(http.MethodPatch, "/api/models/required/"+name, nil, api.RemapModelRequest{}, &resp); code != http.StatusOK || resp.PreviousURL != moved || resp.URL == moved {
+		t.Errorf("restore: status %d, %+v", code, resp)
+	}
+	if urls, _ := h.db.ListModelURLs(context.Background()); len(urls) != 0 {
+		t.Errorf("remap not dropped: %v", urls)
+	}
+
+	if code := h.do(http.MethodPatch, "/api/models/required/"+name, nil, api.RemapModelRequest{URL: "ftp://example.com/x"}, nil); code != http.StatusBadRequest {
+		t.Errorf("bad URL: status %d", code)
+	}
+	if code := h.do(http.MethodPatch, "/api/models/required/unknown.safetensors", nil, api.RemapModelRequest{URL: moved}, nil); code != http.StatusNotFound {
+		t.Errorf("unknown model: status %d", code)
+	}
+}
+
+func TestEndToEndPreviewStream(t *testing.T) {
+	h := newHarness(t)
+	jobID := h.submitI2V("preview")
+	h.waitForJob(jobID)
+
+	// Mock workers send no previews, and a finished job's frame is dropped;
+	// store a PNG one as a worker would
+	var frame bytes.Buffer
+	png.Encode(&frame, image.NewGray(image.Rect(0, 0, 16, 16)))
+	if err := h.db.SaveJobPreview(context.Background(), jobID, frame.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A finished job's stream sends any frame left, as JPEG, and ends
+	resp, err := http.Get(h.server.URL + "/api/jobs/" + jobID + "/preview.mjpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if resp.StatusCode != http.StatusOK || err != nil || mediaType != "multipart/x-mixed-replace" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	part, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	data, _ := io.ReadAll(part)
+	if part.Header.Get("Content-Type") != "image/jpeg" || http.DetectContentType(data) != "image/jpeg" {
+		t.Errorf("frame is %s (%s)", part.Header.Get("Content-Type"), http.DetectContentType(data))
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("expected the stream to end, got %v", err)
+	}
+
+	// So does an interrupted job's
+	ctx := context.Background()
+	if err := h.db.CreateJob(ctx, &db.Job{ID: "interrupted", Type: "i2v", Status: "running", Params: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.db.InterruptJobs(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	interrupted, err := http.Get(h.server.URL + "/api/jobs/interrupted/preview.mjpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer interrupted.Body.Close()
+	if _, err := io.ReadAll(interrupted.Body); err != nil {
+		t.Errorf("interrupted job's stream: %v", err)
+	}
+
+	if code := h.do(http.MethodGet, "/api/jobs/missing/preview.mjpeg", nil, nil, nil); code != http.StatusNotFound {
+		t.Errorf("missing job: status %d", code)
+	}
+}
+
+func TestEndToEndRequestLog(t *testing.T) {
+	t.Setenv("DIFFBOX_REQUEST_LOG_DAYS", "1")
+	h := newHarness(t)
+
+	if code := h.do(http.MethodGet, "/api/jobs/missing", nil, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("get missing job: status %d", code)
+	}
+
+	// Entries are written in batches, so wait for the next one
+	var resp api.RequestLogResponse
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if code := h.do(http.MethodGet, "/api/admin/requests?path=/api/jobs/&status=4xx", nil, nil, &resp); code != http.StatusOK {
+			t.Fatalf("list requests: status %d", code)
+		}
+		if len(resp.Requests) > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !resp.Enabled || resp.RetentionDays != 1 || len(resp.Requests) != 1 {
+		t.Fatalf("requests = %+v", resp)
+	}
+	if e := resp.Requests[0]; e.Method != http.MethodGet || e.Path != "/api/jobs/missing" || e.Status != http.StatusNotFound || e.RequestID == "" {
+		t.Errorf("entry = %+v", e)
+	}
+
+	if code := h.do(http.MethodGet, "/api/admin/requests?status=6xx", nil, nil, nil); code != http.StatusBadRequest {
+		t.Errorf("status=6xx: status %d", code)
+	}
+}
+
+func TestEndToEndRateLimit(t *testing.T) {
+	t.Setenv("DIFFBOX_RATE_LIMIT", "3")
+	h := newHarness(t)
+
+	// Health checks aren't counted
+	for i := 0; i < 5; i++ {
+		if code := h.do(http.MethodGet, "/api/health", nil, nil, nil); code != http.StatusOK {
+			t.Fatalf("health: status %d", code)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if code := h.do(http.MethodGet, "/api/jobs", nil, nil, nil); code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, code)
+		}
+	}
+
+	resp, err := http.Get(h.server.URL + "/api/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var apiErr apierr.Error
+	json.NewDecoder(resp.Body).Decode(&apiErr)
+	if resp.StatusCode != http.StatusTooManyRequests || apiErr.Code != apierr.CodeRateLimited || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("over the limit: status %d, code %q, Retry-After %q", resp.StatusCode, apiErr.Code, resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestEndToEndDiagnostics(t *testing.T) {
+	h := newHarness(t)
+	jobID := h.submitI2V("diagnostics")
+	h.waitForJob(jobID)
+
+	// Dumps already on disk are bundled
+	crashDir := filepath.Join(h.cfg.DataDir, "crashes")
+	if err := os.MkdirAll(crashDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(crashDir, "20260101T000000.000000000-worker-0.json"), []byte(`{"worker_id":0}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logtail.Server.Add(`"GET http://localhost/ws?token=e2e-secret-token HTTP/1.1" 101`)
+
+	resp, err := http.Get(h.server.URL + "/api/admin/diagnostics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("diagnostics: status %d, %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("read bundle: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	for _, name := range []string{"summary.json", "config.json", "jobs.json", "workers.json", "gpu.json", "database.json", "logs/server.log", "goroutines.txt", "crashes/20260101T000000.000000000-worker-0.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("bundle is missing %s", name)
+		}
+	}
+
+	if bytes.Contains(files["logs/server.log"], []byte("e2e-secret-token")) {
+		t.Error("server.log holds an API token")
+	}
+	if !bytes.Contains(files["logs/server.log"], []byte("ws?token=[redacted]")) {
+		t.Error("server.log lacks the redacted request")
+	}
+
+	var summary api.DiagnosticsSummary
+	if err := json.Unmarshal(files["summary.json"], &summary); err != nil || len(summary.Errors) != 0 {
+		t.Errorf("summary = %+v (%v)", summary, err)
+	}
+	var jobs []api.DiagnosticsJob
+	json.Unmarshal(files["jobs.json"], &jobs)
+	if len(jobs) != 1 || jobs[0].ID != jobID || jobs[0].Status != "completed" || len(jobs[0].Events) == 0 {
+		t.Errorf("jobs = %+v", jobs)
+	}
+	if bytes.Contains(files["jobs.json"], []byte("diagnostics")) {
+		t.Error("jobs.json holds the prompt")
+	}
+	var database api.DiagnosticsDatabase
+	json.Unmarshal(files["database.json"], &database)
+	if database.Rows["jobs"] != 1 {
+		t.Errorf("database = %+v", database)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/api"
+	"github.com/druarnfield/diffbox/internal/config"
+)
+
+// healthcheckTimeout stays under the usual probe timeouts so the probe
+// reports a clean failure rather than being killed
+const healthcheckTimeout = 5 * time.Second
+
+// runHealthcheck asks the local server whether it is ready and returns
+// the exit code, so container probes don't need curl in the image
+func runHealthcheck() int {
+	url := fmt.Sprintf("http://127.0.0.1:%s/readyz", config.ListenPort())
+	client := &http.Client{Timeout: healthcheckTimeout}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Printf("unhealthy: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	var ready api.ReadyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ready); err != nil {
+		fmt.Printf("unhealthy: %s returned %s\n", url, resp.Status)
+		return 1
+	}
+	if resp.StatusCode != http.StatusOK || !ready.Ready {
+		names := make([]string, 0, len(ready.Checks))
+		for name := range ready.Checks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Println("unhealthy:")
+		for _, name := range names {
+			fmt.Printf("  %s: %s\n", name, ready.Checks[name])
+		}
+		return 1
+	}
+
+	fmt.Println("ready")
+	return 0
+}
@@ -2,26 +2,48 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strconv"
-	"syscall"
+	"sync"
 	"time"
 
 	"github.com/druarnfield/diffbox/internal/api"
 	"github.com/druarnfield/diffbox/internal/aria2"
+	"github.com/druarnfield/diffbox/internal/auth"
 	"github.com/druarnfield/diffbox/internal/config"
 	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/eta"
+	"github.com/druarnfield/diffbox/internal/gpu"
+	"github.com/druarnfield/diffbox/internal/logtail"
 	"github.com/druarnfield/diffbox/internal/models"
+	"github.com/druarnfield/diffbox/internal/proc"
 	"github.com/druarnfield/diffbox/internal/queue"
+	"github.com/druarnfield/diffbox/internal/tracing"
 	"github.com/druarnfield/diffbox/internal/worker"
+	"github.com/google/uuid"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "doctor", "--check":
+			os.Exit(runDoctor())
+		case "healthcheck":
+			os.Exit(runHealthcheck())
+		case worker.MockWorkerCommand:
+			os.Exit(runMockWorker())
+		}
+	}
+
+	// Keep recent log output for diagnostics bundles
+	logtail.Capture()
 	log.Println("Starting diffbox...")
 
 	// Load configuration
@@ -30,6 +52,19 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Initialize tracing (no-op unless enabled)
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.TracingEnabled, "0.1.0")
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Tracing shutdown error: %v", err)
+		}
+	}()
+
 	// Initialize database
 	database, err := db.New(cfg.DataDir + "/diffbox.db")
 	if err != nil {
@@ -37,35 +72,446 @@ func main() {
 	}
 	defer database.Close()
 
-	// Clear stale jobs from previous session (ephemeral job policy)
-	if err := database.ClearJobs(); err != nil {
-		log.Printf("Warning: failed to clear stale jobs: %v", err)
+	// Jobs started before the last exit can't resume; queued ones are
+	// requeued once the workers are up. History is kept.
+	if ids, err := database.RecoverJobs(context.Background()); err != nil {
+		log.Printf("Warning: failed to recover stale jobs: %v", err)
+	} else if len(ids) > 0 {
+		log.Printf("Marked %d jobs from the previous run as interrupted", len(ids))
+	}
+
+	// Bootstrap an admin user so a fresh multi-user install isn't locked out
+	if cfg.AuthEnabled {
+		if err := ensureAdminUser(database, cfg.AdminToken); err != nil {
+			log.Fatalf("Failed to bootstrap admin user: %v", err)
+		}
+	}
+
+	if cfg.Simulate {
+		log.Printf("Simulation mode: workers are simulated at %gx speed and write placeholder outputs", cfg.SimulateSpeed)
+	}
+
+	q, aria2Client, stopServices := startServices(cfg)
+	defer stopServices()
+
+	a, err := newApp(cfg, database, q, aria2Client)
+	if err != nil {
+		log.Fatalf("Failed to start: %v", err)
+	}
+	defer a.close()
+
+	// Create server
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: a.handler,
+	}
+
+	// Start server in background
+	go func() {
+		log.Printf("Server listening on :%s", cfg.Port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	// Graceful shutdown
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, proc.ShutdownSignals...)
+
+	<-done
+	log.Println("Shutting down...")
+
+	// Stop intake: submissions are turned away and queued jobs stay put,
+	// while the API keeps serving so clients can watch the drain
+	a.api.StopIntake(context.Background(), "Server is shutting down")
+	a.draining.Store(true)
+
+	// Let running jobs finish; a second signal skips the wait
+	drainJobs(database, cfg.ShutdownDrainTimeout, done)
+
+	// Anything still running is kept as interrupted so it can be found and
+	// resubmitted; queued jobs keep their place for the next start
+	interrupted, err := database.InterruptStartedJobs(context.Background(), "interrupted by server shutdown")
+	if err != nil {
+		log.Printf("Failed to mark unfinished jobs as interrupted: %v", err)
+	}
+	for _, id := range interrupted {
+		recordEnergy(context.Background(), database, a.meter, id)
+		a.hub.BroadcastJobError(api.JobError{JobID: id, Error: "Interrupted by server shutdown"})
+	}
+	if len(interrupted) > 0 {
+		log.Printf("Marked %d unfinished jobs as interrupted", len(interrupted))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+
+	// Deferred teardown then stops the workers, aria2 and Valkey, in that
+	// order, and closes the database last
+	log.Println("Goodbye!")
+}
+
+// drainJobs waits for dispatched jobs to finish, giving up after timeout
+// or when force receives another signal
+func drainJobs(database *db.DB, timeout time.Duration, force <-chan os.Signal) {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastLog := time.Time{}
+
+	for {
+		running, err := database.ListDispatchedJobs(context.Background())
+		if err != nil {
+			log.Printf("Failed to check running jobs, not waiting for them: %v", err)
+			return
+		}
+		if len(running) == 0 {
+			return
+		}
+		if time.Since(lastLog) >= 10*time.Second {
+			log.Printf("Waiting for %d running jobs to finish (up to %s, signal again to skip)", len(running), timeout)
+			lastLog = time.Now()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			log.Printf("Drain window of %s elapsed with %d jobs still running", timeout, len(running))
+			return
+		case <-force:
+			log.Println("Skipping drain")
+			return
+		}
+	}
+}
+
+// jobETAs estimates when running jobs will finish from their progress and
+// the history of similar jobs. What that takes from the database is read
+// once per job rather than on every progress report.
+type jobETAs struct {
+	database *db.DB
+
+	mu   sync.Mutex
+	jobs map[string]*jobETA
+}
+
+type jobETA struct {
+	started  time.Time
+	expected time.Duration
+	stored   time.Time // finish time last written to the database
+}
+
+func newJobETAs(database *db.DB) *jobETAs {
+	return &jobETAs{database: database, jobs: make(map[string]*jobETA)}
+}
+
+// Update estimates the time left for a running job, stores the finish time
+// if it moved and returns the time left
+func (e *jobETAs) Update(ctx context.Context, jobID string, progress float64) (time.Duration, bool) {
+	e.mu.Lock()
+	est, ok := e.jobs[jobID]
+	e.mu.Unlock()
+	if !ok {
+		job, err := e.database.GetJob(ctx, jobID)
+		if err != nil || job.StartedAt.IsZero() {
+			return 0, false
+		}
+		expected, _, err := e.database.ExpectedJobDuration(ctx, job.Type, eta.ResolutionKey(job.Params))
+		if err != nil {
+			log.Printf("Failed to load duration history for job %s: %v", jobID, err)
+		}
+		est = &jobETA{started: job.StartedAt, expected: expected}
+		e.mu.Lock()
+		e.jobs[jobID] = est
+		e.mu.Unlock()
+	}
+
+	remaining, ok := eta.Remaining(progress, time.Since(est.started), est.expected)
+	if !ok {
+		return 0, false
+	}
+	finish := time.Now().Add(remaining)
+	e.mu.Lock()
+	moved := finish.Sub(est.stored).Abs() >= time.Second
+	if moved {
+		est.stored = finish
+	}
+	e.mu.Unlock()
+	if moved {
+		if err := e.database.SetJobETA(ctx, jobID, finish); err != nil {
+			log.Printf("Failed to store ETA for job %s: %v", jobID, err)
+		}
+	}
+	return remaining, true
+}
+
+// Forget drops a finished job
+func (e *jobETAs) Forget(jobID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.jobs, jobID)
+}
+
+// previewSaveInterval is the least time between stored preview frames of
+// a job. Every frame is still broadcast.
+const previewSaveInterval = time.Second
+
+// previewThrottle tracks when each job's preview frame was last stored
+type previewThrottle struct {
+	mu    sync.Mutex
+	saved map[string]time.Time
+}
+
+func newPreviewThrottle() *previewThrottle {
+	return &previewThrottle{saved: make(map[string]time.Time)}
+}
+
+// Allow reports whether a preview of the job may be stored now, and if so
+// counts it as stored
+func (p *previewThrottle) Allow(jobID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if last, ok := p.saved[jobID]; ok && time.Since(last) < previewSaveInterval {
+		return false
+	}
+	p.saved[jobID] = time.Now()
+	return true
+}
+
+// Forget drops a finished job
+func (p *previewThrottle) Forget(jobID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.saved, jobID)
+}
+
+// recordJobDuration adds a completed job's run time to the history used
+// for ETAs
+func recordJobDuration(ctx context.Context, database *db.DB, jobID string) {
+	job, err := database.GetJob(ctx, jobID)
+	if err != nil || job.StartedAt.IsZero() {
+		return
+	}
+	err = database.RecordJobDuration(ctx, job.Type, eta.ResolutionKey(job.Params), time.Since(job.StartedAt))
+	if err != nil {
+		log.Printf("Failed to record duration of job %s: %v", jobID, err)
+	}
+}
+
+// queueOrder returns the queued job IDs in the order to try dispatching
+// them. With fair scheduling, users' jobs are interleaved by GPU time used
+// over the last day; otherwise the queue order stands.
+func queueOrder(ctx context.Context, database *db.DB, fair bool) ([]string, error) {
+	if !fair {
+		return database.ListQueuedJobIDs(ctx)
+	}
+	owners, err := database.ListQueuedJobOwners(ctx)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := database.GPUSecondsByUser(ctx, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]worker.QueuedJob, len(owners))
+	for i, o := range owners {
+		jobs[i] = worker.QueuedJob{ID: o.ID, UserID: o.UserID}
+	}
+	return worker.FairOrder(jobs, usage, worker.FairShareCost), nil
+}
+
+// recordOutputSize stores the size of a job's output for storage quotas
+func recordOutputSize(ctx context.Context, database *db.DB, jobID, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("Failed to stat output of job %s: %v", jobID, err)
+		return
+	}
+	if err := database.SetJobOutputSize(ctx, jobID, info.Size()); err != nil {
+		log.Printf("Failed to record output size of job %s: %v", jobID, err)
+	}
+}
+
+// recordEnergy stops metering a job and stores its share of GPU time and
+// power draw, if any GPU reading was taken while it ran
+func recordEnergy(ctx context.Context, database *db.DB, meter *gpu.Meter, jobID string) {
+	usage, ok := meter.Stop(jobID)
+	if !ok || !usage.Sampled {
+		return
+	}
+	if err := database.SetJobEnergy(ctx, jobID, usage.GPUSeconds, usage.EnergyWh); err != nil {
+		log.Printf("Failed to record energy of job %s: %v", jobID, err)
+	}
+}
+
+// recordModelUse marks the models a job type needs as used now
+func recordModelUse(ctx context.Context, database *db.DB, jobType string) {
+	var names []string
+	for _, m := range models.ModelsForWorkflow(models.WorkflowForJobType(jobType)) {
+		names = append(names, m.Name)
+	}
+	if err := database.RecordModelUse(ctx, names); err != nil {
+		log.Printf("Failed to record model use for %s: %v", jobType, err)
+	}
+}
+
+// modelArchiveInterval is how often unused models are checked for archiving
+const modelArchiveInterval = 24 * time.Hour
+
+// runModelArchiver moves unpinned models unused for
+// cfg.ModelArchiveAfterDays into the archive directory once a day. It only
+// runs while no jobs are queued, so a file is never moved out from under a
+// running job.
+func runModelArchiver(ctx context.Context, database *db.DB, downloader *models.Downloader, cfg *config.Config) {
+	ticker := time.NewTicker(modelArchiveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		counts, err := database.CountActiveJobs(ctx)
+		if err != nil {
+			log.Printf("Model archive: failed to count jobs: %v", err)
+			continue
+		}
+		if counts["pending"]+counts["waiting_models"]+counts["running"] > 0 {
+			continue
+		}
+
+		records, err := database.ListModelUsage(ctx)
+		if err != nil {
+			log.Printf("Model archive: failed to load usage: %v", err)
+			continue
+		}
+		usage := make(map[string]models.Usage, len(records))
+		for name, rec := range records {
+			u := models.Usage{Pinned: rec.Pinned}
+			if rec.LastUsedAt != nil {
+				u.LastUsed = *rec.LastUsedAt
+			}
+			usage[name] = u
+		}
+
+		minAge := time.Duration(cfg.ModelArchiveAfterDays) * 24 * time.Hour
+		for _, sg := range models.UnusedModels(cfg.ModelsDir, usage, minAge, time.Now()) {
+			if err := downloader.Archive(sg.Name); err != nil {
+				log.Printf("Model archive: failed to archive %s: %v", sg.Name, err)
+				continue
+			}
+			log.Printf("Model archive: archived %s (%s)", sg.Name, sg.Message)
+		}
+	}
+}
+
+// adminUserKey is the config key holding the bootstrap admin's user ID
+const adminUserKey = "bootstrap:admin_user"
+
+// ensureAdminUser makes the configured admin token valid for the bootstrap
+// admin user, creating the user on first run and rotating its token if the
+// environment value changed
+func ensureAdminUser(database *db.DB, token string) error {
+	if token == "" {
+		log.Println("Warning: auth is enabled but DIFFBOX_ADMIN_TOKEN is not set; only existing users can sign in")
+		return nil
+	}
+
+	ctx := context.Background()
+	hash := auth.HashToken(token)
+	existing, err := database.GetUserByTokenHash(ctx, hash)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+
+	users, err := database.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	adminID, err := database.GetConfig(ctx, adminUserKey)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if adminID == "" {
+		// Installs from before the ID was kept named their admin "admin"
+		for _, u := range users {
+			if u.Name == "admin" && u.Role == string(auth.RoleAdmin) {
+				adminID = u.ID
+			}
+		}
+	}
+	if adminID != "" {
+		rotated, err := database.SetUserTokenHash(ctx, adminID, hash)
+		if err != nil {
+			return err
+		}
+		if rotated {
+			log.Println("Rotated admin user token from DIFFBOX_ADMIN_TOKEN")
+			return database.SetConfig(ctx, adminUserKey, adminID)
+		}
+	}
+
+	// Names are unique, and a user may already go by "admin"
+	taken := make(map[string]bool, len(users))
+	for _, u := range users {
+		taken[u.Name] = true
+	}
+	name := "admin"
+	for i := 2; taken[name]; i++ {
+		name = fmt.Sprintf("admin-%d", i)
+	}
+
+	user := &db.User{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Role:      string(auth.RoleAdmin),
+		TokenHash: hash,
+	}
+	if err := database.CreateUser(ctx, user); err != nil {
+		return err
+	}
+	log.Printf("Created admin user %q from DIFFBOX_ADMIN_TOKEN", name)
+	return database.SetConfig(ctx, adminUserKey, user.ID)
+}
+
+// startServices starts Valkey and aria2 and connects to them, or in test
+// mode returns in-process fakes of both. stop shuts them down.
+func startServices(cfg *config.Config) (q queue.Queue, aria2Client aria2.RPC, stop func()) {
+	if cfg.TestMode {
+		log.Println("Test mode: using an in-process queue and downloader and mock workers")
+		memory := queue.NewMemoryQueue()
+		return memory, aria2.NewFake(nil), func() { memory.Close() }
 	}
-	log.Println("Cleared stale jobs from database")
 
 	// Start Valkey (Redis)
 	valkeyProcess, err := startValkey(cfg)
 	if err != nil {
 		log.Fatalf("Failed to start Valkey: %v", err)
 	}
-	defer stopProcess(valkeyProcess)
 
 	// Wait for Valkey to be ready
 	time.Sleep(1 * time.Second)
 
 	// Initialize queue
-	q, err := queue.NewRedisQueue(cfg.ValkeyAddr)
+	redisQueue, err := queue.NewRedisQueue(cfg.ValkeyAddr)
 	if err != nil {
 		log.Fatalf("Failed to initialize queue: %v", err)
 	}
-	defer q.Close()
 
 	// Start aria2 daemon
 	aria2Process, err := startAria2(cfg)
 	if err != nil {
 		log.Fatalf("Failed to start aria2: %v", err)
 	}
-	defer stopProcess(aria2Process)
 
 	// Create aria2 client and wait for it to be ready
 	aria2Port, err := strconv.Atoi(cfg.Aria2Port)
@@ -73,7 +519,7 @@ func main() {
 		log.Fatalf("Invalid aria2 port: %v", err)
 	}
 	// Use 127.0.0.1 instead of localhost to avoid IPv6 resolution issues
-	aria2Client := aria2.NewClient("127.0.0.1", aria2Port, "")
+	client := aria2.NewClient("127.0.0.1", aria2Port, "")
 
 	// Give aria2 a moment to initialize before first connection attempt
 	time.Sleep(1 * time.Second)
@@ -87,7 +533,9 @@ func main() {
 			log.Fatalf("aria2 process exited prematurely with state: %v", aria2Process.ProcessState)
 		}
 
-		version, err := aria2Client.GetVersion()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		version, err := client.GetVersion(ctx)
+		cancel()
 		if err == nil {
 			log.Printf("aria2 is ready (version: %s)", version)
 			aria2Ready = true
@@ -101,146 +549,12 @@ func main() {
 		log.Fatalf("aria2 failed to become ready after 10 attempts. Last error: %v", lastErr)
 	}
 
-	// Create router (start webserver early so user can see progress)
-	router, wsHub := api.NewRouter(cfg, database, q, aria2Client)
-
-	// Create server
-	server := &http.Server{
-		Addr:    ":" + cfg.Port,
-		Handler: router,
-	}
-
-	// Start server in background
-	go func() {
-		log.Printf("Server listening on :%s", cfg.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
-		}
-	}()
-
-	// Download missing models in background (non-blocking)
-	go func() {
-		log.Println("Starting model download check...")
-		hfToken := os.Getenv("HF_TOKEN")
-		downloader := models.NewDownloader(aria2Client, cfg.ModelsDir, hfToken)
-		if err := downloader.CheckAndDownload(); err != nil {
-			log.Printf("Model download failed: %v", err)
-			log.Println("Server will continue running, but workflows may fail without models")
-		} else {
-			log.Println("All models ready!")
-		}
-	}()
-
-	// Start Python workers (they'll wait for models when processing jobs)
-	workerManager := worker.NewManager(cfg)
-	if err := workerManager.Start(); err != nil {
-		log.Fatalf("Failed to start workers: %v", err)
-	}
-	defer workerManager.Stop()
-
-	// Start queue consumer to dispatch jobs to workers
-	go func() {
-		log.Println("Starting queue consumer...")
-		err := q.Consume("jobs", "workers", "dispatcher", func(id string, data map[string]interface{}) error {
-			// Parse job data
-			jobID, _ := data["id"].(string)
-			jobType, _ := data["type"].(string)
-			params, _ := data["params"].(map[string]interface{})
-
-			// Submit to worker
-			job := &worker.JobRequest{
-				ID:     jobID,
-				Type:   jobType,
-				Params: params,
-			}
-
-			log.Printf("Dispatching job %s from queue to worker", jobID)
-			err := workerManager.SubmitJob(job)
-			if err != nil {
-				log.Printf("Job %s dispatch failed, retrying in 1s: %v", jobID, err)
-				time.Sleep(1 * time.Second)
-				err = workerManager.SubmitJob(job)
-				if err != nil {
-					log.Printf("Job %s dispatch retry failed, marking as failed: %v", jobID, err)
-					// Mark job as failed in database
-					if dbErr := database.FailJob(jobID, fmt.Sprintf("dispatch failed: %v", err)); dbErr != nil {
-						log.Printf("Failed to mark job %s as failed in DB: %v", jobID, dbErr)
-					}
-					// Broadcast failure to WebSocket
-					wsHub.BroadcastJobError(api.JobError{
-						JobID: jobID,
-						Error: fmt.Sprintf("Failed to dispatch job: %v", err),
-					})
-					return nil // Don't return error to avoid queue retry loops
-				}
-			}
-			return nil
-		})
-		if err != nil {
-			log.Printf("Queue consumer error: %v", err)
-		}
-	}()
-
-	// Wire up worker callbacks to WebSocket hub and database
-	workerManager.SetCallbacks(
-		// Progress callback
-		func(progress worker.ProgressUpdate) {
-			// Update database
-			if err := database.UpdateJobProgress(progress.JobID, progress.Progress, progress.Stage); err != nil {
-				log.Printf("Failed to update job progress in DB: %v", err)
-			}
-			// Broadcast to WebSocket
-			wsHub.BroadcastJobProgress(api.JobProgress{
-				JobID:    progress.JobID,
-				Progress: progress.Progress,
-				Stage:    progress.Stage,
-				Preview:  progress.Preview,
-			})
-		},
-		// Complete callback
-		func(result worker.JobResult) {
-			// Update database
-			if err := database.CompleteJob(result.JobID, result.Output); err != nil {
-				log.Printf("Failed to complete job in DB: %v", err)
-			}
-			// Broadcast to WebSocket
-			wsHub.BroadcastJobComplete(api.JobComplete{
-				JobID: result.JobID,
-				Output: api.JobOutput{
-					Type: "output",
-					Path: result.Output,
-				},
-			})
-		},
-		// Error callback
-		func(result worker.JobResult) {
-			// Update database
-			if err := database.FailJob(result.JobID, result.Error); err != nil {
-				log.Printf("Failed to mark job as failed in DB: %v", err)
-			}
-			// Broadcast to WebSocket
-			wsHub.BroadcastJobError(api.JobError{
-				JobID: result.JobID,
-				Error: result.Error,
-			})
-		},
-	)
-
-	// Graceful shutdown
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-
-	<-done
-	log.Println("Shutting down...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
+	// Stop aria2, then Valkey
+	return redisQueue, client, func() {
+		stopProcess(aria2Process)
+		redisQueue.Close()
+		stopProcess(valkeyProcess)
 	}
-
-	log.Println("Goodbye!")
 }
 
 func startValkey(cfg *config.Config) (*exec.Cmd, error) {
@@ -254,16 +568,29 @@ func startValkey(cfg *config.Config) (*exec.Cmd, error) {
 
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	proc.Prepare(cmd)
 
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("start valkey: %w", err)
 	}
+	if err := proc.Attach(cmd); err != nil {
+		log.Printf("Valkey may outlive diffbox: %v", err)
+	}
 
 	log.Printf("Valkey started with PID %d on port %s", cmd.Process.Pid, cfg.ValkeyPort)
 	return cmd, nil
 }
 
 func startAria2(cfg *config.Config) (*exec.Cmd, error) {
+	// The session keeps unfinished downloads, with their GIDs, across
+	// restarts; aria2 refuses to start if the input file is missing
+	session := filepath.Join(cfg.DataDir, "aria2.session")
+	if _, err := os.Stat(session); os.IsNotExist(err) {
+		if err := os.WriteFile(session, nil, 0644); err != nil {
+			return nil, fmt.Errorf("create aria2 session: %w", err)
+		}
+	}
+
 	cmd := exec.Command("aria2c",
 		"--enable-rpc",
 		"--rpc-listen-all=false",
@@ -278,37 +605,28 @@ func startAria2(cfg *config.Config) (*exec.Cmd, error) {
 		"--auto-file-renaming=false",
 		"--allow-overwrite=true",
 		fmt.Sprintf("--dir=%s", cfg.ModelsDir),
+		fmt.Sprintf("--input-file=%s", session),
+		fmt.Sprintf("--save-session=%s", session),
+		"--save-session-interval=10",
 		"--daemon=false",
 		"--console-log-level=notice",
 	)
 
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	proc.Prepare(cmd)
 
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("start aria2: %w", err)
 	}
+	if err := proc.Attach(cmd); err != nil {
+		log.Printf("aria2 may outlive diffbox: %v", err)
+	}
 
 	log.Printf("aria2 started with PID %d on port %s", cmd.Process.Pid, cfg.Aria2Port)
 	return cmd, nil
 }
 
 func stopProcess(cmd *exec.Cmd) {
-	if cmd == nil || cmd.Process == nil {
-		return
-	}
-
-	cmd.Process.Signal(syscall.SIGTERM)
-
-	done := make(chan error, 1)
-	go func() {
-		done <- cmd.Wait()
-	}()
-
-	select {
-	case <-done:
-		return
-	case <-time.After(5 * time.Second):
-		cmd.Process.Kill()
-	}
+	proc.Stop(cmd, 5*time.Second)
 }
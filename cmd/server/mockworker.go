@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/druarnfield/diffbox/internal/worker"
+)
+
+// runMockWorker runs this process as a test mode or simulated worker on
+// stdin and stdout and returns the exit code
+func runMockWorker() int {
+	flags := flag.NewFlagSet(worker.MockWorkerCommand, flag.ContinueOnError)
+	simulate := flags.Bool("simulate", false, "pace jobs like the real workflows")
+	speed := flags.Float64("speed", 1, "divide simulated durations by this")
+	if err := flags.Parse(os.Args[2:]); err != nil {
+		return 2
+	}
+
+	opts := worker.MockOptions{
+		OutputsDir: os.Getenv("DIFFBOX_OUTPUTS_DIR"),
+		Simulate:   *simulate,
+		Speed:      *speed,
+	}
+	if err := worker.RunMock(os.Stdin, os.Stdout, opts); err != nil {
+		log.Printf("Mock worker: %v", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,279 @@
+// Package admission decides whether a job can be accepted before it is
+// queued, so a request the server can't run is refused up front with the
+// resource at fault instead of failing deep in a worker.
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// Resource names a limit a job can be refused for
+type Resource string
+
+const (
+	ResourceVRAM  Resource = "vram"
+	ResourceDisk  Resource = "disk"
+	ResourceQueue Resource = "queue"
+	ResourceQuota Resource = "quota"
+	// Per-user GPU time and stored output, checked alongside the job quota
+	ResourceGPUTime Resource = "gpu_time"
+	ResourceStorage Resource = "storage"
+)
+
+// diskReserve is left free on the outputs volume on top of a job's output,
+// matching the reserve model downloads keep
+const diskReserve = 1 << 30
+
+// Per-workflow VRAM in MB for the resident fp8 weights, text encoder and
+// VAE, measured at the default settings on a 24GB card
+var baseVRAMMB = map[string]int64{
+	"i2v":  14000,
+	"svi":  14000,
+	"qwen": 16000,
+	"chat": 6000,
+}
+
+// Activation memory grows with the latent size. Video is charged per
+// megapixel-frame, images per megapixel.
+const (
+	videoMBPerMegapixelFrame = 60
+	imageMBPerMegapixel      = 1500
+)
+
+// Output bytes per pixel: h264 at the workers' CRF for video, an
+// uncompressed upper bound for PNG
+const (
+	videoBytesPerPixelFrame = 0.15
+	imageBytesPerPixel      = 4
+)
+
+// Job is what admission needs to know about a submitted job
+type Job struct {
+	Type   string
+	UserID string
+	Width  int
+	Height int
+	Frames int // per generated clip, for video
+	Clips  int // SVI clips; the output is Frames * Clips long
+	Tiled  bool
+	// OutputBytes is the expected output size for jobs that don't
+	// generate, such as joining clips
+	OutputBytes int64
+}
+
+// ParseJob reads the sizing params of a job. Missing sizes fall back to
+// the workflow defaults the API applies.
+func ParseJob(jobType, userID, params string) Job {
+	var p struct {
+		Width     int  `json:"width"`
+		Height    int  `json:"height"`
+		NumFrames int  `json:"num_frames"`
+		NumClips  int  `json:"num_clips"`
+		Tiled     bool `json:"tiled"`
+	}
+	json.Unmarshal([]byte(params), &p)
+
+	job := Job{Type: jobType, UserID: userID, Width: p.Width, Height: p.Height, Frames: p.NumFrames, Clips: p.NumClips, Tiled: p.Tiled}
+	switch jobType {
+	case "i2v", "svi":
+		if job.Width == 0 || job.Height == 0 {
+			job.Width, job.Height = 832, 480
+		}
+		if job.Frames == 0 {
+			job.Frames = 81
+		}
+	case "qwen":
+		if job.Width == 0 || job.Height == 0 {
+			job.Width, job.Height = 1024, 1024
+		}
+	}
+	if job.Clips < 1 {
+		job.Clips = 1
+	}
+	return job
+}
+
+func (j Job) video() bool {
+	return j.Type == "i2v" || j.Type == "svi"
+}
+
+// EstimateVRAM returns the peak VRAM in MB the job is expected to need.
+// Tiled VAE decoding roughly halves the activation peak.
+func EstimateVRAM(j Job) int64 {
+	base, ok := baseVRAMMB[j.Type]
+	if !ok {
+		return 0
+	}
+	megapixels := float64(j.Width*j.Height) / 1e6
+	var activations float64
+	switch {
+	case j.video():
+		activations = megapixels * float64(j.Frames) * videoMBPerMegapixelFrame
+	case j.Type == "qwen":
+		activations = megapixels * imageMBPerMegapixel
+	}
+	if j.Tiled {
+		activations /= 2
+	}
+	return base + int64(activations)
+}
+
+// EstimateOutput returns the bytes the job's output file is expected to take
+func EstimateOutput(j Job) int64 {
+	if j.OutputBytes > 0 {
+		return j.OutputBytes
+	}
+	pixels := float64(j.Width * j.Height)
+	switch {
+	case j.video():
+		return int64(pixels * float64(j.Frames*j.Clips) * videoBytesPerPixelFrame)
+	case j.Type == "qwen":
+		return int64(pixels * imageBytesPerPixel)
+	}
+	return 0
+}
+
+// Shortage is returned when a job is refused for lack of a resource
+type Shortage struct {
+	Resource  Resource
+	Required  int64
+	Available int64
+	Unit      string // "MB", "bytes" or "jobs"
+	Message   string
+}
+
+func (s *Shortage) Error() string {
+	return s.Message
+}
+
+// Limits are one user's quotas. Zero means unlimited.
+type Limits struct {
+	Jobs         int     // unfinished jobs
+	GPUSeconds   float64 // run time per rolling day
+	StorageBytes int64   // completed outputs
+}
+
+// Usage is what a user currently holds against their Limits
+type Usage struct {
+	Jobs         int
+	GPUSeconds   float64
+	StorageBytes int64
+}
+
+// Controller checks jobs against the server's resources. Any source left
+// nil, and any limit of zero, is not checked.
+type Controller struct {
+	// VRAM returns the memory in MB of the largest GPU, and false while
+	// it isn't known
+	VRAM func() (int64, bool)
+	// FreeDisk returns the bytes free on the outputs volume
+	FreeDisk func() (uint64, error)
+	// ActiveJobs counts unfinished jobs across all users
+	ActiveJobs func(ctx context.Context) (int, error)
+	// Quota returns a user's limits and usage. It is only consulted for
+	// jobs with a UserID, so single-user servers have no quotas.
+	Quota func(ctx context.Context, userID string) (Limits, Usage, error)
+
+	MaxQueued int
+}
+
+// Check returns a *Shortage for the first resource that can't take the
+// job, or nil if it can be queued. Errors reading a resource are logged
+// and that check is skipped, so a broken probe never blocks submissions.
+func (c *Controller) Check(ctx context.Context, j Job) error {
+	if c.VRAM != nil {
+		if total, ok := c.VRAM(); ok {
+			if need := EstimateVRAM(j); need > total {
+				return &Shortage{
+					Resource:  ResourceVRAM,
+					Required:  need,
+					Available: total,
+					Unit:      "MB",
+					Message: fmt.Sprintf("%s at %dx%d needs about %.1f GB of VRAM but the largest GPU has %.1f GB; lower the resolution or frame count, or enable tiled decoding",
+						j.Type, j.Width, j.Height, float64(need)/1000, float64(total)/1000),
+				}
+			}
+		}
+	}
+
+	if c.FreeDisk != nil {
+		free, err := c.FreeDisk()
+		if err != nil {
+			log.Printf("Admission: disk space check skipped: %v", err)
+		} else if need := EstimateOutput(j) + diskReserve; need > int64(free) {
+			return &Shortage{
+				Resource:  ResourceDisk,
+				Required:  need,
+				Available: int64(free),
+				Unit:      "bytes",
+				Message: fmt.Sprintf("outputs volume has %.1f GB free, below the %.1f GB this job needs including the reserve; free up space or purge archived jobs",
+					float64(free)/1e9, float64(need)/1e9),
+			}
+		}
+	}
+
+	if c.ActiveJobs != nil && c.MaxQueued > 0 {
+		if n, err := c.ActiveJobs(ctx); err != nil {
+			log.Printf("Admission: queue check skipped: %v", err)
+		} else if n >= c.MaxQueued {
+			return &Shortage{
+				Resource:  ResourceQueue,
+				Required:  int64(n + 1),
+				Available: int64(c.MaxQueued),
+				Unit:      "jobs",
+				Message:   fmt.Sprintf("queue is full with %d unfinished jobs (limit %d); retry when some finish", n, c.MaxQueued),
+			}
+		}
+	}
+
+	if c.Quota == nil || j.UserID == "" {
+		return nil
+	}
+	limits, usage, err := c.Quota(ctx, j.UserID)
+	if err != nil {
+		log.Printf("Admission: quota check skipped: %v", err)
+		return nil
+	}
+	return checkQuota(j, limits, usage)
+}
+
+// checkQuota refuses a job that would take a user past one of their limits.
+// GPU time can't be estimated ahead of a run, so a user is refused once
+// the day's allowance is spent rather than before it would be.
+func checkQuota(j Job, limits Limits, usage Usage) error {
+	if limits.Jobs > 0 && usage.Jobs >= limits.Jobs {
+		return &Shortage{
+			Resource:  ResourceQuota,
+			Required:  int64(usage.Jobs + 1),
+			Available: int64(limits.Jobs),
+			Unit:      "jobs",
+			Message:   fmt.Sprintf("you have %d unfinished jobs, the per-user limit is %d; retry when some finish", usage.Jobs, limits.Jobs),
+		}
+	}
+	if limits.GPUSeconds > 0 && usage.GPUSeconds >= limits.GPUSeconds {
+		return &Shortage{
+			Resource:  ResourceGPUTime,
+			Required:  int64(usage.GPUSeconds),
+			Available: int64(limits.GPUSeconds),
+			Unit:      "seconds",
+			Message: fmt.Sprintf("you have used %.0f of your %.0f GPU minutes in the last 24 hours; retry once earlier jobs age out",
+				usage.GPUSeconds/60, limits.GPUSeconds/60),
+		}
+	}
+	if limits.StorageBytes > 0 {
+		if need := usage.StorageBytes + EstimateOutput(j); need > limits.StorageBytes {
+			return &Shortage{
+				Resource:  ResourceStorage,
+				Required:  need,
+				Available: limits.StorageBytes,
+				Unit:      "bytes",
+				Message: fmt.Sprintf("your outputs take %.1f GB of your %.1f GB storage quota, too little for this job; delete or purge old jobs",
+					float64(usage.StorageBytes)/1e9, float64(limits.StorageBytes)/1e9),
+			}
+		}
+	}
+	return nil
+}
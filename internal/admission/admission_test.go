@@ -0,0 +1,129 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseJobDefaults(t *testing.T) {
+	j := ParseJob("svi", "alice", `{"num_clips": 4}`)
+	if j.Width != 832 || j.Height != 480 || j.Frames != 81 || j.Clips != 4 {
+		t.Errorf("unexpected svi job: %+v", j)
+	}
+	if j.UserID != "alice" {
+		t.Errorf("expected user alice, got %q", j.UserID)
+	}
+
+	j = ParseJob("qwen", "", `{"width": 512, "height": 768}`)
+	if j.Width != 512 || j.Height != 768 || j.Clips != 1 {
+		t.Errorf("unexpected qwen job: %+v", j)
+	}
+}
+
+func TestEstimates(t *testing.T) {
+	small := ParseJob("i2v", "", `{}`)
+	large := ParseJob("i2v", "", `{"width": 1280, "height": 720, "num_frames": 121}`)
+	if EstimateVRAM(large) <= EstimateVRAM(small) {
+		t.Errorf("larger video should need more VRAM: %d <= %d", EstimateVRAM(large), EstimateVRAM(small))
+	}
+
+	tiled := large
+	tiled.Tiled = true
+	if EstimateVRAM(tiled) >= EstimateVRAM(large) {
+		t.Errorf("tiled decoding should need less VRAM")
+	}
+
+	svi := ParseJob("svi", "", `{"num_clips": 10}`)
+	if EstimateOutput(svi) != 10*EstimateOutput(small) {
+		t.Errorf("svi output should scale with clips: %d vs %d", EstimateOutput(svi), EstimateOutput(small))
+	}
+	if EstimateOutput(ParseJob("chat", "", `{}`)) != 0 {
+		t.Errorf("chat jobs write no output file")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	job := ParseJob("i2v", "alice", `{}`)
+	limits := Limits{Jobs: 3, GPUSeconds: 3600, StorageBytes: 10e9}
+	usage := Usage{Jobs: 2, GPUSeconds: 1200, StorageBytes: 5e9}
+
+	c := &Controller{
+		VRAM:       func() (int64, bool) { return 24000, true },
+		FreeDisk:   func() (uint64, error) { return 100e9, nil },
+		ActiveJobs: func(ctx context.Context) (int, error) { return 5, nil },
+		Quota: func(ctx context.Context, userID string) (Limits, Usage, error) {
+			return limits, usage, nil
+		},
+		MaxQueued: 10,
+	}
+	if err := c.Check(ctx, job); err != nil {
+		t.Fatalf("expected job to be admitted, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(c *Controller)
+		resource Resource
+	}{
+		{"vram", func(c *Controller) { c.VRAM = func() (int64, bool) { return 8000, true } }, ResourceVRAM},
+		{"disk", func(c *Controller) { c.FreeDisk = func() (uint64, error) { return 1 << 29, nil } }, ResourceDisk},
+		{"queue", func(c *Controller) { c.MaxQueued = 5 }, ResourceQueue},
+		{"quota", quotaOf(Limits{Jobs: 2}, usage), ResourceQuota},
+		{"gpu time", quotaOf(Limits{GPUSeconds: 1000}, usage), ResourceGPUTime},
+		{"storage", quotaOf(Limits{StorageBytes: 5e9 + 1}, usage), ResourceStorage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := *c
+			tt.modify(&c)
+			var shortage *Shortage
+			if err := c.Check(ctx, job); !errors.As(err, &shortage) {
+				t.Fatalf("expected a shortage, got %v", err)
+			}
+			if shortage.Resource != tt.resource {
+				t.Errorf("expected %s shortage, got %s", tt.resource, shortage.Resource)
+			}
+			if shortage.Required <= shortage.Available {
+				t.Errorf("shortage should need more than is available: %+v", shortage)
+			}
+		})
+	}
+}
+
+func TestCheckSkipsUnknownResources(t *testing.T) {
+	c := &Controller{
+		VRAM:     func() (int64, bool) { return 0, false },
+		FreeDisk: func() (uint64, error) { return 0, errors.New("statfs failed") },
+		ActiveJobs: func(ctx context.Context) (int, error) {
+			return 0, errors.New("database locked")
+		},
+		Quota: func(ctx context.Context, userID string) (Limits, Usage, error) {
+			return Limits{}, Usage{}, errors.New("database locked")
+		},
+		MaxQueued: 1,
+	}
+	if err := c.Check(context.Background(), ParseJob("i2v", "alice", `{}`)); err != nil {
+		t.Errorf("failed probes should not block jobs, got %v", err)
+	}
+}
+
+func TestCheckQuotaNeedsUser(t *testing.T) {
+	c := &Controller{
+		Quota: func(ctx context.Context, userID string) (Limits, Usage, error) {
+			return Limits{Jobs: 1}, Usage{Jobs: 5}, nil
+		},
+	}
+	if err := c.Check(context.Background(), ParseJob("i2v", "", `{}`)); err != nil {
+		t.Errorf("jobs without a user should not be held to quotas, got %v", err)
+	}
+}
+
+func quotaOf(limits Limits, usage Usage) func(c *Controller) {
+	return func(c *Controller) {
+		c.Quota = func(ctx context.Context, userID string) (Limits, Usage, error) {
+			return limits, usage, nil
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package alerts watches disk and VRAM headroom and raises an alert when
+// either drops below its threshold, so operators hear about it before
+// downloads and jobs start failing.
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/gpu"
+)
+
+// Alert kinds
+const (
+	KindDisk = "disk"
+	KindVRAM = "vram"
+)
+
+// Alert states
+const (
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// hysteresisPct is how far above its threshold free space has to climb
+// before an alert resolves, so a value hovering at the limit doesn't flap
+const hysteresisPct = 2
+
+// Alert is a resource running low, or recovering
+type Alert struct {
+	Kind string `json:"kind"`
+	// Target is the directory, or the GPU as "gpu<index>"
+	Target       string    `json:"target"`
+	State        string    `json:"state"`
+	FreePct      float64   `json:"free_pct"`
+	ThresholdPct int       `json:"threshold_pct"`
+	FreeBytes    uint64    `json:"free_bytes"`
+	TotalBytes   uint64    `json:"total_bytes"`
+	Message      string    `json:"message"`
+	Since        time.Time `json:"since"` // when it started firing
+	At           time.Time `json:"at"`    // latest check
+}
+
+// Thresholds are the minimum free percentages; zero turns a check off
+type Thresholds struct {
+	DiskFreePct int
+	VRAMFreePct int
+}
+
+// DiskUsageFunc returns the free and total bytes of the filesystem
+// holding dir
+type DiskUsageFunc func(dir string) (free, total uint64, err error)
+
+// Monitor checks the watched directories and the latest GPU samples
+// against the thresholds. Each alert is reported once when it fires and
+// once when it resolves.
+type Monitor struct {
+	thresholds Thresholds
+	dirs       []string
+	diskUsage  DiskUsageFunc
+	gpus       func() []gpu.Sample
+
+	mu       sync.Mutex
+	active   map[string]Alert
+	handlers []func(Alert)
+}
+
+// NewMonitor watches dirs with diskUsage and the GPUs gpus reports.
+// Duplicate directories are checked once.
+func NewMonitor(t Thresholds, dirs []string, diskUsage DiskUsageFunc, gpus func() []gpu.Sample) *Monitor {
+	seen := make(map[string]bool, len(dirs))
+	var unique []string
+	for _, dir := range dirs {
+		if dir != "" && !seen[dir] {
+			seen[dir] = true
+			unique = append(unique, dir)
+		}
+	}
+	return &Monitor{
+		thresholds: t,
+		dirs:       unique,
+		diskUsage:  diskUsage,
+		gpus:       gpus,
+		active:     make(map[string]Alert),
+	}
+}
+
+// OnAlert registers fn to receive every alert as it fires or resolves.
+// Register handlers before Run.
+func (m *Monitor) OnAlert(fn func(Alert)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers = append(m.handlers, fn)
+}
+
+// Run checks every interval until ctx is cancelled
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) {
+	if m.thresholds.DiskFreePct <= 0 && m.thresholds.VRAMFreePct <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.Check(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check takes one reading of everything watched
+func (m *Monitor) Check(now time.Time) {
+	var changed []Alert
+
+	if m.thresholds.DiskFreePct > 0 {
+		for _, dir := range m.dirs {
+			free, total, err := m.diskUsage(dir)
+			if err != nil || total == 0 {
+				continue
+			}
+			if a, ok := m.evaluate(KindDisk, dir, m.thresholds.DiskFreePct, free, total, now); ok {
+				changed = append(changed, a)
+			}
+		}
+	}
+
+	if m.thresholds.VRAMFreePct > 0 && m.gpus != nil {
+		for _, s := range m.gpus() {
+			if s.MemoryTotalMB <= 0 {
+				continue
+			}
+			total := uint64(s.MemoryTotalMB) << 20
+			free := uint64(max(s.MemoryTotalMB-s.MemoryUsedMB, 0)) << 20
+			target := fmt.Sprintf("gpu%d", s.Index)
+			if a, ok := m.evaluate(KindVRAM, target, m.thresholds.VRAMFreePct, free, total, now); ok {
+				changed = append(changed, a)
+			}
+		}
+	}
+
+	m.mu.Lock()
+	handlers := append([]func(Alert){}, m.handlers...)
+	m.mu.Unlock()
+	for _, a := range changed {
+		log.Printf("Alerts: %s", a.Message)
+		for _, fn := range handlers {
+			fn(a)
+		}
+	}
+}
+
+// evaluate updates the alert for one target, returning it if it fired or
+// resolved
+func (m *Monitor) evaluate(kind, target string, threshold int, free, total uint64, now time.Time) (Alert, bool) {
+	pct := float64(free) / float64(total) * 100
+	key := kind + ":" + target
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, firing := m.active[key]
+	switch {
+	case !firing && pct < float64(threshold):
+		a = Alert{Kind: kind, Target: target, State: StateFiring, ThresholdPct: threshold, Since: now}
+	case firing && pct >= float64(threshold+hysteresisPct):
+		a.State = StateResolved
+	case firing:
+		// Still low; keep the reading current for Active
+		a.FreePct, a.FreeBytes, a.TotalBytes, a.At = pct, free, total, now
+		a.Message = message(a)
+		m.active[key] = a
+		return a, false
+	default:
+		return Alert{}, false
+	}
+
+	a.FreePct, a.FreeBytes, a.TotalBytes, a.At = pct, free, total, now
+	a.Message = message(a)
+	if a.State == StateFiring {
+		m.active[key] = a
+	} else {
+		delete(m.active, key)
+	}
+	return a, true
+}
+
+// Active returns the alerts currently firing, disk before VRAM
+func (m *Monitor) Active() []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(m.active))
+	for _, a := range m.active {
+		alerts = append(alerts, a)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Kind != alerts[j].Kind {
+			return alerts[i].Kind < alerts[j].Kind
+		}
+		return alerts[i].Target < alerts[j].Target
+	})
+	return alerts
+}
+
+func message(a Alert) string {
+	what := "disk space in " + a.Target
+	if a.Kind == KindVRAM {
+		what = "VRAM on " + a.Target
+	}
+	if a.State == StateResolved {
+		return fmt.Sprintf("%s recovered: %.1f%% free (%.1f GB of %.1f GB)",
+			what, a.FreePct, float64(a.FreeBytes)/1e9, float64(a.TotalBytes)/1e9)
+	}
+	return fmt.Sprintf("low %s: %.1f%% free (%.1f GB of %.1f GB), below the %d%% threshold",
+		what, a.FreePct, float64(a.FreeBytes)/1e9, float64(a.TotalBytes)/1e9, a.ThresholdPct)
+}
@@ -0,0 +1,103 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/gpu"
+)
+
+func TestDiskAlertFiresAndResolves(t *testing.T) {
+	free := uint64(50)
+	usage := func(dir string) (uint64, uint64, error) {
+		if dir == "/broken" {
+			return 0, 0, errors.New("no such volume")
+		}
+		return free, 1000, nil
+	}
+	m := NewMonitor(Thresholds{DiskFreePct: 10}, []string{"/outputs", "/outputs", "/broken"}, usage, nil)
+
+	var got []Alert
+	m.OnAlert(func(a Alert) { got = append(got, a) })
+
+	now := time.Now()
+	m.Check(now)
+	if len(got) != 1 || got[0].State != StateFiring || got[0].Target != "/outputs" || got[0].FreePct != 5 {
+		t.Fatalf("first check: %+v", got)
+	}
+
+	// Still low: no repeat, but the reading stays current
+	free = 60
+	m.Check(now.Add(time.Minute))
+	if len(got) != 1 {
+		t.Fatalf("alert repeated: %+v", got)
+	}
+	if active := m.Active(); len(active) != 1 || active[0].FreePct != 6 || !active[0].Since.Equal(now) {
+		t.Errorf("active = %+v", active)
+	}
+
+	// Just over the threshold isn't enough to resolve
+	free = 110
+	m.Check(now.Add(2 * time.Minute))
+	if len(got) != 1 {
+		t.Fatalf("resolved inside the hysteresis band: %+v", got)
+	}
+
+	free = 150
+	m.Check(now.Add(3 * time.Minute))
+	if len(got) != 2 || got[1].State != StateResolved {
+		t.Fatalf("expected a resolution, got %+v", got)
+	}
+	if len(m.Active()) != 0 {
+		t.Errorf("resolved alert still active")
+	}
+}
+
+func TestVRAMAlert(t *testing.T) {
+	samples := []gpu.Sample{
+		{Index: 0, MemoryUsedMB: 23000, MemoryTotalMB: 24000},
+		{Index: 1, MemoryUsedMB: 1000, MemoryTotalMB: 24000},
+	}
+	m := NewMonitor(Thresholds{VRAMFreePct: 10}, nil, nil, func() []gpu.Sample { return samples })
+
+	var got []Alert
+	m.OnAlert(func(a Alert) { got = append(got, a) })
+	m.Check(time.Now())
+	if len(got) != 1 || got[0].Kind != KindVRAM || got[0].Target != "gpu0" {
+		t.Fatalf("alerts = %+v", got)
+	}
+}
+
+func TestDisabledThresholds(t *testing.T) {
+	m := NewMonitor(Thresholds{}, []string{"/outputs"}, func(string) (uint64, uint64, error) {
+		return 0, 1000, nil
+	}, nil)
+	m.Check(time.Now())
+	if len(m.Active()) != 0 {
+		t.Errorf("a zero threshold raised an alert")
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	received := make(chan Alert, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Alert
+		json.NewDecoder(r.Body).Decode(&a)
+		received <- a
+	}))
+	defer server.Close()
+
+	Webhook(server.URL, server.Client())(Alert{Kind: KindDisk, Target: "/models", State: StateFiring})
+	select {
+	case a := <-received:
+		if a.Target != "/models" || a.State != StateFiring {
+			t.Errorf("webhook got %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+}
@@ -0,0 +1,44 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// webhookTimeout bounds each delivery
+const webhookTimeout = 10 * time.Second
+
+// Webhook returns an alert handler that POSTs each alert as JSON to url.
+// Deliveries run in the background; failures are logged and dropped.
+func Webhook(url string, client *http.Client) func(Alert) {
+	if client == nil {
+		client = &http.Client{Timeout: webhookTimeout}
+	}
+	return func(a Alert) {
+		go func() {
+			if err := deliver(client, url, a); err != nil {
+				log.Printf("Alerts: webhook delivery failed: %v", err)
+			}
+		}()
+	}
+}
+
+func deliver(client *http.Client, url string, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/admission"
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/models"
+)
+
+// shortageResponses maps each refused resource to its status and code
+var shortageResponses = map[admission.Resource]struct {
+	status int
+	code   apierr.Code
+}{
+	admission.ResourceVRAM:  {http.StatusUnprocessableEntity, apierr.CodeInsufficientVRAM},
+	admission.ResourceDisk:  {http.StatusInsufficientStorage, apierr.CodeInsufficientDisk},
+	admission.ResourceQueue: {http.StatusTooManyRequests, apierr.CodeQueueFull},
+	admission.ResourceQuota: {http.StatusTooManyRequests, apierr.CodeQuotaExceeded},
+
+	admission.ResourceGPUTime: {http.StatusTooManyRequests, apierr.CodeQuotaExceeded},
+	admission.ResourceStorage: {http.StatusTooManyRequests, apierr.CodeQuotaExceeded},
+}
+
+// newAdmission builds the admission checks from config, or returns nil
+// when admission control is off. Per-user quotas only apply with auth on,
+// since every request is the local admin otherwise.
+func (s *Server) newAdmission() *admission.Controller {
+	if !s.cfg.AdmissionControl {
+		return nil
+	}
+	c := &admission.Controller{
+		VRAM:     s.largestGPUMemory,
+		FreeDisk: func() (uint64, error) { return models.FreeSpace(s.cfg.OutputsDir) },
+		ActiveJobs: func(ctx context.Context) (int, error) {
+			counts, err := s.db.CountActiveJobs(ctx)
+			total := 0
+			for _, n := range counts {
+				total += n
+			}
+			return total, err
+		},
+		MaxQueued: s.cfg.MaxQueuedJobs,
+	}
+	if s.cfg.AuthEnabled {
+		c.Quota = s.userQuota
+	}
+	return c
+}
+
+// quotaWindow is how far back GPU time counts against the daily quota
+const quotaWindow = 24 * time.Hour
+
+// userQuota returns a user's effective limits, the configured defaults
+// with their overrides applied, and what they are using
+func (s *Server) userQuota(ctx context.Context, userID string) (admission.Limits, admission.Usage, error) {
+	limits := admission.Limits{
+		Jobs:         s.cfg.MaxJobsPerUser,
+		GPUSeconds:   float64(s.cfg.UserGPUMinutesPerDay * 60),
+		StorageBytes: int64(s.cfg.UserStorageGB) << 30,
+	}
+	quota, err := s.db.GetUserQuota(ctx, userID)
+	if err != nil {
+		return limits, admission.Usage{}, err
+	}
+	if quota.MaxQueuedJobs != nil {
+		limits.Jobs = *quota.MaxQueuedJobs
+	}
+	if quota.GPUMinutesPerDay != nil {
+		limits.GPUSeconds = float64(*quota.GPUMinutesPerDay * 60)
+	}
+	if quota.StorageBytes != nil {
+		limits.StorageBytes = *quota.StorageBytes
+	}
+
+	usage, err := s.db.GetUserUsage(ctx, userID, time.Now().Add(-quotaWindow))
+	if err != nil {
+		return limits, admission.Usage{}, err
+	}
+	return limits, admission.Usage{
+		Jobs:         usage.ActiveJobs,
+		GPUSeconds:   usage.GPUSeconds,
+		StorageBytes: usage.StorageBytes,
+	}, nil
+}
+
+// largestGPUMemory reports the memory of the biggest GPU from the latest
+// telemetry sample. It's unknown without an NVIDIA driver.
+func (s *Server) largestGPUMemory() (int64, bool) {
+	if s.gpu == nil {
+		return 0, false
+	}
+	var largest float64
+	for _, sample := range s.gpu.Latest() {
+		largest = max(largest, sample.MemoryTotalMB)
+	}
+	return int64(largest), largest > 0
+}
+
+// admit runs the admission checks for a job about to be queued. It writes
+// the refusal and returns false if the job can't be taken.
+func (s *Server) admit(w http.ResponseWriter, r *http.Request, job admission.Job, logPrefix string) bool {
+	if s.admission == nil {
+		return true
+	}
+
+	err := s.admission.Check(r.Context(), job)
+	if err == nil {
+		return true
+	}
+
+	var shortage *admission.Shortage
+	if !errors.As(err, &shortage) {
+		log.Printf("%s: Admission check failed: %v", logPrefix, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to check resources")
+		return false
+	}
+
+	log.Printf("%s: Refused %s job for lack of %s: %s", logPrefix, job.Type, shortage.Resource, shortage.Message)
+	resp := shortageResponses[shortage.Resource]
+	apierr.Write(w, resp.status, &apierr.Error{
+		Code:    resp.code,
+		Message: shortage.Message,
+		Resource: &apierr.Resource{
+			Name:      string(shortage.Resource),
+			Required:  shortage.Required,
+			Available: shortage.Available,
+			Unit:      shortage.Unit,
+		},
+	})
+	return false
+}
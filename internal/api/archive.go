@@ -0,0 +1,124 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// PurgeJobsRequest selects archived jobs to delete permanently. An empty
+// IDs list purges every archived job.
+type PurgeJobsRequest struct {
+	IDs         []string `json:"ids"`
+	DeleteFiles bool     `json:"delete_files"` // also remove generated outputs and thumbnails
+}
+
+type PurgeJobsResponse struct {
+	Purged       []string `json:"purged"`
+	FilesRemoved int      `json:"files_removed"`
+}
+
+func (s *Server) handleArchiveJob(w http.ResponseWriter, r *http.Request) {
+	s.setJobArchived(w, r, true)
+}
+
+func (s *Server) handleUnarchiveJob(w http.ResponseWriter, r *http.Request) {
+	s.setJobArchived(w, r, false)
+}
+
+func (s *Server) setJobArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	jobID := chi.URLParam(r, "id")
+
+	var err error
+	if archived {
+		err = s.db.ArchiveJob(r.Context(), jobID)
+	} else {
+		err = s.db.UnarchiveJob(r.Context(), jobID)
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		jobError(w, http.StatusNotFound, apierr.CodeNotFound, jobID, "Job not found")
+		return
+	case err == db.ErrJobActive:
+		jobError(w, http.StatusConflict, apierr.CodeConflict, jobID, "Job is still queued or running")
+		return
+	case err != nil:
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to update job")
+		return
+	}
+
+	dbJob, err := s.db.GetJob(r.Context(), jobID)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get job")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dbJobToAPIJob(dbJob))
+}
+
+// handlePurgeJobs permanently deletes archived jobs. Jobs must be archived
+// first, so a single request can't wipe live history.
+func (s *Server) handlePurgeJobs(w http.ResponseWriter, r *http.Request) {
+	var req PurgeJobsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	purged, err := s.db.PurgeJobs(r.Context(), req.IDs)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to purge jobs")
+		return
+	}
+
+	resp := PurgeJobsResponse{Purged: make([]string, len(purged))}
+	for i, job := range purged {
+		resp.Purged[i] = job.ID
+		if req.DeleteFiles {
+			resp.FilesRemoved += s.removeJobOutputs(job.ID)
+		}
+	}
+	log.Printf("Jobs: purged %d archived jobs (%d output files removed)", len(purged), resp.FilesRemoved)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// removeJobOutputs deletes the files a job wrote to the outputs storage,
+// which workers name after the job ID, and their thumbnails
+func (s *Server) removeJobOutputs(jobID string) int {
+	removed := 0
+	if matches, err := s.files.outputs.Glob(filepath.Base(jobID) + ".*"); err == nil {
+		for _, name := range matches {
+			if err := s.files.outputs.Remove(name); err != nil {
+				log.Printf("Jobs: failed to remove output %s: %v", name, err)
+				continue
+			}
+			removed++
+		}
+	}
+
+	if s.files.thumbnails == nil {
+		return removed
+	}
+	thumbs, err := filepath.Glob(filepath.Join(s.files.thumbnails.Dir(), filepath.Base(jobID)+".*"))
+	if err != nil {
+		return removed
+	}
+	for _, path := range thumbs {
+		if err := os.Remove(path); err != nil {
+			log.Printf("Jobs: failed to remove thumbnail %s: %v", path, err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
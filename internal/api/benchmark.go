@@ -0,0 +1,383 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/benchmark"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/gpu"
+	"github.com/druarnfield/diffbox/internal/models"
+	"github.com/druarnfield/diffbox/internal/version"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// benchmarkHistory is how many runs are listed and searched for baselines
+const benchmarkHistory = 50
+
+// BenchmarkRequest starts a benchmark run. Without workflows, every
+// workflow enabled in setup is benchmarked.
+type BenchmarkRequest struct {
+	Label     string   `json:"label"`
+	Workflows []string `json:"workflows"`
+}
+
+// BenchmarkEnvironment is what a run ran on, to tell runs apart when
+// comparing them
+type BenchmarkEnvironment struct {
+	GPUs    []string `json:"gpus"`
+	Driver  string   `json:"driver,omitempty"`
+	Variant string   `json:"variant"`
+	Version string   `json:"version"`
+	Commit  string   `json:"commit,omitempty"`
+}
+
+type BenchmarkResult struct {
+	Name        string  `json:"name"`
+	Workflow    string  `json:"workflow"`
+	JobID       string  `json:"job_id,omitempty"`
+	Status      string  `json:"status"`
+	WaitSeconds float64 `json:"wait_seconds,omitempty"`
+	RunSeconds  float64 `json:"run_seconds,omitempty"`
+	Error       string  `json:"error,omitempty"`
+	FinishedAt  string  `json:"finished_at,omitempty"`
+	// The same case's run time in the latest earlier run that completed
+	// it, and the change from it in percent (negative is faster)
+	BaselineRunID   string   `json:"baseline_run_id,omitempty"`
+	BaselineSeconds float64  `json:"baseline_seconds,omitempty"`
+	ChangePct       *float64 `json:"change_pct,omitempty"`
+}
+
+type BenchmarkRun struct {
+	ID    string `json:"id"`
+	Label string `json:"label,omitempty"`
+	// Status is running until every job has finished
+	Status      string               `json:"status"`
+	Environment BenchmarkEnvironment `json:"environment"`
+	CreatedAt   string               `json:"created_at"`
+	Results     []BenchmarkResult    `json:"results"`
+}
+
+// handleStartBenchmark queues the benchmark suite. Each case goes through
+// its workflow's own submit handler, so it is validated, admitted and
+// queued like any job; a case refused there is recorded as failed. Jobs
+// are labelled with the case name so they stand out in the job list.
+func (s *Server) handleStartBenchmark(w http.ResponseWriter, r *http.Request) {
+	var req BenchmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if utf8.RuneCountInString(req.Label) > 200 {
+		apierr.Field(w, "label", "too long (max 200 characters)")
+		return
+	}
+	for _, workflow := range req.Workflows {
+		if !slices.Contains(benchmark.Workflows(), workflow) {
+			apierr.Field(w, "workflows", "no benchmark for "+workflow+"; choose from "+strings.Join(benchmark.Workflows(), ", "))
+			return
+		}
+		if !models.WorkflowEnabled(workflow) {
+			apierr.Field(w, "workflows", "the "+workflow+" workflow is disabled in setup")
+			return
+		}
+	}
+	cases := benchmark.Select(req.Workflows, models.WorkflowEnabled)
+	if len(cases) == 0 {
+		apierr.Field(w, "workflows", "no enabled workflow has a benchmark")
+		return
+	}
+
+	runs, err := s.benchmarkRuns(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list benchmark runs")
+		return
+	}
+	// Concurrent runs would share the GPU and slow each other down
+	if len(runs) > 0 && runs[0].Status == "running" {
+		apierr.Respond(w, http.StatusConflict, apierr.CodeConflict, "Benchmark run "+runs[0].ID+" is still running")
+		return
+	}
+
+	environment, err := json.Marshal(s.benchmarkEnvironment(r.Context()))
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to serialize environment")
+		return
+	}
+	run := &db.BenchmarkRun{
+		ID:          uuid.New().String(),
+		Label:       req.Label,
+		Environment: string(environment),
+	}
+	for _, c := range cases {
+		run.Results = append(run.Results, &db.BenchmarkResult{Name: c.Name, Workflow: c.Workflow, Status: db.BenchmarkPending})
+	}
+	// Stored before any job is queued, so a job that finishes quickly
+	// has a result to record its timing in
+	if err := s.db.CreateBenchmarkRun(r.Context(), run); err != nil {
+		log.Printf("Benchmark: Failed to store run %s: %v", run.ID, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to store benchmark run")
+		return
+	}
+
+	queued := 0
+	var firstErr *httptest.ResponseRecorder
+	for i, c := range cases {
+		result := run.Results[i]
+		rec := s.submitBenchmarkCase(r, c)
+		var resp JobResponse
+		if rec.Code == http.StatusOK && json.Unmarshal(rec.Body.Bytes(), &resp) == nil && resp.ID != "" {
+			result.JobID = resp.ID
+			label := "Benchmark " + c.Name
+			if err := s.db.UpdateJobAnnotations(r.Context(), resp.ID, &label, nil); err != nil {
+				log.Printf("Benchmark: Failed to label job %s: %v", resp.ID, err)
+			}
+			queued++
+		} else {
+			var e apierr.Error
+			json.Unmarshal(rec.Body.Bytes(), &e)
+			result.Status, result.Error, result.FinishedAt = db.BenchmarkFailed, e.Message, time.Now()
+			log.Printf("Benchmark: Case %s refused: %d %s", c.Name, rec.Code, e.Message)
+			if firstErr == nil {
+				firstErr = rec
+			}
+		}
+		if err := s.db.UpdateBenchmarkResult(r.Context(), run.ID, result); err != nil {
+			log.Printf("Benchmark: Failed to record case %s of run %s: %v", c.Name, run.ID, err)
+		}
+		if result.JobID == "" {
+			continue
+		}
+		// The job may have finished before it was linked to the result
+		if job, err := s.db.GetJob(r.Context(), result.JobID); err == nil && !jobActive(job.Status) {
+			errorMsg := job.Error
+			if errorMsg == "" && job.Status != "completed" {
+				errorMsg = "job was " + job.Status
+			}
+			s.RecordBenchmarkResult(r.Context(), job.ID, errorMsg)
+		}
+	}
+	if queued == 0 {
+		// Nothing to time, so nothing to record: pass the refusal on
+		if err := s.db.DeleteBenchmarkRun(r.Context(), run.ID); err != nil {
+			log.Printf("Benchmark: Failed to remove run %s: %v", run.ID, err)
+		}
+		for k, v := range firstErr.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(firstErr.Code)
+		w.Write(firstErr.Body.Bytes())
+		return
+	}
+	log.Printf("Benchmark: Run %s queued %d of %d jobs", run.ID, queued, len(cases))
+	if stored, err := s.db.GetBenchmarkRun(r.Context(), run.ID); err == nil {
+		run = stored
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(s.benchmarkRun(r.Context(), run, runs))
+}
+
+// submitBenchmarkCase submits one case through its workflow's handler,
+// outside any session
+func (s *Server) submitBenchmarkCase(r *http.Request, c benchmark.Case) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	body, err := json.Marshal(c.Params)
+	if err != nil {
+		apierr.Respond(rec, http.StatusInternalServerError, apierr.CodeInternal, "Failed to serialize params")
+		return rec
+	}
+	submit := s.submitHandler(c.Workflow)
+	if submit == nil {
+		apierr.Respond(rec, http.StatusConflict, apierr.CodeConflict, "Workflow "+c.Workflow+" is not available")
+		return rec
+	}
+	sub := r.Clone(r.Context())
+	sub.Body = io.NopCloser(bytes.NewReader(body))
+	sub.ContentLength = int64(len(body))
+	sub.Header.Del(SessionHeader)
+	submit(rec, sub)
+	return rec
+}
+
+// handleListBenchmarks lists recent benchmark runs, newest first, each
+// result compared with the run before it
+func (s *Server) handleListBenchmarks(w http.ResponseWriter, r *http.Request) {
+	runs, err := s.benchmarkRuns(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list benchmark runs")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// handleGetBenchmark returns one run. Runs older than the listed history
+// come without baselines.
+func (s *Server) handleGetBenchmark(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	runs, err := s.benchmarkRuns(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list benchmark runs")
+		return
+	}
+	var run BenchmarkRun
+	if i := slices.IndexFunc(runs, func(run BenchmarkRun) bool { return run.ID == id }); i >= 0 {
+		run = runs[i]
+	} else {
+		dbRun, err := s.db.GetBenchmarkRun(r.Context(), id)
+		if err == sql.ErrNoRows {
+			apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Benchmark run not found")
+			return
+		}
+		if err != nil {
+			apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get benchmark run")
+			return
+		}
+		run = s.benchmarkRun(r.Context(), dbRun, nil)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// RecordBenchmarkResult stores a finished job's timing if it belongs to a
+// benchmark run. errorMsg is empty for a job that completed.
+func (s *Server) RecordBenchmarkResult(ctx context.Context, jobID, errorMsg string) {
+	job, err := s.db.GetJob(ctx, jobID)
+	if err != nil {
+		return
+	}
+	status := db.BenchmarkCompleted
+	if errorMsg != "" {
+		status = db.BenchmarkFailed
+	}
+	var wait, run time.Duration
+	if !job.StartedAt.IsZero() {
+		wait, run = job.StartedAt.Sub(job.CreatedAt), time.Since(job.StartedAt)
+	}
+	if err := s.db.FinishBenchmarkJob(ctx, jobID, status, wait, run, errorMsg); err != nil {
+		log.Printf("Benchmark: Failed to record result of job %s: %v", jobID, err)
+	}
+}
+
+// benchmarkRuns lists recent runs for the API, newest first
+func (s *Server) benchmarkRuns(ctx context.Context) ([]BenchmarkRun, error) {
+	dbRuns, err := s.db.ListBenchmarkRuns(ctx, benchmarkHistory)
+	if err != nil {
+		return nil, err
+	}
+	// Converted oldest first, so the runs after each one are its
+	// predecessors, already converted
+	runs := make([]BenchmarkRun, len(dbRuns))
+	for i := len(dbRuns) - 1; i >= 0; i-- {
+		runs[i] = s.benchmarkRun(ctx, dbRuns[i], runs[i+1:])
+	}
+	return runs, nil
+}
+
+// benchmarkRun converts a run for the API. Results still pending whose job
+// will never report, say after a restart interrupted it, take the job's
+// status. earlier are the runs before it, newest first, searched for
+// baselines.
+func (s *Server) benchmarkRun(ctx context.Context, dbRun *db.BenchmarkRun, earlier []BenchmarkRun) BenchmarkRun {
+	run := BenchmarkRun{
+		ID:        dbRun.ID,
+		Label:     dbRun.Label,
+		Status:    db.BenchmarkCompleted,
+		CreatedAt: dbRun.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Results:   make([]BenchmarkResult, 0, len(dbRun.Results)),
+	}
+	json.Unmarshal([]byte(dbRun.Environment), &run.Environment)
+
+	for _, r := range dbRun.Results {
+		result := BenchmarkResult{
+			Name:     r.Name,
+			Workflow: r.Workflow,
+			JobID:    r.JobID,
+			Status:   r.Status,
+			Error:    r.Error,
+		}
+		if !r.FinishedAt.IsZero() {
+			result.FinishedAt = r.FinishedAt.Format("2006-01-02T15:04:05Z07:00")
+		}
+		if r.Status == db.BenchmarkPending {
+			job, err := s.db.GetJob(ctx, r.JobID)
+			switch {
+			case err == sql.ErrNoRows:
+				result.Status, result.Error = db.BenchmarkFailed, "job was purged before it finished"
+			case err == nil && !jobActive(job.Status):
+				result.Status, result.Error = job.Status, job.Error
+			default:
+				run.Status = "running"
+			}
+		}
+		if r.Status == db.BenchmarkCompleted {
+			result.WaitSeconds, result.RunSeconds = r.Wait.Seconds(), r.Run.Seconds()
+			if runID, baseline, ok := benchmarkBaseline(earlier, r.Name); ok {
+				change := benchmark.Change(baseline, result.RunSeconds)
+				result.BaselineRunID, result.BaselineSeconds, result.ChangePct = runID, baseline, &change
+			}
+		}
+		run.Results = append(run.Results, result)
+	}
+	return run
+}
+
+// benchmarkBaseline finds the run time of a case in the latest of runs,
+// newest first, that completed it
+func benchmarkBaseline(runs []BenchmarkRun, name string) (runID string, seconds float64, ok bool) {
+	for _, run := range runs {
+		for _, r := range run.Results {
+			if r.Name == name && r.Status == db.BenchmarkCompleted {
+				return run.ID, r.RunSeconds, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// benchmarkEnvironment describes the GPUs, driver and model variant in use
+func (s *Server) benchmarkEnvironment(ctx context.Context) BenchmarkEnvironment {
+	env := BenchmarkEnvironment{
+		GPUs:    []string{},
+		Variant: models.CurrentSelection().Variant,
+		Version: version.Version,
+		Commit:  version.Commit(),
+	}
+	if env.Variant == "" {
+		env.Variant = models.VariantFull
+	}
+	for _, g := range s.hardware().GPUs {
+		env.GPUs = append(env.GPUs, g.Name)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if driver, err := gpu.DriverVersion(ctx); err == nil {
+		env.Driver = driver
+	}
+	return env
+}
+
+// jobActive reports whether a job in a status may still run
+func jobActive(status string) bool {
+	switch status {
+	case "pending", "waiting_models", "running":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/paramdiff"
+)
+
+// ComparedJob is one side of a job comparison
+type ComparedJob struct {
+	ID     string     `json:"id"`
+	Type   string     `json:"type"`
+	Status string     `json:"status"`
+	Label  string     `json:"label,omitempty"`
+	Output *JobOutput `json:"output,omitempty"`
+	// Seed is the seed actually used, when known
+	Seed            *int64  `json:"seed,omitempty"`
+	CreatedAt       string  `json:"created_at"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"` // run time of a finished job
+}
+
+// JobComparison diffs job B's params against job A's
+type JobComparison struct {
+	A      ComparedJob    `json:"a"`
+	B      ComparedJob    `json:"b"`
+	Params paramdiff.Diff `json:"params"`
+	// DurationDeltaSeconds is B's run time minus A's, when both are known
+	DurationDeltaSeconds *float64 `json:"duration_delta_seconds,omitempty"`
+}
+
+func (s *Server) handleCompareJobs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	idA, idB := query.Get("a"), query.Get("b")
+	if idA == "" || idB == "" {
+		field := "a"
+		if idA != "" {
+			field = "b"
+		}
+		apierr.Field(w, field, "is required")
+		return
+	}
+
+	a, paramsA, ok := s.comparedJob(r.Context(), w, idA)
+	if !ok {
+		return
+	}
+	b, paramsB, ok := s.comparedJob(r.Context(), w, idB)
+	if !ok {
+		return
+	}
+
+	cmp := JobComparison{A: a, B: b, Params: paramdiff.Compare(paramsA, paramsB)}
+	if a.DurationSeconds > 0 && b.DurationSeconds > 0 {
+		delta := b.DurationSeconds - a.DurationSeconds
+		cmp.DurationDeltaSeconds = &delta
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cmp)
+}
+
+// comparedJob loads one side of a comparison along with the params to
+// diff, which carry the resolved seed when one was recorded
+func (s *Server) comparedJob(ctx context.Context, w http.ResponseWriter, id string) (ComparedJob, map[string]interface{}, bool) {
+	dbJob, err := s.db.GetJob(ctx, id)
+	if err == sql.ErrNoRows {
+		jobError(w, http.StatusNotFound, apierr.CodeNotFound, id, "Job not found")
+		return ComparedJob{}, nil, false
+	}
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get job")
+		return ComparedJob{}, nil, false
+	}
+
+	job := dbJobToAPIJob(dbJob)
+	c := ComparedJob{
+		ID:              job.ID,
+		Type:            job.Type,
+		Status:          job.Status,
+		Label:           job.Label,
+		Output:          job.Output,
+		CreatedAt:       job.CreatedAt,
+		DurationSeconds: runDuration(dbJob),
+	}
+
+	params := job.Params
+	report, err := s.recordedRepro(ctx, dbJob)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get repro report")
+		return ComparedJob{}, nil, false
+	}
+	if report != nil {
+		params, c.Seed = report.Params, report.Seed
+	} else {
+		c.Seed = fixedSeed(params)
+	}
+	return c, params, true
+}
+
+// runDuration is how long a finished job ran, or 0 if it hasn't finished
+// or never started
+func runDuration(job *db.Job) float64 {
+	if job.StartedAt.IsZero() {
+		return 0
+	}
+	switch job.Status {
+	case "completed", "failed":
+		return job.UpdatedAt.Sub(job.StartedAt).Seconds()
+	}
+	return 0
+}
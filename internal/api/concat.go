@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/admission"
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/auth"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/video"
+	"github.com/google/uuid"
+)
+
+// ConcatJobType is the job type of joined videos. Concat jobs run in the
+// server with ffmpeg rather than on a GPU worker.
+const ConcatJobType = "concat"
+
+// maxConcatClips bounds how many outputs one request joins
+const maxConcatClips = 50
+
+// maxConcurrentConcats is how many joins run at once; later ones wait for
+// a slot
+const maxConcurrentConcats = 2
+
+// ConcatRequest joins the video outputs of finished jobs in the order
+// given
+type ConcatRequest struct {
+	JobIDs []string `json:"job_ids"`
+	// Crossfade overlaps consecutive clips by this many seconds
+	Crossfade float64 `json:"crossfade,omitempty"`
+	// Encoding re-encodes with these settings; without it matching clips
+	// are joined as they are
+	Encoding *video.Encoding `json:"encoding,omitempty"`
+}
+
+// handleConcatOutputs joins video outputs into a new one. The result is
+// a concat job like any other, with progress, completion and errors over
+// the WebSocket, so it shows in the job list, counts towards storage and
+// can be resubmitted. Clips are probed up front so bad input is refused
+// before the job is created.
+func (s *Server) handleConcatOutputs(w http.ResponseWriter, r *http.Request) {
+	var req ConcatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if len(req.JobIDs) < 2 || len(req.JobIDs) > maxConcatClips {
+		apierr.Field(w, "job_ids", fmt.Sprintf("must name between 2 and %d jobs", maxConcatClips))
+		return
+	}
+	if req.Encoding != nil {
+		if err := req.Encoding.Validate(); err != nil {
+			apierr.Field(w, "encoding", err.Error())
+			return
+		}
+	}
+
+	paths := make([]string, len(req.JobIDs))
+	for i, id := range req.JobIDs {
+		path, ok := s.concatSource(w, r, fmt.Sprintf("job_ids[%d]", i), id)
+		if !ok {
+			return
+		}
+		paths[i] = path
+	}
+	clips := make([]video.Clip, len(paths))
+	for i, path := range paths {
+		clip, err := video.Probe(r.Context(), path)
+		if errors.Is(err, exec.ErrNotFound) {
+			apierr.Respond(w, http.StatusServiceUnavailable, apierr.CodeFFmpegMissing, "ffmpeg is not installed on the server")
+			return
+		}
+		if err != nil {
+			apierr.Field(w, fmt.Sprintf("job_ids[%d]", i), err.Error())
+			return
+		}
+		clips[i] = clip
+	}
+	opts := video.Options{Crossfade: req.Crossfade, Encoding: req.Encoding}
+	if err := video.Check(clips, opts); err != nil {
+		field := "crossfade"
+		if req.Crossfade == 0 {
+			field = "encoding"
+		}
+		apierr.Field(w, field, err.Error())
+		return
+	}
+
+	sessionID, ok := s.jobSession(w, r)
+	if !ok {
+		return
+	}
+	var userID string
+	if user := auth.UserFromContext(r.Context()); user != nil {
+		userID = user.ID
+	}
+	// The joined video is about as big as its clips
+	var size int64
+	for _, clip := range clips {
+		if info, err := os.Stat(clip.Path); err == nil {
+			size += info.Size()
+		}
+	}
+	if !s.admit(w, r, admission.Job{Type: ConcatJobType, UserID: userID, OutputBytes: size}, "Concat") {
+		return
+	}
+
+	params, err := json.Marshal(req)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to serialize params")
+		return
+	}
+	job := &db.Job{
+		ID:        uuid.New().String(),
+		Type:      ConcatJobType,
+		Status:    "pending",
+		Params:    string(params),
+		UserID:    userID,
+		SessionID: sessionID,
+	}
+	if err := s.db.CreateJob(r.Context(), job); err != nil {
+		log.Printf("Concat: Failed to persist job %s: %v", job.ID, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to create job")
+		return
+	}
+	// Started straight away, so it never sits in the GPU queue
+	if err := s.db.UpdateJobProgress(r.Context(), job.ID, 0, "Waiting to join clips"); err != nil {
+		log.Printf("Concat: Failed to start job %s: %v", job.ID, err)
+	}
+
+	output := filepath.Join(s.files.outputs.Dir(), job.ID+".mp4")
+	log.Printf("Concat: Job %s joining %d clips (crossfade %gs, re-encode %v)", job.ID, len(clips), req.Crossfade, video.Reencodes(clips, opts))
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		s.runConcat(job.ID, clips, output, opts)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(JobResponse{ID: job.ID, Status: "running"})
+}
+
+// concatSource returns the output file of a finished video job, writing a
+// 400 for field and returning false if there isn't one
+func (s *Server) concatSource(w http.ResponseWriter, r *http.Request, field, jobID string) (string, bool) {
+	path, err := s.jobOutputPath(r.Context(), jobID, "video")
+	if errors.Is(err, errJobLookup) {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get job")
+		return "", false
+	}
+	if err != nil {
+		apierr.Field(w, field, err.Error())
+		return "", false
+	}
+	return path, true
+}
+
+// runConcat joins the clips of a concat job once a slot is free and
+// finishes it. A join cut short by Close is left for shutdown to mark
+// interrupted.
+func (s *Server) runConcat(jobID string, clips []video.Clip, output string, opts video.Options) {
+	ctx := s.ctx
+	select {
+	case s.concatSlots <- struct{}{}:
+		defer func() { <-s.concatSlots }()
+	case <-ctx.Done():
+		return
+	}
+
+	started := time.Now()
+	err := video.Join(ctx, clips, output, opts, func(progress float64) {
+		if err := s.db.UpdateJobProgress(ctx, jobID, progress, "Joining clips"); err != nil {
+			log.Printf("Concat: Failed to update progress of job %s: %v", jobID, err)
+		}
+		s.hub.BroadcastJobProgress(JobProgress{JobID: jobID, Progress: progress, Stage: "Joining clips"})
+	})
+	if err != nil && ctx.Err() != nil {
+		log.Printf("Concat: Job %s stopped by shutdown", jobID)
+		os.Remove(output)
+		return
+	}
+	if err != nil {
+		log.Printf("Concat: Job %s failed: %v", jobID, err)
+		if dbErr := s.db.FailJob(ctx, jobID, err.Error()); dbErr != nil {
+			log.Printf("Concat: Failed to mark job %s as failed: %v", jobID, dbErr)
+		}
+		s.hub.BroadcastJobError(JobError{JobID: jobID, Error: err.Error()})
+		s.AdvancePipeline(ctx, jobID, err.Error())
+		return
+	}
+
+	output = s.FinalizeOutput(jobID, output)
+	if err := s.db.CompleteJob(ctx, jobID, output); err != nil {
+		log.Printf("Concat: Failed to complete job %s: %v", jobID, err)
+	}
+	if info, err := os.Stat(output); err == nil {
+		if err := s.db.SetJobOutputSize(ctx, jobID, info.Size()); err != nil {
+			log.Printf("Concat: Failed to record output size of job %s: %v", jobID, err)
+		}
+	}
+	log.Printf("Concat: Job %s done in %s", jobID, time.Since(started).Round(time.Millisecond))
+	s.hub.BroadcastJobComplete(JobComplete{
+		JobID:  jobID,
+		Output: JobOutput{Type: "output", Path: output},
+	})
+	s.AdvancePipeline(ctx, jobID, "")
+}
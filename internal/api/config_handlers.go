@@ -1,10 +1,15 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
 	"sync/atomic"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/paramtpl"
+	"github.com/druarnfield/diffbox/internal/tokens"
 )
 
 type UserConfig struct {
@@ -25,6 +30,9 @@ type Preset struct {
 	Name     string                 `json:"name"`
 	Workflow string                 `json:"workflow"`
 	Params   map[string]interface{} `json:"params"`
+	// Variables are the {{name}} placeholders the params use, filled in
+	// from a submission's variables when it names the preset
+	Variables []paramtpl.Variable `json:"variables,omitempty"`
 }
 
 type ModelConfig struct {
@@ -35,8 +43,15 @@ type ModelConfig struct {
 }
 
 type TokenStatus struct {
-	HuggingFace bool `json:"huggingface"`
-	Civitai     bool `json:"civitai"`
+	HuggingFace ProviderTokenStatus `json:"huggingface"`
+	Civitai     ProviderTokenStatus `json:"civitai"`
+}
+
+// ProviderTokenStatus reports whether a token is saved and what the provider
+// said about it when it was last checked
+type ProviderTokenStatus struct {
+	Configured bool `json:"configured"`
+	*tokens.Identity
 }
 
 func (s *Server) handleExportConfig(w http.ResponseWriter, r *http.Request) {
@@ -74,6 +89,12 @@ func (s *Server) handleExportConfig(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	if presets, err := s.db.ListPresets(r.Context(), ""); err == nil {
+		for _, p := range presets {
+			config.Presets = append(config.Presets, dbPresetToAPIPreset(p))
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Disposition", "attachment; filename=diffbox-config.json")
 	json.NewEncoder(w).Encode(config)
@@ -82,7 +103,7 @@ func (s *Server) handleExportConfig(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleImportConfig(w http.ResponseWriter, r *http.Request) {
 	var config UserConfig
 	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
-		http.Error(w, "Invalid config format", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid config format")
 		return
 	}
 
@@ -95,27 +116,100 @@ func (s *Server) handleImportConfig(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *Server) handleGetTokenStatus(w http.ResponseWriter, r *http.Request) {
-	// TODO: Check if tokens are configured (don't return actual values)
-	status := TokenStatus{
-		HuggingFace: false,
-		Civitai:     false,
+// tokenKey is the config key holding a provider's token
+func tokenKey(provider string) string {
+	return "token:" + provider
+}
+
+// tokenIdentityKey is the config key holding a provider token's last check
+func tokenIdentityKey(provider string) string {
+	return "token:" + provider + ":identity"
+}
+
+func (s *Server) tokenStatus(ctx context.Context) TokenStatus {
+	return TokenStatus{
+		HuggingFace: s.providerTokenStatus(ctx, tokens.HuggingFace),
+		Civitai:     s.providerTokenStatus(ctx, tokens.Civitai),
+	}
+}
+
+func (s *Server) providerTokenStatus(ctx context.Context, provider string) ProviderTokenStatus {
+	var status ProviderTokenStatus
+	if token, err := s.db.GetConfig(ctx, tokenKey(provider)); err != nil || token == "" {
+		return status
+	}
+	status.Configured = true
+
+	raw, err := s.db.GetConfig(ctx, tokenIdentityKey(provider))
+	if err != nil {
+		return status
 	}
+	var identity tokens.Identity
+	if err := json.Unmarshal([]byte(raw), &identity); err == nil {
+		status.Identity = &identity
+	}
+	return status
+}
 
+func (s *Server) handleGetTokenStatus(w http.ResponseWriter, r *http.Request) {
+	// Never return the token values themselves
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(status)
+	json.NewEncoder(w).Encode(s.tokenStatus(r.Context()))
 }
 
 func (s *Server) handleUpdateTokens(w http.ResponseWriter, r *http.Request) {
-	var tokens TokenConfig
-	if err := json.NewDecoder(r.Body).Decode(&tokens); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req TokenConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if !s.storeTokens(w, r, req) {
 		return
 	}
 
-	// TODO: Store tokens securely
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.tokenStatus(r.Context()))
+}
 
-	w.WriteHeader(http.StatusNoContent)
+// storeTokens validates and saves the non-empty tokens in req, writing an
+// error and returning false if one can't be saved. Empty values leave the
+// existing token untouched.
+func (s *Server) storeTokens(w http.ResponseWriter, r *http.Request, req TokenConfig) bool {
+	updates := map[string]string{
+		tokens.HuggingFace: req.HuggingFace,
+		tokens.Civitai:     req.Civitai,
+	}
+	for provider, token := range updates {
+		if token == "" {
+			continue
+		}
+
+		identity, err := s.tokens.Validate(provider, token)
+		if err != nil {
+			apierr.Field(w, provider, err.Error())
+			return false
+		}
+		if identity.Valid {
+			log.Printf("Tokens: %s token belongs to %s", provider, identity.Username)
+		} else {
+			log.Printf("Tokens: %s token failed validation: %s", provider, identity.Error)
+		}
+
+		identityJSON, err := json.Marshal(identity)
+		if err != nil {
+			apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to serialize token status")
+			return false
+		}
+		if err := s.db.SetConfig(r.Context(), tokenKey(provider), token); err != nil {
+			apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to store token")
+			return false
+		}
+		if err := s.db.SetConfig(r.Context(), tokenIdentityKey(provider), string(identityJSON)); err != nil {
+			apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to store token status")
+			return false
+		}
+	}
+	return true
 }
 
 var healthCheckCount int32
@@ -129,8 +223,12 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	health := map[string]interface{}{
-		"status":  "ok",
-		"version": "0.1.0",
+		"status":      "ok",
+		"version":     "0.1.0",
+		"maintenance": s.maintenance.active(),
+		"python_env":  s.workers.EnvStatus(),
+		// Outputs are placeholders when no real worker runs
+		"simulated": s.cfg.Simulate || s.cfg.TestMode,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
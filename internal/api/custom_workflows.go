@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/workflow"
+	"github.com/go-chi/chi/v5"
+)
+
+// CustomWorkflow describes a registered custom workflow to clients, so
+// they can render a form from its schema
+type CustomWorkflow struct {
+	Type        string                    `json:"type"`
+	Name        string                    `json:"name"`
+	Description string                    `json:"description,omitempty"`
+	Output      string                    `json:"output"`
+	Params      map[string]workflow.Param `json:"params"`
+	Models      []string                  `json:"models"`
+}
+
+func (s *Server) handleListCustomWorkflows(w http.ResponseWriter, r *http.Request) {
+	result := []CustomWorkflow{}
+	for _, def := range s.workflows.List() {
+		names := make([]string, 0, len(def.Models))
+		for _, m := range def.Models {
+			names = append(names, m.Name)
+		}
+		result = append(result, CustomWorkflow{
+			Type:        def.Type,
+			Name:        def.Name,
+			Description: def.Description,
+			Output:      def.Output,
+			Params:      def.Params,
+			Models:      names,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleCustomSubmit validates a job against a custom workflow's schema
+// and queues it. Besides the declared params the body may carry "models"
+// to override loader inputs, as for the built-in workflows.
+func (s *Server) handleCustomSubmit(w http.ResponseWriter, r *http.Request) {
+	def := s.workflows.Get(chi.URLParam(r, "type"))
+	if def == nil {
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Unknown workflow")
+		return
+	}
+	s.submitCustom(w, r, def)
+}
+
+func (s *Server) submitCustom(w http.ResponseWriter, r *http.Request, def *workflow.Definition) {
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Printf("Custom: Failed to decode %s request: %v", def.Type, err)
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	var overrides map[string]string
+	if raw, ok := body["models"]; ok {
+		if err := json.Unmarshal(raw, &overrides); err != nil {
+			apierr.Field(w, "models", "must map loader inputs to model names")
+			return
+		}
+		delete(body, "models")
+	}
+	overrides, err := s.aliases.ResolveMap(overrides)
+	if err != nil {
+		modelMissing(w, "models", err)
+		return
+	}
+
+	raw := make(map[string]interface{}, len(body))
+	for name, v := range body {
+		var value interface{}
+		json.Unmarshal(v, &value)
+		raw[name] = value
+	}
+	params, fieldErrors := def.Validate(raw)
+	if fieldErrors != nil {
+		apierr.Write(w, http.StatusBadRequest, &apierr.Error{
+			Code:        apierr.CodeValidationFailed,
+			Message:     "Invalid " + def.Name + " request",
+			FieldErrors: fieldErrors,
+		})
+		return
+	}
+
+	for name, p := range def.Params {
+		value, ok := params[name].(string)
+		if !ok || value == "" {
+			continue
+		}
+		var err error
+		switch p.Type {
+		case workflow.TypeImage:
+			value, err = s.resolveImage(r.Context(), value)
+		case workflow.TypeVideo:
+			value, err = s.resolveUpload(r.Context(), value)
+		default:
+			continue
+		}
+		if err != nil {
+			apierr.Field(w, name, err.Error())
+			return
+		}
+		params[name] = value
+	}
+	if len(overrides) > 0 {
+		params["models"] = overrides
+	}
+
+	s.submitJob(w, r, def.Type, "Custom", params)
+}
+
+// knownWorkflow reports whether jobs of a type can be submitted
+func (s *Server) knownWorkflow(jobType string) bool {
+	return presetWorkflows[jobType] || s.workflows.Get(jobType) != nil
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/gpu"
+)
+
+// DashboardJob is a running job as the dashboard shows it: progress
+// without the params, which may carry whole images
+type DashboardJob struct {
+	ID         string  `json:"id"`
+	Type       string  `json:"type"`
+	Label      string  `json:"label,omitempty"`
+	Progress   float64 `json:"progress"`
+	Stage      string  `json:"stage"`
+	StartedAt  string  `json:"started_at,omitempty"`
+	ETA        string  `json:"eta,omitempty"`
+	ETASeconds int64   `json:"eta_seconds,omitempty"`
+	SessionID  string  `json:"session_id,omitempty"`
+}
+
+type DashboardWorker struct {
+	ID      int  `json:"id"`
+	Running bool `json:"running"`
+}
+
+// DashboardResponse is everything the home screen shows, read in one
+// request rather than polling jobs, queue, workers, GPUs and downloads
+type DashboardResponse struct {
+	Jobs []DashboardJob `json:"jobs"`
+	// QueueDepth counts the jobs waiting for a worker, listed in Queue
+	// with their estimated start
+	QueueDepth int               `json:"queue_depth"`
+	Queue      *QueueResponse    `json:"queue"`
+	Workers    []DashboardWorker `json:"workers"`
+	GPUs       []gpu.Sample      `json:"gpus"` // Latest sample of each GPU
+	// Downloads lists the model downloads in progress or queued
+	Downloads   []DownloadStatus `json:"downloads"`
+	GeneratedAt string           `json:"generated_at"`
+}
+
+// handleGetDashboard returns a snapshot of running jobs, the queue,
+// workers, GPUs and active downloads. Downloads are best effort: if they
+// can't be read the rest is still returned.
+func (s *Server) handleGetDashboard(w http.ResponseWriter, r *http.Request) {
+	running, err := s.db.ListRunningJobs(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list running jobs")
+		return
+	}
+	queue, err := s.estimateQueue(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to estimate queue")
+		return
+	}
+
+	resp := DashboardResponse{
+		Jobs:        make([]DashboardJob, 0, len(running)),
+		QueueDepth:  len(queue.Jobs),
+		Queue:       queue,
+		Workers:     []DashboardWorker{},
+		GPUs:        []gpu.Sample{},
+		Downloads:   []DownloadStatus{},
+		GeneratedAt: time.Now().Format("2006-01-02T15:04:05Z07:00"),
+	}
+	for _, dbJob := range running {
+		job := dbJobToAPIJob(dbJob)
+		entry := DashboardJob{
+			ID:         job.ID,
+			Type:       job.Type,
+			Label:      job.Label,
+			Progress:   job.Progress,
+			Stage:      job.Stage,
+			ETA:        job.ETA,
+			ETASeconds: job.ETASeconds,
+			SessionID:  job.SessionID,
+		}
+		if !dbJob.StartedAt.IsZero() {
+			entry.StartedAt = dbJob.StartedAt.Format("2006-01-02T15:04:05Z07:00")
+		}
+		resp.Jobs = append(resp.Jobs, entry)
+	}
+	for _, info := range s.workers.Workers() {
+		resp.Workers = append(resp.Workers, DashboardWorker{ID: info.ID, Running: info.Running})
+	}
+	if s.gpu != nil {
+		resp.GPUs = append(resp.GPUs, s.gpu.Latest()...)
+	}
+
+	downloads, err := s.downloadStatuses(r.Context())
+	if err != nil {
+		log.Printf("Dashboard: Failed to list downloads: %v", err)
+	}
+	for _, d := range downloads {
+		if d.Status == "downloading" || d.Status == "queued" {
+			resp.Downloads = append(resp.Downloads, d)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
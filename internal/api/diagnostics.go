@@ -0,0 +1,205 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/gpu"
+	"github.com/druarnfield/diffbox/internal/logtail"
+	"github.com/druarnfield/diffbox/internal/version"
+	"github.com/druarnfield/diffbox/internal/worker"
+)
+
+const (
+	// diagnosticsJobs is how many recent jobs a bundle describes
+	diagnosticsJobs = 50
+	// diagnosticsGPUWindow is how much GPU history a bundle holds
+	diagnosticsGPUWindow = 10 * time.Minute
+)
+
+// DiagnosticsSummary is summary.json in a diagnostics bundle
+type DiagnosticsSummary struct {
+	GeneratedAt string `json:"generated_at"`
+	Version     string `json:"version"`
+	Commit      string `json:"commit,omitempty"`
+	GoVersion   string `json:"go_version"`
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+	NumCPU      int    `json:"num_cpu"`
+	Goroutines  int    `json:"goroutines"`
+	// Errors lists the parts of the bundle that couldn't be gathered
+	Errors []string `json:"errors,omitempty"`
+}
+
+// DiagnosticsJob is a recent job in jobs.json. Params are left out, as
+// prompts may be private.
+type DiagnosticsJob struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	Status    string     `json:"status"`
+	Stage     string     `json:"stage,omitempty"`
+	Progress  float64    `json:"progress"`
+	Error     string     `json:"error,omitempty"`
+	CreatedAt string     `json:"created_at"`
+	Events    []JobEvent `json:"events"`
+}
+
+// DiagnosticsWorkers is workers.json
+type DiagnosticsWorkers struct {
+	Workers     []worker.WorkerInfo `json:"workers"`
+	Environment worker.EnvStatus    `json:"environment"`
+	Versions    map[string]string   `json:"versions,omitempty"`
+}
+
+// DiagnosticsGPU is gpu.json
+type DiagnosticsGPU struct {
+	Driver  string       `json:"driver,omitempty"`
+	Samples []gpu.Sample `json:"samples"`
+}
+
+// DiagnosticsDatabase is database.json
+type DiagnosticsDatabase struct {
+	SizeBytes     int64            `json:"size_bytes"`
+	FreelistBytes int64            `json:"freelist_bytes"`
+	Rows          map[string]int64 `json:"rows"`
+}
+
+// handleDiagnostics streams a zip to attach to bug reports: recent server
+// logs, the config with secrets redacted, recent jobs with their
+// timelines, worker states and crash dumps, GPU telemetry, database stats
+// and a goroutine dump. Parts that can't be gathered are listed in
+// summary.json rather than failing the download.
+func (s *Server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	now := time.Now()
+	summary := DiagnosticsSummary{
+		GeneratedAt: now.Format("2006-01-02T15:04:05Z07:00"),
+		Version:     version.Version,
+		Commit:      version.Commit(),
+		GoVersion:   runtime.Version(),
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		NumCPU:      runtime.NumCPU(),
+		Goroutines:  runtime.NumGoroutine(),
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=diffbox-diagnostics-%s.zip", now.UTC().Format("20060102-150405")))
+	zw := zip.NewWriter(w)
+	add := func(name string, write func(io.Writer) error) {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err == nil {
+			err = write(f)
+		}
+		if err != nil {
+			summary.Errors = append(summary.Errors, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	addJSON := func(name string, gather func() (interface{}, error)) {
+		add(name, func(f io.Writer) error {
+			v, err := gather()
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "  ")
+			return enc.Encode(v)
+		})
+	}
+
+	add("logs/server.log", func(f io.Writer) error {
+		// Requests are logged redacted, but worker output and older
+		// lines may still hold tokens
+		_, err := io.WriteString(f, redactSecrets(strings.Join(logtail.Server.Lines(), "\n")))
+		return err
+	})
+	addJSON("config.json", func() (interface{}, error) {
+		return s.cfg.Redacted(), nil
+	})
+	addJSON("jobs.json", func() (interface{}, error) {
+		return s.diagnosticsJobs(ctx)
+	})
+	addJSON("workers.json", func() (interface{}, error) {
+		return DiagnosticsWorkers{
+			Workers:     s.workers.Workers(),
+			Environment: s.workers.EnvStatus(),
+			Versions:    s.workers.Versions(),
+		}, nil
+	})
+	addJSON("gpu.json", func() (interface{}, error) {
+		info := DiagnosticsGPU{Samples: []gpu.Sample{}}
+		if driver, err := gpu.DriverVersion(ctx); err == nil {
+			info.Driver = driver
+		}
+		if s.gpu != nil {
+			info.Samples = append(info.Samples, s.gpu.History(now.Add(-diagnosticsGPUWindow))...)
+		}
+		return info, nil
+	})
+	addJSON("database.json", func() (interface{}, error) {
+		stats, err := s.db.Stats(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return DiagnosticsDatabase{SizeBytes: stats.SizeBytes, FreelistBytes: stats.FreelistBytes, Rows: stats.Rows}, nil
+	})
+	for _, path := range s.workers.CrashDumps() {
+		add("crashes/"+filepath.Base(path), func(f io.Writer) error {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			_, err = f.Write(data)
+			return err
+		})
+	}
+	add("goroutines.txt", func(f io.Writer) error {
+		return pprof.Lookup("goroutine").WriteTo(f, 2)
+	})
+
+	addJSON("summary.json", func() (interface{}, error) {
+		return summary, nil
+	})
+	if err := zw.Close(); err != nil {
+		log.Printf("Diagnostics: Failed to write bundle: %v", err)
+	}
+}
+
+// diagnosticsJobs returns the most recent jobs with their timelines
+func (s *Server) diagnosticsJobs(ctx context.Context) ([]DiagnosticsJob, error) {
+	dbJobs, err := s.db.ListJobs(ctx, diagnosticsJobs, db.IncludeArchived)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]DiagnosticsJob, len(dbJobs))
+	for i, j := range dbJobs {
+		events, err := s.db.ListJobEvents(ctx, j.ID)
+		if err != nil {
+			return nil, err
+		}
+		jobs[i] = DiagnosticsJob{
+			ID:        j.ID,
+			Type:      j.Type,
+			Status:    j.Status,
+			Stage:     j.Stage,
+			Progress:  j.Progress,
+			Error:     j.Error,
+			CreatedAt: j.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			Events:    dbEventsToAPIEvents(events),
+		}
+	}
+	return jobs, nil
+}
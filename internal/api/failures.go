@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/failures"
+)
+
+type FailureGroup struct {
+	Fingerprint string         `json:"fingerprint"`
+	Category    string         `json:"category"`
+	Signature   string         `json:"signature"`
+	Count       int            `json:"count"`
+	FirstSeen   string         `json:"first_seen"`
+	LastSeen    string         `json:"last_seen"`
+	LastJobID   string         `json:"last_job_id"`
+	LastError   string         `json:"last_error"`
+	JobTypes    map[string]int `json:"job_types"`
+}
+
+// handleListFailures groups recent worker failures by error fingerprint
+func (s *Server) handleListFailures(w http.ResponseWriter, r *http.Request) {
+	failed, err := s.db.ListFailedJobs(r.Context(), 1000)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list failed jobs")
+		return
+	}
+
+	occurrences := make([]failures.Occurrence, len(failed))
+	for i, job := range failed {
+		occurrences[i] = failures.Occurrence{
+			JobID:    job.ID,
+			JobType:  job.Type,
+			Error:    job.Error,
+			FailedAt: job.UpdatedAt,
+		}
+	}
+
+	groups := failures.Aggregate(occurrences)
+	response := make([]FailureGroup, len(groups))
+	for i, g := range groups {
+		response[i] = FailureGroup{
+			Fingerprint: g.ID,
+			Category:    g.Category,
+			Signature:   g.Signature,
+			Count:       g.Count,
+			FirstSeen:   g.FirstSeen.Format("2006-01-02T15:04:05Z07:00"),
+			LastSeen:    g.LastSeen.Format("2006-01-02T15:04:05Z07:00"),
+			LastJobID:   g.LastJobID,
+			LastError:   g.LastError,
+			JobTypes:    g.JobTypes,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/files"
+	"github.com/druarnfield/diffbox/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// fileRoots is the allow-list of directories served over HTTP. Nothing
+// outside these roots is reachable through the file handlers. Outputs
+// are served from their storage, confined like the rest.
+type fileRoots struct {
+	outputs    storage.Storage
+	static     *files.Root
+	thumbnails *files.Root
+}
+
+func newFileRoots(outputsDir, staticDir, thumbnailsDir string) fileRoots {
+	return fileRoots{
+		outputs:    storage.NewLocal(outputsDir).Confined(),
+		static:     openFileRoot("static", staticDir),
+		thumbnails: openFileRoot("thumbnails", thumbnailsDir),
+	}
+}
+
+func openFileRoot(name, dir string) *files.Root {
+	root, err := files.NewRoot(dir)
+	if err != nil {
+		log.Printf("Warning: %s directory unavailable, not serving it: %v", name, err)
+		return nil
+	}
+	return root
+}
+
+// serveFromRoot serves a file from root, mapping resolution failures to
+// 404 so probes can't distinguish escapes from missing files
+func serveFromRoot(w http.ResponseWriter, r *http.Request, root *files.Root, name string) {
+	if root == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	reportServeError(w, r, root.Dir(), name, root.Serve(w, r, name))
+}
+
+// serveFromStorage serves a stored file like serveFromRoot
+func serveFromStorage(w http.ResponseWriter, r *http.Request, s storage.Storage, name string) {
+	reportServeError(w, r, s.Dir(), name, storage.Serve(w, r, s, name))
+}
+
+func reportServeError(w http.ResponseWriter, r *http.Request, dir, name string, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, files.ErrOutsideRoot):
+		log.Printf("Files: rejected path escaping %s: %q", dir, name)
+		http.NotFound(w, r)
+	case errors.Is(err, files.ErrNotFound):
+		http.NotFound(w, r)
+	default:
+		log.Printf("Files: failed to serve %q: %v", name, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to read file")
+	}
+}
+
+func (s *Server) handleOutputFile(w http.ResponseWriter, r *http.Request) {
+	serveFromStorage(w, r, s.files.outputs, chi.URLParam(r, "*"))
+}
+
+func (s *Server) handleThumbnailFile(w http.ResponseWriter, r *http.Request) {
+	serveFromRoot(w, r, s.files.thumbnails, chi.URLParam(r, "*"))
+}
+
+// handleSPA serves static files and falls back to index.html for SPA routing
+func (s *Server) handleSPA(w http.ResponseWriter, r *http.Request) {
+	if s.files.static == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Serve static files if they exist
+	err := s.files.static.Serve(w, r, r.URL.Path)
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, files.ErrNotFound), errors.Is(err, files.ErrOutsideRoot):
+	default:
+		log.Printf("Files: failed to serve %q: %v", r.URL.Path, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to read file")
+		return
+	}
+
+	// For any other route, serve index.html (SPA routing)
+	serveFromRoot(w, r, s.files.static, "index.html")
+}
+
+// FinalizeOutput hands a finished job's output file over to the outputs
+// storage and returns the path to record for the job. Workers write
+// straight into the storage's Dir, so locally nothing moves.
+func (s *Server) FinalizeOutput(jobID, path string) string {
+	if path == "" {
+		return path
+	}
+	dir := s.files.outputs.Dir()
+	name := filepath.Base(path)
+	if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		name = filepath.ToSlash(rel)
+	}
+	if err := s.files.outputs.Import(name, path); err != nil {
+		log.Printf("Files: failed to store output of job %s: %v", jobID, err)
+		return path
+	}
+	return filepath.Join(dir, filepath.FromSlash(name))
+}
+
+// outputRefPrefix marks a param that names a finished job's output
+// ("output:<job id>") instead of carrying the file, as pipeline steps
+// pass outputs on
+const outputRefPrefix = "output:"
+
+// parseOutputRef returns the job ID an output reference names, and false
+// if s isn't one
+func parseOutputRef(s string) (string, bool) {
+	if !strings.HasPrefix(s, outputRefPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(s, outputRefPrefix), true
+}
+
+// errJobLookup is returned by jobOutputPath when the job couldn't be read
+var errJobLookup = errors.New("failed to get job")
+
+// jobOutputPath returns the local path of a completed job's output, which
+// must be of kind ("image" or "video"). Other errors than errJobLookup
+// describe what is wrong with the job for the client.
+func (s *Server) jobOutputPath(ctx context.Context, jobID, kind string) (string, error) {
+	job, err := s.db.GetJob(ctx, jobID)
+	if err == sql.ErrNoRows {
+		return "", errors.New("unknown job")
+	}
+	if err != nil {
+		return "", errJobLookup
+	}
+	if job.Status != "completed" || job.Output == "" {
+		return "", errors.New("job has no output yet")
+	}
+	if output := dbJobToAPIJob(job).Output; output.Type != kind {
+		return "", errors.New("job output is not a " + kind)
+	}
+
+	// Only files still in the outputs storage can be used
+	rel, err := filepath.Rel(s.files.outputs.Dir(), job.Output)
+	if err != nil {
+		return "", errors.New("job output is not in the outputs directory")
+	}
+	path, err := s.files.outputs.LocalPath(filepath.ToSlash(rel))
+	if err != nil {
+		return "", errors.New("job output file is missing")
+	}
+	return path, nil
+}
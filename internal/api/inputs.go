@@ -0,0 +1,421 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/files"
+	"github.com/druarnfield/diffbox/internal/inputs"
+	"github.com/druarnfield/diffbox/internal/upload"
+	"github.com/druarnfield/diffbox/internal/workflow"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxInputImageBytes matches the 10MB cap on base64 image fields
+const maxInputImageBytes = 10 << 20
+
+// InputImage is an image in the input library. Ref can be passed in place
+// of base64 in any image field of a job submission.
+type InputImage struct {
+	Hash       string `json:"hash"`
+	Ref        string `json:"ref"`
+	URL        string `json:"url"`
+	Format     string `json:"format"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Size       int64  `json:"size"`
+	Jobs       int    `json:"jobs"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+	// Deduplicated is set on upload when the image was already stored
+	Deduplicated bool `json:"deduplicated,omitempty"`
+}
+
+// InputUse is one job field an input image went into
+type InputUse struct {
+	JobID string `json:"job_id,omitempty"`
+	Field string `json:"field"`
+	Hash  string `json:"hash,omitempty"`
+}
+
+// InputImageDetail adds the jobs that used an image
+type InputImageDetail struct {
+	InputImage
+	UsedBy []InputUse `json:"used_by"`
+}
+
+// UploadInputRequest carries an image as base64, like job image fields.
+// Raw image bodies with an image/* Content-Type are accepted too.
+type UploadInputRequest struct {
+	Image string `json:"image"`
+}
+
+// PruneInputsResponse reports what a prune removed
+type PruneInputsResponse struct {
+	Deleted    int   `json:"deleted"`
+	FreedBytes int64 `json:"freed_bytes"`
+}
+
+func (s *Server) handleUploadInput(w http.ResponseWriter, r *http.Request) {
+	var info *upload.ImageInfo
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "image/") {
+		data, readErr := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInputImageBytes))
+		if readErr != nil {
+			apierr.Field(w, "image", "too large (max 10MB)")
+			return
+		}
+		info, err = upload.ValidateImage(data)
+	} else {
+		var req UploadInputRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+			return
+		}
+		if req.Image == "" {
+			apierr.Field(w, "image", "is required")
+			return
+		}
+		if len(req.Image) > 14_000_000 {
+			apierr.Field(w, "image", "too large (max 10MB)")
+			return
+		}
+		info, err = upload.DecodeBase64Image(req.Image)
+	}
+	if err != nil {
+		apierr.Field(w, "image", err.Error())
+		return
+	}
+
+	img, created, err := s.storeInput(r.Context(), info)
+	if err != nil {
+		log.Printf("Inputs: Failed to store image: %v", err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to store image")
+		return
+	}
+
+	resp := dbInputToAPIInput(img)
+	resp.Deduplicated = !created
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		log.Printf("Inputs: Stored %s %dx%d image %s", img.Format, img.Width, img.Height, img.Hash)
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handleListInputs(w http.ResponseWriter, r *http.Request) {
+	images, err := s.db.ListInputImages(r.Context(), r.URL.Query().Get("unused") == "true")
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list input images")
+		return
+	}
+
+	result := make([]InputImage, len(images))
+	for i, img := range images {
+		result[i] = dbInputToAPIInput(img)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (s *Server) handleGetInput(w http.ResponseWriter, r *http.Request) {
+	img, ok := s.loadInput(w, r)
+	if !ok {
+		return
+	}
+
+	uses, err := s.db.ListImageJobs(r.Context(), img.Hash)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list jobs using image")
+		return
+	}
+	detail := InputImageDetail{InputImage: dbInputToAPIInput(img), UsedBy: []InputUse{}}
+	for _, u := range uses {
+		detail.UsedBy = append(detail.UsedBy, InputUse{JobID: u.JobID, Field: u.Field})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+func (s *Server) handleInputFile(w http.ResponseWriter, r *http.Request) {
+	img, ok := s.loadInput(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := s.inputs.Read(img.Hash, img.Format)
+	if errors.Is(err, inputs.ErrNotFound) {
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Input image file is missing")
+		return
+	}
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to read input image")
+		return
+	}
+
+	path := s.inputs.Path(img.Hash, img.Format)
+	w.Header().Set("Content-Type", files.ContentType(path))
+	// The name is the content hash, so the bytes behind it never change
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, path, img.CreatedAt, bytes.NewReader(data))
+}
+
+// handleDeleteInput removes an image no existing job used. Images still
+// referenced are refused so job history keeps its source images.
+func (s *Server) handleDeleteInput(w http.ResponseWriter, r *http.Request) {
+	img, ok := s.loadInput(w, r)
+	if !ok {
+		return
+	}
+	if img.Jobs > 0 {
+		apierr.Respond(w, http.StatusConflict, apierr.CodeConflict,
+			fmt.Sprintf("Image is used by %d jobs; purge them first", img.Jobs))
+		return
+	}
+
+	if err := s.deleteInput(r.Context(), img); err != nil {
+		log.Printf("Inputs: Failed to delete %s: %v", img.Hash, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to delete input image")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePruneInputs deletes every image no existing job used
+func (s *Server) handlePruneInputs(w http.ResponseWriter, r *http.Request) {
+	images, err := s.db.ListInputImages(r.Context(), true)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list input images")
+		return
+	}
+
+	var resp PruneInputsResponse
+	for _, img := range images {
+		if err := s.deleteInput(r.Context(), img); err != nil {
+			log.Printf("Inputs: Failed to delete %s: %v", img.Hash, err)
+			continue
+		}
+		resp.Deleted++
+		resp.FreedBytes += img.Size
+	}
+	log.Printf("Inputs: Pruned %d unused images (%d bytes)", resp.Deleted, resp.FreedBytes)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// loadInput looks up the {hash} in the path, writing a 404 and returning
+// false if it isn't in the library
+func (s *Server) loadInput(w http.ResponseWriter, r *http.Request) (*db.InputImage, bool) {
+	hash := chi.URLParam(r, "hash")
+	if !inputs.ValidHash(hash) {
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Input image not found")
+		return nil, false
+	}
+	img, err := s.db.GetInputImage(r.Context(), hash)
+	if err == sql.ErrNoRows {
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Input image not found")
+		return nil, false
+	}
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get input image")
+		return nil, false
+	}
+	return img, true
+}
+
+// storeInput adds a validated image to the library, returning its record
+// and whether it was new
+func (s *Server) storeInput(ctx context.Context, info *upload.ImageInfo) (*db.InputImage, bool, error) {
+	hash, _, err := s.inputs.Store(info.Data, info.Format)
+	if err != nil {
+		return nil, false, err
+	}
+	created, err := s.db.SaveInputImage(ctx, &db.InputImage{
+		Hash:   hash,
+		Format: info.Format,
+		Width:  info.Width,
+		Height: info.Height,
+		Size:   int64(len(info.Data)),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	img, err := s.db.GetInputImage(ctx, hash)
+	return img, created, err
+}
+
+func (s *Server) deleteInput(ctx context.Context, img *db.InputImage) error {
+	if err := s.db.DeleteInputImage(ctx, img.Hash); err != nil {
+		return err
+	}
+	return s.inputs.Remove(img.Hash, img.Format)
+}
+
+// resolveImage validates an image field of a submission and returns it as
+// plain base64. A library reference ("input:<hash>") is replaced by the
+// stored image, and an output reference ("output:<job id>") by the job's
+// image output, so workers always receive the bytes.
+func (s *Server) resolveImage(ctx context.Context, encoded string) (string, error) {
+	if jobID, ok := parseOutputRef(encoded); ok {
+		path, err := s.jobOutputPath(ctx, jobID, "image")
+		if err != nil {
+			return "", fmt.Errorf("output of job %s: %w", jobID, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("output of job %s: %w", jobID, err)
+		}
+		return normalizeImage(base64.StdEncoding.EncodeToString(data))
+	}
+	hash, ok := inputs.ParseRef(encoded)
+	if !ok {
+		return normalizeImage(encoded)
+	}
+	img, err := s.db.GetInputImage(ctx, hash)
+	if err == sql.ErrNoRows || !inputs.ValidHash(hash) {
+		return "", fmt.Errorf("unknown input image %s", hash)
+	}
+	if err != nil {
+		return "", err
+	}
+	data, err := s.inputs.Read(img.Hash, img.Format)
+	if err != nil {
+		return "", fmt.Errorf("input image %s: %w", hash, err)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// storeInputs adds a submitted job's images to the library and returns
+// its params with each image replaced by its library reference, so the
+// stored job keeps a hash rather than the whole image, along with the
+// uses to record once the job exists. An image that can't be stored stays
+// inline.
+func (s *Server) storeInputs(ctx context.Context, jobID, jobType string, paramsJSON []byte) ([]byte, []db.JobInput) {
+	var params map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(paramsJSON))
+	dec.UseNumber()
+	if err := dec.Decode(&params); err != nil {
+		return paramsJSON, nil
+	}
+
+	var used []db.JobInput
+	for field, encoded := range s.jobImages(jobType, params) {
+		info, err := upload.DecodeBase64Image(encoded)
+		if err != nil {
+			log.Printf("Inputs: Skipping %s of job %s: %v", field, jobID, err)
+			continue
+		}
+		img, _, err := s.storeInput(ctx, info)
+		if err != nil {
+			log.Printf("Inputs: Failed to store %s of job %s: %v", field, jobID, err)
+			continue
+		}
+		setJobImage(params, field, inputs.RefPrefix+img.Hash)
+		used = append(used, db.JobInput{JobID: jobID, Field: field, Hash: img.Hash})
+	}
+	if len(used) == 0 {
+		return paramsJSON, nil
+	}
+	stored, err := json.Marshal(params)
+	if err != nil {
+		return paramsJSON, nil
+	}
+	return stored, used
+}
+
+// ResolveInputs replaces the library references in a stored job's image
+// fields with the images, as workers take them
+func (s *Server) ResolveInputs(ctx context.Context, jobType string, params map[string]interface{}) error {
+	for field, encoded := range s.jobImages(jobType, params) {
+		if _, ok := inputs.ParseRef(encoded); !ok {
+			continue
+		}
+		data, err := s.resolveImage(ctx, encoded)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		setJobImage(params, field, data)
+	}
+	return nil
+}
+
+// setJobImage sets an image field named as jobImages names them
+func setJobImage(params map[string]interface{}, field, value string) {
+	name, index, ok := strings.Cut(field, "[")
+	if !ok {
+		params[name] = value
+		return
+	}
+	i, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+	if list, ok := params[name].([]interface{}); ok && err == nil && i < len(list) {
+		list[i] = value
+	}
+}
+
+// jobImages returns a job's non-empty image fields, keyed by field name
+// with an index for lists (e.g. "edit_images[0]")
+func (s *Server) jobImages(jobType string, params map[string]interface{}) map[string]string {
+	images := make(map[string]string)
+	add := func(field string, v interface{}) {
+		if encoded, ok := v.(string); ok && encoded != "" {
+			images[field] = encoded
+		}
+	}
+
+	switch jobType {
+	case "i2v", "svi":
+		add("input_image", params["input_image"])
+	case "qwen":
+		if list, ok := params["edit_images"].([]interface{}); ok {
+			for i, v := range list {
+				add(fmt.Sprintf("edit_images[%d]", i), v)
+			}
+		}
+		add("inpaint_mask", params["inpaint_mask"])
+	default:
+		if def := s.workflows.Get(jobType); def != nil {
+			for name, p := range def.Params {
+				if p.Type == workflow.TypeImage {
+					add(name, params[name])
+				}
+			}
+		}
+	}
+	return images
+}
+
+func dbInputToAPIInput(img *db.InputImage) InputImage {
+	result := InputImage{
+		Hash:      img.Hash,
+		Ref:       inputs.RefPrefix + img.Hash,
+		URL:       "/api/inputs/" + img.Hash + "/file",
+		Format:    img.Format,
+		Width:     img.Width,
+		Height:    img.Height,
+		Size:      img.Size,
+		Jobs:      img.Jobs,
+		CreatedAt: img.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if !img.LastUsedAt.IsZero() {
+		result.LastUsedAt = img.LastUsedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return result
+}
@@ -3,9 +3,14 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/druarnfield/diffbox/internal/apierr"
 	"github.com/druarnfield/diffbox/internal/db"
 	"github.com/go-chi/chi/v5"
 )
@@ -16,11 +21,73 @@ type Job struct {
 	Status    string                 `json:"status"`
 	Progress  float64                `json:"progress"`
 	Stage     string                 `json:"stage"`
+	Label     string                 `json:"label,omitempty"`
+	Notes     string                 `json:"notes,omitempty"`
 	Params    map[string]interface{} `json:"params"`
 	Output    *JobOutput             `json:"output,omitempty"`
 	Error     string                 `json:"error,omitempty"`
 	CreatedAt string                 `json:"created_at"`
 	UpdatedAt string                 `json:"updated_at"`
+	// ETA is the estimated completion time of a running job and
+	// ETASeconds the time left until then
+	ETA        string `json:"eta,omitempty"`
+	ETASeconds int64  `json:"eta_seconds,omitempty"`
+	// QueuePosition and EstimatedStart are set while the job waits for
+	// a worker; see QueuedJob
+	QueuePosition   int    `json:"queue_position,omitempty"`
+	EstimatedStart  string `json:"estimated_start,omitempty"`
+	StartsInSeconds *int64 `json:"starts_in_seconds,omitempty"`
+	ArchivedAt      string `json:"archived_at,omitempty"`
+	SessionID       string `json:"session_id,omitempty"`
+	// GPUSeconds and EnergyWh are the job's share of GPU time and power
+	// draw, set once a job that ran while GPUs were sampled finishes
+	GPUSeconds *float64 `json:"gpu_seconds,omitempty"`
+	EnergyWh   *float64 `json:"energy_wh,omitempty"`
+	// Inputs lists the library images the job's image fields used. It is
+	// only filled in for a single job.
+	Inputs []InputUse `json:"inputs,omitempty"`
+	// Stages breaks a job's progress and run time down by the stages of
+	// its workflow. It is only filled in for a single job.
+	Stages []JobStage `json:"stages,omitempty"`
+}
+
+// JobStage is one stage of a job's workflow and the time spent in it
+type JobStage struct {
+	Name string `json:"name"`
+	// Weight is the stage's share of the job's overall progress. Stages a
+	// worker reported that the workflow doesn't list have none.
+	Weight float64 `json:"weight"`
+	// Status is "pending" until the job enters the stage, "running" while
+	// it is in it, and "done" once it has finished it or moved on to a
+	// later one. A stage the job left unfinished, such as when it failed,
+	// is "stopped", and one it passed over, or never reached before
+	// completing, is "skipped".
+	Status     string  `json:"status"`
+	Progress   float64 `json:"progress"`
+	StartedAt  string  `json:"started_at,omitempty"`
+	DurationMs int64   `json:"duration_ms"`
+}
+
+// UpdateJobRequest edits a job's annotations; omitted fields are unchanged
+type UpdateJobRequest struct {
+	Label *string `json:"label"`
+	Notes *string `json:"notes"`
+}
+
+// Limits on user-provided job annotations
+const (
+	maxJobLabelLength = 200
+	maxJobNotesLength = 10000
+)
+
+type JobEvent struct {
+	Event     string `json:"event"`
+	Stage     string `json:"stage,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Timestamp string `json:"timestamp"`
+	// SincePreviousMs is the time since the previous event, which is how
+	// long the job spent in the preceding state
+	SincePreviousMs int64 `json:"since_previous_ms"`
 }
 
 type JobOutput struct {
@@ -30,9 +97,21 @@ type JobOutput struct {
 }
 
 func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
-	dbJobs, err := s.db.ListJobs(100)
+	archived := db.ExcludeArchived
+	switch r.URL.Query().Get("archived") {
+	case "", "exclude":
+	case "include":
+		archived = db.IncludeArchived
+	case "only":
+		archived = db.OnlyArchived
+	default:
+		apierr.Field(w, "archived", "must be exclude, include or only")
+		return
+	}
+
+	dbJobs, err := s.db.ListJobs(r.Context(), 100, archived)
 	if err != nil {
-		http.Error(w, "Failed to list jobs", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list jobs")
 		return
 	}
 
@@ -40,6 +119,7 @@ func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
 	for i, dbJob := range dbJobs {
 		jobs[i] = dbJobToAPIJob(dbJob)
 	}
+	s.addQueueEstimates(r.Context(), jobs)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(jobs)
@@ -48,20 +128,168 @@ func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
 	jobID := chi.URLParam(r, "id")
 
-	dbJob, err := s.db.GetJob(jobID)
+	dbJob, err := s.db.GetJob(r.Context(), jobID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			http.Error(w, "Job not found", http.StatusNotFound)
+			jobError(w, http.StatusNotFound, apierr.CodeNotFound, jobID, "Job not found")
 			return
 		}
-		http.Error(w, "Failed to get job", http.StatusInternalServerError)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get job")
 		return
 	}
 
-	job := dbJobToAPIJob(dbJob)
+	jobs := []Job{dbJobToAPIJob(dbJob)}
+	s.addQueueEstimates(r.Context(), jobs)
+
+	inputs, err := s.db.ListJobInputs(r.Context(), jobID)
+	if err != nil {
+		log.Printf("Jobs: Failed to list inputs of job %s: %v", jobID, err)
+	}
+	for _, in := range inputs {
+		jobs[0].Inputs = append(jobs[0].Inputs, InputUse{Field: in.Field, Hash: in.Hash})
+	}
+
+	recorded, err := s.db.ListJobStages(r.Context(), jobID)
+	if err != nil {
+		log.Printf("Jobs: Failed to list stages of job %s: %v", jobID, err)
+	}
+	jobs[0].Stages = jobStages(s.workflows.Stages(dbJob.Type), recorded, dbJob.Status == "completed")
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(job)
+	json.NewEncoder(w).Encode(jobs[0])
+}
+
+func (s *Server) handleUpdateJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "id")
+
+	var req UpdateJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Label == nil && req.Notes == nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeValidationFailed, "Nothing to update (expected label or notes)")
+		return
+	}
+	if req.Label != nil {
+		label := strings.TrimSpace(*req.Label)
+		if utf8.RuneCountInString(label) > maxJobLabelLength {
+			apierr.Field(w, "label", fmt.Sprintf("must be at most %d characters", maxJobLabelLength))
+			return
+		}
+		req.Label = &label
+	}
+	if req.Notes != nil && utf8.RuneCountInString(*req.Notes) > maxJobNotesLength {
+		apierr.Field(w, "notes", fmt.Sprintf("must be at most %d characters", maxJobNotesLength))
+		return
+	}
+
+	if err := s.db.UpdateJobAnnotations(r.Context(), jobID, req.Label, req.Notes); err != nil {
+		if err == sql.ErrNoRows {
+			jobError(w, http.StatusNotFound, apierr.CodeNotFound, jobID, "Job not found")
+			return
+		}
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to update job")
+		return
+	}
+
+	dbJob, err := s.db.GetJob(r.Context(), jobID)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get job")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dbJobToAPIJob(dbJob))
+}
+
+type MoveJobRequest struct {
+	Position string `json:"position"` // top, up, down or bottom
+}
+
+type MoveJobResponse struct {
+	ID       string   `json:"id"`
+	Position int      `json:"position"` // 1-based place in the queue
+	Queue    []string `json:"queue"`    // queued job IDs, next to run first
+}
+
+// handleMoveJob reorders a job that is still waiting for a worker
+func (s *Server) handleMoveJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "id")
+
+	var req MoveJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	switch req.Position {
+	case db.MoveTop, db.MoveUp, db.MoveDown, db.MoveBottom:
+	default:
+		apierr.Field(w, "position", "must be top, up, down or bottom")
+		return
+	}
+
+	position, err := s.db.MoveJob(r.Context(), jobID, req.Position)
+	switch {
+	case err == sql.ErrNoRows:
+		jobError(w, http.StatusNotFound, apierr.CodeNotFound, jobID, "Job not found")
+		return
+	case err == db.ErrJobNotQueued:
+		jobError(w, http.StatusConflict, apierr.CodeConflict, jobID, "Job has already been dispatched")
+		return
+	case err != nil:
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to move job")
+		return
+	}
+
+	queue, err := s.db.ListQueuedJobIDs(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list queue")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MoveJobResponse{ID: jobID, Position: position, Queue: queue})
+}
+
+func (s *Server) handleGetJobEvents(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "id")
+
+	if _, err := s.db.GetJob(r.Context(), jobID); err != nil {
+		if err == sql.ErrNoRows {
+			jobError(w, http.StatusNotFound, apierr.CodeNotFound, jobID, "Job not found")
+			return
+		}
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get job")
+		return
+	}
+
+	dbEvents, err := s.db.ListJobEvents(r.Context(), jobID)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list job events")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dbEventsToAPIEvents(dbEvents))
+}
+
+// dbEventsToAPIEvents converts a job's timeline, timing each event from
+// the one before
+func dbEventsToAPIEvents(dbEvents []*db.JobEvent) []JobEvent {
+	events := make([]JobEvent, len(dbEvents))
+	for i, e := range dbEvents {
+		events[i] = JobEvent{
+			Event:     e.Event,
+			Stage:     e.Stage,
+			Message:   e.Message,
+			Timestamp: e.CreatedAt.Format("2006-01-02T15:04:05.000Z07:00"),
+		}
+		if i > 0 {
+			events[i].SincePreviousMs = e.CreatedAt.Sub(dbEvents[i-1].CreatedAt).Milliseconds()
+		}
+	}
+	return events
 }
 
 func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
@@ -81,9 +309,26 @@ func dbJobToAPIJob(dbJob *db.Job) Job {
 		Status:    dbJob.Status,
 		Progress:  dbJob.Progress,
 		Stage:     dbJob.Stage,
+		Label:     dbJob.Label,
+		Notes:     dbJob.Notes,
 		Error:     dbJob.Error,
 		CreatedAt: dbJob.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 		UpdatedAt: dbJob.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		SessionID: dbJob.SessionID,
+	}
+	if !dbJob.ArchivedAt.IsZero() {
+		job.ArchivedAt = dbJob.ArchivedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	if dbJob.Metered {
+		gpuSeconds, energyWh := dbJob.GPUSeconds, dbJob.EnergyWh
+		job.GPUSeconds, job.EnergyWh = &gpuSeconds, &energyWh
+	}
+
+	if dbJob.Status == "running" && !dbJob.ETA.IsZero() {
+		job.ETA = dbJob.ETA.Format("2006-01-02T15:04:05Z07:00")
+		if left := time.Until(dbJob.ETA); left > 0 {
+			job.ETASeconds = int64(left.Seconds())
+		}
 	}
 
 	// Parse params JSON string into map
@@ -116,3 +361,8 @@ func dbJobToAPIJob(dbJob *db.Job) Job {
 
 	return job
 }
+
+// jobError writes an error about a specific job, tagging it with the job ID
+func jobError(w http.ResponseWriter, status int, code apierr.Code, jobID, message string) {
+	apierr.Write(w, status, &apierr.Error{Code: code, Message: message, JobID: jobID})
+}
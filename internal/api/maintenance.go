@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+)
+
+// maintenanceRetryAfter is the Retry-After hint, in seconds, on submissions
+// rejected during maintenance
+const maintenanceRetryAfter = 300
+
+// maintenanceState is whether new submissions are being turned away while
+// the queue drains
+type maintenanceState struct {
+	mu      sync.RWMutex
+	enabled bool
+	reason  string
+	since   time.Time
+	// initialActive is the number of unfinished jobs when maintenance
+	// started, the baseline for drain progress
+	initialActive int
+	// shuttingDown keeps maintenance on once the server is shutting down
+	shuttingDown bool
+}
+
+// errShuttingDown is returned when turning maintenance off during shutdown
+var errShuttingDown = errors.New("server is shutting down")
+
+type MaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+type MaintenanceStatus struct {
+	Enabled       bool   `json:"enabled"`
+	Reason        string `json:"reason,omitempty"`
+	Since         string `json:"since,omitempty"`
+	Pending       int    `json:"pending"`
+	WaitingModels int    `json:"waiting_models"`
+	Running       int    `json:"running"`
+	// Drained is true once maintenance is on and no jobs are left
+	Drained       bool    `json:"drained"`
+	DrainProgress float64 `json:"drain_progress"`
+}
+
+func (m *maintenanceState) active() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enabled
+}
+
+// rejectDuringMaintenance turns away new submissions while maintenance is on
+func (s *Server) rejectDuringMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.maintenance.active() {
+			w.Header().Set("Retry-After", strconv.Itoa(maintenanceRetryAfter))
+			apierr.Respond(w, http.StatusServiceUnavailable, apierr.CodeMaintenance, "Server is in maintenance mode, not accepting new jobs")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maintenanceStatus reports the maintenance flag and how far the queue has
+// drained
+func (s *Server) maintenanceStatus(ctx context.Context) (MaintenanceStatus, error) {
+	counts, err := s.db.CountActiveJobs(ctx)
+	if err != nil {
+		return MaintenanceStatus{}, err
+	}
+
+	s.maintenance.mu.RLock()
+	defer s.maintenance.mu.RUnlock()
+
+	status := MaintenanceStatus{
+		Enabled:       s.maintenance.enabled,
+		Reason:        s.maintenance.reason,
+		Pending:       counts["pending"],
+		WaitingModels: counts["waiting_models"],
+		Running:       counts["running"],
+	}
+	if !s.maintenance.enabled {
+		return status, nil
+	}
+
+	status.Since = s.maintenance.since.Format(time.RFC3339)
+	remaining := status.Pending + status.WaitingModels + status.Running
+	status.Drained = remaining == 0
+	if initial := s.maintenance.initialActive; initial > 0 && remaining < initial {
+		status.DrainProgress = 1 - float64(remaining)/float64(initial)
+	}
+	if status.Drained {
+		status.DrainProgress = 1
+	}
+	return status, nil
+}
+
+func (s *Server) handleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	status, err := s.maintenanceStatus(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to count jobs")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func (s *Server) handleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req MaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	status, err := s.setMaintenance(r.Context(), req)
+	switch {
+	case err == errShuttingDown:
+		apierr.Respond(w, http.StatusConflict, apierr.CodeShuttingDown, "Server is shutting down")
+		return
+	case err != nil:
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to count jobs")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// StopIntake turns away new submissions for good, as the first step of
+// shutting down
+func (s *Server) StopIntake(ctx context.Context, reason string) {
+	_, err := s.setMaintenance(ctx, MaintenanceRequest{Enabled: true, Reason: reason})
+	if err != nil {
+		log.Printf("Maintenance: failed to report drain status: %v", err)
+	}
+
+	// Submissions stop even if the status couldn't be worked out
+	s.maintenance.mu.Lock()
+	if !s.maintenance.enabled {
+		s.maintenance.enabled, s.maintenance.reason, s.maintenance.since = true, reason, time.Now()
+	}
+	s.maintenance.shuttingDown = true
+	s.maintenance.mu.Unlock()
+}
+
+// setMaintenance switches maintenance mode and announces the new status
+func (s *Server) setMaintenance(ctx context.Context, req MaintenanceRequest) (MaintenanceStatus, error) {
+	counts, err := s.db.CountActiveJobs(ctx)
+	if err != nil {
+		return MaintenanceStatus{}, err
+	}
+
+	s.maintenance.mu.Lock()
+	if s.maintenance.shuttingDown {
+		s.maintenance.mu.Unlock()
+		return MaintenanceStatus{}, errShuttingDown
+	}
+	switch {
+	case req.Enabled && !s.maintenance.enabled:
+		s.maintenance.since = time.Now()
+		s.maintenance.initialActive = counts["pending"] + counts["waiting_models"] + counts["running"]
+		log.Printf("Maintenance: enabled (%d jobs to drain): %s", s.maintenance.initialActive, req.Reason)
+	case !req.Enabled && s.maintenance.enabled:
+		log.Println("Maintenance: disabled, accepting jobs again")
+	}
+	s.maintenance.enabled = req.Enabled
+	s.maintenance.reason = req.Reason
+	if !req.Enabled {
+		s.maintenance.reason = ""
+	}
+	s.maintenance.mu.Unlock()
+
+	status, err := s.maintenanceStatus(ctx)
+	if err != nil {
+		return MaintenanceStatus{}, err
+	}
+	s.hub.BroadcastMaintenance(status)
+	return status, nil
+}
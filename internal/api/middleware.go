@@ -0,0 +1,275 @@
+package api
+
+import (
+	"context"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/auth"
+	"github.com/druarnfield/diffbox/internal/db"
+)
+
+// Optional middleware, turned on by config. See NewRouter for the order.
+
+// clientAddr is the host part of the request's remote address
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Request logging
+
+// secretParams matches query params that carry credentials. WebSocket and
+// MJPEG clients can't set headers, so they pass their API token as
+// ?token=.
+var secretParams = regexp.MustCompile(`(?i)\b(token|access_token|api_key|key|password|secret)=[^&\s"]+`)
+
+// redactSecrets replaces the values of secret query params in s
+func redactSecrets(s string) string {
+	return secretParams.ReplaceAllString(s, "$1=[redacted]")
+}
+
+// redactingLogFormatter logs requests with secret query params redacted
+type redactingLogFormatter struct {
+	middleware.LogFormatter
+}
+
+func (f redactingLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	redacted := *r
+	redacted.RequestURI = redactSecrets(r.RequestURI)
+	return f.LogFormatter.NewLogEntry(&redacted)
+}
+
+// requestLogger writes a line per request to the server log, which
+// diagnostics bundles include
+var requestLogger = middleware.RequestLogger(redactingLogFormatter{
+	&middleware.DefaultLogFormatter{Logger: log.Default(), NoColor: true},
+})
+
+// Request log
+
+const (
+	// requestLogBuffer is how many entries may wait to be written; past
+	// it requests go unlogged rather than waiting on the database
+	requestLogBuffer        = 1024
+	requestLogFlushInterval = time.Second
+	requestLogPruneInterval = time.Hour
+)
+
+// requestLog queues API requests and writes them to the database in
+// batches, keeping the last days of them
+type requestLog struct {
+	db      *db.DB
+	days    int
+	entries chan *db.RequestLogEntry
+}
+
+func newRequestLog(database *db.DB, days int) *requestLog {
+	return &requestLog{
+		db:      database,
+		days:    days,
+		entries: make(chan *db.RequestLogEntry, requestLogBuffer),
+	}
+}
+
+type requestLogKey struct{}
+
+// middleware times each API and WebSocket request and queues it for the
+// log. The path is kept without the query string, which may carry a
+// token.
+func (l *requestLog) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") && r.URL.Path != "/ws" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		entry := &db.RequestLogEntry{
+			At:         start,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			RemoteAddr: clientAddr(r),
+			RequestID:  middleware.GetReqID(r.Context()),
+		}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), requestLogKey{}, entry)))
+
+		entry.Status = ww.Status()
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		entry.Bytes = int64(ww.BytesWritten())
+		entry.DurationMs = time.Since(start).Milliseconds()
+		select {
+		case l.entries <- entry:
+		default:
+		}
+	})
+}
+
+// noteRequestUser records the authenticated user on the request's log
+// entry. It runs after auth, which the log itself runs before so refused
+// tokens are logged too.
+func noteRequestUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if entry, ok := r.Context().Value(requestLogKey{}).(*db.RequestLogEntry); ok {
+			if user := auth.UserFromContext(r.Context()); user != nil {
+				entry.UserID = user.ID
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// run writes queued entries every second and prunes old ones hourly until
+// ctx is done, then writes what is left
+func (l *requestLog) run(ctx context.Context) {
+	flush := time.NewTicker(requestLogFlushInterval)
+	defer flush.Stop()
+	prune := time.NewTicker(requestLogPruneInterval)
+	defer prune.Stop()
+
+	l.prune()
+	var batch []*db.RequestLogEntry
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := l.db.RecordRequests(context.Background(), batch); err != nil {
+			log.Printf("Request log: Failed to write %d entries: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case entry := <-l.entries:
+			batch = append(batch, entry)
+		case <-flush.C:
+			write()
+		case <-prune.C:
+			l.prune()
+		case <-ctx.Done():
+			for len(l.entries) > 0 {
+				batch = append(batch, <-l.entries)
+			}
+			write()
+			return
+		}
+	}
+}
+
+// prune drops entries older than the retention
+func (l *requestLog) prune() {
+	before := time.Now().Add(-time.Duration(l.days) * 24 * time.Hour)
+	n, err := l.db.PruneRequestLog(context.Background(), before)
+	if err != nil {
+		log.Printf("Request log: Failed to prune: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Request log: Pruned %d entries older than %d days", n, l.days)
+	}
+}
+
+// RunRequestLog writes the request log until ctx is done. It does nothing
+// unless the log is enabled.
+func (s *Server) RunRequestLog(ctx context.Context) {
+	if s.requestLog != nil {
+		s.requestLog.run(ctx)
+	}
+}
+
+// Rate limiting
+
+// rateLimiter gives each client a bucket of perMinute requests, refilled
+// evenly over the minute
+type rateLimiter struct {
+	perMinute int
+	byUser    bool // Key on the user rather than the address
+
+	mu        sync.Mutex
+	buckets   map[string]*rateBucket
+	lastSweep time.Time
+}
+
+type rateBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+func newRateLimiter(perMinute int, byUser bool) *rateLimiter {
+	return &rateLimiter{
+		perMinute: perMinute,
+		byUser:    byUser,
+		buckets:   make(map[string]*rateBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a request from key's bucket, or returns how long until one
+// is available
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	capacity := float64(l.perMinute)
+	perSecond := capacity / 60
+	// Full buckets are the same as none, so idle clients are forgotten
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.at).Seconds()*perSecond >= capacity {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &rateBucket{tokens: capacity, at: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.at).Seconds()*perSecond)
+	b.at = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// middleware refuses API requests over the limit with 429 and a
+// Retry-After header. Health checks aren't counted.
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "addr:" + clientAddr(r)
+		if user := auth.UserFromContext(r.Context()); l.byUser && user != nil {
+			key = "user:" + user.ID
+		}
+		if ok, wait := l.allow(key, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			apierr.Respond(w, http.StatusTooManyRequests, apierr.CodeRateLimited, "Too many requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultUnusedDays is how long a model must go unused before it is
+// suggested for cleanup
+const defaultUnusedDays = 60
+
+type ModelSuggestionsResponse struct {
+	Days        int                 `json:"days"`
+	TotalSize   int64               `json:"total_size"`
+	Suggestions []models.Suggestion `json:"suggestions"`
+}
+
+type ModelPinRequest struct {
+	Name   string `json:"name"`
+	Pinned bool   `json:"pinned"`
+}
+
+func (s *Server) handleModelSuggestions(w http.ResponseWriter, r *http.Request) {
+	days := defaultUnusedDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			apierr.Field(w, "days", "must be a non-negative integer")
+			return
+		}
+		days = n
+	}
+
+	records, err := s.db.ListModelUsage(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to load model usage")
+		return
+	}
+	usage := make(map[string]models.Usage, len(records))
+	for name, rec := range records {
+		u := models.Usage{Pinned: rec.Pinned}
+		if rec.LastUsedAt != nil {
+			u.LastUsed = *rec.LastUsedAt
+		}
+		usage[name] = u
+	}
+
+	resp := ModelSuggestionsResponse{
+		Days:        days,
+		Suggestions: models.UnusedModels(s.cfg.ModelsDir, usage, time.Duration(days)*24*time.Hour, time.Now()),
+	}
+	if resp.Suggestions == nil {
+		resp.Suggestions = []models.Suggestion{}
+	}
+	for _, sg := range resp.Suggestions {
+		resp.TotalSize += sg.Size
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleSetModelPin pins or unpins a required model so cleanup leaves it
+// alone. Names can contain slashes, so they travel in the body.
+func (s *Server) handleSetModelPin(w http.ResponseWriter, r *http.Request) {
+	var req ModelPinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	known := false
+	for _, m := range models.RequiredModels() {
+		if m.Name == req.Name {
+			known = true
+			break
+		}
+	}
+	if !known {
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeModelMissing, "Unknown model")
+		return
+	}
+
+	if err := s.db.SetModelPinned(r.Context(), req.Name, req.Pinned); err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to update pin")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+// RemapModelRequest points a required model at a new URL; an empty URL
+// restores the manifest's
+type RemapModelRequest struct {
+	URL string `json:"url"`
+}
+
+type RemapModelResponse struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	PreviousURL string `json:"previous_url"`
+	Workflow    string `json:"workflow"`
+	Size        int64  `json:"size"`
+	// PartialSize is how much of the file is already on disk and
+	// Resumable whether aria2 can carry on from it
+	PartialSize int64 `json:"partial_size"`
+	Resumable   bool  `json:"resumable"`
+	// Moved is set if a download in progress switched to the new URL
+	Moved bool `json:"moved"`
+}
+
+// handleRemapRequiredModel points a required model at a new URL after it
+// moves upstream, keeping what was downloaded. Names can contain slashes,
+// so the route matches the rest of the path.
+func (s *Server) handleRemapRequiredModel(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "*")
+	var req RemapModelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if req.URL != "" {
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			apierr.Field(w, "url", "must be an http or https URL")
+			return
+		}
+	}
+	if _, ok := models.RequiredModel(name); !ok {
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeModelMissing, "Unknown model")
+		return
+	}
+
+	if err := s.db.SetModelURL(r.Context(), name, req.URL); err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to save model URL")
+		return
+	}
+	result, err := s.downloader.Remap(r.Context(), name, req.URL)
+	if errors.Is(err, models.ErrNotRequired) {
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeModelMissing, "Unknown model")
+		return
+	}
+	if err != nil {
+		// The new URL is kept and used the next time the file is queued
+		log.Printf("Models: Failed to move download of %s: %v", name, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RemapModelResponse{
+		Name:        result.Model.Name,
+		URL:         result.Model.URL,
+		PreviousURL: result.PreviousURL,
+		Workflow:    result.Model.Workflow,
+		Size:        result.Model.Size,
+		PartialSize: result.PartialSize,
+		Resumable:   result.Resumable,
+		Moved:       result.Moved,
+	})
+}
+
+func (s *Server) handleListModelAliases(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.aliases.List())
+}
@@ -1,16 +1,26 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"time"
 
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/aria2"
 	"github.com/druarnfield/diffbox/internal/models"
 	"github.com/go-chi/chi/v5"
 )
 
+// aria2Timeout bounds the aria2 calls made for one request. When aria2
+// hangs, downloads are reported from what is on disk instead.
+const aria2Timeout = 5 * time.Second
+
+// maxListedDownloads bounds how much of aria2's waiting queue is read
+const maxListedDownloads = 1000
+
 type Model struct {
 	ID           string   `json:"id"`
 	Source       string   `json:"source"` // "huggingface" or "civitai"
@@ -64,6 +74,11 @@ func (s *Server) handleListLocalModels(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(models)
 }
 
+func (s *Server) handleModelVerification(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.downloader.Verifier().Status())
+}
+
 func (s *Server) handleGetModel(w http.ResponseWriter, r *http.Request) {
 	source := chi.URLParam(r, "source")
 	id := chi.URLParam(r, "id")
@@ -115,11 +130,34 @@ type DownloadStatus struct {
 }
 
 func (s *Server) handleListDownloads(w http.ResponseWriter, r *http.Request) {
+	downloads, err := s.downloadStatuses(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list downloads")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(downloads)
+}
+
+// downloadStatuses reports each required model by the aria2 download
+// tracked for it. Files without a live download are complete if they are
+// on disk at full size and missing otherwise; an interrupted download
+// resumes once the file is queued again.
+func (s *Server) downloadStatuses(ctx context.Context) ([]DownloadStatus, error) {
 	requiredModels := models.RequiredModels()
 	downloads := make([]DownloadStatus, 0, len(requiredModels))
 
-	// Get all active downloads from aria2
-	activeDownloads, _ := s.aria2Client.TellActive()
+	tracked, err := s.db.ListTrackedDownloads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gids := make(map[string]string, len(tracked))
+	for _, d := range tracked {
+		gids[d.Name] = d.GID
+	}
+	ctx, cancel := context.WithTimeout(ctx, aria2Timeout)
+	defer cancel()
 
 	parseSize := func(s string) int64 {
 		var n int64
@@ -127,25 +165,20 @@ func (s *Server) handleListDownloads(w http.ResponseWriter, r *http.Request) {
 		return n
 	}
 
-	// Build a map of filename -> aria2 status for quick lookup
-	aria2ByFilename := make(map[string]*struct {
-		completedLength int64
-		totalLength     int64
-		downloadSpeed   int64
-	})
-	for _, active := range activeDownloads {
-		// Get filename from aria2's Files array
-		if len(active.Files) > 0 && active.Files[0].Path != "" {
-			filename := filepath.Base(active.Files[0].Path)
-			completedLength := parseSize(active.CompletedLength)
-			totalLength := parseSize(active.TotalLength)
-			downloadSpeed := parseSize(active.DownloadSpeed)
-
-			aria2ByFilename[filename] = &struct {
-				completedLength int64
-				totalLength     int64
-				downloadSpeed   int64
-			}{completedLength, totalLength, downloadSpeed}
+	// One listing of aria2's queue covers every tracked download. Finished
+	// ones have left it and are judged from the file on disk below.
+	live := make(map[string]aria2.DownloadStatus)
+	if len(gids) > 0 {
+		active, err := s.aria2Client.TellActive(ctx)
+		if err != nil {
+			log.Printf("Models: failed to list active downloads: %v", err)
+		}
+		waiting, err := s.aria2Client.TellWaiting(ctx, 0, maxListedDownloads)
+		if err != nil {
+			log.Printf("Models: failed to list waiting downloads: %v", err)
+		}
+		for _, status := range append(active, waiting...) {
+			live[status.GID] = status
 		}
 	}
 
@@ -157,65 +190,98 @@ func (s *Server) handleListDownloads(w http.ResponseWriter, r *http.Request) {
 			Workflow:  model.Workflow,
 		}
 
-		filePath := filepath.Join(s.cfg.ModelsDir, model.Name)
-		controlFile := filePath + ".aria2" // aria2 creates this file during download
-
-		// FIRST: Check for .aria2 control file (most reliable indicator of in-progress download)
-		if _, err := os.Stat(controlFile); err == nil {
-			status.Status = "downloading"
-
-			// Try to find this download in aria2's active list by filename
-			if aria2Status, found := aria2ByFilename[model.Name]; found {
-				// Use aria2's actual progress, not file size (aria2 pre-allocates!)
-				status.CompletedSize = aria2Status.completedLength
-				status.DownloadSpeed = aria2Status.downloadSpeed
-				if aria2Status.totalLength > 0 {
-					status.Progress = float64(aria2Status.completedLength) / float64(aria2Status.totalLength) * 100
+		if gid, ok := gids[model.Name]; ok {
+			if aria2Status, ok := live[gid]; ok {
+				// Use aria2's progress, not the file size: it pre-allocates
+				total := parseSize(aria2Status.TotalLength)
+				if total == 0 {
+					total = model.Size
+				}
+				status.CompletedSize = parseSize(aria2Status.CompletedLength)
+				if total > 0 {
+					status.Progress = float64(status.CompletedSize) / float64(total) * 100
+				}
+				switch aria2Status.Status {
+				case "active":
+					status.Status = "downloading"
+					status.DownloadSpeed = parseSize(aria2Status.DownloadSpeed)
+				case "waiting", "paused":
+					status.Status = "queued"
 				}
-			} else {
-				// If not found in active downloads, fall back to file size
-				// This can happen if aria2 just finished but hasn't removed .aria2 yet
-				if fileInfo, err := os.Stat(filePath); err == nil {
-					status.CompletedSize = fileInfo.Size()
-					if model.Size > 0 {
-						status.Progress = float64(fileInfo.Size()) / float64(model.Size) * 100
-					}
+				if status.Status != "" {
+					downloads = append(downloads, status)
+					continue
 				}
 			}
-
-			downloads = append(downloads, status)
-			continue
 		}
 
-		// SECOND: Check if complete file exists locally (no .aria2 file = download finished)
-		fileInfo, err := os.Stat(filePath)
-		if err == nil && fileInfo.Size() >= int64(float64(model.Size)*0.99) {
+		store := s.downloader.Storage()
+		fileInfo, err := store.Stat(model.Name)
+		if _, ctlErr := store.Stat(model.Name + ".aria2"); err == nil && ctlErr != nil && fileInfo.Size() >= int64(float64(model.Size)*0.99) {
 			status.Status = "complete"
 			status.Progress = 100.0
 			status.CompletedSize = fileInfo.Size()
-			downloads = append(downloads, status)
-			continue
-		}
-
-		// LAST: File doesn't exist or is incomplete with no active download
-		if err == nil {
-			// Partial file exists but no .aria2 control file
-			status.Status = "downloading"
-			status.CompletedSize = fileInfo.Size()
-			if model.Size > 0 {
-				status.Progress = float64(fileInfo.Size()) / float64(model.Size) * 100
-			}
 		} else {
 			status.Status = "missing"
 			status.Progress = 0
 			status.CompletedSize = 0
 		}
-
 		downloads = append(downloads, status)
 	}
+	return downloads, nil
+}
+
+type DownloadHistoryEntry struct {
+	Name       string  `json:"name"`
+	URL        string  `json:"url"`
+	Mirror     string  `json:"mirror,omitempty"` // hosts the file came from
+	Workflow   string  `json:"workflow"`
+	Status     string  `json:"status"` // "complete" or "failed"
+	Size       int64   `json:"size"`
+	DurationMs int64   `json:"duration_ms"`
+	AvgSpeed   float64 `json:"avg_speed"` // bytes per second
+	Retries    int     `json:"retries"`
+	Error      string  `json:"error,omitempty"`
+	FinishedAt string  `json:"finished_at"`
+}
+
+func (s *Server) handleDownloadHistory(w http.ResponseWriter, r *http.Request) {
+	records, err := s.db.ListDownloadHistory(r.Context(), 200)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list download history")
+		return
+	}
+
+	history := make([]DownloadHistoryEntry, len(records))
+	for i, rec := range records {
+		history[i] = DownloadHistoryEntry{
+			Name:       rec.Name,
+			URL:        rec.URL,
+			Mirror:     rec.Mirror,
+			Workflow:   rec.Workflow,
+			Status:     rec.Status,
+			Size:       rec.Size,
+			DurationMs: rec.DurationMs,
+			AvgSpeed:   rec.AvgSpeed,
+			Retries:    rec.Retries,
+			Error:      rec.Error,
+			FinishedAt: rec.FinishedAt.Format("2006-01-02T15:04:05Z07:00"),
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(downloads)
+	json.NewEncoder(w).Encode(history)
+}
+
+// handleListMirrors reports the latest probe of each download mirror
+func (s *Server) handleListMirrors(w http.ResponseWriter, r *http.Request) {
+	probes := []models.MirrorProbe{}
+	if sel := s.downloader.MirrorSelector(); sel != nil {
+		probes = sel.Probes()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(probes)
 }
 
 func (s *Server) handleCancelDownload(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,457 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/auth"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/models"
+	"github.com/druarnfield/diffbox/internal/pipeline"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// pipelineHistory is how many pipelines are listed
+const pipelineHistory = 50
+
+// maxPipelineBytes bounds a pipeline document, whose steps may carry
+// images inline
+const maxPipelineBytes = 64 << 20
+
+type PipelineStep struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Needs lists every step this one waits for, named or referred to
+	Needs  []string   `json:"needs,omitempty"`
+	Status string     `json:"status"`
+	JobID  string     `json:"job_id,omitempty"`
+	Error  string     `json:"error,omitempty"`
+	Output *JobOutput `json:"output,omitempty"`
+}
+
+type Pipeline struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Status is running while any step may still run, then completed if
+	// every step did and failed otherwise
+	Status    string         `json:"status"`
+	SessionID string         `json:"session_id,omitempty"`
+	CreatedAt string         `json:"created_at"`
+	UpdatedAt string         `json:"updated_at"`
+	Steps     []PipelineStep `json:"steps"`
+	// Outputs are those of the completed steps no other step depends on
+	Outputs []JobOutput `json:"outputs"`
+}
+
+// handleCreatePipeline accepts a pipeline document, JSON or YAML by
+// Content-Type, and submits the steps that depend on nothing. The rest
+// are submitted as the jobs they wait for complete. Each step goes
+// through its workflow's own submit handler as the pipeline's owner, so
+// it is validated, admitted and queued like any job; a step refused there
+// fails, and the steps depending on it are skipped. If no step could be
+// queued at all, nothing is kept and the first refusal is passed on.
+func (s *Server) handleCreatePipeline(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPipelineBytes))
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	spec, err := pipeline.Parse(data, pipeline.IsYAML(r.Header.Get("Content-Type")))
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid pipeline: "+err.Error())
+		return
+	}
+	if fieldErrors := spec.Validate(); fieldErrors != nil {
+		apierr.Write(w, http.StatusBadRequest, &apierr.Error{
+			Code:        apierr.CodeValidationFailed,
+			Message:     "Invalid pipeline",
+			FieldErrors: fieldErrors,
+		})
+		return
+	}
+	for i, st := range spec.Steps {
+		field := fmt.Sprintf("steps[%d].type", i)
+		if s.submitHandler(st.Type) == nil {
+			apierr.Field(w, field, "unknown workflow "+st.Type)
+			return
+		}
+		if workflow := models.WorkflowForJobType(st.Type); !models.WorkflowEnabled(workflow) {
+			apierr.Field(w, field, "the "+workflow+" workflow is disabled in setup")
+			return
+		}
+	}
+
+	sessionID, ok := s.jobSession(w, r)
+	if !ok {
+		return
+	}
+	owner := auth.UserFromContext(r.Context())
+	var userID string
+	if owner != nil {
+		userID = owner.ID
+	}
+
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to serialize pipeline")
+		return
+	}
+	p := &db.Pipeline{
+		ID:        uuid.New().String(),
+		Name:      spec.Name,
+		Spec:      string(specJSON),
+		UserID:    userID,
+		SessionID: sessionID,
+	}
+	for _, st := range spec.Steps {
+		p.Steps = append(p.Steps, &db.PipelineStep{StepID: st.ID, Type: st.Type, Status: pipeline.StepWaiting})
+	}
+	// Stored first, so a job finishing straight away finds its step
+	if err := s.db.CreatePipeline(r.Context(), p); err != nil {
+		log.Printf("Pipeline: Failed to store pipeline %s: %v", p.ID, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to store pipeline")
+		return
+	}
+
+	s.pipelineMu.Lock()
+	refused := s.advancePipeline(r.Context(), p, spec, owner)
+	s.pipelineMu.Unlock()
+
+	queued := 0
+	for _, st := range p.Steps {
+		if st.JobID != "" {
+			queued++
+		}
+	}
+	if queued == 0 {
+		if err := s.db.DeletePipeline(r.Context(), p.ID); err != nil {
+			log.Printf("Pipeline: Failed to delete refused pipeline %s: %v", p.ID, err)
+		}
+		for k, v := range refused.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(refused.Code)
+		w.Write(refused.Body.Bytes())
+		return
+	}
+	log.Printf("Pipeline: Pipeline %s created with %d steps, %d queued", p.ID, len(p.Steps), queued)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(s.pipelineView(r.Context(), p))
+}
+
+// handleListPipelines lists recent pipelines, newest first
+func (s *Server) handleListPipelines(w http.ResponseWriter, r *http.Request) {
+	dbPipelines, err := s.db.ListPipelines(r.Context(), pipelineHistory)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list pipelines")
+		return
+	}
+	pipelines := make([]Pipeline, 0, len(dbPipelines))
+	for _, p := range dbPipelines {
+		s.reconcilePipeline(r.Context(), p)
+		pipelines = append(pipelines, s.pipelineView(r.Context(), p))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pipelines)
+}
+
+func (s *Server) handleGetPipeline(w http.ResponseWriter, r *http.Request) {
+	p, err := s.db.GetPipeline(r.Context(), chi.URLParam(r, "id"))
+	if err == sql.ErrNoRows {
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Pipeline not found")
+		return
+	}
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get pipeline")
+		return
+	}
+	s.reconcilePipeline(r.Context(), p)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.pipelineView(r.Context(), p))
+}
+
+// AdvancePipeline records a finished job's step if it belongs to a
+// pipeline and submits the steps that were waiting for it. errorMsg is
+// empty for a job that completed.
+func (s *Server) AdvancePipeline(ctx context.Context, jobID, errorMsg string) {
+	s.pipelineMu.Lock()
+	defer s.pipelineMu.Unlock()
+
+	pipelineID, _, err := s.db.GetPipelineByJob(ctx, jobID)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		log.Printf("Pipeline: Failed to look up job %s: %v", jobID, err)
+		return
+	}
+	p, err := s.db.GetPipeline(ctx, pipelineID)
+	if err != nil {
+		log.Printf("Pipeline: Failed to get pipeline %s: %v", pipelineID, err)
+		return
+	}
+	status := pipeline.StepCompleted
+	if errorMsg != "" {
+		status = pipeline.StepFailed
+	}
+	if s.finishPipelineStep(ctx, p, jobID, status, errorMsg) {
+		s.resumePipeline(ctx, p)
+	}
+}
+
+// ReconcilePipelines settles the steps of every unfinished pipeline whose
+// job ended without reporting, and submits the steps that were waiting on
+// them. Run at startup, after jobs from the previous run were marked
+// interrupted.
+func (s *Server) ReconcilePipelines(ctx context.Context) {
+	pipelines, err := s.db.ListPipelinesWithStepStatus(ctx, pipeline.StepQueued)
+	if err != nil {
+		log.Printf("Pipeline: Failed to list unfinished pipelines: %v", err)
+		return
+	}
+	for _, p := range pipelines {
+		s.reconcilePipeline(ctx, p)
+	}
+}
+
+// reconcilePipeline settles steps whose job will never report, say after
+// a restart interrupted it or it was purged, with the job's status, and
+// moves the pipeline on from them
+func (s *Server) reconcilePipeline(ctx context.Context, p *db.Pipeline) {
+	if !slices.ContainsFunc(p.Steps, func(st *db.PipelineStep) bool { return st.Status == pipeline.StepQueued }) {
+		return
+	}
+	s.pipelineMu.Lock()
+	defer s.pipelineMu.Unlock()
+
+	// Read again under the lock, in case a job reported meanwhile
+	fresh, err := s.db.GetPipeline(ctx, p.ID)
+	if err != nil {
+		return
+	}
+	*p = *fresh
+	finished := false
+	for _, st := range p.Steps {
+		if st.Status != pipeline.StepQueued {
+			continue
+		}
+		job, err := s.db.GetJob(ctx, st.JobID)
+		switch {
+		case err == sql.ErrNoRows:
+			finished = s.finishPipelineStep(ctx, p, st.JobID, pipeline.StepFailed, "job was purged before it finished") || finished
+		case err == nil && job.Status == "completed":
+			finished = s.finishPipelineStep(ctx, p, st.JobID, pipeline.StepCompleted, "") || finished
+		case err == nil && !jobActive(job.Status):
+			errorMsg := job.Error
+			if errorMsg == "" {
+				errorMsg = "job was " + job.Status
+			}
+			finished = s.finishPipelineStep(ctx, p, st.JobID, pipeline.StepFailed, errorMsg) || finished
+		}
+	}
+	if finished {
+		s.resumePipeline(ctx, p)
+	}
+}
+
+// finishPipelineStep records how the queued step of a job ended, reporting
+// whether there was such a step
+func (s *Server) finishPipelineStep(ctx context.Context, p *db.Pipeline, jobID, status, errorMsg string) bool {
+	i := slices.IndexFunc(p.Steps, func(st *db.PipelineStep) bool {
+		return st.JobID == jobID && st.Status == pipeline.StepQueued
+	})
+	if i < 0 {
+		return false
+	}
+	s.setPipelineStep(ctx, p, p.Steps[i], status, jobID, errorMsg)
+	return true
+}
+
+// resumePipeline submits the steps of a stored pipeline that have become
+// ready, as its owner
+func (s *Server) resumePipeline(ctx context.Context, p *db.Pipeline) {
+	var spec pipeline.Spec
+	if err := json.Unmarshal([]byte(p.Spec), &spec); err != nil {
+		log.Printf("Pipeline: Failed to read spec of pipeline %s: %v", p.ID, err)
+		return
+	}
+	s.advancePipeline(ctx, p, &spec, s.pipelineOwner(ctx, p.UserID))
+}
+
+// advancePipeline skips the steps that can no longer run and submits
+// those whose dependencies have all completed, until neither is left. It
+// returns the response of the first refused submission, or nil. Callers
+// hold pipelineMu.
+func (s *Server) advancePipeline(ctx context.Context, p *db.Pipeline, spec *pipeline.Spec, owner *auth.User) *httptest.ResponseRecorder {
+	var refused *httptest.ResponseRecorder
+	for {
+		for _, id := range spec.Blocked(pipelineStatuses(p)) {
+			s.setPipelineStep(ctx, p, pipelineStep(p, id), pipeline.StepSkipped, "", "a step it needs did not complete")
+		}
+		ready := spec.Ready(pipelineStatuses(p))
+		if len(ready) == 0 {
+			return refused
+		}
+
+		jobIDs := make(map[string]string, len(p.Steps))
+		for _, st := range p.Steps {
+			jobIDs[st.StepID] = st.JobID
+		}
+		for _, id := range ready {
+			st := spec.Steps[slices.IndexFunc(spec.Steps, func(st pipeline.Step) bool { return st.ID == id })]
+			rec := s.submitPipelineStep(ctx, p, owner, st, jobIDs)
+			var resp JobResponse
+			if rec.Code/100 == 2 && json.Unmarshal(rec.Body.Bytes(), &resp) == nil && resp.ID != "" {
+				s.setPipelineStep(ctx, p, pipelineStep(p, id), pipeline.StepQueued, resp.ID, "")
+				continue
+			}
+			var e apierr.Error
+			json.Unmarshal(rec.Body.Bytes(), &e)
+			message := e.Message
+			for field, msg := range e.FieldErrors {
+				message += "; " + field + ": " + msg
+			}
+			log.Printf("Pipeline: Step %s of pipeline %s refused: %d %s", id, p.ID, rec.Code, message)
+			s.setPipelineStep(ctx, p, pipelineStep(p, id), pipeline.StepFailed, "", message)
+			if refused == nil {
+				refused = rec
+			}
+		}
+	}
+}
+
+// submitPipelineStep submits a step through its workflow's handler, with
+// references to earlier steps resolved: outputs become output references
+// the handlers read the file from, job IDs are passed as they are
+func (s *Server) submitPipelineStep(ctx context.Context, p *db.Pipeline, owner *auth.User, st pipeline.Step, jobIDs map[string]string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	if owner == nil {
+		apierr.Respond(rec, http.StatusForbidden, apierr.CodeForbidden, "The pipeline's owner no longer exists")
+		return rec
+	}
+	submit := s.submitHandler(st.Type)
+	if submit == nil {
+		apierr.Respond(rec, http.StatusConflict, apierr.CodeConflict, "Workflow "+st.Type+" is not available")
+		return rec
+	}
+	params := pipeline.Resolve(st.Params, func(ref pipeline.Ref) string {
+		if ref.Field == pipeline.FieldOutput {
+			return outputRefPrefix + jobIDs[ref.Step]
+		}
+		return jobIDs[ref.Step]
+	})
+	body, err := json.Marshal(params)
+	if err != nil {
+		apierr.Respond(rec, http.StatusInternalServerError, apierr.CodeInternal, "Failed to serialize params")
+		return rec
+	}
+	req, err := http.NewRequestWithContext(auth.WithUser(ctx, owner), http.MethodPost, "/api/pipelines/"+p.ID, bytes.NewReader(body))
+	if err != nil {
+		apierr.Respond(rec, http.StatusInternalServerError, apierr.CodeInternal, "Failed to build request")
+		return rec
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.SessionID != "" {
+		req.Header.Set(SessionHeader, p.SessionID)
+	}
+	submit(rec, req)
+	return rec
+}
+
+// pipelineOwner returns the user a stored pipeline submits as, or nil if
+// they have since been deleted
+func (s *Server) pipelineOwner(ctx context.Context, userID string) *auth.User {
+	if userID == auth.LocalAdmin.ID {
+		return auth.LocalAdmin
+	}
+	users, err := s.db.ListUsers(ctx)
+	if err != nil {
+		log.Printf("Pipeline: Failed to list users: %v", err)
+		return nil
+	}
+	for _, u := range users {
+		if u.ID == userID {
+			return &auth.User{ID: u.ID, Name: u.Name, Role: auth.Role(u.Role)}
+		}
+	}
+	return nil
+}
+
+// setPipelineStep records a step's status, in the DB and in p
+func (s *Server) setPipelineStep(ctx context.Context, p *db.Pipeline, st *db.PipelineStep, status, jobID, errorMsg string) {
+	st.Status, st.JobID, st.Error = status, jobID, errorMsg
+	if err := s.db.UpdatePipelineStep(ctx, p.ID, st.StepID, status, jobID, errorMsg); err != nil {
+		log.Printf("Pipeline: Failed to record step %s of pipeline %s: %v", st.StepID, p.ID, err)
+	}
+}
+
+func pipelineStep(p *db.Pipeline, id string) *db.PipelineStep {
+	return p.Steps[slices.IndexFunc(p.Steps, func(st *db.PipelineStep) bool { return st.StepID == id })]
+}
+
+func pipelineStatuses(p *db.Pipeline) map[string]string {
+	status := make(map[string]string, len(p.Steps))
+	for _, st := range p.Steps {
+		status[st.StepID] = st.Status
+	}
+	return status
+}
+
+// pipelineView converts a pipeline for the API
+func (s *Server) pipelineView(ctx context.Context, p *db.Pipeline) Pipeline {
+	var spec pipeline.Spec
+	json.Unmarshal([]byte(p.Spec), &spec)
+	deps := make(map[string][]string, len(spec.Steps))
+	for _, st := range spec.Steps {
+		deps[st.ID] = st.Deps()
+	}
+
+	view := Pipeline{
+		ID:        p.ID,
+		Name:      p.Name,
+		Status:    pipeline.Status(pipelineStatuses(p)),
+		SessionID: p.SessionID,
+		CreatedAt: p.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt: p.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Steps:     make([]PipelineStep, 0, len(p.Steps)),
+		Outputs:   []JobOutput{},
+	}
+	outputs := make(map[string]*JobOutput)
+	for _, st := range p.Steps {
+		step := PipelineStep{
+			ID:     st.StepID,
+			Type:   st.Type,
+			Needs:  deps[st.StepID],
+			Status: st.Status,
+			JobID:  st.JobID,
+			Error:  st.Error,
+		}
+		if st.Status == pipeline.StepCompleted {
+			if job, err := s.db.GetJob(ctx, st.JobID); err == nil {
+				step.Output = dbJobToAPIJob(job).Output
+				outputs[st.StepID] = step.Output
+			}
+		}
+		view.Steps = append(view.Steps, step)
+	}
+	for _, id := range spec.Sinks() {
+		if output := outputs[id]; output != nil {
+			view.Outputs = append(view.Outputs, *output)
+		}
+	}
+	return view
+}
@@ -0,0 +1,428 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/models"
+	"github.com/druarnfield/diffbox/internal/paramtpl"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Limits on presets
+const (
+	maxPresetNameLength = 200
+	maxSharedPresetSize = 64 * 1024
+	maxPresetVariables  = 50
+)
+
+// sharedPresetFormat versions the export blob so old links stay importable
+const sharedPresetFormat = 1
+
+// presetWorkflows are the built-in workflows a preset can target
+var presetWorkflows = map[string]bool{"i2v": true, "svi": true, "qwen": true, "chat": true}
+
+// jobOnlyParams belong to a single job rather than a reusable preset, and
+// are never stored in or shared with one
+var jobOnlyParams = []string{"input_image", "edit_images", "inpaint_mask", "prompt_id"}
+
+// SharedPreset is the portable form of a preset, with no ID
+type SharedPreset struct {
+	Format    int                    `json:"diffbox_preset"`
+	Name      string                 `json:"name"`
+	Workflow  string                 `json:"workflow"`
+	Params    map[string]interface{} `json:"params"`
+	Variables []paramtpl.Variable    `json:"variables,omitempty"`
+}
+
+type PresetExport struct {
+	Preset  SharedPreset `json:"preset"`
+	Encoded string       `json:"encoded"` // base64url of the preset JSON
+	URL     string       `json:"url"`     // opens the workflow with the preset attached
+}
+
+// PresetImportRequest carries a shared preset as JSON, or as the encoded
+// form or share URL from an export. With DryRun it is only checked.
+type PresetImportRequest struct {
+	Preset  *SharedPreset `json:"preset,omitempty"`
+	Encoded string        `json:"encoded,omitempty"`
+	Name    string        `json:"name,omitempty"` // overrides the shared name
+	DryRun  bool          `json:"dry_run"`
+}
+
+// PresetWarning flags a model the preset references that isn't usable here
+type PresetWarning struct {
+	Field   string `json:"field"`
+	Model   string `json:"model"`
+	Message string `json:"message"`
+}
+
+type PresetImportResponse struct {
+	Preset   Preset          `json:"preset"`
+	Saved    bool            `json:"saved"`
+	Warnings []PresetWarning `json:"warnings"`
+}
+
+func (s *Server) handleListPresets(w http.ResponseWriter, r *http.Request) {
+	dbPresets, err := s.db.ListPresets(r.Context(), r.URL.Query().Get("workflow"))
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list presets")
+		return
+	}
+
+	presets := make([]Preset, 0, len(dbPresets))
+	for _, p := range dbPresets {
+		presets = append(presets, dbPresetToAPIPreset(p))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(presets)
+}
+
+func (s *Server) handleGetPreset(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.loadPreset(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dbPresetToAPIPreset(p))
+}
+
+func (s *Server) handleCreatePreset(w http.ResponseWriter, r *http.Request) {
+	var req Preset
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	shared := SharedPreset{Format: sharedPresetFormat, Name: req.Name, Workflow: req.Workflow, Params: req.Params, Variables: req.Variables}
+	if !s.validatePreset(w, &shared) {
+		return
+	}
+	preset, ok := s.savePreset(w, r, shared)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(preset)
+}
+
+func (s *Server) handleDeletePreset(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.DeletePreset(r.Context(), chi.URLParam(r, "id")); err != nil {
+		if err == sql.ErrNoRows {
+			apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Preset not found")
+			return
+		}
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to delete preset")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleExportPreset returns a preset in a form that can be pasted or
+// linked into another diffbox install
+func (s *Server) handleExportPreset(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.loadPreset(w, r)
+	if !ok {
+		return
+	}
+
+	preset := dbPresetToAPIPreset(p)
+	shared := SharedPreset{
+		Format:    sharedPresetFormat,
+		Name:      preset.Name,
+		Workflow:  preset.Workflow,
+		Params:    preset.Params,
+		Variables: preset.Variables,
+	}
+	data, err := json.Marshal(shared)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to serialize preset")
+		return
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+
+	// The fragment never reaches the server, so shared params stay out of
+	// access logs
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	share := url.URL{Scheme: scheme, Host: r.Host, Path: "/workflow/" + preset.Workflow, Fragment: "preset=" + encoded}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PresetExport{Preset: shared, Encoded: encoded, URL: share.String()})
+}
+
+// handleImportPreset validates a shared preset, reports any models it
+// needs that aren't available here, and saves it unless it's a dry run
+func (s *Server) handleImportPreset(w http.ResponseWriter, r *http.Request) {
+	var req PresetImportRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxSharedPresetSize)).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	shared := req.Preset
+	if shared == nil {
+		if req.Encoded == "" {
+			apierr.Field(w, "preset", "either preset or encoded is required")
+			return
+		}
+		decoded, err := decodeSharedPreset(req.Encoded)
+		if err != nil {
+			apierr.Field(w, "encoded", err.Error())
+			return
+		}
+		shared = decoded
+	}
+	if req.Name != "" {
+		shared.Name = req.Name
+	}
+	if shared.Format != sharedPresetFormat {
+		apierr.Field(w, "diffbox_preset", "unsupported preset format")
+		return
+	}
+	if !s.validatePreset(w, shared) {
+		return
+	}
+
+	resp := PresetImportResponse{
+		Preset:   Preset{Name: shared.Name, Workflow: shared.Workflow, Params: shared.Params, Variables: shared.Variables},
+		Warnings: s.presetModelWarnings(shared.Params),
+	}
+	if !req.DryRun {
+		preset, ok := s.savePreset(w, r, *shared)
+		if !ok {
+			return
+		}
+		resp.Preset, resp.Saved = preset, true
+		log.Printf("Presets: imported %q for %s with %d warnings", preset.Name, preset.Workflow, len(resp.Warnings))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// decodeSharedPreset accepts the encoded blob on its own or the whole
+// share URL
+func decodeSharedPreset(encoded string) (*SharedPreset, error) {
+	if i := strings.LastIndex(encoded, "preset="); i >= 0 {
+		encoded = encoded[i+len("preset="):]
+	}
+	encoded = strings.TrimRight(strings.TrimSpace(encoded), "=")
+	if len(encoded) > base64.RawURLEncoding.EncodedLen(maxSharedPresetSize) {
+		return nil, errors.New("preset too large")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("not a valid preset link")
+	}
+	var shared SharedPreset
+	if err := json.Unmarshal(data, &shared); err != nil {
+		return nil, errors.New("not a valid preset link")
+	}
+	return &shared, nil
+}
+
+// validatePreset checks a preset's shape and strips job-only params. It
+// writes a 400 and returns false if the preset is unusable.
+func (s *Server) validatePreset(w http.ResponseWriter, p *SharedPreset) bool {
+	p.Name = strings.TrimSpace(p.Name)
+	fieldErrors := make(map[string]string)
+	switch {
+	case p.Name == "":
+		fieldErrors["name"] = "is required"
+	case len(p.Name) > maxPresetNameLength:
+		fieldErrors["name"] = "too long (max 200 characters)"
+	}
+	if !s.knownWorkflow(p.Workflow) {
+		fieldErrors["workflow"] = "unknown workflow"
+	}
+	if p.Params == nil {
+		p.Params = make(map[string]interface{})
+	}
+	if v, ok := p.Params["loras"]; ok && !isStringList(v) {
+		fieldErrors["params.loras"] = "must be a list of model names"
+	}
+	if v, ok := p.Params["models"]; ok && !isStringMap(v) {
+		fieldErrors["params.models"] = "must map loader inputs to model names"
+	}
+	if data, _ := json.Marshal(p.Params); len(data) > maxSharedPresetSize {
+		fieldErrors["params"] = "too large (max 64KB)"
+	}
+	if msg := checkPresetVariables(p); msg != "" {
+		fieldErrors["variables"] = msg
+	}
+
+	if len(fieldErrors) > 0 {
+		apierr.Write(w, http.StatusBadRequest, &apierr.Error{
+			Code:        apierr.CodeValidationFailed,
+			Message:     "Invalid preset",
+			FieldErrors: fieldErrors,
+		})
+		return false
+	}
+
+	for _, key := range jobOnlyParams {
+		delete(p.Params, key)
+	}
+	return true
+}
+
+// checkPresetVariables returns what's wrong with a preset's variables, or
+// "" if they're usable: names must be valid and unique, and every
+// placeholder in the params must be declared
+func checkPresetVariables(p *SharedPreset) string {
+	if len(p.Variables) > maxPresetVariables {
+		return "too many (max 50)"
+	}
+	declared := make(map[string]bool, len(p.Variables))
+	for _, v := range p.Variables {
+		switch {
+		case !paramtpl.ValidName(v.Name):
+			return fmt.Sprintf("%q is not a valid name (letters, digits and _, not starting with a digit)", v.Name)
+		case declared[v.Name]:
+			return fmt.Sprintf("%s is declared twice", v.Name)
+		}
+		declared[v.Name] = true
+	}
+	var undeclared []string
+	for _, name := range paramtpl.Placeholders(p.Params) {
+		if !declared[name] {
+			undeclared = append(undeclared, name)
+		}
+	}
+	if len(undeclared) > 0 {
+		return "params use undeclared " + strings.Join(undeclared, ", ")
+	}
+	return ""
+}
+
+func isStringList(v interface{}) bool {
+	list, ok := v.([]interface{})
+	if !ok {
+		return v == nil
+	}
+	for _, item := range list {
+		if _, ok := item.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func isStringMap(v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v == nil
+	}
+	for _, item := range m {
+		if _, ok := item.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// presetModelWarnings lists the LoRAs and loader overrides in params that
+// can't be used on this install as-is
+func (s *Server) presetModelWarnings(params map[string]interface{}) []PresetWarning {
+	manifest := make(map[string]bool)
+	for _, m := range models.RequiredModels() {
+		manifest[m.Name] = true
+	}
+
+	warnings := []PresetWarning{}
+	check := func(field, ref string) {
+		name, err := s.aliases.Resolve(ref)
+		if err != nil {
+			warnings = append(warnings, PresetWarning{Field: field, Model: ref, Message: "unknown model alias"})
+			return
+		}
+		if _, err := s.downloader.Storage().Stat(name); err == nil {
+			return
+		}
+		msg := "not available on this server"
+		if manifest[name] {
+			msg = "not downloaded yet; fetched when a job needs it"
+		}
+		warnings = append(warnings, PresetWarning{Field: field, Model: name, Message: msg})
+	}
+
+	if loras, ok := params["loras"].([]interface{}); ok {
+		for _, l := range loras {
+			check("params.loras", l.(string))
+		}
+	}
+	if slots, ok := params["models"].(map[string]interface{}); ok {
+		for slot, ref := range slots {
+			check("params.models."+slot, ref.(string))
+		}
+	}
+	return warnings
+}
+
+func (s *Server) savePreset(w http.ResponseWriter, r *http.Request, shared SharedPreset) (Preset, bool) {
+	params, err := json.Marshal(shared.Params)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to serialize params")
+		return Preset{}, false
+	}
+	p := &db.Preset{
+		ID:       uuid.New().String(),
+		Name:     shared.Name,
+		Workflow: shared.Workflow,
+		Params:   string(params),
+	}
+	if len(shared.Variables) > 0 {
+		variables, err := json.Marshal(shared.Variables)
+		if err != nil {
+			apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to serialize variables")
+			return Preset{}, false
+		}
+		p.Variables = string(variables)
+	}
+	if err := s.db.CreatePreset(r.Context(), p); err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to save preset")
+		return Preset{}, false
+	}
+	return dbPresetToAPIPreset(p), true
+}
+
+func (s *Server) loadPreset(w http.ResponseWriter, r *http.Request) (*db.Preset, bool) {
+	p, err := s.db.GetPreset(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Preset not found")
+			return nil, false
+		}
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get preset")
+		return nil, false
+	}
+	return p, true
+}
+
+func dbPresetToAPIPreset(p *db.Preset) Preset {
+	preset := Preset{ID: p.ID, Name: p.Name, Workflow: p.Workflow}
+	if err := json.Unmarshal([]byte(p.Params), &preset.Params); err != nil || preset.Params == nil {
+		preset.Params = make(map[string]interface{})
+	}
+	if p.Variables != "" {
+		json.Unmarshal([]byte(p.Variables), &preset.Variables)
+	}
+	return preset
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/go-chi/chi/v5"
+	_ "golang.org/x/image/webp"
+)
+
+// previewPollInterval is how often a preview stream looks for a new frame
+const previewPollInterval = 250 * time.Millisecond
+
+// previewJPEGQuality is used for frames workers send in another format
+const previewJPEGQuality = 85
+
+// handlePreviewStream serves a job's preview frames as a multipart MJPEG
+// stream, so an <img> tag can watch a render without the WebSocket
+// protocol. The latest frame is sent straight away and then each new one;
+// the stream ends once the job finishes or the client goes away.
+func (s *Server) handlePreviewStream(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "id")
+	ctx := r.Context()
+
+	job, err := s.db.GetJob(ctx, jobID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			jobError(w, http.StatusNotFound, apierr.CodeNotFound, jobID, "Job not found")
+			return
+		}
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get job")
+		return
+	}
+
+	mw := multipart.NewWriter(w)
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	ticker := time.NewTicker(previewPollInterval)
+	defer ticker.Stop()
+	var last time.Time
+	for {
+		// The status is read before the frame, so a finished job's last
+		// frame is sent before the stream ends
+		finished := !jobActive(job.Status)
+
+		frame, at, err := s.db.GetJobPreviewAfter(ctx, jobID, last)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			if ctx.Err() == nil {
+				log.Printf("Preview: Failed to read frame of job %s: %v", jobID, err)
+			}
+			return
+		}
+		if frame != nil {
+			last = at
+			if err := writePreviewFrame(mw, frame); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+
+		if finished {
+			mw.Close()
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if job, err = s.db.GetJob(ctx, jobID); err != nil {
+			return
+		}
+	}
+}
+
+// writePreviewFrame sends a frame as one JPEG part. Frames in other
+// formats are re-encoded; ones that don't decode are skipped.
+func writePreviewFrame(mw *multipart.Writer, frame []byte) error {
+	if http.DetectContentType(frame) != "image/jpeg" {
+		img, _, err := image.Decode(bytes.NewReader(frame))
+		if err != nil {
+			log.Printf("Preview: Skipping undecodable frame: %v", err)
+			return nil
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: previewJPEGQuality}); err != nil {
+			return err
+		}
+		frame = buf.Bytes()
+	}
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":   {"image/jpeg"},
+		"Content-Length": {strconv.Itoa(len(frame))},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(frame)
+	return err
+}
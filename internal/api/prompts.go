@@ -0,0 +1,260 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Limits on saved prompts
+const (
+	maxPromptNameLength = 200
+	maxPromptTextLength = 2000
+	maxPromptTags       = 20
+	maxPromptTagLength  = 50
+	defaultPromptLimit  = 100
+)
+
+type Prompt struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	Text           string   `json:"text"`
+	NegativePrompt string   `json:"negative_prompt,omitempty"`
+	Tags           []string `json:"tags"`
+	UseCount       int      `json:"use_count"`
+	LastUsedAt     string   `json:"last_used_at,omitempty"`
+	CreatedAt      string   `json:"created_at"`
+	UpdatedAt      string   `json:"updated_at"`
+}
+
+// PromptRequest creates or replaces a saved prompt
+type PromptRequest struct {
+	Name           string   `json:"name"`
+	Text           string   `json:"text"`
+	NegativePrompt string   `json:"negative_prompt"`
+	Tags           []string `json:"tags"`
+}
+
+type PromptTag struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// handleListPrompts searches saved prompts. q matches the name or text and
+// tag (repeatable or comma-separated) requires every listed tag.
+func (s *Server) handleListPrompts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := db.PromptFilter{
+		Query: strings.TrimSpace(query.Get("q")),
+		Limit: defaultPromptLimit,
+	}
+	for _, v := range query["tag"] {
+		filter.Tags = append(filter.Tags, normalizeTags(strings.Split(v, ","))...)
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			apierr.Field(w, "limit", "must be a positive integer")
+			return
+		}
+		filter.Limit = n
+	}
+
+	dbPrompts, err := s.db.ListPrompts(r.Context(), filter)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list prompts")
+		return
+	}
+
+	prompts := make([]Prompt, len(dbPrompts))
+	for i, p := range dbPrompts {
+		prompts[i] = dbPromptToAPIPrompt(p)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prompts)
+}
+
+func (s *Server) handleListPromptTags(w http.ResponseWriter, r *http.Request) {
+	dbTags, err := s.db.ListPromptTags(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list tags")
+		return
+	}
+
+	tags := make([]PromptTag, len(dbTags))
+	for i, t := range dbTags {
+		tags[i] = PromptTag{Tag: t.Tag, Count: t.Count}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+func (s *Server) handleGetPrompt(w http.ResponseWriter, r *http.Request) {
+	p, err := s.db.GetPrompt(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Prompt not found")
+			return
+		}
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get prompt")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dbPromptToAPIPrompt(p))
+}
+
+func (s *Server) handleCreatePrompt(w http.ResponseWriter, r *http.Request) {
+	p, ok := decodePromptRequest(w, r)
+	if !ok {
+		return
+	}
+	p.ID = uuid.New().String()
+
+	if err := s.db.CreatePrompt(r.Context(), p); err != nil {
+		log.Printf("Prompts: Failed to create prompt %q: %v", p.Name, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to create prompt")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(dbPromptToAPIPrompt(p))
+}
+
+func (s *Server) handleUpdatePrompt(w http.ResponseWriter, r *http.Request) {
+	p, ok := decodePromptRequest(w, r)
+	if !ok {
+		return
+	}
+	p.ID = chi.URLParam(r, "id")
+
+	if err := s.db.UpdatePrompt(r.Context(), p); err != nil {
+		if err == sql.ErrNoRows {
+			apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Prompt not found")
+			return
+		}
+		log.Printf("Prompts: Failed to update prompt %s: %v", p.ID, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to update prompt")
+		return
+	}
+
+	// Return the stored prompt so usage counts are included
+	s.handleGetPrompt(w, r)
+}
+
+func (s *Server) handleDeletePrompt(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.DeletePrompt(r.Context(), chi.URLParam(r, "id")); err != nil {
+		if err == sql.ErrNoRows {
+			apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Prompt not found")
+			return
+		}
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to delete prompt")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodePromptRequest reads and validates a prompt body, writing a 400 and
+// returning false if it is invalid
+func decodePromptRequest(w http.ResponseWriter, r *http.Request) (*db.Prompt, bool) {
+	var req PromptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return nil, false
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	tags := normalizeTags(req.Tags)
+	switch {
+	case req.Name == "":
+		apierr.Field(w, "name", "is required")
+	case strings.TrimSpace(req.Text) == "":
+		apierr.Field(w, "text", "is required")
+	case len(req.Name) > maxPromptNameLength:
+		apierr.Field(w, "name", "too long (max 200 characters)")
+	case len(req.Text) > maxPromptTextLength || len(req.NegativePrompt) > maxPromptTextLength:
+		apierr.Field(w, "text", "too long (max 2000 characters)")
+	case len(tags) > maxPromptTags:
+		apierr.Field(w, "tags", "too many tags (max 20)")
+	default:
+		for _, tag := range tags {
+			if len(tag) > maxPromptTagLength {
+				apierr.Field(w, "tags", "tag too long (max 50 characters)")
+				return nil, false
+			}
+		}
+		return &db.Prompt{
+			Name:           req.Name,
+			Text:           req.Text,
+			NegativePrompt: req.NegativePrompt,
+			Tags:           tags,
+		}, true
+	}
+	return nil, false
+}
+
+// normalizeTags lowercases and trims tags, dropping blanks and duplicates
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	out := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// usePrompt counts a submission against the saved prompt it was built
+// from. It writes a 400 and returns false if the prompt doesn't exist.
+func (s *Server) usePrompt(w http.ResponseWriter, r *http.Request, id string) bool {
+	if id == "" {
+		return true
+	}
+	if err := s.db.RecordPromptUse(r.Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			apierr.Field(w, "prompt_id", "unknown prompt")
+			return false
+		}
+		// Usage counts are a convenience; don't fail the submission
+		log.Printf("Prompts: Failed to record use of prompt %s: %v", id, err)
+	}
+	return true
+}
+
+func dbPromptToAPIPrompt(p *db.Prompt) Prompt {
+	prompt := Prompt{
+		ID:             p.ID,
+		Name:           p.Name,
+		Text:           p.Text,
+		NegativePrompt: p.NegativePrompt,
+		Tags:           p.Tags,
+		UseCount:       p.UseCount,
+		CreatedAt:      p.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:      p.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if prompt.Tags == nil {
+		prompt.Tags = []string{}
+	}
+	if p.LastUsedAt != nil {
+		prompt.LastUsedAt = p.LastUsedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return prompt
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/eta"
+)
+
+// QueuedJob is a job waiting for a worker along with when it is expected
+// to start. The estimate is omitted when a job ahead of it has no
+// duration history; a job that can start right away starts in 0 seconds.
+type QueuedJob struct {
+	ID              string `json:"id"`
+	Type            string `json:"type"`
+	Label           string `json:"label,omitempty"`
+	Position        int    `json:"position"` // 1-based, next to run first
+	EstimatedStart  string `json:"estimated_start,omitempty"`
+	StartsInSeconds *int64 `json:"starts_in_seconds,omitempty"`
+	// ExpectedSeconds is the typical run time of similar jobs
+	ExpectedSeconds int64 `json:"expected_seconds,omitempty"`
+}
+
+type QueueResponse struct {
+	Workers int         `json:"workers"`
+	Running []string    `json:"running"` // jobs already handed to a worker
+	Jobs    []QueuedJob `json:"jobs"`
+}
+
+func (s *Server) handleGetQueue(w http.ResponseWriter, r *http.Request) {
+	queue, err := s.estimateQueue(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to estimate queue")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(queue)
+}
+
+// estimateQueue works out when each queued job should start from the time
+// left on dispatched jobs and the historical run time of each job ahead
+func (s *Server) estimateQueue(ctx context.Context) (*QueueResponse, error) {
+	dispatched, err := s.db.ListDispatchedJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	queued, err := s.db.ListQueuedJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Similar jobs share a history lookup
+	expected := make(map[string]time.Duration)
+	expectedFor := func(job *db.Job) (time.Duration, error) {
+		key := job.Type + "/" + eta.ResolutionKey(job.Params)
+		if d, ok := expected[key]; ok {
+			return d, nil
+		}
+		d, ok, err := s.db.ExpectedJobDuration(ctx, job.Type, eta.ResolutionKey(job.Params))
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			d = eta.Unknown
+		}
+		expected[key] = d
+		return d, nil
+	}
+
+	resp := &QueueResponse{
+		Workers: s.cfg.WorkerCount,
+		Running: make([]string, 0, len(dispatched)),
+		Jobs:    make([]QueuedJob, 0, len(queued)),
+	}
+
+	busy := make([]time.Duration, len(dispatched))
+	for i, job := range dispatched {
+		resp.Running = append(resp.Running, job.ID)
+		if !job.ETA.IsZero() {
+			busy[i] = time.Until(job.ETA)
+			continue
+		}
+		d, err := expectedFor(job)
+		if err != nil {
+			return nil, err
+		}
+		if d != eta.Unknown && !job.StartedAt.IsZero() {
+			d -= time.Since(job.StartedAt)
+		}
+		busy[i] = d
+	}
+
+	durations := make([]time.Duration, len(queued))
+	for i, job := range queued {
+		if durations[i], err = expectedFor(job); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	starts := eta.QueueStarts(busy, s.cfg.WorkerCount, durations)
+	for i, job := range queued {
+		entry := QueuedJob{ID: job.ID, Type: job.Type, Label: job.Label, Position: i + 1}
+		if durations[i] != eta.Unknown {
+			entry.ExpectedSeconds = int64(durations[i].Seconds())
+		}
+		if starts[i] != eta.Unknown {
+			entry.EstimatedStart = now.Add(starts[i]).Format("2006-01-02T15:04:05Z07:00")
+			startsIn := int64(starts[i].Seconds())
+			entry.StartsInSeconds = &startsIn
+		}
+		resp.Jobs = append(resp.Jobs, entry)
+	}
+	return resp, nil
+}
+
+// addQueueEstimates fills in the queue position and estimated start of
+// any queued jobs in the list. Estimates are best effort; a failure
+// leaves the jobs without them.
+func (s *Server) addQueueEstimates(ctx context.Context, jobs []Job) {
+	waiting := false
+	for _, job := range jobs {
+		if job.Status == "pending" || job.Status == "waiting_models" {
+			waiting = true
+			break
+		}
+	}
+	if !waiting {
+		return
+	}
+
+	queue, err := s.estimateQueue(ctx)
+	if err != nil {
+		log.Printf("Failed to estimate queue: %v", err)
+		return
+	}
+	byID := make(map[string]QueuedJob, len(queue.Jobs))
+	for _, entry := range queue.Jobs {
+		byID[entry.ID] = entry
+	}
+	for i := range jobs {
+		if entry, ok := byID[jobs[i].ID]; ok {
+			jobs[i].QueuePosition = entry.Position
+			jobs[i].EstimatedStart = entry.EstimatedStart
+			jobs[i].StartsInSeconds = entry.StartsInSeconds
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// readyTimeout bounds the dependency checks behind /readyz
+const readyTimeout = 3 * time.Second
+
+type ReadyResponse struct {
+	Ready bool `json:"ready"`
+	// Checks maps each dependency to "ok" or what is wrong with it
+	Checks map[string]string `json:"checks"`
+}
+
+// handleReady reports whether the server can take jobs: the database and
+// queue answer, the workers have started and shutdown hasn't begun. It is
+// open to everyone so container probes don't need a token.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	resp := ReadyResponse{Ready: true, Checks: map[string]string{}}
+	check := func(name string, err error) {
+		if err != nil {
+			resp.Ready = false
+			resp.Checks[name] = err.Error()
+			return
+		}
+		resp.Checks[name] = "ok"
+	}
+
+	check("database", s.db.Ping(ctx))
+	check("queue", s.queue.Ping(ctx))
+
+	select {
+	case <-s.workers.Ready():
+		resp.Checks["workers"] = "ok"
+	default:
+		resp.Ready = false
+		if err := s.workers.StartError(); err != nil {
+			resp.Checks["workers"] = "failed: " + err.Error()
+		} else {
+			resp.Checks["workers"] = "starting: " + s.workers.EnvStatus().Message
+		}
+	}
+
+	s.maintenance.mu.RLock()
+	shuttingDown := s.maintenance.shuttingDown
+	s.maintenance.mu.RUnlock()
+	if shuttingDown {
+		resp.Ready = false
+		resp.Checks["shutdown"] = "shutting down"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !resp.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/models"
+	"github.com/druarnfield/diffbox/internal/version"
+	"github.com/go-chi/chi/v5"
+)
+
+// ReproModel is a model file a job depended on
+type ReproModel struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`             // "workflow", "lora" or the loader slot it filled
+	SHA256 string `json:"sha256,omitempty"` // empty if the file hasn't been hashed yet
+	Source string `json:"source,omitempty"` // download URL, which pins the upstream revision
+}
+
+type ReproVersions struct {
+	Diffbox string            `json:"diffbox"`
+	Commit  string            `json:"commit,omitempty"`
+	Worker  map[string]string `json:"worker,omitempty"` // Python and package versions
+}
+
+// ReproReport is everything needed to reproduce a job's result. It is
+// recorded when the job completes; for other jobs it describes the
+// current environment and RecordedAt is empty.
+type ReproReport struct {
+	JobID      string                 `json:"job_id"`
+	Type       string                 `json:"type"`
+	Status     string                 `json:"status"`
+	Params     map[string]interface{} `json:"params"` // seed filled in when known
+	Seed       *int64                 `json:"seed,omitempty"`
+	Models     []ReproModel           `json:"models"`
+	Versions   ReproVersions          `json:"versions"`
+	RecordedAt string                 `json:"recorded_at,omitempty"`
+}
+
+// RecordRepro snapshots what a just-completed job ran with. seed is the
+// seed the worker actually used, nil if it didn't say.
+func (s *Server) RecordRepro(ctx context.Context, jobID string, seed *int64) {
+	job, err := s.db.GetJob(ctx, jobID)
+	if err != nil {
+		log.Printf("Repro: failed to load job %s: %v", jobID, err)
+		return
+	}
+	report := s.buildRepro(job, seed)
+	report.RecordedAt = time.Now().Format("2006-01-02T15:04:05Z07:00")
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		log.Printf("Repro: failed to serialize report for job %s: %v", jobID, err)
+		return
+	}
+	if err := s.db.SetJobRepro(ctx, jobID, string(data)); err != nil {
+		log.Printf("Repro: failed to store report for job %s: %v", jobID, err)
+	}
+}
+
+// buildRepro describes a job against the current models and versions
+func (s *Server) buildRepro(job *db.Job, seed *int64) ReproReport {
+	params := dbJobToAPIJob(job).Params
+	if seed == nil {
+		seed = fixedSeed(params)
+	}
+	if seed != nil {
+		params["seed"] = *seed
+	}
+
+	return ReproReport{
+		JobID:  job.ID,
+		Type:   job.Type,
+		Status: job.Status,
+		Params: params,
+		Seed:   seed,
+		Models: s.reproModels(job.Type, params),
+		Versions: ReproVersions{
+			Diffbox: version.Version,
+			Commit:  version.Commit(),
+			Worker:  s.workers.Versions(),
+		},
+	}
+}
+
+// fixedSeed returns the seed a job asked for, or nil if it asked for a
+// random one
+func fixedSeed(params map[string]interface{}) *int64 {
+	v, ok := params["seed"].(float64)
+	if !ok || v < 0 {
+		return nil
+	}
+	seed := int64(v)
+	return &seed
+}
+
+// reproModels lists the workflow's models followed by the LoRAs and
+// loader overrides in the job params
+func (s *Server) reproModels(jobType string, params map[string]interface{}) []ReproModel {
+	sources := make(map[string]string)
+	for _, m := range models.RequiredModels() {
+		sources[m.Name] = m.URL
+	}
+
+	var list []ReproModel
+	add := func(name, role string) {
+		m := ReproModel{Name: name, Role: role, Source: sources[name]}
+		if s.downloader != nil {
+			m.SHA256 = s.downloader.Verifier().CachedHash(name)
+		}
+		list = append(list, m)
+	}
+
+	for _, m := range models.ModelsForWorkflow(models.WorkflowForJobType(jobType)) {
+		add(m.Name, "workflow")
+	}
+	if loras, ok := params["loras"].([]interface{}); ok {
+		for _, l := range loras {
+			if name, ok := l.(string); ok {
+				add(name, "lora")
+			}
+		}
+	}
+	if slots, ok := params["models"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(slots))
+		for slot := range slots {
+			names = append(names, slot)
+		}
+		sort.Strings(names)
+		for _, slot := range names {
+			if name, ok := slots[slot].(string); ok {
+				add(name, slot)
+			}
+		}
+	}
+	return list
+}
+
+// jobRepro returns the recorded report for a job, or builds one now if
+// none was recorded. It writes the error response and returns false if
+// the job can't be loaded.
+func (s *Server) jobRepro(w http.ResponseWriter, r *http.Request) (ReproReport, bool) {
+	jobID := chi.URLParam(r, "id")
+
+	job, err := s.db.GetJob(r.Context(), jobID)
+	if err == sql.ErrNoRows {
+		jobError(w, http.StatusNotFound, apierr.CodeNotFound, jobID, "Job not found")
+		return ReproReport{}, false
+	}
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get job")
+		return ReproReport{}, false
+	}
+
+	report, err := s.recordedRepro(r.Context(), job)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get repro report")
+		return ReproReport{}, false
+	}
+	if report == nil {
+		return s.buildRepro(job, nil), true
+	}
+	return *report, true
+}
+
+// recordedRepro returns the report recorded when job completed, or nil if
+// there isn't a usable one
+func (s *Server) recordedRepro(ctx context.Context, job *db.Job) (*ReproReport, error) {
+	recorded, err := s.db.GetJobRepro(ctx, job.ID)
+	if err != nil || recorded == "" {
+		return nil, err
+	}
+	var report ReproReport
+	if err := json.Unmarshal([]byte(recorded), &report); err != nil {
+		log.Printf("Repro: ignoring unreadable report for job %s: %v", job.ID, err)
+		return nil, nil
+	}
+	report.Status = job.Status
+	return &report, nil
+}
+
+func (s *Server) handleGetRepro(w http.ResponseWriter, r *http.Request) {
+	report, ok := s.jobRepro(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleResubmitRepro queues a new job with exactly the params, seed
+// included, of a previous one. It refuses if a model file has changed
+// since the job ran, unless ?force=true.
+func (s *Server) handleResubmitRepro(w http.ResponseWriter, r *http.Request) {
+	report, ok := s.jobRepro(w, r)
+	if !ok {
+		return
+	}
+
+	if r.URL.Query().Get("force") != "true" {
+		changed := make(map[string]string)
+		for _, m := range report.Models {
+			if m.SHA256 == "" || s.downloader == nil {
+				continue
+			}
+			if now := s.downloader.Verifier().CachedHash(m.Name); now != "" && now != m.SHA256 {
+				changed["models."+m.Name] = fmt.Sprintf("sha256 is now %s, job used %s", now, m.SHA256)
+			}
+		}
+		if len(changed) > 0 {
+			apierr.Write(w, http.StatusConflict, &apierr.Error{
+				Code:        apierr.CodeConflict,
+				Message:     "Model files changed since the job ran; pass force=true to resubmit anyway",
+				FieldErrors: changed,
+				JobID:       report.JobID,
+			})
+			return
+		}
+	}
+
+	log.Printf("Repro: resubmitting job %s", report.JobID)
+	s.submitJob(w, r, report.Type, "Repro", report.Params)
+}
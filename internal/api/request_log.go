@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/db"
+)
+
+// Request log page sizes
+const (
+	defaultRequestLogLimit = 100
+	maxRequestLogLimit     = 1000
+)
+
+type LoggedRequest struct {
+	ID         int64  `json:"id"`
+	At         string `json:"at"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Status     int    `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Bytes      int64  `json:"bytes"`
+	UserID     string `json:"user_id,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+type RequestLogResponse struct {
+	// Enabled is false when DIFFBOX_REQUEST_LOG_DAYS is unset and nothing
+	// is being logged
+	Enabled       bool            `json:"enabled"`
+	RetentionDays int             `json:"retention_days"`
+	Requests      []LoggedRequest `json:"requests"`
+}
+
+// handleListRequests returns logged API requests, newest first, filtered
+// by ?method=, ?path= (prefix), ?user=, ?status= (a code or a class such
+// as 5xx), ?min_duration_ms=, ?since= (RFC 3339) and ?limit=
+func (s *Server) handleListRequests(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := db.RequestLogFilter{
+		Method:     strings.ToUpper(query.Get("method")),
+		PathPrefix: query.Get("path"),
+		UserID:     query.Get("user"),
+		Limit:      defaultRequestLogLimit,
+	}
+
+	if v := query.Get("status"); v != "" {
+		if class, ok := strings.CutSuffix(strings.ToLower(v), "xx"); ok {
+			n, err := strconv.Atoi(class)
+			if err != nil || n < 1 || n > 5 {
+				apierr.Field(w, "status", "must be a status code or a class such as 5xx")
+				return
+			}
+			filter.MinStatus, filter.MaxStatus = n*100, n*100+99
+		} else {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 100 || n > 599 {
+				apierr.Field(w, "status", "must be a status code or a class such as 5xx")
+				return
+			}
+			filter.MinStatus, filter.MaxStatus = n, n
+		}
+	}
+	if v := query.Get("min_duration_ms"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			apierr.Field(w, "min_duration_ms", "must be a non-negative integer")
+			return
+		}
+		filter.MinDurationMs = n
+	}
+	if v := query.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			apierr.Field(w, "since", "must be an RFC 3339 time")
+			return
+		}
+		filter.Since = since
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRequestLogLimit {
+			apierr.Field(w, "limit", "must be between 1 and "+strconv.Itoa(maxRequestLogLimit))
+			return
+		}
+		filter.Limit = n
+	}
+
+	entries, err := s.db.ListRequests(r.Context(), filter)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list requests")
+		return
+	}
+
+	resp := RequestLogResponse{
+		Enabled:       s.requestLog != nil,
+		RetentionDays: s.cfg.RequestLogDays,
+		Requests:      make([]LoggedRequest, len(entries)),
+	}
+	for i, e := range entries {
+		resp.Requests[i] = LoggedRequest{
+			ID:         e.ID,
+			At:         e.At.Format("2006-01-02T15:04:05Z07:00"),
+			Method:     e.Method,
+			Path:       e.Path,
+			Status:     e.Status,
+			DurationMs: e.DurationMs,
+			Bytes:      e.Bytes,
+			UserID:     e.UserID,
+			RemoteAddr: e.RemoteAddr,
+			RequestID:  e.RequestID,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/camera"
+	"github.com/druarnfield/diffbox/internal/resolution"
+	"github.com/go-chi/chi/v5"
+)
+
+// ResolutionCatalog lists the output sizes a workflow accepts
+type ResolutionCatalog struct {
+	Workflow string              `json:"workflow"`
+	Default  resolution.Preset   `json:"default"`
+	Presets  []resolution.Preset `json:"presets"`
+}
+
+func (s *Server) handleListResolutions(w http.ResponseWriter, r *http.Request) {
+	jobType := chi.URLParam(r, "type")
+	catalog, ok := resolution.For(jobType)
+	if !ok {
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Workflow has no resolution presets")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ResolutionCatalog{
+		Workflow: jobType,
+		Default:  catalog.Default,
+		Presets:  catalog.Presets,
+	})
+}
+
+// CameraMotions lists the camera presets a workflow accepts as
+// camera_direction, with the speed limits for camera_speed
+type CameraMotions struct {
+	Workflow     string          `json:"workflow"`
+	DefaultSpeed float64         `json:"default_speed"`
+	MaxSpeed     float64         `json:"max_speed"`
+	MaxKeyframes int             `json:"max_keyframes"`
+	Motions      []camera.Motion `json:"motions"`
+}
+
+func (s *Server) handleListCameraMotions(w http.ResponseWriter, r *http.Request) {
+	jobType := chi.URLParam(r, "type")
+	if !camera.Supported(jobType) {
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Workflow has no camera control")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CameraMotions{
+		Workflow:     jobType,
+		DefaultSpeed: camera.DefaultSpeed,
+		MaxSpeed:     camera.MaxSpeed,
+		MaxKeyframes: camera.MaxKeyframes,
+		Motions:      camera.Motions(),
+	})
+}
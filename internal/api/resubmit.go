@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/paramdiff"
+	"github.com/go-chi/chi/v5"
+)
+
+// handleResubmitJob queues a new job from a previous one's params with a
+// partial params object merged over them, e.g. {"seed": 7} or
+// {"models": {"ckpt_name": "other"}}. A null resets a param to the
+// workflow default. The merged params go through the workflow's own
+// submit handler, so they are validated exactly as a fresh submission.
+// Unlike POST /jobs/{id}/repro, a random seed stays random unless set.
+func (s *Server) handleResubmitJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "id")
+
+	job, err := s.db.GetJob(r.Context(), jobID)
+	if err == sql.ErrNoRows {
+		jobError(w, http.StatusNotFound, apierr.CodeNotFound, jobID, "Job not found")
+		return
+	}
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get job")
+		return
+	}
+
+	var overrides map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&overrides); err != nil && err != io.EOF {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	submit := s.submitHandler(job.Type)
+	if submit == nil {
+		jobError(w, http.StatusConflict, apierr.CodeConflict, jobID, "Workflow "+job.Type+" is no longer available")
+		return
+	}
+
+	body, err := json.Marshal(paramdiff.Merge(dbJobToAPIJob(job).Params, overrides))
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to serialize params")
+		return
+	}
+
+	log.Printf("Resubmit: resubmitting job %s with %d overrides", jobID, len(overrides))
+	resubmit := r.Clone(r.Context())
+	resubmit.Body = io.NopCloser(bytes.NewReader(body))
+	resubmit.ContentLength = int64(len(body))
+	// Variations stay in the original's session unless the caller names one
+	if resubmit.Header.Get(SessionHeader) == "" && job.SessionID != "" {
+		resubmit.Header.Set(SessionHeader, job.SessionID)
+	}
+	submit(w, resubmit)
+}
+
+// submitHandler returns the handler that validates and queues jobs of a
+// type, or nil if the type isn't known (say, a custom workflow whose
+// definition has since been removed)
+func (s *Server) submitHandler(jobType string) http.HandlerFunc {
+	switch jobType {
+	case "i2v":
+		return s.handleI2VSubmit
+	case "svi":
+		return s.handleSVISubmit
+	case "qwen":
+		return s.handleQwenSubmit
+	case "chat":
+		return s.handleChatSubmit
+	case ConcatJobType:
+		return s.handleConcatOutputs
+	}
+	if def := s.workflows.Get(jobType); def != nil {
+		return func(w http.ResponseWriter, r *http.Request) { s.submitCustom(w, r, def) }
+	}
+	return nil
+}
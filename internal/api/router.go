@@ -1,16 +1,32 @@
 package api
 
 import (
+	"context"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/druarnfield/diffbox/internal/admission"
+	"github.com/druarnfield/diffbox/internal/alerts"
+	"github.com/druarnfield/diffbox/internal/apierr"
 	"github.com/druarnfield/diffbox/internal/aria2"
+	"github.com/druarnfield/diffbox/internal/auth"
 	"github.com/druarnfield/diffbox/internal/config"
 	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/gpu"
+	"github.com/druarnfield/diffbox/internal/inputs"
+	"github.com/druarnfield/diffbox/internal/models"
 	"github.com/druarnfield/diffbox/internal/queue"
+	"github.com/druarnfield/diffbox/internal/setup"
+	"github.com/druarnfield/diffbox/internal/tokens"
+	"github.com/druarnfield/diffbox/internal/tracing"
+	"github.com/druarnfield/diffbox/internal/upload"
+	"github.com/druarnfield/diffbox/internal/worker"
+	"github.com/druarnfield/diffbox/internal/workflow"
 )
 
 type Server struct {
@@ -18,11 +34,44 @@ type Server struct {
 	db          *db.DB
 	queue       queue.Queue
 	hub         *WebSocketHub
-	aria2Client *aria2.Client
+	aria2Client aria2.RPC
+	tokens      *tokens.Validator
+	files       fileRoots
+	gpu         *gpu.Monitor
+	alerts      *alerts.Monitor
+	setup       *setup.Manager
+	downloader  *models.Downloader
+	workers     *worker.Manager
+	aliases     *models.Aliases
+	maintenance maintenanceState
+	admission   *admission.Controller
+	workflows   *workflow.Registry
+	inputs      *inputs.Library
+	uploads     *upload.ChunkStore
+	// requestLog is nil unless requests are logged to the database
+	requestLog *requestLog
+	// pipelineMu serializes submitting pipeline steps with recording the
+	// jobs that finish them
+	pipelineMu sync.Mutex
+	// ctx is cancelled by Close, stopping work the server runs itself
+	// such as concat jobs
+	ctx    context.Context
+	cancel context.CancelFunc
+	// concatSlots bounds the ffmpeg joins running at once
+	concatSlots chan struct{}
+	background  sync.WaitGroup
 }
 
-// NewRouter creates a new HTTP router and returns it along with the WebSocket hub
-func NewRouter(cfg *config.Config, database *db.DB, q queue.Queue, aria2Client *aria2.Client) (http.Handler, *WebSocketHub) {
+// Close stops the work the server runs itself, such as concat jobs, and
+// waits for it to finish
+func (s *Server) Close() {
+	s.cancel()
+	s.background.Wait()
+}
+
+// NewRouter creates a new HTTP router and returns it along with the WebSocket
+// hub and the server, which controls intake during shutdown
+func NewRouter(cfg *config.Config, database *db.DB, q queue.Queue, aria2Client aria2.RPC, gpuMonitor *gpu.Monitor, alertMonitor *alerts.Monitor, setupManager *setup.Manager, downloader *models.Downloader, workers *worker.Manager, workflows *workflow.Registry) (http.Handler, *WebSocketHub, *Server) {
 	hub := NewWebSocketHub()
 	s := &Server{
 		cfg:         cfg,
@@ -30,98 +79,281 @@ func NewRouter(cfg *config.Config, database *db.DB, q queue.Queue, aria2Client *
 		queue:       q,
 		hub:         hub,
 		aria2Client: aria2Client,
+		tokens:      tokens.NewValidator(),
+		files:       newFileRoots(cfg.OutputsDir, cfg.StaticDir, cfg.ThumbnailsDir),
+		gpu:         gpuMonitor,
+		alerts:      alertMonitor,
+		setup:       setupManager,
+		downloader:  downloader,
+		workers:     workers,
+		aliases:     models.NewAliases(cfg.ModelAliases),
+		workflows:   workflows,
+		inputs:      inputs.New(cfg.InputsDir),
+		uploads:     upload.NewChunkStore(cfg.UploadsDir, int64(cfg.MaxUploadMB)<<20),
+		concatSlots: make(chan struct{}, maxConcurrentConcats),
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	s.tokens.SetHFEndpoint(cfg.HFEndpoint)
+	s.admission = s.newAdmission()
+	s.uploads.SetInUse(func() (map[string]bool, error) {
+		return database.ListUploadsInUse(context.Background())
+	})
 
 	// Start WebSocket hub
 	go hub.Run()
 
 	r := chi.NewRouter()
+	// Unmatched routes get the same error envelope as the handlers
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Not found")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		apierr.Respond(w, http.StatusMethodNotAllowed, apierr.CodeMethodNotAllowed, "Method not allowed")
+	})
 
-	// Middleware
-	r.Use(middleware.Logger)
+	// Middleware. Logging, compression, the request log and rate limiting
+	// are optional; auth always runs but lets everyone in as the local
+	// admin when disabled.
+	r.Use(tracing.Middleware)
+	if cfg.RequestLogging {
+		r.Use(requestLogger)
+	}
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
+	if cfg.RequestTimeout > 0 {
+		r.Use(requestTimeout(cfg.RequestTimeout))
+	}
 	r.Use(middleware.RequestID)
+	if cfg.RequestLogDays > 0 {
+		s.requestLog = newRequestLog(database, cfg.RequestLogDays)
+		r.Use(s.requestLog.middleware)
+	}
 	r.Use(corsMiddleware)
+	if cfg.Compression {
+		r.Use(middleware.Compress(5))
+	}
+
+	r.Use(auth.Middleware(cfg.AuthEnabled, s.lookupUser))
+	if s.requestLog != nil {
+		r.Use(noteRequestUser)
+	}
+	if cfg.RateLimit > 0 {
+		r.Use(newRateLimiter(cfg.RateLimit, cfg.AuthEnabled).middleware)
+	}
+
+	viewer := auth.Require(auth.RoleViewer)
+	creator := auth.Require(auth.RoleCreator)
+	admin := auth.Require(auth.RoleAdmin)
 
 	// API routes
 	r.Route("/api", func(r chi.Router) {
 		// Workflows
 		r.Route("/workflows", func(r chi.Router) {
-			r.Post("/i2v", s.handleI2VSubmit)
-			r.Post("/svi", s.handleSVISubmit)
-			r.Post("/qwen", s.handleQwenSubmit)
-			r.Post("/chat", s.handleChatSubmit)
+			r.With(viewer).Get("/custom", s.handleListCustomWorkflows)
+			r.With(viewer).Get("/{type}/resolutions", s.handleListResolutions)
+			r.With(viewer).Get("/{type}/camera-motions", s.handleListCameraMotions)
+
+			r.Group(func(r chi.Router) {
+				r.Use(creator)
+				r.Use(s.rejectDuringMaintenance)
+				r.Use(s.expandTemplates)
+				r.Post("/i2v", s.handleI2VSubmit)
+				r.Post("/svi", s.handleSVISubmit)
+				r.Post("/qwen", s.handleQwenSubmit)
+				r.Post("/chat", s.handleChatSubmit)
+				r.Post("/custom/{type}", s.handleCustomSubmit)
+			})
 		})
 
 		// Jobs
 		r.Route("/jobs", func(r chi.Router) {
-			r.Get("/", s.handleListJobs)
-			r.Get("/{id}", s.handleGetJob)
-			r.Delete("/{id}", s.handleCancelJob)
+			r.With(viewer).Get("/", s.handleListJobs)
+			r.With(viewer).Get("/compare", s.handleCompareJobs)
+			r.With(viewer).Get("/{id}", s.handleGetJob)
+			r.With(viewer).Get("/{id}/events", s.handleGetJobEvents)
+			r.With(viewer).Get("/{id}/preview.mjpeg", s.handlePreviewStream)
+			r.With(viewer).Get("/{id}/repro", s.handleGetRepro)
+			r.With(creator, s.rejectDuringMaintenance).Post("/{id}/repro", s.handleResubmitRepro)
+			r.With(creator, s.rejectDuringMaintenance).Post("/{id}/resubmit", s.handleResubmitJob)
+			r.With(creator).Patch("/{id}", s.handleUpdateJob)
+			r.With(creator).Post("/{id}/move", s.handleMoveJob)
+			r.With(creator).Post("/{id}/archive", s.handleArchiveJob)
+			r.With(creator).Post("/{id}/unarchive", s.handleUnarchiveJob)
+			r.With(admin).Post("/purge", s.handlePurgeJobs)
+			r.With(creator).Delete("/{id}", s.handleCancelJob)
+		})
+
+		// Sessions group the jobs of one UI session or experiment
+		r.Route("/sessions", func(r chi.Router) {
+			r.With(viewer).Get("/", s.handleListSessions)
+			r.With(viewer).Get("/{id}", s.handleGetSession)
+			r.With(creator).Post("/", s.handleCreateSession)
+			r.With(creator).Patch("/{id}", s.handleRenameSession)
+			r.With(creator).Post("/{id}/archive", s.handleArchiveSession)
+			r.With(creator).Post("/{id}/unarchive", s.handleUnarchiveSession)
+		})
+
+		// Video outputs joined into one
+		r.With(creator, s.rejectDuringMaintenance).Post("/outputs/concat", s.handleConcatOutputs)
+
+		// Pipelines of dependent jobs
+		r.Route("/pipelines", func(r chi.Router) {
+			r.With(viewer).Get("/", s.handleListPipelines)
+			r.With(viewer).Get("/{id}", s.handleGetPipeline)
+			r.With(creator, s.rejectDuringMaintenance).Post("/", s.handleCreatePipeline)
+		})
+
+		// Input image library
+		r.Route("/inputs", func(r chi.Router) {
+			r.With(viewer).Get("/", s.handleListInputs)
+			r.With(viewer).Get("/{hash}", s.handleGetInput)
+			r.With(viewer).Get("/{hash}/file", s.handleInputFile)
+			r.With(creator).Post("/", s.handleUploadInput)
+			r.With(creator).Delete("/{hash}", s.handleDeleteInput)
+			r.With(admin).Post("/prune", s.handlePruneInputs)
+		})
+
+		// Chunked uploads of large inputs
+		r.Route("/uploads", func(r chi.Router) {
+			r.Use(creator)
+			r.Post("/", s.handleCreateUpload)
+			r.Get("/{id}", s.handleGetUpload)
+			r.Put("/{id}/chunks/{index}", s.handlePutChunk)
+			r.Post("/{id}/complete", s.handleCompleteUpload)
+			r.Delete("/{id}", s.handleDeleteUpload)
+		})
+
+		// Presets
+		r.Route("/presets", func(r chi.Router) {
+			r.With(viewer).Get("/", s.handleListPresets)
+			r.With(viewer).Get("/{id}", s.handleGetPreset)
+			r.With(viewer).Get("/{id}/export", s.handleExportPreset)
+			r.With(creator).Post("/", s.handleCreatePreset)
+			r.With(creator).Post("/import", s.handleImportPreset)
+			r.With(creator).Delete("/{id}", s.handleDeletePreset)
+		})
+
+		// Saved prompts
+		r.Route("/prompts", func(r chi.Router) {
+			r.With(viewer).Get("/", s.handleListPrompts)
+			r.With(viewer).Get("/tags", s.handleListPromptTags)
+			r.With(viewer).Get("/{id}", s.handleGetPrompt)
+			r.With(creator).Post("/", s.handleCreatePrompt)
+			r.With(creator).Put("/{id}", s.handleUpdatePrompt)
+			r.With(creator).Delete("/{id}", s.handleDeletePrompt)
 		})
 
 		// Models
 		r.Route("/models", func(r chi.Router) {
-			r.Get("/", s.handleSearchModels)
-			r.Get("/local", s.handleListLocalModels)
-			r.Get("/{source}/{id}", s.handleGetModel)
-			r.Post("/{source}/{id}/download", s.handleDownloadModel)
-			r.Delete("/{source}/{id}", s.handleDeleteModel)
+			r.With(viewer).Get("/", s.handleSearchModels)
+			r.With(viewer).Get("/local", s.handleListLocalModels)
+			r.With(viewer).Get("/verification", s.handleModelVerification)
+			r.With(viewer).Get("/suggestions", s.handleModelSuggestions)
+			r.With(viewer).Get("/aliases", s.handleListModelAliases)
+			r.With(admin).Post("/pins", s.handleSetModelPin)
+			r.With(admin).Patch("/required/*", s.handleRemapRequiredModel)
+			r.With(viewer).Get("/{source}/{id}", s.handleGetModel)
+			r.With(admin).Post("/{source}/{id}/download", s.handleDownloadModel)
+			r.With(admin).Delete("/{source}/{id}", s.handleDeleteModel)
 		})
 
 		// Downloads
 		r.Route("/downloads", func(r chi.Router) {
-			r.Get("/", s.handleListDownloads)
-			r.Delete("/{id}", s.handleCancelDownload)
+			r.With(viewer).Get("/", s.handleListDownloads)
+			r.With(viewer).Get("/history", s.handleDownloadHistory)
+			r.With(viewer).Get("/mirrors", s.handleListMirrors)
+			r.With(admin).Delete("/{id}", s.handleCancelDownload)
+		})
+
+		// Workers
+		r.Route("/workers", func(r chi.Router) {
+			r.Use(admin)
+			r.Post("/{id}/unload", s.handleUnloadWorker)
 		})
 
 		// Config
 		r.Route("/config", func(r chi.Router) {
+			r.Use(admin)
 			r.Get("/", s.handleExportConfig)
 			r.Post("/", s.handleImportConfig)
 			r.Get("/tokens", s.handleGetTokenStatus)
 			r.Put("/tokens", s.handleUpdateTokens)
 		})
 
+		// First-run setup
+		r.Route("/setup", func(r chi.Router) {
+			r.With(viewer).Get("/", s.handleGetSetup)
+			r.With(admin).Post("/", s.handleCompleteSetup)
+		})
+
+		// Users
+		r.Route("/users", func(r chi.Router) {
+			r.With(viewer).Get("/me", s.handleGetCurrentUser)
+			r.With(viewer).Get("/me/usage", s.handleGetMyUsage)
+			r.With(admin).Get("/", s.handleListUsers)
+			r.With(admin).Post("/", s.handleCreateUser)
+			r.With(admin).Delete("/{id}", s.handleDeleteUser)
+			r.With(admin).Get("/{id}/quota", s.handleGetUserQuota)
+			r.With(admin).Put("/{id}/quota", s.handleSetUserQuota)
+		})
+
+		// Queued jobs with estimated start times
+		r.With(viewer).Get("/queue", s.handleGetQueue)
+
+		// Home screen snapshot: running jobs, queue, workers, GPUs, downloads
+		r.With(viewer).Get("/dashboard", s.handleGetDashboard)
+
+		// Job counts, GPU time and energy by job type
+		r.With(viewer).Get("/stats", s.handleGetStats)
+
+		// Failures grouped by error fingerprint
+		r.With(viewer).Get("/failures", s.handleListFailures)
+
+		// Admin
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(admin)
+			r.Get("/maintenance", s.handleGetMaintenance)
+			r.Post("/maintenance", s.handleSetMaintenance)
+			r.Get("/workers", s.handleListWorkers)
+			r.Post("/workers/{id}/debug", s.handleWorkerDebug)
+			r.With(s.rejectDuringMaintenance).Post("/benchmark", s.handleStartBenchmark)
+			r.Get("/benchmarks", s.handleListBenchmarks)
+			r.Get("/benchmarks/{id}", s.handleGetBenchmark)
+			r.Get("/requests", s.handleListRequests)
+			r.Get("/diagnostics", s.handleDiagnostics)
+		})
+
+		// System
+		r.Route("/system", func(r chi.Router) {
+			r.Use(viewer)
+			r.Get("/gpu/history", s.handleGPUHistory)
+			r.Get("/alerts", s.handleListAlerts)
+		})
+
 		// Health
 		r.Get("/health", s.handleHealth)
 	})
 
+	// Readiness probe for containers and load balancers
+	r.Get("/readyz", s.handleReady)
+
 	// WebSocket
-	r.Get("/ws", s.handleWebSocket)
+	r.With(viewer).Get("/ws", s.handleWebSocket)
+
+	// Generated outputs and thumbnails
+	r.With(viewer).Get("/outputs/*", s.handleOutputFile)
+	r.With(viewer).Get("/thumbnails/*", s.handleThumbnailFile)
 
 	// Static files (frontend) with SPA fallback
 	r.Get("/*", s.handleSPA)
 
-	return r, hub
-}
-
-// handleSPA serves static files and falls back to index.html for SPA routing
-func (s *Server) handleSPA(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
-
-	// Serve static files if they exist
-	fullPath := s.cfg.StaticDir + path
-	info, err := http.Dir(s.cfg.StaticDir).Open(path)
-	if err == nil {
-		defer info.Close()
-		// Check if it's a file (not a directory)
-		stat, err := info.Stat()
-		if err == nil && !stat.IsDir() {
-			http.ServeFile(w, r, fullPath)
-			return
-		}
-	}
-
-	// For any other route, serve index.html (SPA routing)
-	http.ServeFile(w, r, s.cfg.StaticDir+"/index.html")
+	return r, hub, s
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		if r.Method == "OPTIONS" {
@@ -132,3 +364,25 @@ func corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// requestTimeout puts each request under a deadline, except preview
+// streams, which last as long as the job they show. A handler that gives
+// up on the deadline without responding gets a 504 TIMEOUT error.
+func requestTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, ".mjpeg") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+			if ctx.Err() == context.DeadlineExceeded && ww.Status() == 0 {
+				apierr.Respond(w, http.StatusGatewayTimeout, apierr.CodeTimeout, "Request timed out")
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/auth"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// SessionHeader names the session a submitted job belongs to. The UI sends
+// it with every submission once it has created a session; scripts can do
+// the same to group an experiment.
+const SessionHeader = "X-Diffbox-Session"
+
+const maxSessionNameLength = 200
+
+type Session struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+	// ArchivedAt is set while the session and its jobs are archived
+	ArchivedAt string `json:"archived_at,omitempty"`
+	JobCount   int    `json:"job_count"`
+	// JobCounts counts the session's jobs by status
+	JobCounts map[string]int `json:"job_counts"`
+}
+
+// SessionDetail is a session with its jobs, oldest first
+type SessionDetail struct {
+	Session
+	Jobs []Job `json:"jobs"`
+}
+
+// SessionRequest creates or renames a session
+type SessionRequest struct {
+	Name string `json:"name"`
+}
+
+// handleListSessions lists sessions, newest first. archived works as it
+// does for jobs.
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	archived := db.ExcludeArchived
+	switch r.URL.Query().Get("archived") {
+	case "", "exclude":
+	case "include":
+		archived = db.IncludeArchived
+	case "only":
+		archived = db.OnlyArchived
+	default:
+		apierr.Field(w, "archived", "must be exclude, include or only")
+		return
+	}
+
+	dbSessions, err := s.db.ListSessions(r.Context(), archived)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list sessions")
+		return
+	}
+
+	sessions := make([]Session, len(dbSessions))
+	for i, session := range dbSessions {
+		sessions[i] = dbSessionToAPISession(session)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// handleCreateSession starts a session. The name defaults to the date.
+func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	name, ok := decodeSessionName(w, r, false)
+	if !ok {
+		return
+	}
+	if name == "" {
+		name = "Session " + time.Now().Format("2006-01-02 15:04")
+	}
+
+	session := &db.Session{ID: uuid.New().String(), Name: name}
+	if user := auth.UserFromContext(r.Context()); user != nil {
+		session.UserID = user.ID
+	}
+	if err := s.db.CreateSession(r.Context(), session); err != nil {
+		log.Printf("Sessions: Failed to create session %q: %v", name, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to create session")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(dbSessionToAPISession(session))
+}
+
+// handleGetSession returns a session with all its jobs, archived or not
+func (s *Server) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	session, err := s.db.GetSession(r.Context(), id)
+	if err != nil {
+		sessionError(w, err, "Failed to get session")
+		return
+	}
+	dbJobs, err := s.db.ListSessionJobs(r.Context(), id)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list session jobs")
+		return
+	}
+
+	detail := SessionDetail{Session: dbSessionToAPISession(session), Jobs: make([]Job, len(dbJobs))}
+	for i, dbJob := range dbJobs {
+		detail.Jobs[i] = dbJobToAPIJob(dbJob)
+	}
+	s.addQueueEstimates(r.Context(), detail.Jobs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+func (s *Server) handleRenameSession(w http.ResponseWriter, r *http.Request) {
+	name, ok := decodeSessionName(w, r, true)
+	if !ok {
+		return
+	}
+	if err := s.db.RenameSession(r.Context(), chi.URLParam(r, "id"), name); err != nil {
+		sessionError(w, err, "Failed to rename session")
+		return
+	}
+	s.writeSession(w, r)
+}
+
+func (s *Server) handleArchiveSession(w http.ResponseWriter, r *http.Request) {
+	s.setSessionArchived(w, r, true)
+}
+
+func (s *Server) handleUnarchiveSession(w http.ResponseWriter, r *http.Request) {
+	s.setSessionArchived(w, r, false)
+}
+
+// setSessionArchived archives or restores a session along with its jobs.
+// Archiving is refused while any of them is queued or running.
+func (s *Server) setSessionArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	id := chi.URLParam(r, "id")
+
+	var err error
+	if archived {
+		err = s.db.ArchiveSession(r.Context(), id)
+	} else {
+		err = s.db.UnarchiveSession(r.Context(), id)
+	}
+	if err == db.ErrJobActive {
+		apierr.Respond(w, http.StatusConflict, apierr.CodeConflict, "Session has jobs still queued or running")
+		return
+	}
+	if err != nil {
+		sessionError(w, err, "Failed to update session")
+		return
+	}
+	s.writeSession(w, r)
+}
+
+// writeSession responds with the session named in the URL
+func (s *Server) writeSession(w http.ResponseWriter, r *http.Request) {
+	session, err := s.db.GetSession(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		sessionError(w, err, "Failed to get session")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dbSessionToAPISession(session))
+}
+
+// jobSession returns the session named by a submission's SessionHeader,
+// or "" if there is none. It writes an error and returns false if the
+// session doesn't exist or is archived.
+func (s *Server) jobSession(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := strings.TrimSpace(r.Header.Get(SessionHeader))
+	if id == "" {
+		return "", true
+	}
+	session, err := s.db.GetSession(r.Context(), id)
+	if err == sql.ErrNoRows {
+		apierr.Field(w, "session_id", "unknown session")
+		return "", false
+	}
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get session")
+		return "", false
+	}
+	if !session.ArchivedAt.IsZero() {
+		apierr.Respond(w, http.StatusConflict, apierr.CodeConflict, "Session is archived")
+		return "", false
+	}
+	return id, true
+}
+
+// decodeSessionName reads a session name, writing a 400 and returning
+// false if it is missing when required or too long
+func decodeSessionName(w http.ResponseWriter, r *http.Request, required bool) (string, bool) {
+	var req SessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return "", false
+	}
+	name := strings.TrimSpace(req.Name)
+	switch {
+	case required && name == "":
+		apierr.Field(w, "name", "is required")
+	case len(name) > maxSessionNameLength:
+		apierr.Field(w, "name", "too long (max 200 characters)")
+	default:
+		return name, true
+	}
+	return "", false
+}
+
+func sessionError(w http.ResponseWriter, err error, message string) {
+	if err == sql.ErrNoRows {
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Session not found")
+		return
+	}
+	apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, message)
+}
+
+func dbSessionToAPISession(session *db.Session) Session {
+	out := Session{
+		ID:        session.ID,
+		Name:      session.Name,
+		CreatedAt: session.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt: session.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		JobCounts: session.JobCounts,
+	}
+	if out.JobCounts == nil {
+		out.JobCounts = map[string]int{}
+	}
+	for _, n := range out.JobCounts {
+		out.JobCount += n
+	}
+	if !session.ArchivedAt.IsZero() {
+		out.ArchivedAt = session.ArchivedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return out
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/gpu"
+	"github.com/druarnfield/diffbox/internal/models"
+	"github.com/druarnfield/diffbox/internal/setup"
+)
+
+// SetupStatus is everything the first-run wizard shows: what's been
+// chosen, the hardware found and what each choice would download
+type SetupStatus struct {
+	Completed   bool   `json:"completed"`
+	CompletedAt string `json:"completed_at,omitempty"`
+	// Variant is the chosen variant, or the recommended one before setup
+	Variant            string           `json:"variant"`
+	RecommendedVariant string           `json:"recommended_variant"`
+	Workflows          []SetupWorkflow  `json:"workflows"`
+	Directories        []SetupDirectory `json:"directories"`
+	Hardware           setup.Hardware   `json:"hardware"`
+	Tokens             TokenStatus      `json:"tokens"`
+}
+
+// SetupWorkflow is one built-in workflow and the size of its models in
+// each variant
+type SetupWorkflow struct {
+	Name          string           `json:"name"`
+	Enabled       bool             `json:"enabled"`
+	DownloadBytes map[string]int64 `json:"download_bytes"`
+}
+
+type SetupDirectory struct {
+	Name string `json:"name"` // "models" or "outputs"
+	Path string `json:"path"` // in use now
+	// Pending is a directory chosen in setup that applies at the next start
+	Pending string `json:"pending,omitempty"`
+	// Locked is true when an environment variable pins the directory
+	Locked bool   `json:"locked"`
+	EnvVar string `json:"env_var"`
+}
+
+// SetupRequest completes (or reruns) setup. An empty variant takes the
+// recommended one and empty tokens or directories keep the current ones.
+type SetupRequest struct {
+	Workflows  []string    `json:"workflows"`
+	Variant    string      `json:"variant"`
+	Tokens     TokenConfig `json:"tokens"`
+	ModelsDir  string      `json:"models_dir"`
+	OutputsDir string      `json:"outputs_dir"`
+}
+
+func (s *Server) handleGetSetup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.setupStatus(r.Context()))
+}
+
+// handleCompleteSetup saves the wizard's choices. Model downloads start
+// once it succeeds.
+func (s *Server) handleCompleteSetup(w http.ResponseWriter, r *http.Request) {
+	var req SetupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	state := s.setup.State()
+	state.Workflows = nil
+	for _, workflow := range req.Workflows {
+		if !slices.Contains(models.BuiltinWorkflows, workflow) {
+			apierr.Field(w, "workflows", "unknown workflow "+workflow)
+			return
+		}
+		if !slices.Contains(state.Workflows, workflow) {
+			state.Workflows = append(state.Workflows, workflow)
+		}
+	}
+	if len(state.Workflows) == 0 {
+		apierr.Field(w, "workflows", "enable at least one workflow")
+		return
+	}
+
+	switch req.Variant {
+	case "":
+		state.Variant = setup.Recommend(s.hardware())
+	case models.VariantFull, models.VariantQuantized:
+		state.Variant = req.Variant
+	default:
+		apierr.Field(w, "variant", "must be full or fp8")
+		return
+	}
+
+	dirs := []struct {
+		field, env, path string
+		chosen           *string
+	}{
+		{"models_dir", setup.ModelsDirEnv, req.ModelsDir, &state.ModelsDir},
+		{"outputs_dir", setup.OutputsDirEnv, req.OutputsDir, &state.OutputsDir},
+	}
+	for _, d := range dirs {
+		if d.path == "" {
+			continue
+		}
+		if setup.DirLocked(d.env) {
+			apierr.Field(w, d.field, "set by "+d.env+"; change it there")
+			return
+		}
+		if err := setup.PrepareDir(d.path); err != nil {
+			apierr.Field(w, d.field, err.Error())
+			return
+		}
+		*d.chosen = d.path
+	}
+
+	if !s.storeTokens(w, r, req.Tokens) {
+		return
+	}
+
+	if err := s.setup.Complete(r.Context(), state); err != nil {
+		log.Printf("Setup: Failed to save: %v", err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to save setup")
+		return
+	}
+	log.Printf("Setup: completed with workflows %v, %s variant", state.Workflows, state.Variant)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.setupStatus(r.Context()))
+}
+
+func (s *Server) setupStatus(ctx context.Context) SetupStatus {
+	state := s.setup.State()
+	hw := s.hardware()
+	status := SetupStatus{
+		Completed:          state.Completed,
+		Variant:            state.Variant,
+		RecommendedVariant: setup.Recommend(hw),
+		Hardware:           hw,
+		Tokens:             s.tokenStatus(ctx),
+	}
+	if state.Completed {
+		status.CompletedAt = state.CompletedAt.Format("2006-01-02T15:04:05Z07:00")
+	} else {
+		status.Variant = status.RecommendedVariant
+	}
+
+	for _, workflow := range models.BuiltinWorkflows {
+		status.Workflows = append(status.Workflows, SetupWorkflow{
+			Name:    workflow,
+			Enabled: !state.Completed || slices.Contains(state.Workflows, workflow),
+			DownloadBytes: map[string]int64{
+				models.VariantFull:      setup.DownloadSize(workflow, models.VariantFull),
+				models.VariantQuantized: setup.DownloadSize(workflow, models.VariantQuantized),
+			},
+		})
+	}
+
+	dirs := []struct{ name, env, path, chosen string }{
+		{"models", setup.ModelsDirEnv, s.cfg.ModelsDir, state.ModelsDir},
+		{"outputs", setup.OutputsDirEnv, s.cfg.OutputsDir, state.OutputsDir},
+	}
+	for _, d := range dirs {
+		dir := SetupDirectory{Name: d.name, Path: d.path, Locked: setup.DirLocked(d.env), EnvVar: d.env}
+		if d.chosen != "" && d.chosen != d.path && !dir.Locked {
+			dir.Pending = d.chosen
+		}
+		status.Directories = append(status.Directories, dir)
+	}
+	return status
+}
+
+// hardware describes the GPUs from the latest telemetry sample and the
+// volumes holding the models and outputs
+func (s *Server) hardware() setup.Hardware {
+	var samples []gpu.Sample
+	if s.gpu != nil {
+		samples = s.gpu.Latest()
+	}
+	return setup.Detect(samples, models.DiskUsage, s.cfg.ModelsDir, s.cfg.OutputsDir)
+}
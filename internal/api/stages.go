@@ -0,0 +1,81 @@
+package api
+
+import (
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/workflow"
+)
+
+// Job stage statuses
+const (
+	stagePending = "pending"
+	stageRunning = "running"
+	stageDone    = "done"
+	stageStopped = "stopped"
+	stageSkipped = "skipped"
+)
+
+// jobStages lists a workflow's stages with what the job recorded in each,
+// followed by any stage the worker reported that the workflow doesn't
+// list. Stages a completed job never entered were skipped.
+func jobStages(stages []workflow.Stage, recorded []*db.JobStage, completed bool) []JobStage {
+	byName := make(map[string]*db.JobStage, len(recorded))
+	for _, r := range recorded {
+		byName[r.Stage] = r
+	}
+	var total float64
+	for _, s := range stages {
+		total += s.Weight
+	}
+
+	var out []JobStage
+	listed := make(map[string]bool, len(stages))
+	for _, s := range stages {
+		listed[s.Name] = true
+		stage := JobStage{Name: s.Name, Status: stagePending}
+		if total > 0 {
+			stage.Weight = s.Weight / total
+		}
+		if r := byName[s.Name]; r != nil {
+			fillJobStage(&stage, r)
+		}
+		out = append(out, stage)
+	}
+	for _, r := range recorded {
+		if !listed[r.Stage] {
+			stage := JobStage{Name: r.Stage}
+			fillJobStage(&stage, r)
+			out = append(out, stage)
+		}
+	}
+
+	// A stage left for a later one is done, whatever it last reported,
+	// and one never entered was skipped
+	later := completed
+	for i := len(out) - 1; i >= 0; i-- {
+		switch {
+		case !later:
+		case out[i].Status == stageStopped:
+			out[i].Status = stageDone
+		case out[i].Status == stagePending:
+			out[i].Status = stageSkipped
+		}
+		if out[i].Status != stagePending {
+			later = true
+		}
+	}
+	return out
+}
+
+func fillJobStage(stage *JobStage, r *db.JobStage) {
+	stage.Progress = r.Progress
+	stage.StartedAt = r.StartedAt.Format("2006-01-02T15:04:05.000Z07:00")
+	stage.DurationMs = r.Duration.Milliseconds()
+	switch {
+	case r.Running:
+		stage.Status = stageRunning
+	case r.Progress >= 1:
+		stage.Status = stageDone
+	default:
+		stage.Status = stageStopped
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+)
+
+// defaultStatsDays is how far back job stats go unless asked otherwise
+const defaultStatsDays = 30
+
+// JobTypeStats totals the jobs of one type. GPUSeconds and EnergyWh sum
+// over the metered jobs only: those that ran while GPUs were sampled.
+type JobTypeStats struct {
+	Type        string  `json:"type,omitempty"`
+	Jobs        int     `json:"jobs"`
+	Completed   int     `json:"completed"`
+	Failed      int     `json:"failed"`
+	MeteredJobs int     `json:"metered_jobs"`
+	GPUSeconds  float64 `json:"gpu_seconds"`
+	EnergyWh    float64 `json:"energy_wh"`
+}
+
+type StatsResponse struct {
+	Days   int            `json:"days"`
+	Since  string         `json:"since"`
+	Totals JobTypeStats   `json:"totals"`
+	ByType []JobTypeStats `json:"by_type"`
+}
+
+// handleGetStats totals jobs, GPU time and energy over the last days,
+// overall and by job type
+func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
+	days := defaultStatsDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			apierr.Field(w, "days", "must be a positive integer")
+			return
+		}
+		days = n
+	}
+
+	since := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+	stats, err := s.db.JobStatsByType(r.Context(), since)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to load job stats")
+		return
+	}
+
+	resp := StatsResponse{
+		Days:   days,
+		Since:  since.Format("2006-01-02T15:04:05Z07:00"),
+		ByType: make([]JobTypeStats, 0, len(stats)),
+	}
+	for _, st := range stats {
+		entry := JobTypeStats{
+			Type:        st.Type,
+			Jobs:        st.Jobs,
+			Completed:   st.Completed,
+			Failed:      st.Failed,
+			MeteredJobs: st.Metered,
+			GPUSeconds:  st.GPUSeconds,
+			EnergyWh:    st.EnergyWh,
+		}
+		resp.ByType = append(resp.ByType, entry)
+		resp.Totals.Jobs += entry.Jobs
+		resp.Totals.Completed += entry.Completed
+		resp.Totals.Failed += entry.Failed
+		resp.Totals.MeteredJobs += entry.MeteredJobs
+		resp.Totals.GPUSeconds += entry.GPUSeconds
+		resp.Totals.EnergyWh += entry.EnergyWh
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
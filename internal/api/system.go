@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/alerts"
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/gpu"
+)
+
+type GPUHistoryResponse struct {
+	Samples []gpu.Sample `json:"samples"`
+}
+
+func (s *Server) handleGPUHistory(w http.ResponseWriter, r *http.Request) {
+	// Default to the whole buffer; ?minutes=N narrows the window
+	since := time.Time{}
+	if minutes := r.URL.Query().Get("minutes"); minutes != "" {
+		n, err := strconv.Atoi(minutes)
+		if err != nil || n <= 0 {
+			apierr.Field(w, "minutes", "must be a positive integer")
+			return
+		}
+		since = time.Now().Add(-time.Duration(n) * time.Minute)
+	}
+
+	samples := []gpu.Sample{}
+	if s.gpu != nil {
+		samples = append(samples, s.gpu.History(since)...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GPUHistoryResponse{Samples: samples})
+}
+
+type AlertsResponse struct {
+	Alerts []alerts.Alert `json:"alerts"`
+}
+
+// handleListAlerts returns the disk and VRAM alerts currently firing, so a
+// client that connects late sees what it missed on the WebSocket
+func (s *Server) handleListAlerts(w http.ResponseWriter, r *http.Request) {
+	active := []alerts.Alert{}
+	if s.alerts != nil {
+		active = s.alerts.Active()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AlertsResponse{Alerts: active})
+}
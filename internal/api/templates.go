@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/paramdiff"
+	"github.com/druarnfield/diffbox/internal/paramtpl"
+	"github.com/go-chi/chi/v5"
+)
+
+// Template fields a workflow submission may carry. They are consumed by
+// expandTemplates and never reach the workflow handler.
+const (
+	// templateVariablesField holds the values for {{name}} placeholders
+	templateVariablesField = "variables"
+	// templatePresetField names a preset whose params fill in whatever the
+	// submission leaves out
+	templatePresetField = "preset_id"
+)
+
+// expandTemplates resolves a submission's preset and {{name}}
+// placeholders before the workflow handler decodes it, so every workflow
+// gets templating without knowing about it. Submissions without variables
+// or a preset pass through untouched, so a prompt may hold literal
+// {{braces}}.
+func (s *Server) expandTemplates(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if !bytes.Contains(body, []byte(`"`+templateVariablesField+`"`)) &&
+			!bytes.Contains(body, []byte(`"`+templatePresetField+`"`)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Numbers stay json.Number so large seeds survive the round trip
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var params map[string]interface{}
+		if err := dec.Decode(&params); err != nil {
+			// Not an object; the handler reports it
+			next.ServeHTTP(w, r)
+			return
+		}
+		_, hasVars := params[templateVariablesField]
+		_, hasPreset := params[templatePresetField]
+		if !hasVars && !hasPreset {
+			// The field names only appeared in text
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		vars, ok := params[templateVariablesField].(map[string]interface{})
+		if !ok && params[templateVariablesField] != nil {
+			apierr.Field(w, templateVariablesField, "must be an object")
+			return
+		}
+		presetID, ok := params[templatePresetField].(string)
+		if !ok && params[templatePresetField] != nil {
+			apierr.Field(w, templatePresetField, "must be a string")
+			return
+		}
+		delete(params, templateVariablesField)
+		delete(params, templatePresetField)
+
+		var declared []paramtpl.Variable
+		if presetID != "" {
+			p, err := s.db.GetPreset(r.Context(), presetID)
+			if errors.Is(err, sql.ErrNoRows) {
+				apierr.Field(w, templatePresetField, "unknown preset")
+				return
+			}
+			if err != nil {
+				apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to get preset")
+				return
+			}
+			preset := dbPresetToAPIPreset(p)
+			if workflow := submissionWorkflow(r); preset.Workflow != workflow {
+				apierr.Field(w, templatePresetField, "preset is for "+preset.Workflow+", not "+workflow)
+				return
+			}
+			params = paramdiff.Merge(preset.Params, params)
+			declared = preset.Variables
+		}
+
+		vars = paramtpl.WithDefaults(vars, declared)
+		var required []string
+		for _, v := range declared {
+			if _, ok := vars[v.Name]; !ok {
+				required = append(required, v.Name)
+			}
+		}
+		if len(required) > 0 {
+			apierr.Field(w, templateVariablesField, "no value for "+strings.Join(required, ", "))
+			return
+		}
+		expanded, err := paramtpl.Expand(params, vars)
+		if err != nil {
+			apierr.Field(w, templateVariablesField, err.Error())
+			return
+		}
+
+		data, err := json.Marshal(expanded)
+		if err != nil {
+			apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to serialize params")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		r.ContentLength = int64(len(data))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// submissionWorkflow is the workflow a submission route targets
+func submissionWorkflow(r *http.Request) string {
+	if workflow := chi.URLParam(r, "type"); workflow != "" {
+		return workflow
+	}
+	return path.Base(r.URL.Path)
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/upload"
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateUploadRequest starts a chunked upload. SHA256 is optional; when
+// given, the assembled file must match it.
+type CreateUploadRequest struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256,omitempty"`
+}
+
+// UploadStatus describes a chunked upload. Clients resume by sending the
+// Missing chunks, then completing it; Ref can then be passed to video
+// params of custom workflows.
+type UploadStatus struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	ChunkSize   int64  `json:"chunk_size"`
+	Chunks      int    `json:"chunks"`
+	Received    int    `json:"received"`
+	Missing     []int  `json:"missing"`
+	Completed   bool   `json:"completed"`
+	Ref         string `json:"ref,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	CompletedAt string `json:"completed_at,omitempty"`
+}
+
+func (s *Server) handleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	var req CreateUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	session, err := s.uploads.Create(req.Filename, req.Size, req.SHA256)
+	if err != nil {
+		s.uploadError(w, "", err)
+		return
+	}
+
+	log.Printf("Uploads: Started %s (%d bytes in %d chunks)", session.ID, session.Size, session.Chunks())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/uploads/"+session.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(uploadStatus(session))
+}
+
+func (s *Server) handleGetUpload(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	session, err := s.uploads.Get(id)
+	if err != nil {
+		s.uploadError(w, id, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uploadStatus(session))
+}
+
+// handlePutChunk stores one chunk from the raw request body. Chunks can
+// be sent in any order, in parallel, and resent after a failure.
+func (s *Server) handlePutChunk(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	index, err := strconv.Atoi(chi.URLParam(r, "index"))
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Chunk index must be a number")
+		return
+	}
+
+	session, err := s.uploads.PutChunk(id, index, r.Body)
+	if err != nil {
+		s.uploadError(w, id, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uploadStatus(session))
+}
+
+// handleCompleteUpload assembles the chunks into the final file. It
+// answers 409 with the missing chunks if any haven't arrived.
+func (s *Server) handleCompleteUpload(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	session, err := s.uploads.Complete(id)
+	if errors.Is(err, upload.ErrIncomplete) {
+		apierr.Respond(w, http.StatusConflict, apierr.CodeConflict, err.Error())
+		return
+	}
+	if errors.Is(err, upload.ErrChecksum) {
+		apierr.Field(w, "sha256", err.Error())
+		return
+	}
+	if err != nil {
+		s.uploadError(w, id, err)
+		return
+	}
+
+	log.Printf("Uploads: Completed %s (%s)", session.ID, session.Filename)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uploadStatus(session))
+}
+
+func (s *Server) handleDeleteUpload(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if err := s.uploads.Delete(id); err != nil {
+		s.uploadError(w, id, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uploadError maps chunk store errors to responses
+func (s *Server) uploadError(w http.ResponseWriter, id string, err error) {
+	switch {
+	case errors.Is(err, upload.ErrUploadNotFound):
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "Upload not found")
+	case errors.Is(err, upload.ErrInvalidUpload):
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeValidationFailed, err.Error())
+	default:
+		log.Printf("Uploads: Failed on upload %s: %v", id, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to store upload")
+	}
+}
+
+// resolveUpload turns an "upload:<id>" param into the absolute path of
+// the completed file, which is what workers on this host read. A video
+// output of a finished job ("output:<job id>") resolves the same way.
+func (s *Server) resolveUpload(ctx context.Context, ref string) (string, error) {
+	if jobID, ok := parseOutputRef(ref); ok {
+		path, err := s.jobOutputPath(ctx, jobID, "video")
+		if err != nil {
+			return "", fmt.Errorf("output of job %s: %w", jobID, err)
+		}
+		return filepath.Abs(path)
+	}
+	id, ok := upload.ParseRef(ref)
+	if !ok {
+		return "", errors.New("must reference a completed upload (upload:<id>) or job output (output:<job id>)")
+	}
+	path, err := s.uploads.Path(id)
+	if errors.Is(err, upload.ErrUploadNotFound) {
+		return "", errors.New("unknown upload " + id)
+	}
+	if errors.Is(err, upload.ErrIncomplete) {
+		return "", errors.New("upload " + id + " hasn't been completed")
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(path)
+}
+
+// recordUploads notes the chunked uploads a job's params point at, so
+// they aren't expired while it waits or runs
+func (s *Server) recordUploads(ctx context.Context, jobID string, paramsJSON []byte) {
+	var params map[string]interface{}
+	if err := json.Unmarshal(paramsJSON, &params); err != nil {
+		return
+	}
+	var ids []string
+	for _, v := range params {
+		if path, ok := v.(string); ok {
+			if id, ok := s.uploads.IDForPath(path); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	if err := s.db.RecordJobUploads(ctx, jobID, ids); err != nil {
+		log.Printf("Uploads: Failed to record uploads of job %s: %v", jobID, err)
+	}
+}
+
+func uploadStatus(session *upload.Session) UploadStatus {
+	missing := session.Missing()
+	status := UploadStatus{
+		ID:        session.ID,
+		Filename:  session.Filename,
+		Size:      session.Size,
+		ChunkSize: session.ChunkSize,
+		Chunks:    session.Chunks(),
+		Received:  session.Chunks() - len(missing),
+		Missing:   missing,
+		Completed: session.Completed(),
+		CreatedAt: session.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt: session.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if session.Completed() {
+		status.Ref = upload.RefPrefix + session.ID
+		status.CompletedAt = session.CompletedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return status
+}
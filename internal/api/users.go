@@ -0,0 +1,300 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/druarnfield/diffbox/internal/admission"
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/auth"
+	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type User struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+type CreateUserRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// CreateUserResponse includes the API token, which is only shown once
+type CreateUserResponse struct {
+	User
+	Token string `json:"token"`
+}
+
+// QuotaLimits are a user's effective limits. Zero means unlimited.
+type QuotaLimits struct {
+	MaxQueuedJobs    int     `json:"max_queued_jobs"`
+	GPUMinutesPerDay float64 `json:"gpu_minutes_per_day"`
+	StorageBytes     int64   `json:"storage_bytes"`
+}
+
+// QuotaUsage is what a user holds against their limits. GPU minutes cover
+// jobs started in the last 24 hours.
+type QuotaUsage struct {
+	ActiveJobs   int     `json:"active_jobs"`
+	GPUMinutes   float64 `json:"gpu_minutes"`
+	StorageBytes int64   `json:"storage_bytes"`
+}
+
+// UserUsageResponse reports a user's quota standing. Enforced is false
+// when admission control or auth is off, so the limits aren't applied.
+type UserUsageResponse struct {
+	UserID   string      `json:"user_id"`
+	Enforced bool        `json:"enforced"`
+	Limits   QuotaLimits `json:"limits"`
+	Usage    QuotaUsage  `json:"usage"`
+}
+
+// UserQuota is an admin's view of one user's overrides. A null field
+// falls back to the server default.
+type UserQuota struct {
+	UserID           string      `json:"user_id"`
+	MaxQueuedJobs    *int        `json:"max_queued_jobs"`
+	GPUMinutesPerDay *int        `json:"gpu_minutes_per_day"`
+	StorageBytes     *int64      `json:"storage_bytes"`
+	Effective        QuotaLimits `json:"effective"`
+}
+
+// lookupUser resolves API tokens for the auth middleware
+func (s *Server) lookupUser(ctx context.Context, tokenHash string) (*auth.User, error) {
+	user, err := s.db.GetUserByTokenHash(ctx, tokenHash)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	return &auth.User{ID: user.ID, Name: user.Name, Role: auth.Role(user.Role)}, nil
+}
+
+func (s *Server) handleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(User{
+		ID:   user.ID,
+		Name: user.Name,
+		Role: string(user.Role),
+	})
+}
+
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	dbUsers, err := s.db.ListUsers(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list users")
+		return
+	}
+
+	users := make([]User, len(dbUsers))
+	for i, u := range dbUsers {
+		users[i] = dbUserToAPIUser(u)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		apierr.Field(w, "name", "is required")
+		return
+	}
+	if req.Role == "" {
+		req.Role = string(auth.RoleViewer)
+	}
+	if !auth.Role(req.Role).Valid() {
+		apierr.Field(w, "role", "must be admin, creator, or viewer")
+		return
+	}
+
+	token, err := auth.GenerateToken()
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to generate token")
+		return
+	}
+
+	dbUser := &db.User{
+		ID:        uuid.New().String(),
+		Name:      req.Name,
+		Role:      req.Role,
+		TokenHash: auth.HashToken(token),
+	}
+	if err := s.db.CreateUser(r.Context(), dbUser); err != nil {
+		log.Printf("Users: Failed to create user %s: %v", req.Name, err)
+		apierr.Respond(w, http.StatusConflict, apierr.CodeConflict, "Failed to create user (name may already exist)")
+		return
+	}
+
+	log.Printf("Users: Created %s user %s", dbUser.Role, dbUser.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateUserResponse{
+		User:  dbUserToAPIUser(dbUser),
+		Token: token,
+	})
+}
+
+func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+
+	if current := auth.UserFromContext(r.Context()); current != nil && current.ID == userID {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeConflict, "Cannot delete the current user")
+		return
+	}
+
+	if err := s.db.DeleteUser(r.Context(), userID); err != nil {
+		if err == sql.ErrNoRows {
+			apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "User not found")
+			return
+		}
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to delete user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func dbUserToAPIUser(u *db.User) User {
+	user := User{
+		ID:   u.ID,
+		Name: u.Name,
+		Role: u.Role,
+	}
+	if !u.CreatedAt.IsZero() {
+		user.CreatedAt = u.CreatedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return user
+}
+
+func (s *Server) handleGetMyUsage(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+
+	limits, usage, err := s.userQuota(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Users: Failed to load usage for %s: %v", user.ID, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to load usage")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UserUsageResponse{
+		UserID:   user.ID,
+		Enforced: s.admission != nil && s.admission.Quota != nil,
+		Limits:   quotaLimits(limits),
+		Usage: QuotaUsage{
+			ActiveJobs:   usage.Jobs,
+			GPUMinutes:   usage.GPUSeconds / 60,
+			StorageBytes: usage.StorageBytes,
+		},
+	})
+}
+
+func (s *Server) handleGetUserQuota(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	if !s.userExists(w, r, userID) {
+		return
+	}
+	s.writeUserQuota(w, r, userID)
+}
+
+func (s *Server) handleSetUserQuota(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+
+	var req UserQuota
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	switch {
+	case req.MaxQueuedJobs != nil && *req.MaxQueuedJobs < 0:
+		apierr.Field(w, "max_queued_jobs", "must not be negative")
+		return
+	case req.GPUMinutesPerDay != nil && *req.GPUMinutesPerDay < 0:
+		apierr.Field(w, "gpu_minutes_per_day", "must not be negative")
+		return
+	case req.StorageBytes != nil && *req.StorageBytes < 0:
+		apierr.Field(w, "storage_bytes", "must not be negative")
+		return
+	}
+	if !s.userExists(w, r, userID) {
+		return
+	}
+
+	err := s.db.SetUserQuota(r.Context(), &db.UserQuota{
+		UserID:           userID,
+		MaxQueuedJobs:    req.MaxQueuedJobs,
+		GPUMinutesPerDay: req.GPUMinutesPerDay,
+		StorageBytes:     req.StorageBytes,
+	})
+	if err != nil {
+		log.Printf("Users: Failed to set quota for %s: %v", userID, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to save quota")
+		return
+	}
+
+	log.Printf("Users: Updated quota for %s", userID)
+	s.writeUserQuota(w, r, userID)
+}
+
+func (s *Server) writeUserQuota(w http.ResponseWriter, r *http.Request, userID string) {
+	quota, err := s.db.GetUserQuota(r.Context(), userID)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to load quota")
+		return
+	}
+	limits, _, err := s.userQuota(r.Context(), userID)
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to load quota")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UserQuota{
+		UserID:           userID,
+		MaxQueuedJobs:    quota.MaxQueuedJobs,
+		GPUMinutesPerDay: quota.GPUMinutesPerDay,
+		StorageBytes:     quota.StorageBytes,
+		Effective:        quotaLimits(limits),
+	})
+}
+
+// userExists writes a 404 and returns false if no user has the ID
+func (s *Server) userExists(w http.ResponseWriter, r *http.Request, userID string) bool {
+	users, err := s.db.ListUsers(r.Context())
+	if err != nil {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to list users")
+		return false
+	}
+	for _, u := range users {
+		if u.ID == userID {
+			return true
+		}
+	}
+	apierr.Respond(w, http.StatusNotFound, apierr.CodeNotFound, "User not found")
+	return false
+}
+
+func quotaLimits(l admission.Limits) QuotaLimits {
+	return QuotaLimits{
+		MaxQueuedJobs:    l.Jobs,
+		GPUMinutesPerDay: l.GPUSeconds / 60,
+		StorageBytes:     l.StorageBytes,
+	}
+}
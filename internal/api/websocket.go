@@ -6,6 +6,10 @@ import (
 	"net/http"
 	"sync"
 
+	"github.com/druarnfield/diffbox/internal/alerts"
+	"github.com/druarnfield/diffbox/internal/gpu"
+	"github.com/druarnfield/diffbox/internal/models"
+	"github.com/druarnfield/diffbox/internal/worker"
 	"github.com/gorilla/websocket"
 )
 
@@ -26,6 +30,12 @@ type JobProgress struct {
 	Progress float64 `json:"progress"`
 	Stage    string  `json:"stage"`
 	Preview  string  `json:"preview,omitempty"` // base64 preview frame
+	// ETASeconds is the estimated time left, omitted until one is known
+	ETASeconds int64 `json:"eta_seconds,omitempty"`
+	// StageID and StageProgress are the workflow stage the job is in and
+	// how far through it, when the worker reports stages
+	StageID       string  `json:"stage_id,omitempty"`
+	StageProgress float64 `json:"stage_progress,omitempty"`
 }
 
 type JobComplete struct {
@@ -45,14 +55,23 @@ type DownloadProgress struct {
 	Speed      string  `json:"speed"`
 }
 
+// JobLog is a line of worker output written while running a job
+type JobLog struct {
+	JobID string `json:"job_id"`
+	Line  string `json:"line"`
+}
+
 type SubscribeMessage struct {
 	JobIDs []string `json:"job_ids"`
+	// Logs opts in to job:log messages for these jobs
+	Logs bool `json:"logs,omitempty"`
 }
 
 // WebSocket Hub manages all client connections
 type WebSocketHub struct {
 	clients    map[*Client]bool
 	broadcast  chan []byte
+	logs       chan JobLog
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.RWMutex
@@ -63,13 +82,16 @@ type Client struct {
 	conn         *websocket.Conn
 	send         chan []byte
 	subscribedTo map[string]bool
-	mu           sync.RWMutex
+	// logsFor holds the jobs the client wants job:log lines for
+	logsFor map[string]bool
+	mu      sync.RWMutex
 }
 
 func NewWebSocketHub() *WebSocketHub {
 	return &WebSocketHub{
 		clients:    make(map[*Client]bool),
 		broadcast:  make(chan []byte, 256),
+		logs:       make(chan JobLog, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 	}
@@ -102,6 +124,34 @@ func (h *WebSocketHub) Run() {
 				}
 			}
 			h.mu.RUnlock()
+
+		case line := <-h.logs:
+			h.deliverJobLog(line)
+		}
+	}
+}
+
+// deliverJobLog sends a log line to the clients that opted in to logs for
+// its job. Log lines are best effort: a client that can't keep up misses
+// lines rather than being disconnected.
+func (h *WebSocketHub) deliverJobLog(line JobLog) {
+	var msgBytes []byte
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		client.mu.RLock()
+		wanted := client.logsFor[line.JobID]
+		client.mu.RUnlock()
+		if !wanted {
+			continue
+		}
+		if msgBytes == nil {
+			data, _ := json.Marshal(line)
+			msgBytes, _ = json.Marshal(WSMessage{Type: "job:log", Data: data})
+		}
+		select {
+		case client.send <- msgBytes:
+		default:
 		}
 	}
 }
@@ -139,6 +189,16 @@ func (h *WebSocketHub) BroadcastJobError(jobError JobError) {
 	h.broadcast <- msgBytes
 }
 
+// BroadcastJobLog sends a worker log line to clients subscribed to the
+// job's logs. Lines are dropped when the hub is backed up so a chatty
+// worker never stalls job processing.
+func (h *WebSocketHub) BroadcastJobLog(line JobLog) {
+	select {
+	case h.logs <- line:
+	default:
+	}
+}
+
 // BroadcastDownloadProgress sends download progress
 func (h *WebSocketHub) BroadcastDownloadProgress(progress DownloadProgress) {
 	data, _ := json.Marshal(progress)
@@ -150,6 +210,68 @@ func (h *WebSocketHub) BroadcastDownloadProgress(progress DownloadProgress) {
 	h.broadcast <- msgBytes
 }
 
+// BroadcastGPUSamples sends a live GPU telemetry reading
+func (h *WebSocketHub) BroadcastGPUSamples(samples []gpu.Sample) {
+	data, _ := json.Marshal(samples)
+	msg := WSMessage{
+		Type: "system:gpu",
+		Data: data,
+	}
+	msgBytes, _ := json.Marshal(msg)
+	h.broadcast <- msgBytes
+}
+
+// PythonEnvUpdate is a line of Python environment bootstrap output along
+// with the bootstrap state
+type PythonEnvUpdate struct {
+	worker.EnvStatus
+	Line string `json:"line,omitempty"`
+}
+
+// BroadcastPythonEnv streams Python environment bootstrap progress
+func (h *WebSocketHub) BroadcastPythonEnv(update PythonEnvUpdate) {
+	data, _ := json.Marshal(update)
+	msg := WSMessage{
+		Type: "system:python_env",
+		Data: data,
+	}
+	msgBytes, _ := json.Marshal(msg)
+	h.broadcast <- msgBytes
+}
+
+// BroadcastMaintenance announces maintenance mode changes
+func (h *WebSocketHub) BroadcastMaintenance(status MaintenanceStatus) {
+	data, _ := json.Marshal(status)
+	msg := WSMessage{
+		Type: "system:maintenance",
+		Data: data,
+	}
+	msgBytes, _ := json.Marshal(msg)
+	h.broadcast <- msgBytes
+}
+
+// BroadcastDiskSpace warns that pending model downloads won't fit on disk
+func (h *WebSocketHub) BroadcastDiskSpace(report models.DiskSpaceReport) {
+	data, _ := json.Marshal(report)
+	msg := WSMessage{
+		Type: "system:disk_space",
+		Data: data,
+	}
+	msgBytes, _ := json.Marshal(msg)
+	h.broadcast <- msgBytes
+}
+
+// BroadcastAlert announces a low disk or VRAM alert firing or resolving
+func (h *WebSocketHub) BroadcastAlert(alert alerts.Alert) {
+	data, _ := json.Marshal(alert)
+	msg := WSMessage{
+		Type: "system:alert",
+		Data: data,
+	}
+	msgBytes, _ := json.Marshal(msg)
+	h.broadcast <- msgBytes
+}
+
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -162,6 +284,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		conn:         conn,
 		send:         make(chan []byte, 256),
 		subscribedTo: make(map[string]bool),
+		logsFor:      make(map[string]bool),
 	}
 
 	s.hub.register <- client
@@ -194,6 +317,9 @@ func (c *Client) readPump() {
 			c.mu.Lock()
 			for _, jobID := range sub.JobIDs {
 				c.subscribedTo[jobID] = true
+				if sub.Logs {
+					c.logsFor[jobID] = true
+				}
 			}
 			c.mu.Unlock()
 
@@ -203,6 +329,7 @@ func (c *Client) readPump() {
 			c.mu.Lock()
 			for _, jobID := range sub.JobIDs {
 				delete(c.subscribedTo, jobID)
+				delete(c.logsFor, jobID)
 			}
 			c.mu.Unlock()
 		}
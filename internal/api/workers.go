@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/auth"
+	"github.com/druarnfield/diffbox/internal/worker"
+	"github.com/go-chi/chi/v5"
+)
+
+// workerDebugTimeout bounds how long a debug command may take. It stays
+// under the router's request timeout so the caller gets a proper 504.
+const workerDebugTimeout = 45 * time.Second
+
+type WorkerDebugRequest struct {
+	Command string                 `json:"command"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+}
+
+func (s *Server) handleListWorkers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.workers.Workers())
+}
+
+func (s *Server) handleWorkerDebug(w http.ResponseWriter, r *http.Request) {
+	workerID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid worker ID")
+		return
+	}
+
+	var req WorkerDebugRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Command == "" {
+		apierr.Field(w, "command", "is required")
+		return
+	}
+
+	user := "unknown"
+	if u := auth.UserFromContext(r.Context()); u != nil {
+		user = u.Name
+	}
+	log.Printf("Worker debug: %s sent %q to worker %d", user, req.Command, workerID)
+
+	ctx, cancel := context.WithTimeout(r.Context(), workerDebugTimeout)
+	defer cancel()
+
+	resp, err := s.workers.Debug(ctx, workerID, req.Command, req.Args)
+	switch {
+	case errors.Is(err, worker.ErrNoWorker):
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeWorkerUnavailable, "Worker not found or not running")
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		apierr.Respond(w, http.StatusGatewayTimeout, apierr.CodeWorkerTimeout, "Worker did not answer in time")
+		return
+	case err != nil:
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handleUnloadWorker(w http.ResponseWriter, r *http.Request) {
+	workerID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid worker ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), workerDebugTimeout)
+	defer cancel()
+
+	resp, err := s.workers.Unload(ctx, workerID)
+	switch {
+	case errors.Is(err, worker.ErrNoWorker):
+		apierr.Respond(w, http.StatusNotFound, apierr.CodeWorkerUnavailable, "Worker not found or not running")
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		apierr.Respond(w, http.StatusGatewayTimeout, apierr.CodeWorkerTimeout, "Worker is busy, try again after the current job")
+		return
+	case err != nil:
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, err.Error())
+		return
+	}
+	if resp.Error != "" {
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, resp.Error)
+		return
+	}
+
+	log.Printf("Worker %d: models unloaded on request", workerID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -1,12 +1,29 @@
 package api
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"maps"
 	"net/http"
-
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/admission"
+	"github.com/druarnfield/diffbox/internal/apierr"
+	"github.com/druarnfield/diffbox/internal/auth"
+	"github.com/druarnfield/diffbox/internal/camera"
 	"github.com/druarnfield/diffbox/internal/db"
+	"github.com/druarnfield/diffbox/internal/models"
+	"github.com/druarnfield/diffbox/internal/resolution"
+	"github.com/druarnfield/diffbox/internal/tracing"
+	"github.com/druarnfield/diffbox/internal/upload"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // I2V Request
@@ -21,12 +38,26 @@ type I2VRequest struct {
 	NumInferenceSteps int      `json:"num_inference_steps"`
 	CFGScale          float64  `json:"cfg_scale"`
 	DenoisingStrength float64  `json:"denoising_strength"`
-	CameraDirection   string   `json:"camera_direction"`
+	CameraDirection   string   `json:"camera_direction"` // preset from /api/workflows/i2v/camera-motions
 	CameraSpeed       float64  `json:"camera_speed"`
 	MotionBucketID    *int     `json:"motion_bucket_id"`
 	LoRAs             []string `json:"loras"`
 	Tiled             bool     `json:"tiled"`
 	TileSize          []int    `json:"tile_size"`
+	// CameraPath is a keyframed camera motion, instead of a direction
+	CameraPath *camera.Path `json:"camera_path,omitempty"`
+	// CameraMotion is the path the worker renders, resolved by the server
+	// from the direction or path on every submission
+	CameraMotion *camera.Path `json:"camera_motion,omitempty"`
+	// SnapResolution replaces an unsupported width and height with the
+	// nearest preset instead of refusing the job
+	SnapResolution bool `json:"snap_resolution,omitempty"`
+	// Models overrides the file loaded by a workflow loader input, e.g.
+	// {"ckpt_name": "wan-i2v-high"}. Values may be aliases or filenames;
+	// keys must be one of the workflow's modelSlots.
+	Models map[string]string `json:"models,omitempty"`
+	// PromptID records the saved prompt the prompt text came from
+	PromptID string `json:"prompt_id,omitempty"`
 }
 
 // SVI Request
@@ -54,6 +85,12 @@ type QwenRequest struct {
 	ControlNet        string   `json:"controlnet"`
 	ControlNetScale   float64  `json:"controlnet_scale"`
 	LoRAs             []string `json:"loras"`
+	// SnapResolution snaps unsupported sizes, as for I2VRequest
+	SnapResolution bool `json:"snap_resolution,omitempty"`
+	// Models overrides loader inputs, as for I2VRequest
+	Models map[string]string `json:"models,omitempty"`
+	// PromptID records the saved prompt used, as for I2VRequest
+	PromptID string `json:"prompt_id,omitempty"`
 }
 
 // Chat Message
@@ -74,13 +111,33 @@ type ChatRequest struct {
 type JobResponse struct {
 	ID     string `json:"id"`
 	Status string `json:"status"`
+	// Warnings lists requested params the job was queued without
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// submitWarner is a request that can be queued with params the workers
+// can't act on yet, which the submit response flags
+type submitWarner interface {
+	submitWarnings() []string
+}
+
+// cameraUnsupported is the warning for camera motion, which is validated
+// and passed to the worker but not rendered until the bundled template
+// has a camera conditioning node
+const cameraUnsupported = "camera motion is not applied yet: the bundled template has no camera conditioning, so the clip renders without it"
+
+func (req I2VRequest) submitWarnings() []string {
+	if req.CameraMotion == nil {
+		return nil
+	}
+	return []string{cameraUnsupported}
 }
 
 func (s *Server) handleI2VSubmit(w http.ResponseWriter, r *http.Request) {
 	var req I2VRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("I2V: Failed to decode request: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
 		return
 	}
 
@@ -89,21 +146,29 @@ func (s *Server) handleI2VSubmit(w http.ResponseWriter, r *http.Request) {
 
 	// Validate input
 	if len(req.InputImage) > 14_000_000 {
-		http.Error(w, "Image too large (max 10MB)", http.StatusBadRequest)
+		apierr.Field(w, "input_image", "too large (max 10MB)")
 		return
 	}
 	if len(req.Prompt) > 500 {
-		http.Error(w, "Prompt too long (max 500 characters)", http.StatusBadRequest)
+		apierr.Field(w, "prompt", "too long (max 500 characters)")
 		return
 	}
-
-	// Set defaults
-	if req.Height == 0 {
-		req.Height = 480
+	if req.InputImage == "" {
+		apierr.Field(w, "input_image", "is required")
+		return
 	}
-	if req.Width == 0 {
-		req.Width = 832
+	inputImage, err := s.resolveImage(r.Context(), req.InputImage)
+	if err != nil {
+		apierr.Field(w, "input_image", err.Error())
+		return
 	}
+	req.InputImage = inputImage
+
+	if !checkResolution(w, "i2v", &req.Width, &req.Height, &req.SnapResolution) {
+		return
+	}
+
+	// Set defaults
 	if req.NumFrames == 0 {
 		req.NumFrames = 81
 	}
@@ -117,81 +182,59 @@ func (s *Server) handleI2VSubmit(w http.ResponseWriter, r *http.Request) {
 		req.DenoisingStrength = 1.0
 	}
 
-	// Create job
-	jobID := uuid.New().String()
-
-	// Persist job to database
-	paramsJSON, err := json.Marshal(req)
-	if err != nil {
-		log.Printf("I2V: Failed to serialize params for job %s: %v", jobID, err)
-		http.Error(w, "Failed to serialize params", http.StatusInternalServerError)
+	if !checkCamera(w, &req) {
 		return
 	}
 
-	dbJob := &db.Job{
-		ID:     jobID,
-		Type:   "i2v",
-		Status: "pending",
-		Params: string(paramsJSON),
-	}
-	if err := s.db.CreateJob(dbJob); err != nil {
-		log.Printf("I2V: Failed to persist job %s: %v", jobID, err)
-		http.Error(w, "Failed to create job", http.StatusInternalServerError)
+	if !s.resolveModelRefs(w, "i2v", &req.LoRAs, &req.Models) {
 		return
 	}
 
-	// Queue job
-	job := map[string]interface{}{
-		"id":     jobID,
-		"type":   "i2v",
-		"params": req,
-		"status": "pending",
-	}
-
-	if err := s.queue.Enqueue("jobs", job); err != nil {
-		log.Printf("I2V: Failed to enqueue job %s: %v", jobID, err)
-		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
+	if !s.usePrompt(w, r, req.PromptID) {
 		return
 	}
 
-	log.Printf("I2V: Job %s queued successfully", jobID)
-	// Return job ID
-	json.NewEncoder(w).Encode(JobResponse{
-		ID:     jobID,
-		Status: "pending",
-	})
+	s.submitJob(w, r, "i2v", "I2V", req)
 }
 
 func (s *Server) handleSVISubmit(w http.ResponseWriter, r *http.Request) {
 	var req SVIRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
 		return
 	}
 
 	// Validate input
 	if len(req.InputImage) > 14_000_000 {
-		http.Error(w, "Image too large (max 10MB)", http.StatusBadRequest)
+		apierr.Field(w, "input_image", "too large (max 10MB)")
 		return
 	}
 	if len(req.Prompt) > 500 {
-		http.Error(w, "Prompt too long (max 500 characters)", http.StatusBadRequest)
+		apierr.Field(w, "prompt", "too long (max 500 characters)")
+		return
+	}
+	if req.InputImage == "" {
+		apierr.Field(w, "input_image", "is required")
 		return
 	}
+	inputImage, err := s.resolveImage(r.Context(), req.InputImage)
+	if err != nil {
+		apierr.Field(w, "input_image", err.Error())
+		return
+	}
+	req.InputImage = inputImage
 	for _, prompt := range req.Prompts {
 		if len(prompt) > 500 {
-			http.Error(w, "Prompt too long (max 500 characters)", http.StatusBadRequest)
+			apierr.Field(w, "prompts", "each prompt must be at most 500 characters")
 			return
 		}
 	}
 
-	// Set defaults
-	if req.Height == 0 {
-		req.Height = 480
-	}
-	if req.Width == 0 {
-		req.Width = 832
+	if !checkResolution(w, "svi", &req.Width, &req.Height, &req.SnapResolution) {
+		return
 	}
+
+	// Set defaults
 	if req.NumFrames == 0 {
 		req.NumFrames = 81
 	}
@@ -208,76 +251,59 @@ func (s *Server) handleSVISubmit(w http.ResponseWriter, r *http.Request) {
 		req.NumMotionFrames = 5
 	}
 
-	// Create job
-	jobID := uuid.New().String()
-
-	// Persist job to database
-	paramsJSON, err := json.Marshal(req)
-	if err != nil {
-		log.Printf("SVI: Failed to serialize params for job %s: %v", jobID, err)
-		http.Error(w, "Failed to serialize params", http.StatusInternalServerError)
+	if !checkCamera(w, &req.I2VRequest) {
 		return
 	}
 
-	dbJob := &db.Job{
-		ID:     jobID,
-		Type:   "svi",
-		Status: "pending",
-		Params: string(paramsJSON),
-	}
-	if err := s.db.CreateJob(dbJob); err != nil {
-		log.Printf("SVI: Failed to persist job %s: %v", jobID, err)
-		http.Error(w, "Failed to create job", http.StatusInternalServerError)
+	if !s.resolveModelRefs(w, "svi", &req.LoRAs, &req.Models) {
 		return
 	}
 
-	// Queue job
-	job := map[string]interface{}{
-		"id":     jobID,
-		"type":   "svi",
-		"params": req,
-		"status": "pending",
-	}
-
-	if err := s.queue.Enqueue("jobs", job); err != nil {
-		log.Printf("SVI: Failed to enqueue job %s: %v", jobID, err)
-		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
+	if !s.usePrompt(w, r, req.PromptID) {
 		return
 	}
 
-	log.Printf("SVI: Job %s queued successfully", jobID)
-	json.NewEncoder(w).Encode(JobResponse{
-		ID:     jobID,
-		Status: "pending",
-	})
+	s.submitJob(w, r, "svi", "SVI", req)
 }
 
 func (s *Server) handleQwenSubmit(w http.ResponseWriter, r *http.Request) {
 	var req QwenRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
 		return
 	}
 
 	// Validate input
-	for _, img := range req.EditImages {
+	for i, img := range req.EditImages {
 		if len(img) > 14_000_000 {
-			http.Error(w, "Image too large (max 10MB)", http.StatusBadRequest)
+			apierr.Field(w, fmt.Sprintf("edit_images[%d]", i), "too large (max 10MB)")
 			return
 		}
+		normalized, err := s.resolveImage(r.Context(), img)
+		if err != nil {
+			apierr.Field(w, fmt.Sprintf("edit_images[%d]", i), err.Error())
+			return
+		}
+		req.EditImages[i] = normalized
+	}
+	if req.InpaintMask != "" {
+		mask, err := s.resolveImage(r.Context(), req.InpaintMask)
+		if err != nil {
+			apierr.Field(w, "inpaint_mask", err.Error())
+			return
+		}
+		req.InpaintMask = mask
 	}
 	if len(req.Prompt) > 500 {
-		http.Error(w, "Prompt too long (max 500 characters)", http.StatusBadRequest)
+		apierr.Field(w, "prompt", "too long (max 500 characters)")
 		return
 	}
 
-	// Set defaults
-	if req.Height == 0 {
-		req.Height = 1024
-	}
-	if req.Width == 0 {
-		req.Width = 1024
+	if !checkResolution(w, "qwen", &req.Width, &req.Height, &req.SnapResolution) {
+		return
 	}
+
+	// Set defaults
 	if req.NumInferenceSteps == 0 {
 		req.NumInferenceSteps = 4
 	}
@@ -291,71 +317,38 @@ func (s *Server) handleQwenSubmit(w http.ResponseWriter, r *http.Request) {
 		req.Mode = "generate"
 	}
 
-	// Create job
-	jobID := uuid.New().String()
-
-	// Persist job to database
-	paramsJSON, err := json.Marshal(req)
-	if err != nil {
-		log.Printf("Qwen: Failed to serialize params for job %s: %v", jobID, err)
-		http.Error(w, "Failed to serialize params", http.StatusInternalServerError)
-		return
-	}
-
-	dbJob := &db.Job{
-		ID:     jobID,
-		Type:   "qwen",
-		Status: "pending",
-		Params: string(paramsJSON),
-	}
-	if err := s.db.CreateJob(dbJob); err != nil {
-		log.Printf("Qwen: Failed to persist job %s: %v", jobID, err)
-		http.Error(w, "Failed to create job", http.StatusInternalServerError)
+	if !s.resolveModelRefs(w, "qwen", &req.LoRAs, &req.Models) {
 		return
 	}
 
-	// Queue job
-	job := map[string]interface{}{
-		"id":     jobID,
-		"type":   "qwen",
-		"params": req,
-		"status": "pending",
-	}
-
-	if err := s.queue.Enqueue("jobs", job); err != nil {
-		log.Printf("Qwen: Failed to enqueue job %s: %v", jobID, err)
-		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
+	if !s.usePrompt(w, r, req.PromptID) {
 		return
 	}
 
-	log.Printf("Qwen: Job %s queued successfully", jobID)
-	json.NewEncoder(w).Encode(JobResponse{
-		ID:     jobID,
-		Status: "pending",
-	})
+	s.submitJob(w, r, "qwen", "Qwen", req)
 }
 
 func (s *Server) handleChatSubmit(w http.ResponseWriter, r *http.Request) {
 	var req ChatRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeInvalidRequest, "Invalid request body")
 		return
 	}
 
 	// Validate input
 	if len(req.Messages) == 0 {
-		http.Error(w, "No messages provided", http.StatusBadRequest)
+		apierr.Field(w, "messages", "at least one message is required")
 		return
 	}
 
 	// Validate each message
-	for _, msg := range req.Messages {
+	for i, msg := range req.Messages {
 		if msg.Role != "user" && msg.Role != "assistant" && msg.Role != "system" {
-			http.Error(w, "Invalid message role (must be user, assistant, or system)", http.StatusBadRequest)
+			apierr.Field(w, fmt.Sprintf("messages[%d].role", i), "must be user, assistant, or system")
 			return
 		}
 		if len(msg.Content) > 4000 {
-			http.Error(w, "Message content too long (max 4000 characters)", http.StatusBadRequest)
+			apierr.Field(w, fmt.Sprintf("messages[%d].content", i), "too long (max 4000 characters)")
 			return
 		}
 	}
@@ -388,46 +381,221 @@ func (s *Server) handleChatSubmit(w http.ResponseWriter, r *http.Request) {
 		req.TopP = 1.0
 	}
 
-	// Create job
+	s.submitJob(w, r, "chat", "Chat", req)
+}
+
+// checkResolution fills in the workflow's default size when none was
+// given, and the other side when only one was, then checks the size
+// against the workflow's catalog. With
+// snap set, an unsupported size is replaced by the nearest preset and the
+// flag cleared, so the stored params record what actually ran. It writes a
+// 400 and returns false for an unsupported size otherwise.
+func checkResolution(w http.ResponseWriter, jobType string, width, height *int, snap *bool) bool {
+	catalog, ok := resolution.For(jobType)
+	if !ok {
+		return true
+	}
+	if *width == 0 && *height == 0 {
+		*width, *height = catalog.Default.Width, catalog.Default.Height
+		return true
+	}
+	*width, *height = catalog.Complete(*width, *height)
+	if catalog.Valid(*width, *height) {
+		*snap = false
+		return true
+	}
+	if *snap {
+		nearest := catalog.Nearest(*width, *height)
+		log.Printf("%s: Snapped %dx%d to %s", jobType, *width, *height, nearest)
+		*width, *height, *snap = nearest.Width, nearest.Height, false
+		return true
+	}
+
+	message := fmt.Sprintf("%dx%d is not a supported %s resolution; pick one from /api/workflows/%s/resolutions or set snap_resolution",
+		*width, *height, jobType, jobType)
+	apierr.Write(w, http.StatusBadRequest, &apierr.Error{
+		Code:        apierr.CodeValidationFailed,
+		Message:     message,
+		FieldErrors: map[string]string{"width": message, "height": message},
+	})
+	return false
+}
+
+// checkCamera resolves the camera fields of a Wan request into the path
+// the worker renders, writing a 400 and returning false if they're invalid
+func checkCamera(w http.ResponseWriter, req *I2VRequest) bool {
+	path, err := camera.Resolve(req.CameraDirection, req.CameraSpeed, req.CameraPath, req.NumFrames)
+	var fe *camera.FieldError
+	if errors.As(err, &fe) {
+		apierr.Field(w, fe.Field, fe.Message)
+		return false
+	}
+	if err != nil {
+		apierr.Respond(w, http.StatusBadRequest, apierr.CodeValidationFailed, err.Error())
+		return false
+	}
+	req.CameraMotion = path
+	return true
+}
+
+// normalizeImage validates a base64 image field and returns it as plain
+// base64, stripping any data: URL prefix the worker wouldn't understand.
+// Submissions go through resolveImage, which also accepts library and
+// output refs.
+func normalizeImage(encoded string) (string, error) {
+	info, err := upload.DecodeBase64Image(encoded)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(encoded, "data:") {
+		return base64.StdEncoding.EncodeToString(info.Data), nil
+	}
+	return encoded, nil
+}
+
+// modelSlots are the loader inputs each built-in workflow's template reads
+// a model file from. An override naming any other input would match no
+// node and be ignored by the worker, so it is refused instead.
+var modelSlots = map[string][]string{
+	"i2v":  {"ckpt_name"},
+	"svi":  {"ckpt_name"},
+	"qwen": {"ckpt_name"},
+}
+
+// resolveModelRefs swaps model aliases in a request for filenames, so the
+// stored params record exactly which files the job used. It writes a 400
+// and returns false for an unknown alias or a loader input the job type's
+// workflow doesn't have.
+func (s *Server) resolveModelRefs(w http.ResponseWriter, jobType string, loras *[]string, slots *map[string]string) bool {
+	for _, slot := range slices.Sorted(maps.Keys(*slots)) {
+		if !slices.Contains(modelSlots[jobType], slot) {
+			apierr.Field(w, "models", fmt.Sprintf("%s has no loader input %q (overridable: %s)",
+				jobType, slot, strings.Join(modelSlots[jobType], ", ")))
+			return false
+		}
+	}
+	files, err := s.aliases.ResolveAll(*loras)
+	if err != nil {
+		modelMissing(w, "loras", err)
+		return false
+	}
+	resolved, err := s.aliases.ResolveMap(*slots)
+	if err != nil {
+		modelMissing(w, "models", err)
+		return false
+	}
+	*loras, *slots = files, resolved
+	return true
+}
+
+// modelMissing writes a 400 for a request field naming a model diffbox
+// doesn't know about
+func modelMissing(w http.ResponseWriter, field string, err error) {
+	apierr.Write(w, http.StatusBadRequest, &apierr.Error{
+		Code:        apierr.CodeModelMissing,
+		Message:     field + ": " + err.Error(),
+		FieldErrors: map[string]string{field: err.Error()},
+	})
+}
+
+// enqueueTimeout bounds handing a job to the queue
+const enqueueTimeout = 5 * time.Second
+
+// submitJob persists a validated job and queues it for the workers. The
+// trace context travels with the queued job so dispatch and execution
+// spans join the submission trace.
+func (s *Server) submitJob(w http.ResponseWriter, r *http.Request, jobType, logPrefix string, params interface{}) {
 	jobID := uuid.New().String()
 
+	ctx, span := tracing.Start(r.Context(), "job.submit",
+		tracing.JobIDKey.String(jobID),
+		attribute.String("job.type", jobType),
+	)
+	defer span.End()
+
 	// Persist job to database
-	paramsJSON, err := json.Marshal(req)
+	paramsJSON, err := json.Marshal(params)
 	if err != nil {
-		log.Printf("Chat: Failed to serialize params for job %s: %v", jobID, err)
-		http.Error(w, "Failed to serialize params", http.StatusInternalServerError)
+		log.Printf("%s: Failed to serialize params for job %s: %v", logPrefix, jobID, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to serialize params")
 		return
 	}
 
-	dbJob := &db.Job{
-		ID:     jobID,
-		Type:   "chat",
-		Status: "pending",
-		Params: string(paramsJSON),
+	if workflow := models.WorkflowForJobType(jobType); !models.WorkflowEnabled(workflow) {
+		apierr.Respond(w, http.StatusConflict, apierr.CodeConflict, "The "+workflow+" workflow is disabled in setup")
+		return
 	}
-	if err := s.db.CreateJob(dbJob); err != nil {
-		log.Printf("Chat: Failed to persist job %s: %v", jobID, err)
-		http.Error(w, "Failed to create job", http.StatusInternalServerError)
+
+	sessionID, ok := s.jobSession(w, r)
+	if !ok {
 		return
 	}
 
-	// Queue job
-	job := map[string]interface{}{
-		"id":     jobID,
-		"type":   "chat",
-		"params": req,
-		"status": "pending",
+	var userID string
+	if user := auth.UserFromContext(ctx); user != nil {
+		userID = user.ID
+	}
+	if !s.admit(w, r, admission.ParseJob(jobType, userID, string(paramsJSON)), logPrefix) {
+		return
 	}
 
-	if err := s.queue.Enqueue("jobs", job); err != nil {
-		log.Printf("Chat: Failed to enqueue job %s: %v", jobID, err)
-		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
+	stored, used := s.storeInputs(ctx, jobID, jobType, paramsJSON)
+	dbJob := &db.Job{
+		ID:        jobID,
+		Type:      jobType,
+		Status:    "pending",
+		Params:    string(stored),
+		UserID:    userID,
+		SessionID: sessionID,
+	}
+	if err := s.db.CreateJob(ctx, dbJob); err != nil {
+		log.Printf("%s: Failed to persist job %s: %v", logPrefix, jobID, err)
+		apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to create job")
 		return
 	}
+	if len(used) > 0 {
+		if err := s.db.RecordJobInputs(ctx, used); err != nil {
+			log.Printf("Inputs: Failed to record inputs of job %s: %v", jobID, err)
+		}
+	}
+	s.recordUploads(ctx, jobID, paramsJSON)
 
-	log.Printf("Chat: Job %s queued successfully", jobID)
-	json.NewEncoder(w).Encode(JobResponse{
+	// Queue job
+	job := map[string]interface{}{
+		"id":          jobID,
+		"type":        jobType,
+		"params":      params,
+		"status":      "pending",
+		"trace":       tracing.Inject(ctx),
+		"enqueued_at": time.Now().UnixMilli(),
+	}
+
+	// A client that hangs up before this point gets nothing queued
+	enqueueCtx, cancel := context.WithTimeout(ctx, enqueueTimeout)
+	enqueueCtx, enqueueSpan := tracing.Start(enqueueCtx, "queue.enqueue", tracing.JobIDKey.String(jobID))
+	err = s.queue.Enqueue(enqueueCtx, "jobs", job)
+	tracing.End(enqueueSpan, err)
+	cancel()
+	if err != nil {
+		log.Printf("%s: Failed to enqueue job %s: %v", logPrefix, jobID, err)
+		// Don't leave a pending job no worker will ever see
+		if err := s.db.FailJob(context.WithoutCancel(ctx), jobID, "Failed to queue job: "+err.Error()); err != nil {
+			log.Printf("%s: Failed to mark job %s failed: %v", logPrefix, jobID, err)
+		}
+		jobError(w, http.StatusInternalServerError, apierr.CodeInternal, jobID, "Failed to queue job")
+		return
+	}
+
+	// If models are still downloading, fetch this workflow's first
+	s.downloader.Prioritize(jobType)
+
+	resp := JobResponse{
 		ID:     jobID,
 		Status: "pending",
-	})
+	}
+	if warner, ok := params.(submitWarner); ok {
+		resp.Warnings = warner.submitWarnings()
+	}
+	log.Printf("%s: Job %s queued successfully", logPrefix, jobID)
+	json.NewEncoder(w).Encode(resp)
 }
@@ -0,0 +1,80 @@
+// Package apierr defines the JSON error envelope every API endpoint
+// returns, so clients can branch on a stable code instead of parsing
+// message text.
+package apierr
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Code identifies a class of error. Codes are part of the API contract:
+// add new ones freely but never rename or reuse them.
+type Code string
+
+// Stable error codes
+const (
+	CodeInvalidRequest    Code = "INVALID_REQUEST"
+	CodeValidationFailed  Code = "VALIDATION_FAILED"
+	CodeNotFound          Code = "NOT_FOUND"
+	CodeMethodNotAllowed  Code = "METHOD_NOT_ALLOWED"
+	CodeConflict          Code = "CONFLICT"
+	CodeModelMissing      Code = "MODEL_MISSING"
+	CodeQueueFull         Code = "QUEUE_FULL"
+	CodeQuotaExceeded     Code = "QUOTA_EXCEEDED"
+	CodeInsufficientVRAM  Code = "INSUFFICIENT_VRAM"
+	CodeInsufficientDisk  Code = "INSUFFICIENT_DISK"
+	CodeMaintenance       Code = "MAINTENANCE"
+	CodeShuttingDown      Code = "SHUTTING_DOWN"
+	CodeWorkerUnavailable Code = "WORKER_UNAVAILABLE"
+	CodeWorkerTimeout     Code = "WORKER_TIMEOUT"
+	CodeFFmpegMissing     Code = "FFMPEG_MISSING"
+	CodeUnauthorized      Code = "UNAUTHORIZED"
+	CodeForbidden         Code = "FORBIDDEN"
+	CodeRateLimited       Code = "RATE_LIMITED"
+	CodeTimeout           Code = "TIMEOUT"
+	CodeInternal          Code = "INTERNAL"
+)
+
+// Error is the body of every non-2xx API response
+type Error struct {
+	Code        Code              `json:"code"`
+	Message     string            `json:"message"`
+	FieldErrors map[string]string `json:"field_errors,omitempty"`
+	JobID       string            `json:"job_id,omitempty"`
+	Resource    *Resource         `json:"resource,omitempty"`
+}
+
+// Resource details a request refused because a resource was short
+type Resource struct {
+	Name      string `json:"name"`
+	Required  int64  `json:"required"`
+	Available int64  `json:"available"`
+	Unit      string `json:"unit"`
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Write sends e as the response with the given status
+func Write(w http.ResponseWriter, status int, e *Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// Respond writes an error with just a code and message
+func Respond(w http.ResponseWriter, status int, code Code, message string) {
+	Write(w, status, &Error{Code: code, Message: message})
+}
+
+// Field writes a 400 VALIDATION_FAILED error for a single request field
+func Field(w http.ResponseWriter, field, message string) {
+	Write(w, http.StatusBadRequest, &Error{
+		Code:        CodeValidationFailed,
+		Message:     field + ": " + message,
+		FieldErrors: map[string]string{field: message},
+	})
+}
@@ -0,0 +1,53 @@
+package apierr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestField(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Field(rec, "prompt", "too long (max 500 characters)")
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var e Error
+	if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Code != CodeValidationFailed {
+		t.Errorf("code = %q, want %q", e.Code, CodeValidationFailed)
+	}
+	if e.FieldErrors["prompt"] != "too long (max 500 characters)" {
+		t.Errorf("field_errors = %v", e.FieldErrors)
+	}
+	if e.Message != "prompt: too long (max 500 characters)" {
+		t.Errorf("message = %q", e.Message)
+	}
+}
+
+func TestRespondOmitsEmptyFields(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Respond(rec, http.StatusNotFound, CodeNotFound, "Job not found")
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["field_errors"]; ok {
+		t.Error("field_errors should be omitted when empty")
+	}
+	if _, ok := body["job_id"]; ok {
+		t.Error("job_id should be omitted when empty")
+	}
+	if body["code"] != string(CodeNotFound) {
+		t.Errorf("code = %v", body["code"])
+	}
+}
@@ -2,6 +2,7 @@ package aria2
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +11,21 @@ import (
 	"time"
 )
 
+// RPC is the part of the aria2 JSON-RPC API diffbox uses. Client talks to
+// a real aria2c; Fake downloads in-process for test mode.
+type RPC interface {
+	AddURI(ctx context.Context, url string, dir string, filename string, headers map[string]string) (string, error)
+	AddURIs(ctx context.Context, urls []string, dir string, filename string, headers map[string]string) (string, error)
+	TellStatus(ctx context.Context, gid string) (*DownloadStatus, error)
+	TellActive(ctx context.Context) ([]DownloadStatus, error)
+	TellWaiting(ctx context.Context, offset, num int) ([]DownloadStatus, error)
+	Pause(ctx context.Context, gid string) error
+	Unpause(ctx context.Context, gid string) error
+	ChangePosition(ctx context.Context, gid string, pos int, how string) (int, error)
+	Remove(ctx context.Context, gid string) error
+	GetVersion(ctx context.Context) (string, error)
+}
+
 type Client struct {
 	url        string
 	secret     string
@@ -36,9 +52,17 @@ type RPCError struct {
 }
 
 type DownloadFile struct {
-	Path            string `json:"path"`
-	Length          string `json:"length"`
-	CompletedLength string `json:"completedLength"`
+	Path            string        `json:"path"`
+	Length          string        `json:"length"`
+	CompletedLength string        `json:"completedLength"`
+	URIs            []DownloadURI `json:"uris"`
+}
+
+// DownloadURI is one source of a file. Status is "used" once aria2 has
+// fetched from it and "waiting" otherwise.
+type DownloadURI struct {
+	URI    string `json:"uri"`
+	Status string `json:"status"`
 }
 
 type DownloadStatus struct {
@@ -62,7 +86,9 @@ func NewClient(host string, port int, secret string) *Client {
 	}
 }
 
-func (c *Client) call(method string, params ...interface{}) (json.RawMessage, error) {
+// call makes one RPC. It gives up when ctx is done or after the client's own
+// 30 second timeout, whichever comes first.
+func (c *Client) call(ctx context.Context, method string, params ...interface{}) (json.RawMessage, error) {
 	id := fmt.Sprintf("%d", atomic.AddUint64(&c.counter, 1))
 
 	// Ensure params is always an array (aria2 requires array, not null)
@@ -87,7 +113,13 @@ func (c *Client) call(method string, params ...interface{}) (json.RawMessage, er
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	resp, err := c.httpClient.Post(c.url, "application/json", bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("http post: %w", err)
 	}
@@ -112,7 +144,13 @@ func (c *Client) call(method string, params ...interface{}) (json.RawMessage, er
 }
 
 // AddURI adds a download by URL, returns GID
-func (c *Client) AddURI(url string, dir string, filename string, headers map[string]string) (string, error) {
+func (c *Client) AddURI(ctx context.Context, url string, dir string, filename string, headers map[string]string) (string, error) {
+	return c.AddURIs(ctx, []string{url}, dir, filename, headers)
+}
+
+// AddURIs adds a download with several sources for the same file, which
+// aria2 splits the transfer across. Returns the GID.
+func (c *Client) AddURIs(ctx context.Context, urls []string, dir string, filename string, headers map[string]string) (string, error) {
 	options := map[string]interface{}{
 		"dir": dir,
 		"out": filename,
@@ -126,7 +164,7 @@ func (c *Client) AddURI(url string, dir string, filename string, headers map[str
 		options["header"] = headerList
 	}
 
-	result, err := c.call("aria2.addUri", []string{url}, options)
+	result, err := c.call(ctx, "aria2.addUri", urls, options)
 	if err != nil {
 		return "", err
 	}
@@ -140,8 +178,8 @@ func (c *Client) AddURI(url string, dir string, filename string, headers map[str
 }
 
 // TellStatus gets download status by GID
-func (c *Client) TellStatus(gid string) (*DownloadStatus, error) {
-	result, err := c.call("aria2.tellStatus", gid)
+func (c *Client) TellStatus(ctx context.Context, gid string) (*DownloadStatus, error) {
+	result, err := c.call(ctx, "aria2.tellStatus", gid)
 	if err != nil {
 		return nil, err
 	}
@@ -155,8 +193,24 @@ func (c *Client) TellStatus(gid string) (*DownloadStatus, error) {
 }
 
 // TellActive gets all active downloads
-func (c *Client) TellActive() ([]DownloadStatus, error) {
-	result, err := c.call("aria2.tellActive")
+func (c *Client) TellActive(ctx context.Context) ([]DownloadStatus, error) {
+	result, err := c.call(ctx, "aria2.tellActive")
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []DownloadStatus
+	if err := json.Unmarshal(result, &statuses); err != nil {
+		return nil, fmt.Errorf("unmarshal statuses: %w", err)
+	}
+
+	return statuses, nil
+}
+
+// TellWaiting gets up to num waiting and paused downloads, starting at
+// offset in the queue
+func (c *Client) TellWaiting(ctx context.Context, offset, num int) ([]DownloadStatus, error) {
+	result, err := c.call(ctx, "aria2.tellWaiting", offset, num)
 	if err != nil {
 		return nil, err
 	}
@@ -170,20 +224,42 @@ func (c *Client) TellActive() ([]DownloadStatus, error) {
 }
 
 // Pause pauses a download
-func (c *Client) Pause(gid string) error {
-	_, err := c.call("aria2.pause", gid)
+func (c *Client) Pause(ctx context.Context, gid string) error {
+	_, err := c.call(ctx, "aria2.pause", gid)
+	return err
+}
+
+// Unpause resumes a paused download
+func (c *Client) Unpause(ctx context.Context, gid string) error {
+	_, err := c.call(ctx, "aria2.unpause", gid)
 	return err
 }
 
+// ChangePosition moves a download in the waiting queue. how is one of
+// POS_SET, POS_CUR or POS_END; the new position is returned.
+func (c *Client) ChangePosition(ctx context.Context, gid string, pos int, how string) (int, error) {
+	result, err := c.call(ctx, "aria2.changePosition", gid, pos, how)
+	if err != nil {
+		return 0, err
+	}
+
+	var newPos int
+	if err := json.Unmarshal(result, &newPos); err != nil {
+		return 0, fmt.Errorf("unmarshal position: %w", err)
+	}
+
+	return newPos, nil
+}
+
 // Remove removes a download
-func (c *Client) Remove(gid string) error {
-	_, err := c.call("aria2.remove", gid)
+func (c *Client) Remove(ctx context.Context, gid string) error {
+	_, err := c.call(ctx, "aria2.remove", gid)
 	return err
 }
 
 // GetVersion checks aria2 is running
-func (c *Client) GetVersion() (string, error) {
-	result, err := c.call("aria2.getVersion")
+func (c *Client) GetVersion(ctx context.Context) (string, error) {
+	result, err := c.call(ctx, "aria2.getVersion")
 	if err != nil {
 		return "", err
 	}
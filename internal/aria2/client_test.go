@@ -1,10 +1,13 @@
 package aria2
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestNewClient(t *testing.T) {
@@ -51,7 +54,7 @@ func TestClientGetVersion(t *testing.T) {
 		httpClient: server.Client(),
 	}
 
-	version, err := client.GetVersion()
+	version, err := client.GetVersion(context.Background())
 	if err != nil {
 		t.Fatalf("GetVersion failed: %v", err)
 	}
@@ -92,7 +95,7 @@ func TestClientAddURI(t *testing.T) {
 		httpClient: server.Client(),
 	}
 
-	gid, err := client.AddURI("https://example.com/file.bin", "/downloads", "file.bin", nil)
+	gid, err := client.AddURI(context.Background(), "https://example.com/file.bin", "/downloads", "file.bin", nil)
 	if err != nil {
 		t.Fatalf("AddURI failed: %v", err)
 	}
@@ -102,6 +105,35 @@ func TestClientAddURI(t *testing.T) {
 	}
 }
 
+func TestClientAddURIs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+
+		// Every mirror goes in the one URI list, so aria2 treats them as
+		// sources for the same file
+		uris, ok := req.Params[0].([]interface{})
+		if !ok || len(uris) != 2 || uris[1] != "https://mirror.example.com/file.bin" {
+			t.Errorf("expected both URIs in the first param, got %v", req.Params[0])
+		}
+
+		json.NewEncoder(w).Encode(Response{ID: req.ID, Result: json.RawMessage(`"abc123"`)})
+	}))
+	defer server.Close()
+
+	client := &Client{
+		url:        server.URL,
+		httpClient: server.Client(),
+	}
+
+	_, err := client.AddURIs(context.Background(), []string{"https://example.com/file.bin", "https://mirror.example.com/file.bin"}, "/downloads", "file.bin", nil)
+	if err != nil {
+		t.Fatalf("AddURIs failed: %v", err)
+	}
+}
+
 func TestClientTellStatus(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var req Request
@@ -128,7 +160,7 @@ func TestClientTellStatus(t *testing.T) {
 		httpClient: server.Client(),
 	}
 
-	status, err := client.TellStatus("abc123")
+	status, err := client.TellStatus(context.Background(), "abc123")
 	if err != nil {
 		t.Fatalf("TellStatus failed: %v", err)
 	}
@@ -165,7 +197,7 @@ func TestClientRPCError(t *testing.T) {
 		httpClient: server.Client(),
 	}
 
-	_, err := client.GetVersion()
+	_, err := client.GetVersion(context.Background())
 	if err == nil {
 		t.Error("expected error, got nil")
 	}
@@ -216,8 +248,104 @@ func TestParamsAlwaysArray(t *testing.T) {
 	}
 
 	// Call GetVersion which takes no params - this is where the bug would occur
-	_, err := client.GetVersion()
+	_, err := client.GetVersion(context.Background())
 	if err != nil {
 		t.Fatalf("GetVersion failed: %v", err)
 	}
 }
+
+func TestClientChangePosition(t *testing.T) {
+	var got Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+
+		response := Response{
+			ID:     got.ID,
+			Result: json.RawMessage(`0`),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	client := &Client{
+		url:        server.URL,
+		httpClient: server.Client(),
+	}
+
+	pos, err := client.ChangePosition(context.Background(), "abc123", 0, "POS_SET")
+	if err != nil {
+		t.Fatalf("ChangePosition failed: %v", err)
+	}
+
+	if pos != 0 {
+		t.Errorf("expected position 0, got %d", pos)
+	}
+
+	if got.Method != "aria2.changePosition" || len(got.Params) != 3 {
+		t.Errorf("unexpected request: %+v", got)
+	}
+}
+
+func TestClientTellWaiting(t *testing.T) {
+	var got Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+
+		response := Response{
+			ID:     got.ID,
+			Result: json.RawMessage(`[{"gid": "2089b05ecca3d829", "status": "paused", "files": [{"path": "/models/vae.safetensors"}]}]`),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	client := &Client{
+		url:        server.URL,
+		httpClient: server.Client(),
+	}
+
+	statuses, err := client.TellWaiting(context.Background(), 0, 100)
+	if err != nil {
+		t.Fatalf("TellWaiting failed: %v", err)
+	}
+
+	if len(statuses) != 1 || statuses[0].Status != "paused" || statuses[0].Files[0].Path != "/models/vae.safetensors" {
+		t.Errorf("unexpected statuses: %+v", statuses)
+	}
+
+	if got.Method != "aria2.tellWaiting" || len(got.Params) != 2 {
+		t.Errorf("unexpected request: %+v", got)
+	}
+}
+
+func TestClientContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := &Client{
+		url:        server.URL,
+		httpClient: server.Client(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.TellStatus(ctx, "abc123")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("call took %v after its deadline", elapsed)
+	}
+}
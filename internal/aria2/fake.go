@@ -0,0 +1,324 @@
+package aria2
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Fake is an in-process stand-in for the aria2 daemon. It fetches each
+// file over plain HTTP with one connection, trying the sources in order,
+// and reports status the way aria2 does, so the downloader runs unchanged
+// without aria2c. Paused downloads start over when resumed.
+type Fake struct {
+	client  *http.Client
+	counter uint64
+
+	mu        sync.Mutex
+	downloads map[string]*fakeDownload
+}
+
+type fakeDownload struct {
+	urls     []string
+	path     string
+	headers  map[string]string
+	status   DownloadStatus
+	uris     []DownloadURI
+	run      int // bumped on every start, so a stale fetch can't report
+	cancel   context.CancelFunc
+	received atomic.Int64
+}
+
+var _ RPC = (*Fake)(nil)
+
+// NewFake returns a Fake downloading with client, or http.DefaultClient
+// if nil
+func NewFake(client *http.Client) *Fake {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Fake{client: client, downloads: make(map[string]*fakeDownload)}
+}
+
+func (f *Fake) AddURI(ctx context.Context, url string, dir string, filename string, headers map[string]string) (string, error) {
+	return f.AddURIs(ctx, []string{url}, dir, filename, headers)
+}
+
+func (f *Fake) AddURIs(ctx context.Context, urls []string, dir string, filename string, headers map[string]string) (string, error) {
+	if len(urls) == 0 {
+		return "", fmt.Errorf("rpc error 1: no URI to download")
+	}
+	gid := fmt.Sprintf("%016x", atomic.AddUint64(&f.counter, 1))
+	dl := &fakeDownload{
+		urls:    urls,
+		path:    filepath.Join(dir, filename),
+		headers: headers,
+	}
+	for _, u := range urls {
+		dl.uris = append(dl.uris, DownloadURI{URI: u, Status: "waiting"})
+	}
+	dl.status = DownloadStatus{GID: gid}
+
+	if err := f.lock(ctx); err != nil {
+		return "", err
+	}
+	f.downloads[gid] = dl
+	f.start(dl)
+	f.mu.Unlock()
+	return gid, nil
+}
+
+// start begins fetching dl; callers hold mu
+func (f *Fake) start(dl *fakeDownload) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dl.run++
+	dl.cancel = cancel
+	dl.status.Status = "active"
+	dl.received.Store(0)
+	go f.fetch(ctx, dl, dl.run)
+}
+
+// fetch downloads dl from the first source that answers
+func (f *Fake) fetch(ctx context.Context, dl *fakeDownload, run int) {
+	var lastErr error
+	for i, u := range dl.urls {
+		total, err := f.fetchURL(ctx, dl, run, u)
+		if ctx.Err() != nil {
+			return
+		}
+		f.mu.Lock()
+		if dl.run == run {
+			dl.uris[i].Status = "used"
+			if err == nil {
+				dl.status.Status = "complete"
+				dl.status.TotalLength = strconv.FormatInt(total, 10)
+			}
+		}
+		f.mu.Unlock()
+		if err == nil {
+			return
+		}
+		lastErr = err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if dl.run == run {
+		dl.status.Status = "error"
+		dl.status.ErrorCode = "1"
+		dl.status.ErrorMessage = lastErr.Error()
+	}
+}
+
+// fetchURL downloads one source to a temp file beside the target and
+// renames it into place, returning the size
+func (f *Fake) fetchURL(ctx context.Context, dl *fakeDownload, run int, url string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range dl.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	f.mu.Lock()
+	if dl.run == run && resp.ContentLength > 0 {
+		dl.status.TotalLength = strconv.FormatInt(resp.ContentLength, 10)
+	}
+	f.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(dl.path), 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dl.path), "."+filepath.Base(dl.path)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(io.MultiWriter(tmp, progressWriter{&dl.received}), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp.Name(), dl.path)
+}
+
+// progressWriter counts the bytes written through it
+type progressWriter struct{ n *atomic.Int64 }
+
+func (w progressWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// snapshot returns dl's status as aria2 would report it; callers hold mu
+func (f *Fake) snapshot(dl *fakeDownload) DownloadStatus {
+	status := dl.status
+	completed := dl.received.Load()
+	if status.Status == "complete" {
+		completed, _ = strconv.ParseInt(status.TotalLength, 10, 64)
+	}
+	status.CompletedLength = strconv.FormatInt(completed, 10)
+	if status.TotalLength == "" {
+		status.TotalLength = "0"
+	}
+	status.DownloadSpeed = "0"
+	status.Files = []DownloadFile{{
+		Path:            dl.path,
+		Length:          status.TotalLength,
+		CompletedLength: status.CompletedLength,
+		URIs:            append([]DownloadURI(nil), dl.uris...),
+	}}
+	return status
+}
+
+// lock takes mu, failing instead when ctx is already done the way a call
+// to aria2 would
+func (f *Fake) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	return nil
+}
+
+func (f *Fake) lookup(gid string) (*fakeDownload, error) {
+	dl, ok := f.downloads[gid]
+	if !ok {
+		return nil, fmt.Errorf("rpc error 1: GID %s is not found", gid)
+	}
+	return dl, nil
+}
+
+func (f *Fake) TellStatus(ctx context.Context, gid string) (*DownloadStatus, error) {
+	if err := f.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer f.mu.Unlock()
+	dl, err := f.lookup(gid)
+	if err != nil {
+		return nil, err
+	}
+	status := f.snapshot(dl)
+	return &status, nil
+}
+
+func (f *Fake) TellActive(ctx context.Context) ([]DownloadStatus, error) {
+	if err := f.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer f.mu.Unlock()
+	statuses := []DownloadStatus{}
+	for _, dl := range f.downloads {
+		if dl.status.Status == "active" {
+			statuses = append(statuses, f.snapshot(dl))
+		}
+	}
+	return statuses, nil
+}
+
+// TellWaiting lists paused downloads; nothing else waits in the fake.
+// They come in GID order, which is the order they were added.
+func (f *Fake) TellWaiting(ctx context.Context, offset, num int) ([]DownloadStatus, error) {
+	if err := f.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer f.mu.Unlock()
+	statuses := []DownloadStatus{}
+	for _, dl := range f.downloads {
+		if dl.status.Status == "paused" {
+			statuses = append(statuses, f.snapshot(dl))
+		}
+	}
+	slices.SortFunc(statuses, func(a, b DownloadStatus) int { return strings.Compare(a.GID, b.GID) })
+	offset = min(max(offset, 0), len(statuses))
+	return statuses[offset:min(offset+max(num, 0), len(statuses))], nil
+}
+
+func (f *Fake) Pause(ctx context.Context, gid string) error {
+	if err := f.lock(ctx); err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	dl, err := f.lookup(gid)
+	if err != nil {
+		return err
+	}
+	if dl.status.Status != "active" {
+		return fmt.Errorf("rpc error 1: GID %s cannot be paused now", gid)
+	}
+	dl.run++
+	dl.cancel()
+	dl.status.Status = "paused"
+	return nil
+}
+
+func (f *Fake) Unpause(ctx context.Context, gid string) error {
+	if err := f.lock(ctx); err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	dl, err := f.lookup(gid)
+	if err != nil {
+		return err
+	}
+	if dl.status.Status != "paused" {
+		return fmt.Errorf("rpc error 1: GID %s cannot be unpaused now", gid)
+	}
+	f.start(dl)
+	return nil
+}
+
+// ChangePosition accepts any move; the fake runs every download at once,
+// so there is no waiting queue to reorder
+func (f *Fake) ChangePosition(ctx context.Context, gid string, pos int, how string) (int, error) {
+	if err := f.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer f.mu.Unlock()
+	if _, err := f.lookup(gid); err != nil {
+		return 0, err
+	}
+	return pos, nil
+}
+
+func (f *Fake) Remove(ctx context.Context, gid string) error {
+	if err := f.lock(ctx); err != nil {
+		return err
+	}
+	defer f.mu.Unlock()
+	dl, err := f.lookup(gid)
+	if err != nil {
+		return err
+	}
+	dl.run++
+	dl.cancel()
+	dl.status.Status = "removed"
+	return nil
+}
+
+func (f *Fake) GetVersion(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return "fake", nil
+}
@@ -0,0 +1,128 @@
+package aria2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitFor polls a fake download until it reaches a final status
+func waitFor(t *testing.T, f *Fake, gid string) *DownloadStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := f.TellStatus(context.Background(), gid)
+		if err != nil {
+			t.Fatalf("TellStatus: %v", err)
+		}
+		if status.Status == "complete" || status.Status == "error" {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("download %s didn't finish", gid)
+	return nil
+}
+
+func TestFakeDownload(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("expected the auth header to be passed on")
+		}
+		w.Write([]byte("model weights"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	f := NewFake(server.Client())
+	gid, err := f.AddURIs(ctx, []string{server.URL + "/missing", server.URL + "/model"}, dir, "sub/model.bin",
+		map[string]string{"Authorization": "Bearer token"})
+	if err != nil {
+		t.Fatalf("AddURIs: %v", err)
+	}
+
+	status := waitFor(t, f, gid)
+	if status.Status != "complete" || status.TotalLength != "13" || status.CompletedLength != "13" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if uris := status.Files[0].URIs; uris[0].Status != "used" || uris[1].Status != "used" {
+		t.Errorf("expected both sources to be tried, got %+v", uris)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "sub", "model.bin"))
+	if err != nil || string(data) != "model weights" {
+		t.Errorf("downloaded file = %q, %v", data, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "sub")); len(entries) != 1 {
+		t.Errorf("expected no temp files left, got %d entries", len(entries))
+	}
+
+	gid, _ = f.AddURI(ctx, server.URL+"/missing", dir, "gone.bin", nil)
+	if status := waitFor(t, f, gid); status.Status != "error" || status.ErrorMessage == "" {
+		t.Errorf("expected a failed download, got %+v", status)
+	}
+	if _, err := f.TellStatus(ctx, "nope"); err == nil {
+		t.Error("expected an unknown GID to fail")
+	}
+}
+
+func TestFakePauseAndRemove(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+			w.Write([]byte("done"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	f := NewFake(server.Client())
+	gid, _ := f.AddURI(ctx, server.URL, t.TempDir(), "model.bin", nil)
+
+	if active, _ := f.TellActive(ctx); len(active) != 1 || active[0].GID != gid {
+		t.Fatalf("expected one active download, got %+v", active)
+	}
+	if err := f.Pause(ctx, gid); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if status, _ := f.TellStatus(ctx, gid); status.Status != "paused" {
+		t.Errorf("status = %s, want paused", status.Status)
+	}
+	if active, _ := f.TellActive(ctx); len(active) != 0 {
+		t.Errorf("paused downloads aren't active, got %+v", active)
+	}
+	if waiting, _ := f.TellWaiting(ctx, 0, 10); len(waiting) != 1 || waiting[0].GID != gid {
+		t.Errorf("expected the paused download to be waiting, got %+v", waiting)
+	}
+	if err := f.Pause(ctx, gid); err == nil {
+		t.Error("expected pausing twice to fail")
+	}
+
+	if err := f.Unpause(ctx, gid); err != nil {
+		t.Fatalf("Unpause: %v", err)
+	}
+	if err := f.Remove(ctx, gid); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if status, _ := f.TellStatus(ctx, gid); status.Status != "removed" {
+		t.Errorf("status = %s, want removed", status.Status)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := f.TellStatus(canceled, gid); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled call to fail, got %v", err)
+	}
+}
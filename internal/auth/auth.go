@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/druarnfield/diffbox/internal/apierr"
+)
+
+// Role controls what a user may do. Roles are ordered: each one includes
+// the permissions of the roles below it.
+type Role string
+
+const (
+	RoleViewer  Role = "viewer"  // browse gallery and job status
+	RoleCreator Role = "creator" // submit jobs
+	RoleAdmin   Role = "admin"   // manage models, tokens, workers and users
+)
+
+var roleRank = map[Role]int{
+	RoleViewer:  1,
+	RoleCreator: 2,
+	RoleAdmin:   3,
+}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// Allows reports whether r grants at least the permissions of required
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] >= roleRank[required]
+}
+
+// User is the authenticated caller of a request
+type User struct {
+	ID   string
+	Name string
+	Role Role
+}
+
+// LocalAdmin is the implicit user when authentication is disabled, matching
+// the single-user self-hosted setup where whoever can reach the port owns it.
+var LocalAdmin = &User{ID: "local", Name: "local", Role: RoleAdmin}
+
+// LookupFunc resolves a token hash to a user, returning nil if unknown
+type LookupFunc func(ctx context.Context, tokenHash string) (*User, error)
+
+type contextKey struct{}
+
+// WithUser returns a copy of ctx carrying user
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext returns the user attached by Middleware, if any
+func UserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(contextKey{}).(*User)
+	return user
+}
+
+// GenerateToken returns a new random API token
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "dbx_" + hex.EncodeToString(b), nil
+}
+
+// HashToken returns the stored form of a token. Tokens are high-entropy,
+// so a plain SHA-256 is enough to keep them out of the database.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenFromRequest extracts a bearer token from the Authorization header,
+// falling back to the token query parameter for WebSocket clients that
+// cannot set headers.
+func TokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+// Middleware authenticates requests. When enabled is false every request
+// runs as LocalAdmin. Requests without a valid token continue anonymously
+// and are rejected by Require.
+func Middleware(enabled bool, lookup LookupFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !enabled {
+				next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), LocalAdmin)))
+				return
+			}
+
+			token := TokenFromRequest(r)
+			if token == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user, err := lookup(r.Context(), HashToken(token))
+			if err != nil {
+				apierr.Respond(w, http.StatusInternalServerError, apierr.CodeInternal, "Failed to authenticate")
+				return
+			}
+			if user == nil {
+				apierr.Respond(w, http.StatusUnauthorized, apierr.CodeUnauthorized, "Invalid token")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+		})
+	}
+}
+
+// Require rejects requests whose user does not have at least role
+func Require(role Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := UserFromContext(r.Context())
+			if user == nil {
+				apierr.Respond(w, http.StatusUnauthorized, apierr.CodeUnauthorized, "Authentication required")
+				return
+			}
+			if !user.Role.Allows(role) {
+				apierr.Respond(w, http.StatusForbidden, apierr.CodeForbidden, "Insufficient permissions")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		expected bool
+	}{
+		{RoleAdmin, RoleViewer, true},
+		{RoleAdmin, RoleAdmin, true},
+		{RoleCreator, RoleViewer, true},
+		{RoleCreator, RoleAdmin, false},
+		{RoleViewer, RoleCreator, false},
+		{Role("bogus"), RoleViewer, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.expected {
+			t.Errorf("%s.Allows(%s) = %v, expected %v", tt.role, tt.required, got, tt.expected)
+		}
+	}
+}
+
+func TestMiddlewareAndRequire(t *testing.T) {
+	creatorToken := "dbx_creator"
+	lookup := func(ctx context.Context, hash string) (*User, error) {
+		if hash == HashToken(creatorToken) {
+			return &User{ID: "u1", Name: "carol", Role: RoleCreator}, nil
+		}
+		return nil, nil
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		token    string
+		required Role
+		expected int
+	}{
+		{"disabled runs as admin", false, "", RoleAdmin, http.StatusOK},
+		{"anonymous rejected", true, "", RoleViewer, http.StatusUnauthorized},
+		{"unknown token rejected", true, "dbx_nope", RoleViewer, http.StatusUnauthorized},
+		{"creator can submit", true, creatorToken, RoleCreator, http.StatusOK},
+		{"creator cannot administer", true, creatorToken, RoleAdmin, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Middleware(tt.enabled, lookup)(Require(tt.required)(ok))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/jobs", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+}
+
+func TestTokenFromRequestQuery(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/ws?token=dbx_ws", nil)
+	if got := TokenFromRequest(req); got != "dbx_ws" {
+		t.Errorf("expected token from query, got %q", got)
+	}
+}
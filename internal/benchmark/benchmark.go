@@ -0,0 +1,131 @@
+// Package benchmark defines a fixed suite of small jobs. Their params never
+// change, so timings recorded run after run show what a driver update, a
+// quantized model or a new GPU did to generation speed.
+package benchmark
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// Seed is used by every case that takes one
+const Seed = 42
+
+// Case is one job of the suite
+type Case struct {
+	Name     string                 `json:"name"`
+	Workflow string                 `json:"workflow"`
+	Params   map[string]interface{} `json:"params"`
+}
+
+// Input image size, the smallest landscape preset Wan supports
+const (
+	imageWidth  = 832
+	imageHeight = 480
+)
+
+// Suite returns the benchmark cases. Each is kept small, a few steps at the
+// smallest presets, so the whole suite takes minutes rather than hours.
+func Suite() []Case {
+	return []Case{
+		{
+			Name:     "i2v-480p",
+			Workflow: "i2v",
+			Params: map[string]interface{}{
+				"prompt":              "a paper boat drifting down a stream, soft daylight",
+				"input_image":         InputImage(),
+				"seed":                Seed,
+				"width":               imageWidth,
+				"height":              imageHeight,
+				"num_frames":          33,
+				"num_inference_steps": 4,
+			},
+		},
+		{
+			Name:     "qwen-1024",
+			Workflow: "qwen",
+			Params: map[string]interface{}{
+				"prompt":              "a lighthouse on a rocky coast at dusk, oil painting",
+				"seed":                Seed,
+				"width":               1024,
+				"height":              1024,
+				"num_inference_steps": 4,
+				"mode":                "generate",
+			},
+		},
+		{
+			Name:     "chat-256",
+			Workflow: "chat",
+			Params: map[string]interface{}{
+				"messages": []map[string]string{
+					{"role": "user", "content": "Write a detailed description of a busy harbour at sunrise."},
+				},
+				// Low enough that the reply always runs to the limit, so
+				// every run generates the same number of tokens
+				"max_tokens":  256,
+				"temperature": 0.01,
+				"top_p":       0.9,
+			},
+		},
+	}
+}
+
+// Select returns the cases of the given workflows, or of all workflows
+// enabled when workflows is empty
+func Select(workflows []string, enabled func(workflow string) bool) []Case {
+	want := make(map[string]bool, len(workflows))
+	for _, w := range workflows {
+		want[w] = true
+	}
+	var cases []Case
+	for _, c := range Suite() {
+		if want[c.Workflow] || (len(workflows) == 0 && enabled(c.Workflow)) {
+			cases = append(cases, c)
+		}
+	}
+	return cases
+}
+
+// Workflows lists the workflows the suite covers
+func Workflows() []string {
+	var workflows []string
+	seen := make(map[string]bool)
+	for _, c := range Suite() {
+		if !seen[c.Workflow] {
+			seen[c.Workflow] = true
+			workflows = append(workflows, c.Workflow)
+		}
+	}
+	return workflows
+}
+
+// InputImage is the i2v input: a diagonal gradient, base64-encoded PNG.
+// It is generated rather than shipped, and identical on every run.
+func InputImage() string {
+	img := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight))
+	for y := 0; y < imageHeight; y++ {
+		for x := 0; x < imageWidth; x++ {
+			img.Set(x, y, color.RGBA{
+				R: uint8(x * 255 / imageWidth),
+				G: uint8(y * 255 / imageHeight),
+				B: uint8((x + y) * 255 / (imageWidth + imageHeight)),
+				A: 255,
+			})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// Change is the relative change from a baseline duration to the current
+// one, in percent: negative means faster
+func Change(baseline, current float64) float64 {
+	if baseline <= 0 {
+		return 0
+	}
+	return (current - baseline) / baseline * 100
+}
@@ -0,0 +1,64 @@
+package benchmark
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/druarnfield/diffbox/internal/resolution"
+)
+
+func TestSuiteUsesSupportedResolutions(t *testing.T) {
+	for _, c := range Suite() {
+		catalog, ok := resolution.For(c.Workflow)
+		if !ok {
+			continue
+		}
+		width, height := c.Params["width"].(int), c.Params["height"].(int)
+		if !catalog.Valid(width, height) {
+			t.Errorf("%s: %dx%d is not a %s preset", c.Name, width, height, c.Workflow)
+		}
+	}
+}
+
+func TestInputImage(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(InputImage())
+	if err != nil {
+		t.Fatalf("decode base64: %v", err)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode PNG: %v", err)
+	}
+	if cfg.Width != imageWidth || cfg.Height != imageHeight {
+		t.Errorf("image is %dx%d", cfg.Width, cfg.Height)
+	}
+	if InputImage() != InputImage() {
+		t.Error("input image differs between calls")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	enabled := func(workflow string) bool { return workflow != "qwen" }
+	var names []string
+	for _, c := range Select(nil, enabled) {
+		names = append(names, c.Workflow)
+	}
+	if len(names) != 2 || names[0] != "i2v" || names[1] != "chat" {
+		t.Errorf("enabled cases = %v", names)
+	}
+	if cases := Select([]string{"qwen"}, enabled); len(cases) != 1 || cases[0].Workflow != "qwen" {
+		t.Errorf("named cases = %+v", cases)
+	}
+}
+
+func TestChange(t *testing.T) {
+	if got := Change(40, 30); math.Abs(got+25) > 1e-9 {
+		t.Errorf("Change(40, 30) = %v, want -25", got)
+	}
+	if got := Change(0, 30); got != 0 {
+		t.Errorf("Change without a baseline = %v", got)
+	}
+}
@@ -0,0 +1,258 @@
+// Package camera defines the camera motions an I2V request can ask for:
+// named presets such as orbit or dolly-in, or a keyframed path given as
+// JSON. Either form is validated and expanded into a Path, which is what
+// the worker receives, so workflows only ever deal with keyframes.
+package camera
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Speed is the amount of motion per frame, as a fraction of the frame for
+// moves and of degreesPerUnit for turns. The default matches the camera
+// speed Wan's camera-control LoRAs were trained with.
+const (
+	DefaultSpeed = 0.0185
+	MaxSpeed     = 0.1
+)
+
+// degreesPerUnit converts speed into rotation for pans, tilts and orbits:
+// the default speed over an 81-frame clip turns about 30 degrees.
+const degreesPerUnit = 20
+
+// Path limits. Poses are relative to the first frame, so a path can't
+// move further than this without the subject leaving the frame.
+const (
+	MaxKeyframes = 32
+	maxOffset    = 4
+	maxDegrees   = 360
+	minZoom      = -0.9
+	maxZoom      = 4
+)
+
+// Easing values for Path.Easing
+const (
+	EasingLinear    = "linear"
+	EasingEaseInOut = "ease-in-out"
+)
+
+// Keyframe is the camera pose at one point in the clip, relative to the
+// pose at the first frame
+type Keyframe struct {
+	At   float64 `json:"at"`   // 0 is the first frame, 1 the last
+	X    float64 `json:"x"`    // truck, in frame widths; positive moves right
+	Y    float64 `json:"y"`    // pedestal, in frame heights; positive moves up
+	Zoom float64 `json:"zoom"` // dolly, as added magnification; 0.5 is 1.5x
+	Pan  float64 `json:"pan"`  // yaw in degrees; positive turns right
+	Tilt float64 `json:"tilt"` // pitch in degrees; positive turns up
+	Roll float64 `json:"roll"` // degrees clockwise
+}
+
+func (k Keyframe) scale(f float64) Keyframe {
+	return Keyframe{
+		X: k.X * f, Y: k.Y * f, Zoom: k.Zoom * f,
+		Pan: k.Pan * f, Tilt: k.Tilt * f, Roll: k.Roll * f,
+	}
+}
+
+// Path is a camera motion as keyframes in time order. The pose between
+// keyframes is interpolated according to Easing.
+type Path struct {
+	Keyframes []Keyframe `json:"keyframes"`
+	Easing    string     `json:"easing,omitempty"`
+}
+
+// Motion is a named camera preset
+type Motion struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label"`
+	Description string   `json:"description"`
+	Aliases     []string `json:"aliases,omitempty"`
+	delta       Keyframe // pose change per frame at speed 1
+}
+
+// Path expands the motion over a clip of frames at speed
+func (m Motion) Path(speed float64, frames int) *Path {
+	return &Path{
+		Keyframes: []Keyframe{{At: 0}, withAt(m.delta.scale(speed*float64(max(frames-1, 1))), 1)},
+		Easing:    EasingLinear,
+	}
+}
+
+func withAt(k Keyframe, at float64) Keyframe {
+	k.At = at
+	return k
+}
+
+// Aliases cover the Left/Right/Up/Down/ZoomIn/ZoomOut directions of the
+// original camera_direction parameter.
+var motions = []Motion{
+	{Name: "pan-left", Label: "Pan left", Description: "Turn the camera left on the spot",
+		Aliases: []string{"left"}, delta: Keyframe{Pan: -degreesPerUnit}},
+	{Name: "pan-right", Label: "Pan right", Description: "Turn the camera right on the spot",
+		Aliases: []string{"right"}, delta: Keyframe{Pan: degreesPerUnit}},
+	{Name: "tilt-up", Label: "Tilt up", Description: "Turn the camera up on the spot",
+		Aliases: []string{"up"}, delta: Keyframe{Tilt: degreesPerUnit}},
+	{Name: "tilt-down", Label: "Tilt down", Description: "Turn the camera down on the spot",
+		Aliases: []string{"down"}, delta: Keyframe{Tilt: -degreesPerUnit}},
+	{Name: "truck-left", Label: "Truck left", Description: "Slide the camera sideways to the left",
+		delta: Keyframe{X: -1}},
+	{Name: "truck-right", Label: "Truck right", Description: "Slide the camera sideways to the right",
+		delta: Keyframe{X: 1}},
+	{Name: "dolly-in", Label: "Dolly in", Description: "Move the camera towards the subject",
+		Aliases: []string{"zoom-in", "zoomin", "in"}, delta: Keyframe{Zoom: 0.25}},
+	{Name: "dolly-out", Label: "Dolly out", Description: "Move the camera away from the subject",
+		Aliases: []string{"zoom-out", "zoomout", "out"}, delta: Keyframe{Zoom: -0.25}},
+	{Name: "orbit-left", Label: "Orbit left", Description: "Circle the subject to the left, keeping it centered",
+		delta: Keyframe{X: -1, Pan: degreesPerUnit}},
+	{Name: "orbit-right", Label: "Orbit right", Description: "Circle the subject to the right, keeping it centered",
+		delta: Keyframe{X: 1, Pan: -degreesPerUnit}},
+	{Name: "crane-up", Label: "Crane up", Description: "Raise the camera while tilting down onto the subject",
+		delta: Keyframe{Y: 1, Tilt: -degreesPerUnit / 2}},
+	{Name: "roll-clockwise", Label: "Roll clockwise", Description: "Rotate the frame clockwise",
+		Aliases: []string{"cw", "clockwise"}, delta: Keyframe{Roll: degreesPerUnit}},
+}
+
+// Supported reports whether a job type takes camera motion. Only the Wan
+// video workflows do.
+func Supported(jobType string) bool {
+	return jobType == "i2v" || jobType == "svi"
+}
+
+// Motions returns the presets in display order
+func Motions() []Motion {
+	return append([]Motion(nil), motions...)
+}
+
+// Lookup finds a preset by name or alias. Matching ignores case, spaces
+// and underscores, so "Pan Left" and "pan_left" find pan-left.
+func Lookup(name string) (Motion, bool) {
+	key := normalize(name)
+	for _, m := range motions {
+		if m.Name == key {
+			return m, true
+		}
+		for _, alias := range m.Aliases {
+			if alias == key {
+				return m, true
+			}
+		}
+	}
+	return Motion{}, false
+}
+
+func normalize(name string) string {
+	return strings.NewReplacer(" ", "-", "_", "-").Replace(strings.ToLower(strings.TrimSpace(name)))
+}
+
+// isStatic reports whether a direction asks for no camera motion
+func isStatic(direction string) bool {
+	switch normalize(direction) {
+	case "", "none", "static":
+		return true
+	}
+	return false
+}
+
+// FieldError is a validation failure of one request field
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+func fieldError(field, format string, args ...interface{}) error {
+	return &FieldError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// Resolve turns the camera fields of a request into the path to render,
+// or nil for a static camera. A path is used as given; a direction is
+// looked up and expanded at speed (0 means DefaultSpeed) over frames.
+func Resolve(direction string, speed float64, path *Path, frames int) (*Path, error) {
+	if path != nil {
+		if !isStatic(direction) {
+			return nil, fieldError("camera_path", "can't be combined with camera_direction")
+		}
+		if err := path.Validate(); err != nil {
+			return nil, err
+		}
+		if path.Easing == "" {
+			path.Easing = EasingLinear
+		}
+		return path, nil
+	}
+	if isStatic(direction) {
+		return nil, nil
+	}
+
+	motion, ok := Lookup(direction)
+	if !ok {
+		return nil, fieldError("camera_direction", "unknown motion %q; see /api/workflows/i2v/camera-motions", direction)
+	}
+	if speed == 0 {
+		speed = DefaultSpeed
+	}
+	if speed < 0 || speed > MaxSpeed || math.IsNaN(speed) {
+		return nil, fieldError("camera_speed", "must be between 0 and %g", MaxSpeed)
+	}
+	expanded := motion.Path(speed, frames)
+	if expanded.Validate() != nil {
+		return nil, fieldError("camera_speed", "too fast for a %d-frame clip", frames)
+	}
+	return expanded, nil
+}
+
+// Validate checks that keyframes start at 0, run forward in time and stay
+// within the limits a clip can render
+func (p *Path) Validate() error {
+	switch p.Easing {
+	case "", EasingLinear, EasingEaseInOut:
+	default:
+		return fieldError("camera_path.easing", "must be %q or %q", EasingLinear, EasingEaseInOut)
+	}
+	if len(p.Keyframes) < 2 {
+		return fieldError("camera_path.keyframes", "needs at least 2 keyframes")
+	}
+	if len(p.Keyframes) > MaxKeyframes {
+		return fieldError("camera_path.keyframes", "at most %d keyframes", MaxKeyframes)
+	}
+	if p.Keyframes[0].At != 0 {
+		return fieldError("camera_path.keyframes[0].at", "must be 0")
+	}
+
+	for i, k := range p.Keyframes {
+		field := fmt.Sprintf("camera_path.keyframes[%d]", i)
+		if i > 0 && k.At <= p.Keyframes[i-1].At {
+			return fieldError(field+".at", "must be after the previous keyframe")
+		}
+		if k.At > 1 {
+			return fieldError(field+".at", "must be between 0 and 1")
+		}
+		if i == 0 && k != (Keyframe{}) {
+			return fieldError(field, "the first keyframe is the starting pose and must be all zeros")
+		}
+		checks := []struct {
+			name     string
+			value    float64
+			min, max float64
+		}{
+			{"x", k.X, -maxOffset, maxOffset},
+			{"y", k.Y, -maxOffset, maxOffset},
+			{"zoom", k.Zoom, minZoom, maxZoom},
+			{"pan", k.Pan, -maxDegrees, maxDegrees},
+			{"tilt", k.Tilt, -maxDegrees, maxDegrees},
+			{"roll", k.Roll, -maxDegrees, maxDegrees},
+		}
+		for _, c := range checks {
+			if math.IsNaN(c.value) || c.value < c.min || c.value > c.max {
+				return fieldError(field+"."+c.name, "must be between %g and %g", c.min, c.max)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package camera
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := map[string]string{
+		"orbit-left": "orbit-left",
+		"Pan Left":   "pan-left",
+		"dolly_in":   "dolly-in",
+		"Left":       "pan-left",
+		"ZoomOut":    "dolly-out",
+	}
+	for name, want := range tests {
+		m, ok := Lookup(name)
+		if !ok || m.Name != want {
+			t.Errorf("Lookup(%q) = %q, %v; want %q", name, m.Name, ok, want)
+		}
+	}
+	if _, ok := Lookup("sideways"); ok {
+		t.Error("expected an unknown motion to be rejected")
+	}
+}
+
+func TestMotionNamesUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for _, m := range Motions() {
+		for _, name := range append([]string{m.Name}, m.Aliases...) {
+			if seen[name] {
+				t.Errorf("%q is used by more than one motion", name)
+			}
+			seen[name] = true
+		}
+		if m.delta == (Keyframe{}) {
+			t.Errorf("%s doesn't move the camera", m.Name)
+		}
+	}
+}
+
+func TestResolvePreset(t *testing.T) {
+	path, err := Resolve("pan-right", 0, nil, 81)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if len(path.Keyframes) != 2 || path.Keyframes[1].At != 1 {
+		t.Fatalf("unexpected keyframes %+v", path.Keyframes)
+	}
+	if got := path.Keyframes[1].Pan; math.Abs(got-DefaultSpeed*degreesPerUnit*80) > 1e-9 {
+		t.Errorf("pan = %v at the default speed", got)
+	}
+	if err := path.Validate(); err != nil {
+		t.Errorf("expanded preset fails validation: %v", err)
+	}
+
+	// Every preset at the default speed fits a long clip
+	for _, m := range Motions() {
+		if err := m.Path(DefaultSpeed, 161).Validate(); err != nil {
+			t.Errorf("%s at the default speed: %v", m.Name, err)
+		}
+	}
+
+	for _, direction := range []string{"", "none", "Static"} {
+		if path, err := Resolve(direction, 0.5, nil, 81); path != nil || err != nil {
+			t.Errorf("Resolve(%q) = %v, %v; want a static camera", direction, path, err)
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	valid := &Path{Keyframes: []Keyframe{{}, {At: 1, Zoom: 0.5}}}
+	tests := []struct {
+		name      string
+		direction string
+		speed     float64
+		path      *Path
+		field     string
+	}{
+		{"unknown motion", "sideways", 0, nil, "camera_direction"},
+		{"too fast", "orbit-left", 0.5, nil, "camera_speed"},
+		{"past the limits", "truck-left", MaxSpeed, nil, "camera_speed"},
+		{"negative speed", "orbit-left", -0.01, nil, "camera_speed"},
+		{"both", "orbit-left", 0, valid, "camera_path"},
+		{"one keyframe", "", 0, &Path{Keyframes: []Keyframe{{}}}, "camera_path.keyframes"},
+		{"late start", "", 0, &Path{Keyframes: []Keyframe{{At: 0.1}, {At: 1}}}, "camera_path.keyframes[0].at"},
+		{"moved start", "", 0, &Path{Keyframes: []Keyframe{{X: 1}, {At: 1}}}, "camera_path.keyframes[0]"},
+		{"out of order", "", 0, &Path{Keyframes: []Keyframe{{}, {At: 0.6}, {At: 0.6}}}, "camera_path.keyframes[2].at"},
+		{"past the end", "", 0, &Path{Keyframes: []Keyframe{{}, {At: 1.5}}}, "camera_path.keyframes[1].at"},
+		{"zoom through", "", 0, &Path{Keyframes: []Keyframe{{}, {At: 1, Zoom: -1}}}, "camera_path.keyframes[1].zoom"},
+		{"bad easing", "", 0, &Path{Keyframes: valid.Keyframes, Easing: "bounce"}, "camera_path.easing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Resolve(tt.direction, tt.speed, tt.path, 81)
+			var fe *FieldError
+			if !errors.As(err, &fe) {
+				t.Fatalf("expected a field error, got %v", err)
+			}
+			if fe.Field != tt.field {
+				t.Errorf("field = %q, want %q (%v)", fe.Field, tt.field, err)
+			}
+		})
+	}
+
+	path, err := Resolve("none", 0, &Path{Keyframes: valid.Keyframes}, 81)
+	if err != nil || path.Easing != EasingLinear {
+		t.Errorf("custom path = %+v, %v; want it accepted with linear easing", path, err)
+	}
+}
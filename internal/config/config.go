@@ -1,15 +1,36 @@
 package config
 
 import (
+	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Port       string
-	DataDir    string
-	ModelsDir  string
-	OutputsDir string
-	StaticDir  string
+	Port          string
+	DataDir       string
+	ModelsDir     string
+	OutputsDir    string
+	StaticDir     string
+	ThumbnailsDir string
+	ScratchDir    string
+	// WorkflowsDir holds custom workflow definitions (*.workflow.json)
+	WorkflowsDir string
+	// InputsDir is the content-addressed library of input images
+	InputsDir string
+	// UploadsDir holds chunked uploads of large inputs such as videos, and
+	// MaxUploadMB caps the size of one
+	UploadsDir  string
+	MaxUploadMB int
+
+	// ScratchGracePeriod is how long a finished job's scratch directory is
+	// kept before removal
+	ScratchGracePeriod time.Duration
 
 	ValkeyAddr string
 	ValkeyPort string
@@ -19,13 +40,146 @@ type Config struct {
 
 	ComfyUIURL string
 
+	// HFEndpoint is the HuggingFace base URL for model downloads and token
+	// checks. DIFFBOX_HF_MIRROR wins over the standard HF_ENDPOINT.
+	HFEndpoint string
+	// HFMirrors are more HuggingFace-compatible endpoints serving the same
+	// files, probed to pick the fastest source for each download
+	HFMirrors []string
+	// MirrorSelection is "fastest" to download from the best mirror or
+	// "spread" to split downloads across every healthy one
+	MirrorSelection string
+
 	WorkerCount int
 	PythonPath  string
+	// PythonBootstrap runs in PythonPath before the workers start, so
+	// dependencies are installed on first boot. "off" disables it.
+	PythonBootstrap string
+
+	// ConcurrencyLimits caps concurrently dispatched jobs per job type,
+	// e.g. DIFFBOX_CONCURRENCY_LIMITS=svi=1,qwen=2. Unlisted types are
+	// only bounded by the workers.
+	ConcurrencyLimits map[string]int
+
+	// IdleUnloadTimeout unloads a worker's models after it has been idle
+	// this long, freeing VRAM between sessions. Zero disables it.
+	IdleUnloadTimeout time.Duration
+
+	// ShutdownDrainTimeout is how long shutdown waits for running jobs to
+	// finish before marking them interrupted
+	ShutdownDrainTimeout time.Duration
+
+	// RequestTimeout is the deadline for each API request. Handlers pass it
+	// down to the database, queue and aria2 calls they make. Zero disables it.
+	RequestTimeout time.Duration
+
+	// AuthEnabled turns on per-user API tokens and role checks. When off,
+	// every request is treated as the local admin.
+	AuthEnabled bool
+	// AdminToken bootstraps an admin user on startup when auth is enabled
+	AdminToken string
+
+	// Optional HTTP middleware. RequestLogging writes a line per request
+	// to the server log, Compression gzips text and JSON responses, and
+	// RateLimit caps the API requests each user (or address, with auth
+	// off) may make per minute; zero disables it.
+	RequestLogging bool
+	Compression    bool
+	RateLimit      int
+	// RequestLogDays keeps a structured log of API requests in the
+	// database for this many days, for troubleshooting clients. Zero
+	// disables it.
+	RequestLogDays int
+
+	// TracingEnabled exports OpenTelemetry spans over OTLP/HTTP, configured
+	// by the standard OTEL_EXPORTER_OTLP_* variables
+	TracingEnabled bool
+
+	// LazyModelDownloads skips the startup download; each workflow's models
+	// are fetched when its first job arrives
+	LazyModelDownloads bool
+	// SkipSetup starts downloads without waiting for the first-run setup
+	// wizard, for headless deployments
+	SkipSetup bool
+	// VerifyModelsRemote checks local model files against the size and
+	// sha256 HuggingFace publishes instead of only the manifest size
+	VerifyModelsRemote bool
+	// DiskSpaceCheck is what happens when missing models won't fit on the
+	// models volume: "refuse", "warn" or "off"
+	DiskSpaceCheck string
+	// ModelArchiveDir receives model files no job has used for
+	// ModelArchiveAfterDays. Archiving is off unless both are set.
+	ModelArchiveDir       string
+	ModelArchiveAfterDays int
+	// ModelAliases repoints or adds model aliases used in job requests,
+	// e.g. DIFFBOX_MODEL_ALIASES=lightning-high=wan2.2_lightning_high_fp8.safetensors
+	ModelAliases map[string]string
+
+	// AdmissionControl refuses jobs up front when the GPU, the outputs
+	// volume or the submitter's quota can't take them
+	AdmissionControl bool
+	// MaxQueuedJobs caps pending and running jobs across all users, and
+	// MaxJobsPerUser caps them per user. Zero means no limit.
+	MaxQueuedJobs  int
+	MaxJobsPerUser int
+	// Default per-user GPU minutes per rolling day and stored output size.
+	// Admins can override these per user. Zero means no limit.
+	UserGPUMinutesPerDay int
+	UserStorageGB        int
+	// FairScheduling interleaves users' queued jobs, favouring whoever has
+	// used the least GPU time today, instead of dispatching strictly in
+	// queue order
+	FairScheduling bool
+
+	// TestMode runs without a GPU or external daemons: Valkey and aria2 are
+	// replaced by in-process fakes and the Python workers by a mock that
+	// completes every job with a placeholder output. It backs the end to
+	// end tests and is handy for frontend work.
+	TestMode bool
+	// Simulate replaces the Python workers with a simulator that paces
+	// jobs like the real workflows and writes placeholder outputs, while
+	// Valkey and aria2 run as usual. No models are needed. SimulateSpeed
+	// divides the simulated durations.
+	Simulate      bool
+	SimulateSpeed float64
+
+	// GPU telemetry sampling
+	GPUSampleInterval time.Duration
+	GPUHistorySize    int
+
+	// Alert when free space on the outputs or models volume, or free VRAM
+	// on a GPU, drops below these percentages. Zero turns a check off.
+	// Alerts go to the WebSocket, the log and AlertWebhookURL if set.
+	AlertDiskFreePct int
+	AlertVRAMFreePct int
+	AlertInterval    time.Duration
+	AlertWebhookURL  string
 }
 
+// Load reads the configuration from the environment and creates the
+// directories it names
 func Load() (*Config, error) {
+	cfg, err := Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure directories exist
+	dirs := []string{cfg.DataDir, cfg.ModelsDir, cfg.OutputsDir, cfg.ThumbnailsDir, cfg.ScratchDir, cfg.InputsDir, cfg.UploadsDir}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// Read reads the configuration from the environment without touching the
+// filesystem
+func Read() (*Config, error) {
 	cfg := &Config{
-		Port:       getEnv("DIFFBOX_PORT", "8080"),
+		Port:       ListenPort(),
 		DataDir:    getEnv("DIFFBOX_DATA_DIR", "./data"),
 		ModelsDir:  getEnv("DIFFBOX_MODELS_DIR", "./models"),
 		OutputsDir: getEnv("DIFFBOX_OUTPUTS_DIR", "./outputs"),
@@ -38,25 +192,283 @@ func Load() (*Config, error) {
 		Aria2MaxConnections: 16,
 
 		ComfyUIURL: getEnv("COMFYUI_URL", "http://localhost:8188"),
+		HFEndpoint: strings.TrimRight(getEnv("DIFFBOX_HF_MIRROR", getEnv("HF_ENDPOINT", "https://huggingface.co")), "/"),
+
+		HFMirrors:       splitList(os.Getenv("DIFFBOX_HF_MIRRORS")),
+		MirrorSelection: getEnv("DIFFBOX_MIRROR_SELECTION", "fastest"),
 
 		WorkerCount: 1,
 		PythonPath:  getEnv("DIFFBOX_PYTHON_PATH", "./python"),
+
+		PythonBootstrap:   getEnv("DIFFBOX_PYTHON_BOOTSTRAP", "uv sync"),
+		IdleUnloadTimeout: getEnvDuration("DIFFBOX_IDLE_UNLOAD_TIMEOUT", 0),
+
+		ShutdownDrainTimeout: getEnvDuration("DIFFBOX_SHUTDOWN_DRAIN_TIMEOUT", 5*time.Minute),
+
+		ScratchGracePeriod: getEnvDuration("DIFFBOX_SCRATCH_GRACE_PERIOD", 10*time.Minute),
+
+		AuthEnabled: getEnvBool("DIFFBOX_AUTH_ENABLED", false),
+		AdminToken:  getEnv("DIFFBOX_ADMIN_TOKEN", ""),
+
+		RequestLogging: getEnvBool("DIFFBOX_REQUEST_LOGGING", true),
+		Compression:    getEnvBool("DIFFBOX_COMPRESSION", false),
+		RateLimit:      getEnvInt("DIFFBOX_RATE_LIMIT", 0),
+		RequestLogDays: getEnvInt("DIFFBOX_REQUEST_LOG_DAYS", 0),
+
+		TracingEnabled: getEnvBool("DIFFBOX_TRACING_ENABLED", false),
+
+		LazyModelDownloads:    getEnvBool("DIFFBOX_LAZY_MODEL_DOWNLOADS", false),
+		SkipSetup:             getEnvBool("DIFFBOX_SKIP_SETUP", false),
+		VerifyModelsRemote:    getEnvBool("DIFFBOX_VERIFY_MODELS_REMOTE", true),
+		DiskSpaceCheck:        getEnv("DIFFBOX_DISK_SPACE_CHECK", "refuse"),
+		ModelArchiveDir:       getEnv("DIFFBOX_MODEL_ARCHIVE_DIR", ""),
+		ModelArchiveAfterDays: getEnvInt("DIFFBOX_MODEL_ARCHIVE_AFTER_DAYS", 0),
+
+		AdmissionControl: getEnvBool("DIFFBOX_ADMISSION_CONTROL", true),
+		MaxQueuedJobs:    getEnvInt("DIFFBOX_MAX_QUEUED_JOBS", 0),
+		MaxJobsPerUser:   getEnvInt("DIFFBOX_MAX_JOBS_PER_USER", 0),
+
+		UserGPUMinutesPerDay: getEnvInt("DIFFBOX_USER_GPU_MINUTES_PER_DAY", 0),
+		UserStorageGB:        getEnvInt("DIFFBOX_USER_STORAGE_GB", 0),
+		FairScheduling:       getEnvBool("DIFFBOX_FAIR_SCHEDULING", true),
+
+		TestMode: getEnvBool("DIFFBOX_TEST_MODE", false),
+		Simulate: getEnvBool("DIFFBOX_SIMULATE", false),
+
+		GPUSampleInterval: getEnvDuration("DIFFBOX_GPU_SAMPLE_INTERVAL", 5*time.Second),
+		GPUHistorySize:    getEnvInt("DIFFBOX_GPU_HISTORY_SIZE", 720),
+
+		AlertDiskFreePct: getEnvInt("DIFFBOX_ALERT_DISK_FREE_PCT", 10),
+		AlertVRAMFreePct: getEnvInt("DIFFBOX_ALERT_VRAM_FREE_PCT", 0),
+		AlertInterval:    getEnvDuration("DIFFBOX_ALERT_INTERVAL", time.Minute),
+		AlertWebhookURL:  getEnv("DIFFBOX_ALERT_WEBHOOK_URL", ""),
 	}
 
-	// Ensure directories exist
-	dirs := []string{cfg.DataDir, cfg.ModelsDir, cfg.OutputsDir}
-	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return nil, err
+	limits, err := parseLimits(os.Getenv("DIFFBOX_CONCURRENCY_LIMITS"))
+	if err != nil {
+		return nil, fmt.Errorf("DIFFBOX_CONCURRENCY_LIMITS: %w", err)
+	}
+	cfg.ConcurrencyLimits = limits
+
+	aliases, err := parseAliases(os.Getenv("DIFFBOX_MODEL_ALIASES"))
+	if err != nil {
+		return nil, fmt.Errorf("DIFFBOX_MODEL_ALIASES: %w", err)
+	}
+	cfg.ModelAliases = aliases
+
+	switch cfg.MirrorSelection {
+	case "fastest", "spread":
+	default:
+		return nil, fmt.Errorf("DIFFBOX_MIRROR_SELECTION: expected fastest or spread, got %q", cfg.MirrorSelection)
+	}
+
+	switch cfg.DiskSpaceCheck {
+	case "refuse", "warn", "off":
+	default:
+		return nil, fmt.Errorf("DIFFBOX_DISK_SPACE_CHECK: expected refuse, warn or off, got %q", cfg.DiskSpaceCheck)
+	}
+
+	for name, pct := range map[string]int{
+		"DIFFBOX_ALERT_DISK_FREE_PCT": cfg.AlertDiskFreePct,
+		"DIFFBOX_ALERT_VRAM_FREE_PCT": cfg.AlertVRAMFreePct,
+	} {
+		if pct < 0 || pct >= 100 {
+			return nil, fmt.Errorf("%s: expected a percentage from 0 to 99, got %d", name, pct)
+		}
+	}
+
+	for name, n := range map[string]int{
+		"DIFFBOX_RATE_LIMIT":       cfg.RateLimit,
+		"DIFFBOX_REQUEST_LOG_DAYS": cfg.RequestLogDays,
+	} {
+		if n < 0 {
+			return nil, fmt.Errorf("%s: expected zero or more, got %d", name, n)
 		}
 	}
 
+	// The GPU sampler keeps a ring buffer of this many samples
+	if cfg.GPUHistorySize < 1 {
+		return nil, fmt.Errorf("DIFFBOX_GPU_HISTORY_SIZE: expected one or more, got %d", cfg.GPUHistorySize)
+	}
+
+	// Parsed here rather than with getEnvDuration, which ignores zero
+	cfg.RequestTimeout = 60 * time.Second
+	if v := os.Getenv("DIFFBOX_REQUEST_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("DIFFBOX_REQUEST_TIMEOUT: expected a duration, or 0 to disable, got %q", v)
+		}
+		cfg.RequestTimeout = timeout
+	}
+
+	cfg.SimulateSpeed = 1
+	if v := os.Getenv("DIFFBOX_SIMULATE_SPEED"); v != "" {
+		speed, err := strconv.ParseFloat(v, 64)
+		if err != nil || speed <= 0 {
+			return nil, fmt.Errorf("DIFFBOX_SIMULATE_SPEED: expected a positive number, got %q", v)
+		}
+		cfg.SimulateSpeed = speed
+	}
+
+	if cfg.PythonBootstrap == "off" {
+		cfg.PythonBootstrap = ""
+	}
+	// Test mode runs offline: the mock workers need no Python environment
+	// and model files aren't checked against HuggingFace. Simulated workers
+	// need no Python either.
+	if cfg.Simulate {
+		cfg.PythonBootstrap = ""
+	}
+	if cfg.TestMode {
+		cfg.PythonBootstrap = ""
+		cfg.VerifyModelsRemote = false
+	}
+
+	cfg.ThumbnailsDir = getEnv("DIFFBOX_THUMBNAILS_DIR", filepath.Join(cfg.DataDir, "thumbnails"))
+	cfg.ScratchDir = getEnv("DIFFBOX_SCRATCH_DIR", filepath.Join(cfg.DataDir, "scratch"))
+	cfg.WorkflowsDir = getEnv("DIFFBOX_WORKFLOWS_DIR", filepath.Join(cfg.DataDir, "workflows"))
+	cfg.InputsDir = getEnv("DIFFBOX_INPUTS_DIR", filepath.Join(cfg.DataDir, "inputs"))
+	cfg.UploadsDir = getEnv("DIFFBOX_UPLOADS_DIR", filepath.Join(cfg.DataDir, "uploads"))
+	cfg.MaxUploadMB = getEnvInt("DIFFBOX_MAX_UPLOAD_MB", 2048)
+
 	return cfg, nil
 }
 
+// ListenPort returns the HTTP port without loading the rest of the
+// configuration, for commands that talk to a running server
+func ListenPort() string {
+	return getEnv("DIFFBOX_PORT", "8080")
+}
+
+// splitList parses a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// secretFields are config fields whose values are left out of Redacted
+var secretFields = []string{"Token", "Password", "Secret", "WebhookURL"}
+
+// Redacted returns the config by field name with secrets blanked and
+// passwords removed from URLs, safe to attach to a bug report. Durations
+// are written as strings such as "1m30s".
+func (c *Config) Redacted() map[string]interface{} {
+	out := make(map[string]interface{})
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		field := v.Field(i)
+		secret := false
+		for _, s := range secretFields {
+			secret = secret || strings.Contains(name, s)
+		}
+
+		switch value := field.Interface().(type) {
+		case string:
+			if secret && value != "" {
+				out[name] = "[redacted]"
+			} else {
+				out[name] = redactURL(value)
+			}
+		case []string:
+			urls := make([]string, len(value))
+			for i, u := range value {
+				urls[i] = redactURL(u)
+			}
+			out[name] = urls
+		case time.Duration:
+			out[name] = value.String()
+		default:
+			out[name] = value
+		}
+	}
+	return out
+}
+
+// redactURL hides the password of a URL with credentials, and returns
+// anything else as it is
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	return u.Redacted()
+}
+
+// parseLimits parses a comma-separated list of type=limit pairs
+func parseLimits(value string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, limit, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected type=limit, got %q", pair)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid limit for %s: %q", name, limit)
+		}
+		limits[strings.TrimSpace(name)] = n
+	}
+	return limits, nil
+}
+
+// parseAliases parses "alias=file" pairs separated by commas
+func parseAliases(value string) (map[string]string, error) {
+	aliases := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, file, ok := strings.Cut(pair, "=")
+		name, file = strings.TrimSpace(name), strings.TrimSpace(file)
+		if !ok || name == "" || file == "" {
+			return nil, fmt.Errorf("expected alias=file, got %q", pair)
+		}
+		aliases[name] = file
+	}
+	return aliases, nil
+}
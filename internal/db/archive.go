@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// Archive methods. Archiving hides a finished job from the default job
+// list without losing it; only archived jobs can be purged for good.
+
+// ErrJobActive is returned when archiving a job that hasn't finished
+var ErrJobActive = errors.New("job is still queued or running")
+
+// ArchiveFilter selects which jobs a listing returns
+type ArchiveFilter int
+
+const (
+	ExcludeArchived ArchiveFilter = iota
+	IncludeArchived
+	OnlyArchived
+)
+
+func (f ArchiveFilter) where() string {
+	switch f {
+	case IncludeArchived:
+		return ""
+	case OnlyArchived:
+		return "WHERE archived_at IS NOT NULL"
+	default:
+		return "WHERE archived_at IS NULL"
+	}
+}
+
+// ArchiveJob archives a finished job. Archiving an archived job is a
+// no-op. Returns sql.ErrNoRows if the job doesn't exist and ErrJobActive
+// if it hasn't finished.
+func (db *DB) ArchiveJob(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "ArchiveJob")
+	defer func() { tracing.End(span, err) }()
+
+	return db.setArchived(ctx, id, true)
+}
+
+// UnarchiveJob returns an archived job to the job list
+func (db *DB) UnarchiveJob(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "UnarchiveJob")
+	defer func() { tracing.End(span, err) }()
+
+	return db.setArchived(ctx, id, false)
+}
+
+func (db *DB) setArchived(ctx context.Context, id string, archived bool) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var archivedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `SELECT status, archived_at FROM jobs WHERE id = ?`, id).Scan(&status, &archivedAt)
+	if err != nil {
+		return err
+	}
+	if archivedAt.Valid == archived {
+		return nil
+	}
+	if archived {
+		switch status {
+		case "pending", "waiting_models", "running":
+			return ErrJobActive
+		}
+	}
+
+	var at interface{}
+	event := EventUnarchived
+	if archived {
+		at, event = time.Now(), EventArchived
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE jobs SET archived_at = ? WHERE id = ?`, at, id); err != nil {
+		return err
+	}
+	if err := recordJobEvent(ctx, tx, id, event, "", ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeJobs permanently deletes archived jobs along with their events and
+// previews, returning the deleted jobs so callers can clean up outputs.
+// With no IDs every archived job is purged; IDs of jobs that aren't
+// archived are skipped.
+func (db *DB) PurgeJobs(ctx context.Context, ids []string) (purged []*Job, err error) {
+	ctx, span := startSpan(ctx, "PurgeJobs")
+	defer func() { tracing.End(span, err) }()
+
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE archived_at IS NOT NULL`
+	args := make([]interface{}, len(ids))
+	if len(ids) > 0 {
+		query += ` AND id IN (?` + strings.Repeat(`, ?`, len(ids)-1) + `)`
+		for i, id := range ids {
+			args[i] = id
+		}
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		purged = append(purged, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, job := range purged {
+		for _, q := range []string{
+			`DELETE FROM job_events WHERE job_id = ?`,
+			`DELETE FROM job_stages WHERE job_id = ?`,
+			`DELETE FROM job_previews WHERE job_id = ?`,
+			`DELETE FROM jobs WHERE id = ?`,
+		} {
+			if _, err := tx.ExecContext(ctx, q, job.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return purged, tx.Commit()
+}
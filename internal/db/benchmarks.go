@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// Benchmark methods. A run queues the benchmark suite's jobs; each job's
+// timing is filled in when it finishes.
+
+// Benchmark result statuses
+const (
+	BenchmarkPending   = "pending"
+	BenchmarkCompleted = "completed"
+	BenchmarkFailed    = "failed"
+)
+
+type BenchmarkRun struct {
+	ID    string
+	Label string
+	// Environment describes the GPUs, driver and models the run used, as
+	// JSON
+	Environment string
+	CreatedAt   time.Time
+	Results     []*BenchmarkResult
+}
+
+// BenchmarkResult is one suite case of a run
+type BenchmarkResult struct {
+	Name     string
+	Workflow string
+	JobID    string // Empty if the job was never queued
+	Status   string
+	// Wait is the time queued, Run the time from the first progress
+	// report to the end
+	Wait       time.Duration
+	Run        time.Duration
+	Error      string
+	FinishedAt time.Time // Zero while pending
+}
+
+// CreateBenchmarkRun stores a run with its results
+func (db *DB) CreateBenchmarkRun(ctx context.Context, run *BenchmarkRun) (err error) {
+	ctx, span := startSpan(ctx, "CreateBenchmarkRun")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO benchmark_runs (id, label, environment, created_at) VALUES (?, ?, ?, ?)`,
+		run.ID, run.Label, run.Environment, now,
+	)
+	if err != nil {
+		return err
+	}
+	for _, r := range run.Results {
+		var finishedAt interface{}
+		if !r.FinishedAt.IsZero() {
+			finishedAt = r.FinishedAt
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO benchmark_results (run_id, name, workflow, job_id, status, error, finished_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			run.ID, r.Name, r.Workflow, r.JobID, r.Status, r.Error, finishedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	run.CreatedAt = now
+	return tx.Commit()
+}
+
+// UpdateBenchmarkResult records the job a result's case was submitted
+// as, or why it was refused
+func (db *DB) UpdateBenchmarkResult(ctx context.Context, runID string, r *BenchmarkResult) (err error) {
+	ctx, span := startSpan(ctx, "UpdateBenchmarkResult")
+	defer func() { tracing.End(span, err) }()
+
+	var finishedAt interface{}
+	if !r.FinishedAt.IsZero() {
+		finishedAt = r.FinishedAt
+	}
+	_, err = db.conn.ExecContext(ctx,
+		`UPDATE benchmark_results SET job_id = ?, status = ?, error = ?, finished_at = ?
+		WHERE run_id = ? AND name = ?`,
+		r.JobID, r.Status, r.Error, finishedAt, runID, r.Name,
+	)
+	return err
+}
+
+// DeleteBenchmarkRun removes a run and its results
+func (db *DB) DeleteBenchmarkRun(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "DeleteBenchmarkRun")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err = db.conn.ExecContext(ctx, `DELETE FROM benchmark_results WHERE run_id = ?`, id); err != nil {
+		return err
+	}
+	_, err = db.conn.ExecContext(ctx, `DELETE FROM benchmark_runs WHERE id = ?`, id)
+	return err
+}
+
+// FinishBenchmarkJob records the timing of a benchmark job. Jobs that
+// aren't part of a benchmark run are ignored.
+func (db *DB) FinishBenchmarkJob(ctx context.Context, jobID, status string, wait, run time.Duration, errorMsg string) (err error) {
+	ctx, span := startSpan(ctx, "FinishBenchmarkJob")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`UPDATE benchmark_results SET status = ?, wait_ms = ?, run_ms = ?, error = ?, finished_at = ?
+		WHERE job_id = ? AND status = ?`,
+		status, wait.Milliseconds(), run.Milliseconds(), errorMsg, time.Now(), jobID, BenchmarkPending,
+	)
+	return err
+}
+
+// GetBenchmarkRun returns a run with its results, or sql.ErrNoRows if
+// there is none
+func (db *DB) GetBenchmarkRun(ctx context.Context, id string) (run *BenchmarkRun, err error) {
+	ctx, span := startSpan(ctx, "GetBenchmarkRun")
+	defer func() { tracing.End(span, err) }()
+
+	run = &BenchmarkRun{ID: id}
+	var label, environment sql.NullString
+	err = db.conn.QueryRowContext(ctx,
+		`SELECT label, environment, created_at FROM benchmark_runs WHERE id = ?`, id,
+	).Scan(&label, &environment, &run.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	run.Label, run.Environment = label.String, environment.String
+	if err := db.loadBenchmarkResults(ctx, []*BenchmarkRun{run}); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// ListBenchmarkRuns returns the most recent runs with their results,
+// newest first
+func (db *DB) ListBenchmarkRuns(ctx context.Context, limit int) (runs []*BenchmarkRun, err error) {
+	ctx, span := startSpan(ctx, "ListBenchmarkRuns")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT id, label, environment, created_at FROM benchmark_runs ORDER BY created_at DESC, rowid DESC LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		run := &BenchmarkRun{}
+		var label, environment sql.NullString
+		if err := rows.Scan(&run.ID, &label, &environment, &run.CreatedAt); err != nil {
+			return nil, err
+		}
+		run.Label, run.Environment = label.String, environment.String
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return runs, db.loadBenchmarkResults(ctx, runs)
+}
+
+// loadBenchmarkResults fills in the results of runs, in suite order
+func (db *DB) loadBenchmarkResults(ctx context.Context, runs []*BenchmarkRun) error {
+	for _, run := range runs {
+		rows, err := db.conn.QueryContext(ctx,
+			`SELECT name, workflow, job_id, status, wait_ms, run_ms, error, finished_at
+			FROM benchmark_results WHERE run_id = ? ORDER BY rowid`, run.ID,
+		)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			r := &BenchmarkResult{}
+			var jobID, errorMsg sql.NullString
+			var waitMS, runMS int64
+			var finishedAt sql.NullTime
+			if err := rows.Scan(&r.Name, &r.Workflow, &jobID, &r.Status, &waitMS, &runMS, &errorMsg, &finishedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			r.JobID, r.Error = jobID.String, errorMsg.String
+			r.Wait = time.Duration(waitMS) * time.Millisecond
+			r.Run = time.Duration(runMS) * time.Millisecond
+			if finishedAt.Valid {
+				r.FinishedAt = finishedAt.Time
+			}
+			run.Results = append(run.Results, r)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressThreshold is the size above which params/output text is stored
+// zstd-compressed. Small values aren't worth the CPU or the framing overhead.
+const compressThreshold = 4 * 1024
+
+// zstdMagic is the zstd frame header. JSON and file paths never start with
+// it, so it doubles as the marker for compressed column values.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// EncodeAll/DecodeAll are safe for concurrent use, so one of each is shared.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compressField returns the value to store for a heavy text column. Values
+// under compressThreshold are stored as plain text so they stay readable
+// with the sqlite3 CLI.
+func compressField(s string) interface{} {
+	if len(s) < compressThreshold {
+		return s
+	}
+	return zstdEncoder.EncodeAll([]byte(s), nil)
+}
+
+// decompressField reverses compressField. Plain text passes through unchanged.
+func decompressField(s string) (string, error) {
+	if !isCompressed(s) {
+		return s, nil
+	}
+	out, err := zstdDecoder.DecodeAll([]byte(s), nil)
+	if err != nil {
+		return "", fmt.Errorf("decompress field: %w", err)
+	}
+	return string(out), nil
+}
+
+func isCompressed(s string) bool {
+	return len(s) >= len(zstdMagic) && bytes.Equal([]byte(s[:len(zstdMagic)]), zstdMagic)
+}
+
+// needsCompression reports whether a stored value is oversized plain text.
+func needsCompression(s string) bool {
+	return len(s) >= compressThreshold && !isCompressed(s)
+}
@@ -1,10 +1,16 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"log"
 	"time"
 
+	"github.com/druarnfield/diffbox/internal/tracing"
 	_ "github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type DB struct {
@@ -26,6 +32,11 @@ func New(path string) (*DB, error) {
 	return db, nil
 }
 
+// Ping checks that the database can still be queried
+func (db *DB) Ping(ctx context.Context) error {
+	return db.conn.PingContext(ctx)
+}
+
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
@@ -87,6 +98,221 @@ func (db *DB) migrate() error {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
+
+		// Preview frames are large and rewritten on every progress tick, so
+		// they live outside the jobs table to keep job listing scans small.
+		`CREATE TABLE IF NOT EXISTS job_previews (
+			job_id TEXT PRIMARY KEY,
+			preview BLOB NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS users (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			role TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Per-user overrides of the configured quotas. NULL keeps the default.
+		`CREATE TABLE IF NOT EXISTS user_quotas (
+			user_id TEXT PRIMARY KEY,
+			max_queued_jobs INTEGER,
+			gpu_minutes_per_day INTEGER,
+			storage_bytes INTEGER,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS job_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			job_id TEXT NOT NULL,
+			event TEXT NOT NULL,
+			stage TEXT,
+			message TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_job_events_job ON job_events(job_id, id)`,
+
+		`CREATE TABLE IF NOT EXISTS download_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			url TEXT NOT NULL,
+			workflow TEXT,
+			status TEXT NOT NULL,
+			size INTEGER DEFAULT 0,
+			duration_ms INTEGER DEFAULT 0,
+			avg_speed REAL DEFAULT 0,
+			retries INTEGER DEFAULT 0,
+			error TEXT,
+			finished_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Recent run times per job type and resolution, kept across
+		// restarts to estimate how long new jobs will take
+		`CREATE TABLE IF NOT EXISTS job_durations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			job_type TEXT NOT NULL,
+			resolution TEXT NOT NULL,
+			duration_ms INTEGER NOT NULL,
+			completed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_job_durations_type ON job_durations(job_type, resolution, id)`,
+
+		// When each required model file was last needed by a job, keyed by
+		// local filename
+		`CREATE TABLE IF NOT EXISTS model_usage (
+			name TEXT PRIMARY KEY,
+			last_used_at DATETIME,
+			use_count INTEGER DEFAULT 0,
+			pinned INTEGER DEFAULT 0
+		)`,
+
+		// Saved prompt text, reusable across workflows
+		`CREATE TABLE IF NOT EXISTS prompts (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			text TEXT NOT NULL,
+			negative_prompt TEXT,
+			use_count INTEGER DEFAULT 0,
+			last_used_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS prompt_tags (
+			prompt_id TEXT NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (prompt_id, tag)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_prompt_tags_tag ON prompt_tags(tag)`,
+
+		// Input images kept in the content-addressed library, keyed by the
+		// SHA-256 of the file, and which jobs used them
+		`CREATE TABLE IF NOT EXISTS input_images (
+			hash TEXT PRIMARY KEY,
+			format TEXT NOT NULL,
+			width INTEGER NOT NULL,
+			height INTEGER NOT NULL,
+			size INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_used_at DATETIME
+		)`,
+		`CREATE TABLE IF NOT EXISTS job_inputs (
+			job_id TEXT NOT NULL,
+			field TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			PRIMARY KEY (job_id, field)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_job_inputs_hash ON job_inputs(hash)`,
+
+		// Chunked uploads a job reads, so expiry keeps them until it ends
+		`CREATE TABLE IF NOT EXISTS job_uploads (
+			job_id TEXT NOT NULL,
+			upload_id TEXT NOT NULL,
+			PRIMARY KEY (job_id, upload_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_job_uploads_upload ON job_uploads(upload_id)`,
+
+		// Sessions group the jobs of one UI session or experiment
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			user_id TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			archived_at DATETIME
+		)`,
+
+		// Benchmark suite runs and the timing of each job in them, kept
+		// to compare runs across driver, model and hardware changes
+		`CREATE TABLE IF NOT EXISTS benchmark_runs (
+			id TEXT PRIMARY KEY,
+			label TEXT,
+			environment TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS benchmark_results (
+			run_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			workflow TEXT NOT NULL,
+			job_id TEXT,
+			status TEXT NOT NULL,
+			wait_ms INTEGER DEFAULT 0,
+			run_ms INTEGER DEFAULT 0,
+			error TEXT,
+			finished_at DATETIME,
+			PRIMARY KEY (run_id, name)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_benchmark_results_job ON benchmark_results(job_id)`,
+
+		// The aria2 download fetching each model file, so downloads are
+		// found again after a restart
+		`CREATE TABLE IF NOT EXISTS download_gids (
+			name TEXT PRIMARY KEY,
+			gid TEXT NOT NULL,
+			url TEXT,
+			workflow TEXT,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Pipelines: a spec of dependent steps and the job each step
+		// became once its dependencies completed
+		`CREATE TABLE IF NOT EXISTS pipelines (
+			id TEXT PRIMARY KEY,
+			name TEXT,
+			spec TEXT NOT NULL,
+			user_id TEXT,
+			session_id TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS pipeline_steps (
+			pipeline_id TEXT NOT NULL,
+			step_id TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			job_id TEXT,
+			status TEXT NOT NULL,
+			error TEXT,
+			PRIMARY KEY (pipeline_id, step_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_pipeline_steps_job ON pipeline_steps(job_id)`,
+
+		// API requests kept for troubleshooting clients, pruned after the
+		// configured number of days
+		`CREATE TABLE IF NOT EXISTS request_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			at DATETIME NOT NULL,
+			method TEXT NOT NULL,
+			path TEXT NOT NULL,
+			status INTEGER NOT NULL,
+			duration_ms INTEGER NOT NULL,
+			bytes INTEGER NOT NULL,
+			user_id TEXT,
+			remote_addr TEXT,
+			request_id TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_request_log_at ON request_log(at)`,
+
+		// Required model files pointed at a new URL after moving upstream
+		`CREATE TABLE IF NOT EXISTS model_urls (
+			name TEXT PRIMARY KEY,
+			url TEXT NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Time each job spent in each stage of its workflow. A stage can
+		// be entered more than once, so time is summed over its spans;
+		// running_since is set while the job is in it.
+		`CREATE TABLE IF NOT EXISTS job_stages (
+			job_id TEXT NOT NULL,
+			stage TEXT NOT NULL,
+			progress REAL NOT NULL DEFAULT 0,
+			started_at DATETIME NOT NULL,
+			running_since DATETIME,
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (job_id, stage)
+		)`,
 	}
 
 	for _, migration := range migrations {
@@ -95,87 +321,459 @@ func (db *DB) migrate() error {
 		}
 	}
 
+	// Columns added after a table was first created
+	columns := []struct{ table, name, def string }{
+		{"jobs", "started_at", "DATETIME"},
+		{"jobs", "eta_at", "DATETIME"},
+		{"jobs", "label", "TEXT"},
+		{"jobs", "notes", "TEXT"},
+		{"jobs", "queue_pos", "INTEGER"},
+		{"jobs", "dispatched_at", "DATETIME"},
+		{"jobs", "archived_at", "DATETIME"},
+		{"jobs", "repro", "TEXT"},
+		{"jobs", "user_id", "TEXT"},
+		{"download_history", "mirror", "TEXT"},
+		{"jobs", "output_size", "INTEGER"},
+		{"jobs", "session_id", "TEXT"},
+		{"presets", "variables", "TEXT"},
+		{"jobs", "gpu_seconds", "REAL"},
+		{"jobs", "energy_wh", "REAL"},
+	}
+	for _, c := range columns {
+		if err := db.addColumn(c.table, c.name, c.def); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", c.table, c.name, err)
+		}
+	}
+
+	if err := db.compactJobs(); err != nil {
+		return fmt.Errorf("compact jobs: %w", err)
+	}
+
 	return nil
 }
 
+// addColumn adds a column to an existing table unless it's already there
+func (db *DB) addColumn(table, name, def string) error {
+	rows, err := db.conn.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return err
+		}
+		if col == name {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.conn.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, name, def))
+	return err
+}
+
+// compactJobsKey marks that existing job rows have been compressed.
+const compactJobsKey = "migration:compact_jobs"
+
+// compactJobs compresses heavy params/output values written before
+// compression existed, then vacuums so the file actually shrinks. It runs
+// once per database.
+func (db *DB) compactJobs() error {
+	if _, err := db.GetConfig(context.Background(), compactJobsKey); err == nil {
+		return nil
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	// Rows are read and rewritten a batch at a time, each batch in its own
+	// transaction, so a multi-GB table never has to fit in memory
+	rewritten := 0
+	var after int64
+	for {
+		n, last, err := db.compactJobBatch(after)
+		if err != nil {
+			return err
+		}
+		if last == 0 {
+			break
+		}
+		rewritten += n
+		after = last
+	}
+
+	if rewritten > 0 {
+		log.Printf("Compressed %d oversized job rows, vacuuming database", rewritten)
+		if _, err := db.conn.Exec(`VACUUM`); err != nil {
+			return err
+		}
+	}
+
+	return db.SetConfig(context.Background(), compactJobsKey, time.Now().Format(time.RFC3339))
+}
+
+// compactJobBatchSize is how many heavy job rows compactJobs rewrites per
+// transaction
+const compactJobBatchSize = 200
+
+// compactJobBatch compresses the next batch of heavy job rows after rowid
+// after. It returns how many it rewrote and the last rowid read, or 0 once
+// there are none left.
+func (db *DB) compactJobBatch(after int64) (rewritten int, last int64, err error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`SELECT rowid, id, params, output FROM jobs
+		WHERE rowid > ? AND (length(params) >= ? OR length(output) >= ?)
+		ORDER BY rowid LIMIT ?`,
+		after, compressThreshold, compressThreshold, compactJobBatchSize,
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type heavyRow struct {
+		id, params, output string
+	}
+	var heavy []heavyRow
+	for rows.Next() {
+		var r heavyRow
+		var params, output sql.NullString
+		if err := rows.Scan(&last, &r.id, &params, &output); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		r.params, r.output = params.String, output.String
+		heavy = append(heavy, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, r := range heavy {
+		if !needsCompression(r.params) && !needsCompression(r.output) {
+			continue
+		}
+		var output interface{}
+		if r.output != "" {
+			output = compressField(r.output)
+		}
+		if _, err := tx.Exec(
+			`UPDATE jobs SET params = ?, output = ? WHERE id = ?`,
+			compressField(r.params), output, r.id,
+		); err != nil {
+			return 0, 0, err
+		}
+		rewritten++
+	}
+	return rewritten, last, tx.Commit()
+}
+
+// startSpan opens a span for a database operation
+func startSpan(ctx context.Context, op string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "db."+op, attribute.String("db.system", "sqlite"), attribute.String("db.operation", op))
+}
+
 // Job methods
 
 type Job struct {
-	ID        string
-	Type      string
-	Status    string
-	Progress  float64
-	Stage     string
-	Params    string
-	Output    string
-	Error     string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-}
-
-func (db *DB) CreateJob(job *Job) error {
-	_, err := db.conn.Exec(
-		`INSERT INTO jobs (id, type, status, params, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)`,
-		job.ID, job.Type, job.Status, job.Params, time.Now(), time.Now(),
+	ID         string
+	Type       string
+	Status     string
+	Progress   float64
+	Stage      string
+	Params     string
+	Output     string
+	Error      string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	StartedAt  time.Time // Zero until the first progress report
+	ETA        time.Time // Estimated completion, zero if unknown
+	Label      string    // User-given name
+	Notes      string
+	ArchivedAt time.Time // Zero unless the job is archived
+	UserID     string    // Submitter, empty for jobs from before users were tracked
+	SessionID  string    // Empty unless submitted in a session
+	// Metered is set once the job's share of GPU time and power draw
+	// have been recorded
+	Metered    bool
+	GPUSeconds float64
+	EnergyWh   float64
+}
+
+func (db *DB) CreateJob(ctx context.Context, job *Job) (err error) {
+	ctx, span := startSpan(ctx, "CreateJob")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`INSERT INTO jobs (id, type, status, params, created_at, updated_at, user_id, session_id, queue_pos)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, (SELECT COALESCE(MAX(queue_pos), 0) + 1 FROM jobs))`,
+		job.ID, job.Type, job.Status, compressField(job.Params), time.Now(), time.Now(), job.UserID, job.SessionID,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	return recordJobEvent(ctx, db.conn, job.ID, EventQueued, "", "")
+}
+
+const jobColumns = `id, type, status, progress, stage, params, output, error, created_at, updated_at, started_at, eta_at, label, notes, archived_at, user_id, session_id, gpu_seconds, energy_wh`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-func (db *DB) GetJob(id string) (*Job, error) {
+// scanJob reads a row selected with jobColumns, tolerating NULLs and
+// decompressing heavy fields.
+func scanJob(row rowScanner) (*Job, error) {
 	job := &Job{}
-	err := db.conn.QueryRow(
-		`SELECT id, type, status, progress, stage, params, output, error, created_at, updated_at
-		FROM jobs WHERE id = ?`,
-		id,
-	).Scan(&job.ID, &job.Type, &job.Status, &job.Progress, &job.Stage, &job.Params, &job.Output, &job.Error, &job.CreatedAt, &job.UpdatedAt)
+	var stage, params, output, errMsg, label, notes, userID, sessionID sql.NullString
+	var startedAt, etaAt, archivedAt sql.NullTime
+	var gpuSeconds, energyWh sql.NullFloat64
+	err := row.Scan(
+		&job.ID, &job.Type, &job.Status, &job.Progress,
+		&stage, &params, &output, &errMsg,
+		&job.CreatedAt, &job.UpdatedAt,
+		&startedAt, &etaAt, &label, &notes, &archivedAt, &userID, &sessionID,
+		&gpuSeconds, &energyWh,
+	)
 	if err != nil {
 		return nil, err
 	}
+	job.Metered = gpuSeconds.Valid
+	job.GPUSeconds, job.EnergyWh = gpuSeconds.Float64, energyWh.Float64
+	job.StartedAt = startedAt.Time
+	job.ETA = etaAt.Time
+	job.ArchivedAt = archivedAt.Time
+	job.Label = label.String
+	job.Notes = notes.String
+	job.UserID = userID.String
+	job.SessionID = sessionID.String
+	job.Stage = stage.String
+	job.Error = errMsg.String
+	if job.Params, err = decompressField(params.String); err != nil {
+		return nil, fmt.Errorf("job %s params: %w", job.ID, err)
+	}
+	if job.Output, err = decompressField(output.String); err != nil {
+		return nil, fmt.Errorf("job %s output: %w", job.ID, err)
+	}
 	return job, nil
 }
 
-func (db *DB) UpdateJobProgress(id string, progress float64, stage string) error {
-	_, err := db.conn.Exec(
+func (db *DB) GetJob(ctx context.Context, id string) (job *Job, err error) {
+	ctx, span := startSpan(ctx, "GetJob")
+	defer func() { tracing.End(span, err) }()
+
+	return scanJob(db.conn.QueryRowContext(ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE id = ?`,
+		id,
+	))
+}
+
+func (db *DB) UpdateJobProgress(ctx context.Context, id string, progress float64, stage string) (err error) {
+	ctx, span := startSpan(ctx, "UpdateJobProgress")
+	defer func() { tracing.End(span, err) }()
+
+	// The first progress report marks the job as running
+	result, err := db.conn.ExecContext(ctx,
+		`UPDATE jobs SET status = 'running', started_at = ? WHERE id = ? AND status = 'pending'`,
+		time.Now(), id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		if err := recordJobEvent(ctx, db.conn, id, EventRunning, "", ""); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.conn.ExecContext(ctx,
 		`UPDATE jobs SET progress = ?, stage = ?, updated_at = ? WHERE id = ?`,
 		progress, stage, time.Now(), id,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	return recordStageChange(ctx, db.conn, id, stage)
 }
 
-func (db *DB) UpdateJobStatus(id string, status string) error {
-	_, err := db.conn.Exec(
+// UpdateJobAnnotations sets a job's label and notes. Nil values are left
+// unchanged. Returns sql.ErrNoRows if the job doesn't exist.
+func (db *DB) UpdateJobAnnotations(ctx context.Context, id string, label, notes *string) (err error) {
+	ctx, span := startSpan(ctx, "UpdateJobAnnotations")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := db.conn.ExecContext(ctx,
+		`UPDATE jobs SET label = COALESCE(?, label), notes = COALESCE(?, notes) WHERE id = ?`,
+		label, notes, id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (db *DB) UpdateJobStatus(ctx context.Context, id string, status string) (err error) {
+	ctx, span := startSpan(ctx, "UpdateJobStatus")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
 		`UPDATE jobs SET status = ?, updated_at = ? WHERE id = ?`,
 		status, time.Now(), id,
 	)
 	return err
 }
 
-func (db *DB) CompleteJob(id string, output string) error {
-	_, err := db.conn.Exec(
-		`UPDATE jobs SET status = 'completed', output = ?, updated_at = ? WHERE id = ?`,
-		output, time.Now(), id,
+func (db *DB) CompleteJob(ctx context.Context, id string, output string) (err error) {
+	ctx, span := startSpan(ctx, "CompleteJob")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`UPDATE jobs SET status = 'completed', output = ?, eta_at = NULL, updated_at = ? WHERE id = ?`,
+		compressField(output), time.Now(), id,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if err := endJobStages(ctx, db.conn, id, true); err != nil {
+		return err
+	}
+	if err := dropJobPreview(ctx, db.conn, id); err != nil {
+		return err
+	}
+	return recordJobEvent(ctx, db.conn, id, EventCompleted, "", "")
 }
 
-func (db *DB) FailJob(id string, errorMsg string) error {
-	_, err := db.conn.Exec(
-		`UPDATE jobs SET status = 'failed', error = ?, updated_at = ? WHERE id = ?`,
+func (db *DB) FailJob(ctx context.Context, id string, errorMsg string) (err error) {
+	ctx, span := startSpan(ctx, "FailJob")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`UPDATE jobs SET status = 'failed', error = ?, eta_at = NULL, updated_at = ? WHERE id = ?`,
 		errorMsg, time.Now(), id,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if err := endJobStages(ctx, db.conn, id, false); err != nil {
+		return err
+	}
+	if err := dropJobPreview(ctx, db.conn, id); err != nil {
+		return err
+	}
+	return recordJobEvent(ctx, db.conn, id, EventFailed, "", errorMsg)
 }
 
-func (db *DB) ClearJobs() error {
-	_, err := db.conn.Exec(`DELETE FROM jobs`)
-	return err
+// RecoverJobs tidies up after a previous run. Jobs that were still
+// waiting in the queue keep their place and are queued again by the
+// caller; jobs a worker had started can't resume, so they are marked
+// interrupted and their IDs returned. Job history is kept.
+func (db *DB) RecoverJobs(ctx context.Context) (ids []string, err error) {
+	if _, err := db.conn.ExecContext(ctx, `DELETE FROM job_previews`); err != nil {
+		return nil, err
+	}
+	return db.InterruptStartedJobs(ctx, "diffbox restarted before the job finished")
+}
+
+// InterruptJobs marks every unfinished job as interrupted, returning their
+// IDs
+func (db *DB) InterruptJobs(ctx context.Context, reason string) (ids []string, err error) {
+	ctx, span := startSpan(ctx, "InterruptJobs")
+	defer func() { tracing.End(span, err) }()
+
+	return db.interruptJobs(ctx, `status IN ('pending', 'waiting_models', 'running')`, reason)
+}
+
+// InterruptStartedJobs marks the unfinished jobs that are running or were
+// handed to a worker as interrupted, returning their IDs. Jobs still
+// waiting in the queue are left to run later.
+func (db *DB) InterruptStartedJobs(ctx context.Context, reason string) (ids []string, err error) {
+	ctx, span := startSpan(ctx, "InterruptStartedJobs")
+	defer func() { tracing.End(span, err) }()
+
+	return db.interruptJobs(ctx,
+		`status IN ('pending', 'waiting_models', 'running') AND (status = 'running' OR dispatched_at IS NOT NULL)`,
+		reason)
+}
+
+func (db *DB) interruptJobs(ctx context.Context, where, reason string) (ids []string, err error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM jobs WHERE `+where+` ORDER BY queue_pos`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE jobs SET status = 'interrupted', error = ?, eta_at = NULL, updated_at = ? WHERE id = ?`,
+			reason, now, id,
+		); err != nil {
+			return nil, err
+		}
+		if err := endJobStages(ctx, tx, id, false); err != nil {
+			return nil, err
+		}
+		if err := dropJobPreview(ctx, tx, id); err != nil {
+			return nil, err
+		}
+		if err := recordJobEvent(ctx, tx, id, EventInterrupted, "", reason); err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit()
+}
+
+// ListJobs returns the most recent jobs, with archived jobs included or
+// not according to archived
+func (db *DB) ListJobs(ctx context.Context, limit int, archived ArchiveFilter) (jobs []*Job, err error) {
+	ctx, span := startSpan(ctx, "ListJobs")
+	defer func() { tracing.End(span, err) }()
+
+	return db.queryJobs(ctx,
+		`SELECT `+jobColumns+` FROM jobs `+archived.where()+` ORDER BY created_at DESC LIMIT ?`,
+		limit,
+	)
 }
 
-func (db *DB) ListJobs(limit int) ([]*Job, error) {
-	rows, err := db.conn.Query(
-		`SELECT id, type, status, progress, stage, params, output, error, created_at, updated_at
-		FROM jobs ORDER BY created_at DESC LIMIT ?`,
+// ListFailedJobs returns the most recently failed jobs
+func (db *DB) ListFailedJobs(ctx context.Context, limit int) (jobs []*Job, err error) {
+	ctx, span := startSpan(ctx, "ListFailedJobs")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE status = 'failed' ORDER BY updated_at DESC LIMIT ?`,
 		limit,
 	)
 	if err != nil {
@@ -183,43 +781,119 @@ func (db *DB) ListJobs(limit int) ([]*Job, error) {
 	}
 	defer rows.Close()
 
-	var jobs []*Job
 	for rows.Next() {
-		job := &Job{}
-		var stage, output, errMsg sql.NullString
-		err := rows.Scan(
-			&job.ID, &job.Type, &job.Status, &job.Progress,
-			&stage, &job.Params, &output, &errMsg,
-			&job.CreatedAt, &job.UpdatedAt,
-		)
+		job, err := scanJob(rows)
 		if err != nil {
 			return nil, err
 		}
-		job.Stage = stage.String
-		job.Output = output.String
-		job.Error = errMsg.String
 		jobs = append(jobs, job)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
+	return jobs, rows.Err()
+}
 
-	return jobs, nil
+// SaveJobPreview stores the latest preview frame for a job, replacing any
+// previous one.
+func (db *DB) SaveJobPreview(ctx context.Context, jobID string, preview []byte) (err error) {
+	ctx, span := startSpan(ctx, "SaveJobPreview")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`INSERT OR REPLACE INTO job_previews (job_id, preview, updated_at) VALUES (?, ?, ?)`,
+		jobID, preview, time.Now(),
+	)
+	return err
+}
+
+// dropJobPreview deletes the preview frame of a job that has finished, so
+// the table only ever holds frames of running jobs
+func dropJobPreview(ctx context.Context, conn execer, jobID string) error {
+	_, err := conn.ExecContext(ctx, `DELETE FROM job_previews WHERE job_id = ?`, jobID)
+	return err
+}
+
+// GetJobPreview returns the latest preview frame for a job.
+func (db *DB) GetJobPreview(ctx context.Context, jobID string) (preview []byte, err error) {
+	ctx, span := startSpan(ctx, "GetJobPreview")
+	defer func() { tracing.End(span, err) }()
+
+	err = db.conn.QueryRowContext(ctx, `SELECT preview FROM job_previews WHERE job_id = ?`, jobID).Scan(&preview)
+	return preview, err
+}
+
+// GetJobPreviewAfter returns a job's latest preview frame and when it was
+// stored, or a nil frame if it is no newer than after. Watchers poll with
+// it without reading the same frame again.
+func (db *DB) GetJobPreviewAfter(ctx context.Context, jobID string, after time.Time) (preview []byte, updatedAt time.Time, err error) {
+	ctx, span := startSpan(ctx, "GetJobPreviewAfter")
+	defer func() { tracing.End(span, err) }()
+
+	err = db.conn.QueryRowContext(ctx, `SELECT updated_at FROM job_previews WHERE job_id = ?`, jobID).Scan(&updatedAt)
+	if err != nil || !updatedAt.After(after) {
+		return nil, updatedAt, err
+	}
+	err = db.conn.QueryRowContext(ctx, `SELECT preview FROM job_previews WHERE job_id = ?`, jobID).Scan(&preview)
+	return preview, updatedAt, err
 }
 
 // Config methods
 
-func (db *DB) GetConfig(key string) (string, error) {
-	var value string
-	err := db.conn.QueryRow(`SELECT value FROM config WHERE key = ?`, key).Scan(&value)
+func (db *DB) GetConfig(ctx context.Context, key string) (value string, err error) {
+	ctx, span := startSpan(ctx, "GetConfig")
+	defer func() { tracing.End(span, err) }()
+
+	err = db.conn.QueryRowContext(ctx, `SELECT value FROM config WHERE key = ?`, key).Scan(&value)
 	return value, err
 }
 
-func (db *DB) SetConfig(key, value string) error {
-	_, err := db.conn.Exec(
+func (db *DB) SetConfig(ctx context.Context, key, value string) (err error) {
+	ctx, span := startSpan(ctx, "SetConfig")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
 		`INSERT OR REPLACE INTO config (key, value, updated_at) VALUES (?, ?, ?)`,
 		key, value, time.Now(),
 	)
 	return err
 }
+
+// CountActiveJobs returns the number of unfinished jobs by status
+func (db *DB) CountActiveJobs(ctx context.Context) (counts map[string]int, err error) {
+	ctx, span := startSpan(ctx, "CountActiveJobs")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT status, COUNT(*) FROM jobs
+		WHERE status IN ('pending', 'waiting_models', 'running')
+		GROUP BY status`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts = make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// CountUserActiveJobs returns the number of unfinished jobs submitted by
+// userID
+func (db *DB) CountUserActiveJobs(ctx context.Context, userID string) (n int, err error) {
+	ctx, span := startSpan(ctx, "CountUserActiveJobs")
+	defer func() { tracing.End(span, err) }()
+
+	err = db.conn.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM jobs
+		WHERE user_id = ? AND status IN ('pending', 'waiting_models', 'running')`,
+		userID,
+	).Scan(&n)
+	return n, err
+}
@@ -1,6 +1,11 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -13,44 +18,106 @@ func setupTestDB(t *testing.T) *DB {
 	return db
 }
 
-func TestClearJobs(t *testing.T) {
+func TestRecoverJobs(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
+	ctx := context.Background()
 
-	// Create some test jobs
 	jobs := []*Job{
 		{ID: "job-1", Type: "i2v", Status: "pending", Params: "{}"},
 		{ID: "job-2", Type: "svi", Status: "running", Params: "{}"},
 		{ID: "job-3", Type: "qwen", Status: "completed", Params: "{}"},
+		{ID: "job-4", Type: "i2v", Status: "pending", Params: "{}"},
 	}
-
 	for _, job := range jobs {
-		if err := db.CreateJob(job); err != nil {
+		if err := db.CreateJob(ctx, job); err != nil {
 			t.Fatalf("failed to create job: %v", err)
 		}
 	}
+	if err := db.MarkJobDispatched(ctx, "job-4"); err != nil {
+		t.Fatalf("failed to mark job dispatched: %v", err)
+	}
+	if err := db.SaveJobPreview(ctx, "job-2", []byte("frame")); err != nil {
+		t.Fatalf("failed to save preview: %v", err)
+	}
+
+	ids, err := db.RecoverJobs(ctx)
+	if err != nil {
+		t.Fatalf("RecoverJobs failed: %v", err)
+	}
+	if strings.Join(ids, ",") != "job-2,job-4" {
+		t.Errorf("expected job-2 and job-4 to be interrupted, got %v", ids)
+	}
 
-	// Verify jobs exist
-	jobList, err := db.ListJobs(10)
+	// History is kept; jobs still queued keep their place
+	jobList, err := db.ListJobs(ctx, 10, ExcludeArchived)
 	if err != nil {
 		t.Fatalf("failed to list jobs: %v", err)
 	}
-	if len(jobList) != 3 {
-		t.Fatalf("expected 3 jobs, got %d", len(jobList))
+	if len(jobList) != 4 {
+		t.Fatalf("expected 4 jobs after recovery, got %d", len(jobList))
+	}
+	for _, job := range jobList {
+		want := "interrupted"
+		switch job.ID {
+		case "job-1":
+			want = "pending"
+		case "job-3":
+			want = "completed"
+		}
+		if job.Status != want {
+			t.Errorf("job %s: expected status %s, got %s", job.ID, want, job.Status)
+		}
+	}
+
+	if _, err := db.GetJobPreview(ctx, "job-2"); err != sql.ErrNoRows {
+		t.Errorf("expected previews to be cleared, got %v", err)
+	}
+}
+
+func TestInterruptJobs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	jobs := []*Job{
+		{ID: "job-1", Type: "i2v", Status: "running", Params: "{}"},
+		{ID: "job-2", Type: "qwen", Status: "pending", Params: "{}"},
+		{ID: "job-3", Type: "qwen", Status: "completed", Params: "{}"},
+	}
+	for _, job := range jobs {
+		if err := db.CreateJob(ctx, job); err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
 	}
 
-	// Clear all jobs
-	if err := db.ClearJobs(); err != nil {
-		t.Fatalf("failed to clear jobs: %v", err)
+	ids, err := db.InterruptJobs(ctx, "server shutdown")
+	if err != nil {
+		t.Fatalf("InterruptJobs failed: %v", err)
+	}
+	if strings.Join(ids, ",") != "job-1,job-2" {
+		t.Errorf("expected job-1 and job-2 to be interrupted, got %v", ids)
 	}
 
-	// Verify table is empty
-	jobList, err = db.ListJobs(10)
+	// Interrupted jobs survive startup recovery untouched, with their history
+	if ids, err := db.RecoverJobs(ctx); err != nil || len(ids) != 0 {
+		t.Fatalf("expected nothing left to recover, got %v, %v", ids, err)
+	}
+	for _, id := range []string{"job-1", "job-2"} {
+		job, err := db.GetJob(ctx, id)
+		if err != nil {
+			t.Fatalf("failed to get job: %v", err)
+		}
+		if job.Status != "interrupted" || job.Error != "server shutdown" {
+			t.Errorf("unexpected job after recovery: %+v", job)
+		}
+	}
+	events, err := db.ListJobEvents(ctx, "job-1")
 	if err != nil {
-		t.Fatalf("failed to list jobs after clear: %v", err)
+		t.Fatalf("failed to list job events: %v", err)
 	}
-	if len(jobList) != 0 {
-		t.Fatalf("expected 0 jobs after clear, got %d", len(jobList))
+	if len(events) == 0 || events[len(events)-1].Event != EventInterrupted {
+		t.Errorf("expected an interrupted event, got %+v", events)
 	}
 }
 
@@ -82,7 +149,7 @@ func TestListJobs(t *testing.T) {
 	}
 
 	// Test listing all jobs - should be in DESC order (newest first)
-	jobList, err := db.ListJobs(10)
+	jobList, err := db.ListJobs(context.Background(), 10, ExcludeArchived)
 	if err != nil {
 		t.Fatalf("failed to list jobs: %v", err)
 	}
@@ -102,7 +169,7 @@ func TestListJobs(t *testing.T) {
 	}
 
 	// Test limit
-	limitedList, err := db.ListJobs(2)
+	limitedList, err := db.ListJobs(context.Background(), 2, ExcludeArchived)
 	if err != nil {
 		t.Fatalf("failed to list jobs with limit: %v", err)
 	}
@@ -114,7 +181,7 @@ func TestListJobs(t *testing.T) {
 	}
 
 	// Test with limit 0 - should return empty
-	emptyList, err := db.ListJobs(0)
+	emptyList, err := db.ListJobs(context.Background(), 0, ExcludeArchived)
 	if err != nil {
 		t.Fatalf("failed to list jobs with limit 0: %v", err)
 	}
@@ -129,12 +196,12 @@ func TestListJobsWithNullFields(t *testing.T) {
 
 	// Create a job with minimal fields (stage, output, error will be NULL)
 	job := &Job{ID: "job-nulls", Type: "i2v", Status: "pending", Params: "{}"}
-	if err := db.CreateJob(job); err != nil {
+	if err := db.CreateJob(context.Background(), job); err != nil {
 		t.Fatalf("failed to create job: %v", err)
 	}
 
 	// List should handle NULL fields gracefully
-	jobList, err := db.ListJobs(10)
+	jobList, err := db.ListJobs(context.Background(), 10, ExcludeArchived)
 	if err != nil {
 		t.Fatalf("failed to list jobs with null fields: %v", err)
 	}
@@ -153,3 +220,1380 @@ func TestListJobsWithNullFields(t *testing.T) {
 		t.Errorf("expected empty error for null field, got %s", jobList[0].Error)
 	}
 }
+
+func TestJobFieldCompression(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	bigParams := `{"prompt":"` + strings.Repeat("a", 2*compressThreshold) + `"}`
+	bigOutput := "/outputs/" + strings.Repeat("b", 2*compressThreshold) + ".mp4"
+
+	if err := db.CreateJob(context.Background(), &Job{ID: "job-big", Type: "i2v", Status: "pending", Params: bigParams}); err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+	if err := db.CompleteJob(context.Background(), "job-big", bigOutput); err != nil {
+		t.Fatalf("failed to complete job: %v", err)
+	}
+
+	// Stored values should be compressed
+	var rawParams, rawOutput []byte
+	if err := db.conn.QueryRow(`SELECT params, output FROM jobs WHERE id = ?`, "job-big").Scan(&rawParams, &rawOutput); err != nil {
+		t.Fatalf("failed to read raw row: %v", err)
+	}
+	if !isCompressed(string(rawParams)) || len(rawParams) >= len(bigParams) {
+		t.Errorf("expected params to be stored compressed, got %d bytes", len(rawParams))
+	}
+	if !isCompressed(string(rawOutput)) {
+		t.Error("expected output to be stored compressed")
+	}
+
+	// Reads should be transparent
+	job, err := db.GetJob(context.Background(), "job-big")
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+	if job.Params != bigParams {
+		t.Error("params did not round-trip")
+	}
+	if job.Output != bigOutput {
+		t.Error("output did not round-trip")
+	}
+
+	// Small values stay plain text
+	if err := db.CreateJob(context.Background(), &Job{ID: "job-small", Type: "qwen", Status: "pending", Params: "{}"}); err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+	var raw string
+	if err := db.conn.QueryRow(`SELECT params FROM jobs WHERE id = ?`, "job-small").Scan(&raw); err != nil {
+		t.Fatalf("failed to read raw row: %v", err)
+	}
+	if raw != "{}" {
+		t.Errorf("expected small params stored as plain text, got %q", raw)
+	}
+}
+
+func TestCompactJobs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// Simulate rows written before compression existed, more than one
+	// batch of them
+	bigParams := `{"input_image":"` + strings.Repeat("x", 2*compressThreshold) + `"}`
+	for i := 0; i <= compactJobBatchSize; i++ {
+		id := fmt.Sprintf("job-old-%d", i)
+		if i == compactJobBatchSize {
+			id = "job-legacy"
+		}
+		if _, err := db.conn.Exec(
+			`INSERT INTO jobs (id, type, status, params) VALUES (?, ?, ?, ?)`,
+			id, "i2v", "completed", bigParams,
+		); err != nil {
+			t.Fatalf("failed to insert legacy job: %v", err)
+		}
+	}
+	if _, err := db.conn.Exec(`DELETE FROM config WHERE key = ?`, compactJobsKey); err != nil {
+		t.Fatalf("failed to reset migration marker: %v", err)
+	}
+
+	if err := db.compactJobs(); err != nil {
+		t.Fatalf("compactJobs failed: %v", err)
+	}
+
+	var raw []byte
+	if err := db.conn.QueryRow(`SELECT params FROM jobs WHERE id = ?`, "job-legacy").Scan(&raw); err != nil {
+		t.Fatalf("failed to read raw row: %v", err)
+	}
+	if !isCompressed(string(raw)) {
+		t.Error("expected legacy params to be compressed by migration")
+	}
+
+	job, err := db.GetJob(context.Background(), "job-legacy")
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+	if job.Params != bigParams {
+		t.Error("legacy params did not round-trip after compaction")
+	}
+}
+
+func TestJobPreview(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if err := db.SaveJobPreview(ctx, "job-1", []byte("frame-1")); err != nil {
+		t.Fatalf("failed to save preview: %v", err)
+	}
+	if err := db.SaveJobPreview(ctx, "job-1", []byte("frame-2")); err != nil {
+		t.Fatalf("failed to replace preview: %v", err)
+	}
+
+	preview, err := db.GetJobPreview(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("failed to get preview: %v", err)
+	}
+	if string(preview) != "frame-2" {
+		t.Errorf("expected latest preview frame-2, got %q", preview)
+	}
+
+	if _, err := db.GetJobPreview(ctx, "missing"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for missing preview, got %v", err)
+	}
+
+	// Finishing the job drops its frame
+	if err := db.CreateJob(ctx, &Job{ID: "job-1", Type: "i2v", Status: "running", Params: "{}"}); err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+	if err := db.CompleteJob(ctx, "job-1", "out.mp4"); err != nil {
+		t.Fatalf("failed to complete job: %v", err)
+	}
+	if _, err := db.GetJobPreview(ctx, "job-1"); err != sql.ErrNoRows {
+		t.Errorf("expected the preview dropped with the job finished, got %v", err)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if err := db.CreateUser(ctx, &User{ID: "u1", Name: "alice", Role: "admin", TokenHash: "hash-1"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	user, err := db.GetUserByTokenHash(ctx, "hash-1")
+	if err != nil {
+		t.Fatalf("failed to look up user: %v", err)
+	}
+	if user == nil || user.Name != "alice" || user.Role != "admin" {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	if user, err := db.GetUserByTokenHash(ctx, "unknown"); err != nil || user != nil {
+		t.Errorf("expected nil user for unknown token, got %+v (err %v)", user, err)
+	}
+
+	rotated, err := db.SetUserTokenHash(ctx, "u1", "hash-2")
+	if err != nil || !rotated {
+		t.Fatalf("expected token rotation, got rotated=%v err=%v", rotated, err)
+	}
+	if user, _ := db.GetUserByTokenHash(ctx, "hash-1"); user != nil {
+		t.Error("old token should no longer resolve")
+	}
+
+	if err := db.DeleteUser(ctx, "u1"); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	if err := db.DeleteUser(ctx, "u1"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows deleting missing user, got %v", err)
+	}
+}
+
+func TestJobEvents(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if err := db.CreateJob(ctx, &Job{ID: "job-1", Type: "i2v", Status: "pending", Params: "{}"}); err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+	if err := db.RecordJobEvent(ctx, "job-1", EventDispatched, ""); err != nil {
+		t.Fatalf("failed to record dispatch: %v", err)
+	}
+	for _, stage := range []string{"Loading models", "Loading models", "Denoising", "Denoising"} {
+		if err := db.UpdateJobProgress(ctx, "job-1", 0.5, stage); err != nil {
+			t.Fatalf("failed to update progress: %v", err)
+		}
+	}
+	if err := db.CompleteJob(ctx, "job-1", "/outputs/job-1.mp4"); err != nil {
+		t.Fatalf("failed to complete job: %v", err)
+	}
+
+	events, err := db.ListJobEvents(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("failed to list events: %v", err)
+	}
+
+	expected := []struct{ event, stage string }{
+		{EventQueued, ""},
+		{EventDispatched, ""},
+		{EventRunning, ""},
+		{EventStage, "Loading models"},
+		{EventStage, "Denoising"},
+		{EventCompleted, ""},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(events))
+	}
+	for i, e := range expected {
+		if events[i].Event != e.event || events[i].Stage != e.stage {
+			t.Errorf("event %d: expected %s/%q, got %s/%q", i, e.event, e.stage, events[i].Event, events[i].Stage)
+		}
+	}
+
+	job, err := db.GetJob(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+	if job.Status != "completed" {
+		t.Errorf("expected completed status, got %s", job.Status)
+	}
+}
+
+func TestDownloadHistory(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	now := time.Now()
+	records := []*DownloadRecord{
+		{Name: "vae.safetensors", URL: "https://hf/vae", Mirror: "hf-mirror.com", Workflow: "i2v", Status: "complete", Size: 254_000_000, DurationMs: 10_000, AvgSpeed: 25_400_000, FinishedAt: now.Add(-time.Minute)},
+		{Name: "dit.safetensors", URL: "https://hf/dit", Workflow: "i2v", Status: "failed", Size: 1_000, Retries: 3, Error: "timeout", FinishedAt: now},
+	}
+	for _, rec := range records {
+		if err := db.RecordDownload(ctx, rec); err != nil {
+			t.Fatalf("failed to record download: %v", err)
+		}
+	}
+
+	history, err := db.ListDownloadHistory(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to list history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(history))
+	}
+	if history[0].Name != "dit.safetensors" || history[0].Retries != 3 || history[0].Error != "timeout" {
+		t.Errorf("expected newest failed download first, got %+v", history[0])
+	}
+	if history[1].AvgSpeed != 25_400_000 || history[1].Mirror != "hf-mirror.com" {
+		t.Errorf("expected avg speed and mirror to round-trip, got %+v", history[1])
+	}
+}
+
+func TestJobDurationsAndETA(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, ok, err := db.ExpectedJobDuration(ctx, "i2v", "832x480x81"); err != nil || ok {
+		t.Fatalf("expected no history, got ok=%v err=%v", ok, err)
+	}
+
+	for _, d := range []time.Duration{4 * time.Minute, 6 * time.Minute} {
+		if err := db.RecordJobDuration(ctx, "i2v", "832x480x81", d); err != nil {
+			t.Fatalf("failed to record duration: %v", err)
+		}
+	}
+	if err := db.RecordJobDuration(ctx, "i2v", "1280x720x81", 20*time.Minute); err != nil {
+		t.Fatalf("failed to record duration: %v", err)
+	}
+
+	d, ok, err := db.ExpectedJobDuration(ctx, "i2v", "832x480x81")
+	if err != nil || !ok || d != 5*time.Minute {
+		t.Errorf("expected 5m for matching resolution, got %v ok=%v err=%v", d, ok, err)
+	}
+	// Unknown resolutions fall back to every run of the type
+	d, ok, err = db.ExpectedJobDuration(ctx, "i2v", "640x640x33")
+	if err != nil || !ok || d != 10*time.Minute {
+		t.Errorf("expected 10m type-wide fallback, got %v ok=%v err=%v", d, ok, err)
+	}
+
+	if err := db.CreateJob(ctx, &Job{ID: "job-1", Type: "i2v", Status: "pending"}); err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+	if err := db.UpdateJobProgress(ctx, "job-1", 0.1, "Sampling"); err != nil {
+		t.Fatalf("failed to update progress: %v", err)
+	}
+	eta := time.Now().Add(3 * time.Minute)
+	if err := db.SetJobETA(ctx, "job-1", eta); err != nil {
+		t.Fatalf("failed to set ETA: %v", err)
+	}
+
+	job, err := db.GetJob(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+	if job.StartedAt.IsZero() {
+		t.Error("expected started_at to be set by the first progress report")
+	}
+	if !job.ETA.Equal(eta) {
+		t.Errorf("expected ETA %v, got %v", eta, job.ETA)
+	}
+
+	if err := db.CompleteJob(ctx, "job-1", "/outputs/job-1.mp4"); err != nil {
+		t.Fatalf("failed to complete job: %v", err)
+	}
+	job, _ = db.GetJob(ctx, "job-1")
+	if !job.ETA.IsZero() {
+		t.Errorf("expected ETA cleared on completion, got %v", job.ETA)
+	}
+}
+
+func TestJobAnnotations(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if err := db.CreateJob(ctx, &Job{ID: "job-1", Type: "i2v", Status: "pending"}); err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+
+	label, notes := "hero shot v3", "good motion"
+	if err := db.UpdateJobAnnotations(ctx, "job-1", &label, &notes); err != nil {
+		t.Fatalf("failed to annotate job: %v", err)
+	}
+
+	// Nil leaves a field as it was
+	relabel := "hero shot v4"
+	if err := db.UpdateJobAnnotations(ctx, "job-1", &relabel, nil); err != nil {
+		t.Fatalf("failed to relabel job: %v", err)
+	}
+
+	job, err := db.GetJob(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+	if job.Label != "hero shot v4" || job.Notes != "good motion" {
+		t.Errorf("unexpected annotations: label=%q notes=%q", job.Label, job.Notes)
+	}
+
+	if err := db.UpdateJobAnnotations(ctx, "missing", &label, nil); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for missing job, got %v", err)
+	}
+}
+
+func TestCountActiveJobs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	for id, status := range map[string]string{
+		"job-1": "pending",
+		"job-2": "pending",
+		"job-3": "running",
+		"job-4": "completed",
+		"job-5": "failed",
+	} {
+		if err := db.CreateJob(ctx, &Job{ID: id, Type: "i2v", Status: status}); err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+	}
+
+	counts, err := db.CountActiveJobs(ctx)
+	if err != nil {
+		t.Fatalf("failed to count jobs: %v", err)
+	}
+	if counts["pending"] != 2 || counts["running"] != 1 || len(counts) != 2 {
+		t.Errorf("unexpected counts: %v", counts)
+	}
+}
+
+func TestCountUserActiveJobs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, j := range []*Job{
+		{ID: "job-1", Status: "pending", UserID: "alice"},
+		{ID: "job-2", Status: "running", UserID: "alice"},
+		{ID: "job-3", Status: "completed", UserID: "alice"},
+		{ID: "job-4", Status: "pending", UserID: "bob"},
+	} {
+		j.Type = "i2v"
+		if err := db.CreateJob(ctx, j); err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+	}
+
+	n, err := db.CountUserActiveJobs(ctx, "alice")
+	if err != nil {
+		t.Fatalf("CountUserActiveJobs failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 active jobs for alice, got %d", n)
+	}
+
+	job, err := db.GetJob(ctx, "job-4")
+	if err != nil {
+		t.Fatalf("GetJob failed: %v", err)
+	}
+	if job.UserID != "bob" {
+		t.Errorf("expected user bob, got %q", job.UserID)
+	}
+}
+
+func TestUserQuotaAndUsage(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	q, err := db.GetUserQuota(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetUserQuota failed: %v", err)
+	}
+	if q.MaxQueuedJobs != nil || q.GPUMinutesPerDay != nil || q.StorageBytes != nil {
+		t.Errorf("expected no overrides, got %+v", q)
+	}
+
+	maxJobs, storage := 3, int64(1<<30)
+	if err := db.SetUserQuota(ctx, &UserQuota{UserID: "alice", MaxQueuedJobs: &maxJobs, StorageBytes: &storage}); err != nil {
+		t.Fatalf("SetUserQuota failed: %v", err)
+	}
+	q, err = db.GetUserQuota(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetUserQuota failed: %v", err)
+	}
+	if q.MaxQueuedJobs == nil || *q.MaxQueuedJobs != 3 || q.GPUMinutesPerDay != nil || q.StorageBytes == nil || *q.StorageBytes != 1<<30 {
+		t.Errorf("unexpected quota %+v", q)
+	}
+
+	for _, j := range []*Job{
+		{ID: "job-1", Status: "completed", UserID: "alice"},
+		{ID: "job-2", Status: "pending", UserID: "alice"},
+		{ID: "job-3", Status: "pending", UserID: "bob"},
+		{ID: "job-4", Status: "pending", UserID: "alice"},
+	} {
+		j.Type = "i2v"
+		if err := db.CreateJob(ctx, j); err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+	}
+	now := time.Now()
+	if _, err := db.conn.Exec(`UPDATE jobs SET started_at = ?, updated_at = ? WHERE id = 'job-1'`,
+		now.Add(-10*time.Minute), now.Add(-5*time.Minute)); err != nil {
+		t.Fatalf("failed to set times: %v", err)
+	}
+	if err := db.SetJobOutputSize(ctx, "job-1", 1000); err != nil {
+		t.Fatalf("SetJobOutputSize failed: %v", err)
+	}
+
+	usage, err := db.GetUserUsage(ctx, "alice", now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("GetUserUsage failed: %v", err)
+	}
+	if usage.ActiveJobs != 2 || usage.StorageBytes != 1000 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+	if usage.GPUSeconds < 299 || usage.GPUSeconds > 301 {
+		t.Errorf("expected ~300 GPU seconds, got %v", usage.GPUSeconds)
+	}
+
+	usage, err = db.GetUserUsage(ctx, "alice", now.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("GetUserUsage failed: %v", err)
+	}
+	if usage.GPUSeconds != 0 {
+		t.Errorf("expected jobs before the window to be excluded, got %v", usage.GPUSeconds)
+	}
+
+	owners, err := db.ListQueuedJobOwners(ctx)
+	if err != nil {
+		t.Fatalf("ListQueuedJobOwners failed: %v", err)
+	}
+	want := []QueuedJobOwner{{"job-2", "alice"}, {"job-3", "bob"}, {"job-4", "alice"}}
+	if len(owners) != len(want) {
+		t.Fatalf("expected %d queued jobs, got %+v", len(want), owners)
+	}
+	for i := range want {
+		if owners[i] != want[i] {
+			t.Errorf("owner %d: expected %+v, got %+v", i, want[i], owners[i])
+		}
+	}
+}
+
+func TestInputImages(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, hash := range []string{"aaa", "bbb"} {
+		created, err := db.SaveInputImage(ctx, &InputImage{Hash: hash, Format: "png", Width: 64, Height: 64, Size: 100})
+		if err != nil || !created {
+			t.Fatalf("SaveInputImage(%s) = %v, %v", hash, created, err)
+		}
+	}
+	created, err := db.SaveInputImage(ctx, &InputImage{Hash: "aaa", Format: "png", Width: 64, Height: 64, Size: 100})
+	if err != nil || created {
+		t.Fatalf("expected duplicate to be ignored, got %v, %v", created, err)
+	}
+
+	if err := db.CreateJob(ctx, &Job{ID: "job-1", Type: "qwen", Status: "pending"}); err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+	err = db.RecordJobInputs(ctx, []JobInput{
+		{JobID: "job-1", Field: "edit_images[0]", Hash: "aaa"},
+		{JobID: "job-1", Field: "edit_images[1]", Hash: "aaa"},
+		// A job since purged no longer holds its image
+		{JobID: "purged", Field: "input_image", Hash: "bbb"},
+	})
+	if err != nil {
+		t.Fatalf("RecordJobInputs failed: %v", err)
+	}
+
+	img, err := db.GetInputImage(ctx, "aaa")
+	if err != nil {
+		t.Fatalf("GetInputImage failed: %v", err)
+	}
+	if img.Jobs != 1 || img.LastUsedAt.IsZero() {
+		t.Errorf("expected one job and a last use, got %+v", img)
+	}
+
+	unused, err := db.ListInputImages(ctx, true)
+	if err != nil {
+		t.Fatalf("ListInputImages failed: %v", err)
+	}
+	if len(unused) != 1 || unused[0].Hash != "bbb" {
+		t.Errorf("expected only bbb to be unused, got %+v", unused)
+	}
+
+	uses, err := db.ListImageJobs(ctx, "aaa")
+	if err != nil {
+		t.Fatalf("ListImageJobs failed: %v", err)
+	}
+	if len(uses) != 2 || uses[0].JobID != "job-1" || uses[0].Field != "edit_images[0]" {
+		t.Errorf("unexpected uses %+v", uses)
+	}
+	jobInputs, err := db.ListJobInputs(ctx, "job-1")
+	if err != nil || len(jobInputs) != 2 {
+		t.Errorf("ListJobInputs = %+v, %v", jobInputs, err)
+	}
+
+	if err := db.DeleteInputImage(ctx, "bbb"); err != nil {
+		t.Fatalf("DeleteInputImage failed: %v", err)
+	}
+	if _, err := db.GetInputImage(ctx, "bbb"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows after delete, got %v", err)
+	}
+	if err := db.DeleteInputImage(ctx, "bbb"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows deleting twice, got %v", err)
+	}
+}
+
+func TestModelUsage(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if err := db.RecordModelUse(ctx, []string{"a.safetensors", "b.safetensors"}); err != nil {
+		t.Fatalf("RecordModelUse failed: %v", err)
+	}
+	if err := db.RecordModelUse(ctx, []string{"a.safetensors"}); err != nil {
+		t.Fatalf("RecordModelUse failed: %v", err)
+	}
+	if err := db.SetModelPinned(ctx, "c.safetensors", true); err != nil {
+		t.Fatalf("SetModelPinned failed: %v", err)
+	}
+
+	usage, err := db.ListModelUsage(ctx)
+	if err != nil {
+		t.Fatalf("ListModelUsage failed: %v", err)
+	}
+	if len(usage) != 3 {
+		t.Fatalf("expected 3 models, got %d", len(usage))
+	}
+	if a := usage["a.safetensors"]; a.UseCount != 2 || a.LastUsedAt == nil || a.Pinned {
+		t.Errorf("unexpected usage for a: %+v", a)
+	}
+	if c := usage["c.safetensors"]; c.LastUsedAt != nil || !c.Pinned {
+		t.Errorf("pinned-only model should have no last use: %+v", c)
+	}
+
+	// Recording use keeps the pin
+	if err := db.RecordModelUse(ctx, []string{"c.safetensors"}); err != nil {
+		t.Fatalf("RecordModelUse failed: %v", err)
+	}
+	usage, _ = db.ListModelUsage(ctx)
+	if c := usage["c.safetensors"]; !c.Pinned || c.UseCount != 1 {
+		t.Errorf("pin lost after use: %+v", c)
+	}
+}
+
+func TestMoveJob(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := db.CreateJob(ctx, &Job{ID: id, Type: "qwen", Status: "pending", Params: "{}"}); err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+	}
+	if err := db.MarkJobDispatched(ctx, "a"); err != nil {
+		t.Fatalf("MarkJobDispatched failed: %v", err)
+	}
+
+	steps := []struct {
+		id, where string
+		want      []string
+		pos       int
+	}{
+		{"d", MoveTop, []string{"d", "b", "c"}, 1},
+		{"d", MoveDown, []string{"b", "d", "c"}, 2},
+		{"b", MoveBottom, []string{"d", "c", "b"}, 3},
+		{"c", MoveUp, []string{"c", "d", "b"}, 1},
+		{"c", MoveUp, []string{"c", "d", "b"}, 1},
+	}
+	for _, step := range steps {
+		pos, err := db.MoveJob(ctx, step.id, step.where)
+		if err != nil {
+			t.Fatalf("MoveJob(%s, %s) failed: %v", step.id, step.where, err)
+		}
+		ids, err := db.ListQueuedJobIDs(ctx)
+		if err != nil {
+			t.Fatalf("ListQueuedJobIDs failed: %v", err)
+		}
+		if strings.Join(ids, ",") != strings.Join(step.want, ",") || pos != step.pos {
+			t.Errorf("after moving %s %s: got %v at %d, want %v at %d", step.id, step.where, ids, pos, step.want, step.pos)
+		}
+	}
+
+	// New submissions still go to the back
+	if err := db.CreateJob(ctx, &Job{ID: "e", Type: "qwen", Status: "pending", Params: "{}"}); err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+	ids, _ := db.ListQueuedJobIDs(ctx)
+	if ids[len(ids)-1] != "e" {
+		t.Errorf("expected new job last, got %v", ids)
+	}
+
+	if _, err := db.MoveJob(ctx, "a", MoveTop); err != ErrJobNotQueued {
+		t.Errorf("expected ErrJobNotQueued for a dispatched job, got %v", err)
+	}
+	if _, err := db.MoveJob(ctx, "missing", MoveTop); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for an unknown job, got %v", err)
+	}
+}
+
+func TestListQueuedAndDispatchedJobs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := db.CreateJob(ctx, &Job{ID: id, Type: "i2v", Status: "pending", Params: "{}"}); err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+	}
+	if err := db.MarkJobDispatched(ctx, "a"); err != nil {
+		t.Fatalf("MarkJobDispatched failed: %v", err)
+	}
+	if _, err := db.MoveJob(ctx, "c", MoveTop); err != nil {
+		t.Fatalf("MoveJob failed: %v", err)
+	}
+
+	queued, err := db.ListQueuedJobs(ctx)
+	if err != nil {
+		t.Fatalf("ListQueuedJobs failed: %v", err)
+	}
+	if len(queued) != 2 || queued[0].ID != "c" || queued[1].ID != "b" {
+		t.Errorf("unexpected queued jobs %v", queued)
+	}
+
+	dispatched, err := db.ListDispatchedJobs(ctx)
+	if err != nil {
+		t.Fatalf("ListDispatchedJobs failed: %v", err)
+	}
+	if len(dispatched) != 1 || dispatched[0].ID != "a" {
+		t.Errorf("unexpected dispatched jobs %v", dispatched)
+	}
+	// Dispatched jobs count as running once they report progress
+	if running, _ := db.ListRunningJobs(ctx); len(running) != 0 {
+		t.Errorf("unexpected running jobs %v", running)
+	}
+	if err := db.UpdateJobProgress(ctx, "a", 0.5, "Sampling"); err != nil {
+		t.Fatalf("UpdateJobProgress failed: %v", err)
+	}
+	if running, err := db.ListRunningJobs(ctx); err != nil || len(running) != 1 || running[0].Progress != 0.5 {
+		t.Errorf("ListRunningJobs = %v, %v", running, err)
+	}
+
+	// Finished jobs leave both lists
+	if err := db.CompleteJob(ctx, "a", "out.mp4"); err != nil {
+		t.Fatalf("CompleteJob failed: %v", err)
+	}
+	if dispatched, _ := db.ListDispatchedJobs(ctx); len(dispatched) != 0 {
+		t.Errorf("completed job still listed as dispatched")
+	}
+}
+
+func TestPrompts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	prompts := []*Prompt{
+		{ID: "p1", Name: "Slow pan", Text: "camera pans slowly across a forest", Tags: []string{"camera", "nature"}},
+		{ID: "p2", Name: "Portrait", Text: "studio portrait, 50% soft light", Tags: []string{"people"}},
+		{ID: "p3", Name: "Ocean", Text: "waves crash on rocks", Tags: []string{"nature"}},
+	}
+	for _, p := range prompts {
+		if err := db.CreatePrompt(ctx, p); err != nil {
+			t.Fatalf("CreatePrompt failed: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := db.RecordPromptUse(ctx, "p3"); err != nil {
+			t.Fatalf("RecordPromptUse failed: %v", err)
+		}
+	}
+	if err := db.RecordPromptUse(ctx, "missing"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for unknown prompt, got %v", err)
+	}
+
+	ids := func(ps []*Prompt) string {
+		var out []string
+		for _, p := range ps {
+			out = append(out, p.ID)
+		}
+		return strings.Join(out, ",")
+	}
+	tests := []struct {
+		filter PromptFilter
+		want   string
+	}{
+		{PromptFilter{}, "p3,p2,p1"},
+		{PromptFilter{Tags: []string{"nature"}}, "p3,p1"},
+		{PromptFilter{Tags: []string{"nature", "camera"}}, "p1"},
+		{PromptFilter{Query: "portrait"}, "p2"},
+		{PromptFilter{Query: "50%"}, "p2"},
+		{PromptFilter{Query: "%"}, "p2"},
+	}
+	for _, tt := range tests {
+		got, err := db.ListPrompts(ctx, tt.filter)
+		if err != nil {
+			t.Fatalf("ListPrompts failed: %v", err)
+		}
+		if ids(got) != tt.want {
+			t.Errorf("ListPrompts(%+v) = %s, want %s", tt.filter, ids(got), tt.want)
+		}
+	}
+
+	p, err := db.GetPrompt(ctx, "p3")
+	if err != nil {
+		t.Fatalf("GetPrompt failed: %v", err)
+	}
+	if p.UseCount != 2 || p.LastUsedAt == nil || strings.Join(p.Tags, ",") != "nature" {
+		t.Errorf("unexpected prompt %+v", p)
+	}
+
+	p.Tags = []string{"sea"}
+	if err := db.UpdatePrompt(ctx, p); err != nil {
+		t.Fatalf("UpdatePrompt failed: %v", err)
+	}
+	tags, err := db.ListPromptTags(ctx)
+	if err != nil {
+		t.Fatalf("ListPromptTags failed: %v", err)
+	}
+	if len(tags) != 4 || tags[0] != (TagCount{"camera", 1}) {
+		t.Errorf("unexpected tags %v", tags)
+	}
+
+	if err := db.DeletePrompt(ctx, "p3"); err != nil {
+		t.Fatalf("DeletePrompt failed: %v", err)
+	}
+	if _, err := db.GetPrompt(ctx, "p3"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows after delete, got %v", err)
+	}
+}
+
+func TestArchiveAndPurgeJobs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, job := range []*Job{
+		{ID: "job-1", Type: "i2v", Status: "pending", Params: "{}"},
+		{ID: "job-2", Type: "qwen", Status: "pending", Params: "{}"},
+		{ID: "job-3", Type: "qwen", Status: "pending", Params: "{}"},
+	} {
+		if err := db.CreateJob(ctx, job); err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+	}
+	if err := db.CompleteJob(ctx, "job-2", "/outputs/job-2.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FailJob(ctx, "job-3", "boom"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.ArchiveJob(ctx, "job-1"); err != ErrJobActive {
+		t.Errorf("expected ErrJobActive archiving a pending job, got %v", err)
+	}
+	if err := db.ArchiveJob(ctx, "missing"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+	for _, id := range []string{"job-2", "job-3"} {
+		if err := db.ArchiveJob(ctx, id); err != nil {
+			t.Fatalf("ArchiveJob(%s) failed: %v", id, err)
+		}
+	}
+	// Archiving twice is a no-op
+	if err := db.ArchiveJob(ctx, "job-2"); err != nil {
+		t.Fatalf("second ArchiveJob failed: %v", err)
+	}
+
+	listIDs := func(f ArchiveFilter) string {
+		jobs, err := db.ListJobs(ctx, 10, f)
+		if err != nil {
+			t.Fatalf("ListJobs failed: %v", err)
+		}
+		var ids []string
+		for _, job := range jobs {
+			ids = append(ids, job.ID)
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, ",")
+	}
+	if got := listIDs(ExcludeArchived); got != "job-1" {
+		t.Errorf("ExcludeArchived = %s", got)
+	}
+	if got := listIDs(OnlyArchived); got != "job-2,job-3" {
+		t.Errorf("OnlyArchived = %s", got)
+	}
+	if got := listIDs(IncludeArchived); got != "job-1,job-2,job-3" {
+		t.Errorf("IncludeArchived = %s", got)
+	}
+
+	if err := db.UnarchiveJob(ctx, "job-3"); err != nil {
+		t.Fatalf("UnarchiveJob failed: %v", err)
+	}
+	job, err := db.GetJob(ctx, "job-3")
+	if err != nil || !job.ArchivedAt.IsZero() {
+		t.Fatalf("expected job-3 to be unarchived, got %+v, %v", job, err)
+	}
+
+	// Only archived jobs are purged, even when named explicitly
+	purged, err := db.PurgeJobs(ctx, []string{"job-1", "job-2", "job-3"})
+	if err != nil {
+		t.Fatalf("PurgeJobs failed: %v", err)
+	}
+	if len(purged) != 1 || purged[0].ID != "job-2" || purged[0].Output != "/outputs/job-2.png" {
+		t.Fatalf("expected only job-2 to be purged, got %+v", purged)
+	}
+	if _, err := db.GetJob(ctx, "job-2"); err != sql.ErrNoRows {
+		t.Errorf("expected job-2 to be gone, got %v", err)
+	}
+	if events, _ := db.ListJobEvents(ctx, "job-2"); len(events) != 0 {
+		t.Errorf("expected job-2 events to be purged, got %d", len(events))
+	}
+	if got := listIDs(IncludeArchived); got != "job-1,job-3" {
+		t.Errorf("after purge = %s", got)
+	}
+}
+
+func TestPresets(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, p := range []*Preset{
+		{ID: "p1", Name: "slow pan", Workflow: "i2v", Params: `{"cfg_scale":5}`, Variables: `[{"name":"subject"}]`},
+		{ID: "p2", Name: "Anime", Workflow: "qwen", Params: `{}`},
+		{ID: "p3", Name: "fast", Workflow: "i2v", Params: `{}`},
+	} {
+		if err := db.CreatePreset(ctx, p); err != nil {
+			t.Fatalf("CreatePreset failed: %v", err)
+		}
+	}
+
+	got, err := db.GetPreset(ctx, "p1")
+	if err != nil || got.Name != "slow pan" || got.Params != `{"cfg_scale":5}` || got.Variables != `[{"name":"subject"}]` {
+		t.Fatalf("unexpected preset %+v, %v", got, err)
+	}
+
+	all, err := db.ListPresets(ctx, "")
+	if err != nil || len(all) != 3 || all[0].Name != "Anime" {
+		t.Fatalf("expected 3 presets sorted by name, got %+v, %v", all, err)
+	}
+	i2v, err := db.ListPresets(ctx, "i2v")
+	if err != nil || len(i2v) != 2 || i2v[0].Name != "fast" {
+		t.Fatalf("expected 2 i2v presets, got %+v, %v", i2v, err)
+	}
+
+	if err := db.DeletePreset(ctx, "p1"); err != nil {
+		t.Fatalf("DeletePreset failed: %v", err)
+	}
+	if err := db.DeletePreset(ctx, "p1"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows deleting twice, got %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if err := db.CreateSession(ctx, &Session{ID: "s1", Name: "lighting tests"}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	for _, job := range []*Job{
+		{ID: "job-1", Type: "i2v", Status: "pending", Params: "{}", SessionID: "s1"},
+		{ID: "job-2", Type: "i2v", Status: "pending", Params: "{}", SessionID: "s1"},
+		{ID: "job-3", Type: "i2v", Status: "pending", Params: "{}", SessionID: "s1"},
+		{ID: "other", Type: "qwen", Status: "pending", Params: "{}"},
+	} {
+		if err := db.CreateJob(ctx, job); err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+	}
+
+	jobs, err := db.ListSessionJobs(ctx, "s1")
+	if err != nil || len(jobs) != 3 || jobs[0].ID != "job-1" || jobs[0].SessionID != "s1" {
+		t.Fatalf("ListSessionJobs = %v, %v", jobs, err)
+	}
+
+	if err := db.ArchiveSession(ctx, "s1"); err != ErrJobActive {
+		t.Errorf("expected ErrJobActive archiving a session with pending jobs, got %v", err)
+	}
+	db.CompleteJob(ctx, "job-1", "/outputs/job-1.mp4")
+	db.CompleteJob(ctx, "job-2", "/outputs/job-2.mp4")
+	db.FailJob(ctx, "job-3", "boom")
+	// Archived on its own first, so it stays archived with the session
+	if err := db.ArchiveJob(ctx, "job-3"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := db.GetSession(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetSession failed: %v", err)
+	}
+	if s.JobCounts["completed"] != 2 || s.JobCounts["failed"] != 1 {
+		t.Errorf("job counts = %v", s.JobCounts)
+	}
+
+	if err := db.RenameSession(ctx, "s1", "final lighting"); err != nil {
+		t.Fatalf("RenameSession failed: %v", err)
+	}
+	if err := db.RenameSession(ctx, "missing", "x"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows renaming a missing session, got %v", err)
+	}
+
+	if err := db.ArchiveSession(ctx, "s1"); err != nil {
+		t.Fatalf("ArchiveSession failed: %v", err)
+	}
+	active, _ := db.ListJobs(ctx, 10, ExcludeArchived)
+	if len(active) != 1 || active[0].ID != "other" {
+		t.Errorf("jobs left after archiving the session: %v", active)
+	}
+	archived, _ := db.ListSessions(ctx, OnlyArchived)
+	if len(archived) != 1 || archived[0].Name != "final lighting" || archived[0].ArchivedAt.IsZero() {
+		t.Errorf("archived sessions = %v", archived)
+	}
+	if live, _ := db.ListSessions(ctx, ExcludeArchived); len(live) != 0 {
+		t.Errorf("archived session still listed: %v", live)
+	}
+
+	if err := db.UnarchiveSession(ctx, "s1"); err != nil {
+		t.Fatalf("UnarchiveSession failed: %v", err)
+	}
+	for id, want := range map[string]bool{"job-1": false, "job-2": false, "job-3": true} {
+		job, _ := db.GetJob(ctx, id)
+		if got := !job.ArchivedAt.IsZero(); got != want {
+			t.Errorf("%s archived = %v after unarchiving the session, want %v", id, got, want)
+		}
+	}
+}
+
+func TestBenchmarkRuns(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, id := range []string{"run-1", "run-2"} {
+		run := &BenchmarkRun{ID: id, Label: "driver 550", Environment: `{"gpus":["L40S"]}`, Results: []*BenchmarkResult{
+			{Name: "i2v-480p", Workflow: "i2v", JobID: "job-" + id, Status: BenchmarkPending},
+			{Name: "qwen-1024", Workflow: "qwen", Status: BenchmarkFailed, Error: "quota exceeded", FinishedAt: time.Now()},
+		}}
+		if err := db.CreateBenchmarkRun(ctx, run); err != nil {
+			t.Fatalf("CreateBenchmarkRun failed: %v", err)
+		}
+	}
+
+	if err := db.FinishBenchmarkJob(ctx, "job-run-1", BenchmarkCompleted, 2*time.Second, 95*time.Second, ""); err != nil {
+		t.Fatalf("FinishBenchmarkJob failed: %v", err)
+	}
+	// Not a benchmark job
+	if err := db.FinishBenchmarkJob(ctx, "other", BenchmarkCompleted, 0, time.Second, ""); err != nil {
+		t.Fatalf("FinishBenchmarkJob for another job failed: %v", err)
+	}
+
+	run, err := db.GetBenchmarkRun(ctx, "run-1")
+	if err != nil {
+		t.Fatalf("GetBenchmarkRun failed: %v", err)
+	}
+	if run.Label != "driver 550" || run.Environment != `{"gpus":["L40S"]}` || len(run.Results) != 2 {
+		t.Fatalf("run = %+v", run)
+	}
+	i2v, qwen := run.Results[0], run.Results[1]
+	if i2v.Status != BenchmarkCompleted || i2v.Run != 95*time.Second || i2v.Wait != 2*time.Second || i2v.FinishedAt.IsZero() {
+		t.Errorf("i2v result = %+v", i2v)
+	}
+	if qwen.Status != BenchmarkFailed || qwen.Error != "quota exceeded" || qwen.JobID != "" {
+		t.Errorf("qwen result = %+v", qwen)
+	}
+
+	runs, err := db.ListBenchmarkRuns(ctx, 10)
+	if err != nil || len(runs) != 2 || runs[0].ID != "run-2" || runs[0].Results[0].Status != BenchmarkPending {
+		t.Errorf("ListBenchmarkRuns = %v, %v", runs, err)
+	}
+	if _, err := db.GetBenchmarkRun(ctx, "missing"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a missing run, got %v", err)
+	}
+
+	// Cases are linked to their jobs once submitted
+	linked := &BenchmarkResult{Name: "qwen-1024", JobID: "job-qwen", Status: BenchmarkPending}
+	if err := db.UpdateBenchmarkResult(ctx, "run-2", linked); err != nil {
+		t.Fatalf("UpdateBenchmarkResult failed: %v", err)
+	}
+	if run, _ := db.GetBenchmarkRun(ctx, "run-2"); run.Results[1].JobID != "job-qwen" || run.Results[1].Status != BenchmarkPending || !run.Results[1].FinishedAt.IsZero() {
+		t.Errorf("linked result = %+v", run.Results[1])
+	}
+	if err := db.DeleteBenchmarkRun(ctx, "run-2"); err != nil {
+		t.Fatalf("DeleteBenchmarkRun failed: %v", err)
+	}
+	if _, err := db.GetBenchmarkRun(ctx, "run-2"); err != sql.ErrNoRows {
+		t.Errorf("expected the deleted run to be gone, got %v", err)
+	}
+}
+
+func TestTrackedDownloads(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if err := db.TrackDownload(ctx, &TrackedDownload{Name: "vae.safetensors", GID: "0001", URL: "https://example.com/vae", Workflow: "i2v"}); err != nil {
+		t.Fatalf("TrackDownload failed: %v", err)
+	}
+	if err := db.TrackDownload(ctx, &TrackedDownload{Name: "text.safetensors", GID: "0002", Workflow: "qwen"}); err != nil {
+		t.Fatalf("TrackDownload failed: %v", err)
+	}
+	// A retry replaces the GID
+	if err := db.TrackDownload(ctx, &TrackedDownload{Name: "vae.safetensors", GID: "0003", URL: "https://mirror.example.com/vae", Workflow: "i2v"}); err != nil {
+		t.Fatalf("TrackDownload failed: %v", err)
+	}
+
+	downloads, err := db.ListTrackedDownloads(ctx)
+	if err != nil {
+		t.Fatalf("ListTrackedDownloads failed: %v", err)
+	}
+	if len(downloads) != 2 {
+		t.Fatalf("expected 2 tracked downloads, got %d", len(downloads))
+	}
+	if d := downloads[1]; d.Name != "vae.safetensors" || d.GID != "0003" || d.URL != "https://mirror.example.com/vae" {
+		t.Errorf("unexpected retried download: %+v", d)
+	}
+
+	if err := db.UntrackDownload(ctx, "vae.safetensors"); err != nil {
+		t.Fatalf("UntrackDownload failed: %v", err)
+	}
+	downloads, err = db.ListTrackedDownloads(ctx)
+	if err != nil {
+		t.Fatalf("ListTrackedDownloads failed: %v", err)
+	}
+	if len(downloads) != 1 || downloads[0].Name != "text.safetensors" {
+		t.Errorf("expected only text.safetensors left, got %+v", downloads)
+	}
+}
+
+func TestModelURLs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if err := db.SetModelURL(ctx, "vae.safetensors", "https://example.com/old"); err != nil {
+		t.Fatalf("SetModelURL failed: %v", err)
+	}
+	if err := db.SetModelURL(ctx, "vae.safetensors", "https://example.com/new"); err != nil {
+		t.Fatalf("SetModelURL failed: %v", err)
+	}
+	if err := db.SetModelURL(ctx, "dir/text.json", "https://example.com/text"); err != nil {
+		t.Fatalf("SetModelURL failed: %v", err)
+	}
+	urls, err := db.ListModelURLs(ctx)
+	if err != nil {
+		t.Fatalf("ListModelURLs failed: %v", err)
+	}
+	if len(urls) != 2 || urls["vae.safetensors"] != "https://example.com/new" || urls["dir/text.json"] != "https://example.com/text" {
+		t.Errorf("unexpected URLs %v", urls)
+	}
+
+	if err := db.SetModelURL(ctx, "vae.safetensors", ""); err != nil {
+		t.Fatalf("SetModelURL failed: %v", err)
+	}
+	urls, err = db.ListModelURLs(ctx)
+	if err != nil {
+		t.Fatalf("ListModelURLs failed: %v", err)
+	}
+	if _, ok := urls["vae.safetensors"]; ok || len(urls) != 1 {
+		t.Errorf("expected the remap dropped, got %v", urls)
+	}
+}
+
+func TestPipelines(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, id := range []string{"pipe-1", "pipe-2"} {
+		p := &Pipeline{ID: id, Name: "fox clips", Spec: `{"steps":[]}`, UserID: "user-1", Steps: []*PipelineStep{
+			{StepID: "still", Type: "qwen", JobID: "job-" + id, Status: "queued"},
+			{StepID: "clip", Type: "i2v", Status: "waiting"},
+		}}
+		if err := db.CreatePipeline(ctx, p); err != nil {
+			t.Fatalf("CreatePipeline failed: %v", err)
+		}
+	}
+
+	pipelineID, stepID, err := db.GetPipelineByJob(ctx, "job-pipe-1")
+	if err != nil || pipelineID != "pipe-1" || stepID != "still" {
+		t.Fatalf("GetPipelineByJob = %s, %s, %v", pipelineID, stepID, err)
+	}
+	if _, _, err := db.GetPipelineByJob(ctx, "other"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a job outside pipelines, got %v", err)
+	}
+
+	if err := db.UpdatePipelineStep(ctx, "pipe-1", "clip", "failed", "job-clip", "worker crashed"); err != nil {
+		t.Fatalf("UpdatePipelineStep failed: %v", err)
+	}
+	p, err := db.GetPipeline(ctx, "pipe-1")
+	if err != nil {
+		t.Fatalf("GetPipeline failed: %v", err)
+	}
+	if p.Name != "fox clips" || p.UserID != "user-1" || len(p.Steps) != 2 || p.Steps[0].StepID != "still" {
+		t.Fatalf("pipeline = %+v", p)
+	}
+	if clip := p.Steps[1]; clip.Status != "failed" || clip.JobID != "job-clip" || clip.Error != "worker crashed" {
+		t.Errorf("clip step = %+v", clip)
+	}
+
+	pipelines, err := db.ListPipelines(ctx, 10)
+	if err != nil || len(pipelines) != 2 || pipelines[0].ID != "pipe-2" || len(pipelines[0].Steps) != 2 {
+		t.Errorf("ListPipelines = %v, %v", pipelines, err)
+	}
+
+	if err := db.DeletePipeline(ctx, "pipe-2"); err != nil {
+		t.Fatalf("DeletePipeline failed: %v", err)
+	}
+	if _, err := db.GetPipeline(ctx, "pipe-2"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a deleted pipeline, got %v", err)
+	}
+	if _, _, err := db.GetPipelineByJob(ctx, "job-pipe-2"); err != sql.ErrNoRows {
+		t.Errorf("expected the deleted pipeline's steps to go, got %v", err)
+	}
+}
+
+func TestJobEnergyAndStats(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, j := range []*Job{
+		{ID: "job-1", Type: "i2v", Status: "completed"},
+		{ID: "job-2", Type: "i2v", Status: "failed"},
+		{ID: "job-3", Type: "i2v", Status: "completed"},
+		{ID: "job-4", Type: "qwen_t2i", Status: "pending"},
+	} {
+		if err := db.CreateJob(ctx, j); err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+	}
+	if err := db.SetJobEnergy(ctx, "job-1", 120, 10); err != nil {
+		t.Fatalf("SetJobEnergy failed: %v", err)
+	}
+	if err := db.SetJobEnergy(ctx, "job-2", 30, 2.5); err != nil {
+		t.Fatalf("SetJobEnergy failed: %v", err)
+	}
+
+	job, err := db.GetJob(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("GetJob failed: %v", err)
+	}
+	if !job.Metered || job.GPUSeconds != 120 || job.EnergyWh != 10 {
+		t.Errorf("unexpected usage %v %v %v", job.Metered, job.GPUSeconds, job.EnergyWh)
+	}
+	job, err = db.GetJob(ctx, "job-3")
+	if err != nil {
+		t.Fatalf("GetJob failed: %v", err)
+	}
+	if job.Metered {
+		t.Error("expected job-3 to be unmetered")
+	}
+
+	stats, err := db.JobStatsByType(ctx, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("JobStatsByType failed: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 types, got %d", len(stats))
+	}
+	i2v := stats[0]
+	if i2v.Type != "i2v" || i2v.Jobs != 3 || i2v.Completed != 2 || i2v.Failed != 1 ||
+		i2v.Metered != 2 || i2v.GPUSeconds != 150 || i2v.EnergyWh != 12.5 {
+		t.Errorf("unexpected i2v stats %+v", i2v)
+	}
+	if t2i := stats[1]; t2i.Type != "qwen_t2i" || t2i.Jobs != 1 || t2i.Metered != 0 || t2i.GPUSeconds != 0 {
+		t.Errorf("unexpected qwen_t2i stats %+v", t2i)
+	}
+
+	stats, err = db.JobStatsByType(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("JobStatsByType failed: %v", err)
+	}
+	if len(stats) != 0 {
+		t.Errorf("expected no stats after the window, got %d", len(stats))
+	}
+}
+
+func TestRequestLog(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	now := time.Now()
+	err := db.RecordRequests(ctx, []*RequestLogEntry{
+		{At: now.Add(-48 * time.Hour), Method: "GET", Path: "/api/jobs", Status: 200, DurationMs: 3},
+		{At: now.Add(-time.Minute), Method: "POST", Path: "/api/i2v", Status: 400, DurationMs: 12, UserID: "u1"},
+		{At: now, Method: "GET", Path: "/api/jobs/abc", Status: 500, DurationMs: 250, Bytes: 42, RemoteAddr: "10.0.0.1", RequestID: "req-1"},
+	})
+	if err != nil {
+		t.Fatalf("RecordRequests failed: %v", err)
+	}
+
+	all, err := db.ListRequests(ctx, RequestLogFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListRequests failed: %v", err)
+	}
+	if len(all) != 3 || all[0].Path != "/api/jobs/abc" || all[0].Bytes != 42 || all[0].RequestID != "req-1" {
+		t.Fatalf("unexpected entries %+v", all)
+	}
+
+	for name, tc := range map[string]struct {
+		filter RequestLogFilter
+		want   int
+	}{
+		"limit":    {RequestLogFilter{Limit: 1}, 1},
+		"since":    {RequestLogFilter{Since: now.Add(-time.Hour), Limit: 10}, 2},
+		"method":   {RequestLogFilter{Method: "GET", Limit: 10}, 2},
+		"prefix":   {RequestLogFilter{PathPrefix: "/api/jobs", Limit: 10}, 2},
+		"user":     {RequestLogFilter{UserID: "u1", Limit: 10}, 1},
+		"5xx":      {RequestLogFilter{MinStatus: 500, MaxStatus: 599, Limit: 10}, 1},
+		"duration": {RequestLogFilter{MinDurationMs: 10, Limit: 10}, 2},
+	} {
+		got, err := db.ListRequests(ctx, tc.filter)
+		if err != nil {
+			t.Fatalf("%s: ListRequests failed: %v", name, err)
+		}
+		if len(got) != tc.want {
+			t.Errorf("%s: got %d entries, want %d", name, len(got), tc.want)
+		}
+	}
+
+	n, err := db.PruneRequestLog(ctx, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("PruneRequestLog failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("pruned %d entries, want 1", n)
+	}
+}
+
+func TestStats(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if err := db.CreateJob(ctx, &Job{ID: "job-1", Type: "i2v", Status: "pending"}); err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+	stats, err := db.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.SizeBytes <= 0 || stats.Rows["jobs"] != 1 || stats.Rows["job_events"] != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if _, ok := stats.Rows["request_log"]; !ok {
+		t.Errorf("request_log missing from %v", stats.Rows)
+	}
+}
+
+func TestJobStages(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if err := db.CreateJob(ctx, &Job{ID: "job-1", Type: "svi", Status: "pending"}); err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+	record := func(stage string, progress float64) {
+		t.Helper()
+		if err := db.RecordJobStage(ctx, "job-1", stage, progress); err != nil {
+			t.Fatalf("RecordJobStage failed: %v", err)
+		}
+	}
+
+	record("load_models", 0)
+	time.Sleep(20 * time.Millisecond)
+	record("denoise", 0.5)
+	time.Sleep(20 * time.Millisecond)
+	record("denoise", 1)
+	record("decode", 0.5)
+	// Entering a stage again adds to its time
+	record("denoise", 0.2)
+	time.Sleep(20 * time.Millisecond)
+
+	stages, err := db.ListJobStages(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("ListJobStages failed: %v", err)
+	}
+	if len(stages) != 3 || stages[0].Stage != "load_models" || stages[1].Stage != "denoise" || stages[2].Stage != "decode" {
+		t.Fatalf("unexpected stages %+v", stages)
+	}
+	if stages[0].Running || !stages[1].Running || stages[2].Running {
+		t.Errorf("expected only denoise running: %+v", stages)
+	}
+	if stages[0].Duration < 20*time.Millisecond || stages[1].Duration < 40*time.Millisecond {
+		t.Errorf("unexpected durations %v %v", stages[0].Duration, stages[1].Duration)
+	}
+	if stages[1].Progress != 0.2 {
+		t.Errorf("denoise progress = %v, want the last reported", stages[1].Progress)
+	}
+
+	if err := db.CompleteJob(ctx, "job-1", "out.mp4"); err != nil {
+		t.Fatalf("CompleteJob failed: %v", err)
+	}
+	stages, _ = db.ListJobStages(ctx, "job-1")
+	for _, s := range stages {
+		if s.Running || s.Progress != 1 {
+			t.Errorf("stage %s not finished: %+v", s.Stage, s)
+		}
+	}
+}
+
+func TestUploadsInUse(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, job := range []*Job{
+		{ID: "job-1", Type: "custom", Status: "pending", Params: "{}"},
+		{ID: "job-2", Type: "custom", Status: "completed", Params: "{}"},
+	} {
+		if err := db.CreateJob(ctx, job); err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+	}
+	if err := db.RecordJobUploads(ctx, "job-1", []string{"upload-a"}); err != nil {
+		t.Fatalf("RecordJobUploads failed: %v", err)
+	}
+	if err := db.RecordJobUploads(ctx, "job-2", []string{"upload-b"}); err != nil {
+		t.Fatalf("RecordJobUploads failed: %v", err)
+	}
+
+	ids, err := db.ListUploadsInUse(ctx)
+	if err != nil || len(ids) != 1 || !ids["upload-a"] {
+		t.Errorf("ListUploadsInUse = %v, %v; want only the pending job's upload", ids, err)
+	}
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// DatabaseStats describes the database for a diagnostics bundle
+type DatabaseStats struct {
+	SizeBytes     int64
+	FreelistBytes int64            // Unused pages VACUUM would reclaim
+	Rows          map[string]int64 // By table
+}
+
+// Stats returns the database's size and the number of rows in each table
+func (db *DB) Stats(ctx context.Context) (stats *DatabaseStats, err error) {
+	ctx, span := startSpan(ctx, "Stats")
+	defer func() { tracing.End(span, err) }()
+
+	stats = &DatabaseStats{Rows: make(map[string]int64)}
+	var pageSize, pages, free int64
+	if err := db.conn.QueryRowContext(ctx, `PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return nil, err
+	}
+	if err := db.conn.QueryRowContext(ctx, `PRAGMA page_count`).Scan(&pages); err != nil {
+		return nil, err
+	}
+	if err := db.conn.QueryRowContext(ctx, `PRAGMA freelist_count`).Scan(&free); err != nil {
+		return nil, err
+	}
+	stats.SizeBytes, stats.FreelistBytes = pages*pageSize, free*pageSize
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, table := range tables {
+		var n int64
+		// Names come from sqlite_master, not the caller
+		if err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM "`+table+`"`).Scan(&n); err != nil {
+			return nil, err
+		}
+		stats.Rows[table] = n
+	}
+	return stats, nil
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// Download history methods
+
+type DownloadRecord struct {
+	ID         int64
+	Name       string
+	URL        string
+	Mirror     string // Hosts the file came from
+	Workflow   string
+	Status     string
+	Size       int64
+	DurationMs int64
+	AvgSpeed   float64
+	Retries    int
+	Error      string
+	FinishedAt time.Time
+}
+
+func (db *DB) RecordDownload(ctx context.Context, rec *DownloadRecord) (err error) {
+	ctx, span := startSpan(ctx, "RecordDownload")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`INSERT INTO download_history
+		(name, url, mirror, workflow, status, size, duration_ms, avg_speed, retries, error, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.Name, rec.URL, rec.Mirror, rec.Workflow, rec.Status, rec.Size,
+		rec.DurationMs, rec.AvgSpeed, rec.Retries, rec.Error, rec.FinishedAt,
+	)
+	return err
+}
+
+// ListDownloadHistory returns the most recent downloads first
+func (db *DB) ListDownloadHistory(ctx context.Context, limit int) (records []*DownloadRecord, err error) {
+	ctx, span := startSpan(ctx, "ListDownloadHistory")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT id, name, url, mirror, workflow, status, size, duration_ms, avg_speed, retries, error, finished_at
+		FROM download_history ORDER BY finished_at DESC, id DESC LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rec := &DownloadRecord{}
+		var mirror, workflow, errMsg sql.NullString
+		if err := rows.Scan(
+			&rec.ID, &rec.Name, &rec.URL, &mirror, &workflow, &rec.Status, &rec.Size,
+			&rec.DurationMs, &rec.AvgSpeed, &rec.Retries, &errMsg, &rec.FinishedAt,
+		); err != nil {
+			return nil, err
+		}
+		rec.Mirror = mirror.String
+		rec.Workflow = workflow.String
+		rec.Error = errMsg.String
+		records = append(records, rec)
+	}
+
+	return records, rows.Err()
+}
+
+// TrackedDownload ties a model file to the aria2 GID fetching it
+type TrackedDownload struct {
+	Name      string
+	GID       string
+	URL       string
+	Workflow  string
+	UpdatedAt time.Time
+}
+
+// TrackDownload records the GID fetching a model file, replacing any
+// earlier one
+func (db *DB) TrackDownload(ctx context.Context, d *TrackedDownload) (err error) {
+	ctx, span := startSpan(ctx, "TrackDownload")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`INSERT INTO download_gids (name, gid, url, workflow, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET gid = excluded.gid, url = excluded.url,
+			workflow = excluded.workflow, updated_at = excluded.updated_at`,
+		d.Name, d.GID, d.URL, d.Workflow, time.Now(),
+	)
+	return err
+}
+
+// UntrackDownload forgets the GID of a model file once its download is
+// over
+func (db *DB) UntrackDownload(ctx context.Context, name string) (err error) {
+	ctx, span := startSpan(ctx, "UntrackDownload")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx, `DELETE FROM download_gids WHERE name = ?`, name)
+	return err
+}
+
+// ListTrackedDownloads returns every tracked download by file name
+func (db *DB) ListTrackedDownloads(ctx context.Context) (downloads []*TrackedDownload, err error) {
+	ctx, span := startSpan(ctx, "ListTrackedDownloads")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT name, gid, url, workflow, updated_at FROM download_gids ORDER BY name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := &TrackedDownload{}
+		var url, workflow sql.NullString
+		if err := rows.Scan(&d.Name, &d.GID, &url, &workflow, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		d.URL, d.Workflow = url.String, workflow.String
+		downloads = append(downloads, d)
+	}
+	return downloads, rows.Err()
+}
+
+// SetModelURL remaps a required model file to a new URL. An empty URL
+// drops the remap, restoring the manifest's.
+func (db *DB) SetModelURL(ctx context.Context, name, url string) (err error) {
+	ctx, span := startSpan(ctx, "SetModelURL")
+	defer func() { tracing.End(span, err) }()
+
+	if url == "" {
+		_, err = db.conn.ExecContext(ctx, `DELETE FROM model_urls WHERE name = ?`, name)
+		return err
+	}
+	_, err = db.conn.ExecContext(ctx,
+		`INSERT INTO model_urls (name, url, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET url = excluded.url, updated_at = excluded.updated_at`,
+		name, url, time.Now(),
+	)
+	return err
+}
+
+// ListModelURLs returns the remapped URL of each model file by name
+func (db *DB) ListModelURLs(ctx context.Context) (urls map[string]string, err error) {
+	ctx, span := startSpan(ctx, "ListModelURLs")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT name, url FROM model_urls`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls = make(map[string]string)
+	for rows.Next() {
+		var name, url string
+		if err := rows.Scan(&name, &url); err != nil {
+			return nil, err
+		}
+		urls[name] = url
+	}
+	return urls, rows.Err()
+}
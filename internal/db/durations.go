@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// Job duration history methods
+
+// durationSamples is how many recent runs an estimate averages over
+const durationSamples = 10
+
+// RecordJobDuration stores how long a completed job ran
+func (db *DB) RecordJobDuration(ctx context.Context, jobType, resolution string, d time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "RecordJobDuration")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`INSERT INTO job_durations (job_type, resolution, duration_ms, completed_at) VALUES (?, ?, ?, ?)`,
+		jobType, resolution, d.Milliseconds(), time.Now(),
+	)
+	return err
+}
+
+// ExpectedJobDuration averages the most recent runs of a job type at a
+// resolution, falling back to any resolution of the type. ok is false when
+// there is no history at all.
+func (db *DB) ExpectedJobDuration(ctx context.Context, jobType, resolution string) (d time.Duration, ok bool, err error) {
+	ctx, span := startSpan(ctx, "ExpectedJobDuration")
+	defer func() { tracing.End(span, err) }()
+
+	queries := []struct {
+		sql  string
+		args []interface{}
+	}{
+		{`SELECT AVG(duration_ms), COUNT(*) FROM (
+			SELECT duration_ms FROM job_durations WHERE job_type = ? AND resolution = ?
+			ORDER BY id DESC LIMIT ?)`, []interface{}{jobType, resolution, durationSamples}},
+		{`SELECT AVG(duration_ms), COUNT(*) FROM (
+			SELECT duration_ms FROM job_durations WHERE job_type = ?
+			ORDER BY id DESC LIMIT ?)`, []interface{}{jobType, durationSamples}},
+	}
+	for _, q := range queries {
+		var avg sql.NullFloat64
+		var n int
+		if err := db.conn.QueryRowContext(ctx, q.sql, q.args...).Scan(&avg, &n); err != nil {
+			return 0, false, err
+		}
+		if n > 0 && avg.Valid {
+			return time.Duration(avg.Float64) * time.Millisecond, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// SetJobETA stores a job's estimated completion time
+func (db *DB) SetJobETA(ctx context.Context, id string, eta time.Time) (err error) {
+	ctx, span := startSpan(ctx, "SetJobETA")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`UPDATE jobs SET eta_at = ? WHERE id = ?`,
+		eta, id,
+	)
+	return err
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Job lifecycle event types
+const (
+	EventQueued        = "queued"
+	EventDispatched    = "dispatched"
+	EventWaitingModels = "waiting_models"
+	EventRunning       = "running"
+	EventStage         = "stage"
+	EventCompleted     = "completed"
+	EventFailed        = "failed"
+	EventInterrupted   = "interrupted"
+	EventArchived      = "archived"
+	EventUnarchived    = "unarchived"
+)
+
+// JobEvent is one entry in a job's lifecycle timeline
+type JobEvent struct {
+	ID        int64
+	JobID     string
+	Event     string
+	Stage     string
+	Message   string
+	CreatedAt time.Time
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func recordJobEvent(ctx context.Context, conn execer, jobID, event, stage, message string) error {
+	_, err := conn.ExecContext(ctx,
+		`INSERT INTO job_events (job_id, event, stage, message, created_at) VALUES (?, ?, ?, ?, ?)`,
+		jobID, event, stage, message, time.Now(),
+	)
+	return err
+}
+
+// RecordJobEvent appends an event to a job's timeline
+func (db *DB) RecordJobEvent(ctx context.Context, jobID, event, message string) error {
+	return recordJobEvent(ctx, db.conn, jobID, event, "", message)
+}
+
+// recordStageChange appends a stage event unless the job's latest stage
+// event already names the same stage, so repeated progress ticks within a
+// stage don't flood the timeline
+func recordStageChange(ctx context.Context, conn execer, jobID, stage string) error {
+	if stage == "" {
+		return nil
+	}
+	_, err := conn.ExecContext(ctx,
+		`INSERT INTO job_events (job_id, event, stage, message, created_at)
+		SELECT ?, ?, ?, '', ?
+		WHERE COALESCE((
+			SELECT stage FROM job_events
+			WHERE job_id = ? AND event = ?
+			ORDER BY id DESC LIMIT 1
+		), '') != ?`,
+		jobID, EventStage, stage, time.Now(), jobID, EventStage, stage,
+	)
+	return err
+}
+
+// ListJobEvents returns a job's timeline in order
+func (db *DB) ListJobEvents(ctx context.Context, jobID string) ([]*JobEvent, error) {
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT id, job_id, event, stage, message, created_at
+		FROM job_events WHERE job_id = ? ORDER BY id`,
+		jobID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*JobEvent
+	for rows.Next() {
+		e := &JobEvent{}
+		var stage, message sql.NullString
+		if err := rows.Scan(&e.ID, &e.JobID, &e.Event, &stage, &message, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Stage = stage.String
+		e.Message = message.String
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
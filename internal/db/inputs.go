@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// Input image methods. The files live in the inputs library; these rows
+// describe them and record which job fields used each one.
+
+type InputImage struct {
+	Hash       string
+	Format     string
+	Width      int
+	Height     int
+	Size       int64
+	CreatedAt  time.Time
+	LastUsedAt time.Time // zero until a job uses it
+	Jobs       int       // existing jobs that used it
+}
+
+// JobInput is one image field of a job
+type JobInput struct {
+	JobID string
+	Field string // e.g. "input_image" or "edit_images[1]"
+	Hash  string
+}
+
+// inputImageSelect reads input_images with the count of jobs still in the
+// jobs table, so purged jobs stop holding an image
+const inputImageSelect = `SELECT i.hash, i.format, i.width, i.height, i.size, i.created_at, i.last_used_at,
+		(SELECT COUNT(DISTINCT ji.job_id) FROM job_inputs ji JOIN jobs j ON j.id = ji.job_id WHERE ji.hash = i.hash)
+	FROM input_images i`
+
+// SaveInputImage records an image added to the library. Saving one that
+// is already recorded leaves it unchanged and reports created as false.
+func (db *DB) SaveInputImage(ctx context.Context, img *InputImage) (created bool, err error) {
+	ctx, span := startSpan(ctx, "SaveInputImage")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := db.conn.ExecContext(ctx,
+		`INSERT OR IGNORE INTO input_images (hash, format, width, height, size, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		img.Hash, img.Format, img.Width, img.Height, img.Size, time.Now(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetInputImage returns an image, or sql.ErrNoRows if there is none
+func (db *DB) GetInputImage(ctx context.Context, hash string) (img *InputImage, err error) {
+	ctx, span := startSpan(ctx, "GetInputImage")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx, inputImageSelect+` WHERE i.hash = ?`, hash)
+	if err != nil {
+		return nil, err
+	}
+	images, err := scanInputImages(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return images[0], nil
+}
+
+// ListInputImages returns the library, most recently used first. With
+// unusedOnly, only images no existing job used are returned.
+func (db *DB) ListInputImages(ctx context.Context, unusedOnly bool) (images []*InputImage, err error) {
+	ctx, span := startSpan(ctx, "ListInputImages")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		inputImageSelect+` ORDER BY COALESCE(i.last_used_at, i.created_at) DESC`)
+	if err != nil {
+		return nil, err
+	}
+	all, err := scanInputImages(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, img := range all {
+		if !unusedOnly || img.Jobs == 0 {
+			images = append(images, img)
+		}
+	}
+	return images, nil
+}
+
+func scanInputImages(rows *sql.Rows) ([]*InputImage, error) {
+	defer rows.Close()
+
+	var images []*InputImage
+	for rows.Next() {
+		img := &InputImage{}
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&img.Hash, &img.Format, &img.Width, &img.Height, &img.Size, &img.CreatedAt, &lastUsed, &img.Jobs); err != nil {
+			return nil, err
+		}
+		img.LastUsedAt = lastUsed.Time
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// RecordJobInputs notes which library images a job's fields used and
+// marks them used now
+func (db *DB) RecordJobInputs(ctx context.Context, inputs []JobInput) (err error) {
+	ctx, span := startSpan(ctx, "RecordJobInputs")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, in := range inputs {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO job_inputs (job_id, field, hash) VALUES (?, ?, ?)`,
+			in.JobID, in.Field, in.Hash,
+		); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE input_images SET last_used_at = ? WHERE hash = ?`, now, in.Hash,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListImageJobs returns the fields of existing jobs that used an image,
+// newest job first
+func (db *DB) ListImageJobs(ctx context.Context, hash string) (inputs []JobInput, err error) {
+	ctx, span := startSpan(ctx, "ListImageJobs")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT ji.job_id, ji.field, ji.hash FROM job_inputs ji JOIN jobs j ON j.id = ji.job_id
+		WHERE ji.hash = ? ORDER BY j.created_at DESC, ji.field`,
+		hash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var in JobInput
+		if err := rows.Scan(&in.JobID, &in.Field, &in.Hash); err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, in)
+	}
+	return inputs, rows.Err()
+}
+
+// ListJobInputs returns the library images a job used
+func (db *DB) ListJobInputs(ctx context.Context, jobID string) (inputs []JobInput, err error) {
+	ctx, span := startSpan(ctx, "ListJobInputs")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT job_id, field, hash FROM job_inputs WHERE job_id = ? ORDER BY field`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var in JobInput
+		if err := rows.Scan(&in.JobID, &in.Field, &in.Hash); err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, in)
+	}
+	return inputs, rows.Err()
+}
+
+// DeleteInputImage forgets an image along with usage rows left by purged
+// jobs, returning sql.ErrNoRows if it wasn't recorded. Callers check that
+// no existing job uses it first.
+func (db *DB) DeleteInputImage(ctx context.Context, hash string) (err error) {
+	ctx, span := startSpan(ctx, "DeleteInputImage")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := db.conn.ExecContext(ctx, `DELETE FROM input_images WHERE hash = ?`, hash)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	_, err = db.conn.ExecContext(ctx, `DELETE FROM job_inputs WHERE hash = ?`, hash)
+	return err
+}
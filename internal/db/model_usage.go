@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// Model usage methods
+
+type ModelUsage struct {
+	Name       string
+	LastUsedAt *time.Time
+	UseCount   int
+	Pinned     bool
+}
+
+// RecordModelUse marks model files as used by a job now
+func (db *DB) RecordModelUse(ctx context.Context, names []string) (err error) {
+	ctx, span := startSpan(ctx, "RecordModelUse")
+	defer func() { tracing.End(span, err) }()
+
+	now := time.Now()
+	for _, name := range names {
+		_, err = db.conn.ExecContext(ctx,
+			`INSERT INTO model_usage (name, last_used_at, use_count) VALUES (?, ?, 1)
+			ON CONFLICT(name) DO UPDATE SET last_used_at = excluded.last_used_at, use_count = use_count + 1`,
+			name, now,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetModelPinned pins a model file so it is never suggested for cleanup or
+// archived
+func (db *DB) SetModelPinned(ctx context.Context, name string, pinned bool) (err error) {
+	ctx, span := startSpan(ctx, "SetModelPinned")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`INSERT INTO model_usage (name, pinned) VALUES (?, ?)
+		ON CONFLICT(name) DO UPDATE SET pinned = excluded.pinned`,
+		name, pinned,
+	)
+	return err
+}
+
+// ListModelUsage returns the usage of every model file seen so far, keyed
+// by name
+func (db *DB) ListModelUsage(ctx context.Context) (usage map[string]*ModelUsage, err error) {
+	ctx, span := startSpan(ctx, "ListModelUsage")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT name, last_used_at, use_count, pinned FROM model_usage`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage = make(map[string]*ModelUsage)
+	for rows.Next() {
+		u := &ModelUsage{}
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&u.Name, &lastUsed, &u.UseCount, &u.Pinned); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			u.LastUsedAt = &lastUsed.Time
+		}
+		usage[u.Name] = u
+	}
+	return usage, rows.Err()
+}
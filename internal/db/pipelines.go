@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// Pipeline methods. A pipeline keeps its spec as submitted; each step
+// records the job it became and how that went.
+
+type Pipeline struct {
+	ID        string
+	Name      string
+	Spec      string // JSON
+	UserID    string
+	SessionID string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Steps     []*PipelineStep // In spec order
+}
+
+type PipelineStep struct {
+	StepID string
+	Type   string
+	JobID  string // Empty until the step is submitted
+	Status string
+	Error  string
+}
+
+// CreatePipeline stores a pipeline with its steps
+func (db *DB) CreatePipeline(ctx context.Context, p *Pipeline) (err error) {
+	ctx, span := startSpan(ctx, "CreatePipeline")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO pipelines (id, name, spec, user_id, session_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, p.Name, p.Spec, p.UserID, p.SessionID, now, now,
+	)
+	if err != nil {
+		return err
+	}
+	for i, st := range p.Steps {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO pipeline_steps (pipeline_id, step_id, position, type, job_id, status, error)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			p.ID, st.StepID, i, st.Type, st.JobID, st.Status, st.Error,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	p.CreatedAt, p.UpdatedAt = now, now
+	return tx.Commit()
+}
+
+// UpdatePipelineStep records a step's job and status
+func (db *DB) UpdatePipelineStep(ctx context.Context, pipelineID, stepID, status, jobID, errorMsg string) (err error) {
+	ctx, span := startSpan(ctx, "UpdatePipelineStep")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE pipeline_steps SET status = ?, job_id = ?, error = ? WHERE pipeline_id = ? AND step_id = ?`,
+		status, jobID, errorMsg, pipelineID, stepID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE pipelines SET updated_at = ? WHERE id = ?`, time.Now(), pipelineID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPipelineByJob returns the ID of the pipeline a job is a step of, and
+// the step, or sql.ErrNoRows if it isn't part of one
+func (db *DB) GetPipelineByJob(ctx context.Context, jobID string) (pipelineID, stepID string, err error) {
+	ctx, span := startSpan(ctx, "GetPipelineByJob")
+	defer func() { tracing.End(span, err) }()
+
+	err = db.conn.QueryRowContext(ctx,
+		`SELECT pipeline_id, step_id FROM pipeline_steps WHERE job_id = ?`, jobID,
+	).Scan(&pipelineID, &stepID)
+	return pipelineID, stepID, err
+}
+
+// GetPipeline returns a pipeline with its steps, or sql.ErrNoRows if
+// there is none
+func (db *DB) GetPipeline(ctx context.Context, id string) (p *Pipeline, err error) {
+	ctx, span := startSpan(ctx, "GetPipeline")
+	defer func() { tracing.End(span, err) }()
+
+	p = &Pipeline{ID: id}
+	var name, userID, sessionID sql.NullString
+	err = db.conn.QueryRowContext(ctx,
+		`SELECT name, spec, user_id, session_id, created_at, updated_at FROM pipelines WHERE id = ?`, id,
+	).Scan(&name, &p.Spec, &userID, &sessionID, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.Name, p.UserID, p.SessionID = name.String, userID.String, sessionID.String
+	if err := db.loadPipelineSteps(ctx, []*Pipeline{p}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ListPipelines returns the most recent pipelines with their steps,
+// newest first
+func (db *DB) ListPipelines(ctx context.Context, limit int) (pipelines []*Pipeline, err error) {
+	ctx, span := startSpan(ctx, "ListPipelines")
+	defer func() { tracing.End(span, err) }()
+
+	return db.queryPipelines(ctx, `SELECT `+pipelineColumns+`
+		FROM pipelines ORDER BY created_at DESC, rowid DESC LIMIT ?`, limit)
+}
+
+// ListPipelinesWithStepStatus returns the pipelines that have a step in
+// the given status, with all their steps, oldest first
+func (db *DB) ListPipelinesWithStepStatus(ctx context.Context, status string) (pipelines []*Pipeline, err error) {
+	ctx, span := startSpan(ctx, "ListPipelinesWithStepStatus")
+	defer func() { tracing.End(span, err) }()
+
+	return db.queryPipelines(ctx, `SELECT `+pipelineColumns+` FROM pipelines
+		WHERE id IN (SELECT pipeline_id FROM pipeline_steps WHERE status = ?)
+		ORDER BY created_at, rowid`, status)
+}
+
+const pipelineColumns = `id, name, spec, user_id, session_id, created_at, updated_at`
+
+func (db *DB) queryPipelines(ctx context.Context, query string, args ...interface{}) ([]*Pipeline, error) {
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pipelines []*Pipeline
+	for rows.Next() {
+		p := &Pipeline{}
+		var name, userID, sessionID sql.NullString
+		if err := rows.Scan(&p.ID, &name, &p.Spec, &userID, &sessionID, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		p.Name, p.UserID, p.SessionID = name.String, userID.String, sessionID.String
+		pipelines = append(pipelines, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return pipelines, db.loadPipelineSteps(ctx, pipelines)
+}
+
+// DeletePipeline removes a pipeline and its steps. Jobs already submitted
+// are left alone.
+func (db *DB) DeletePipeline(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "DeletePipeline")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err = db.conn.ExecContext(ctx, `DELETE FROM pipeline_steps WHERE pipeline_id = ?`, id); err != nil {
+		return err
+	}
+	_, err = db.conn.ExecContext(ctx, `DELETE FROM pipelines WHERE id = ?`, id)
+	return err
+}
+
+// loadPipelineSteps fills in the steps of pipelines, in spec order
+func (db *DB) loadPipelineSteps(ctx context.Context, pipelines []*Pipeline) error {
+	for _, p := range pipelines {
+		rows, err := db.conn.QueryContext(ctx,
+			`SELECT step_id, type, job_id, status, error
+			FROM pipeline_steps WHERE pipeline_id = ? ORDER BY position`, p.ID,
+		)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			st := &PipelineStep{}
+			var jobID, errorMsg sql.NullString
+			if err := rows.Scan(&st.StepID, &st.Type, &jobID, &st.Status, &errorMsg); err != nil {
+				rows.Close()
+				return err
+			}
+			st.JobID, st.Error = jobID.String, errorMsg.String
+			p.Steps = append(p.Steps, st)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
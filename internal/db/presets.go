@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// Preset methods. A preset is a named set of workflow params; Params is
+// stored as JSON text.
+
+type Preset struct {
+	ID       string
+	Name     string
+	Workflow string
+	Params   string
+	// Variables is a JSON list of the template variables the params use,
+	// empty for presets without any
+	Variables string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+const presetColumns = `id, name, workflow, params, variables, created_at, updated_at`
+
+func (db *DB) CreatePreset(ctx context.Context, p *Preset) (err error) {
+	ctx, span := startSpan(ctx, "CreatePreset")
+	defer func() { tracing.End(span, err) }()
+
+	now := time.Now()
+	_, err = db.conn.ExecContext(ctx,
+		`INSERT INTO presets (id, name, workflow, params, variables, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, p.Name, p.Workflow, p.Params, p.Variables, now, now,
+	)
+	if err != nil {
+		return err
+	}
+	p.CreatedAt, p.UpdatedAt = now, now
+	return nil
+}
+
+// GetPreset returns a preset, or sql.ErrNoRows if there is none
+func (db *DB) GetPreset(ctx context.Context, id string) (p *Preset, err error) {
+	ctx, span := startSpan(ctx, "GetPreset")
+	defer func() { tracing.End(span, err) }()
+
+	return scanPreset(db.conn.QueryRowContext(ctx, `SELECT `+presetColumns+` FROM presets WHERE id = ?`, id))
+}
+
+// ListPresets returns every preset, optionally only those for one
+// workflow, sorted by name
+func (db *DB) ListPresets(ctx context.Context, workflow string) (presets []*Preset, err error) {
+	ctx, span := startSpan(ctx, "ListPresets")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT `+presetColumns+` FROM presets WHERE ? = '' OR workflow = ? ORDER BY name COLLATE NOCASE, created_at`,
+		workflow, workflow,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPreset(rows)
+		if err != nil {
+			return nil, err
+		}
+		presets = append(presets, p)
+	}
+	return presets, rows.Err()
+}
+
+// DeletePreset removes a preset, returning sql.ErrNoRows if it didn't exist
+func (db *DB) DeletePreset(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "DeletePreset")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := db.conn.ExecContext(ctx, `DELETE FROM presets WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanPreset(row rowScanner) (*Preset, error) {
+	p := &Preset{}
+	var variables sql.NullString
+	err := row.Scan(&p.ID, &p.Name, &p.Workflow, &p.Params, &variables, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.Variables = variables.String
+	return p, nil
+}
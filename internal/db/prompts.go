@@ -0,0 +1,281 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// Saved prompt methods. Unlike presets, a saved prompt is only the text;
+// jobs record which one they used in their params.
+
+type Prompt struct {
+	ID             string
+	Name           string
+	Text           string
+	NegativePrompt string
+	Tags           []string
+	UseCount       int
+	LastUsedAt     *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// PromptFilter narrows ListPrompts. Query matches the name or text, and
+// every tag in Tags must be present.
+type PromptFilter struct {
+	Query string
+	Tags  []string
+	Limit int
+}
+
+// TagCount is a prompt tag with the number of prompts carrying it
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+const promptColumns = `id, name, text, negative_prompt, use_count, last_used_at, created_at, updated_at`
+
+func (db *DB) CreatePrompt(ctx context.Context, p *Prompt) (err error) {
+	ctx, span := startSpan(ctx, "CreatePrompt")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO prompts (id, name, text, negative_prompt, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		p.ID, p.Name, p.Text, p.NegativePrompt, now, now,
+	)
+	if err != nil {
+		return err
+	}
+	if err := setPromptTags(ctx, tx, p.ID, p.Tags); err != nil {
+		return err
+	}
+	p.CreatedAt, p.UpdatedAt = now, now
+	return tx.Commit()
+}
+
+// UpdatePrompt replaces a prompt's name, text and tags, returning
+// sql.ErrNoRows if it doesn't exist
+func (db *DB) UpdatePrompt(ctx context.Context, p *Prompt) (err error) {
+	ctx, span := startSpan(ctx, "UpdatePrompt")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE prompts SET name = ?, text = ?, negative_prompt = ?, updated_at = ? WHERE id = ?`,
+		p.Name, p.Text, p.NegativePrompt, time.Now(), p.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if err := setPromptTags(ctx, tx, p.ID, p.Tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setPromptTags(ctx context.Context, tx *sql.Tx, id string, tags []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM prompt_tags WHERE prompt_id = ?`, id); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR IGNORE INTO prompt_tags (prompt_id, tag) VALUES (?, ?)`, id, tag,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPrompt returns a saved prompt, or sql.ErrNoRows if there is none
+func (db *DB) GetPrompt(ctx context.Context, id string) (p *Prompt, err error) {
+	ctx, span := startSpan(ctx, "GetPrompt")
+	defer func() { tracing.End(span, err) }()
+
+	p, err = scanPrompt(db.conn.QueryRowContext(ctx,
+		`SELECT `+promptColumns+` FROM prompts WHERE id = ?`, id,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if err := db.loadPromptTags(ctx, []*Prompt{p}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DeletePrompt removes a saved prompt, returning sql.ErrNoRows if it
+// didn't exist. Jobs that used it keep its ID in their params.
+func (db *DB) DeletePrompt(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "DeletePrompt")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := db.conn.ExecContext(ctx, `DELETE FROM prompt_tags WHERE prompt_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := db.conn.ExecContext(ctx, `DELETE FROM prompts WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListPrompts returns saved prompts matching a filter, most used first
+func (db *DB) ListPrompts(ctx context.Context, f PromptFilter) (prompts []*Prompt, err error) {
+	ctx, span := startSpan(ctx, "ListPrompts")
+	defer func() { tracing.End(span, err) }()
+
+	query := `SELECT ` + promptColumns + ` FROM prompts WHERE 1 = 1`
+	var args []interface{}
+	if f.Query != "" {
+		like := "%" + escapeLike(f.Query) + "%"
+		query += ` AND (name LIKE ? ESCAPE '\' OR text LIKE ? ESCAPE '\')`
+		args = append(args, like, like)
+	}
+	for _, tag := range f.Tags {
+		query += ` AND id IN (SELECT prompt_id FROM prompt_tags WHERE tag = ?)`
+		args = append(args, tag)
+	}
+	query += ` ORDER BY use_count DESC, updated_at DESC`
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPrompt(rows)
+		if err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return prompts, db.loadPromptTags(ctx, prompts)
+}
+
+// ListPromptTags returns every tag in use, most common first
+func (db *DB) ListPromptTags(ctx context.Context) (tags []TagCount, err error) {
+	ctx, span := startSpan(ctx, "ListPromptTags")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT tag, COUNT(*) FROM prompt_tags GROUP BY tag ORDER BY COUNT(*) DESC, tag`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Tag, &tc.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tc)
+	}
+	return tags, rows.Err()
+}
+
+// RecordPromptUse counts a submission that used a saved prompt, returning
+// sql.ErrNoRows for an unknown prompt
+func (db *DB) RecordPromptUse(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "RecordPromptUse")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := db.conn.ExecContext(ctx,
+		`UPDATE prompts SET use_count = use_count + 1, last_used_at = ? WHERE id = ?`,
+		time.Now(), id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanPrompt(row rowScanner) (*Prompt, error) {
+	p := &Prompt{}
+	var negative sql.NullString
+	var lastUsed sql.NullTime
+	err := row.Scan(&p.ID, &p.Name, &p.Text, &negative, &p.UseCount, &lastUsed, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.NegativePrompt = negative.String
+	if lastUsed.Valid {
+		p.LastUsedAt = &lastUsed.Time
+	}
+	return p, nil
+}
+
+// loadPromptTags fills in the tags of each prompt
+func (db *DB) loadPromptTags(ctx context.Context, prompts []*Prompt) error {
+	if len(prompts) == 0 {
+		return nil
+	}
+	byID := make(map[string]*Prompt, len(prompts))
+	placeholders := make([]string, len(prompts))
+	args := make([]interface{}, len(prompts))
+	for i, p := range prompts {
+		byID[p.ID] = p
+		p.Tags = []string{}
+		placeholders[i] = "?"
+		args[i] = p.ID
+	}
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT prompt_id, tag FROM prompt_tags WHERE prompt_id IN (`+strings.Join(placeholders, ", ")+`) ORDER BY tag`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		byID[id].Tags = append(byID[id].Tags, tag)
+	}
+	return rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in s for use with ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
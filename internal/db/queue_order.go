@@ -0,0 +1,187 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// Queue order methods. Jobs are dispatched in queue_pos order; a job
+// leaves the order once it is handed to a worker.
+
+// ErrJobNotQueued is returned when moving a job that has already been
+// dispatched or has finished
+var ErrJobNotQueued = errors.New("job is not waiting in the queue")
+
+// Positions a queued job can be moved to
+const (
+	MoveTop    = "top"
+	MoveUp     = "up"
+	MoveDown   = "down"
+	MoveBottom = "bottom"
+)
+
+const queuedJobsWhere = `WHERE status IN ('pending', 'waiting_models') AND dispatched_at IS NULL
+	ORDER BY queue_pos, created_at`
+
+const queuedJobsQuery = `SELECT id FROM jobs ` + queuedJobsWhere
+
+// MarkJobDispatched records that a job was handed to a worker
+func (db *DB) MarkJobDispatched(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "MarkJobDispatched")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`UPDATE jobs SET dispatched_at = ? WHERE id = ?`,
+		time.Now(), id,
+	)
+	return err
+}
+
+// ListQueuedJobIDs returns the jobs not yet dispatched, next to run first
+func (db *DB) ListQueuedJobIDs(ctx context.Context) (ids []string, err error) {
+	ctx, span := startSpan(ctx, "ListQueuedJobIDs")
+	defer func() { tracing.End(span, err) }()
+
+	return queuedIDs(ctx, db.conn)
+}
+
+// ListQueuedJobs returns the jobs not yet dispatched, next to run first
+func (db *DB) ListQueuedJobs(ctx context.Context) (jobs []*Job, err error) {
+	ctx, span := startSpan(ctx, "ListQueuedJobs")
+	defer func() { tracing.End(span, err) }()
+
+	return db.queryJobs(ctx, `SELECT `+jobColumns+` FROM jobs `+queuedJobsWhere)
+}
+
+// ListDispatchedJobs returns the unfinished jobs that have been handed to
+// a worker, oldest dispatch first
+func (db *DB) ListDispatchedJobs(ctx context.Context) (jobs []*Job, err error) {
+	ctx, span := startSpan(ctx, "ListDispatchedJobs")
+	defer func() { tracing.End(span, err) }()
+
+	return db.queryJobs(ctx, `SELECT `+jobColumns+` FROM jobs
+		WHERE status IN ('pending', 'waiting_models', 'running') AND dispatched_at IS NOT NULL
+		ORDER BY dispatched_at`)
+}
+
+// ListRunningJobs returns the jobs that have reported progress and not yet
+// finished, longest running first
+func (db *DB) ListRunningJobs(ctx context.Context) (jobs []*Job, err error) {
+	ctx, span := startSpan(ctx, "ListRunningJobs")
+	defer func() { tracing.End(span, err) }()
+
+	return db.queryJobs(ctx, `SELECT `+jobColumns+` FROM jobs WHERE status = 'running' ORDER BY started_at`)
+}
+
+func (db *DB) queryJobs(ctx context.Context, query string, args ...interface{}) ([]*Job, error) {
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queuedIDs(ctx context.Context, q queryer) ([]string, error) {
+	rows, err := q.QueryContext(ctx, queuedJobsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MoveJob moves a queued job to the top or bottom of the queue, or one
+// place up or down, and returns its new 1-based position. It returns
+// sql.ErrNoRows for an unknown job and ErrJobNotQueued for one that has
+// already been dispatched.
+func (db *DB) MoveJob(ctx context.Context, id, where string) (position int, err error) {
+	ctx, span := startSpan(ctx, "MoveJob")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	ids, err := queuedIDs(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	from := -1
+	for i, queued := range ids {
+		if queued == id {
+			from = i
+			break
+		}
+	}
+	if from < 0 {
+		var exists int
+		if err := tx.QueryRowContext(ctx, `SELECT 1 FROM jobs WHERE id = ?`, id).Scan(&exists); err != nil {
+			return 0, err
+		}
+		return 0, ErrJobNotQueued
+	}
+
+	to := from
+	switch where {
+	case MoveTop:
+		to = 0
+	case MoveUp:
+		to = max(from-1, 0)
+	case MoveDown:
+		to = min(from+1, len(ids)-1)
+	case MoveBottom:
+		to = len(ids) - 1
+	default:
+		return 0, fmt.Errorf("unknown position %q", where)
+	}
+
+	ids = append(ids[:from], ids[from+1:]...)
+	ids = append(ids[:to], append([]string{id}, ids[to:]...)...)
+
+	// Renumber the queued jobs ahead of anything submitted later
+	var base int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MIN(queue_pos), 1) FROM jobs
+		WHERE status IN ('pending', 'waiting_models') AND dispatched_at IS NULL`,
+	).Scan(&base); err != nil {
+		return 0, err
+	}
+	for i, queued := range ids {
+		if _, err := tx.ExecContext(ctx, `UPDATE jobs SET queue_pos = ? WHERE id = ?`, base+i, queued); err != nil {
+			return 0, err
+		}
+	}
+
+	return to + 1, tx.Commit()
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// Quota and usage methods
+
+// UserQuota overrides the configured limits for one user. A nil field
+// keeps the default.
+type UserQuota struct {
+	UserID           string
+	MaxQueuedJobs    *int
+	GPUMinutesPerDay *int
+	StorageBytes     *int64
+	UpdatedAt        time.Time
+}
+
+// UserUsage is what a user is consuming against their quota
+type UserUsage struct {
+	ActiveJobs   int
+	GPUSeconds   float64 // run time of jobs started since the window began
+	StorageBytes int64   // outputs of completed jobs still on disk
+}
+
+// QueuedJobOwner is a queued job and who submitted it
+type QueuedJobOwner struct {
+	ID     string
+	UserID string
+}
+
+// GetUserQuota returns a user's overrides, with every field nil if none
+// are set
+func (db *DB) GetUserQuota(ctx context.Context, userID string) (q *UserQuota, err error) {
+	ctx, span := startSpan(ctx, "GetUserQuota")
+	defer func() { tracing.End(span, err) }()
+
+	q = &UserQuota{UserID: userID}
+	var maxJobs, gpuMinutes, storage sql.NullInt64
+	var updatedAt sql.NullTime
+	err = db.conn.QueryRowContext(ctx,
+		`SELECT max_queued_jobs, gpu_minutes_per_day, storage_bytes, updated_at
+		FROM user_quotas WHERE user_id = ?`,
+		userID,
+	).Scan(&maxJobs, &gpuMinutes, &storage, &updatedAt)
+	if err == sql.ErrNoRows {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if maxJobs.Valid {
+		n := int(maxJobs.Int64)
+		q.MaxQueuedJobs = &n
+	}
+	if gpuMinutes.Valid {
+		n := int(gpuMinutes.Int64)
+		q.GPUMinutesPerDay = &n
+	}
+	if storage.Valid {
+		q.StorageBytes = &storage.Int64
+	}
+	q.UpdatedAt = updatedAt.Time
+	return q, nil
+}
+
+// SetUserQuota replaces a user's overrides
+func (db *DB) SetUserQuota(ctx context.Context, q *UserQuota) (err error) {
+	ctx, span := startSpan(ctx, "SetUserQuota")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`INSERT OR REPLACE INTO user_quotas (user_id, max_queued_jobs, gpu_minutes_per_day, storage_bytes, updated_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		q.UserID, q.MaxQueuedJobs, q.GPUMinutesPerDay, q.StorageBytes, time.Now(),
+	)
+	return err
+}
+
+// SetJobOutputSize records the size of a finished job's output file, so
+// per-user storage can be totalled without walking the outputs directory
+func (db *DB) SetJobOutputSize(ctx context.Context, id string, size int64) (err error) {
+	ctx, span := startSpan(ctx, "SetJobOutputSize")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx, `UPDATE jobs SET output_size = ? WHERE id = ?`, size, id)
+	return err
+}
+
+// GetUserUsage totals a user's unfinished jobs, GPU time of jobs started
+// since the given time, and stored outputs
+func (db *DB) GetUserUsage(ctx context.Context, userID string, since time.Time) (usage *UserUsage, err error) {
+	ctx, span := startSpan(ctx, "GetUserUsage")
+	defer func() { tracing.End(span, err) }()
+
+	usage = &UserUsage{}
+	err = db.conn.QueryRowContext(ctx,
+		`SELECT
+			COUNT(CASE WHEN status IN ('pending', 'waiting_models', 'running') THEN 1 END),
+			COALESCE(SUM(CASE WHEN status = 'completed' THEN output_size END), 0)
+		FROM jobs WHERE user_id = ?`,
+		userID,
+	).Scan(&usage.ActiveJobs, &usage.StorageBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	gpu, err := db.gpuSeconds(ctx, since, userID)
+	if err != nil {
+		return nil, err
+	}
+	usage.GPUSeconds = gpu[userID]
+	return usage, nil
+}
+
+// GPUSecondsByUser totals the run time of jobs started since the given
+// time for each user
+func (db *DB) GPUSecondsByUser(ctx context.Context, since time.Time) (seconds map[string]float64, err error) {
+	ctx, span := startSpan(ctx, "GPUSecondsByUser")
+	defer func() { tracing.End(span, err) }()
+
+	return db.gpuSeconds(ctx, since, "")
+}
+
+// gpuSeconds sums run times in Go, since started_at and updated_at are
+// stored in the driver's time format rather than one SQLite can subtract.
+// Running jobs count up to now. An empty userID covers everyone.
+func (db *DB) gpuSeconds(ctx context.Context, since time.Time, userID string) (map[string]float64, error) {
+	query := `SELECT COALESCE(user_id, ''), status, started_at, updated_at FROM jobs
+		WHERE started_at IS NOT NULL AND started_at >= ?`
+	args := []interface{}{since}
+	if userID != "" {
+		query += ` AND user_id = ?`
+		args = append(args, userID)
+	}
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	seconds := make(map[string]float64)
+	for rows.Next() {
+		var user, status string
+		var startedAt, updatedAt time.Time
+		if err := rows.Scan(&user, &status, &startedAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		end := updatedAt
+		if status == "running" {
+			end = now
+		}
+		if d := end.Sub(startedAt); d > 0 {
+			seconds[user] += d.Seconds()
+		}
+	}
+	return seconds, rows.Err()
+}
+
+// ListQueuedJobOwners returns the jobs not yet dispatched with their
+// submitters, next to run first
+func (db *DB) ListQueuedJobOwners(ctx context.Context) (owners []QueuedJobOwner, err error) {
+	ctx, span := startSpan(ctx, "ListQueuedJobOwners")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT id, COALESCE(user_id, '') FROM jobs `+queuedJobsWhere)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o QueuedJobOwner
+		if err := rows.Scan(&o.ID, &o.UserID); err != nil {
+			return nil, err
+		}
+		owners = append(owners, o)
+	}
+	return owners, rows.Err()
+}
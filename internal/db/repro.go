@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// SetJobRepro stores the reproducibility snapshot taken when a job
+// finished. The snapshot is opaque JSON to the database.
+func (db *DB) SetJobRepro(ctx context.Context, id, repro string) (err error) {
+	ctx, span := startSpan(ctx, "SetJobRepro")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx, `UPDATE jobs SET repro = ? WHERE id = ?`, repro, id)
+	return err
+}
+
+// GetJobRepro returns a job's reproducibility snapshot, or "" if none was
+// recorded. Returns sql.ErrNoRows if the job doesn't exist.
+func (db *DB) GetJobRepro(ctx context.Context, id string) (repro string, err error) {
+	ctx, span := startSpan(ctx, "GetJobRepro")
+	defer func() { tracing.End(span, err) }()
+
+	var value sql.NullString
+	err = db.conn.QueryRowContext(ctx, `SELECT repro FROM jobs WHERE id = ?`, id).Scan(&value)
+	return value.String, err
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// RequestLogEntry is one API request as the request log keeps it
+type RequestLogEntry struct {
+	ID         int64
+	At         time.Time
+	Method     string
+	Path       string // Without the query string, which may carry a token
+	Status     int
+	DurationMs int64
+	Bytes      int64 // Response body size
+	UserID     string
+	RemoteAddr string
+	RequestID  string
+}
+
+// RequestLogFilter narrows ListRequests. Zero fields match everything.
+type RequestLogFilter struct {
+	Since      time.Time
+	Method     string
+	PathPrefix string
+	UserID     string
+	// MinStatus and MaxStatus bound the status code, inclusive
+	MinStatus     int
+	MaxStatus     int
+	MinDurationMs int64
+	Limit         int
+}
+
+// RecordRequests appends entries to the request log in one transaction
+func (db *DB) RecordRequests(ctx context.Context, entries []*RequestLogEntry) (err error) {
+	ctx, span := startSpan(ctx, "RecordRequests")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO request_log (at, method, path, status, duration_ms, bytes, user_id, remote_addr, request_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range entries {
+		if _, err := stmt.ExecContext(ctx, e.At, e.Method, e.Path, e.Status, e.DurationMs, e.Bytes, e.UserID, e.RemoteAddr, e.RequestID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListRequests returns logged requests matching filter, newest first
+func (db *DB) ListRequests(ctx context.Context, filter RequestLogFilter) (entries []*RequestLogEntry, err error) {
+	ctx, span := startSpan(ctx, "ListRequests")
+	defer func() { tracing.End(span, err) }()
+
+	var where []string
+	var args []interface{}
+	if !filter.Since.IsZero() {
+		where = append(where, `at >= ?`)
+		args = append(args, filter.Since)
+	}
+	if filter.Method != "" {
+		where = append(where, `method = ?`)
+		args = append(args, filter.Method)
+	}
+	if filter.PathPrefix != "" {
+		where = append(where, `substr(path, 1, ?) = ?`)
+		args = append(args, len(filter.PathPrefix), filter.PathPrefix)
+	}
+	if filter.UserID != "" {
+		where = append(where, `user_id = ?`)
+		args = append(args, filter.UserID)
+	}
+	if filter.MinStatus > 0 {
+		where = append(where, `status >= ?`)
+		args = append(args, filter.MinStatus)
+	}
+	if filter.MaxStatus > 0 {
+		where = append(where, `status <= ?`)
+		args = append(args, filter.MaxStatus)
+	}
+	if filter.MinDurationMs > 0 {
+		where = append(where, `duration_ms >= ?`)
+		args = append(args, filter.MinDurationMs)
+	}
+
+	query := `SELECT id, at, method, path, status, duration_ms, bytes, user_id, remote_addr, request_id FROM request_log`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := &RequestLogEntry{}
+		var userID, remoteAddr, requestID sql.NullString
+		if err := rows.Scan(&e.ID, &e.At, &e.Method, &e.Path, &e.Status, &e.DurationMs, &e.Bytes, &userID, &remoteAddr, &requestID); err != nil {
+			return nil, err
+		}
+		e.UserID, e.RemoteAddr, e.RequestID = userID.String, remoteAddr.String, requestID.String
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// PruneRequestLog deletes requests logged before the given time and
+// returns how many went
+func (db *DB) PruneRequestLog(ctx context.Context, before time.Time) (n int64, err error) {
+	ctx, span := startSpan(ctx, "PruneRequestLog")
+	defer func() { tracing.End(span, err) }()
+
+	res, err := db.conn.ExecContext(ctx, `DELETE FROM request_log WHERE at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
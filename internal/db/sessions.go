@@ -0,0 +1,262 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// Session methods. A session groups the jobs submitted from one UI session
+// or experiment, so they can be listed, renamed and archived together.
+
+type Session struct {
+	ID         string
+	Name       string
+	UserID     string // Creator, empty with auth off
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ArchivedAt time.Time // Zero unless the session is archived
+	// JobCounts counts the session's jobs by status
+	JobCounts map[string]int
+}
+
+const sessionColumns = `id, name, user_id, created_at, updated_at, archived_at`
+
+func (db *DB) CreateSession(ctx context.Context, s *Session) (err error) {
+	ctx, span := startSpan(ctx, "CreateSession")
+	defer func() { tracing.End(span, err) }()
+
+	now := time.Now()
+	_, err = db.conn.ExecContext(ctx,
+		`INSERT INTO sessions (id, name, user_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+		s.ID, s.Name, s.UserID, now, now,
+	)
+	if err != nil {
+		return err
+	}
+	s.CreatedAt, s.UpdatedAt = now, now
+	s.JobCounts = map[string]int{}
+	return nil
+}
+
+// GetSession returns a session with its job counts, or sql.ErrNoRows if
+// there is none
+func (db *DB) GetSession(ctx context.Context, id string) (s *Session, err error) {
+	ctx, span := startSpan(ctx, "GetSession")
+	defer func() { tracing.End(span, err) }()
+
+	s, err = scanSession(db.conn.QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, id,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if err := db.loadSessionCounts(ctx, []*Session{s}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ListSessions returns sessions with their job counts, newest first
+func (db *DB) ListSessions(ctx context.Context, archived ArchiveFilter) (sessions []*Session, err error) {
+	ctx, span := startSpan(ctx, "ListSessions")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions `+archived.where()+` ORDER BY created_at DESC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, db.loadSessionCounts(ctx, sessions)
+}
+
+// RenameSession renames a session, returning sql.ErrNoRows if it doesn't
+// exist
+func (db *DB) RenameSession(ctx context.Context, id, name string) (err error) {
+	ctx, span := startSpan(ctx, "RenameSession")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := db.conn.ExecContext(ctx,
+		`UPDATE sessions SET name = ?, updated_at = ? WHERE id = ?`, name, time.Now(), id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListSessionJobs returns a session's jobs, archived or not, oldest first
+func (db *DB) ListSessionJobs(ctx context.Context, id string) (jobs []*Job, err error) {
+	ctx, span := startSpan(ctx, "ListSessionJobs")
+	defer func() { tracing.End(span, err) }()
+
+	return db.queryJobs(ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE session_id = ? ORDER BY created_at, rowid`, id,
+	)
+}
+
+// ArchiveSession archives a session together with its jobs. Jobs archived
+// on their own beforehand are left as they are. Returns sql.ErrNoRows if
+// the session doesn't exist and ErrJobActive if any of its jobs hasn't
+// finished.
+func (db *DB) ArchiveSession(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "ArchiveSession")
+	defer func() { tracing.End(span, err) }()
+
+	return db.setSessionArchived(ctx, id, true)
+}
+
+// UnarchiveSession restores a session and the jobs archived with it
+func (db *DB) UnarchiveSession(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "UnarchiveSession")
+	defer func() { tracing.End(span, err) }()
+
+	return db.setSessionArchived(ctx, id, false)
+}
+
+func (db *DB) setSessionArchived(ctx context.Context, id string, archived bool) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var archivedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `SELECT archived_at FROM sessions WHERE id = ?`, id).Scan(&archivedAt)
+	if err != nil {
+		return err
+	}
+	if archivedAt.Valid == archived {
+		return nil
+	}
+
+	// The session's jobs share its archive timestamp, which is how
+	// unarchiving tells them from jobs archived separately
+	var ids []string
+	event := EventUnarchived
+	if archived {
+		var active int
+		err := tx.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM jobs WHERE session_id = ? AND status IN ('pending', 'waiting_models', 'running')`, id,
+		).Scan(&active)
+		if err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrJobActive
+		}
+
+		now := time.Now()
+		if _, err := tx.ExecContext(ctx, `UPDATE sessions SET archived_at = ? WHERE id = ?`, now, id); err != nil {
+			return err
+		}
+		if ids, err = sessionJobIDs(ctx, tx, `SELECT id FROM jobs WHERE session_id = ? AND archived_at IS NULL`, id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE jobs SET archived_at = (SELECT archived_at FROM sessions WHERE id = ?)
+			WHERE session_id = ? AND archived_at IS NULL`, id, id,
+		); err != nil {
+			return err
+		}
+		event = EventArchived
+	} else {
+		const archivedWithSession = `session_id = ? AND archived_at = (SELECT archived_at FROM sessions WHERE id = ?)`
+		if ids, err = sessionJobIDs(ctx, tx, `SELECT id FROM jobs WHERE `+archivedWithSession, id, id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE jobs SET archived_at = NULL WHERE `+archivedWithSession, id, id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE sessions SET archived_at = NULL WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+
+	for _, jobID := range ids {
+		if err := recordJobEvent(ctx, tx, jobID, event, "", "with session "+id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func sessionJobIDs(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (db *DB) loadSessionCounts(ctx context.Context, sessions []*Session) error {
+	byID := make(map[string]*Session, len(sessions))
+	for _, s := range sessions {
+		s.JobCounts = map[string]int{}
+		byID[s.ID] = s
+	}
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT session_id, status, COUNT(*) FROM jobs WHERE session_id IS NOT NULL AND session_id != '' GROUP BY session_id, status`,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, status string
+		var count int
+		if err := rows.Scan(&id, &status, &count); err != nil {
+			return err
+		}
+		if s, ok := byID[id]; ok {
+			s.JobCounts[status] = count
+		}
+	}
+	return rows.Err()
+}
+
+func scanSession(row rowScanner) (*Session, error) {
+	s := &Session{}
+	var userID sql.NullString
+	var archivedAt sql.NullTime
+	err := row.Scan(&s.ID, &s.Name, &userID, &s.CreatedAt, &s.UpdatedAt, &archivedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.UserID = userID.String
+	s.ArchivedAt = archivedAt.Time
+	return s, nil
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// JobStage is the time a job spent in one stage of its workflow
+type JobStage struct {
+	Stage     string
+	Progress  float64   // Within the stage, as last reported
+	StartedAt time.Time // When the job first entered it
+	// Duration is the total time in the stage, up to now while the job is
+	// in it
+	Duration time.Duration
+	Running  bool
+}
+
+// queryExecer is satisfied by both *sql.DB and *sql.Tx
+type queryExecer interface {
+	execer
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// RecordJobStage notes that a job is progress of the way through stage,
+// leaving whichever stage it was in before
+func (db *DB) RecordJobStage(ctx context.Context, jobID, stage string, progress float64) (err error) {
+	ctx, span := startSpan(ctx, "RecordJobStage")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := leaveJobStages(ctx, tx, jobID, stage, now); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO job_stages (job_id, stage, progress, started_at, running_since) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (job_id, stage) DO UPDATE SET
+			progress = excluded.progress,
+			running_since = COALESCE(running_since, excluded.running_since)`,
+		jobID, stage, progress, now, now,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// leaveJobStages adds the time since the job entered its running stages,
+// other than except, to their totals and stops them
+func leaveJobStages(ctx context.Context, conn queryExecer, jobID, except string, now time.Time) error {
+	rows, err := conn.QueryContext(ctx,
+		`SELECT stage, running_since FROM job_stages
+		WHERE job_id = ? AND stage != ? AND running_since IS NOT NULL`,
+		jobID, except,
+	)
+	if err != nil {
+		return err
+	}
+	elapsed := make(map[string]time.Duration)
+	for rows.Next() {
+		var stage string
+		var since time.Time
+		if err := rows.Scan(&stage, &since); err != nil {
+			rows.Close()
+			return err
+		}
+		elapsed[stage] = max(now.Sub(since), 0)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for stage, d := range elapsed {
+		if _, err := conn.ExecContext(ctx,
+			`UPDATE job_stages SET duration_ms = duration_ms + ?, running_since = NULL WHERE job_id = ? AND stage = ?`,
+			d.Milliseconds(), jobID, stage,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endJobStages stops the clock on a finished job's stages. A completed job
+// finished every stage it entered.
+func endJobStages(ctx context.Context, conn queryExecer, jobID string, completed bool) error {
+	if err := leaveJobStages(ctx, conn, jobID, "", time.Now()); err != nil {
+		return err
+	}
+	if !completed {
+		return nil
+	}
+	_, err := conn.ExecContext(ctx, `UPDATE job_stages SET progress = 1 WHERE job_id = ?`, jobID)
+	return err
+}
+
+// ListJobStages returns the stages a job has entered, in the order it
+// first entered them
+func (db *DB) ListJobStages(ctx context.Context, jobID string) (stages []*JobStage, err error) {
+	ctx, span := startSpan(ctx, "ListJobStages")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT stage, progress, started_at, running_since, duration_ms
+		FROM job_stages WHERE job_id = ? ORDER BY started_at, rowid`,
+		jobID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	for rows.Next() {
+		s := &JobStage{}
+		var since sql.NullTime
+		var durationMs int64
+		if err := rows.Scan(&s.Stage, &s.Progress, &s.StartedAt, &since, &durationMs); err != nil {
+			return nil, err
+		}
+		s.Duration = time.Duration(durationMs) * time.Millisecond
+		if since.Valid {
+			s.Running = true
+			s.Duration += max(now.Sub(since.Time), 0)
+		}
+		stages = append(stages, s)
+	}
+	return stages, rows.Err()
+}
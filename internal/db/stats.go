@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// JobTypeStats totals the jobs of one type
+type JobTypeStats struct {
+	Type      string
+	Jobs      int
+	Completed int
+	Failed    int
+	// Metered counts the jobs whose GPU time and energy were recorded;
+	// GPUSeconds and EnergyWh sum over those only
+	Metered    int
+	GPUSeconds float64
+	EnergyWh   float64
+}
+
+// SetJobEnergy records a finished job's share of GPU time and power draw
+func (db *DB) SetJobEnergy(ctx context.Context, id string, gpuSeconds, energyWh float64) (err error) {
+	ctx, span := startSpan(ctx, "SetJobEnergy")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`UPDATE jobs SET gpu_seconds = ?, energy_wh = ? WHERE id = ?`,
+		gpuSeconds, energyWh, id,
+	)
+	return err
+}
+
+// JobStatsByType totals jobs created since the given time by type, most
+// GPU time first
+func (db *DB) JobStatsByType(ctx context.Context, since time.Time) (stats []*JobTypeStats, err error) {
+	ctx, span := startSpan(ctx, "JobStatsByType")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT type, COUNT(*),
+			COALESCE(SUM(CASE WHEN status = 'completed' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END), 0),
+			COUNT(gpu_seconds),
+			COALESCE(SUM(gpu_seconds), 0),
+			COALESCE(SUM(energy_wh), 0)
+		FROM jobs WHERE created_at >= ?
+		GROUP BY type ORDER BY SUM(gpu_seconds) DESC, type`,
+		since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		st := &JobTypeStats{}
+		if err := rows.Scan(&st.Type, &st.Jobs, &st.Completed, &st.Failed, &st.Metered, &st.GPUSeconds, &st.EnergyWh); err != nil {
+			return nil, err
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// Upload methods. The uploads themselves live in the chunk store; these
+// rows record which jobs read each one.
+
+// RecordJobUploads records the chunked uploads a job reads
+func (db *DB) RecordJobUploads(ctx context.Context, jobID string, uploadIDs []string) (err error) {
+	ctx, span := startSpan(ctx, "RecordJobUploads")
+	defer func() { tracing.End(span, err) }()
+
+	for _, id := range uploadIDs {
+		if _, err := db.conn.ExecContext(ctx,
+			`INSERT OR IGNORE INTO job_uploads (job_id, upload_id) VALUES (?, ?)`, jobID, id,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListUploadsInUse returns the uploads read by jobs that haven't finished
+func (db *DB) ListUploadsInUse(ctx context.Context) (ids map[string]bool, err error) {
+	ctx, span := startSpan(ctx, "ListUploadsInUse")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT DISTINCT ju.upload_id FROM job_uploads ju JOIN jobs j ON j.id = ju.job_id
+		WHERE j.status IN ('pending', 'waiting_models', 'running')`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids = make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
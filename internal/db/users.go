@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/tracing"
+)
+
+// User methods
+
+type User struct {
+	ID        string
+	Name      string
+	Role      string
+	TokenHash string
+	CreatedAt time.Time
+}
+
+func (db *DB) CreateUser(ctx context.Context, user *User) (err error) {
+	ctx, span := startSpan(ctx, "CreateUser")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.conn.ExecContext(ctx,
+		`INSERT INTO users (id, name, role, token_hash, created_at) VALUES (?, ?, ?, ?, ?)`,
+		user.ID, user.Name, user.Role, user.TokenHash, time.Now(),
+	)
+	return err
+}
+
+// GetUserByTokenHash returns the user owning a token, or nil if none does
+func (db *DB) GetUserByTokenHash(ctx context.Context, tokenHash string) (user *User, err error) {
+	ctx, span := startSpan(ctx, "GetUserByTokenHash")
+	defer func() { tracing.End(span, err) }()
+
+	user = &User{}
+	err = db.conn.QueryRowContext(ctx,
+		`SELECT id, name, role, token_hash, created_at FROM users WHERE token_hash = ?`,
+		tokenHash,
+	).Scan(&user.ID, &user.Name, &user.Role, &user.TokenHash, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (db *DB) ListUsers(ctx context.Context) (users []*User, err error) {
+	ctx, span := startSpan(ctx, "ListUsers")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT id, name, role, token_hash, created_at FROM users ORDER BY created_at`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := &User{}
+		if err := rows.Scan(&user.ID, &user.Name, &user.Role, &user.TokenHash, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// SetUserTokenHash replaces the token of a user, reporting whether the
+// user existed
+func (db *DB) SetUserTokenHash(ctx context.Context, id, tokenHash string) (existed bool, err error) {
+	ctx, span := startSpan(ctx, "SetUserTokenHash")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := db.conn.ExecContext(ctx, `UPDATE users SET token_hash = ? WHERE id = ?`, tokenHash, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteUser removes a user and their quota overrides, returning
+// sql.ErrNoRows if it didn't exist
+func (db *DB) DeleteUser(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "DeleteUser")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := db.conn.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	_, err = db.conn.ExecContext(ctx, `DELETE FROM user_quotas WHERE user_id = ?`, id)
+	return err
+}
@@ -0,0 +1,230 @@
+// Package doctor runs preflight checks on the environment diffbox needs,
+// so problems show up as a report instead of a failed start.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/config"
+	"github.com/druarnfield/diffbox/internal/gpu"
+)
+
+// checkTimeout bounds each check, since some shell out to other programs
+const checkTimeout = 10 * time.Second
+
+// Check outcomes
+const (
+	Pass = "pass"
+	Warn = "warn"
+	Fail = "fail"
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// Check verifies one requirement. It returns the detail to show and an
+// error if the requirement isn't met.
+type Check struct {
+	Name string
+	// Optional checks warn instead of failing
+	Optional bool
+	Run      func(ctx context.Context) (string, error)
+}
+
+// Checks returns the checks for a configuration
+func Checks(cfg *config.Config) []Check {
+	checks := []Check{
+		{Name: "valkey-server", Run: binary("valkey-server", "--version")},
+		{Name: "aria2c", Run: binary("aria2c", "--version")},
+		{Name: "uv", Run: binary("uv", "--version")},
+		// Video encoding happens in ComfyUI, which can bring its own
+		{Name: "ffmpeg", Optional: true, Run: binary("ffmpeg", "-version")},
+		{Name: "GPU", Run: checkGPU},
+	}
+	dirs := []struct{ name, path string }{
+		{"data dir", cfg.DataDir},
+		{"models dir", cfg.ModelsDir},
+		{"outputs dir", cfg.OutputsDir},
+		{"scratch dir", cfg.ScratchDir},
+	}
+	for _, d := range dirs {
+		checks = append(checks, Check{Name: d.name, Run: writableDir(d.path)})
+	}
+	checks = append(checks,
+		Check{Name: "python dir", Run: existingDir(cfg.PythonPath)},
+		Check{Name: "HTTP port", Run: freePort(cfg.Port)},
+		Check{Name: "Valkey port", Run: freePort(cfg.ValkeyPort)},
+		Check{Name: "aria2 port", Run: freePort(cfg.Aria2Port)},
+	)
+	return checks
+}
+
+// Run runs each check in turn
+func Run(ctx context.Context, checks []Check) []Result {
+	results := make([]Result, 0, len(checks))
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		detail, err := c.Run(checkCtx)
+		cancel()
+
+		r := Result{Name: c.Name, Status: Pass, Detail: detail}
+		if err != nil {
+			r.Status, r.Detail = Fail, err.Error()
+			if c.Optional {
+				r.Status = Warn
+			}
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// Report prints one line per result and a summary, returning false if any
+// check failed
+func Report(w io.Writer, results []Result) bool {
+	width := 0
+	for _, r := range results {
+		width = max(width, len(r.Name))
+	}
+
+	failed := 0
+	for _, r := range results {
+		fmt.Fprintf(w, "[%s] %-*s  %s\n", strings.ToUpper(r.Status), width, r.Name, r.Detail)
+		if r.Status == Fail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "\n%d of %d checks failed\n", failed, len(results))
+		return false
+	}
+	fmt.Fprintf(w, "\nAll %d checks passed\n", len(results))
+	return true
+}
+
+// binary checks that a program is on PATH and reports the first line of
+// its version output
+func binary(name string, versionArgs ...string) func(context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			return "", fmt.Errorf("%s not found on PATH", name)
+		}
+		out, err := exec.CommandContext(ctx, path, versionArgs...).Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		version, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		return fmt.Sprintf("%s (%s)", version, path), nil
+	}
+}
+
+func checkGPU(ctx context.Context) (string, error) {
+	samples, err := gpu.Query(ctx)
+	if err != nil {
+		return "", fmt.Errorf("no NVIDIA GPU found: %w", err)
+	}
+	if len(samples) == 0 {
+		return "", fmt.Errorf("nvidia-smi reported no GPUs")
+	}
+	names := make([]string, len(samples))
+	for i, s := range samples {
+		names[i] = fmt.Sprintf("%s (%.0f MiB)", s.Name, s.MemoryTotalMB)
+	}
+	return strings.Join(names, ", "), nil
+}
+
+// writableDir checks that files can be created in a directory. One that
+// doesn't exist yet passes if the server will be able to create it.
+func writableDir(dir string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			return creatableDir(dir)
+		}
+		if _, err := statDir(dir); err != nil {
+			return "", err
+		}
+		f, err := os.CreateTemp(dir, ".diffbox-doctor-*")
+		if err != nil {
+			return "", fmt.Errorf("%s is not writable: %w", dir, err)
+		}
+		f.Close()
+		os.Remove(f.Name())
+		return dir, nil
+	}
+}
+
+// creatableDir checks that the nearest existing parent of a missing
+// directory is writable
+func creatableDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	parent := filepath.Dir(abs)
+	for {
+		if _, err := os.Stat(parent); !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		next := filepath.Dir(parent)
+		if next == parent {
+			break
+		}
+		parent = next
+	}
+	if _, err := writableDir(parent)(context.Background()); err != nil {
+		return "", fmt.Errorf("%s does not exist and cannot be created: %w", abs, err)
+	}
+	return abs + " (will be created)", nil
+}
+
+func existingDir(dir string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		return statDir(dir)
+	}
+}
+
+// statDir checks that dir is a directory and returns its absolute path
+func statDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%s does not exist", abs)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", abs)
+	}
+	return abs, nil
+}
+
+// freePort checks that nothing is listening on a port yet
+func freePort(port string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		ln, err := net.Listen("tcp", net.JoinHostPort("", port))
+		if err != nil {
+			return "", fmt.Errorf("port %s is in use: %w", port, err)
+		}
+		ln.Close()
+		return "port " + port + " is free", nil
+	}
+}
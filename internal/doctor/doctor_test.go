@@ -0,0 +1,73 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunAndReport(t *testing.T) {
+	checks := []Check{
+		{Name: "ok", Run: func(context.Context) (string, error) { return "fine", nil }},
+		{Name: "optional", Optional: true, Run: func(context.Context) (string, error) { return "", errors.New("missing") }},
+	}
+
+	results := Run(context.Background(), checks)
+	if results[0].Status != Pass || results[1].Status != Warn || results[1].Detail != "missing" {
+		t.Errorf("unexpected results %+v", results)
+	}
+	var out bytes.Buffer
+	if !Report(&out, results) {
+		t.Errorf("warnings alone should not fail the report:\n%s", out.String())
+	}
+
+	checks = append(checks, Check{Name: "required", Run: func(context.Context) (string, error) { return "", errors.New("broken") }})
+	out.Reset()
+	if Report(&out, Run(context.Background(), checks)) {
+		t.Error("expected report to fail")
+	}
+	if !strings.Contains(out.String(), "[FAIL] required") || !strings.Contains(out.String(), "1 of 3 checks failed") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
+
+func TestWritableDir(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := writableDir(dir)(context.Background()); err != nil {
+		t.Errorf("expected %s to be writable: %v", dir, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("check left files behind: %v", entries)
+	}
+	missing := filepath.Join(dir, "missing", "models")
+	if detail, err := writableDir(missing)(context.Background()); err != nil || !strings.Contains(detail, "will be created") {
+		t.Errorf("expected missing dir to be creatable, got %q, %v", detail, err)
+	}
+	if _, err := os.Stat(missing); err == nil {
+		t.Error("check created the missing dir")
+	}
+
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0644)
+	if _, err := writableDir(filepath.Join(file, "models"))(context.Background()); err == nil {
+		t.Error("expected dir under a file to fail")
+	}
+}
+
+func TestFreePort(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	if _, err := freePort(port)(context.Background()); err == nil {
+		t.Errorf("expected port %s to be reported in use", port)
+	}
+}
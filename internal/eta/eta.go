@@ -0,0 +1,67 @@
+// Package eta estimates how long a running job has left.
+package eta
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// minRateProgress is the progress below which the observed rate is too
+// noisy to extrapolate from (model loading dominates the first few percent)
+const minRateProgress = 0.05
+
+// ResolutionKey buckets a job's params by the settings that drive its run
+// time: output size and, for video, frame count
+func ResolutionKey(params string) string {
+	var p struct {
+		Width     int `json:"width"`
+		Height    int `json:"height"`
+		NumFrames int `json:"num_frames"`
+	}
+	if err := json.Unmarshal([]byte(params), &p); err != nil || p.Width == 0 || p.Height == 0 {
+		return "default"
+	}
+	if p.NumFrames > 0 {
+		return fmt.Sprintf("%dx%dx%d", p.Width, p.Height, p.NumFrames)
+	}
+	return fmt.Sprintf("%dx%d", p.Width, p.Height)
+}
+
+// Remaining estimates the time left for a job that has been running for
+// elapsed and reports progress in [0, 1]. expected is the historical
+// duration for similar jobs, or zero if there is none. The historical
+// estimate dominates early on and the observed rate takes over as the job
+// advances.
+func Remaining(progress float64, elapsed, expected time.Duration) (time.Duration, bool) {
+	if progress >= 1 {
+		return 0, true
+	}
+
+	var fromRate, fromHistory time.Duration
+	haveRate := progress >= minRateProgress && elapsed > 0
+	if haveRate {
+		fromRate = time.Duration(float64(elapsed) * (1 - progress) / progress)
+	}
+	haveHistory := expected > 0
+	if haveHistory {
+		fromHistory = expected - elapsed
+		if fromHistory < 0 {
+			// Running long; assume the unfinished share of a typical run
+			fromHistory = time.Duration(float64(expected) * (1 - progress))
+		}
+	}
+
+	var remaining time.Duration
+	switch {
+	case haveRate && haveHistory:
+		remaining = time.Duration(progress*float64(fromRate) + (1-progress)*float64(fromHistory))
+	case haveRate:
+		remaining = fromRate
+	case haveHistory:
+		remaining = fromHistory
+	default:
+		return 0, false
+	}
+	return remaining.Round(time.Second), true
+}
@@ -0,0 +1,85 @@
+package eta
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolutionKey(t *testing.T) {
+	tests := []struct {
+		params string
+		want   string
+	}{
+		{`{"width":832,"height":480,"num_frames":81}`, "832x480x81"},
+		{`{"width":1024,"height":1024}`, "1024x1024"},
+		{`{"messages":[]}`, "default"},
+		{`not json`, "default"},
+	}
+
+	for _, tt := range tests {
+		if got := ResolutionKey(tt.params); got != tt.want {
+			t.Errorf("ResolutionKey(%s) = %s, want %s", tt.params, got, tt.want)
+		}
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress float64
+		elapsed  time.Duration
+		expected time.Duration
+		want     time.Duration
+		ok       bool
+	}{
+		{"nothing to go on", 0.01, 10 * time.Second, 0, 0, false},
+		{"history only", 0.01, time.Minute, 10 * time.Minute, 9 * time.Minute, true},
+		{"rate only", 0.5, 3 * time.Minute, 0, 3 * time.Minute, true},
+		{"rate and history agree", 0.5, 5 * time.Minute, 10 * time.Minute, 5 * time.Minute, true},
+		{"running past history", 0.9, 20 * time.Minute, 10 * time.Minute, 2*time.Minute + 6*time.Second, true},
+		{"done", 1, time.Minute, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Remaining(tt.progress, tt.elapsed, tt.expected)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Remaining = %v, %v; want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestQueueStarts(t *testing.T) {
+	m := time.Minute
+	tests := []struct {
+		name    string
+		busy    []time.Duration
+		workers int
+		queued  []time.Duration
+		want    []time.Duration
+	}{
+		{"idle worker", nil, 1, []time.Duration{5 * m, 5 * m}, []time.Duration{0, 5 * m}},
+		{"behind running job", []time.Duration{3 * m}, 1, []time.Duration{5 * m, 2 * m}, []time.Duration{3 * m, 8 * m}},
+		{"two workers", []time.Duration{3 * m}, 2, []time.Duration{5 * m, 2 * m, m}, []time.Duration{0, 3 * m, 5 * m}},
+		{"overdue running job", []time.Duration{-m}, 1, []time.Duration{m}, []time.Duration{0}},
+		{"unknown running job", []time.Duration{Unknown}, 1, []time.Duration{m}, []time.Duration{Unknown}},
+		{"unknown queued job", nil, 1, []time.Duration{Unknown, m}, []time.Duration{0, Unknown}},
+		{"unknown on one of two workers", nil, 2, []time.Duration{Unknown, 2 * m, m}, []time.Duration{0, 0, 2 * m}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := QueueStarts(tt.busy, tt.workers, tt.queued)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
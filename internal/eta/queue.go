@@ -0,0 +1,50 @@
+package eta
+
+import "time"
+
+// Unknown marks a duration with no estimate
+const Unknown time.Duration = -1
+
+// QueueStarts estimates when each queued job will start, as an offset
+// from now. busy holds the time left on each job already dispatched,
+// workers is how many jobs run at once and queued holds the expected run
+// time of each waiting job, next to run first. Jobs are assumed to go to
+// whichever worker frees up first. Any of the durations may be Unknown; a
+// worker whose current job has no estimate is left out, and a job starts
+// at Unknown once no worker has a known free time.
+func QueueStarts(busy []time.Duration, workers int, queued []time.Duration) []time.Duration {
+	if workers < len(busy) {
+		workers = len(busy)
+	}
+	// Time until each worker is free
+	free := make([]time.Duration, 0, workers)
+	for _, d := range busy {
+		if d != Unknown {
+			free = append(free, max(d, 0))
+		}
+	}
+	for i := len(busy); i < workers; i++ {
+		free = append(free, 0)
+	}
+
+	starts := make([]time.Duration, len(queued))
+	for i, d := range queued {
+		if len(free) == 0 {
+			starts[i] = Unknown
+			continue
+		}
+		next := 0
+		for j := range free {
+			if free[j] < free[next] {
+				next = j
+			}
+		}
+		starts[i] = free[next].Round(time.Second)
+		if d == Unknown {
+			free = append(free[:next], free[next+1:]...)
+		} else {
+			free[next] += d
+		}
+	}
+	return starts
+}
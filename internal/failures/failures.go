@@ -0,0 +1,163 @@
+package failures
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Failure categories for errors diffbox knows how to recognise
+const (
+	CategoryCUDAOOM        = "cuda_oom"
+	CategoryModelMissing   = "model_missing"
+	CategoryBackendDown    = "backend_unreachable"
+	CategoryDispatchFailed = "dispatch_failed"
+	CategoryInvalidInput   = "invalid_input"
+	CategoryOther          = "other"
+)
+
+// categoryRules are checked in order against the lowercased error text
+var categoryRules = []struct {
+	category string
+	patterns []string
+}{
+	{CategoryCUDAOOM, []string{"cuda out of memory", "outofmemoryerror", "cuda error: out of memory", "cublas_status_alloc_failed"}},
+	{CategoryModelMissing, []string{".safetensors", "no such file or directory", "filenotfounderror", "model not found"}},
+	{CategoryBackendDown, []string{"connection refused", "cannot connect to host", "clientconnectorerror", "connection reset"}},
+	{CategoryDispatchFailed, []string{"dispatch failed", "no running workers", "no workers available"}},
+	{CategoryInvalidInput, []string{"valueerror", "is required"}},
+}
+
+// Normalization strips the parts of an error that vary between
+// occurrences of the same underlying problem
+var (
+	uuidPattern   = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	hexPattern    = regexp.MustCompile(`0x[0-9a-fA-F]+`)
+	pathPattern   = regexp.MustCompile(`(/[\w.\-]+)+`)
+	numberPattern = regexp.MustCompile(`\d+(\.\d+)?`)
+	spacePattern  = regexp.MustCompile(`\s+`)
+)
+
+// maxSignatureLength bounds signatures built from long tracebacks, in
+// characters
+const maxSignatureLength = 200
+
+// Fingerprint identifies a class of failure
+type Fingerprint struct {
+	ID        string
+	Category  string
+	Signature string
+}
+
+// Classify returns the fingerprint of an error message. Only the head of
+// a traceback is used: the first line carrying the exception, with IDs,
+// paths and numbers replaced by placeholders.
+func Classify(errMsg string) Fingerprint {
+	lower := strings.ToLower(errMsg)
+
+	category := CategoryOther
+	for _, rule := range categoryRules {
+		for _, p := range rule.patterns {
+			if strings.Contains(lower, p) {
+				category = rule.category
+				break
+			}
+		}
+		if category != CategoryOther {
+			break
+		}
+	}
+
+	signature := normalize(head(errMsg))
+	sum := sha1.Sum([]byte(category + "|" + signature))
+
+	return Fingerprint{
+		ID:        hex.EncodeToString(sum[:6]),
+		Category:  category,
+		Signature: signature,
+	}
+}
+
+// head returns the most telling line of an error: the last line of a
+// Python traceback (the exception itself), or the first line otherwise
+func head(errMsg string) string {
+	lines := strings.Split(strings.TrimSpace(errMsg), "\n")
+	if strings.HasPrefix(lines[0], "Traceback") {
+		for i := len(lines) - 1; i >= 0; i-- {
+			if line := strings.TrimSpace(lines[i]); line != "" {
+				return line
+			}
+		}
+	}
+	return lines[0]
+}
+
+func normalize(s string) string {
+	s = uuidPattern.ReplaceAllString(s, "<id>")
+	s = hexPattern.ReplaceAllString(s, "<hex>")
+	s = pathPattern.ReplaceAllString(s, "<path>")
+	s = numberPattern.ReplaceAllString(s, "<n>")
+	s = strings.TrimSpace(spacePattern.ReplaceAllString(s, " "))
+	if utf8.RuneCountInString(s) > maxSignatureLength {
+		s = string([]rune(s)[:maxSignatureLength]) + "…"
+	}
+	return s
+}
+
+// Occurrence is one failed job
+type Occurrence struct {
+	JobID    string
+	JobType  string
+	Error    string
+	FailedAt time.Time
+}
+
+// Group aggregates occurrences sharing a fingerprint
+type Group struct {
+	Fingerprint
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	LastJobID string
+	LastError string
+	JobTypes  map[string]int
+}
+
+// Aggregate groups failures by fingerprint, most frequent first
+func Aggregate(occurrences []Occurrence) []*Group {
+	groups := make(map[string]*Group)
+	for _, o := range occurrences {
+		fp := Classify(o.Error)
+		g, ok := groups[fp.ID]
+		if !ok {
+			g = &Group{Fingerprint: fp, FirstSeen: o.FailedAt, JobTypes: make(map[string]int)}
+			groups[fp.ID] = g
+		}
+		g.Count++
+		g.JobTypes[o.JobType]++
+		if o.FailedAt.Before(g.FirstSeen) {
+			g.FirstSeen = o.FailedAt
+		}
+		if !o.FailedAt.Before(g.LastSeen) {
+			g.LastSeen = o.FailedAt
+			g.LastJobID = o.JobID
+			g.LastError = o.Error
+		}
+	}
+
+	result := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+	return result
+}
@@ -0,0 +1,79 @@
+package failures
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestClassifyCategories(t *testing.T) {
+	tests := []struct {
+		err      string
+		expected string
+	}{
+		{"OutOfMemoryError: CUDA out of memory. Tried to allocate 2.00 GiB (GPU 0; 23.65 GiB total capacity)", CategoryCUDAOOM},
+		{"FileNotFoundError: [Errno 2] No such file or directory: '/models/wan_2.1_vae.safetensors'", CategoryModelMissing},
+		{"ClientConnectorError: Cannot connect to host localhost:8188", CategoryBackendDown},
+		{"dispatch failed: no running workers available", CategoryDispatchFailed},
+		{"ValueError: input_image is required for I2V", CategoryInvalidInput},
+		{"RuntimeError: something unexpected", CategoryOther},
+	}
+
+	for _, tt := range tests {
+		if got := Classify(tt.err).Category; got != tt.expected {
+			t.Errorf("Classify(%q) category = %s, expected %s", tt.err, got, tt.expected)
+		}
+	}
+}
+
+func TestClassifyNormalizesVariableParts(t *testing.T) {
+	a := Classify("OutOfMemoryError: CUDA out of memory. Tried to allocate 2.00 GiB for job 3f2b8c1e-1111-2222-3333-444455556666")
+	b := Classify("OutOfMemoryError: CUDA out of memory. Tried to allocate 1.50 GiB for job 9a8b7c6d-aaaa-bbbb-cccc-ddddeeeeffff")
+	if a.ID != b.ID {
+		t.Errorf("expected same fingerprint, got %s (%q) vs %s (%q)", a.ID, a.Signature, b.ID, b.Signature)
+	}
+
+	c := Classify("RuntimeError: different problem")
+	if a.ID == c.ID {
+		t.Error("expected different fingerprints for different errors")
+	}
+}
+
+func TestClassifyTruncatesOnRunes(t *testing.T) {
+	fp := Classify("ValueError: " + strings.Repeat("é", maxSignatureLength))
+	if !utf8.ValidString(fp.Signature) || utf8.RuneCountInString(fp.Signature) != maxSignatureLength+1 {
+		t.Errorf("expected %d characters and an ellipsis, got %q", maxSignatureLength, fp.Signature)
+	}
+}
+
+func TestClassifyTracebackUsesException(t *testing.T) {
+	tb := "Traceback (most recent call last):\n  File \"/app/worker/i2v.py\", line 42, in run\n    x()\nKeyError: 'seed'\n"
+	fp := Classify(tb)
+	if fp.Signature != "KeyError: 'seed'" {
+		t.Errorf("expected exception line as signature, got %q", fp.Signature)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	now := time.Now()
+	groups := Aggregate([]Occurrence{
+		{JobID: "a", JobType: "i2v", Error: "CUDA out of memory. Tried to allocate 2 GiB", FailedAt: now.Add(-2 * time.Hour)},
+		{JobID: "b", JobType: "svi", Error: "CUDA out of memory. Tried to allocate 4 GiB", FailedAt: now},
+		{JobID: "c", JobType: "qwen", Error: "RuntimeError: boom", FailedAt: now.Add(-time.Hour)},
+	})
+
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+	oom := groups[0]
+	if oom.Category != CategoryCUDAOOM || oom.Count != 2 {
+		t.Errorf("expected OOM group with 2 occurrences first, got %+v", oom)
+	}
+	if oom.LastJobID != "b" || !oom.LastSeen.Equal(now) {
+		t.Errorf("expected last occurrence to be job b, got %s at %v", oom.LastJobID, oom.LastSeen)
+	}
+	if oom.JobTypes["i2v"] != 1 || oom.JobTypes["svi"] != 1 {
+		t.Errorf("unexpected job type breakdown: %v", oom.JobTypes)
+	}
+}
@@ -0,0 +1,128 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrOutsideRoot is returned when a path resolves outside its root,
+	// whether through ".." segments or a symlink
+	ErrOutsideRoot = errors.New("path escapes root")
+	// ErrNotFound is returned for missing files and directories
+	ErrNotFound = errors.New("file not found")
+)
+
+// contentTypes maps the extensions diffbox serves to explicit MIME types so
+// responses never depend on the host's mime database or content sniffing
+var contentTypes = map[string]string{
+	".html":  "text/html; charset=utf-8",
+	".js":    "text/javascript; charset=utf-8",
+	".mjs":   "text/javascript; charset=utf-8",
+	".css":   "text/css; charset=utf-8",
+	".json":  "application/json",
+	".map":   "application/json",
+	".txt":   "text/plain; charset=utf-8",
+	".svg":   "image/svg+xml",
+	".ico":   "image/x-icon",
+	".png":   "image/png",
+	".jpg":   "image/jpeg",
+	".jpeg":  "image/jpeg",
+	".webp":  "image/webp",
+	".gif":   "image/gif",
+	".mp4":   "video/mp4",
+	".webm":  "video/webm",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+}
+
+// ContentType returns the MIME type served for a file name
+func ContentType(name string) string {
+	if ct, ok := contentTypes[strings.ToLower(filepath.Ext(name))]; ok {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// Root is a directory files may be served from. All lookups are confined to
+// it after symlinks are resolved.
+type Root struct {
+	dir string
+}
+
+// NewRoot creates a root for dir, which must exist
+func NewRoot(dir string) (*Root, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve root %s: %w", dir, err)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("resolve root %s: %w", dir, err)
+	}
+	return &Root{dir: resolved}, nil
+}
+
+// Dir returns the resolved root directory
+func (r *Root) Dir() string {
+	return r.dir
+}
+
+// Resolve maps a slash-separated request path to a file path inside the
+// root. It returns ErrNotFound if nothing exists there and ErrOutsideRoot
+// if the path or any symlink along it leads out of the root.
+func (r *Root) Resolve(name string) (string, error) {
+	if strings.ContainsRune(name, 0) || strings.Contains(name, "\\") {
+		return "", ErrOutsideRoot
+	}
+
+	// Cleaning against "/" collapses any ".." before it can climb
+	rel := strings.TrimPrefix(path.Clean("/"+name), "/")
+	full := filepath.Join(r.dir, filepath.FromSlash(rel))
+
+	resolved, err := filepath.EvalSymlinks(full)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+
+	if resolved != r.dir && !strings.HasPrefix(resolved, r.dir+string(filepath.Separator)) {
+		return "", ErrOutsideRoot
+	}
+	return resolved, nil
+}
+
+// Serve writes the named regular file with an explicit content type and
+// range support. Directories are reported as ErrNotFound.
+func (r *Root) Serve(w http.ResponseWriter, req *http.Request, name string) error {
+	resolved, err := r.Resolve(name)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(resolved)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return ErrNotFound
+	}
+
+	w.Header().Set("Content-Type", ContentType(resolved))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, req, info.Name(), info.ModTime(), f)
+	return nil
+}
@@ -0,0 +1,87 @@
+package files
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setupRoot(t *testing.T) (*Root, string) {
+	t.Helper()
+	base := t.TempDir()
+	rootDir := filepath.Join(base, "outputs")
+	if err := os.MkdirAll(filepath.Join(rootDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootDir, "job.mp4"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := NewRoot(rootDir)
+	if err != nil {
+		t.Fatalf("NewRoot failed: %v", err)
+	}
+	return root, base
+}
+
+func TestResolve(t *testing.T) {
+	root, base := setupRoot(t)
+
+	if _, err := root.Resolve("job.mp4"); err != nil {
+		t.Errorf("expected job.mp4 to resolve, got %v", err)
+	}
+	if _, err := root.Resolve("missing.mp4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// ".." is collapsed against the root, so this looks for outputs/secret.txt
+	if _, err := root.Resolve("../secret.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected traversal to stay inside root, got %v", err)
+	}
+	if _, err := root.Resolve("sub\\..\\..\\secret.txt"); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("expected backslash path to be rejected, got %v", err)
+	}
+
+	// A symlink pointing out of the root must not be followed
+	if err := os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(root.Dir(), "link.txt")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	if _, err := root.Resolve("link.txt"); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("expected symlink escape to be rejected, got %v", err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	root, _ := setupRoot(t)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/outputs/job.mp4", nil)
+	if err := root.Serve(rec, req, "job.mp4"); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "video/mp4" {
+		t.Errorf("expected video/mp4, got %s", ct)
+	}
+	if rec.Body.String() != "video" {
+		t.Errorf("unexpected body %q", rec.Body.String())
+	}
+
+	if err := root.Serve(httptest.NewRecorder(), req, "sub"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected directory to be ErrNotFound, got %v", err)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	if ct := ContentType("a.PNG"); ct != "image/png" {
+		t.Errorf("expected image/png, got %s", ct)
+	}
+	if ct := ContentType("a.exe"); ct != "application/octet-stream" {
+		t.Errorf("expected octet-stream fallback, got %s", ct)
+	}
+}
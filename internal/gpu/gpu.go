@@ -0,0 +1,203 @@
+package gpu
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sample is one reading of one GPU
+type Sample struct {
+	Timestamp      time.Time `json:"timestamp"`
+	Index          int       `json:"index"`
+	Name           string    `json:"name"`
+	UtilizationPct float64   `json:"utilization_pct"`
+	MemoryUsedMB   float64   `json:"memory_used_mb"`
+	MemoryTotalMB  float64   `json:"memory_total_mb"`
+	TemperatureC   float64   `json:"temperature_c"`
+	PowerW         float64   `json:"power_w"`
+}
+
+// queryFields are requested from nvidia-smi, which reads them through NVML
+const queryFields = "index,name,utilization.gpu,memory.used,memory.total,temperature.gpu,power.draw"
+
+// Query samples all GPUs once using nvidia-smi
+func Query(ctx context.Context) ([]Sample, error) {
+	out, err := exec.CommandContext(ctx, "nvidia-smi",
+		"--query-gpu="+queryFields,
+		"--format=csv,noheader,nounits",
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("nvidia-smi: %w", err)
+	}
+	return parseSamples(string(out), time.Now())
+}
+
+// DriverVersion asks nvidia-smi for the installed NVIDIA driver version
+func DriverVersion(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "nvidia-smi",
+		"--query-gpu=driver_version",
+		"--format=csv,noheader",
+	).Output()
+	if err != nil {
+		return "", fmt.Errorf("nvidia-smi: %w", err)
+	}
+	// One line per GPU, all the same
+	version, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(version), nil
+}
+
+// parseSamples parses nvidia-smi CSV output. Fields nvidia-smi can't read
+// on a given card come back as "[N/A]" and are left at zero.
+func parseSamples(out string, now time.Time) ([]Sample, error) {
+	r := csv.NewReader(strings.NewReader(out))
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parse nvidia-smi output: %w", err)
+	}
+
+	samples := make([]Sample, 0, len(records))
+	for _, rec := range records {
+		if len(rec) != 7 {
+			return nil, fmt.Errorf("unexpected nvidia-smi field count %d", len(rec))
+		}
+		index, err := strconv.Atoi(strings.TrimSpace(rec[0]))
+		if err != nil {
+			return nil, fmt.Errorf("parse gpu index %q: %w", rec[0], err)
+		}
+		samples = append(samples, Sample{
+			Timestamp:      now,
+			Index:          index,
+			Name:           strings.TrimSpace(rec[1]),
+			UtilizationPct: parseFloat(rec[2]),
+			MemoryUsedMB:   parseFloat(rec[3]),
+			MemoryTotalMB:  parseFloat(rec[4]),
+			TemperatureC:   parseFloat(rec[5]),
+			PowerW:         parseFloat(rec[6]),
+		})
+	}
+	return samples, nil
+}
+
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return f
+}
+
+// QueryFunc samples all GPUs; swapped out in tests
+type QueryFunc func(ctx context.Context) ([]Sample, error)
+
+// Monitor samples GPUs periodically and keeps a fixed-size history
+type Monitor struct {
+	query    QueryFunc
+	interval time.Duration
+
+	mu      sync.RWMutex
+	history []Sample
+	next    int
+	full    bool
+	latest  []Sample
+}
+
+// NewMonitor creates a monitor keeping the most recent capacity samples
+func NewMonitor(query QueryFunc, interval time.Duration, capacity int) *Monitor {
+	return &Monitor{
+		query:    query,
+		interval: interval,
+		history:  make([]Sample, capacity),
+	}
+}
+
+// Run samples until ctx is cancelled, calling onSample with each reading.
+// It only gives up when nvidia-smi isn't installed; other failures, such
+// as a driver still starting, are retried on the next tick. Each query gets
+// one interval to answer.
+func (m *Monitor) Run(ctx context.Context, onSample func([]Sample)) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	failing := false
+	for {
+		queryCtx, cancel := context.WithTimeout(ctx, m.interval)
+		samples, err := m.query(queryCtx)
+		cancel()
+		switch {
+		case errors.Is(err, exec.ErrNotFound):
+			log.Printf("GPU telemetry unavailable, sampling disabled: %v", err)
+			return
+		case err != nil:
+			// Log the start of a run of failures, not every one
+			if !failing && ctx.Err() == nil {
+				log.Printf("GPU telemetry sample failed, retrying: %v", err)
+			}
+			failing = true
+		default:
+			if failing {
+				log.Println("GPU telemetry recovered")
+			}
+			failing = false
+			m.record(samples)
+			if onSample != nil {
+				onSample(samples)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) record(samples []Sample) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.latest = samples
+	if len(m.history) == 0 {
+		return
+	}
+	for _, s := range samples {
+		m.history[m.next] = s
+		m.next = (m.next + 1) % len(m.history)
+		if m.next == 0 {
+			m.full = true
+		}
+	}
+}
+
+// Latest returns the most recent reading of every GPU
+func (m *Monitor) Latest() []Sample {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]Sample(nil), m.latest...)
+}
+
+// History returns buffered samples taken after since, oldest first
+func (m *Monitor) History(since time.Time) []Sample {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ordered []Sample
+	if m.full {
+		ordered = append(ordered, m.history[m.next:]...)
+	}
+	ordered = append(ordered, m.history[:m.next]...)
+
+	result := make([]Sample, 0, len(ordered))
+	for _, s := range ordered {
+		if s.Timestamp.After(since) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
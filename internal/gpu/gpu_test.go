@@ -0,0 +1,105 @@
+package gpu
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestParseSamples(t *testing.T) {
+	out := "0, NVIDIA GeForce RTX 4090, 87, 20123, 24564, 71, 412.35\n1, NVIDIA A100-SXM4-80GB, 0, 5, 81920, 34, [N/A]\n"
+	now := time.Now()
+
+	samples, err := parseSamples(out, now)
+	if err != nil {
+		t.Fatalf("parseSamples failed: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(samples))
+	}
+
+	s := samples[0]
+	if s.Index != 0 || s.Name != "NVIDIA GeForce RTX 4090" {
+		t.Errorf("unexpected identity: %+v", s)
+	}
+	if s.UtilizationPct != 87 || s.MemoryUsedMB != 20123 || s.MemoryTotalMB != 24564 || s.TemperatureC != 71 || s.PowerW != 412.35 {
+		t.Errorf("unexpected readings: %+v", s)
+	}
+	if samples[1].PowerW != 0 {
+		t.Errorf("expected [N/A] power to parse as 0, got %f", samples[1].PowerW)
+	}
+
+	if _, err := parseSamples("0, only, three\n", now); err == nil {
+		t.Error("expected error for malformed output")
+	}
+}
+
+func TestMonitorHistoryRingBuffer(t *testing.T) {
+	m := NewMonitor(nil, time.Second, 3)
+	base := time.Now()
+
+	for i := 0; i < 5; i++ {
+		m.record([]Sample{{Timestamp: base.Add(time.Duration(i) * time.Second), Index: i}})
+	}
+
+	history := m.History(time.Time{})
+	if len(history) != 3 {
+		t.Fatalf("expected 3 buffered samples, got %d", len(history))
+	}
+	for i, s := range history {
+		if s.Index != i+2 {
+			t.Errorf("history[%d]: expected sample %d, got %d", i, i+2, s.Index)
+		}
+	}
+
+	recent := m.History(base.Add(3 * time.Second))
+	if len(recent) != 1 || recent[0].Index != 4 {
+		t.Errorf("expected only sample 4 after cutoff, got %+v", recent)
+	}
+
+	if latest := m.Latest(); len(latest) != 1 || latest[0].Index != 4 {
+		t.Errorf("expected latest sample 4, got %+v", latest)
+	}
+}
+
+func TestMonitorRunRetries(t *testing.T) {
+	calls := 0
+	query := func(ctx context.Context) ([]Sample, error) {
+		calls++
+		switch calls {
+		case 1:
+			return nil, errors.New("driver not loaded")
+		case 2:
+			// A hung nvidia-smi is cut off after one interval
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return []Sample{{Index: 0}}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := NewMonitor(query, 10*time.Millisecond, 4)
+	m.Run(ctx, func([]Sample) { cancel() })
+	if calls != 3 || len(m.Latest()) != 1 {
+		t.Errorf("expected a sample on the third query, got %d queries and %+v", calls, m.Latest())
+	}
+}
+
+func TestMonitorRunStopsWithoutNvidiaSMI(t *testing.T) {
+	query := func(ctx context.Context) ([]Sample, error) {
+		return nil, &exec.Error{Name: "nvidia-smi", Err: exec.ErrNotFound}
+	}
+	done := make(chan struct{})
+	go func() {
+		NewMonitor(query, 10*time.Millisecond, 4).Run(context.Background(), nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Run to give up without nvidia-smi")
+	}
+}
@@ -0,0 +1,109 @@
+package gpu
+
+import (
+	"sync"
+	"time"
+)
+
+// Usage is what a job drew from the GPUs while it ran
+type Usage struct {
+	// GPUSeconds is the job's share of GPU time: each GPU's time is
+	// split evenly between the jobs running then, so on a single GPU
+	// with one worker it is the run time
+	GPUSeconds float64
+	// EnergyWh is the job's share of the GPUs' power draw, split the
+	// same way
+	EnergyWh float64
+	// Sampled is false if no GPU reading was taken while the job ran,
+	// in which case nothing could be measured
+	Sampled bool
+}
+
+// Meter attributes GPU time and power draw to running jobs. Jobs don't
+// map to particular GPUs, so between two readings every job running is
+// charged an even share of the time and of the power all GPUs drew.
+type Meter struct {
+	mu     sync.Mutex
+	jobs   map[string]*meteredJob
+	latest []Sample
+}
+
+type meteredJob struct {
+	usage Usage
+	since time.Time // Charged up to here
+}
+
+func NewMeter() *Meter {
+	return &Meter{jobs: make(map[string]*meteredJob)}
+}
+
+// Start begins charging a job. Starting a job already metered does
+// nothing, so it can be called with every progress report.
+func (m *Meter) Start(jobID string) {
+	m.StartAt(jobID, time.Now())
+}
+
+// StartAt is Start from a given time
+func (m *Meter) StartAt(jobID string, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.jobs[jobID]; !ok {
+		m.jobs[jobID] = &meteredJob{since: at}
+	}
+}
+
+// Record takes a new reading and charges the running jobs for the time
+// since they were last charged at its power. Jobs that stop before the
+// next reading are charged at it too.
+func (m *Meter) Record(samples []Sample) {
+	if len(samples) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.charge(samples[0].Timestamp, samples)
+	m.latest = samples
+}
+
+// Stop ends charging a job and returns its usage, charging the time since
+// the last reading at that reading's power. ok is false if the job wasn't
+// being metered.
+func (m *Meter) Stop(jobID string) (usage Usage, ok bool) {
+	return m.StopAt(jobID, time.Now())
+}
+
+// StopAt is Stop at a given time
+func (m *Meter) StopAt(jobID string, at time.Time) (usage Usage, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.jobs[jobID]; !ok {
+		return Usage{}, false
+	}
+	m.charge(at, m.latest)
+	job := m.jobs[jobID]
+	delete(m.jobs, jobID)
+	return job.usage, true
+}
+
+// charge splits the time from each job's last charge up to at, and the
+// power samples report, between the running jobs
+func (m *Meter) charge(at time.Time, samples []Sample) {
+	if len(m.jobs) == 0 {
+		return
+	}
+	var watts float64
+	for _, s := range samples {
+		watts += s.PowerW
+	}
+	share := 1 / float64(len(m.jobs))
+	for _, job := range m.jobs {
+		seconds := at.Sub(job.since).Seconds()
+		if seconds <= 0 {
+			continue
+		}
+		job.usage.GPUSeconds += seconds * float64(len(samples)) * share
+		job.usage.EnergyWh += watts * seconds / 3600 * share
+		job.usage.Sampled = job.usage.Sampled || len(samples) > 0
+		job.since = at
+	}
+}
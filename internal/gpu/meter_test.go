@@ -0,0 +1,57 @@
+package gpu
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMeter(t *testing.T) {
+	m := NewMeter()
+	base := time.Now()
+	reading := func(offset time.Duration, watts ...float64) []Sample {
+		samples := make([]Sample, len(watts))
+		for i, w := range watts {
+			samples[i] = Sample{Timestamp: base.Add(offset), Index: i, PowerW: w}
+		}
+		return samples
+	}
+
+	// One job alone on two GPUs for 10s, then sharing them with another
+	// for 20s
+	m.StartAt("a", base)
+	m.Record(reading(10*time.Second, 300, 60))
+	m.StartAt("b", base.Add(10*time.Second))
+	m.StartAt("a", base.Add(15*time.Second)) // Already metered
+	m.Record(reading(30*time.Second, 400, 320))
+
+	a, ok := m.StopAt("a", base.Add(30*time.Second))
+	if !ok || !a.Sampled {
+		t.Fatalf("StopAt(a) = %+v, %v", a, ok)
+	}
+	// 10s x 2 GPUs + half of 20s x 2 GPUs; 360W for 10s + half of 720W for 20s
+	if !near(a.GPUSeconds, 40) || !near(a.EnergyWh, (360*10+720*20/2)/3600.0) {
+		t.Errorf("usage of a = %+v", a)
+	}
+
+	// Alone again after the last reading, charged at its power
+	b, _ := m.StopAt("b", base.Add(36*time.Second))
+	if !near(b.GPUSeconds, 20+12) || !near(b.EnergyWh, (720*20/2+720*6)/3600.0) {
+		t.Errorf("usage of b = %+v", b)
+	}
+
+	if _, ok := m.StopAt("a", base.Add(40*time.Second)); ok {
+		t.Error("expected a stopped job to be forgotten")
+	}
+
+	// Without any reading nothing is measured
+	unmetered := NewMeter()
+	unmetered.StartAt("c", base)
+	if c, _ := unmetered.StopAt("c", base.Add(time.Minute)); c.Sampled || c.EnergyWh != 0 {
+		t.Errorf("usage without readings = %+v", c)
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,124 @@
+// Package inputs stores input images content-addressed by their SHA-256,
+// so an image uploaded many times is kept once and jobs can refer back to
+// it by hash.
+package inputs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RefPrefix marks an image field that names a library image instead of
+// carrying base64, e.g. "input:3a7bd3e2..."
+const RefPrefix = "input:"
+
+// ErrNotFound is returned for hashes with no file in the library
+var ErrNotFound = errors.New("input image not found")
+
+// extensions maps the upload package's format names to file extensions
+var extensions = map[string]string{
+	"png":  ".png",
+	"jpeg": ".jpg",
+	"webp": ".webp",
+}
+
+// Library is a directory of images named <hash><ext>
+type Library struct {
+	dir string
+}
+
+// New returns a library in dir, which must exist
+func New(dir string) *Library {
+	return &Library{dir: dir}
+}
+
+// Hash returns the content address of an image
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidHash reports whether s looks like a hash Hash returned. Paths are
+// built from hashes, so anything else is refused before touching disk.
+func ValidHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
+
+// ParseRef returns the hash an image field refers to, and false if the
+// field isn't a library reference
+func ParseRef(s string) (string, bool) {
+	if !strings.HasPrefix(s, RefPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(s, RefPrefix), true
+}
+
+// Path returns where an image of the given format is stored
+func (l *Library) Path(hash, format string) string {
+	return filepath.Join(l.dir, hash+extensions[format])
+}
+
+// Store writes an already validated image unless an identical one is
+// there, returning its hash and whether it was new. Files are written to a
+// temporary name and renamed, so a crash never leaves a partial image
+// under a valid hash.
+func (l *Library) Store(data []byte, format string) (hash string, created bool, err error) {
+	if _, ok := extensions[format]; !ok {
+		return "", false, fmt.Errorf("unsupported image format %q", format)
+	}
+	hash = Hash(data)
+	path := l.Path(hash, format)
+	if _, err := os.Stat(path); err == nil {
+		return hash, false, nil
+	}
+
+	tmp, err := os.CreateTemp(l.dir, ".upload-*")
+	if err != nil {
+		return "", false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", false, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", false, err
+	}
+	return hash, true, nil
+}
+
+// Read returns an image's bytes, or ErrNotFound
+func (l *Library) Read(hash, format string) ([]byte, error) {
+	if !ValidHash(hash) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(l.Path(hash, format))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Remove deletes an image. Removing a missing image is not an error.
+func (l *Library) Remove(hash, format string) error {
+	if !ValidHash(hash) {
+		return ErrNotFound
+	}
+	err := os.Remove(l.Path(hash, format))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package inputs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestStoreDeduplicates(t *testing.T) {
+	lib := New(t.TempDir())
+	data := []byte("\x89PNG fake image bytes")
+
+	hash, created, err := lib.Store(data, "png")
+	if err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if !created || !ValidHash(hash) || hash != Hash(data) {
+		t.Fatalf("unexpected first store: hash=%s created=%v", hash, created)
+	}
+
+	again, created, err := lib.Store(data, "png")
+	if err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if created || again != hash {
+		t.Errorf("expected identical upload to be deduplicated, got hash=%s created=%v", again, created)
+	}
+
+	got, err := lib.Read(hash, "png")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Read returned %q, %v", got, err)
+	}
+
+	if err := lib.Remove(hash, "png"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(lib.Path(hash, "png")); !os.IsNotExist(err) {
+		t.Errorf("expected file to be removed, got %v", err)
+	}
+	if _, err := lib.Read(hash, "png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after removal, got %v", err)
+	}
+}
+
+func TestStoreRejectsUnknownFormat(t *testing.T) {
+	if _, _, err := New(t.TempDir()).Store([]byte("GIF89a"), "gif"); err == nil {
+		t.Error("expected unsupported format to be refused")
+	}
+}
+
+func TestRefsAndHashes(t *testing.T) {
+	hash := Hash([]byte("x"))
+	if got, ok := ParseRef(RefPrefix + hash); !ok || got != hash {
+		t.Errorf("ParseRef = %q, %v", got, ok)
+	}
+	if _, ok := ParseRef("iVBORw0KGgo="); ok {
+		t.Error("base64 should not parse as a reference")
+	}
+	for _, bad := range []string{"", "../../etc/passwd", hash[:10], "Z" + hash[1:], hash + "00"} {
+		if ValidHash(bad) {
+			t.Errorf("expected %q to be an invalid hash", bad)
+		}
+	}
+	if _, err := New(t.TempDir()).Read("../secret", "png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected invalid hash to read as not found, got %v", err)
+	}
+}
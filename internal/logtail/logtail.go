@@ -0,0 +1,91 @@
+// Package logtail keeps the last lines of log output in memory, for
+// diagnostics bundles and crash dumps.
+package logtail
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"sync"
+)
+
+// serverLines is how many lines of the server log are kept
+const serverLines = 5000
+
+// Server holds the server's recent log output once Capture is called
+var Server = New(serverLines)
+
+// Capture copies everything the standard logger writes into Server
+func Capture() {
+	log.SetOutput(io.MultiWriter(log.Writer(), Server))
+}
+
+// Tail is a ring of the last lines written to it. It is safe for
+// concurrent use.
+type Tail struct {
+	mu      sync.Mutex
+	lines   []string
+	next    int
+	full    bool
+	partial []byte // Written after the last newline
+}
+
+// New returns a Tail keeping the last n lines
+func New(n int) *Tail {
+	return &Tail{lines: make([]string, n)}
+}
+
+// Write splits p into lines, holding back a trailing partial line until
+// its newline arrives
+func (t *Tail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	data := p
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		line := data[:i]
+		if len(t.partial) > 0 {
+			line = append(t.partial, line...)
+			t.partial = nil
+		}
+		t.add(string(line))
+		data = data[i+1:]
+	}
+	t.partial = append(t.partial, data...)
+	return len(p), nil
+}
+
+// Add appends one line
+func (t *Tail) Add(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.add(line)
+}
+
+func (t *Tail) add(line string) {
+	if len(t.lines) == 0 {
+		return
+	}
+	t.lines[t.next] = line
+	t.next = (t.next + 1) % len(t.lines)
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+// Lines returns the kept lines, oldest first
+func (t *Tail) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.full {
+		return append([]string(nil), t.lines[:t.next]...)
+	}
+	lines := make([]string, 0, len(t.lines))
+	lines = append(lines, t.lines[t.next:]...)
+	return append(lines, t.lines[:t.next]...)
+}
@@ -0,0 +1,31 @@
+package logtail
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestTail(t *testing.T) {
+	tail := New(3)
+	if lines := tail.Lines(); len(lines) != 0 {
+		t.Errorf("expected no lines, got %q", lines)
+	}
+
+	fmt.Fprint(tail, "one\ntw")
+	if lines := tail.Lines(); !slices.Equal(lines, []string{"one"}) {
+		t.Errorf("partial line kept: %q", lines)
+	}
+	fmt.Fprint(tail, "o\nthree\n")
+	tail.Add("four")
+	if lines := tail.Lines(); !slices.Equal(lines, []string{"two", "three", "four"}) {
+		t.Errorf("lines = %q", lines)
+	}
+
+	for i := 5; i <= 7; i++ {
+		tail.Add(fmt.Sprint(i))
+	}
+	if lines := tail.Lines(); !slices.Equal(lines, []string{"5", "6", "7"}) {
+		t.Errorf("lines after wrapping = %q", lines)
+	}
+}
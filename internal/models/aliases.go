@@ -0,0 +1,125 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownAlias is returned for a model reference that is neither a known
+// alias nor a filename
+var ErrUnknownAlias = errors.New("unknown model alias")
+
+// Alias is a stable name for a model file, so presets and saved requests
+// keep working when the file behind it changes
+type Alias struct {
+	Name     string `json:"name"`
+	File     string `json:"file"`
+	Workflow string `json:"workflow,omitempty"`
+	// Overridden is true when configuration points the alias at a
+	// different file than the built-in default
+	Overridden bool `json:"overridden"`
+}
+
+// builtinAliases name the required checkpoints and LoRAs
+var builtinAliases = []Alias{
+	{Name: "wan-i2v-high", File: "wan2.2_i2v_high_noise_14B_fp16.safetensors", Workflow: "i2v"},
+	{Name: "wan-i2v-low", File: "wan2.2_i2v_low_noise_14B_fp16.safetensors", Workflow: "i2v"},
+	{Name: "wan-t5", File: "umt5_xxl_fp16.safetensors", Workflow: "i2v"},
+	{Name: "wan-vae", File: "wan_2.1_vae.safetensors", Workflow: "i2v"},
+	{Name: "lightning-high", File: "wan2.2_lightning_high_noise.safetensors", Workflow: "i2v"},
+	{Name: "lightning-low", File: "wan2.2_lightning_low_noise.safetensors", Workflow: "i2v"},
+	{Name: "qwen-edit", File: "qwen_image_edit_2511_bf16.safetensors", Workflow: "qwen"},
+	{Name: "qwen-vl", File: "qwen_2.5_vl_7b.safetensors", Workflow: "qwen"},
+	{Name: "qwen-vae", File: "qwen_image_vae.safetensors", Workflow: "qwen"},
+	{Name: "qwen-lightning", File: "Qwen-Image-Edit-2511-Lightning-4steps-V1.0-bf16.safetensors", Workflow: "qwen"},
+}
+
+// Aliases resolves model references in job requests to filenames
+type Aliases struct {
+	byName map[string]Alias
+}
+
+// NewAliases builds the alias table from the built-ins plus overrides,
+// which either repoint a built-in alias (e.g. at a quantized file) or add
+// a new one
+func NewAliases(overrides map[string]string) *Aliases {
+	a := &Aliases{byName: make(map[string]Alias, len(builtinAliases)+len(overrides))}
+	for _, alias := range builtinAliases {
+		a.byName[alias.Name] = alias
+	}
+	for name, file := range overrides {
+		alias := a.byName[name]
+		alias.Name = name
+		alias.File = file
+		alias.Overridden = true
+		a.byName[name] = alias
+	}
+	return a
+}
+
+// List returns every alias sorted by name
+func (a *Aliases) List() []Alias {
+	list := make([]Alias, 0, len(a.byName))
+	for _, alias := range a.byName {
+		list = append(list, a.current(alias))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// current points a built-in alias at the file for the selected model
+// variant; overridden aliases keep the file they were given
+func (a *Aliases) current(alias Alias) Alias {
+	if !alias.Overridden {
+		alias.File = variantFile(alias.File)
+	}
+	return alias
+}
+
+// Resolve turns a model reference into a filename. References that look
+// like filenames (they have an extension or a directory) pass through, so
+// requests naming files directly keep working.
+func (a *Aliases) Resolve(ref string) (string, error) {
+	if alias, ok := a.byName[ref]; ok {
+		return a.current(alias).File, nil
+	}
+	if strings.ContainsAny(ref, "./") {
+		return ref, nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownAlias, ref)
+}
+
+// ResolveAll resolves a list of references, such as a request's LoRAs
+func (a *Aliases) ResolveAll(refs []string) ([]string, error) {
+	if refs == nil {
+		return nil, nil
+	}
+	files := make([]string, len(refs))
+	for i, ref := range refs {
+		file, err := a.Resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = file
+	}
+	return files, nil
+}
+
+// ResolveMap resolves the values of a slot-to-reference map, such as a
+// request's checkpoint overrides
+func (a *Aliases) ResolveMap(refs map[string]string) (map[string]string, error) {
+	if refs == nil {
+		return nil, nil
+	}
+	files := make(map[string]string, len(refs))
+	for slot, ref := range refs {
+		file, err := a.Resolve(ref)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", slot, err)
+		}
+		files[slot] = file
+	}
+	return files, nil
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuiltinAliasesMatchRequiredModels(t *testing.T) {
+	required := make(map[string]string)
+	for _, m := range RequiredModels() {
+		required[m.Name] = m.Workflow
+	}
+	for _, alias := range builtinAliases {
+		workflow, ok := required[alias.File]
+		if !ok {
+			t.Errorf("alias %s points at %s, which is not a required model", alias.Name, alias.File)
+			continue
+		}
+		if workflow != alias.Workflow {
+			t.Errorf("alias %s listed under %s, file belongs to %s", alias.Name, alias.Workflow, workflow)
+		}
+	}
+}
+
+func TestResolveAliases(t *testing.T) {
+	a := NewAliases(map[string]string{
+		"lightning-high": "wan2.2_lightning_high_noise_fp8.safetensors",
+		"my-style":       "loras/my_style.safetensors",
+	})
+
+	files, err := a.ResolveAll([]string{"lightning-high", "lightning-low", "my-style", "other.safetensors"})
+	if err != nil {
+		t.Fatalf("ResolveAll failed: %v", err)
+	}
+	want := []string{
+		"wan2.2_lightning_high_noise_fp8.safetensors",
+		"wan2.2_lightning_low_noise.safetensors",
+		"loras/my_style.safetensors",
+		"other.safetensors",
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("ref %d: expected %s, got %s", i, want[i], files[i])
+		}
+	}
+
+	if _, err := a.Resolve("no-such-alias"); !errors.Is(err, ErrUnknownAlias) {
+		t.Errorf("expected ErrUnknownAlias, got %v", err)
+	}
+
+	slots, err := a.ResolveMap(map[string]string{"unet_name": "wan-i2v-high"})
+	if err != nil || slots["unet_name"] != "wan2.2_i2v_high_noise_14B_fp16.safetensors" {
+		t.Errorf("unexpected slots %v (%v)", slots, err)
+	}
+
+	for _, alias := range a.List() {
+		if alias.Name == "lightning-high" && (!alias.Overridden || alias.Workflow != "i2v") {
+			t.Errorf("override should keep workflow and be marked: %+v", alias)
+		}
+	}
+}
+
+func TestAliasesFollowVariant(t *testing.T) {
+	SetSelection(Selection{Variant: VariantQuantized})
+	defer SetSelection(Selection{})
+
+	a := NewAliases(map[string]string{"wan-t5": "my_t5.safetensors"})
+	if file, _ := a.Resolve("wan-i2v-high"); file != "wan2.2_i2v_high_noise_14B_fp8_scaled.safetensors" {
+		t.Errorf("wan-i2v-high = %s, want the fp8 file", file)
+	}
+	if file, _ := a.Resolve("wan-t5"); file != "my_t5.safetensors" {
+		t.Errorf("overridden alias followed the variant: %s", file)
+	}
+	if file, _ := a.Resolve("lightning-high"); file != "wan2.2_lightning_high_noise.safetensors" {
+		t.Errorf("lightning-high = %s, which has no fp8 variant", file)
+	}
+}
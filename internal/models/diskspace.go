@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"log"
+)
+
+// Disk space policies for CheckDiskSpace
+const (
+	DiskSpaceRefuse = "refuse" // don't queue downloads that won't fit
+	DiskSpaceWarn   = "warn"   // report the shortfall but download anyway
+	DiskSpaceOff    = "off"
+)
+
+// diskSpaceReserve is left free on top of the downloads so the disk isn't
+// filled to the last byte
+const diskSpaceReserve = 1 << 30
+
+// DiskSpaceReport compares the space pending downloads need with what's
+// free on the models volume
+type DiskSpaceReport struct {
+	Dir       string `json:"dir"`
+	Files     int    `json:"files"`
+	Required  int64  `json:"required"`
+	Free      int64  `json:"free"`
+	Shortfall int64  `json:"shortfall"`
+	Refused   bool   `json:"refused"`
+	Message   string `json:"message"`
+}
+
+// InsufficientSpaceError is returned when downloads are refused for lack
+// of disk space
+type InsufficientSpaceError struct {
+	Report DiskSpaceReport
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return e.Report.Message
+}
+
+// SetDiskSpacePolicy sets what happens when downloads won't fit: refuse,
+// warn or off. onShort, if set, receives every failed check.
+func (d *Downloader) SetDiskSpacePolicy(policy string, onShort func(DiskSpaceReport)) {
+	d.spacePolicy = policy
+	d.onSpaceShort = onShort
+}
+
+// checkDiskSpace makes sure the missing models fit on the models volume
+// before they are handed to aria2. Bytes already on disk from a partial
+// download are subtracted, since aria2 resumes them.
+func (d *Downloader) checkDiskSpace(missing []ModelFile) error {
+	if d.spacePolicy == DiskSpaceOff || len(missing) == 0 {
+		return nil
+	}
+
+	var required int64
+	for _, m := range missing {
+		need := m.Size
+		if info, err := d.store.Stat(m.Name); err == nil {
+			need -= info.Size()
+		}
+		if need > 0 {
+			required += need
+		}
+	}
+
+	free, err := FreeSpace(d.store.Dir())
+	if err != nil {
+		// Don't block downloads on platforms or mounts we can't measure
+		log.Printf("Disk space check skipped: %v", err)
+		return nil
+	}
+
+	shortfall := required + diskSpaceReserve - int64(free)
+	if shortfall <= 0 {
+		return nil
+	}
+
+	report := DiskSpaceReport{
+		Dir:       d.store.Dir(),
+		Files:     len(missing),
+		Required:  required,
+		Free:      int64(free),
+		Shortfall: shortfall,
+		Refused:   d.spacePolicy != DiskSpaceWarn,
+	}
+	report.Message = fmt.Sprintf("not enough disk space for %d model files in %s: need %.1f GB (plus %.0f GB reserve), %.1f GB free, short by %.1f GB",
+		report.Files, report.Dir, gb(required), gb(diskSpaceReserve), gb(int64(free)), gb(shortfall))
+
+	log.Printf("WARNING - %s", report.Message)
+	if d.onSpaceShort != nil {
+		d.onSpaceShort(report)
+	}
+	if report.Refused {
+		return &InsufficientSpaceError{Report: report}
+	}
+	return nil
+}
+
+func gb(n int64) float64 {
+	return float64(n) / 1e9
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !windows
+
+package models
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// FreeSpace isn't supported here, so disk space checks are skipped
+func FreeSpace(dir string) (uint64, error) {
+	free, _, err := DiskUsage(dir)
+	return free, err
+}
+
+// DiskUsage isn't supported here, as Statfs_t differs between the BSDs
+func DiskUsage(dir string) (free, total uint64, err error) {
+	return 0, 0, fmt.Errorf("disk usage isn't supported on %s", runtime.GOOS)
+}
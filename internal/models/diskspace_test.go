@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/druarnfield/diffbox/internal/storage"
+)
+
+func TestCheckDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	d := NewDownloader(nil, storage.NewLocal(dir), "")
+
+	free, err := FreeSpace(dir)
+	if err != nil {
+		t.Skipf("can't measure free space here: %v", err)
+	}
+	tooBig := []ModelFile{{Name: "huge.safetensors", Size: int64(free) + 10<<30}}
+
+	var reports []DiskSpaceReport
+	d.SetDiskSpacePolicy(DiskSpaceRefuse, func(r DiskSpaceReport) { reports = append(reports, r) })
+
+	err = d.checkDiskSpace(tooBig)
+	var spaceErr *InsufficientSpaceError
+	if !errors.As(err, &spaceErr) {
+		t.Fatalf("expected InsufficientSpaceError, got %v", err)
+	}
+	if r := spaceErr.Report; r.Shortfall < 10<<30 || !r.Refused || len(reports) != 1 {
+		t.Errorf("unexpected report %+v (%d callbacks)", r, len(reports))
+	}
+
+	// Bytes from a partial download count towards the total
+	partial := []ModelFile{{Name: "small.safetensors", Size: 1000}}
+	if err := os.WriteFile(filepath.Join(dir, "small.safetensors"), make([]byte, 600), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.checkDiskSpace(partial); err != nil {
+		t.Errorf("expected a small download to fit: %v", err)
+	}
+
+	d.SetDiskSpacePolicy(DiskSpaceWarn, func(r DiskSpaceReport) { reports = append(reports, r) })
+	if err := d.checkDiskSpace(tooBig); err != nil {
+		t.Errorf("warn policy should not refuse: %v", err)
+	}
+	if len(reports) != 2 || reports[1].Refused {
+		t.Errorf("expected a non-refused warning, got %+v", reports)
+	}
+
+	d.SetDiskSpacePolicy(DiskSpaceOff, nil)
+	if err := d.checkDiskSpace(tooBig); err != nil {
+		t.Errorf("off policy should skip the check: %v", err)
+	}
+}
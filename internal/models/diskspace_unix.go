@@ -0,0 +1,21 @@
+//go:build linux || darwin
+
+package models
+
+import "syscall"
+
+// FreeSpace returns the bytes available to unprivileged users under dir
+func FreeSpace(dir string) (uint64, error) {
+	free, _, err := DiskUsage(dir)
+	return free, err
+}
+
+// DiskUsage returns the bytes available to unprivileged users under dir
+// and the size of its filesystem
+func DiskUsage(dir string) (free, total uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), st.Blocks * uint64(st.Bsize), nil
+}
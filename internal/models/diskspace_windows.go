@@ -0,0 +1,25 @@
+//go:build windows
+
+package models
+
+import "golang.org/x/sys/windows"
+
+// FreeSpace returns the bytes available to the current user under dir
+func FreeSpace(dir string) (uint64, error) {
+	free, _, err := DiskUsage(dir)
+	return free, err
+}
+
+// DiskUsage returns the bytes available to the current user under dir
+// and the size of its volume
+func DiskUsage(dir string) (free, total uint64, err error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	var avail, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &avail, &total, &totalFree); err != nil {
+		return 0, 0, err
+	}
+	return avail, total, nil
+}
@@ -1,13 +1,16 @@
 package models
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/druarnfield/diffbox/internal/aria2"
+	"github.com/druarnfield/diffbox/internal/storage"
 )
 
 // ModelFile represents a required model file
@@ -16,12 +19,109 @@ type ModelFile struct {
 	URL      string // HuggingFace URL
 	Size     int64  // Expected size in bytes
 	Workflow string // Which workflow needs this
+	SHA256   string // Optional content hash, verified when set
+	// Mirrors are other URLs serving the same file
+	Mirrors []string
 }
 
-// RequiredModels returns all models needed for I2V and Qwen workflows
+// URLs returns the primary URL followed by the mirrors
+func (m ModelFile) URLs() []string {
+	return append([]string{m.URL}, m.Mirrors...)
+}
+
+// DefaultHFEndpoint is where model files are fetched from unless a mirror
+// is configured
+const DefaultHFEndpoint = "https://huggingface.co"
+
+var hfEndpoint = DefaultHFEndpoint
+
+// SetHFEndpoint points model URLs at a HuggingFace mirror such as
+// https://hf-mirror.com. Call it at startup, before any downloads.
+func SetHFEndpoint(endpoint string) {
+	endpoint = strings.TrimRight(endpoint, "/")
+	if endpoint == "" {
+		endpoint = DefaultHFEndpoint
+	}
+	hfEndpoint = endpoint
+}
+
+var hfMirrors []string
+
+// SetHFMirrors adds HuggingFace-compatible endpoints serving the same files
+// as the main one. Every model on the main endpoint gets a mirror URL on
+// each. Call it at startup, before any downloads.
+func SetHFMirrors(endpoints []string) {
+	hfMirrors = nil
+	for _, e := range endpoints {
+		if e = strings.TrimRight(e, "/"); e != "" {
+			hfMirrors = append(hfMirrors, e)
+		}
+	}
+}
+
+// registered holds models added by custom workflow definitions
+var registered []ModelFile
+
+// RegisterModels adds files to the manifest for custom workflows. A URL
+// starting with "/" is relative to the HuggingFace endpoint. Call it at
+// startup, before any downloads.
+func RegisterModels(files ...ModelFile) {
+	registered = append(registered, files...)
+}
+
+// RequiredModels returns the models needed by the enabled built-in
+// workflows, in the selected variant, and by any registered custom ones
 func RequiredModels() []ModelFile {
-	hfBase := "https://huggingface.co"
+	return Manifest(CurrentSelection())
+}
+
+// Manifest returns the models a selection of built-in workflows and
+// variant would need, plus those of any registered custom workflows
+func Manifest(sel Selection) []ModelFile {
+	hfBase := hfEndpoint
+
+	var required []ModelFile
+	for _, m := range builtinModels(hfBase) {
+		if !sel.enabled(m.Workflow) {
+			continue
+		}
+		if sel.Variant == VariantQuantized {
+			if q, ok := quantized[m.Name]; ok {
+				q.URL = hfBase + q.URL
+				q.Workflow = m.Workflow
+				m = q
+			}
+		}
+		required = append(required, m)
+	}
+
+	for _, m := range registered {
+		if strings.HasPrefix(m.URL, "/") {
+			m.URL = hfBase + m.URL
+		}
+		required = append(required, m)
+	}
+
+	for i, m := range required {
+		if url, ok := remappedURL(m.Name); ok {
+			required[i].URL = url
+			m.URL = url
+		}
+		path, ok := strings.CutPrefix(m.URL, hfBase+"/")
+		if !ok {
+			continue
+		}
+		for _, mirror := range hfMirrors {
+			if mirror != hfBase {
+				required[i].Mirrors = append(required[i].Mirrors, mirror+"/"+path)
+			}
+		}
+	}
+	return required
+}
 
+// builtinModels lists the full-precision files of the built-in workflows
+func builtinModels(hfBase string) []ModelFile {
 	return []ModelFile{
 		// Wan 2.2 I2V - High Noise DiT
 		{
@@ -212,107 +312,409 @@ func RequiredModels() []ModelFile {
 	}
 }
 
+// maxDownloadRetries is how many times a failed download is re-queued
+// before giving up
+const maxDownloadRetries = 3
+
+// DownloadRecord summarizes a finished (or abandoned) download
+type DownloadRecord struct {
+	Name       string
+	URL        string
+	Mirror     string // Hosts the file actually came from, comma-separated
+	Workflow   string
+	Status     string // "complete" or "failed"
+	Size       int64
+	Duration   time.Duration
+	AvgSpeed   float64 // bytes per second
+	Retries    int
+	Error      string
+	FinishedAt time.Time
+}
+
+// DownloadCallback is called when a download finishes or is abandoned
+type DownloadCallback func(DownloadRecord)
+
 // Downloader manages model downloads via aria2
 type Downloader struct {
-	client    *aria2.Client
-	modelsDir string
-	hfToken   string
+	client     aria2.RPC
+	store      storage.Storage
+	tokenMu    sync.RWMutex
+	hfToken    string
+	verifier   *Verifier
+	archiveDir string
+	// archiveMu keeps archiving and restoring from moving the same file
+	// both ways at once
+	archiveMu  sync.Mutex
+	onFinished DownloadCallback
+	prioritize chan string
+
+	spacePolicy  string
+	onSpaceShort func(DiskSpaceReport)
+
+	mirrors *MirrorSelector
+
+	lazyMu sync.Mutex
+	lazy   map[string]*workflowDownload
+
+	gidMu   sync.Mutex
+	gids    GIDStore
+	adopted map[string]string // GIDs Reconcile picked up, by file name
+	// remapping holds the GIDs Remap removed to queue again from a new
+	// URL
+	remapping map[string]bool
 }
 
-// NewDownloader creates a new downloader
-func NewDownloader(client *aria2.Client, modelsDir, hfToken string) *Downloader {
+// rpcTimeout bounds each aria2 call, or each polling round of calls, the
+// download loop makes, so a hung aria2 delays downloads rather than
+// stalling them for good
+const rpcTimeout = 15 * time.Second
+
+// verifyConcurrency bounds how many files are checked at once
+const verifyConcurrency = 4
+
+// NewDownloader creates a downloader keeping models in store. aria2
+// downloads into the store's Dir.
+func NewDownloader(client aria2.RPC, store storage.Storage, hfToken string) *Downloader {
 	return &Downloader{
-		client:    client,
-		modelsDir: modelsDir,
-		hfToken:   hfToken,
+		client:      client,
+		store:       store,
+		hfToken:     hfToken,
+		verifier:    NewVerifier(store, verifyConcurrency),
+		prioritize:  make(chan string, 8),
+		spacePolicy: DiskSpaceRefuse,
+		lazy:        make(map[string]*workflowDownload),
+	}
+}
+
+// Verifier returns the verifier used for the startup model scan
+func (d *Downloader) Verifier() *Verifier {
+	return d.verifier
+}
+
+// Storage returns where the models are kept
+func (d *Downloader) Storage() storage.Storage {
+	return d.store
+}
+
+// SetHFToken changes the HuggingFace token sent with later downloads
+func (d *Downloader) SetHFToken(token string) {
+	d.tokenMu.Lock()
+	defer d.tokenMu.Unlock()
+	d.hfToken = token
+}
+
+// SetCallbacks sets the callback for finished downloads
+func (d *Downloader) SetCallbacks(onFinished DownloadCallback) {
+	d.onFinished = onFinished
+}
+
+// activeDownload tracks one queued model across retries
+type activeDownload struct {
+	model    ModelFile
+	started  time.Time
+	retries  int
+	deferred bool     // paused so a prioritized workflow gets the bandwidth
+	sources  []string // URLs handed to aria2 for the current attempt
+	servedBy string   // hosts aria2 fetched from, once complete
+}
+
+// WorkflowForJobType maps a job type to the workflow whose models it needs
+func WorkflowForJobType(jobType string) string {
+	switch jobType {
+	case "svi":
+		return "i2v"
+	default:
+		return jobType
+	}
+}
+
+// Prioritize asks the running download loop to fetch the models for a job
+// type's workflow before everything else. It is a no-op once all models
+// are downloaded.
+func (d *Downloader) Prioritize(jobType string) {
+	select {
+	case d.prioritize <- WorkflowForJobType(jobType):
+	default:
+	}
+}
+
+// applyPriority moves the workflow's downloads to the front of the aria2
+// queue and pauses the rest until they finish
+func (d *Downloader) applyPriority(ctx context.Context, active map[string]*activeDownload, workflow string) bool {
+	if !hasWorkflow(active, workflow) {
+		return false
+	}
+
+	log.Printf("Prioritizing %s model downloads", workflow)
+	for gid, dl := range active {
+		if dl.model.Workflow == workflow {
+			if dl.deferred {
+				if err := d.client.Unpause(ctx, gid); err != nil {
+					log.Printf("Failed to resume %s: %v", dl.model.Name, err)
+				}
+				dl.deferred = false
+			}
+			// Only waiting downloads can be moved; active ones already run
+			d.client.ChangePosition(ctx, gid, 0, "POS_SET")
+			continue
+		}
+		if !dl.deferred {
+			if err := d.client.Pause(ctx, gid); err != nil {
+				log.Printf("Failed to defer %s: %v", dl.model.Name, err)
+				continue
+			}
+			dl.deferred = true
+		}
+	}
+	return true
+}
+
+// resumeDeferred unpauses everything applyPriority held back
+func (d *Downloader) resumeDeferred(ctx context.Context, active map[string]*activeDownload) {
+	for gid, dl := range active {
+		if !dl.deferred {
+			continue
+		}
+		if err := d.client.Unpause(ctx, gid); err != nil {
+			log.Printf("Failed to resume %s: %v", dl.model.Name, err)
+			continue
+		}
+		dl.deferred = false
 	}
 }
 
 // CheckAndDownload checks for missing models and downloads them
 func (d *Downloader) CheckAndDownload() error {
 	required := RequiredModels()
-	missing := d.findMissing(required)
+	d.restoreArchived(required)
+	missing := d.verifier.Verify(required)
+	for _, f := range d.verifier.Status().Files {
+		if f.Status == VerifyCorrupt {
+			d.discard(f.Name)
+		}
+	}
 
 	if len(missing) == 0 {
 		log.Println("All required models present")
 		return nil
 	}
 
+	if err := d.checkDiskSpace(missing); err != nil {
+		return err
+	}
+
 	log.Printf("Downloading %d missing models...", len(missing))
 
 	// Queue all downloads
-	gids := make(map[string]ModelFile)
+	active := make(map[string]*activeDownload)
 	for _, model := range missing {
-		headers := map[string]string{}
-		if d.hfToken != "" {
-			headers["Authorization"] = "Bearer " + d.hfToken
-		}
-
-		gid, err := d.client.AddURI(model.URL, d.modelsDir, model.Name, headers)
+		gid, sources, err := d.queue(model)
 		if err != nil {
 			return fmt.Errorf("queue download %s: %w", model.Name, err)
 		}
-		gids[gid] = model
+		active[gid] = &activeDownload{model: model, started: time.Now(), sources: sources}
 		log.Printf("Queued: %s", model.Name)
 	}
 
 	// Wait for all downloads to complete
-	return d.waitForDownloads(gids)
+	return d.waitForDownloads(active, nil)
 }
 
-func (d *Downloader) findMissing(models []ModelFile) []ModelFile {
-	var missing []ModelFile
+// discard deletes a corrupt file so aria2 fetches it from scratch instead
+// of treating it as already downloaded
+func (d *Downloader) discard(name string) {
+	log.Printf("Removing corrupt model file %s", name)
+	if err := d.store.Remove(name); err != nil {
+		log.Printf("Failed to remove %s: %v", name, err)
+	}
+}
 
-	for _, model := range models {
-		path := filepath.Join(d.modelsDir, model.Name)
-		info, err := os.Stat(path)
+// SetMirrorSelector ranks mirrors before each download. Without one only
+// the primary URL is used.
+func (d *Downloader) SetMirrorSelector(s *MirrorSelector) {
+	d.mirrors = s
+}
 
-		if os.IsNotExist(err) {
-			missing = append(missing, model)
-			continue
-		}
+// MirrorSelector returns the selector set with SetMirrorSelector, or nil
+func (d *Downloader) MirrorSelector() *MirrorSelector {
+	return d.mirrors
+}
 
-		if err != nil {
-			// Permission or other error - treat as missing
-			log.Printf("Cannot stat %s: %v (will download)", model.Name, err)
-			missing = append(missing, model)
-			continue
-		}
+// queue hands a download to aria2, choosing its sources among the model's
+// mirrors, and returns the GID and the URLs used
+func (d *Downloader) queue(model ModelFile) (string, []string, error) {
+	headers := map[string]string{}
+	d.tokenMu.RLock()
+	if d.hfToken != "" {
+		headers["Authorization"] = "Bearer " + d.hfToken
+	}
+	d.tokenMu.RUnlock()
+	urls := []string{model.URL}
+	if gid, ok := d.adopt(model.Name); ok {
+		log.Printf("Resuming %s from the aria2 session", model.Name)
+		return gid, urls, nil
+	}
+	if d.mirrors != nil && len(model.Mirrors) > 0 {
+		urls = d.mirrors.Select(model.URLs())
+		log.Printf("Sources for %s: %s", model.Name, strings.Join(urls, ", "))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	gid, err := d.client.AddURIs(ctx, urls, d.store.Dir(), model.Name, headers)
+	if err != nil {
+		return "", nil, err
+	}
+	d.track(model, gid)
+	return gid, urls, nil
+}
 
-		// Check size (allow 1% tolerance for filesystem differences)
-		if info.Size() < int64(float64(model.Size)*0.99) {
-			log.Printf("Incomplete: %s (%.2f GB / %.2f GB)",
-				model.Name,
-				float64(info.Size())/1e9,
-				float64(model.Size)/1e9)
-			missing = append(missing, model)
+// servedBy lists the hosts aria2 reports having fetched a file from,
+// falling back to the sources it was given
+func servedBy(status *aria2.DownloadStatus, sources []string) string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, f := range status.Files {
+		for _, u := range f.URIs {
+			if h := hostOf(u.URI); u.Status == "used" && !seen[h] {
+				seen[h] = true
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		for _, u := range sources {
+			hosts = append(hosts, hostOf(u))
 		}
 	}
+	return strings.Join(hosts, ",")
+}
 
-	return missing
+// finish stops tracking a finished download and reports it to the
+// callback
+func (d *Downloader) finish(dl *activeDownload, status string, size int64, errMsg string) {
+	d.untrack(dl.model.Name)
+	if d.onFinished == nil {
+		return
+	}
+	record := DownloadRecord{
+		Name:       dl.model.Name,
+		URL:        dl.model.URL,
+		Mirror:     dl.servedBy,
+		Workflow:   dl.model.Workflow,
+		Status:     status,
+		Size:       size,
+		Duration:   time.Since(dl.started),
+		Retries:    dl.retries,
+		Error:      errMsg,
+		FinishedAt: time.Now(),
+	}
+	if secs := record.Duration.Seconds(); secs > 0 {
+		record.AvgSpeed = float64(size) / secs
+	}
+	d.onFinished(record)
 }
 
-func (d *Downloader) waitForDownloads(gids map[string]ModelFile) error {
+// waitForDownloads polls aria2 until every download finishes. onProgress,
+// if set, gets the bytes downloaded so far after each poll.
+func (d *Downloader) waitForDownloads(active map[string]*activeDownload, onProgress func(downloaded int64)) error {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
-	for len(gids) > 0 {
-		<-ticker.C
+	priority := ""
+	var finished int64
+	// A failed download ends the wait, prioritized or not; don't leave the
+	// rest paused behind it in aria2
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		defer cancel()
+		d.resumeDeferred(ctx, active)
+	}()
+	for len(active) > 0 {
+		select {
+		case workflow := <-d.prioritize:
+			ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+			if workflow != priority && d.applyPriority(ctx, active, workflow) {
+				priority = workflow
+			}
+			cancel()
+			continue
+		case <-ticker.C:
+		}
 
-		for gid, model := range gids {
-			status, err := d.client.TellStatus(gid)
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		inFlight := int64(0)
+		for gid, dl := range active {
+			model := dl.model
+			status, err := d.client.TellStatus(ctx, gid)
 			if err != nil {
 				log.Printf("Status check failed for %s: %v", model.Name, err)
 				continue
 			}
 
+			if status.Status != "complete" && status.Status != "error" {
+				inFlight += parseSize(status.CompletedLength)
+			}
+
 			switch status.Status {
 			case "complete":
 				log.Printf("Complete: %s", model.Name)
-				delete(gids, gid)
+				if err := d.store.Import(model.Name, filepath.Join(d.store.Dir(), filepath.FromSlash(model.Name))); err != nil {
+					log.Printf("Failed to store %s: %v", model.Name, err)
+				}
+				dl.servedBy = servedBy(status, dl.sources)
+				d.finish(dl, "complete", parseSize(status.TotalLength), "")
+				finished += parseSize(status.TotalLength)
+				delete(active, gid)
 
 			case "error":
-				return fmt.Errorf("download failed %s: %s", model.Name, status.ErrorMessage)
+				delete(active, gid)
+				if dl.retries >= maxDownloadRetries {
+					d.finish(dl, "failed", parseSize(status.CompletedLength), status.ErrorMessage)
+					cancel()
+					return fmt.Errorf("download failed %s after %d retries: %s", model.Name, dl.retries, status.ErrorMessage)
+				}
+
+				// aria2 resumes from the partial file, so a retry only
+				// re-fetches what's missing
+				dl.retries++
+				log.Printf("Download failed %s: %s (retry %d/%d)", model.Name, status.ErrorMessage, dl.retries, maxDownloadRetries)
+				// Let the retry go to another mirror
+				if d.mirrors != nil && len(dl.sources) == 1 && len(model.Mirrors) > 0 {
+					d.mirrors.MarkFailed(dl.sources[0], status.ErrorMessage)
+				}
+				newGID, sources, err := d.queue(model)
+				if err != nil {
+					d.finish(dl, "failed", parseSize(status.CompletedLength), err.Error())
+					cancel()
+					return fmt.Errorf("requeue download %s: %w", model.Name, err)
+				}
+				dl.sources = sources
+				active[newGID] = dl
+				if dl.deferred {
+					d.client.Pause(ctx, newGID)
+				}
+
+			case "removed":
+				// Remap took it off aria2; queue it again from the new URL,
+				// carrying on from the control file
+				if !d.takeRemap(gid) {
+					continue
+				}
+				delete(active, gid)
+				if m, ok := RequiredModel(model.Name); ok {
+					dl.model = m
+				}
+				newGID, sources, err := d.queue(dl.model)
+				if err != nil {
+					d.finish(dl, "failed", parseSize(status.CompletedLength), err.Error())
+					cancel()
+					return fmt.Errorf("requeue download %s: %w", model.Name, err)
+				}
+				dl.sources = sources
+				active[newGID] = dl
+				if dl.deferred {
+					d.client.Pause(ctx, newGID)
+				}
 
 			case "active":
 				// Parse progress
@@ -330,14 +732,39 @@ func (d *Downloader) waitForDownloads(gids map[string]ModelFile) error {
 				log.Printf("Waiting: %s (queued)", model.Name)
 
 			case "paused":
-				log.Printf("Paused: %s (resuming...)", model.Name)
+				if dl.deferred {
+					log.Printf("Deferred: %s (waiting for %s models)", model.Name, priority)
+				} else {
+					log.Printf("Paused: %s (resuming...)", model.Name)
+				}
 			}
 		}
+
+		if onProgress != nil {
+			onProgress(finished + inFlight)
+		}
+
+		// Once the prioritized workflow is complete, let the rest continue
+		if priority != "" && !hasWorkflow(active, priority) {
+			log.Printf("All %s models downloaded, resuming remaining downloads", priority)
+			d.resumeDeferred(ctx, active)
+			priority = ""
+		}
+		cancel()
 	}
 
 	return nil
 }
 
+func hasWorkflow(active map[string]*activeDownload, workflow string) bool {
+	for _, dl := range active {
+		if dl.model.Workflow == workflow {
+			return true
+		}
+	}
+	return false
+}
+
 func parseSize(s string) int64 {
 	var n int64
 	fmt.Sscanf(s, "%d", &n)
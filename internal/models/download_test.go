@@ -1,7 +1,18 @@
 package models
 
 import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/druarnfield/diffbox/internal/aria2"
+	"github.com/druarnfield/diffbox/internal/storage"
 )
 
 func TestRequiredModels(t *testing.T) {
@@ -76,10 +87,10 @@ func TestParseSize(t *testing.T) {
 
 func TestDownloaderNew(t *testing.T) {
 	// Create downloader with nil client (for testing)
-	downloader := NewDownloader(nil, "/models", "test_token")
+	downloader := NewDownloader(nil, storage.NewLocal("/models"), "test_token")
 
-	if downloader.modelsDir != "/models" {
-		t.Errorf("expected modelsDir /models, got %s", downloader.modelsDir)
+	if downloader.store.Dir() != "/models" {
+		t.Errorf("expected models dir /models, got %s", downloader.store.Dir())
 	}
 
 	if downloader.hfToken != "test_token" {
@@ -136,3 +147,137 @@ func TestModelFileURL(t *testing.T) {
 		}
 	}
 }
+
+func TestWorkflowForJobType(t *testing.T) {
+	workflows := make(map[string]bool)
+	for _, m := range RequiredModels() {
+		workflows[m.Workflow] = true
+	}
+
+	for _, jobType := range []string{"i2v", "svi", "qwen", "chat"} {
+		if wf := WorkflowForJobType(jobType); !workflows[wf] {
+			t.Errorf("job type %s maps to unknown workflow %q", jobType, wf)
+		}
+	}
+}
+
+func TestPrioritizeDoesNotBlock(t *testing.T) {
+	d := NewDownloader(nil, storage.NewLocal(t.TempDir()), "")
+
+	// Nothing is draining the channel; extra requests must be dropped
+	for i := 0; i < 100; i++ {
+		d.Prioritize("qwen")
+	}
+}
+
+func TestApplyPriority(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string][]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req aria2.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		calls[req.Method] = append(calls[req.Method], req.Params[0].(string))
+		mu.Unlock()
+		json.NewEncoder(w).Encode(aria2.Response{ID: req.ID, Result: json.RawMessage(`0`)})
+	}))
+	defer server.Close()
+
+	host, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	d := NewDownloader(aria2.NewClient(host, port, ""), storage.NewLocal(t.TempDir()), "")
+	ctx := context.Background()
+
+	active := map[string]*activeDownload{
+		"wan":  {model: ModelFile{Name: "wan.safetensors", Workflow: "i2v"}},
+		"qwen": {model: ModelFile{Name: "qwen.safetensors", Workflow: "qwen"}},
+	}
+
+	if d.applyPriority(ctx, active, "chat") {
+		t.Error("expected no priority for a workflow with nothing downloading")
+	}
+
+	if !d.applyPriority(ctx, active, "qwen") {
+		t.Fatal("expected qwen to be prioritized")
+	}
+	if !active["wan"].deferred || active["qwen"].deferred {
+		t.Error("expected only the i2v download to be deferred")
+	}
+	if len(calls["aria2.pause"]) != 1 || calls["aria2.pause"][0] != "wan" {
+		t.Errorf("expected wan to be paused, got %v", calls["aria2.pause"])
+	}
+	if len(calls["aria2.changePosition"]) != 1 || calls["aria2.changePosition"][0] != "qwen" {
+		t.Errorf("expected qwen to move to the front, got %v", calls["aria2.changePosition"])
+	}
+
+	delete(active, "qwen")
+	d.resumeDeferred(ctx, active)
+	if active["wan"].deferred {
+		t.Error("expected wan to be resumed")
+	}
+	if len(calls["aria2.unpause"]) != 1 {
+		t.Errorf("expected one unpause, got %v", calls["aria2.unpause"])
+	}
+}
+
+func TestSetHFEndpoint(t *testing.T) {
+	defer SetHFEndpoint("")
+
+	SetHFEndpoint("https://hf-mirror.com/")
+	for _, m := range RequiredModels() {
+		if !strings.HasPrefix(m.URL, "https://hf-mirror.com/") || strings.HasPrefix(m.URL, "https://hf-mirror.com//") {
+			t.Errorf("%s not pointed at the mirror: %s", m.Name, m.URL)
+		}
+	}
+
+	SetHFEndpoint("")
+	if url := RequiredModels()[0].URL; !strings.HasPrefix(url, DefaultHFEndpoint+"/") {
+		t.Errorf("expected default endpoint restored, got %s", url)
+	}
+}
+
+func TestRegisterModels(t *testing.T) {
+	defer func() { registered = nil }()
+	defer SetHFEndpoint("")
+
+	SetHFEndpoint("https://hf-mirror.com")
+	RegisterModels(
+		ModelFile{Name: "custom.safetensors", URL: "/org/repo/resolve/main/custom.safetensors", Workflow: "custom"},
+		ModelFile{Name: "other.safetensors", URL: "https://example.com/other.safetensors", Workflow: "custom"},
+	)
+
+	urls := make(map[string]string)
+	for _, m := range RequiredModels() {
+		urls[m.Name] = m.URL
+	}
+	if got := urls["custom.safetensors"]; got != "https://hf-mirror.com/org/repo/resolve/main/custom.safetensors" {
+		t.Errorf("relative URL not resolved against the endpoint: %s", got)
+	}
+	if got := urls["other.safetensors"]; got != "https://example.com/other.safetensors" {
+		t.Errorf("absolute URL changed: %s", got)
+	}
+}
+
+func TestManifestSelection(t *testing.T) {
+	models := Manifest(Selection{Workflows: []string{"i2v"}, Variant: VariantQuantized})
+
+	names := make(map[string]bool)
+	for _, m := range models {
+		if m.Workflow != "i2v" {
+			t.Errorf("%s from disabled workflow %s", m.Name, m.Workflow)
+		}
+		if m.URL == "" || !strings.HasPrefix(m.URL, DefaultHFEndpoint+"/") {
+			t.Errorf("%s has URL %q", m.Name, m.URL)
+		}
+		names[m.Name] = true
+	}
+	if len(models) != 6 {
+		t.Errorf("expected 6 i2v models, got %d", len(models))
+	}
+	if !names["wan2.2_i2v_high_noise_14B_fp8_scaled.safetensors"] || names["wan2.2_i2v_high_noise_14B_fp16.safetensors"] {
+		t.Errorf("quantized variant not applied: %v", names)
+	}
+	if !names["wan_2.1_vae.safetensors"] {
+		t.Error("files without an fp8 variant should be kept")
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+)
+
+// hashCacheFile lives in the models dir, so it goes away with the models
+const hashCacheFile = ".diffbox-hashes.json"
+
+type hashEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+	SHA256  string `json:"sha256"`
+}
+
+// hashCache remembers the sha256 of files that haven't changed since they
+// were last hashed, so multi-GB checkpoints are only read once
+type hashCache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]hashEntry
+}
+
+func loadHashCache(path string) *hashCache {
+	c := &hashCache{path: path, entries: make(map[string]hashEntry)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		log.Printf("Ignoring unreadable hash cache %s: %v", path, err)
+		c.entries = make(map[string]hashEntry)
+	}
+	return c
+}
+
+// get returns the cached hash if the file still has the recorded size and
+// modification time
+func (c *hashCache) get(name string, info os.FileInfo) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[name]
+	if !ok || e.Size != info.Size() || e.ModTime != info.ModTime().UnixNano() {
+		return "", false
+	}
+	return e.SHA256, true
+}
+
+func (c *hashCache) put(name string, info os.FileInfo, sum string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[name] = hashEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		SHA256:  sum,
+	}
+}
+
+func (c *hashCache) save() error {
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0644)
+}
@@ -0,0 +1,217 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Mirror selection policies
+const (
+	MirrorFastest = "fastest" // download from the fastest healthy mirror
+	MirrorSpread  = "spread"  // split each download across all healthy mirrors
+)
+
+// probeBytes is how much of a file a probe fetches: enough to get past
+// TCP slow start so the throughput means something
+const probeBytes = 4 << 20
+
+// probeTTL is how long a probe result is trusted before re-measuring
+const probeTTL = 30 * time.Minute
+
+// MirrorProbe is one measurement of a download host
+type MirrorProbe struct {
+	Host       string        `json:"host"`
+	Latency    time.Duration `json:"latency"`    // until the first byte
+	Throughput float64       `json:"throughput"` // bytes per second over the probe
+	Error      string        `json:"error,omitempty"`
+	ProbedAt   time.Time     `json:"probed_at"`
+}
+
+// Healthy reports whether the host answered the probe
+func (p MirrorProbe) Healthy() bool {
+	return p.Error == ""
+}
+
+// MirrorProbeFunc measures a host by fetching the start of fileURL
+type MirrorProbeFunc func(fileURL string) MirrorProbe
+
+// NewHTTPProbe returns a probe that issues a ranged GET for the first
+// probeBytes of a file, following redirects to the CDN. The token is sent
+// as it is for the download itself.
+func NewHTTPProbe(token string) MirrorProbeFunc {
+	client := &http.Client{Timeout: 15 * time.Second}
+
+	return func(fileURL string) MirrorProbe {
+		probe := MirrorProbe{Host: hostOf(fileURL), ProbedAt: time.Now()}
+
+		req, err := http.NewRequest(http.MethodGet, fileURL, nil)
+		if err != nil {
+			probe.Error = err.Error()
+			return probe
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", probeBytes-1))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			probe.Error = err.Error()
+			return probe
+		}
+		defer resp.Body.Close()
+		probe.Latency = time.Since(start)
+
+		if resp.StatusCode >= 400 {
+			probe.Error = fmt.Sprintf("status %d", resp.StatusCode)
+			return probe
+		}
+		// A server ignoring Range sends the whole file; stop at probeBytes
+		n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, probeBytes))
+		if err != nil {
+			probe.Error = err.Error()
+			return probe
+		}
+		if elapsed := time.Since(start) - probe.Latency; elapsed > 0 {
+			probe.Throughput = float64(n) / elapsed.Seconds()
+		}
+		return probe
+	}
+}
+
+// MirrorSelector ranks the sources of a download by probing their hosts.
+// Results are cached per host, since one probe speaks for every file a
+// mirror serves.
+type MirrorSelector struct {
+	probe  MirrorProbeFunc
+	policy string
+
+	mu     sync.Mutex
+	probes map[string]MirrorProbe
+}
+
+// NewMirrorSelector creates a selector using policy "fastest" or "spread"
+func NewMirrorSelector(probe MirrorProbeFunc, policy string) *MirrorSelector {
+	return &MirrorSelector{
+		probe:  probe,
+		policy: policy,
+		probes: make(map[string]MirrorProbe),
+	}
+}
+
+// Select returns the sources to hand aria2 for a file, fastest first: the
+// fastest alone, or every healthy one when spreading. Unhealthy hosts are
+// left out unless none is healthy, in which case all are tried.
+func (s *MirrorSelector) Select(urls []string) []string {
+	if len(urls) < 2 {
+		return urls
+	}
+
+	probes := s.measure(urls)
+	order := make([]int, len(urls))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return probes[order[i]].betterThan(probes[order[j]])
+	})
+
+	var ranked, healthy []string
+	for _, i := range order {
+		ranked = append(ranked, urls[i])
+		if probes[i].Healthy() {
+			healthy = append(healthy, urls[i])
+		}
+	}
+	if len(healthy) == 0 {
+		log.Printf("No mirror answered for %s, trying all", ranked[0])
+		return ranked
+	}
+	if s.policy == MirrorSpread {
+		return healthy
+	}
+	return healthy[:1]
+}
+
+// measure returns a probe per URL, probing uncached hosts in parallel
+func (s *MirrorSelector) measure(urls []string) []MirrorProbe {
+	results := make([]MirrorProbe, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		host := hostOf(u)
+		s.mu.Lock()
+		cached, ok := s.probes[host]
+		s.mu.Unlock()
+		if ok && time.Since(cached.ProbedAt) < probeTTL {
+			results[i] = cached
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			p := s.probe(u)
+			p.Host = hostOf(u)
+			if p.Healthy() {
+				log.Printf("Mirror %s: %dms to first byte, %.1f MB/s", p.Host, p.Latency.Milliseconds(), p.Throughput/1e6)
+			} else {
+				log.Printf("Mirror %s unhealthy: %s", p.Host, p.Error)
+			}
+			s.mu.Lock()
+			s.probes[p.Host] = p
+			s.mu.Unlock()
+			results[i] = p
+		}(i, u)
+	}
+	wg.Wait()
+	return results
+}
+
+// MarkFailed records that a download from url failed, so the host is
+// passed over until it's probed again
+func (s *MirrorSelector) MarkFailed(fileURL, reason string) {
+	host := hostOf(fileURL)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.probes[host] = MirrorProbe{Host: host, Error: reason, ProbedAt: time.Now()}
+}
+
+// Probes returns the latest measurement of every host, fastest first
+func (s *MirrorSelector) Probes() []MirrorProbe {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	probes := make([]MirrorProbe, 0, len(s.probes))
+	for _, p := range s.probes {
+		probes = append(probes, p)
+	}
+	sort.Slice(probes, func(i, j int) bool { return probes[i].betterThan(probes[j]) })
+	return probes
+}
+
+// betterThan orders healthy hosts before unhealthy ones, then by
+// throughput, then by latency
+func (p MirrorProbe) betterThan(other MirrorProbe) bool {
+	if p.Healthy() != other.Healthy() {
+		return p.Healthy()
+	}
+	if p.Throughput != other.Throughput {
+		return p.Throughput > other.Throughput
+	}
+	return p.Latency < other.Latency
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Host
+}
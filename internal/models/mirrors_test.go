@@ -0,0 +1,136 @@
+package models
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/aria2"
+)
+
+// probeCalls counts probes per host. Hosts are probed in parallel.
+type probeCalls struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *probeCalls) count(host string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[host]
+}
+
+func fakeProbe(speeds map[string]float64, calls *probeCalls) MirrorProbeFunc {
+	return func(fileURL string) MirrorProbe {
+		host := hostOf(fileURL)
+		calls.mu.Lock()
+		calls.counts[host]++
+		calls.mu.Unlock()
+		p := MirrorProbe{Host: host, ProbedAt: time.Now(), Throughput: speeds[host], Latency: 50 * time.Millisecond}
+		if speeds[host] == 0 {
+			p.Error = "connection refused"
+		}
+		return p
+	}
+}
+
+func TestMirrorSelectorSelect(t *testing.T) {
+	urls := []string{
+		"https://slow.example.com/f.bin",
+		"https://fast.example.com/f.bin",
+		"https://down.example.com/f.bin",
+		"https://medium.example.com/f.bin",
+	}
+	speeds := map[string]float64{"slow.example.com": 1e6, "fast.example.com": 50e6, "medium.example.com": 10e6}
+
+	calls := &probeCalls{counts: make(map[string]int)}
+	fastest := NewMirrorSelector(fakeProbe(speeds, calls), MirrorFastest)
+	got := fastest.Select(urls)
+	if len(got) != 1 || got[0] != "https://fast.example.com/f.bin" {
+		t.Errorf("expected the fastest mirror alone, got %v", got)
+	}
+
+	// Results are cached per host
+	fastest.Select(urls)
+	if n := calls.count("fast.example.com"); n != 1 {
+		t.Errorf("expected one probe per host, got %d", n)
+	}
+
+	spread := NewMirrorSelector(fakeProbe(speeds, &probeCalls{counts: make(map[string]int)}), MirrorSpread)
+	got = spread.Select(urls)
+	want := []string{"https://fast.example.com/f.bin", "https://medium.example.com/f.bin", "https://slow.example.com/f.bin"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("expected healthy mirrors fastest first, got %v", got)
+	}
+
+	// A failed download demotes the host until it's probed again
+	fastest.MarkFailed("https://fast.example.com/other.bin", "checksum mismatch")
+	if got := fastest.Select(urls); got[0] != "https://medium.example.com/f.bin" {
+		t.Errorf("expected the next fastest after a failure, got %v", got)
+	}
+	if probes := fastest.Probes(); probes[len(probes)-1].Healthy() {
+		t.Errorf("expected unhealthy hosts listed last, got %+v", probes)
+	}
+}
+
+func TestMirrorSelectorAllDown(t *testing.T) {
+	s := NewMirrorSelector(fakeProbe(nil, &probeCalls{counts: make(map[string]int)}), MirrorFastest)
+	urls := []string{"https://a.example.com/f.bin", "https://b.example.com/f.bin"}
+	if got := s.Select(urls); len(got) != 2 {
+		t.Errorf("expected every source when none is healthy, got %v", got)
+	}
+}
+
+func TestHTTPProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "bytes=0-4194303" {
+			t.Errorf("unexpected range %q", r.Header.Get("Range"))
+		}
+		if r.Header.Get("Authorization") != "Bearer hf_test" {
+			t.Errorf("token not sent")
+		}
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(make([]byte, 64<<10))
+	}))
+	defer server.Close()
+
+	p := NewHTTPProbe("hf_test")(server.URL + "/f.bin")
+	if !p.Healthy() || p.Throughput <= 0 {
+		t.Errorf("expected a healthy probe with throughput, got %+v", p)
+	}
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	if p := NewHTTPProbe("")(missing.URL + "/f.bin"); p.Healthy() {
+		t.Errorf("expected a 404 to be unhealthy")
+	}
+}
+
+func TestRequiredModelsMirrors(t *testing.T) {
+	defer SetHFMirrors(nil)
+
+	SetHFMirrors([]string{"https://hf-mirror.com/", DefaultHFEndpoint})
+	for _, m := range RequiredModels() {
+		path := strings.TrimPrefix(m.URL, DefaultHFEndpoint)
+		if len(m.Mirrors) != 1 || m.Mirrors[0] != "https://hf-mirror.com"+path {
+			t.Fatalf("%s: expected one mirror on hf-mirror.com, got %v", m.Name, m.Mirrors)
+		}
+	}
+}
+
+func TestServedBy(t *testing.T) {
+	status := &aria2.DownloadStatus{Files: []aria2.DownloadFile{{URIs: []aria2.DownloadURI{
+		{URI: "https://a.example.com/f.bin", Status: "used"},
+		{URI: "https://b.example.com/f.bin", Status: "waiting"},
+		{URI: "https://c.example.com/f.bin", Status: "used"},
+	}}}}
+	if got := servedBy(status, nil); got != "a.example.com,c.example.com" {
+		t.Errorf("unexpected hosts %q", got)
+	}
+	if got := servedBy(&aria2.DownloadStatus{}, []string{"https://a.example.com/f.bin"}); got != "a.example.com" {
+		t.Errorf("expected the sources as a fallback, got %q", got)
+	}
+}
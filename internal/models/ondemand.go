@@ -0,0 +1,144 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ProgressFunc receives the fraction (0-1) of a workflow's missing bytes
+// downloaded so far
+type ProgressFunc func(progress float64)
+
+// workflowDownload is an in-flight on-demand download of one workflow's
+// models, shared by every job waiting on it
+type workflowDownload struct {
+	done chan struct{}
+	err  error
+
+	mu        sync.Mutex
+	progress  float64
+	listeners []ProgressFunc
+}
+
+func (w *workflowDownload) subscribe(fn ProgressFunc) {
+	if fn == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, fn)
+	fn(w.progress)
+}
+
+func (w *workflowDownload) report(progress float64) {
+	w.mu.Lock()
+	w.progress = progress
+	listeners := append([]ProgressFunc{}, w.listeners...)
+	w.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(progress)
+	}
+}
+
+// ModelsForWorkflow returns the required models for one workflow
+func ModelsForWorkflow(workflow string) []ModelFile {
+	var files []ModelFile
+	for _, m := range RequiredModels() {
+		if m.Workflow == workflow {
+			files = append(files, m)
+		}
+	}
+	return files
+}
+
+// missingFor returns the workflow's models that aren't usable on disk
+func (d *Downloader) missingFor(workflow string) []ModelFile {
+	models := ModelsForWorkflow(workflow)
+	d.restoreArchived(models)
+
+	var missing []ModelFile
+	for _, m := range models {
+		result := d.verifier.verifyFile(m)
+		if result.Status == VerifyCorrupt {
+			d.discard(m.Name)
+		}
+		if result.Status != VerifyOK {
+			missing = append(missing, m)
+		}
+	}
+	if err := d.verifier.hashes.save(); err != nil {
+		log.Printf("Failed to save model hash cache: %v", err)
+	}
+	return missing
+}
+
+// WorkflowReady reports whether every model for a workflow is on disk
+func (d *Downloader) WorkflowReady(workflow string) bool {
+	return len(d.missingFor(workflow)) == 0
+}
+
+// EnsureWorkflow downloads a workflow's missing models and blocks until
+// they are on disk. Concurrent callers for the same workflow share a single
+// download; onProgress may be nil.
+func (d *Downloader) EnsureWorkflow(workflow string, onProgress ProgressFunc) error {
+	d.lazyMu.Lock()
+	wd, ok := d.lazy[workflow]
+	if !ok {
+		wd = &workflowDownload{done: make(chan struct{})}
+		d.lazy[workflow] = wd
+		go d.fetchWorkflow(workflow, wd)
+	}
+	d.lazyMu.Unlock()
+
+	wd.subscribe(onProgress)
+	<-wd.done
+	return wd.err
+}
+
+func (d *Downloader) fetchWorkflow(workflow string, wd *workflowDownload) {
+	defer func() {
+		// Forget the download so a later call re-checks the disk
+		d.lazyMu.Lock()
+		delete(d.lazy, workflow)
+		d.lazyMu.Unlock()
+		close(wd.done)
+	}()
+
+	missing := d.missingFor(workflow)
+	if len(missing) == 0 {
+		wd.report(1)
+		return
+	}
+
+	var total int64
+	for _, m := range missing {
+		total += m.Size
+	}
+	if wd.err = d.checkDiskSpace(missing); wd.err != nil {
+		return
+	}
+	log.Printf("Downloading %d models (%.2f GB) for %s on demand", len(missing), float64(total)/1e9, workflow)
+
+	active := make(map[string]*activeDownload)
+	for _, model := range missing {
+		gid, sources, err := d.queue(model)
+		if err != nil {
+			wd.err = fmt.Errorf("queue download %s: %w", model.Name, err)
+			return
+		}
+		active[gid] = &activeDownload{model: model, started: time.Now(), sources: sources}
+	}
+
+	wd.err = d.waitForDownloads(active, func(downloaded int64) {
+		if total > 0 {
+			wd.report(float64(downloaded) / float64(total))
+		}
+	})
+	if wd.err == nil {
+		wd.report(1)
+		log.Printf("All %s models ready", workflow)
+	}
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/druarnfield/diffbox/internal/storage"
+)
+
+func TestModelsForWorkflow(t *testing.T) {
+	total := 0
+	for _, wf := range []string{"i2v", "qwen", "chat"} {
+		files := ModelsForWorkflow(wf)
+		if len(files) == 0 {
+			t.Errorf("expected models for workflow %s", wf)
+		}
+		for _, f := range files {
+			if f.Workflow != wf {
+				t.Errorf("%s listed under %s, belongs to %s", f.Name, wf, f.Workflow)
+			}
+		}
+		total += len(files)
+	}
+	if total != len(RequiredModels()) {
+		t.Errorf("expected workflows to cover all %d models, got %d", len(RequiredModels()), total)
+	}
+}
+
+func TestEnsureWorkflowReady(t *testing.T) {
+	dir := t.TempDir()
+	d := NewDownloader(nil, storage.NewLocal(dir), "")
+
+	if d.WorkflowReady("qwen") {
+		t.Fatal("expected qwen not ready with an empty models dir")
+	}
+
+	// Sparse files stand in for the real checkpoints
+	for _, m := range ModelsForWorkflow("qwen") {
+		path := filepath.Join(dir, m.Name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Truncate(m.Size); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	if !d.WorkflowReady("qwen") {
+		t.Fatal("expected qwen ready once its files exist")
+	}
+
+	var last float64
+	if err := d.EnsureWorkflow("qwen", func(p float64) { last = p }); err != nil {
+		t.Fatalf("EnsureWorkflow failed: %v", err)
+	}
+	if last != 1 {
+		t.Errorf("expected final progress 1, got %v", last)
+	}
+}
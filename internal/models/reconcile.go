@@ -0,0 +1,249 @@
+package models
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/druarnfield/diffbox/internal/aria2"
+)
+
+// controlSuffix is the extension of the control file aria2 keeps beside a
+// file until its download completes
+const controlSuffix = ".aria2"
+
+// maxSessionDownloads bounds how much of aria2's waiting queue is read
+const maxSessionDownloads = 1000
+
+// GIDStore remembers which aria2 download is fetching each model file, so
+// downloads are found again after a restart
+type GIDStore interface {
+	Track(model ModelFile, gid string) error
+	Untrack(name string) error
+	// Tracked returns the GID of each tracked file by name
+	Tracked() (map[string]string, error)
+}
+
+// SetGIDStore sets where GIDs are kept. Without one downloads aren't
+// tracked, and after a restart aria2 resumes them from their control
+// files once they are queued again.
+func (d *Downloader) SetGIDStore(store GIDStore) {
+	d.gidMu.Lock()
+	defer d.gidMu.Unlock()
+	d.gids = store
+}
+
+// track records the GID now fetching model
+func (d *Downloader) track(model ModelFile, gid string) {
+	d.gidMu.Lock()
+	store := d.gids
+	d.gidMu.Unlock()
+	if store == nil {
+		return
+	}
+	if err := store.Track(model, gid); err != nil {
+		log.Printf("Failed to track download of %s: %v", model.Name, err)
+	}
+}
+
+// untrack forgets the GID of a finished or abandoned download
+func (d *Downloader) untrack(name string) {
+	d.gidMu.Lock()
+	store := d.gids
+	d.gidMu.Unlock()
+	if store == nil {
+		return
+	}
+	if err := store.Untrack(name); err != nil {
+		log.Printf("Failed to untrack download of %s: %v", name, err)
+	}
+}
+
+// adopt hands over the download Reconcile picked up for a file, if any,
+// so it is waited on instead of queued again
+func (d *Downloader) adopt(name string) (string, bool) {
+	d.gidMu.Lock()
+	defer d.gidMu.Unlock()
+	gid, ok := d.adopted[name]
+	delete(d.adopted, name)
+	return gid, ok
+}
+
+// ReconcileReport lists what Reconcile did, by file name
+type ReconcileReport struct {
+	// Resumed downloads were still in aria2's session and are picked up
+	// where they are
+	Resumed []string
+	// Stale GIDs were no longer known to aria2. The control files of
+	// required files are kept, so aria2 carries on from them when the
+	// file is queued again.
+	Stale []string
+	// Orphans were downloads of files no longer needed; they were
+	// removed from aria2 along with their control file and partial data
+	Orphans []string
+}
+
+// Reconcile squares the tracked GIDs, aria2's session and the control
+// files in the models dir, before any download is queued. Live downloads
+// of required files are resumed and adopted, tracking is dropped for GIDs
+// aria2 has forgotten, and downloads of files no longer required are
+// removed along with what they left on disk.
+func (d *Downloader) Reconcile() ReconcileReport {
+	var report ReconcileReport
+	required := make(map[string]ModelFile)
+	for _, m := range RequiredModels() {
+		required[m.Name] = m
+	}
+
+	d.gidMu.Lock()
+	store := d.gids
+	d.adopted = make(map[string]string)
+	d.gidMu.Unlock()
+
+	tracked := map[string]string{}
+	if store != nil {
+		var err error
+		if tracked, err = store.Tracked(); err != nil {
+			log.Printf("Failed to load tracked downloads: %v", err)
+			tracked = map[string]string{}
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	live := d.sessionDownloads(ctx)
+
+	names := make([]string, 0, len(tracked)+len(live))
+	for name := range tracked {
+		names = append(names, name)
+	}
+	for name := range live {
+		if _, ok := tracked[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	orphaned := make(map[string]bool)
+	for _, name := range names {
+		gid, isTracked := tracked[name]
+		status, isLive := live[name]
+		model, isRequired := required[name]
+
+		switch {
+		case isLive && !isRequired:
+			if err := d.client.Remove(ctx, status.GID); err != nil {
+				log.Printf("Failed to remove download of %s: %v", name, err)
+			}
+			if isTracked {
+				d.untrack(name)
+			}
+			d.removePartial(name)
+			orphaned[name] = true
+
+		case isLive:
+			if status.Status == "paused" {
+				if err := d.client.Unpause(ctx, status.GID); err != nil {
+					log.Printf("Failed to resume %s: %v", name, err)
+				}
+			}
+			if status.GID != gid {
+				d.track(model, status.GID)
+			}
+			d.gidMu.Lock()
+			d.adopted[name] = status.GID
+			d.gidMu.Unlock()
+			report.Resumed = append(report.Resumed, name)
+
+		default:
+			// A finished file or one aria2 has forgotten; either way the
+			// GID is no use
+			d.untrack(name)
+			report.Stale = append(report.Stale, name)
+		}
+	}
+
+	for _, name := range d.controlFiles() {
+		if _, ok := required[name]; ok {
+			continue
+		}
+		d.removePartial(name)
+		orphaned[name] = true
+	}
+	for name := range orphaned {
+		report.Orphans = append(report.Orphans, name)
+	}
+	slices.Sort(report.Orphans)
+
+	if len(report.Resumed)+len(report.Stale)+len(report.Orphans) > 0 {
+		log.Printf("Reconciled downloads: %d resumed, %d stale, %d orphaned", len(report.Resumed), len(report.Stale), len(report.Orphans))
+	}
+	return report
+}
+
+// sessionDownloads returns the unfinished downloads aria2 has into the
+// models dir by file name. Its saved session brings them back after a
+// restart with the GIDs they had.
+func (d *Downloader) sessionDownloads(ctx context.Context) map[string]*aria2.DownloadStatus {
+	var statuses []aria2.DownloadStatus
+	active, err := d.client.TellActive(ctx)
+	if err != nil {
+		log.Printf("Failed to list active downloads: %v", err)
+	}
+	statuses = append(statuses, active...)
+	waiting, err := d.client.TellWaiting(ctx, 0, maxSessionDownloads)
+	if err != nil {
+		log.Printf("Failed to list waiting downloads: %v", err)
+	}
+	statuses = append(statuses, waiting...)
+
+	live := make(map[string]*aria2.DownloadStatus)
+	for i := range statuses {
+		status := &statuses[i]
+		if len(status.Files) == 0 || status.Files[0].Path == "" {
+			continue
+		}
+		if name, ok := d.modelName(status.Files[0].Path); ok {
+			live[name] = status
+		}
+	}
+	return live
+}
+
+// controlFiles returns the names of the files in the models dir that have
+// an aria2 control file beside them
+func (d *Downloader) controlFiles() []string {
+	var names []string
+	filepath.WalkDir(d.store.Dir(), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, controlSuffix) {
+			return nil
+		}
+		if name, ok := d.modelName(strings.TrimSuffix(path, controlSuffix)); ok {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names
+}
+
+// modelName is the manifest name of a path in the models dir
+func (d *Downloader) modelName(path string) (string, bool) {
+	rel, err := filepath.Rel(d.store.Dir(), path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// removePartial deletes the control file of an abandoned download and the
+// data it fetched
+func (d *Downloader) removePartial(name string) {
+	log.Printf("Removing orphaned download %s", name)
+	for _, n := range []string{name + controlSuffix, name} {
+		if err := d.store.Remove(n); err != nil {
+			log.Printf("Failed to remove %s: %v", n, err)
+		}
+	}
+}
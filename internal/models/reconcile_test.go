@@ -0,0 +1,128 @@
+package models
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/druarnfield/diffbox/internal/aria2"
+	"github.com/druarnfield/diffbox/internal/storage"
+)
+
+// memoryGIDs is a GIDStore in a map
+type memoryGIDs struct {
+	mu   sync.Mutex
+	gids map[string]string
+}
+
+func (m *memoryGIDs) Track(model ModelFile, gid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gids[model.Name] = gid
+	return nil
+}
+
+func (m *memoryGIDs) Untrack(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.gids, name)
+	return nil
+}
+
+func (m *memoryGIDs) Tracked() (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.gids), nil
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	dir := t.TempDir()
+	fake := aria2.NewFake(server.Client())
+	store := &memoryGIDs{gids: make(map[string]string)}
+	d := NewDownloader(fake, storage.NewLocal(dir), "")
+	d.SetGIDStore(store)
+
+	chat, qwen := ModelsForWorkflow("chat"), ModelsForWorkflow("qwen")
+	active, paused, interrupted := chat[0], chat[1], qwen[0]
+
+	// Left running by the last start: one tracked, one paused and never
+	// tracked, and one of a file no longer needed
+	activeGID, _ := fake.AddURIs(ctx, []string{server.URL}, dir, active.Name, nil)
+	pausedGID, _ := fake.AddURIs(ctx, []string{server.URL}, dir, paused.Name, nil)
+	if err := fake.Pause(ctx, pausedGID); err != nil {
+		t.Fatal(err)
+	}
+	oldGID, _ := fake.AddURIs(ctx, []string{server.URL}, dir, "old.safetensors", nil)
+	store.gids[active.Name] = activeGID
+	store.gids[interrupted.Name] = "00000000deadbeef"
+	store.gids["gone.safetensors"] = "00000000feedface"
+
+	for _, name := range []string{interrupted.Name + ".aria2", interrupted.Name, "leftover.bin.aria2", "leftover.bin"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := d.Reconcile()
+
+	resumed := []string{active.Name, paused.Name}
+	slices.Sort(resumed)
+	if !slices.Equal(report.Resumed, resumed) {
+		t.Errorf("resumed = %v, want %v", report.Resumed, resumed)
+	}
+	stale := []string{interrupted.Name, "gone.safetensors"}
+	slices.Sort(stale)
+	if !slices.Equal(report.Stale, stale) {
+		t.Errorf("stale = %v, want %v", report.Stale, stale)
+	}
+	if want := []string{"leftover.bin", "old.safetensors"}; !slices.Equal(report.Orphans, want) {
+		t.Errorf("orphans = %v, want %v", report.Orphans, want)
+	}
+
+	if status, _ := fake.TellStatus(ctx, pausedGID); status.Status != "active" {
+		t.Errorf("paused download is %s, want active", status.Status)
+	}
+	if status, _ := fake.TellStatus(ctx, oldGID); status.Status != "removed" {
+		t.Errorf("orphaned download is %s, want removed", status.Status)
+	}
+	want := map[string]string{active.Name: activeGID, paused.Name: pausedGID}
+	if gids, _ := store.Tracked(); len(gids) != len(want) || gids[active.Name] != activeGID || gids[paused.Name] != pausedGID {
+		t.Errorf("tracked = %v, want %v", gids, want)
+	}
+
+	// The interrupted download resumes from its control file when queued
+	if _, err := os.Stat(filepath.Join(dir, interrupted.Name+".aria2")); err != nil {
+		t.Errorf("control file of a required file was removed: %v", err)
+	}
+	for _, name := range []string{"leftover.bin.aria2", "leftover.bin"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected orphaned %s to be removed", name)
+		}
+	}
+
+	// Adopted downloads are waited on rather than added again
+	gid, _, err := d.queue(active)
+	if err != nil || gid != activeGID {
+		t.Errorf("queue = %s, %v; want the adopted %s", gid, err, activeGID)
+	}
+	if again, _, _ := d.queue(active); again == activeGID {
+		t.Error("expected an adopted GID to be handed out once")
+	}
+}
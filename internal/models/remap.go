@@ -0,0 +1,129 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// URL remaps point a required file at a new URL after it moves upstream,
+// such as a renamed repo or a file moved within one. The local name stays
+// the same and aria2's control file doesn't record where the data came
+// from, so a partial download carries on from the new URL instead of
+// starting over.
+
+// ErrNotRequired is returned when remapping a file no enabled workflow
+// needs
+var ErrNotRequired = errors.New("not a required model")
+
+var (
+	remapMu  sync.RWMutex
+	remapped = map[string]string{} // URL by file name
+)
+
+// SetRemappedURLs replaces the remapped URLs, by file name. Call it at
+// startup, before any downloads.
+func SetRemappedURLs(urls map[string]string) {
+	remapMu.Lock()
+	defer remapMu.Unlock()
+	remapped = make(map[string]string, len(urls))
+	for name, url := range urls {
+		remapped[name] = url
+	}
+}
+
+func setRemappedURL(name, url string) {
+	remapMu.Lock()
+	defer remapMu.Unlock()
+	if url == "" {
+		delete(remapped, name)
+		return
+	}
+	remapped[name] = url
+}
+
+func remappedURL(name string) (string, bool) {
+	remapMu.RLock()
+	defer remapMu.RUnlock()
+	url, ok := remapped[name]
+	return url, ok
+}
+
+// RequiredModel returns the manifest entry of a required file
+func RequiredModel(name string) (ModelFile, bool) {
+	for _, m := range RequiredModels() {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return ModelFile{}, false
+}
+
+// RemapResult describes a remapped file and what was already downloaded
+type RemapResult struct {
+	Model       ModelFile // The entry with its new URL
+	PreviousURL string
+	// PartialSize is how much of the file is on disk, and Resumable is
+	// set if aria2's control file is beside it to carry on from
+	PartialSize int64
+	Resumable   bool
+	// Moved is set if a download in progress was switched to the new URL
+	Moved bool
+}
+
+// Remap points a required file at url, or back at its manifest URL if url
+// is empty. A download in progress is removed from aria2, keeping its
+// partial file and control file, and the loop waiting on it queues it
+// again from the new URL.
+func (d *Downloader) Remap(ctx context.Context, name, url string) (RemapResult, error) {
+	prev, ok := RequiredModel(name)
+	if !ok {
+		return RemapResult{}, ErrNotRequired
+	}
+	setRemappedURL(name, url)
+	model, _ := RequiredModel(name)
+
+	result := RemapResult{Model: model, PreviousURL: prev.URL}
+	path := filepath.Join(d.store.Dir(), filepath.FromSlash(name))
+	if info, err := os.Stat(path); err == nil {
+		result.PartialSize = info.Size()
+	}
+	if _, err := os.Stat(path + controlSuffix); err == nil {
+		result.Resumable = true
+	}
+	if model.URL == prev.URL {
+		return result, nil
+	}
+
+	status, ok := d.sessionDownloads(ctx)[name]
+	if !ok {
+		return result, nil
+	}
+	d.gidMu.Lock()
+	if d.remapping == nil {
+		d.remapping = make(map[string]bool)
+	}
+	d.remapping[status.GID] = true
+	d.gidMu.Unlock()
+	if err := d.client.Remove(ctx, status.GID); err != nil {
+		d.takeRemap(status.GID)
+		return result, fmt.Errorf("remove download of %s: %w", name, err)
+	}
+	log.Printf("Moving download of %s to %s", name, model.URL)
+	result.Moved = true
+	return result, nil
+}
+
+// takeRemap reports whether Remap removed the download, so the loop
+// waiting on it should queue it again, and forgets it
+func (d *Downloader) takeRemap(gid string) bool {
+	d.gidMu.Lock()
+	defer d.gidMu.Unlock()
+	ok := d.remapping[gid]
+	delete(d.remapping, gid)
+	return ok
+}
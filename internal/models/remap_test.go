@@ -0,0 +1,83 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/druarnfield/diffbox/internal/aria2"
+	"github.com/druarnfield/diffbox/internal/storage"
+)
+
+func TestRemap(t *testing.T) {
+	defer SetRemappedURLs(nil)
+	ctx := context.Background()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	dir := t.TempDir()
+	fake := aria2.NewFake(server.Client())
+	d := NewDownloader(fake, storage.NewLocal(dir), "")
+
+	model := ModelsForWorkflow("qwen")[0]
+	gid, _, err := d.queue(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{model.Name, model.Name + controlSuffix} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moved := DefaultHFEndpoint + "/new-org/repo/resolve/main/" + model.Name
+	result, err := d.Remap(ctx, model.Name, moved)
+	if err != nil {
+		t.Fatalf("Remap failed: %v", err)
+	}
+	if result.PreviousURL != model.URL || result.Model.URL != moved || !result.Moved {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if result.PartialSize != int64(len("partial")) || !result.Resumable {
+		t.Errorf("partial download not reported: %+v", result)
+	}
+	if m, _ := RequiredModel(model.Name); m.URL != moved {
+		t.Errorf("manifest URL = %s, want %s", m.URL, moved)
+	}
+
+	// The old download is removed for the loop to queue again, leaving
+	// what it fetched in place
+	if status, _ := fake.TellStatus(ctx, gid); status.Status != "removed" {
+		t.Errorf("old download is %s, want removed", status.Status)
+	}
+	if !d.takeRemap(gid) || d.takeRemap(gid) {
+		t.Error("expected the removed GID to be taken once")
+	}
+	if _, err := os.Stat(filepath.Join(dir, model.Name+controlSuffix)); err != nil {
+		t.Errorf("control file removed: %v", err)
+	}
+
+	// Remapping back restores the manifest URL; nothing is downloading
+	result, err = d.Remap(ctx, model.Name, "")
+	if err != nil {
+		t.Fatalf("Remap failed: %v", err)
+	}
+	if result.Model.URL != model.URL || result.Moved {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	if _, err := d.Remap(ctx, "unknown.safetensors", moved); !errors.Is(err, ErrNotRequired) {
+		t.Errorf("expected ErrNotRequired, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RemoteFile is a file's identity as reported by HuggingFace
+type RemoteFile struct {
+	SHA256 string // Empty for small non-LFS files
+	Size   int64
+}
+
+// RemoteLookup fetches the expected size and hash for a model URL
+type RemoteLookup func(url string) (*RemoteFile, error)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// NewHFLookup returns a lookup that issues HEAD requests against HuggingFace
+// resolve URLs. LFS files answer with a redirect to the CDN carrying
+// X-Linked-Etag (the sha256) and X-Linked-Size; the redirect isn't followed.
+func NewHFLookup(token string) RemoteLookup {
+	client := &http.Client{
+		Timeout: 15 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return func(url string) (*RemoteFile, error) {
+		req, err := http.NewRequest(http.MethodHead, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("head %s: %w", url, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 400 {
+			return nil, fmt.Errorf("head %s: status %d", url, resp.StatusCode)
+		}
+		return parseRemoteHeaders(resp.Header, resp.StatusCode), nil
+	}
+}
+
+func parseRemoteHeaders(h http.Header, status int) *RemoteFile {
+	rf := &RemoteFile{}
+
+	if etag := normalizeETag(h.Get("X-Linked-Etag")); sha256Pattern.MatchString(etag) {
+		rf.SHA256 = etag
+	}
+	if size, err := strconv.ParseInt(h.Get("X-Linked-Size"), 10, 64); err == nil {
+		rf.Size = size
+	} else if status == http.StatusOK {
+		// Non-LFS files are served directly
+		if size, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil {
+			rf.Size = size
+		}
+	}
+
+	return rf
+}
+
+// normalizeETag strips the weak prefix and quotes from an ETag
+func normalizeETag(etag string) string {
+	etag = strings.TrimPrefix(etag, "W/")
+	return strings.ToLower(strings.Trim(etag, `"`))
+}
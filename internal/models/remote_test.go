@@ -0,0 +1,59 @@
+package models
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHFLookup(t *testing.T) {
+	const sum = "4c5c0b5a1c8a2d3e6f7081a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6"
+
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if r.Method != http.MethodHead {
+			t.Errorf("expected HEAD, got %s", r.Method)
+		}
+		switch r.URL.Path {
+		case "/lfs.safetensors":
+			w.Header().Set("X-Linked-Etag", `"`+sum+`"`)
+			w.Header().Set("X-Linked-Size", "1234")
+			w.Header().Set("Location", "/cdn")
+			w.WriteHeader(http.StatusFound)
+		case "/tokenizer.json":
+			w.Header().Set("ETag", `"0123456789abcdef0123456789abcdef01234567"`)
+			w.Header().Set("Content-Length", "42")
+		case "/cdn":
+			t.Error("redirect to the CDN should not be followed")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	lookup := NewHFLookup("hf_test")
+
+	rf, err := lookup(server.URL + "/lfs.safetensors")
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	if rf.SHA256 != sum || rf.Size != 1234 {
+		t.Errorf("unexpected LFS metadata: %+v", rf)
+	}
+	if auth != "Bearer hf_test" {
+		t.Errorf("expected token to be sent, got %q", auth)
+	}
+
+	rf, err = lookup(server.URL + "/tokenizer.json")
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	if rf.SHA256 != "" || rf.Size != 42 {
+		t.Errorf("unexpected non-LFS metadata: %+v", rf)
+	}
+
+	if _, err := lookup(server.URL + "/missing"); err == nil {
+		t.Error("expected error for 404")
+	}
+}
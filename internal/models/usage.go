@@ -0,0 +1,137 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/storage"
+)
+
+// Usage is what's known about how a model file has been used
+type Usage struct {
+	LastUsed time.Time // zero if no job has needed it yet
+	Pinned   bool
+}
+
+// Suggestion is a model file that looks safe to remove
+type Suggestion struct {
+	Name       string    `json:"name"`
+	Workflow   string    `json:"workflow"`
+	Size       int64     `json:"size"`
+	LastUsed   time.Time `json:"last_used"`
+	NeverUsed  bool      `json:"never_used"`
+	UnusedDays int       `json:"unused_days"`
+	Message    string    `json:"message"`
+}
+
+// UnusedModels returns required model files on disk that no job has needed
+// for at least minAge, largest first. Files never used by a job count from
+// when they were downloaded. Pinned files are skipped.
+func UnusedModels(modelsDir string, usage map[string]Usage, minAge time.Duration, now time.Time) []Suggestion {
+	var suggestions []Suggestion
+	for _, m := range RequiredModels() {
+		u := usage[m.Name]
+		if u.Pinned {
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(modelsDir, m.Name))
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		since := u.LastUsed
+		if since.IsZero() {
+			since = info.ModTime()
+		}
+		idle := now.Sub(since)
+		if idle < minAge {
+			continue
+		}
+
+		days := int(idle.Hours() / 24)
+		suggestions = append(suggestions, Suggestion{
+			Name:       m.Name,
+			Workflow:   m.Workflow,
+			Size:       info.Size(),
+			LastUsed:   u.LastUsed,
+			NeverUsed:  u.LastUsed.IsZero(),
+			UnusedDays: days,
+			Message:    fmt.Sprintf("unused for %d days, %.1f GB", days, float64(info.Size())/1e9),
+		})
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		return suggestions[i].Size > suggestions[j].Size
+	})
+	return suggestions
+}
+
+// SetArchiveDir sets where archived model files are moved. Archived files
+// are moved back instead of downloaded when a workflow needs them again.
+func (d *Downloader) SetArchiveDir(dir string) {
+	d.archiveDir = dir
+}
+
+// Archive moves a model file out of the models directory into the archive
+func (d *Downloader) Archive(name string) error {
+	if d.archiveDir == "" {
+		return fmt.Errorf("no archive directory configured")
+	}
+	d.archiveMu.Lock()
+	defer d.archiveMu.Unlock()
+	src, err := d.store.LocalPath(name)
+	if err != nil {
+		return err
+	}
+	if err := storage.MoveFile(src, filepath.Join(d.archiveDir, name)); err != nil {
+		return err
+	}
+	// A no-op locally; other backends drop their copy
+	return d.store.Remove(name)
+}
+
+// WorkflowArchived reports whether any of a workflow's missing models has
+// an archived copy to restore. Restoring can be a long copy, so it is
+// left to EnsureWorkflow.
+func (d *Downloader) WorkflowArchived(workflow string) bool {
+	if d.archiveDir == "" {
+		return false
+	}
+	for _, m := range ModelsForWorkflow(workflow) {
+		if _, err := os.Stat(filepath.Join(d.archiveDir, m.Name)); err != nil {
+			continue
+		}
+		if _, err := d.store.Stat(m.Name); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreArchived moves archived copies of missing models back into the
+// models directory, so only files that were never archived get downloaded
+func (d *Downloader) restoreArchived(models []ModelFile) {
+	if d.archiveDir == "" {
+		return
+	}
+	d.archiveMu.Lock()
+	defer d.archiveMu.Unlock()
+	for _, m := range models {
+		src := filepath.Join(d.archiveDir, m.Name)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		if _, err := d.store.Stat(m.Name); err == nil {
+			continue
+		}
+		log.Printf("Restoring archived model %s", m.Name)
+		if err := d.store.Import(m.Name, src); err != nil {
+			log.Printf("Failed to restore %s: %v", m.Name, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/storage"
+)
+
+func TestUnusedModels(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	qwen := ModelsForWorkflow("qwen")
+	if len(qwen) < 3 {
+		t.Fatalf("test needs at least 3 qwen models, have %d", len(qwen))
+	}
+
+	for i, m := range qwen[:3] {
+		path := filepath.Join(dir, m.Name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, 100*(i+1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		old := now.Add(-90 * 24 * time.Hour)
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	usage := map[string]Usage{
+		qwen[0].Name: {LastUsed: now.Add(-70 * 24 * time.Hour)},
+		qwen[1].Name: {LastUsed: now.Add(-24 * time.Hour)},
+		qwen[2].Name: {Pinned: true},
+	}
+	got := UnusedModels(dir, usage, 60*24*time.Hour, now)
+	if len(got) != 1 || got[0].Name != qwen[0].Name {
+		t.Fatalf("expected only %s, got %+v", qwen[0].Name, got)
+	}
+	if got[0].UnusedDays != 70 || got[0].NeverUsed {
+		t.Errorf("unexpected suggestion %+v", got[0])
+	}
+
+	// Files no job has used count from their download time
+	got = UnusedModels(dir, nil, 60*24*time.Hour, now)
+	if len(got) != 3 || !got[0].NeverUsed || got[0].Size < got[1].Size {
+		t.Errorf("expected all three never-used files, largest first, got %+v", got)
+	}
+}
+
+func TestArchiveAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	d := NewDownloader(nil, storage.NewLocal(dir), "")
+	d.SetArchiveDir(filepath.Join(t.TempDir(), "archive"))
+
+	m := ModelsForWorkflow("qwen")[4] // nested under qwen_tokenizer/
+	path := filepath.Join(dir, m.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("weights"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Archive(m.Name); err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("expected model moved out of the models dir")
+	}
+
+	if !d.WorkflowArchived("qwen") || d.WorkflowArchived("i2v") {
+		t.Error("expected only qwen to have archived models")
+	}
+
+	d.restoreArchived([]ModelFile{m})
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "weights" {
+		t.Errorf("expected model restored, got %q, %v", data, err)
+	}
+	if d.WorkflowArchived("qwen") {
+		t.Error("expected nothing left to restore")
+	}
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"slices"
+	"sync"
+)
+
+// Model variants. The quantized one swaps the largest fp16/bf16 checkpoints
+// for fp8 files about half the size, for GPUs that can't hold the full
+// ones.
+const (
+	VariantFull      = "full"
+	VariantQuantized = "fp8"
+)
+
+// BuiltinWorkflows are the workflows whose models ship in the manifest.
+// SVI jobs use the i2v models.
+var BuiltinWorkflows = []string{"i2v", "qwen", "chat"}
+
+// quantized maps full-precision files to their fp8 replacements. URLs are
+// relative to the HuggingFace endpoint.
+var quantized = map[string]ModelFile{
+	"wan2.2_i2v_high_noise_14B_fp16.safetensors": {
+		Name: "wan2.2_i2v_high_noise_14B_fp8_scaled.safetensors",
+		URL:  "/Comfy-Org/Wan_2.2_ComfyUI_Repackaged/resolve/main/split_files/diffusion_models/wan2.2_i2v_high_noise_14B_fp8_scaled.safetensors",
+		Size: 14_300_000_000,
+	},
+	"wan2.2_i2v_low_noise_14B_fp16.safetensors": {
+		Name: "wan2.2_i2v_low_noise_14B_fp8_scaled.safetensors",
+		URL:  "/Comfy-Org/Wan_2.2_ComfyUI_Repackaged/resolve/main/split_files/diffusion_models/wan2.2_i2v_low_noise_14B_fp8_scaled.safetensors",
+		Size: 14_300_000_000,
+	},
+	"umt5_xxl_fp16.safetensors": {
+		Name: "umt5_xxl_fp8_e4m3fn_scaled.safetensors",
+		URL:  "/Comfy-Org/Wan_2.2_ComfyUI_Repackaged/resolve/main/split_files/text_encoders/umt5_xxl_fp8_e4m3fn_scaled.safetensors",
+		Size: 6_740_000_000,
+	},
+	"qwen_image_edit_2511_bf16.safetensors": {
+		Name: "qwen_image_edit_2511_fp8mixed.safetensors",
+		URL:  "/Comfy-Org/Qwen-Image-Edit_ComfyUI/resolve/main/split_files/diffusion_models/qwen_image_edit_2511_fp8mixed.safetensors",
+		Size: 20_500_000_000,
+	},
+	"qwen_2.5_vl_7b.safetensors": {
+		Name: "qwen_2.5_vl_7b_fp8_scaled.safetensors",
+		URL:  "/Comfy-Org/Qwen-Image_ComfyUI/resolve/main/split_files/text_encoders/qwen_2.5_vl_7b_fp8_scaled.safetensors",
+		Size: 9_380_000_000,
+	},
+}
+
+// Selection is which built-in workflows are enabled and which variant of
+// their models to use. Custom workflows are always enabled.
+type Selection struct {
+	Workflows []string // Nil enables every built-in workflow
+	Variant   string   // VariantFull or VariantQuantized; empty means full
+}
+
+func (s Selection) enabled(workflow string) bool {
+	return s.Workflows == nil || slices.Contains(s.Workflows, workflow) ||
+		!slices.Contains(BuiltinWorkflows, workflow)
+}
+
+var (
+	selectionMu sync.RWMutex
+	selection   Selection
+)
+
+// SetSelection changes which models RequiredModels lists and which file
+// each built-in alias resolves to. It takes effect for downloads and jobs
+// started afterwards.
+func SetSelection(s Selection) {
+	selectionMu.Lock()
+	defer selectionMu.Unlock()
+	selection = s
+}
+
+// CurrentSelection returns the selection set with SetSelection; by default
+// every workflow is enabled at full precision
+func CurrentSelection() Selection {
+	selectionMu.RLock()
+	defer selectionMu.RUnlock()
+	return selection
+}
+
+// WorkflowEnabled reports whether jobs of a workflow may run
+func WorkflowEnabled(workflow string) bool {
+	return CurrentSelection().enabled(workflow)
+}
+
+// variantFile returns the file to use in place of a full-precision one
+// under the current selection
+func variantFile(name string) string {
+	if CurrentSelection().Variant == VariantQuantized {
+		if q, ok := quantized[name]; ok {
+			return q.Name
+		}
+	}
+	return name
+}
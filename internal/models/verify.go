@@ -0,0 +1,318 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/storage"
+)
+
+// Verification states of a single file
+const (
+	VerifyPending    = "pending"
+	VerifyChecking   = "checking"
+	VerifyOK         = "ok"
+	VerifyMissing    = "missing"
+	VerifyIncomplete = "incomplete"
+	VerifyCorrupt    = "corrupt"
+	VerifyError      = "error"
+)
+
+// FileVerification is the result of checking one model file
+type FileVerification struct {
+	Name         string `json:"name"`
+	Workflow     string `json:"workflow"`
+	Status       string `json:"status"`
+	ExpectedSize int64  `json:"expected_size"`
+	ActualSize   int64  `json:"actual_size"`
+	Method       string `json:"method,omitempty"` // "size", "exact_size" or "sha256"
+	Detail       string `json:"detail,omitempty"`
+}
+
+// VerificationStatus is a snapshot of a verification run
+type VerificationStatus struct {
+	Running    bool               `json:"running"`
+	Total      int                `json:"total"`
+	Checked    int                `json:"checked"`
+	Progress   float64            `json:"progress"`
+	StartedAt  *time.Time         `json:"started_at,omitempty"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+	Files      []FileVerification `json:"files"`
+}
+
+// Verifier checks local model files against the manifest using a bounded
+// pool of workers, so a slow disk or a large hash doesn't serialize the
+// whole scan
+type Verifier struct {
+	store       storage.Storage
+	concurrency int
+	hashes      *hashCache
+
+	remoteMu sync.Mutex
+	remote   RemoteLookup
+	known    map[string]*RemoteFile
+
+	mu         sync.RWMutex
+	files      []FileVerification
+	checked    int
+	running    bool
+	startedAt  time.Time
+	finishedAt time.Time
+}
+
+// NewVerifier creates a verifier checking the files in store
+func NewVerifier(store storage.Storage, concurrency int) *Verifier {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Verifier{
+		store:       store,
+		concurrency: concurrency,
+		hashes:      loadHashCache(filepath.Join(store.Dir(), hashCacheFile)),
+		known:       make(map[string]*RemoteFile),
+	}
+}
+
+// SetRemoteLookup makes the verifier check files against the size and hash
+// published upstream instead of trusting the approximate manifest size
+func (v *Verifier) SetRemoteLookup(lookup RemoteLookup) {
+	v.remoteMu.Lock()
+	defer v.remoteMu.Unlock()
+	v.remote = lookup
+}
+
+// remoteFile looks up a model upstream, remembering successful answers.
+// A nil result means only the manifest can be used.
+func (v *Verifier) remoteFile(model ModelFile) *RemoteFile {
+	v.remoteMu.Lock()
+	lookup := v.remote
+	rf, ok := v.known[model.URL]
+	v.remoteMu.Unlock()
+
+	if ok || lookup == nil {
+		return rf
+	}
+
+	rf, err := lookup(model.URL)
+	if err != nil {
+		log.Printf("Cannot fetch upstream metadata for %s: %v (falling back to size check)", model.Name, err)
+		return nil
+	}
+
+	v.remoteMu.Lock()
+	v.known[model.URL] = rf
+	v.remoteMu.Unlock()
+	return rf
+}
+
+// Verify checks every model and returns the ones that need downloading
+func (v *Verifier) Verify(models []ModelFile) []ModelFile {
+	v.mu.Lock()
+	v.files = make([]FileVerification, len(models))
+	for i, m := range models {
+		v.files[i] = FileVerification{
+			Name:         m.Name,
+			Workflow:     m.Workflow,
+			Status:       VerifyPending,
+			ExpectedSize: m.Size,
+		}
+	}
+	v.checked = 0
+	v.running = true
+	v.startedAt = time.Now()
+	v.finishedAt = time.Time{}
+	v.mu.Unlock()
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < v.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				v.setStatus(i, FileVerification{Status: VerifyChecking})
+				v.setStatus(i, v.verifyFile(models[i]))
+			}
+		}()
+	}
+	for i := range models {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if err := v.hashes.save(); err != nil {
+		log.Printf("Failed to save model hash cache: %v", err)
+	}
+
+	v.mu.Lock()
+	v.running = false
+	v.finishedAt = time.Now()
+	var missing []ModelFile
+	for i, f := range v.files {
+		if f.Status != VerifyOK {
+			missing = append(missing, models[i])
+		}
+	}
+	elapsed := v.finishedAt.Sub(v.startedAt)
+	v.mu.Unlock()
+
+	log.Printf("Verified %d model files in %s (%d need downloading)", len(models), elapsed.Round(time.Millisecond), len(missing))
+	return missing
+}
+
+func (v *Verifier) setStatus(i int, result FileVerification) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	f := &v.files[i]
+	f.Status = result.Status
+	f.ActualSize = result.ActualSize
+	f.Method = result.Method
+	f.Detail = result.Detail
+	if result.ExpectedSize > 0 {
+		f.ExpectedSize = result.ExpectedSize
+	}
+	if result.Status != VerifyChecking {
+		v.checked++
+	}
+}
+
+func (v *Verifier) verifyFile(model ModelFile) FileVerification {
+	info, err := v.store.Stat(model.Name)
+
+	if errors.Is(err, storage.ErrNotFound) {
+		return FileVerification{Status: VerifyMissing}
+	}
+	if err != nil {
+		// Permission or other error - treat as missing
+		log.Printf("Cannot stat %s: %v (will download)", model.Name, err)
+		return FileVerification{Status: VerifyError, Detail: err.Error()}
+	}
+
+	result := FileVerification{ActualSize: info.Size()}
+
+	// An .aria2 control file means a download was interrupted mid-way
+	if _, err := v.store.Stat(model.Name + ".aria2"); err == nil {
+		result.Status = VerifyIncomplete
+		result.Detail = "interrupted download"
+		return result
+	}
+
+	expectedSize, expectedHash := model.Size, model.SHA256
+	exact := false
+	if rf := v.remoteFile(model); rf != nil {
+		if rf.Size > 0 {
+			expectedSize, exact = rf.Size, true
+		}
+		if expectedHash == "" {
+			expectedHash = rf.SHA256
+		}
+	}
+	result.ExpectedSize = expectedSize
+
+	if exact {
+		result.Method = "exact_size"
+		if info.Size() < expectedSize {
+			result.Status = VerifyIncomplete
+			return result
+		}
+		if info.Size() != expectedSize {
+			log.Printf("Corrupt: %s (%d bytes, expected %d)", model.Name, info.Size(), expectedSize)
+			result.Status = VerifyCorrupt
+			result.Detail = "size mismatch"
+			return result
+		}
+	} else {
+		// Check size (allow 1% tolerance for filesystem differences)
+		result.Method = "size"
+		if info.Size() < int64(float64(expectedSize)*0.99) {
+			log.Printf("Incomplete: %s (%.2f GB / %.2f GB)",
+				model.Name,
+				float64(info.Size())/1e9,
+				float64(expectedSize)/1e9)
+			result.Status = VerifyIncomplete
+			return result
+		}
+	}
+
+	if expectedHash != "" {
+		result.Method = "sha256"
+		sum, ok := v.hashes.get(model.Name, info)
+		if !ok {
+			var err error
+			if sum, err = v.hashFile(model.Name); err != nil {
+				result.Status = VerifyError
+				result.Detail = err.Error()
+				return result
+			}
+			v.hashes.put(model.Name, info, sum)
+		}
+		if sum != expectedHash {
+			log.Printf("Corrupt: %s (sha256 %s, expected %s)", model.Name, sum, expectedHash)
+			result.Status = VerifyCorrupt
+			result.Detail = "sha256 mismatch"
+			return result
+		}
+	}
+
+	result.Status = VerifyOK
+	return result
+}
+
+func (v *Verifier) hashFile(name string) (string, error) {
+	f, err := v.store.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash %s: %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Status returns a snapshot of the current or most recent run
+func (v *Verifier) Status() VerificationStatus {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	status := VerificationStatus{
+		Running: v.running,
+		Total:   len(v.files),
+		Checked: v.checked,
+		Files:   append([]FileVerification{}, v.files...),
+	}
+	if status.Total > 0 {
+		status.Progress = float64(v.checked) / float64(status.Total) * 100
+	}
+	if !v.startedAt.IsZero() {
+		started := v.startedAt
+		status.StartedAt = &started
+	}
+	if !v.finishedAt.IsZero() {
+		finished := v.finishedAt
+		status.FinishedAt = &finished
+	}
+	return status
+}
+
+// CachedHash returns a model file's sha256 if it has been hashed since it
+// last changed, or "" otherwise. It never reads the file itself.
+func (v *Verifier) CachedHash(name string) string {
+	info, err := v.store.Stat(name)
+	if err != nil {
+		return ""
+	}
+	sum, _ := v.hashes.get(name, info)
+	return sum
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/storage"
+)
+
+func TestVerifierVerify(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	full := make([]byte, 1000)
+	sum := sha256.Sum256(full)
+
+	write("a/complete.bin", full)
+	write("a/short.bin", full[:100])
+	write("b/interrupted.bin", full)
+	write("b/interrupted.bin.aria2", nil)
+	write("b/hashed.bin", full)
+	write("b/corrupt.bin", full)
+
+	models := []ModelFile{
+		{Name: "a/complete.bin", Size: 1000, Workflow: "i2v"},
+		{Name: "a/short.bin", Size: 1000, Workflow: "i2v"},
+		{Name: "a/missing.bin", Size: 1000, Workflow: "i2v"},
+		{Name: "b/interrupted.bin", Size: 1000, Workflow: "qwen"},
+		{Name: "b/hashed.bin", Size: 1000, Workflow: "qwen", SHA256: hex.EncodeToString(sum[:])},
+		{Name: "b/corrupt.bin", Size: 1000, Workflow: "qwen", SHA256: "deadbeef"},
+	}
+
+	v := NewVerifier(storage.NewLocal(dir), 3)
+	missing := v.Verify(models)
+
+	if len(missing) != 4 {
+		t.Errorf("expected 4 files to download, got %d", len(missing))
+	}
+
+	status := v.Status()
+	if status.Running {
+		t.Error("expected verification to be finished")
+	}
+	if status.Total != len(models) || status.Checked != len(models) {
+		t.Errorf("expected %d/%d checked, got %d/%d", len(models), len(models), status.Checked, status.Total)
+	}
+	if status.Progress != 100 {
+		t.Errorf("expected progress 100, got %v", status.Progress)
+	}
+	if status.StartedAt == nil || status.FinishedAt == nil {
+		t.Error("expected start and finish times")
+	}
+
+	expected := map[string]string{
+		"a/complete.bin":    VerifyOK,
+		"a/short.bin":       VerifyIncomplete,
+		"a/missing.bin":     VerifyMissing,
+		"b/interrupted.bin": VerifyIncomplete,
+		"b/hashed.bin":      VerifyOK,
+		"b/corrupt.bin":     VerifyCorrupt,
+	}
+	for _, f := range status.Files {
+		if f.Status != expected[f.Name] {
+			t.Errorf("%s: expected %s, got %s", f.Name, expected[f.Name], f.Status)
+		}
+	}
+}
+
+func TestVerifierStatusBeforeRun(t *testing.T) {
+	status := NewVerifier(storage.NewLocal(t.TempDir()), 0).Status()
+	if status.Running || status.Total != 0 || status.StartedAt != nil {
+		t.Errorf("unexpected status before first run: %+v", status)
+	}
+}
+
+func TestVerifierRemoteLookup(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("model weights")
+	sum := sha256.Sum256(data)
+
+	for _, name := range []string{"good.bin", "bitrot.bin", "long.bin"} {
+		content := data
+		if name == "bitrot.bin" {
+			content = []byte("model weighta")
+		}
+		if name == "long.bin" {
+			content = append(data, '!')
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var lookups atomic.Int32
+	v := NewVerifier(storage.NewLocal(dir), 2)
+	v.SetRemoteLookup(func(url string) (*RemoteFile, error) {
+		lookups.Add(1)
+		return &RemoteFile{SHA256: hex.EncodeToString(sum[:]), Size: int64(len(data))}, nil
+	})
+
+	// The manifest sizes are approximate; upstream metadata wins
+	models := []ModelFile{
+		{Name: "good.bin", URL: "https://hf/good", Size: 10},
+		{Name: "bitrot.bin", URL: "https://hf/bitrot", Size: 10},
+		{Name: "long.bin", URL: "https://hf/long", Size: 10},
+	}
+	v.Verify(models)
+
+	expected := map[string]string{
+		"good.bin":   VerifyOK,
+		"bitrot.bin": VerifyCorrupt,
+		"long.bin":   VerifyCorrupt,
+	}
+	for _, f := range v.Status().Files {
+		if f.Status != expected[f.Name] {
+			t.Errorf("%s: expected %s, got %s (%s)", f.Name, expected[f.Name], f.Status, f.Detail)
+		}
+		if f.ExpectedSize != int64(len(data)) {
+			t.Errorf("%s: expected upstream size %d, got %d", f.Name, len(data), f.ExpectedSize)
+		}
+	}
+
+	// Upstream answers are remembered across runs
+	v.Verify(models)
+	if n := int(lookups.Load()); n != len(models) {
+		t.Errorf("expected %d lookups, got %d", len(models), n)
+	}
+	// Hashes computed while verifying are available without rereading
+	if got := v.CachedHash("good.bin"); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected cached hash for good.bin, got %q", got)
+	}
+	if got := v.CachedHash("missing.bin"); got != "" {
+		t.Errorf("expected no hash for a missing file, got %q", got)
+	}
+}
+
+func TestHashCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "model.bin")
+	if err := os.WriteFile(path, []byte("weights"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(path)
+
+	cache := loadHashCache(filepath.Join(dir, hashCacheFile))
+	cache.put("model.bin", info, "abc")
+	if err := cache.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := loadHashCache(filepath.Join(dir, hashCacheFile))
+	if sum, ok := reloaded.get("model.bin", info); !ok || sum != "abc" {
+		t.Errorf("expected cached hash abc, got %q (%v)", sum, ok)
+	}
+
+	// A rewritten file must be hashed again
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	info, _ = os.Stat(path)
+	if _, ok := reloaded.get("model.bin", info); ok {
+		t.Error("expected cache miss after the file changed")
+	}
+}
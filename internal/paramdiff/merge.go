@@ -0,0 +1,28 @@
+package paramdiff
+
+// Merge applies patch over params as a JSON merge patch (RFC 7386): keys
+// in patch replace those in params, nested objects merge key by key, and
+// a null removes the key so the workflow default applies again. Arrays
+// are replaced whole. Neither input is modified.
+func Merge(params, patch map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(params)+len(patch))
+	for k, v := range params {
+		merged[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		sub, isObject := v.(map[string]interface{})
+		base, baseIsObject := merged[k].(map[string]interface{})
+		if isObject && baseIsObject {
+			merged[k] = Merge(base, sub)
+		} else if isObject {
+			merged[k] = Merge(nil, sub)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
@@ -0,0 +1,100 @@
+// Package paramdiff compares two sets of job params. Nested objects are
+// flattened into dotted keys so a change deep inside, say, the loader
+// overrides shows up as "models.unet_name" rather than the whole object.
+// It also merges overrides into a set, for resubmitting a job with tweaks.
+package paramdiff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// maxValueLength is the longest string reported verbatim. Longer values
+// are usually base64 images, which are summarised instead.
+const maxValueLength = 256
+
+// Change is one key that differs between the two param sets. A is nil
+// for added keys and B for removed ones.
+type Change struct {
+	Key string      `json:"key"`
+	A   interface{} `json:"a,omitempty"`
+	B   interface{} `json:"b,omitempty"`
+}
+
+// Diff is the difference from params a to params b
+type Diff struct {
+	Changed   []Change `json:"changed"`
+	Added     []Change `json:"added"`   // only in b
+	Removed   []Change `json:"removed"` // only in a
+	Unchanged int      `json:"unchanged"`
+}
+
+// Compare diffs two param maps as decoded from JSON
+func Compare(a, b map[string]interface{}) Diff {
+	flatA, flatB := flatten(a), flatten(b)
+
+	keys := make(map[string]bool, len(flatA)+len(flatB))
+	for k := range flatA {
+		keys[k] = true
+	}
+	for k := range flatB {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	d := Diff{Changed: []Change{}, Added: []Change{}, Removed: []Change{}}
+	for _, k := range sorted {
+		va, inA := flatA[k]
+		vb, inB := flatB[k]
+		switch {
+		case !inA:
+			d.Added = append(d.Added, Change{Key: k, B: summarise(vb)})
+		case !inB:
+			d.Removed = append(d.Removed, Change{Key: k, A: summarise(va)})
+		case reflect.DeepEqual(va, vb):
+			d.Unchanged++
+		default:
+			d.Changed = append(d.Changed, Change{Key: k, A: summarise(va), B: summarise(vb)})
+		}
+	}
+	return d
+}
+
+// flatten turns nested objects into dotted keys. Arrays are compared as a
+// whole; null values are treated as absent.
+func flatten(params map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			key := prefix + k
+			switch v := v.(type) {
+			case nil:
+			case map[string]interface{}:
+				walk(key+".", v)
+			default:
+				flat[key] = v
+			}
+		}
+	}
+	walk("", params)
+	return flat
+}
+
+// summarise replaces oversized strings with their length and a short hash,
+// enough to tell two images apart without echoing megabytes of base64
+func summarise(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok || len(s) <= maxValueLength {
+		return v
+	}
+	sum := sha256.Sum256([]byte(s))
+	return fmt.Sprintf("<%d bytes, sha256 %s>", len(s), hex.EncodeToString(sum[:])[:12])
+}
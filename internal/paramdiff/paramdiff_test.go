@@ -0,0 +1,72 @@
+package paramdiff
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestCompare(t *testing.T) {
+	a := decode(t, `{"prompt":"a cat","seed":1,"cfg_scale":5,"loras":["x"],"models":{"unet_name":"a.safetensors"},"tiled":true,"motion_bucket_id":null}`)
+	b := decode(t, `{"prompt":"a cat","seed":2,"cfg_scale":5,"loras":["x","y"],"models":{"unet_name":"b.safetensors"},"num_frames":81}`)
+
+	d := Compare(a, b)
+
+	var changed []string
+	for _, c := range d.Changed {
+		changed = append(changed, c.Key)
+	}
+	if got := strings.Join(changed, ","); got != "loras,models.unet_name,seed" {
+		t.Errorf("changed = %s", got)
+	}
+	if len(d.Added) != 1 || d.Added[0].Key != "num_frames" || d.Added[0].B != 81.0 {
+		t.Errorf("added = %+v", d.Added)
+	}
+	// Null values count as absent, so motion_bucket_id isn't reported
+	if len(d.Removed) != 1 || d.Removed[0].Key != "tiled" {
+		t.Errorf("removed = %+v", d.Removed)
+	}
+	if d.Unchanged != 2 {
+		t.Errorf("unchanged = %d, want 2", d.Unchanged)
+	}
+}
+
+func TestCompareSummarisesLargeValues(t *testing.T) {
+	img := strings.Repeat("A", 10_000)
+	d := Compare(
+		map[string]interface{}{"input_image": img},
+		map[string]interface{}{"input_image": img + "B"},
+	)
+	if len(d.Changed) != 1 {
+		t.Fatalf("expected one change, got %+v", d)
+	}
+	a, _ := d.Changed[0].A.(string)
+	b, _ := d.Changed[0].B.(string)
+	if !strings.HasPrefix(a, "<10000 bytes, sha256 ") || !strings.HasPrefix(b, "<10001 bytes") || a == b {
+		t.Errorf("unexpected summaries %q, %q", a, b)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	params := decode(t, `{"prompt":"a cat","seed":1,"num_inference_steps":8,"loras":["x","y"],"models":{"unet_name":"a.safetensors","vae_name":"v.safetensors"},"tiled":true}`)
+	patch := decode(t, `{"seed":42,"num_inference_steps":12,"loras":["z"],"models":{"unet_name":"b.safetensors","clip_name":null},"tiled":null,"cfg_scale":3.5}`)
+
+	merged := Merge(params, patch)
+	want := decode(t, `{"prompt":"a cat","seed":42,"num_inference_steps":12,"loras":["z"],"models":{"unet_name":"b.safetensors","vae_name":"v.safetensors"},"cfg_scale":3.5}`)
+
+	if d := Compare(want, merged); len(d.Changed)+len(d.Added)+len(d.Removed) > 0 {
+		t.Errorf("unexpected merge result: %+v", d)
+	}
+	if params["seed"] != float64(1) || params["tiled"] != true {
+		t.Errorf("Merge modified its input: %v", params)
+	}
+}
@@ -0,0 +1,170 @@
+// Package paramtpl expands {{name}} placeholders in job params from a map
+// of variables, so one preset can drive many jobs: a prompt of
+// "{{subject}} in the style of {{style}}" becomes a concrete prompt at
+// submission time.
+package paramtpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidName reports whether name can be used as a variable
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// Variable is a variable a preset declares
+type Variable struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Default applies when a submission doesn't set the variable; without
+	// one the variable is required
+	Default interface{} `json:"default,omitempty"`
+}
+
+// MissingError lists placeholders that had no value
+type MissingError struct {
+	Names []string
+}
+
+func (e *MissingError) Error() string {
+	return "no value for " + strings.Join(e.Names, ", ")
+}
+
+// Placeholders returns the variable names used in the strings anywhere
+// within v, sorted
+func Placeholders(v interface{}) []string {
+	seen := make(map[string]bool)
+	walkStrings(v, func(s string) {
+		for _, m := range placeholder.FindAllStringSubmatch(s, -1) {
+			seen[m[1]] = true
+		}
+	})
+	return sortedKeys(seen)
+}
+
+// WithDefaults returns vars plus the defaults of the declared variables
+// it doesn't set
+func WithDefaults(vars map[string]interface{}, declared []Variable) map[string]interface{} {
+	merged := make(map[string]interface{}, len(vars)+len(declared))
+	for _, d := range declared {
+		if d.Default != nil {
+			merged[d.Name] = d.Default
+		}
+	}
+	for k, v := range vars {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Expand returns a copy of v with its placeholders replaced from vars. A
+// string that is exactly one placeholder takes the variable's value as
+// is, so {"seed": "{{seed}}"} can become a number; inside longer text
+// values are formatted as text. Object keys are left alone. If any
+// placeholder has no value it returns a *MissingError naming them all.
+func Expand(v interface{}, vars map[string]interface{}) (interface{}, error) {
+	missing := make(map[string]bool)
+	out := expand(v, vars, missing)
+	if len(missing) > 0 {
+		return nil, &MissingError{Names: sortedKeys(missing)}
+	}
+	return out, nil
+}
+
+func expand(v interface{}, vars map[string]interface{}, missing map[string]bool) interface{} {
+	switch v := v.(type) {
+	case string:
+		return expandString(v, vars, missing)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = expand(item, vars, missing)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = expand(item, vars, missing)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func expandString(s string, vars map[string]interface{}, missing map[string]bool) interface{} {
+	if m := placeholder.FindStringSubmatchIndex(s); m != nil && m[0] == 0 && m[1] == len(s) {
+		name := s[m[2]:m[3]]
+		value, ok := vars[name]
+		if !ok {
+			missing[name] = true
+			return s
+		}
+		return value
+	}
+	return placeholder.ReplaceAllStringFunc(s, func(match string) string {
+		name := placeholder.FindStringSubmatch(match)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing[name] = true
+			return match
+		}
+		return text(value)
+	})
+}
+
+// text formats a variable's value for use inside a string
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+func walkStrings(v interface{}, fn func(string)) {
+	switch v := v.(type) {
+	case string:
+		fn(v)
+	case []interface{}:
+		for _, item := range v {
+			walkStrings(item, fn)
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			walkStrings(item, fn)
+		}
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
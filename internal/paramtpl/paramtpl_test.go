@@ -0,0 +1,78 @@
+package paramtpl
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	params := map[string]interface{}{
+		"prompt": "a {{ subject }} in the style of {{style}}, {{subject}} centered",
+		"seed":   "{{seed}}",
+		"loras":  []interface{}{"{{lora}}", "fixed.safetensors"},
+		"models": map[string]interface{}{"{{key}}": "wan-i2v-high"},
+		"steps":  8,
+	}
+	vars := map[string]interface{}{
+		"subject": "fox",
+		"style":   "ukiyo-e",
+		"seed":    json.Number("12345678901234567"),
+		"lora":    "ink.safetensors",
+	}
+
+	got, err := Expand(params, vars)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	want := map[string]interface{}{
+		"prompt": "a fox in the style of ukiyo-e, fox centered",
+		"seed":   json.Number("12345678901234567"),
+		"loras":  []interface{}{"ink.safetensors", "fixed.safetensors"},
+		"models": map[string]interface{}{"{{key}}": "wan-i2v-high"},
+		"steps":  8,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expand = %#v\nwant %#v", got, want)
+	}
+	if params["prompt"] != "a {{ subject }} in the style of {{style}}, {{subject}} centered" {
+		t.Error("Expand modified its input")
+	}
+}
+
+func TestExpandFormatsValuesInText(t *testing.T) {
+	got, err := Expand("{{n}} frames, {{f}}x, tiled={{b}}", map[string]interface{}{"n": json.Number("81"), "f": 1.5, "b": true})
+	if err != nil || got != "81 frames, 1.5x, tiled=true" {
+		t.Errorf("Expand = %v, %v", got, err)
+	}
+}
+
+func TestExpandMissing(t *testing.T) {
+	_, err := Expand(map[string]interface{}{"prompt": "{{subject}} and {{style}}", "negative": "{{style}}"}, nil)
+	var missing *MissingError
+	if !errors.As(err, &missing) || !reflect.DeepEqual(missing.Names, []string{"style", "subject"}) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestPlaceholdersAndDefaults(t *testing.T) {
+	params := map[string]interface{}{"prompt": "{{subject}}, {{style}}", "loras": []interface{}{"{{lora}}"}, "bad": "{{ not valid }}"}
+	if got := Placeholders(params); !reflect.DeepEqual(got, []string{"lora", "style", "subject"}) {
+		t.Errorf("Placeholders = %v", got)
+	}
+
+	vars := WithDefaults(map[string]interface{}{"style": "noir"}, []Variable{
+		{Name: "style", Default: "watercolor"},
+		{Name: "lora", Default: "ink.safetensors"},
+		{Name: "subject"},
+	})
+	want := map[string]interface{}{"style": "noir", "lora": "ink.safetensors"}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("WithDefaults = %v", vars)
+	}
+
+	if !ValidName("subject_2") || ValidName("2subject") || ValidName("sub-ject") {
+		t.Error("ValidName")
+	}
+}
@@ -0,0 +1,350 @@
+// Package pipeline describes batch pipelines: several jobs submitted as
+// one document, each a step that may wait for others and take their
+// outputs. A step refers to another with {{steps.<id>.output}} or
+// {{steps.<id>.job_id}} in its params, so an image step can feed an I2V
+// step whose clip is then upscaled and joined with others.
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaxSteps bounds how many steps one pipeline has
+const MaxSteps = 50
+
+// Step statuses. A step waits until every step it depends on has
+// completed; it is skipped if any of them fails or is skipped.
+const (
+	StepWaiting   = "waiting"
+	StepQueued    = "queued" // Its job was submitted
+	StepCompleted = "completed"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped"
+)
+
+// Pipeline statuses
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Ref fields: a step's output, passed to workflows as an output reference
+// they resolve to the file, or its job ID, as concat takes
+const (
+	FieldOutput = "output"
+	FieldJobID  = "job_id"
+)
+
+var reference = regexp.MustCompile(`\{\{\s*steps\.([A-Za-z0-9_-]+)\.(output|job_id)\s*\}\}`)
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Spec is a pipeline document
+type Spec struct {
+	Name  string `json:"name,omitempty"`
+	Steps []Step `json:"steps"`
+}
+
+// Step is one job of a pipeline: the params its workflow's submit
+// endpoint takes, plus the steps it waits for
+type Step struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Needs lists steps to wait for beyond those the params refer to
+	Needs  []string               `json:"needs,omitempty"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// Ref is a reference from one step's params to another step
+type Ref struct {
+	Step  string
+	Field string
+}
+
+// IsYAML reports whether a Content-Type names YAML. Anything else is read
+// as JSON.
+func IsYAML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	}
+	return false
+}
+
+// Parse reads a spec from JSON, or from YAML if isYAML is set. YAML goes
+// through JSON so both forms decode alike, numbers included.
+func Parse(data []byte, isYAML bool) (*Spec, error) {
+	if isYAML {
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var spec Spec
+	if err := dec.Decode(&spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Refs returns the references in the strings anywhere within the step's
+// params, in order of step then field
+func (st Step) Refs() []Ref {
+	seen := make(map[Ref]bool)
+	walkStrings(st.Params, func(s string) {
+		for _, m := range reference.FindAllStringSubmatch(s, -1) {
+			seen[Ref{Step: m[1], Field: m[2]}] = true
+		}
+	})
+	refs := make([]Ref, 0, len(seen))
+	for ref := range seen {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Step != refs[j].Step {
+			return refs[i].Step < refs[j].Step
+		}
+		return refs[i].Field < refs[j].Field
+	})
+	return refs
+}
+
+// Deps returns the steps a step waits for: its needs and the steps its
+// params refer to, sorted
+func (st Step) Deps() []string {
+	deps := slices.Clone(st.Needs)
+	for _, ref := range st.Refs() {
+		deps = append(deps, ref.Step)
+	}
+	slices.Sort(deps)
+	return slices.Compact(deps)
+}
+
+// Validate checks the shape of a spec and its dependencies, returning
+// errors by field ("steps[2].needs") or nil. Whether each step's type and
+// params are acceptable is up to its workflow when the step is submitted.
+func (s *Spec) Validate() map[string]string {
+	fieldErrors := make(map[string]string)
+	if len(s.Name) > 200 {
+		fieldErrors["name"] = "too long (max 200 characters)"
+	}
+	if len(s.Steps) == 0 || len(s.Steps) > MaxSteps {
+		fieldErrors["steps"] = fmt.Sprintf("must have between 1 and %d steps", MaxSteps)
+		return fieldErrors
+	}
+
+	ids := make(map[string]bool, len(s.Steps))
+	for i, st := range s.Steps {
+		field := fmt.Sprintf("steps[%d]", i)
+		switch {
+		case !validID.MatchString(st.ID):
+			fieldErrors[field+".id"] = "must be 1-64 letters, digits, '-' or '_'"
+		case ids[st.ID]:
+			fieldErrors[field+".id"] = "duplicate step " + st.ID
+		}
+		ids[st.ID] = true
+		if st.Type == "" {
+			fieldErrors[field+".type"] = "is required"
+		}
+	}
+	for i, st := range s.Steps {
+		field := fmt.Sprintf("steps[%d]", i)
+		for _, dep := range st.Needs {
+			if !ids[dep] || dep == st.ID {
+				fieldErrors[field+".needs"] = "no other step " + dep
+			}
+		}
+		for _, ref := range st.Refs() {
+			if !ids[ref.Step] || ref.Step == st.ID {
+				fieldErrors[field+".params"] = "refers to no other step " + ref.Step
+			}
+		}
+	}
+	if len(fieldErrors) == 0 {
+		if _, err := s.Order(); err != nil {
+			fieldErrors["steps"] = err.Error()
+		}
+	}
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+	return fieldErrors
+}
+
+// Order returns the step IDs with each after every step it depends on,
+// otherwise in spec order, or an error naming the steps of a cycle
+func (s *Spec) Order() ([]string, error) {
+	done := make(map[string]bool, len(s.Steps))
+	order := make([]string, 0, len(s.Steps))
+	for len(order) < len(s.Steps) {
+		progressed := false
+		for _, st := range s.Steps {
+			if done[st.ID] {
+				continue
+			}
+			ready := true
+			for _, dep := range st.Deps() {
+				ready = ready && done[dep]
+			}
+			if ready {
+				done[st.ID] = true
+				order = append(order, st.ID)
+				progressed = true
+			}
+		}
+		if !progressed {
+			var cycle []string
+			for _, st := range s.Steps {
+				if !done[st.ID] {
+					cycle = append(cycle, st.ID)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle among %s", strings.Join(cycle, ", "))
+		}
+	}
+	return order, nil
+}
+
+// Ready returns the waiting steps whose dependencies have all completed,
+// in spec order. status maps step IDs to step statuses.
+func (s *Spec) Ready(status map[string]string) []string {
+	var ready []string
+	for _, st := range s.Steps {
+		if status[st.ID] != StepWaiting {
+			continue
+		}
+		ok := true
+		for _, dep := range st.Deps() {
+			ok = ok && status[dep] == StepCompleted
+		}
+		if ok {
+			ready = append(ready, st.ID)
+		}
+	}
+	return ready
+}
+
+// Blocked returns the waiting steps that can never run because a step
+// they depend on, directly or not, failed or was skipped
+func (s *Spec) Blocked(status map[string]string) []string {
+	settled := make(map[string]string, len(status))
+	for id, st := range status {
+		settled[id] = st
+	}
+	var blocked []string
+	for changed := true; changed; {
+		changed = false
+		for _, st := range s.Steps {
+			if settled[st.ID] != StepWaiting {
+				continue
+			}
+			for _, dep := range st.Deps() {
+				if settled[dep] == StepFailed || settled[dep] == StepSkipped {
+					settled[st.ID] = StepSkipped
+					blocked = append(blocked, st.ID)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return blocked
+}
+
+// Sinks returns the steps no other step depends on, in spec order. Their
+// outputs are the pipeline's.
+func (s *Spec) Sinks() []string {
+	used := make(map[string]bool)
+	for _, st := range s.Steps {
+		for _, dep := range st.Deps() {
+			used[dep] = true
+		}
+	}
+	var sinks []string
+	for _, st := range s.Steps {
+		if !used[st.ID] {
+			sinks = append(sinks, st.ID)
+		}
+	}
+	return sinks
+}
+
+// Status sums up step statuses: running while any step may still run,
+// then failed if any step failed or was skipped
+func Status(steps map[string]string) string {
+	status := StatusCompleted
+	for _, st := range steps {
+		switch st {
+		case StepWaiting, StepQueued:
+			return StatusRunning
+		case StepFailed, StepSkipped:
+			status = StatusFailed
+		}
+	}
+	return status
+}
+
+// Resolve returns a copy of params with each reference replaced by
+// value(ref), wherever it appears in a string. Object keys are left alone.
+func Resolve(params map[string]interface{}, value func(Ref) string) map[string]interface{} {
+	return resolve(params, value).(map[string]interface{})
+}
+
+func resolve(v interface{}, value func(Ref) string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return reference.ReplaceAllStringFunc(v, func(match string) string {
+			m := reference.FindStringSubmatch(match)
+			return value(Ref{Step: m[1], Field: m[2]})
+		})
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = resolve(item, value)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = resolve(item, value)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func walkStrings(v interface{}, fn func(string)) {
+	switch v := v.(type) {
+	case string:
+		fn(v)
+	case []interface{}:
+		for _, item := range v {
+			walkStrings(item, fn)
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			walkStrings(item, fn)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package pipeline
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+const specYAML = `
+name: fox clips
+steps:
+  - id: still
+    type: qwen
+    params:
+      prompt: a fox
+      seed: 42
+  - id: clip
+    type: i2v
+    params:
+      input_image: "{{steps.still.output}}"
+      prompt: the fox runs
+  - id: upscaled
+    type: upscale
+    params:
+      video: "{{ steps.clip.output }}"
+  - id: joined
+    type: concat
+    needs: [still]
+    params:
+      job_ids: ["{{steps.clip.job_id}}", "{{steps.upscaled.job_id}}"]
+`
+
+func TestParse(t *testing.T) {
+	spec, err := Parse([]byte(specYAML), true)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if spec.Name != "fox clips" || len(spec.Steps) != 4 {
+		t.Fatalf("spec = %+v", spec)
+	}
+	// Numbers come through JSON like they would from a JSON document
+	if seed := spec.Steps[0].Params["seed"]; seed != float64(42) {
+		t.Errorf("seed = %#v", seed)
+	}
+	if fieldErrors := spec.Validate(); fieldErrors != nil {
+		t.Errorf("Validate = %v", fieldErrors)
+	}
+
+	if _, err := Parse([]byte(`{"steps": [], "stages": []}`), false); err == nil {
+		t.Error("expected unknown fields to be refused")
+	}
+	if !IsYAML("application/yaml; charset=utf-8") || IsYAML("application/json") || IsYAML("") {
+		t.Error("IsYAML misread content types")
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	spec, _ := Parse([]byte(specYAML), true)
+
+	if deps := spec.Steps[3].Deps(); !slices.Equal(deps, []string{"clip", "still", "upscaled"}) {
+		t.Errorf("deps = %v", deps)
+	}
+	order, err := spec.Order()
+	if err != nil || !slices.Equal(order, []string{"still", "clip", "upscaled", "joined"}) {
+		t.Errorf("Order = %v, %v", order, err)
+	}
+	if sinks := spec.Sinks(); !slices.Equal(sinks, []string{"joined"}) {
+		t.Errorf("Sinks = %v", sinks)
+	}
+
+	status := map[string]string{"still": StepCompleted, "clip": StepWaiting, "upscaled": StepWaiting, "joined": StepWaiting}
+	if ready := spec.Ready(status); !slices.Equal(ready, []string{"clip"}) {
+		t.Errorf("Ready = %v", ready)
+	}
+	if Status(status) != StatusRunning {
+		t.Errorf("Status = %s, want running", Status(status))
+	}
+
+	status["clip"] = StepFailed
+	if blocked := spec.Blocked(status); !slices.Equal(blocked, []string{"upscaled", "joined"}) {
+		t.Errorf("Blocked = %v", blocked)
+	}
+	status["upscaled"], status["joined"] = StepSkipped, StepSkipped
+	if Status(status) != StatusFailed {
+		t.Errorf("Status = %s, want failed", Status(status))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  Spec
+		field string
+	}{
+		{"empty", Spec{}, "steps"},
+		{"bad id", Spec{Steps: []Step{{ID: "a b", Type: "qwen"}}}, "steps[0].id"},
+		{"duplicate id", Spec{Steps: []Step{{ID: "a", Type: "qwen"}, {ID: "a", Type: "qwen"}}}, "steps[1].id"},
+		{"no type", Spec{Steps: []Step{{ID: "a"}}}, "steps[0].type"},
+		{"unknown need", Spec{Steps: []Step{{ID: "a", Type: "qwen", Needs: []string{"b"}}}}, "steps[0].needs"},
+		{"self reference", Spec{Steps: []Step{{ID: "a", Type: "qwen", Params: map[string]interface{}{"prompt": "{{steps.a.job_id}}"}}}}, "steps[0].params"},
+		{"cycle", Spec{Steps: []Step{
+			{ID: "a", Type: "qwen", Needs: []string{"b"}},
+			{ID: "b", Type: "qwen", Needs: []string{"a"}},
+			{ID: "c", Type: "qwen"},
+		}}, "steps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fieldErrors := tt.spec.Validate()
+			if _, ok := fieldErrors[tt.field]; !ok {
+				t.Errorf("Validate = %v, want an error for %s", fieldErrors, tt.field)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	params := map[string]interface{}{
+		"video":   "{{steps.clip.output}}",
+		"job_ids": []interface{}{"{{steps.clip.job_id}}", "fixed"},
+		"prompt":  "after {{ steps.clip.job_id }}",
+		"steps":   8.0,
+	}
+	got := Resolve(params, func(ref Ref) string { return ref.Field + ":" + ref.Step })
+	want := map[string]interface{}{
+		"video":   "output:clip",
+		"job_ids": []interface{}{"job_id:clip", "fixed"},
+		"prompt":  "after job_id:clip",
+		"steps":   8.0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve = %#v\nwant %#v", got, want)
+	}
+	if params["video"] != "{{steps.clip.output}}" {
+		t.Error("Resolve modified its input")
+	}
+}
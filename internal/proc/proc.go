@@ -0,0 +1,49 @@
+// Package proc starts and stops the helper processes diffbox manages
+// (Valkey, aria2 and the Python workers) the same way on every platform.
+//
+// Call Prepare before starting a command and Attach after, then use
+// Terminate to ask it to exit and Kill to force it. On Unix each child
+// gets its own process group, so signals reach anything it spawned (uv
+// runs Python as a child). On Windows each child is placed in a job
+// object, which takes its descendants down with it and is closed if
+// diffbox itself dies.
+package proc
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// ShutdownSignals are the signals that start a graceful shutdown. On
+// Windows, Go reports console close, logoff and system shutdown as
+// SIGTERM.
+var ShutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// Stop asks a started command to exit and waits for it, killing it if it
+// is still running after timeout. Use it only for commands nothing else
+// waits on.
+func Stop(cmd *exec.Cmd, timeout time.Duration) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+
+	if err := Terminate(cmd); err != nil {
+		Kill(cmd)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		Kill(cmd)
+		<-done
+	}
+	Release(cmd)
+}
@@ -0,0 +1,45 @@
+//go:build unix
+
+package proc
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Prepare puts the command in its own process group. Besides letting
+// Terminate reach its children, this keeps a terminal Ctrl-C from hitting
+// the helpers directly, so shutdown can stop them in order.
+func Prepare(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// Attach is a no-op on Unix; the process group set up by Prepare is
+// enough
+func Attach(cmd *exec.Cmd) error {
+	return nil
+}
+
+// Terminate sends SIGTERM to the command's process group
+func Terminate(cmd *exec.Cmd) error {
+	return signalGroup(cmd, syscall.SIGTERM)
+}
+
+// Kill sends SIGKILL to the command's process group
+func Kill(cmd *exec.Cmd) error {
+	return signalGroup(cmd, syscall.SIGKILL)
+}
+
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	pid := cmd.Process.Pid
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		pid = -pid
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// Release frees what Attach set up once a command has exited
+func Release(cmd *exec.Cmd) {}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package proc
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStopReachesChildren(t *testing.T) {
+	// The shell's child stands in for the Python process uv starts
+	cmd := exec.Command("sh", "-c", "sleep 30 & wait")
+	Prepare(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start sh: %v", err)
+	}
+	if err := Attach(cmd); err != nil {
+		t.Fatalf("Attach failed: %v", err)
+	}
+	pgid := cmd.Process.Pid
+
+	start := time.Now()
+	Stop(cmd, 2*time.Second)
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("Stop took %s", time.Since(start))
+	}
+
+	// Give the orphaned sleep a moment to be reaped
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := syscall.Kill(-pgid, 0)
+		if errors.Is(err, syscall.ESRCH) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("process group %d still alive after Stop (err %v)", pgid, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,80 @@
+//go:build windows
+
+package proc
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// jobs holds the job object of each attached command, keyed by PID
+var jobs sync.Map
+
+// Prepare starts the command in a new process group so Terminate can
+// send it CTRL_BREAK without interrupting diffbox, and so a console
+// Ctrl-C doesn't reach it directly
+func Prepare(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= windows.CREATE_NEW_PROCESS_GROUP
+}
+
+// Attach places a started command in a job object that kills the whole
+// process tree when it is terminated or when diffbox exits. Processes the
+// command started before Attach ran are not included.
+func Attach(cmd *exec.Cmd) error {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return fmt.Errorf("create job object: %w", err)
+	}
+
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	if _, err := windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		windows.CloseHandle(job)
+		return fmt.Errorf("configure job object: %w", err)
+	}
+
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return fmt.Errorf("open process: %w", err)
+	}
+	defer windows.CloseHandle(process)
+
+	if err := windows.AssignProcessToJobObject(job, process); err != nil {
+		windows.CloseHandle(job)
+		return fmt.Errorf("assign job object: %w", err)
+	}
+	jobs.Store(cmd.Process.Pid, job)
+	return nil
+}
+
+// Terminate sends CTRL_BREAK to the command's process group, the closest
+// Windows has to SIGTERM for console programs
+func Terminate(cmd *exec.Cmd) error {
+	return windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(cmd.Process.Pid))
+}
+
+// Kill ends the command and everything in its job object
+func Kill(cmd *exec.Cmd) error {
+	if job, ok := jobs.Load(cmd.Process.Pid); ok {
+		return windows.TerminateJobObject(job.(windows.Handle), 1)
+	}
+	return cmd.Process.Kill()
+}
+
+// Release closes the command's job object once it has exited, killing any
+// descendants it left behind
+func Release(cmd *exec.Cmd) {
+	if job, ok := jobs.LoadAndDelete(cmd.Process.Pid); ok {
+		windows.CloseHandle(job.(windows.Handle))
+	}
+}
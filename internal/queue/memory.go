@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// ErrClosed is returned by a MemoryQueue's blocking calls once it's closed
+var ErrClosed = errors.New("queue closed")
+
+// subscriberBuffer is how many messages a slow subscriber can fall behind
+// before new ones are dropped for it, as Redis does for slow clients
+const subscriberBuffer = 256
+
+// MemoryQueue is an in-process Queue for test mode. Streams keep every
+// message and each consumer group reads them once, in order, like Redis
+// streams; messages round-trip through JSON so handlers see the same
+// types they get from Valkey.
+type MemoryQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	streams map[string][]memoryMessage
+	// next message index per stream and consumer group
+	groups map[string]int
+	subs   map[string][]chan []byte
+	seq    int64
+	closed bool
+}
+
+type memoryMessage struct {
+	id   string
+	data []byte
+}
+
+var _ Queue = (*MemoryQueue)(nil)
+
+func NewMemoryQueue() *MemoryQueue {
+	q := &MemoryQueue{
+		streams: make(map[string][]memoryMessage),
+		groups:  make(map[string]int),
+		subs:    make(map[string][]chan []byte),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *MemoryQueue) Ping(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close wakes every consumer and subscriber, which return
+func (q *MemoryQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	for _, subs := range q.subs {
+		for _, ch := range subs {
+			close(ch)
+		}
+	}
+	q.cond.Broadcast()
+	return nil
+}
+
+func (q *MemoryQueue) Enqueue(ctx context.Context, stream string, data interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	q.seq++
+	q.streams[stream] = append(q.streams[stream], memoryMessage{id: fmt.Sprintf("%d-0", q.seq), data: jsonData})
+	q.cond.Broadcast()
+	return nil
+}
+
+// Consume hands each message of the stream to handler once per group,
+// blocking for new ones until the queue closes. A handler error is logged
+// and the message skipped.
+func (q *MemoryQueue) Consume(stream string, group string, consumer string, handler func(id string, data map[string]interface{}) error) error {
+	key := stream + "/" + group
+	for {
+		q.mu.Lock()
+		for !q.closed && q.groups[key] >= len(q.streams[stream]) {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return ErrClosed
+		}
+		message := q.streams[stream][q.groups[key]]
+		q.groups[key]++
+		q.mu.Unlock()
+
+		var data map[string]interface{}
+		if err := json.Unmarshal(message.data, &data); err != nil {
+			log.Printf("ERROR - Failed to unmarshal job data from queue: %v", err)
+			continue
+		}
+		if err := handler(message.id, data); err != nil {
+			log.Printf("ERROR - Failed to process job %s: %v", data["id"], err)
+		}
+	}
+}
+
+func (q *MemoryQueue) Publish(ctx context.Context, channel string, data interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	for _, ch := range q.subs[channel] {
+		select {
+		case ch <- jsonData:
+		default:
+			log.Printf("Queue: dropped a message on %s for a slow subscriber", channel)
+		}
+	}
+	return nil
+}
+
+// Subscribe calls handler with each message published to channel after
+// it subscribed, until the queue closes
+func (q *MemoryQueue) Subscribe(channel string, handler func(data []byte)) error {
+	ch := make(chan []byte, subscriberBuffer)
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrClosed
+	}
+	q.subs[channel] = append(q.subs[channel], ch)
+	q.mu.Unlock()
+
+	for data := range ch {
+		handler(data)
+	}
+	return nil
+}
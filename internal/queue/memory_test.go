@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryQueueConsume(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	if err := q.Enqueue(ctx, "jobs", map[string]interface{}{"id": "a", "steps": 8}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	got := make(chan map[string]interface{}, 4)
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Consume("jobs", "workers", "dispatcher", func(id string, data map[string]interface{}) error {
+			got <- data
+			return nil
+		})
+	}()
+
+	first := <-got
+	// Numbers come back as float64, as they do through Valkey
+	if first["id"] != "a" || first["steps"] != float64(8) {
+		t.Errorf("unexpected message %v", first)
+	}
+
+	// Consumers block until something is enqueued
+	q.Enqueue(ctx, "jobs", map[string]interface{}{"id": "b"})
+	select {
+	case second := <-got:
+		if second["id"] != "b" {
+			t.Errorf("unexpected message %v", second)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("consumer didn't get the second message")
+	}
+
+	q.Close()
+	if err := <-done; !errors.Is(err, ErrClosed) {
+		t.Errorf("Consume returned %v after close, want ErrClosed", err)
+	}
+	if err := q.Enqueue(ctx, "jobs", "late"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Enqueue after close = %v", err)
+	}
+}
+
+func TestMemoryQueueGroups(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	defer q.Close()
+	for _, id := range []string{"a", "b"} {
+		q.Enqueue(ctx, "jobs", map[string]interface{}{"id": id})
+	}
+
+	// Each group sees every message once
+	for _, group := range []string{"workers", "audit"} {
+		seen := make(chan string, 2)
+		go q.Consume("jobs", group, "c", func(id string, data map[string]interface{}) error {
+			seen <- data["id"].(string)
+			return nil
+		})
+		for _, want := range []string{"a", "b"} {
+			if got := <-seen; got != want {
+				t.Errorf("group %s got %s, want %s", group, got, want)
+			}
+		}
+	}
+}
+
+func TestMemoryQueuePubSub(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	received := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Subscribe("events", func(data []byte) { received <- string(data) })
+	}()
+
+	// Wait for the subscription before publishing
+	deadline := time.Now().Add(time.Second)
+	for {
+		q.mu.Lock()
+		n := len(q.subs["events"])
+		q.mu.Unlock()
+		if n == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	q.Publish(ctx, "events", map[string]string{"job": "a"})
+	if got := <-received; got != `{"job":"a"}` {
+		t.Errorf("received %s", got)
+	}
+	q.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Subscribe returned %v after close", err)
+	}
+}
+
+func TestMemoryQueueEnqueueCanceled(t *testing.T) {
+	q := NewMemoryQueue()
+	defer q.Close()
+
+	// A client that hung up before its job was queued leaves nothing behind
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := q.Enqueue(ctx, "jobs", map[string]interface{}{"id": "a"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Enqueue = %v, want context.Canceled", err)
+	}
+	q.mu.Lock()
+	n := len(q.streams["jobs"])
+	q.mu.Unlock()
+	if n != 0 {
+		t.Errorf("expected nothing enqueued, got %d messages", n)
+	}
+}
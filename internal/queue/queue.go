@@ -9,10 +9,13 @@ import (
 )
 
 type Queue interface {
-	Enqueue(stream string, data interface{}) error
+	// Enqueue adds data to a stream. Nothing is added once ctx is done.
+	Enqueue(ctx context.Context, stream string, data interface{}) error
 	Consume(stream string, group string, consumer string, handler func(id string, data map[string]interface{}) error) error
-	Publish(channel string, data interface{}) error
+	Publish(ctx context.Context, channel string, data interface{}) error
 	Subscribe(channel string, handler func(data []byte)) error
+	// Ping checks that the queue backend is reachable
+	Ping(ctx context.Context) error
 	Close() error
 }
 
@@ -39,17 +42,21 @@ func NewRedisQueue(addr string) (*RedisQueue, error) {
 	}, nil
 }
 
+func (q *RedisQueue) Ping(ctx context.Context) error {
+	return q.client.Ping(ctx).Err()
+}
+
 func (q *RedisQueue) Close() error {
 	return q.client.Close()
 }
 
-func (q *RedisQueue) Enqueue(stream string, data interface{}) error {
+func (q *RedisQueue) Enqueue(ctx context.Context, stream string, data interface{}) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	return q.client.XAdd(q.ctx, &redis.XAddArgs{
+	return q.client.XAdd(ctx, &redis.XAddArgs{
 		Stream: stream,
 		Values: map[string]interface{}{
 			"data": string(jsonData),
@@ -101,13 +108,13 @@ func (q *RedisQueue) Consume(stream string, group string, consumer string, handl
 	}
 }
 
-func (q *RedisQueue) Publish(channel string, data interface{}) error {
+func (q *RedisQueue) Publish(ctx context.Context, channel string, data interface{}) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	return q.client.Publish(q.ctx, channel, string(jsonData)).Err()
+	return q.client.Publish(ctx, channel, string(jsonData)).Err()
 }
 
 func (q *RedisQueue) Subscribe(channel string, handler func(data []byte)) error {
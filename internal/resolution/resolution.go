@@ -0,0 +1,135 @@
+// Package resolution is the catalog of output sizes each built-in workflow
+// supports. Wan 2.2 is trained at 480p and 720p and Qwen-Image at about a
+// megapixel in a fixed set of aspect ratios; other sizes run, but produce
+// stretched or garbled output, so requests are checked against it.
+package resolution
+
+import (
+	"fmt"
+	"math"
+)
+
+// Preset is one supported output size
+type Preset struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Aspect string `json:"aspect"` // e.g. "16:9"
+	Label  string `json:"label"`
+}
+
+func (p Preset) String() string {
+	return fmt.Sprintf("%dx%d", p.Width, p.Height)
+}
+
+// Catalog is the presets of one workflow. Default is used when a request
+// omits the size.
+type Catalog struct {
+	Default Preset
+	Presets []Preset
+}
+
+var wanPresets = []Preset{
+	{832, 480, "16:9", "480p landscape"},
+	{480, 832, "9:16", "480p portrait"},
+	{624, 624, "1:1", "480p square"},
+	{960, 544, "16:9", "540p landscape"},
+	{544, 960, "9:16", "540p portrait"},
+	{1280, 720, "16:9", "720p landscape"},
+	{720, 1280, "9:16", "720p portrait"},
+	{960, 960, "1:1", "720p square"},
+}
+
+var qwenPresets = []Preset{
+	{1024, 1024, "1:1", "Square"},
+	{1024, 768, "4:3", "Landscape"},
+	{768, 1024, "3:4", "Portrait"},
+	{1328, 1328, "1:1", "Square HD"},
+	{1664, 928, "16:9", "Widescreen HD"},
+	{928, 1664, "9:16", "Tall HD"},
+	{1472, 1140, "4:3", "Landscape HD"},
+	{1140, 1472, "3:4", "Portrait HD"},
+	{1584, 1056, "3:2", "Photo HD"},
+	{1056, 1584, "2:3", "Photo portrait HD"},
+}
+
+var catalogs = map[string]Catalog{
+	"i2v":  {Default: wanPresets[0], Presets: wanPresets},
+	"svi":  {Default: wanPresets[0], Presets: wanPresets},
+	"qwen": {Default: qwenPresets[0], Presets: qwenPresets},
+}
+
+// For returns the catalog of a job type, and false for types without one
+// (chat and custom workflows)
+func For(jobType string) (Catalog, bool) {
+	c, ok := catalogs[jobType]
+	return c, ok
+}
+
+// Valid reports whether width x height is one of the presets
+func (c Catalog) Valid(width, height int) bool {
+	for _, p := range c.Presets {
+		if p.Width == width && p.Height == height {
+			return true
+		}
+	}
+	return false
+}
+
+// Complete fills in a size given only one side: the other side of the
+// first preset with that side, or of the default if none has it. Sizes
+// with both sides, or neither, are returned as they are.
+func (c Catalog) Complete(width, height int) (int, int) {
+	switch {
+	case width == 0 && height != 0:
+		for _, p := range c.Presets {
+			if p.Height == height {
+				return p.Width, height
+			}
+		}
+		return c.Default.Width, height
+	case height == 0 && width != 0:
+		for _, p := range c.Presets {
+			if p.Width == width {
+				return width, p.Height
+			}
+		}
+		return width, c.Default.Height
+	}
+	return width, height
+}
+
+// sameShape is how far apart, as a log ratio, two aspect ratios can be and
+// still count as the same shape. It groups the rounded sizes of one
+// nominal ratio, such as 832x480 and 1280x720 for 16:9.
+const sameShape = 0.05
+
+// Nearest returns the preset closest to width x height: among the presets
+// with the closest aspect ratio, so the framing survives, the one with the
+// closest pixel count. Sizes that aren't positive snap to the default.
+func (c Catalog) Nearest(width, height int) Preset {
+	if width <= 0 || height <= 0 {
+		return c.Default
+	}
+	aspect := math.Log(float64(width) / float64(height))
+	pixels := math.Log(float64(width * height))
+	aspectDistance := func(p Preset) float64 {
+		return math.Abs(aspect - math.Log(float64(p.Width)/float64(p.Height)))
+	}
+
+	closest := math.Inf(1)
+	for _, p := range c.Presets {
+		closest = math.Min(closest, aspectDistance(p))
+	}
+
+	var best Preset
+	bestPixels := math.Inf(1)
+	for _, p := range c.Presets {
+		if aspectDistance(p) > closest+sameShape {
+			continue
+		}
+		if dp := math.Abs(pixels - math.Log(float64(p.Width*p.Height))); dp < bestPixels {
+			best, bestPixels = p, dp
+		}
+	}
+	return best
+}
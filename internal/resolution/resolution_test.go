@@ -0,0 +1,79 @@
+package resolution
+
+import "testing"
+
+func TestCatalogs(t *testing.T) {
+	for _, jobType := range []string{"i2v", "svi", "qwen"} {
+		c, ok := For(jobType)
+		if !ok {
+			t.Fatalf("expected a catalog for %s", jobType)
+		}
+		if !c.Valid(c.Default.Width, c.Default.Height) {
+			t.Errorf("%s default %s is not in its catalog", jobType, c.Default)
+		}
+	}
+	// Wan's VAE downsamples by 8 and patchifies by 2
+	for _, p := range wanPresets {
+		if p.Width%16 != 0 || p.Height%16 != 0 {
+			t.Errorf("Wan preset %s is not a multiple of 16", p)
+		}
+	}
+	if _, ok := For("chat"); ok {
+		t.Error("chat should have no resolution catalog")
+	}
+}
+
+func TestValid(t *testing.T) {
+	c, _ := For("i2v")
+	if !c.Valid(832, 480) || !c.Valid(480, 832) {
+		t.Error("expected 480p sizes to be valid")
+	}
+	if c.Valid(1920, 1080) || c.Valid(833, 480) {
+		t.Error("expected unsupported sizes to be invalid")
+	}
+}
+
+func TestComplete(t *testing.T) {
+	c, _ := For("i2v")
+	tests := []struct{ width, height, wantWidth, wantHeight int }{
+		{1280, 0, 1280, 720},
+		{0, 832, 480, 832},
+		{0, 700, 832, 700}, // No preset is 700 high
+		{0, 0, 0, 0},
+		{960, 544, 960, 544},
+	}
+	for _, tc := range tests {
+		if w, h := c.Complete(tc.width, tc.height); w != tc.wantWidth || h != tc.wantHeight {
+			t.Errorf("Complete(%d, %d) = %dx%d, want %dx%d", tc.width, tc.height, w, h, tc.wantWidth, tc.wantHeight)
+		}
+	}
+}
+
+func TestNearest(t *testing.T) {
+	wan, _ := For("i2v")
+	qwen, _ := For("qwen")
+
+	tests := []struct {
+		name          string
+		catalog       Catalog
+		width, height int
+		want          string
+	}{
+		{"exact", wan, 960, 544, "960x544"},
+		{"1080p to 720p", wan, 1920, 1080, "1280x720"},
+		{"small landscape", wan, 800, 450, "832x480"},
+		{"portrait", wan, 400, 700, "480x832"},
+		{"square", wan, 1000, 1000, "960x960"},
+		{"missing size", wan, 0, 0, "832x480"},
+		{"qwen widescreen", qwen, 1920, 1080, "1664x928"},
+		{"qwen small square", qwen, 512, 512, "1024x1024"},
+		{"qwen 3:2", qwen, 1500, 1000, "1584x1056"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.catalog.Nearest(tt.width, tt.height).String(); got != tt.want {
+				t.Errorf("Nearest(%d, %d) = %s, want %s", tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+}
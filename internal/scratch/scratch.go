@@ -0,0 +1,121 @@
+// Package scratch gives each job a private temp directory for intermediate
+// files and removes it after the job finishes.
+package scratch
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Manager creates and cleans up per-job scratch directories under a root
+type Manager struct {
+	root  string
+	grace time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*time.Timer // job ID -> scheduled removal
+}
+
+// NewManager creates a manager rooted at root. Directories are removed
+// grace after their job finishes, leaving a window to inspect a failure.
+func NewManager(root string, grace time.Duration) *Manager {
+	return &Manager{
+		root:    root,
+		grace:   grace,
+		pending: make(map[string]*time.Timer),
+	}
+}
+
+// Dir returns the scratch directory path for a job
+func (m *Manager) Dir(jobID string) string {
+	return filepath.Join(m.root, filepath.Base(jobID))
+}
+
+// Create makes a fresh scratch directory for a job and returns its path.
+// A removal still pending from an earlier run of the job, such as one
+// requeued after a restart, is called off.
+func (m *Manager) Create(jobID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if timer, ok := m.pending[jobID]; ok {
+		timer.Stop()
+		delete(m.pending, jobID)
+	}
+	dir := m.Dir(jobID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create scratch dir: %w", err)
+	}
+	return dir, nil
+}
+
+// Release schedules a job's scratch directory for removal after the grace
+// period. Releasing twice or releasing a job without a directory is fine.
+func (m *Manager) Release(jobID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.pending[jobID]; ok {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(m.grace, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		// Create may have called this removal off after it fired
+		if m.pending[jobID] != timer {
+			return
+		}
+		delete(m.pending, jobID)
+		m.remove(jobID)
+	})
+	m.pending[jobID] = timer
+}
+
+// Sweep removes every scratch directory. Jobs don't survive a restart, so
+// anything left at startup is garbage from a crash.
+func (m *Manager) Sweep() error {
+	entries, err := os.ReadDir(m.root)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			m.remove(entry.Name())
+		}
+	}
+	if len(entries) > 0 {
+		log.Printf("Scratch: removed %d leftover job directories", len(entries))
+	}
+	return nil
+}
+
+// Stop removes all directories still waiting out their grace period
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	jobs := make([]string, 0, len(m.pending))
+	for jobID, timer := range m.pending {
+		timer.Stop()
+		jobs = append(jobs, jobID)
+	}
+	m.pending = make(map[string]*time.Timer)
+	m.mu.Unlock()
+
+	for _, jobID := range jobs {
+		m.remove(jobID)
+	}
+}
+
+func (m *Manager) remove(jobID string) {
+	if err := os.RemoveAll(m.Dir(jobID)); err != nil {
+		log.Printf("Scratch: failed to remove %s: %v", m.Dir(jobID), err)
+	}
+}
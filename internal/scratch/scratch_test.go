@@ -0,0 +1,96 @@
+package scratch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreateAndRelease(t *testing.T) {
+	root := t.TempDir()
+	m := NewManager(root, 20*time.Millisecond)
+
+	dir, err := m.Create("job-1")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if dir != filepath.Join(root, "job-1") {
+		t.Errorf("unexpected dir %s", dir)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "frame_0001.png"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Release("job-1")
+	m.Release("job-1")
+
+	// Kept during the grace period
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("expected dir to survive the grace period: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected dir to be removed after the grace period")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCreateCancelsRelease(t *testing.T) {
+	m := NewManager(t.TempDir(), 20*time.Millisecond)
+
+	if _, err := m.Create("job-1"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	m.Release("job-1")
+	dir, err := m.Create("job-1")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("expected the recreated dir to outlive the earlier release: %v", err)
+	}
+}
+
+func TestDirStaysUnderRoot(t *testing.T) {
+	m := NewManager("/scratch", time.Minute)
+	if dir := m.Dir("../../etc"); dir != "/scratch/etc" {
+		t.Errorf("expected job ID to be confined to the root, got %s", dir)
+	}
+}
+
+func TestSweepAndStop(t *testing.T) {
+	root := t.TempDir()
+	m := NewManager(root, time.Hour)
+
+	for _, id := range []string{"old-1", "old-2"} {
+		if _, err := m.Create(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Sweep(); err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("expected sweep to empty the root, found %d entries", len(entries))
+	}
+
+	dir, _ := m.Create("job-1")
+	m.Release("job-1")
+	m.Stop()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("expected Stop to remove released dirs immediately")
+	}
+
+	if err := NewManager(filepath.Join(root, "missing"), time.Minute).Sweep(); err != nil {
+		t.Errorf("expected sweep of a missing root to succeed, got %v", err)
+	}
+}
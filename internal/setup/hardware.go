@@ -0,0 +1,76 @@
+package setup
+
+import (
+	"runtime"
+
+	"github.com/druarnfield/diffbox/internal/gpu"
+	"github.com/druarnfield/diffbox/internal/models"
+)
+
+// fullVariantMinVRAMMB is the smallest GPU that runs the full-precision
+// checkpoints without offloading: a 14B fp16 DiT is about 29 GB before
+// activations
+const fullVariantMinVRAMMB = 46_000
+
+// Hardware is what the wizard shows before the user picks a variant
+type Hardware struct {
+	GPUs  []GPU  `json:"gpus"`
+	CPUs  int    `json:"cpus"`
+	Disks []Disk `json:"disks"`
+}
+
+type GPU struct {
+	Index    int     `json:"index"`
+	Name     string  `json:"name"`
+	MemoryMB float64 `json:"memory_mb"`
+}
+
+// Disk is the filesystem holding one of the configured directories
+type Disk struct {
+	Dir        string `json:"dir"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	TotalBytes uint64 `json:"total_bytes"`
+}
+
+// Detect describes the GPUs in samples and the filesystems holding dirs.
+// Directories whose usage can't be read are left out.
+func Detect(samples []gpu.Sample, diskUsage func(dir string) (free, total uint64, err error), dirs ...string) Hardware {
+	hw := Hardware{GPUs: []GPU{}, CPUs: runtime.NumCPU(), Disks: []Disk{}}
+	for _, s := range samples {
+		hw.GPUs = append(hw.GPUs, GPU{Index: s.Index, Name: s.Name, MemoryMB: s.MemoryTotalMB})
+	}
+	for _, dir := range dirs {
+		free, total, err := diskUsage(dir)
+		if err != nil {
+			continue
+		}
+		hw.Disks = append(hw.Disks, Disk{Dir: dir, FreeBytes: free, TotalBytes: total})
+	}
+	return hw
+}
+
+// Recommend picks the full variant when the largest GPU can hold the
+// full-precision checkpoints, and fp8 otherwise (including when no GPU
+// was found)
+func Recommend(hw Hardware) string {
+	var largest float64
+	for _, g := range hw.GPUs {
+		largest = max(largest, g.MemoryMB)
+	}
+	if largest >= fullVariantMinVRAMMB {
+		return models.VariantFull
+	}
+	return models.VariantQuantized
+}
+
+// DownloadSize is the total size of a built-in workflow's files in a
+// variant
+func DownloadSize(workflow, variant string) int64 {
+	var total int64
+	for _, m := range models.Manifest(models.Selection{Workflows: []string{workflow}, Variant: variant}) {
+		if m.Workflow == workflow {
+			total += m.Size
+		}
+	}
+	return total
+}
@@ -0,0 +1,183 @@
+// Package setup keeps the choices made in the first-run wizard: which
+// workflows to enable, which model variant to download and where models
+// and outputs live. Startup model downloads wait until it is completed.
+package setup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/config"
+	"github.com/druarnfield/diffbox/internal/models"
+)
+
+// configKey is where the state is kept in the config table
+const configKey = "setup"
+
+// State is what the wizard saved
+type State struct {
+	Completed   bool      `json:"completed"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+	// Workflows are the enabled built-in workflows
+	Workflows []string `json:"workflows"`
+	Variant   string   `json:"variant"`
+	// Directories chosen in the wizard, applied at the next start unless
+	// the matching environment variable is set
+	ModelsDir  string `json:"models_dir,omitempty"`
+	OutputsDir string `json:"outputs_dir,omitempty"`
+}
+
+// Selection returns the model selection the state describes. Until setup
+// is completed everything is enabled at full precision.
+func (s State) Selection() models.Selection {
+	if !s.Completed {
+		return models.Selection{}
+	}
+	return models.Selection{Workflows: s.Workflows, Variant: s.Variant}
+}
+
+// Store persists the state; *db.DB implements it
+type Store interface {
+	GetConfig(ctx context.Context, key string) (string, error)
+	SetConfig(ctx context.Context, key, value string) error
+}
+
+// Manager holds the current state and tells listeners when setup completes
+type Manager struct {
+	store Store
+
+	mu       sync.Mutex
+	state    State
+	handlers []func(State)
+}
+
+// Load reads the saved state, which is empty on first boot
+func Load(ctx context.Context, store Store) (*Manager, error) {
+	m := &Manager{store: store}
+	raw, err := store.GetConfig(ctx, configKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load setup state: %w", err)
+	}
+	if err := json.Unmarshal([]byte(raw), &m.state); err != nil {
+		return nil, fmt.Errorf("parse setup state: %w", err)
+	}
+	return m, nil
+}
+
+// State returns the current state
+func (m *Manager) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// OnComplete registers fn to run each time setup is completed, including
+// when it is run again to change the choices
+func (m *Manager) OnComplete(fn func(State)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers = append(m.handlers, fn)
+}
+
+// Complete saves the choices, marks setup completed and notifies the
+// handlers
+func (m *Manager) Complete(ctx context.Context, s State) error {
+	s.Completed = true
+	s.CompletedAt = time.Now().UTC()
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	if err := m.store.SetConfig(ctx, configKey, string(raw)); err != nil {
+		m.mu.Unlock()
+		return fmt.Errorf("save setup state: %w", err)
+	}
+	m.state = s
+	handlers := append([]func(State){}, m.handlers...)
+	m.mu.Unlock()
+
+	for _, fn := range handlers {
+		fn(s)
+	}
+	return nil
+}
+
+// PrepareDir checks that dir is an absolute path to a directory that
+// exists, or can be created, and is writable
+func PrepareDir(dir string) error {
+	if !filepath.IsAbs(dir) {
+		return errors.New("must be an absolute path")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create %s: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, ".diffbox-setup-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
+
+// Environment variables that pin a directory; while set, the wizard can't
+// change it
+const (
+	ModelsDirEnv  = "DIFFBOX_MODELS_DIR"
+	OutputsDirEnv = "DIFFBOX_OUTPUTS_DIR"
+)
+
+// DirLocked reports whether env pins its directory
+func DirLocked(env string) bool {
+	return os.Getenv(env) != ""
+}
+
+// ApplyDirs points cfg at the directories chosen in the wizard, except
+// those pinned by the environment. Call it at startup, before anything
+// uses them.
+func ApplyDirs(cfg *config.Config, s State) error {
+	dirs := []struct {
+		env, chosen string
+		dir         *string
+	}{
+		{ModelsDirEnv, s.ModelsDir, &cfg.ModelsDir},
+		{OutputsDirEnv, s.OutputsDir, &cfg.OutputsDir},
+	}
+	for _, d := range dirs {
+		if d.chosen == "" || d.chosen == *d.dir || DirLocked(d.env) {
+			continue
+		}
+		if err := os.MkdirAll(d.chosen, 0755); err != nil {
+			return err
+		}
+		log.Printf("Setup: using %s from setup for %s", d.chosen, d.env)
+		*d.dir = d.chosen
+	}
+	return nil
+}
+
+// HasModels reports whether dir already holds any built-in model file in
+// either variant, i.e. this isn't a first boot
+func HasModels(dir string) bool {
+	for _, variant := range []string{models.VariantFull, models.VariantQuantized} {
+		for _, m := range models.Manifest(models.Selection{Variant: variant}) {
+			if _, err := os.Stat(filepath.Join(dir, m.Name)); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
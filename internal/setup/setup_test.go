@@ -0,0 +1,109 @@
+package setup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/druarnfield/diffbox/internal/gpu"
+	"github.com/druarnfield/diffbox/internal/models"
+)
+
+type memStore map[string]string
+
+func (s memStore) GetConfig(ctx context.Context, key string) (string, error) {
+	v, ok := s[key]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return v, nil
+}
+
+func (s memStore) SetConfig(ctx context.Context, key, value string) error {
+	s[key] = value
+	return nil
+}
+
+func TestCompletePersists(t *testing.T) {
+	ctx := context.Background()
+	store := memStore{}
+	m, err := Load(ctx, store)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if m.State().Completed {
+		t.Fatal("fresh state is completed")
+	}
+	if sel := m.State().Selection(); sel.Workflows != nil || sel.Variant != "" {
+		t.Errorf("incomplete setup should select everything, got %+v", sel)
+	}
+
+	var notified State
+	m.OnComplete(func(s State) { notified = s })
+	if err := m.Complete(ctx, State{Workflows: []string{"i2v"}, Variant: models.VariantQuantized}); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if !notified.Completed || notified.CompletedAt.IsZero() {
+		t.Errorf("handler got %+v", notified)
+	}
+
+	reloaded, err := Load(ctx, store)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	sel := reloaded.State().Selection()
+	if len(sel.Workflows) != 1 || sel.Workflows[0] != "i2v" || sel.Variant != models.VariantQuantized {
+		t.Errorf("reloaded selection = %+v", sel)
+	}
+}
+
+func TestLoadCorrupt(t *testing.T) {
+	if _, err := Load(context.Background(), memStore{configKey: "{"}); err == nil {
+		t.Error("expected an error for a corrupt state")
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	usage := func(dir string) (uint64, uint64, error) {
+		if dir == "/missing" {
+			return 0, 0, errors.New("no such file")
+		}
+		return 10, 100, nil
+	}
+	tests := []struct {
+		samples []gpu.Sample
+		want    string
+	}{
+		{nil, models.VariantQuantized},
+		{[]gpu.Sample{{MemoryTotalMB: 24564}}, models.VariantQuantized},
+		{[]gpu.Sample{{MemoryTotalMB: 24564}, {Index: 1, MemoryTotalMB: 81559}}, models.VariantFull},
+	}
+	for _, tt := range tests {
+		hw := Detect(tt.samples, usage, "/models", "/missing")
+		if len(hw.Disks) != 1 || hw.Disks[0].Dir != "/models" {
+			t.Errorf("disks = %+v", hw.Disks)
+		}
+		if got := Recommend(hw); got != tt.want {
+			t.Errorf("Recommend(%v) = %s, want %s", tt.samples, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadSize(t *testing.T) {
+	full := DownloadSize("i2v", models.VariantFull)
+	fp8 := DownloadSize("i2v", models.VariantQuantized)
+	if fp8 <= 0 || fp8 >= full {
+		t.Errorf("fp8 i2v download %d should be smaller than full %d", fp8, full)
+	}
+}
+
+func TestPrepareDir(t *testing.T) {
+	if err := PrepareDir("relative/models"); err == nil {
+		t.Error("relative path accepted")
+	}
+	if err := PrepareDir(filepath.Join(t.TempDir(), "models")); err != nil {
+		t.Errorf("PrepareDir: %v", err)
+	}
+}
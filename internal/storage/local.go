@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/druarnfield/diffbox/internal/files"
+)
+
+// Local keeps files in a directory on this host, which may itself be a
+// mounted network share
+type Local struct {
+	dir      string
+	confined bool
+
+	mu   sync.Mutex
+	root *files.Root
+}
+
+var _ Storage = (*Local)(nil)
+
+// NewLocal keeps files in dir, which is created on first write if it
+// doesn't exist. Symlinks are followed wherever they lead, so single
+// model files can live on another disk.
+func NewLocal(dir string) *Local {
+	return &Local{dir: dir}
+}
+
+// Confined returns storage over the same directory that refuses files
+// whose path or symlinks lead out of it, for files served over HTTP
+func (l *Local) Confined() *Local {
+	return &Local{dir: l.dir, confined: true}
+}
+
+func (l *Local) Dir() string {
+	return l.dir
+}
+
+// path maps a name into the directory. ".." segments are collapsed
+// against the root, so they can't climb out of it.
+func (l *Local) path(name string) (string, error) {
+	if strings.ContainsRune(name, 0) || strings.Contains(name, "\\") {
+		return "", ErrOutsideRoot
+	}
+	rel := strings.TrimPrefix(path.Clean("/"+name), "/")
+	return filepath.Join(l.dir, filepath.FromSlash(rel)), nil
+}
+
+// resolver returns the root confined lookups go through, opening it once
+// the directory exists
+func (l *Local) resolver() (*files.Root, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.root == nil {
+		root, err := files.NewRoot(l.dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		l.root = root
+	}
+	return l.root, nil
+}
+
+func (l *Local) LocalPath(name string) (string, error) {
+	if l.confined {
+		root, err := l.resolver()
+		if err != nil {
+			return "", err
+		}
+		return root.Resolve(name)
+	}
+
+	p, err := l.path(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(p); err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return p, nil
+}
+
+func (l *Local) Stat(name string) (fs.FileInfo, error) {
+	p, err := l.LocalPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+func (l *Local) Open(name string) (File, error) {
+	p, err := l.LocalPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// Import moves src into place. Files already written there, as workers
+// and aria2 do, are left alone.
+func (l *Local) Import(name, src string) error {
+	dst, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if sameFile(src, dst) {
+		return nil
+	}
+	return MoveFile(src, dst)
+}
+
+func (l *Local) Remove(name string) error {
+	p, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Glob(pattern string) ([]string, error) {
+	p, err := l.path(pattern)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(p)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		rel, err := filepath.Rel(l.dir, m)
+		if err != nil {
+			continue
+		}
+		names = append(names, filepath.ToSlash(rel))
+	}
+	return names, nil
+}
+
+// sameFile reports whether a and b name one existing file
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ai, bi)
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "models")
+	s := NewLocal(dir)
+
+	if _, err := s.Stat("vae.safetensors"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound before the dir exists, got %v", err)
+	}
+
+	// Workers write straight into Dir, so importing there is a no-op
+	if err := os.MkdirAll(filepath.Join(dir, "qwen_tokenizer"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	written := filepath.Join(dir, "qwen_tokenizer", "vocab.json")
+	if err := os.WriteFile(written, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Import("qwen_tokenizer/vocab.json", written); err != nil {
+		t.Fatalf("Import in place failed: %v", err)
+	}
+
+	// Files from elsewhere are moved in
+	src := filepath.Join(base, "staged.bin")
+	if err := os.WriteFile(src, []byte("weights"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Import("vae.safetensors", src); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Error("expected the imported file to be moved")
+	}
+	if info, err := s.Stat("vae.safetensors"); err != nil || info.Size() != 7 {
+		t.Errorf("Stat = %v, %v", info, err)
+	}
+	if p, err := s.LocalPath("../vae.safetensors"); err != nil || p != filepath.Join(dir, "vae.safetensors") {
+		t.Errorf("LocalPath = %s, %v; expected .. to stay in the dir", p, err)
+	}
+
+	names, err := s.Glob("*.safetensors")
+	if err != nil || !slices.Equal(names, []string{"vae.safetensors"}) {
+		t.Errorf("Glob = %v, %v", names, err)
+	}
+
+	if err := s.Remove("vae.safetensors"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if err := s.Remove("vae.safetensors"); err != nil {
+		t.Errorf("removing a missing file failed: %v", err)
+	}
+}
+
+func TestLocalSymlinks(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "outputs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(dir, "link.txt")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	// Models may be symlinked from another disk...
+	if _, err := NewLocal(dir).Stat("link.txt"); err != nil {
+		t.Errorf("expected an unconfined symlink to be followed, got %v", err)
+	}
+	// ...but served files must stay inside the dir
+	if _, err := NewLocal(dir).Confined().Open("link.txt"); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("expected a confined symlink escape to be rejected, got %v", err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "job.mp4"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewLocal(dir).Confined()
+
+	rec := httptest.NewRecorder()
+	if err := Serve(rec, httptest.NewRequest(http.MethodGet, "/outputs/job.mp4", nil), s, "job.mp4"); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "video/mp4" || rec.Body.String() != "video" {
+		t.Errorf("served %q as %s", rec.Body.String(), ct)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/outputs/sub", nil), s, "sub"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a directory to be ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+// Package storage abstracts where diffbox keeps its models and outputs.
+// Local keeps them in a directory on the GPU host; backends for object
+// stores and network shares implement the same interface, so the
+// downloader, output finalization and file serving don't change with
+// them.
+package storage
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/druarnfield/diffbox/internal/files"
+)
+
+var (
+	// ErrNotFound is returned for names with nothing stored under them
+	ErrNotFound = files.ErrNotFound
+	// ErrOutsideRoot is returned for names that lead out of the storage
+	ErrOutsideRoot = files.ErrOutsideRoot
+)
+
+// Storage holds files under slash-separated names such as
+// "qwen_tokenizer/vocab.json". Tools that read and write files directly
+// (aria2, the workers, ffmpeg) work in Dir and hand finished files over
+// with Import.
+type Storage interface {
+	// Dir is the local directory new files are written to before they
+	// are imported. For Local it is the storage itself.
+	Dir() string
+	// Stat describes a stored file
+	Stat(name string) (fs.FileInfo, error)
+	// Open opens a stored file for reading
+	Open(name string) (File, error)
+	// LocalPath returns a path on this host holding a stored file, for
+	// tools that need one
+	LocalPath(name string) (string, error)
+	// Import moves the finished local file src into storage as name
+	Import(name, src string) error
+	// Remove deletes a stored file. Removing a missing file is not an
+	// error.
+	Remove(name string) error
+	// Glob returns the names matching a path.Match pattern
+	Glob(pattern string) ([]string, error)
+}
+
+// File is an open stored file
+type File interface {
+	io.ReadSeekCloser
+	Stat() (fs.FileInfo, error)
+}
+
+// Serve writes a stored regular file with an explicit content type and
+// range support. Directories are reported as ErrNotFound.
+func Serve(w http.ResponseWriter, r *http.Request, s Storage, name string) error {
+	f, err := s.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return ErrNotFound
+	}
+
+	w.Header().Set("Content-Type", files.ContentType(name))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	return nil
+}
+
+// MoveFile renames src to dst, copying when they are on different
+// filesystems
+func MoveFile(src, dst string) error {
+	// Some model names include a subdirectory
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".partial"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
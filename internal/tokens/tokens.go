@@ -0,0 +1,112 @@
+package tokens
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Supported token providers
+const (
+	HuggingFace = "huggingface"
+	Civitai     = "civitai"
+)
+
+// Identity is the result of checking a token against its provider
+type Identity struct {
+	Valid     bool      `json:"valid"`
+	Username  string    `json:"username,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Validator checks tokens against provider whoami endpoints
+type Validator struct {
+	hfURL      string
+	civitaiURL string
+	httpClient *http.Client
+}
+
+// NewValidator creates a validator for the public provider endpoints
+func NewValidator() *Validator {
+	return &Validator{
+		hfURL:      "https://huggingface.co/api/whoami-v2",
+		civitaiURL: "https://civitai.com/api/v1/me",
+		httpClient: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+}
+
+// SetHFEndpoint checks HuggingFace tokens against a mirror instead of
+// huggingface.co
+func (v *Validator) SetHFEndpoint(endpoint string) {
+	v.hfURL = strings.TrimRight(endpoint, "/") + "/api/whoami-v2"
+}
+
+// Validate checks a token and returns the identity it belongs to. A rejected
+// token is reported as an invalid Identity, not an error; errors are reserved
+// for unknown providers.
+func (v *Validator) Validate(provider, token string) (*Identity, error) {
+	var url string
+	switch provider {
+	case HuggingFace:
+		url = v.hfURL
+	case Civitai:
+		url = v.civitaiURL
+	default:
+		return nil, fmt.Errorf("unknown provider: %s", provider)
+	}
+
+	identity := &Identity{CheckedAt: time.Now()}
+
+	username, err := v.whoami(url, token)
+	if err != nil {
+		identity.Error = err.Error()
+		return identity, nil
+	}
+
+	identity.Valid = true
+	identity.Username = username
+	return identity, nil
+}
+
+func (v *Validator) whoami(url, token string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("provider unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return "", fmt.Errorf("token rejected by provider (status %d)", resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	// HuggingFace reports "name", Civitai reports "username"
+	var body struct {
+		Name     string `json:"name"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+
+	if body.Username != "" {
+		return body.Username, nil
+	}
+	if body.Name != "" {
+		return body.Name, nil
+	}
+	return "", fmt.Errorf("provider returned no username")
+}
@@ -0,0 +1,78 @@
+package tokens
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestValidator(server *httptest.Server) *Validator {
+	return &Validator{
+		hfURL:      server.URL + "/hf",
+		civitaiURL: server.URL + "/civitai",
+		httpClient: server.Client(),
+	}
+}
+
+func TestValidateHuggingFace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/hf" {
+			t.Errorf("expected /hf, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer hf_good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"type": "user", "name": "alice"})
+	}))
+	defer server.Close()
+
+	v := newTestValidator(server)
+
+	identity, err := v.Validate(HuggingFace, "hf_good")
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if !identity.Valid {
+		t.Errorf("expected valid token, got error %q", identity.Error)
+	}
+	if identity.Username != "alice" {
+		t.Errorf("expected username alice, got %s", identity.Username)
+	}
+
+	identity, err = v.Validate(HuggingFace, "hf_bad")
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if identity.Valid {
+		t.Error("expected rejected token to be invalid")
+	}
+	if identity.Error == "" {
+		t.Error("expected error message for rejected token")
+	}
+}
+
+func TestValidateCivitai(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/civitai" {
+			t.Errorf("expected /civitai, got %s", r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 42, "username": "bob"})
+	}))
+	defer server.Close()
+
+	identity, err := newTestValidator(server).Validate(Civitai, "civ_token")
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if !identity.Valid || identity.Username != "bob" {
+		t.Errorf("expected valid identity for bob, got %+v", identity)
+	}
+}
+
+func TestValidateUnknownProvider(t *testing.T) {
+	if _, err := NewValidator().Validate("dropbox", "token"); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+}
@@ -0,0 +1,207 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/druarnfield/diffbox"
+
+// JobIDKey is the span attribute linking spans across the pipeline
+var JobIDKey = attribute.Key("job.id")
+
+// Init installs an OTLP/HTTP tracer provider when enabled. The exporter is
+// configured through the standard OTEL_EXPORTER_OTLP_* environment
+// variables. When disabled the global no-op provider stays in place, so
+// instrumentation costs nothing. The returned function flushes and stops
+// the exporter.
+func Init(ctx context.Context, enabled bool, version string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	if !enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create otlp exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("diffbox"),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	log.Println("Tracing enabled (OTLP/HTTP)")
+	return provider.Shutdown, nil
+}
+
+// Start begins a span under ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End finishes span, recording err if non-nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject serializes the span context in ctx so it can travel with a job
+// through the queue
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
+
+// Extract restores a span context serialized by Inject. It accepts the
+// generic map produced by decoding queue JSON.
+func Extract(ctx context.Context, raw interface{}) context.Context {
+	carrier := propagation.MapCarrier{}
+	switch m := raw.(type) {
+	case map[string]string:
+		for k, v := range m {
+			carrier[k] = v
+		}
+	case map[string]interface{}:
+		for k, v := range m {
+			if s, ok := v.(string); ok {
+				carrier[k] = s
+			}
+		}
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// Middleware creates a server span per HTTP request, named after the
+// matched chi route pattern rather than the raw path
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		route := r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.HTTPRoute(route),
+			semconv.HTTPResponseStatusCode(ww.Status()),
+		)
+		if ww.Status() >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(ww.Status()))
+		}
+	})
+}
+
+// JobTracker keeps the long-lived span of each running job so worker
+// progress can be recorded as per-stage child spans, showing how long a job
+// spent loading models versus denoising versus encoding.
+type JobTracker struct {
+	mu   sync.Mutex
+	jobs map[string]*jobTrace
+}
+
+type jobTrace struct {
+	ctx       context.Context
+	span      trace.Span
+	stage     trace.Span
+	stageName string
+}
+
+func NewJobTracker() *JobTracker {
+	return &JobTracker{jobs: make(map[string]*jobTrace)}
+}
+
+// RecordQueueWait emits a span covering the time a job sat in the queue,
+// from enqueuedAt until now
+func RecordQueueWait(ctx context.Context, jobID string, enqueuedAt time.Time) {
+	if enqueuedAt.IsZero() {
+		return
+	}
+	_, span := otel.Tracer(tracerName).Start(ctx, "queue.wait",
+		trace.WithTimestamp(enqueuedAt),
+		trace.WithAttributes(JobIDKey.String(jobID)),
+	)
+	span.End()
+}
+
+// StartJob opens the span covering a job's execution on a worker
+func (t *JobTracker) StartJob(ctx context.Context, jobID, jobType string) {
+	ctx, span := Start(ctx, "job.run", JobIDKey.String(jobID), attribute.String("job.type", jobType))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.jobs[jobID] = &jobTrace{ctx: ctx, span: span}
+}
+
+// Stage records a stage change, closing the previous stage span
+func (t *JobTracker) Stage(jobID, stage string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	jt, ok := t.jobs[jobID]
+	if !ok || stage == "" || stage == jt.stageName {
+		return
+	}
+	if jt.stage != nil {
+		jt.stage.End()
+	}
+	_, jt.stage = Start(jt.ctx, "job.stage", JobIDKey.String(jobID), attribute.String("job.stage", stage))
+	jt.stageName = stage
+}
+
+// EndJob closes a job's spans, marking them failed if errMsg is set
+func (t *JobTracker) EndJob(jobID, errMsg string) {
+	t.mu.Lock()
+	jt, ok := t.jobs[jobID]
+	delete(t.jobs, jobID)
+	t.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	if jt.stage != nil {
+		jt.stage.End()
+	}
+	if errMsg != "" {
+		jt.span.SetStatus(codes.Error, errMsg)
+	}
+	jt.span.End()
+}
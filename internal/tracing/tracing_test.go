@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestJobTrackerStages(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	tracker := NewJobTracker()
+	tracker.StartJob(context.Background(), "job-1", "i2v")
+	tracker.Stage("job-1", "Loading models")
+	tracker.Stage("job-1", "Loading models") // repeated stage is not a new span
+	tracker.Stage("job-1", "Denoising")
+	tracker.EndJob("job-1", "")
+
+	// Unknown jobs are ignored
+	tracker.Stage("job-2", "Denoising")
+	tracker.EndJob("job-2", "boom")
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 ended spans (2 stages + job), got %d", len(spans))
+	}
+
+	root := spans[len(spans)-1]
+	if root.Name() != "job.run" {
+		t.Errorf("expected job.run to end last, got %s", root.Name())
+	}
+	for _, span := range spans[:2] {
+		if span.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("stage span %s is not a child of job.run", span.Name())
+		}
+	}
+}
+
+func TestInjectExtractRoundTrip(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	if _, err := Init(context.Background(), false, "test"); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	ctx, span := Start(context.Background(), "submit")
+	defer span.End()
+
+	// Simulate the JSON round-trip through the queue
+	carrier := map[string]interface{}{}
+	for k, v := range Inject(ctx) {
+		carrier[k] = v
+	}
+
+	extracted := Extract(context.Background(), carrier)
+	_, child := Start(extracted, "dispatch")
+	defer child.End()
+
+	if child.SpanContext().TraceID() != span.SpanContext().TraceID() {
+		t.Error("expected dispatch span to share the submission trace")
+	}
+}
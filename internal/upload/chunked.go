@@ -0,0 +1,436 @@
+package upload
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultChunkSize is the size of every chunk but the last
+const DefaultChunkSize = 8 << 20
+
+// Unfinished uploads are removed after a day without a chunk, and finished
+// ones a week after completion unless a job that hasn't finished reads
+// them
+const (
+	incompleteTTL = 24 * time.Hour
+	completeTTL   = 7 * 24 * time.Hour
+)
+
+// RefPrefix marks a job param that names a completed upload, e.g.
+// "upload:9f86d081..."
+const RefPrefix = "upload:"
+
+var (
+	// ErrUploadNotFound is returned for unknown or expired upload IDs
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrInvalidUpload is wrapped by every rejection of a bad request, so
+	// callers can tell them apart from storage errors
+	ErrInvalidUpload = errors.New("invalid upload")
+	// ErrIncomplete is returned when completing an upload with chunks
+	// still missing, or using one that hasn't been completed
+	ErrIncomplete = errors.New("upload is incomplete")
+	// ErrChecksum is returned when the assembled file doesn't match the
+	// SHA-256 given at creation
+	ErrChecksum = errors.New("checksum mismatch")
+)
+
+// Session is a chunked upload. Its state lives in the upload's directory,
+// so an interrupted upload can resume after a server restart.
+type Session struct {
+	ID          string    `json:"id"`
+	Filename    string    `json:"filename"`
+	Size        int64     `json:"size"`
+	ChunkSize   int64     `json:"chunk_size"`
+	SHA256      string    `json:"sha256,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+
+	// Received marks the chunks stored so far; not persisted, it's read
+	// back from the chunk files
+	Received []bool `json:"-"`
+}
+
+// Chunks returns how many chunks the upload is split into
+func (s *Session) Chunks() int {
+	return int((s.Size + s.ChunkSize - 1) / s.ChunkSize)
+}
+
+// Missing returns the indexes of chunks not yet received
+func (s *Session) Missing() []int {
+	missing := []int{}
+	for i, ok := range s.Received {
+		if !ok {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// Completed reports whether the upload has been assembled
+func (s *Session) Completed() bool {
+	return !s.CompletedAt.IsZero()
+}
+
+// chunkLength is the exact size chunk i must have
+func (s *Session) chunkLength(i int) int64 {
+	if i == s.Chunks()-1 {
+		return s.Size - int64(i)*s.ChunkSize
+	}
+	return s.ChunkSize
+}
+
+// ChunkStore keeps chunked uploads under a directory, one subdirectory
+// per upload holding session.json, the chunks and, once complete, the
+// assembled file
+type ChunkStore struct {
+	dir       string
+	maxSize   int64
+	chunkSize int64
+	mu        sync.Mutex // serializes session.json updates and assembly
+	inUse     func() (map[string]bool, error)
+}
+
+// NewChunkStore creates a store in dir, which must exist. Uploads larger
+// than maxSize bytes are refused.
+func NewChunkStore(dir string, maxSize int64) *ChunkStore {
+	return &ChunkStore{dir: dir, maxSize: maxSize, chunkSize: DefaultChunkSize}
+}
+
+// SetInUse sets how the store finds the completed uploads that jobs still
+// read, which expiry keeps
+func (c *ChunkStore) SetInUse(inUse func() (map[string]bool, error)) {
+	c.inUse = inUse
+}
+
+// MaxSize returns the largest upload accepted
+func (c *ChunkStore) MaxSize() int64 {
+	return c.maxSize
+}
+
+// Create starts an upload of size bytes. sha256, if given, is checked
+// against the assembled file.
+func (c *ChunkStore) Create(filename string, size int64, sha string) (*Session, error) {
+	filename = filepath.Base(strings.TrimSpace(filename))
+	switch {
+	case filename == "." || filename == string(filepath.Separator) || filename == "":
+		return nil, invalidUpload("filename is required")
+	case size <= 0:
+		return nil, invalidUpload("size must be positive")
+	case size > c.maxSize:
+		return nil, invalidUpload("size exceeds the %d MB upload limit", c.maxSize>>20)
+	case sha != "" && (len(sha) != sha256.Size*2 || !isHex(sha)):
+		return nil, invalidUpload("sha256 must be 64 hex characters")
+	}
+	c.Expire()
+
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	s := &Session{
+		ID:        id,
+		Filename:  filename,
+		Size:      size,
+		ChunkSize: c.chunkSize,
+		SHA256:    strings.ToLower(sha),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := os.MkdirAll(c.uploadDir(id), 0755); err != nil {
+		return nil, err
+	}
+	if err := c.save(s); err != nil {
+		return nil, err
+	}
+	s.Received = make([]bool, s.Chunks())
+	return s, nil
+}
+
+// Get returns an upload with the chunks received so far
+func (c *ChunkStore) Get(id string) (*Session, error) {
+	if !validUploadID(id) {
+		return nil, ErrUploadNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(c.uploadDir(id), "session.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("read upload %s: %w", id, err)
+	}
+
+	s.Received = make([]bool, s.Chunks())
+	for i := range s.Received {
+		if s.Completed() {
+			s.Received[i] = true
+			continue
+		}
+		info, err := os.Stat(c.chunkPath(id, i))
+		s.Received[i] = err == nil && info.Size() == s.chunkLength(i)
+	}
+	return &s, nil
+}
+
+// PutChunk stores chunk index of an upload. Chunks may arrive in any
+// order and be resent; each must be exactly the session's chunk size
+// except the last, which holds the remainder.
+func (c *ChunkStore) PutChunk(id string, index int, r io.Reader) (*Session, error) {
+	s, err := c.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if s.Completed() {
+		return nil, invalidUpload("upload is already complete")
+	}
+	if index < 0 || index >= s.Chunks() {
+		return nil, invalidUpload("chunk %d is out of range (upload has %d)", index, s.Chunks())
+	}
+
+	want := s.chunkLength(index)
+	tmp, err := os.CreateTemp(c.uploadDir(id), ".chunk-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, io.LimitReader(r, want+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n != want {
+		return nil, invalidUpload("chunk %d must be %d bytes, got %d", index, want, n)
+	}
+	if err := os.Rename(tmp.Name(), c.chunkPath(id, index)); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	s.UpdatedAt = time.Now()
+	err = c.save(s)
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.Received[index] = true
+	return s, nil
+}
+
+// Complete assembles the chunks in order into the final file, checks its
+// size and checksum, and removes the chunks. Completing twice is fine.
+func (c *ChunkStore) Complete(id string) (*Session, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, err := c.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if s.Completed() {
+		return s, nil
+	}
+	if missing := s.Missing(); len(missing) > 0 {
+		return s, fmt.Errorf("%w: %d of %d chunks missing", ErrIncomplete, len(missing), s.Chunks())
+	}
+
+	tmp, err := os.CreateTemp(c.uploadDir(id), ".assemble-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	for i := 0; i < s.Chunks(); i++ {
+		if err := appendChunk(io.MultiWriter(tmp, hash), c.chunkPath(id, i)); err != nil {
+			tmp.Close()
+			return nil, err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); s.SHA256 != "" && sum != s.SHA256 {
+		return s, fmt.Errorf("%w: assembled file has sha256 %s", ErrChecksum, sum)
+	}
+	if err := os.Rename(tmp.Name(), c.filePath(s)); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < s.Chunks(); i++ {
+		os.Remove(c.chunkPath(id, i))
+	}
+	s.CompletedAt = time.Now()
+	s.UpdatedAt = s.CompletedAt
+	if err := c.save(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the assembled file of a completed upload
+func (c *ChunkStore) Path(id string) (string, error) {
+	s, err := c.Get(id)
+	if err != nil {
+		return "", err
+	}
+	if !s.Completed() {
+		return "", ErrIncomplete
+	}
+	return c.filePath(s), nil
+}
+
+// Delete removes an upload and everything stored for it
+func (c *ChunkStore) Delete(id string) error {
+	if _, err := c.Get(id); err != nil {
+		return err
+	}
+	return os.RemoveAll(c.uploadDir(id))
+}
+
+// IDForPath returns the upload whose completed file is at path, and false
+// if path isn't one
+func (c *ChunkStore) IDForPath(path string) (string, bool) {
+	dir, err := filepath.Abs(c.dir)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return "", false
+	}
+	id, file, ok := strings.Cut(filepath.ToSlash(rel), "/")
+	if !ok || !validUploadID(id) || strings.Contains(file, "/") {
+		return "", false
+	}
+	return id, true
+}
+
+// Expire removes unfinished uploads idle for a day and finished ones a
+// week old that no unfinished job reads, returning how many went
+func (c *ChunkStore) Expire() int {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return 0
+	}
+
+	var inUse map[string]bool
+	keepCompleted := false
+	if c.inUse != nil {
+		if inUse, err = c.inUse(); err != nil {
+			// Better to keep them all than remove one a job needs
+			log.Printf("Uploads: failed to find uploads in use, keeping completed ones: %v", err)
+			keepCompleted = true
+		}
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		s, err := c.Get(entry.Name())
+		if err != nil {
+			continue
+		}
+		ttl := incompleteTTL
+		if s.Completed() {
+			if keepCompleted || inUse[s.ID] {
+				continue
+			}
+			ttl = completeTTL
+		}
+		if time.Since(s.UpdatedAt) < ttl {
+			continue
+		}
+		if err := os.RemoveAll(c.uploadDir(s.ID)); err != nil {
+			log.Printf("Uploads: failed to remove expired upload %s: %v", s.ID, err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("Uploads: removed %d expired uploads", removed)
+	}
+	return removed
+}
+
+// ParseRef returns the upload ID a param refers to, and false if it isn't
+// an upload reference
+func ParseRef(s string) (string, bool) {
+	if !strings.HasPrefix(s, RefPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(s, RefPrefix), true
+}
+
+func invalidUpload(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidUpload, fmt.Sprintf(format, args...))
+}
+
+func (c *ChunkStore) save(s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(c.uploadDir(s.ID), "session.json")
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (c *ChunkStore) uploadDir(id string) string {
+	return filepath.Join(c.dir, id)
+}
+
+func (c *ChunkStore) chunkPath(id string, index int) string {
+	return filepath.Join(c.uploadDir(id), fmt.Sprintf("chunk-%06d", index))
+}
+
+// filePath keeps the client's extension so consumers can tell the format
+func (c *ChunkStore) filePath(s *Session) string {
+	return filepath.Join(c.uploadDir(s.ID), "file"+strings.ToLower(filepath.Ext(s.Filename)))
+}
+
+func appendChunk(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validUploadID keeps IDs from reaching the filesystem unless they have
+// the shape newUploadID produces
+func validUploadID(id string) bool {
+	return len(id) == 32 && isHex(id)
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,174 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestChunkStore(t *testing.T) *ChunkStore {
+	t.Helper()
+	c := NewChunkStore(t.TempDir(), 1<<20)
+	c.chunkSize = 10
+	return c
+}
+
+func TestChunkedUpload(t *testing.T) {
+	c := newTestChunkStore(t)
+	data := []byte("0123456789abcdefghij_tail")
+	sum := sha256.Sum256(data)
+
+	s, err := c.Create("../clip.MP4", int64(len(data)), hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if s.Chunks() != 3 || s.Filename != "clip.MP4" {
+		t.Fatalf("unexpected session %+v", s)
+	}
+
+	// Out of order, with a resend, as a resuming client might
+	for _, i := range []int{2, 0, 0} {
+		end := min((i+1)*10, len(data))
+		if _, err := c.PutChunk(s.ID, i, bytes.NewReader(data[i*10:end])); err != nil {
+			t.Fatalf("PutChunk(%d) failed: %v", i, err)
+		}
+	}
+	if _, err := c.PutChunk(s.ID, 1, bytes.NewReader([]byte("short"))); err == nil {
+		t.Error("expected a short chunk to be refused")
+	}
+	if _, err := c.PutChunk(s.ID, 3, bytes.NewReader(nil)); err == nil {
+		t.Error("expected an out of range chunk to be refused")
+	}
+
+	// State survives in the upload directory
+	s, err = c.Get(s.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if missing := s.Missing(); len(missing) != 1 || missing[0] != 1 {
+		t.Errorf("expected chunk 1 missing, got %v", missing)
+	}
+	if _, err := c.Complete(s.ID); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("expected ErrIncomplete, got %v", err)
+	}
+	if _, err := c.Path(s.ID); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("expected incomplete upload to have no path, got %v", err)
+	}
+
+	if _, err := c.PutChunk(s.ID, 1, bytes.NewReader(data[10:20])); err != nil {
+		t.Fatalf("PutChunk(1) failed: %v", err)
+	}
+	s, err = c.Complete(s.ID)
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if !s.Completed() {
+		t.Error("expected upload to be complete")
+	}
+
+	path, err := c.Path(s.ID)
+	if err != nil {
+		t.Fatalf("Path failed: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("assembled file = %q, %v", got, err)
+	}
+	if _, err := os.Stat(c.chunkPath(s.ID, 0)); !os.IsNotExist(err) {
+		t.Error("expected chunks to be removed after assembly")
+	}
+
+	if err := c.Delete(s.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := c.Get(s.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("expected ErrUploadNotFound after delete, got %v", err)
+	}
+}
+
+func TestChunkedUploadChecksum(t *testing.T) {
+	c := newTestChunkStore(t)
+	s, err := c.Create("a.bin", 5, hex.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := c.PutChunk(s.ID, 0, bytes.NewReader([]byte("hello"))); err != nil {
+		t.Fatalf("PutChunk failed: %v", err)
+	}
+	if _, err := c.Complete(s.ID); !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected ErrChecksum, got %v", err)
+	}
+}
+
+func TestChunkedUploadLimitsAndExpiry(t *testing.T) {
+	c := newTestChunkStore(t)
+	for _, tc := range []struct {
+		name string
+		size int64
+		sha  string
+	}{
+		{"", 5, ""},
+		{"a.bin", 0, ""},
+		{"a.bin", 2 << 20, ""},
+		{"a.bin", 5, "not-hex"},
+	} {
+		if _, err := c.Create(tc.name, tc.size, tc.sha); err == nil {
+			t.Errorf("expected Create(%q, %d, %q) to fail", tc.name, tc.size, tc.sha)
+		}
+	}
+	if _, err := c.Get("../../etc"); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("expected invalid ID to be not found, got %v", err)
+	}
+
+	s, err := c.Create("a.bin", 5, "")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	s.UpdatedAt = time.Now().Add(-2 * incompleteTTL)
+	if err := c.save(s); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if n := c.Expire(); n != 1 {
+		t.Errorf("expected 1 expired upload, got %d", n)
+	}
+	if _, err := c.Get(s.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("expected expired upload to be gone, got %v", err)
+	}
+
+	// A completed upload a job still reads outlives its TTL
+	s, err = c.Create("a.bin", 5, "")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := c.PutChunk(s.ID, 0, bytes.NewReader([]byte("hello"))); err != nil {
+		t.Fatalf("PutChunk failed: %v", err)
+	}
+	if s, err = c.Complete(s.ID); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	path, _ := c.Path(s.ID)
+	abs, _ := filepath.Abs(path)
+	if id, ok := c.IDForPath(abs); !ok || id != s.ID {
+		t.Errorf("IDForPath(%s) = %q, %v", abs, id, ok)
+	}
+	if _, ok := c.IDForPath("/etc/passwd"); ok {
+		t.Error("expected a path outside the store not to be an upload")
+	}
+	s.UpdatedAt = time.Now().Add(-2 * completeTTL)
+	if err := c.save(s); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	c.SetInUse(func() (map[string]bool, error) { return map[string]bool{s.ID: true}, nil })
+	if n := c.Expire(); n != 0 {
+		t.Errorf("expected the upload in use to be kept, %d expired", n)
+	}
+	c.SetInUse(nil)
+	if n := c.Expire(); n != 1 {
+		t.Errorf("expected the unused upload to expire, %d expired", n)
+	}
+}
@@ -0,0 +1,108 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Dimension limits for input images. The workflows resize internally, so
+// anything outside this range is either a mistake or an attempt to make the
+// worker allocate an absurd amount of memory.
+const (
+	MinImageDimension = 64
+	MaxImageDimension = 8192
+	MaxImagePixels    = 40_000_000
+)
+
+// allowedFormats maps sniffed MIME types to the image package format names
+var allowedFormats = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpeg",
+	"image/webp": "webp",
+}
+
+// ImageInfo describes a validated image
+type ImageInfo struct {
+	Format string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// ErrInvalidImage is wrapped by every validation failure so callers can
+// tell bad input apart from internal errors
+var ErrInvalidImage = errors.New("invalid image")
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidImage, fmt.Sprintf(format, args...))
+}
+
+// DecodeBase64Image decodes a base64 image (optionally a data: URL) and
+// validates it with ValidateImage
+func DecodeBase64Image(encoded string) (*ImageInfo, error) {
+	if strings.HasPrefix(encoded, "data:") {
+		comma := strings.IndexByte(encoded, ',')
+		if comma < 0 {
+			return nil, invalid("malformed data URL")
+		}
+		encoded = encoded[comma+1:]
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, invalid("not valid base64")
+	}
+
+	return ValidateImage(data)
+}
+
+// ValidateImage checks that data is a PNG, JPEG or WebP whose content
+// matches its magic bytes, whose dimensions are sane, and which fully
+// decodes. Disguised or truncated files are rejected before they reach a
+// worker.
+func ValidateImage(data []byte) (*ImageInfo, error) {
+	if len(data) == 0 {
+		return nil, invalid("empty image")
+	}
+
+	mimeType := http.DetectContentType(data)
+	format, ok := allowedFormats[mimeType]
+	if !ok {
+		return nil, invalid("unsupported type %s (must be PNG, JPEG, or WebP)", mimeType)
+	}
+
+	// Check dimensions from the header before paying for a full decode
+	cfg, decodedFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, invalid("cannot read %s header: %v", format, err)
+	}
+	if decodedFormat != format {
+		return nil, invalid("content is %s but header decodes as %s", format, decodedFormat)
+	}
+	if cfg.Width < MinImageDimension || cfg.Height < MinImageDimension {
+		return nil, invalid("image is %dx%d (minimum %dx%d)", cfg.Width, cfg.Height, MinImageDimension, MinImageDimension)
+	}
+	if cfg.Width > MaxImageDimension || cfg.Height > MaxImageDimension || cfg.Width*cfg.Height > MaxImagePixels {
+		return nil, invalid("image is %dx%d (maximum %d per side, %d pixels)", cfg.Width, cfg.Height, MaxImageDimension, MaxImagePixels)
+	}
+
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		return nil, invalid("corrupt %s data: %v", format, err)
+	}
+
+	return &ImageInfo{
+		Format: format,
+		Width:  cfg.Width,
+		Height: cfg.Height,
+		Data:   data,
+	}, nil
+}
@@ -0,0 +1,90 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidateImagePNG(t *testing.T) {
+	info, err := ValidateImage(encodePNG(t, 128, 96))
+	if err != nil {
+		t.Fatalf("expected valid png, got %v", err)
+	}
+	if info.Format != "png" || info.Width != 128 || info.Height != 96 {
+		t.Errorf("unexpected info: %+v", info)
+	}
+}
+
+func TestValidateImageJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 100, 100)), nil); err != nil {
+		t.Fatalf("failed to encode jpeg: %v", err)
+	}
+
+	info, err := ValidateImage(buf.Bytes())
+	if err != nil {
+		t.Fatalf("expected valid jpeg, got %v", err)
+	}
+	if info.Format != "jpeg" {
+		t.Errorf("expected jpeg, got %s", info.Format)
+	}
+}
+
+func TestValidateImageRejects(t *testing.T) {
+	valid := encodePNG(t, 128, 128)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"text disguised as image", []byte("#!/bin/sh\nrm -rf /\n")},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;")},
+		{"truncated png", valid[:len(valid)/2]},
+		{"too small", encodePNG(t, 16, 16)},
+		{"too large", encodePNG(t, MaxImageDimension+1, 64)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateImage(tt.data)
+			if err == nil {
+				t.Fatal("expected validation error")
+			}
+			if !errors.Is(err, ErrInvalidImage) {
+				t.Errorf("expected ErrInvalidImage, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeBase64Image(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(encodePNG(t, 64, 64))
+
+	if _, err := DecodeBase64Image(encoded); err != nil {
+		t.Errorf("expected plain base64 to validate, got %v", err)
+	}
+	if _, err := DecodeBase64Image("data:image/png;base64," + encoded); err != nil {
+		t.Errorf("expected data URL to validate, got %v", err)
+	}
+	if _, err := DecodeBase64Image("not base64!!"); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("expected ErrInvalidImage for bad base64, got %v", err)
+	}
+}
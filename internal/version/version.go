@@ -0,0 +1,32 @@
+// Package version reports which build of diffbox is running.
+package version
+
+import "runtime/debug"
+
+// Version is the release version, set at build time with
+// -ldflags "-X github.com/druarnfield/diffbox/internal/version.Version=v1.2.3"
+var Version = "dev"
+
+// Commit returns the VCS revision the binary was built from, suffixed
+// with "-dirty" if the tree had uncommitted changes. It is empty when the
+// build carries no VCS information, e.g. under go run.
+func Commit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var revision string
+	var modified bool
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if revision != "" && modified {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,342 @@
+// Package video joins video clips into one file with ffmpeg, optionally
+// crossfading between them. Clips that already match are joined without
+// re-encoding.
+package video
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Clip is a video file and the properties of its video stream
+type Clip struct {
+	Path     string
+	Duration float64 // Seconds
+	Width    int
+	Height   int
+	FPS      float64
+	Codec    string
+}
+
+// Encoding settings for re-encoding the joined video. Zero values take
+// the defaults.
+type Encoding struct {
+	// Codec is h264 (default) or h265
+	Codec string `json:"codec,omitempty"`
+	// CRF is the constant rate factor, 0-51; lower is better quality
+	CRF *int `json:"crf,omitempty"`
+	// Preset is an x264/x265 preset such as fast or slow
+	Preset string `json:"preset,omitempty"`
+	// FPS resamples the output; the first clip's rate by default
+	FPS float64 `json:"fps,omitempty"`
+}
+
+// Defaults used when re-encoding
+const (
+	DefaultCodec  = "h264"
+	DefaultCRF    = 18
+	DefaultPreset = "medium"
+)
+
+// MaxFPS bounds Encoding.FPS
+const MaxFPS = 120
+
+var encoders = map[string]string{
+	"h264": "libx264",
+	"h265": "libx265",
+}
+
+var presets = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow"}
+
+// Validate checks the settings, returning an error naming the bad one
+func (e Encoding) Validate() error {
+	if e.Codec != "" {
+		if _, ok := encoders[e.Codec]; !ok {
+			return fmt.Errorf("codec must be h264 or h265")
+		}
+	}
+	if e.CRF != nil && (*e.CRF < 0 || *e.CRF > 51) {
+		return fmt.Errorf("crf must be between 0 and 51")
+	}
+	if e.Preset != "" && !slices.Contains(presets, e.Preset) {
+		return fmt.Errorf("preset must be one of %s", strings.Join(presets, ", "))
+	}
+	if e.FPS < 0 || e.FPS > MaxFPS {
+		return fmt.Errorf("fps must be between 0 and %d", MaxFPS)
+	}
+	return nil
+}
+
+// Options controls how clips are joined
+type Options struct {
+	// Crossfade is the overlap between consecutive clips in seconds; 0
+	// cuts straight from one to the next
+	Crossfade float64
+	// Encoding forces a re-encode with these settings. Without it clips
+	// are copied unless they differ or are crossfaded.
+	Encoding *Encoding
+}
+
+// Check reports whether clips can be joined with opts
+func Check(clips []Clip, opts Options) error {
+	if len(clips) < 2 {
+		return errors.New("at least two clips are needed")
+	}
+	if opts.Crossfade < 0 {
+		return errors.New("crossfade must not be negative")
+	}
+	for _, c := range clips {
+		if opts.Crossfade > 0 && opts.Crossfade >= c.Duration {
+			return fmt.Errorf("crossfade of %gs is not shorter than %s (%.2fs)", opts.Crossfade, filepath.Base(c.Path), c.Duration)
+		}
+	}
+	if opts.Encoding != nil {
+		return opts.Encoding.Validate()
+	}
+	return nil
+}
+
+// Reencodes reports whether joining clips with opts needs a re-encode:
+// when asked for, to crossfade, or because the clips' streams differ
+func Reencodes(clips []Clip, opts Options) bool {
+	if opts.Encoding != nil || opts.Crossfade > 0 {
+		return true
+	}
+	for _, c := range clips[1:] {
+		first := clips[0]
+		if c.Codec != first.Codec || c.Width != first.Width || c.Height != first.Height || c.FPS != first.FPS {
+			return true
+		}
+	}
+	return false
+}
+
+// Duration is the length of the joined video in seconds
+func Duration(clips []Clip, crossfade float64) float64 {
+	var total float64
+	for _, c := range clips {
+		total += c.Duration
+	}
+	return total - crossfade*float64(len(clips)-1)
+}
+
+// Args builds the ffmpeg arguments that join clips into output. A copy
+// join reads the clips through the concat demuxer from listFile, which
+// must hold ConcatList(clips); re-encodes don't use it. Audio is dropped:
+// generated clips have none.
+func Args(clips []Clip, listFile, output string, opts Options) []string {
+	args := []string{"-y", "-loglevel", "error", "-nostats", "-progress", "pipe:1"}
+	if !Reencodes(clips, opts) {
+		args = append(args, "-f", "concat", "-safe", "0", "-i", listFile, "-map", "0:v", "-c", "copy")
+		return append(args, "-an", "-movflags", "+faststart", output)
+	}
+
+	enc := Encoding{Codec: DefaultCodec, Preset: DefaultPreset}
+	crf := DefaultCRF
+	if opts.Encoding != nil {
+		if opts.Encoding.Codec != "" {
+			enc.Codec = opts.Encoding.Codec
+		}
+		if opts.Encoding.CRF != nil {
+			crf = *opts.Encoding.CRF
+		}
+		if opts.Encoding.Preset != "" {
+			enc.Preset = opts.Encoding.Preset
+		}
+		enc.FPS = opts.Encoding.FPS
+	}
+	if enc.FPS == 0 {
+		enc.FPS = clips[0].FPS
+	}
+
+	for _, c := range clips {
+		args = append(args, "-i", c.Path)
+	}
+	args = append(args, "-filter_complex", filterGraph(clips, enc.FPS, opts.Crossfade), "-map", "[out]")
+	args = append(args,
+		"-c:v", encoders[enc.Codec],
+		"-crf", strconv.Itoa(crf),
+		"-preset", enc.Preset,
+		"-pix_fmt", "yuv420p",
+	)
+	if enc.Codec == "h265" {
+		// Lets Apple players recognise HEVC in MP4
+		args = append(args, "-tag:v", "hvc1")
+	}
+	return append(args, "-an", "-movflags", "+faststart", output)
+}
+
+// filterGraph brings every clip to the first one's size and the output
+// frame rate, then joins them with xfade or concat
+func filterGraph(clips []Clip, fps, crossfade float64) string {
+	w, h := clips[0].Width, clips[0].Height
+	var parts []string
+	for i := range clips {
+		parts = append(parts, fmt.Sprintf(
+			"[%d:v]scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=%s,format=yuv420p[v%d]",
+			i, w, h, w, h, formatFloat(fps), i))
+	}
+
+	if crossfade <= 0 {
+		var inputs string
+		for i := range clips {
+			inputs += fmt.Sprintf("[v%d]", i)
+		}
+		parts = append(parts, fmt.Sprintf("%sconcat=n=%d:v=1:a=0[out]", inputs, len(clips)))
+		return strings.Join(parts, ";")
+	}
+
+	// Each fade starts crossfade seconds before the end of what's joined
+	// so far, which then grows by the next clip less the overlap
+	prev, length := "[v0]", clips[0].Duration
+	for i := 1; i < len(clips); i++ {
+		out := fmt.Sprintf("[x%d]", i)
+		if i == len(clips)-1 {
+			out = "[out]"
+		}
+		parts = append(parts, fmt.Sprintf("%s[v%d]xfade=transition=fade:duration=%s:offset=%s%s",
+			prev, i, formatFloat(crossfade), formatFloat(length-crossfade), out))
+		prev, length = out, length+clips[i].Duration-crossfade
+	}
+	return strings.Join(parts, ";")
+}
+
+// ConcatList is the concat demuxer list of clips
+func ConcatList(clips []Clip) string {
+	var b strings.Builder
+	for _, c := range clips {
+		// Single quotes are closed, escaped and reopened
+		fmt.Fprintf(&b, "file '%s'\n", strings.ReplaceAll(c.Path, "'", `'\''`))
+	}
+	return b.String()
+}
+
+// Join runs ffmpeg to join clips into output, reporting progress from 0
+// to 1. A partial output is removed on failure.
+func Join(ctx context.Context, clips []Clip, output string, opts Options, onProgress func(float64)) error {
+	if err := Check(clips, opts); err != nil {
+		return err
+	}
+	listFile := output + ".list.txt"
+	if err := os.WriteFile(listFile, []byte(ConcatList(clips)), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(listFile)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", Args(clips, listFile, output, opts)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	readProgress(stdout, Duration(clips, opts.Crossfade), onProgress)
+	if err := cmd.Wait(); err != nil {
+		os.Remove(output)
+		return fmt.Errorf("ffmpeg: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// readProgress follows ffmpeg's -progress output, reporting the share of
+// total seconds written
+func readProgress(r io.Reader, total float64, onProgress func(float64)) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		// out_time_ms is in microseconds too, despite the name
+		if !ok || (key != "out_time_us" && key != "out_time_ms") || total <= 0 {
+			continue
+		}
+		us, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || us < 0 {
+			continue
+		}
+		onProgress(min(float64(us)/1e6/total, 1))
+	}
+}
+
+// Probe reads a clip's duration and video stream with ffprobe
+func Probe(ctx context.Context, path string) (Clip, error) {
+	out, err := exec.CommandContext(ctx, "ffprobe", "-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=codec_name,width,height,avg_frame_rate:format=duration",
+		"-of", "json", path,
+	).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return Clip{}, fmt.Errorf("ffprobe %s: %s", filepath.Base(path), bytes.TrimSpace(exitErr.Stderr))
+		}
+		return Clip{}, fmt.Errorf("ffprobe: %w", err)
+	}
+	return parseProbe(path, out)
+}
+
+func parseProbe(path string, out []byte) (Clip, error) {
+	var probe struct {
+		Streams []struct {
+			CodecName    string `json:"codec_name"`
+			Width        int    `json:"width"`
+			Height       int    `json:"height"`
+			AvgFrameRate string `json:"avg_frame_rate"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return Clip{}, fmt.Errorf("parse ffprobe output: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return Clip{}, fmt.Errorf("%s has no video stream", filepath.Base(path))
+	}
+	s := probe.Streams[0]
+	duration, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil || duration <= 0 {
+		return Clip{}, fmt.Errorf("%s has no duration", filepath.Base(path))
+	}
+	return Clip{
+		Path:     path,
+		Duration: duration,
+		Width:    s.Width,
+		Height:   s.Height,
+		FPS:      parseRate(s.AvgFrameRate),
+		Codec:    s.CodecName,
+	}, nil
+}
+
+// parseRate parses an ffprobe rate such as "16/1" or "30000/1001"
+func parseRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
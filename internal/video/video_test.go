@@ -0,0 +1,119 @@
+package video
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func clips() []Clip {
+	return []Clip{
+		{Path: "/outputs/a.mp4", Duration: 5.0625, Width: 832, Height: 480, FPS: 16, Codec: "h264"},
+		{Path: "/outputs/b.mp4", Duration: 5.0625, Width: 832, Height: 480, FPS: 16, Codec: "h264"},
+		{Path: "/outputs/c.mp4", Duration: 3, Width: 832, Height: 480, FPS: 16, Codec: "h264"},
+	}
+}
+
+func TestArgsCopiesMatchingClips(t *testing.T) {
+	args := Args(clips(), "/outputs/out.mp4.list.txt", "/outputs/out.mp4", Options{})
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "-f concat -safe 0 -i /outputs/out.mp4.list.txt -map 0:v -c copy") {
+		t.Errorf("copy join args = %v", args)
+	}
+	if args[len(args)-1] != "/outputs/out.mp4" {
+		t.Errorf("output is not last: %v", args)
+	}
+}
+
+func TestArgsReencodesMismatchedClips(t *testing.T) {
+	c := clips()
+	c[2].Width, c[2].Height = 480, 832
+	args := Args(c, "list", "out.mp4", Options{})
+	if slices.Contains(args, "copy") || !slices.Contains(args, "libx264") {
+		t.Errorf("mismatched clips should be re-encoded: %v", args)
+	}
+	graph := args[slices.Index(args, "-filter_complex")+1]
+	if !strings.Contains(graph, "[2:v]scale=832:480:") || !strings.HasSuffix(graph, "[v0][v1][v2]concat=n=3:v=1:a=0[out]") {
+		t.Errorf("graph = %s", graph)
+	}
+}
+
+func TestArgsCrossfade(t *testing.T) {
+	crf := 23
+	args := Args(clips(), "list", "out.mp4", Options{Crossfade: 0.5, Encoding: &Encoding{Codec: "h265", CRF: &crf, FPS: 24}})
+	joined := strings.Join(args, " ")
+	for _, want := range []string{"-c:v libx265", "-crf 23", "-preset medium", "-tag:v hvc1"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("args missing %q: %v", want, args)
+		}
+	}
+	graph := args[slices.Index(args, "-filter_complex")+1]
+	for _, want := range []string{
+		"fps=24,",
+		"[v0][v1]xfade=transition=fade:duration=0.5:offset=4.5625[x1]",
+		"[x1][v2]xfade=transition=fade:duration=0.5:offset=9.125[out]",
+	} {
+		if !strings.Contains(graph, want) {
+			t.Errorf("graph missing %q: %s", want, graph)
+		}
+	}
+	if got := Duration(clips(), 0.5); got != 12.125 {
+		t.Errorf("Duration = %v, want 12.125", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	crf := 60
+	tests := []struct {
+		clips []Clip
+		opts  Options
+		ok    bool
+	}{
+		{clips(), Options{Crossfade: 1}, true},
+		{clips()[:1], Options{}, false},
+		{clips(), Options{Crossfade: 3}, false},
+		{clips(), Options{Crossfade: -1}, false},
+		{clips(), Options{Encoding: &Encoding{Codec: "av1"}}, false},
+		{clips(), Options{Encoding: &Encoding{CRF: &crf}}, false},
+		{clips(), Options{Encoding: &Encoding{Preset: "turbo"}}, false},
+	}
+	for i, tt := range tests {
+		if err := Check(tt.clips, tt.opts); (err == nil) != tt.ok {
+			t.Errorf("case %d: Check = %v, want ok %v", i, err, tt.ok)
+		}
+	}
+}
+
+func TestConcatList(t *testing.T) {
+	got := ConcatList([]Clip{{Path: "/outputs/a.mp4"}, {Path: "/outputs/it's.mp4"}})
+	if want := "file '/outputs/a.mp4'\nfile '/outputs/it'\\''s.mp4'\n"; got != want {
+		t.Errorf("ConcatList = %q, want %q", got, want)
+	}
+}
+
+func TestParseProbe(t *testing.T) {
+	out := `{"streams":[{"codec_name":"h264","width":832,"height":480,"avg_frame_rate":"16/1"}],"format":{"duration":"5.062500"}}`
+	clip, err := parseProbe("/outputs/a.mp4", []byte(out))
+	if err != nil {
+		t.Fatalf("parseProbe: %v", err)
+	}
+	want := Clip{Path: "/outputs/a.mp4", Duration: 5.0625, Width: 832, Height: 480, FPS: 16, Codec: "h264"}
+	if clip != want {
+		t.Errorf("clip = %+v", clip)
+	}
+	if _, err := parseProbe("x.mp4", []byte(`{"streams":[],"format":{"duration":"1"}}`)); err == nil {
+		t.Error("expected an error for a file without video")
+	}
+	if got := parseRate("30000/1001"); got < 29.97 || got > 29.98 {
+		t.Errorf("parseRate = %v", got)
+	}
+}
+
+func TestReadProgress(t *testing.T) {
+	var got []float64
+	readProgress(strings.NewReader("frame=10\nout_time_us=2500000\nprogress=continue\nout_time_us=20000000\nprogress=end\n"), 10,
+		func(p float64) { got = append(got, p) })
+	if !slices.Equal(got, []float64{0.25, 1}) {
+		t.Errorf("progress = %v", got)
+	}
+}
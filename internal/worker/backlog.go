@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"context"
+	"sync"
+)
+
+// Backlog holds jobs that are ready to run until a worker is free. It
+// doesn't decide the order; the dispatcher asks for jobs by ID in the
+// order the database keeps, so reordering takes effect immediately.
+type Backlog struct {
+	mu    sync.Mutex
+	jobs  map[string]heldJob
+	ready chan struct{}
+}
+
+// heldJob keeps the job's context so its trace continues at dispatch
+type heldJob struct {
+	ctx context.Context
+	job *JobRequest
+}
+
+func NewBacklog() *Backlog {
+	return &Backlog{
+		jobs:  make(map[string]heldJob),
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// Add holds a job and wakes the dispatcher
+func (b *Backlog) Add(ctx context.Context, job *JobRequest) {
+	b.mu.Lock()
+	b.jobs[job.ID] = heldJob{ctx: ctx, job: job}
+	b.mu.Unlock()
+	b.Wake()
+}
+
+// Get returns a held job without removing it
+func (b *Backlog) Get(id string) (*JobRequest, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	held, ok := b.jobs[id]
+	return held.job, ok
+}
+
+// Take removes and returns a held job with the context it was added with
+func (b *Backlog) Take(id string) (context.Context, *JobRequest, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	held, ok := b.jobs[id]
+	delete(b.jobs, id)
+	return held.ctx, held.job, ok
+}
+
+// Len is the number of held jobs
+func (b *Backlog) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.jobs)
+}
+
+// Wake tells the dispatcher something changed: a job arrived, a worker or
+// concurrency slot freed up
+func (b *Backlog) Wake() {
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Ready receives after Wake. Wakes while the dispatcher is busy coalesce
+// into one.
+func (b *Backlog) Ready() <-chan struct{} {
+	return b.ready
+}
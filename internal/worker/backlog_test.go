@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBacklog(t *testing.T) {
+	b := NewBacklog()
+	b.Add(context.Background(), &JobRequest{ID: "a", Type: "qwen"})
+	b.Add(context.Background(), &JobRequest{ID: "b", Type: "svi"})
+
+	// Two adds coalesce into a single wake
+	select {
+	case <-b.Ready():
+	default:
+		t.Fatal("expected a wake after Add")
+	}
+	select {
+	case <-b.Ready():
+		t.Fatal("expected wakes to coalesce")
+	default:
+	}
+
+	if job, ok := b.Get("b"); !ok || job.Type != "svi" || b.Len() != 2 {
+		t.Errorf("Get should not remove the job")
+	}
+	if ctx, _, ok := b.Take("a"); !ok || ctx == nil || b.Len() != 1 {
+		t.Errorf("Take should remove the job")
+	}
+	if _, _, ok := b.Take("a"); ok {
+		t.Errorf("expected job a gone")
+	}
+}
@@ -0,0 +1,152 @@
+package worker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Python environment states
+const (
+	EnvPending    = "pending"
+	EnvInstalling = "installing"
+	EnvReady      = "ready"
+	EnvFailed     = "failed"
+)
+
+// envOutputLines is how much bootstrap output EnvStatus keeps
+const envOutputLines = 20
+
+// EnvStatus reports the Python environment bootstrap
+type EnvStatus struct {
+	State      string     `json:"state"`
+	Message    string     `json:"message"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Output     []string   `json:"output,omitempty"`
+}
+
+// EnvLogCallback is called with each line of bootstrap output
+type EnvLogCallback func(status EnvStatus, line string)
+
+// envTracker holds the bootstrap status for concurrent readers
+type envTracker struct {
+	mu     sync.RWMutex
+	status EnvStatus
+	onLog  EnvLogCallback
+}
+
+func (t *envTracker) set(state, message string) {
+	t.mu.Lock()
+	now := time.Now()
+	t.status.State = state
+	t.status.Message = message
+	switch state {
+	case EnvInstalling:
+		t.status.StartedAt = &now
+	case EnvReady, EnvFailed:
+		t.status.FinishedAt = &now
+	}
+	status := t.snapshot()
+	onLog := t.onLog
+	t.mu.Unlock()
+
+	if onLog != nil {
+		onLog(status, "")
+	}
+}
+
+func (t *envTracker) line(line string) {
+	t.mu.Lock()
+	t.status.Output = append(t.status.Output, line)
+	if len(t.status.Output) > envOutputLines {
+		t.status.Output = t.status.Output[len(t.status.Output)-envOutputLines:]
+	}
+	status := t.snapshot()
+	onLog := t.onLog
+	t.mu.Unlock()
+
+	log.Printf("Python env: %s", line)
+	if onLog != nil {
+		onLog(status, line)
+	}
+}
+
+// snapshot copies the status; callers hold mu
+func (t *envTracker) snapshot() EnvStatus {
+	status := t.status
+	status.Output = append([]string{}, t.status.Output...)
+	return status
+}
+
+// SetEnvLogCallback streams bootstrap progress, e.g. to WebSocket clients
+func (m *Manager) SetEnvLogCallback(onLog EnvLogCallback) {
+	m.env.mu.Lock()
+	defer m.env.mu.Unlock()
+	m.env.onLog = onLog
+}
+
+// EnvStatus returns the state of the Python environment bootstrap
+func (m *Manager) EnvStatus() EnvStatus {
+	m.env.mu.RLock()
+	defer m.env.mu.RUnlock()
+	return m.env.snapshot()
+}
+
+// bootstrap runs the configured environment setup command (uv sync by
+// default) in the Python directory before any worker starts
+func (m *Manager) bootstrap() error {
+	args := strings.Fields(m.cfg.PythonBootstrap)
+	if len(args) == 0 {
+		m.env.set(EnvReady, "bootstrap disabled")
+		return nil
+	}
+
+	m.env.set(EnvInstalling, "installing dependencies")
+	log.Printf("Python env: running %s", m.cfg.PythonBootstrap)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = m.cfg.PythonPath
+	cmd.Env = os.Environ()
+
+	// uv reports progress on stderr; merge both streams
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	if err := cmd.Start(); err != nil {
+		pw.Close()
+		m.env.set(EnvFailed, err.Error())
+		return fmt.Errorf("start %s: %w", args[0], err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				m.env.line(line)
+			}
+		}
+		io.Copy(io.Discard, pr)
+	}()
+
+	err := cmd.Wait()
+	pw.Close()
+	<-done
+
+	if err != nil {
+		m.env.set(EnvFailed, fmt.Sprintf("%s failed: %v", m.cfg.PythonBootstrap, err))
+		return fmt.Errorf("%s: %w", m.cfg.PythonBootstrap, err)
+	}
+
+	m.env.set(EnvReady, "dependencies installed")
+	return nil
+}
@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/druarnfield/diffbox/internal/config"
+)
+
+func TestBootstrap(t *testing.T) {
+	manager := NewManager(&config.Config{
+		PythonPath:      t.TempDir(),
+		PythonBootstrap: "echo Resolved 42 packages",
+	})
+
+	if state := manager.EnvStatus().State; state != EnvPending {
+		t.Errorf("expected pending before start, got %s", state)
+	}
+
+	var mu sync.Mutex
+	var lines []string
+	manager.SetEnvLogCallback(func(status EnvStatus, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if line != "" {
+			lines = append(lines, line)
+		}
+	})
+
+	// No workers configured, so Start only bootstraps
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := manager.StartError(); err != nil {
+		t.Errorf("StartError = %v after a good start", err)
+	}
+
+	status := manager.EnvStatus()
+	if status.State != EnvReady || status.StartedAt == nil || status.FinishedAt == nil {
+		t.Errorf("unexpected status after bootstrap: %+v", status)
+	}
+	if len(lines) != 1 || lines[0] != "Resolved 42 packages" {
+		t.Errorf("expected streamed output, got %v", lines)
+	}
+
+	select {
+	case <-manager.Ready():
+	default:
+		t.Error("expected Ready to be closed after Start")
+	}
+}
+
+func TestBootstrapFailure(t *testing.T) {
+	manager := NewManager(&config.Config{
+		PythonPath:      t.TempDir(),
+		PythonBootstrap: "false",
+	})
+
+	if err := manager.Start(); err == nil {
+		t.Fatal("expected Start to fail when the bootstrap fails")
+	}
+	if manager.StartError() == nil {
+		t.Error("expected the failure to be kept")
+	}
+	if state := manager.EnvStatus().State; state != EnvFailed {
+		t.Errorf("expected failed state, got %s", state)
+	}
+
+	select {
+	case <-manager.Ready():
+		t.Error("expected Ready to stay open after a failed start")
+	default:
+	}
+}
+
+func TestBootstrapDisabled(t *testing.T) {
+	manager := NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if state := manager.EnvStatus().State; state != EnvReady {
+		t.Errorf("expected ready when bootstrap is disabled, got %s", state)
+	}
+}
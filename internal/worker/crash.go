@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// crashLogLines is how much of a worker's stderr a crash dump keeps
+	crashLogLines = 200
+	// maxCrashDumps is how many crash dumps are kept on disk
+	maxCrashDumps = 20
+	// workerStderrDelay is how long Wait keeps reading stderr after a
+	// worker exits
+	workerStderrDelay = 5 * time.Second
+)
+
+// CrashDump is written when a worker exits unexpectedly: the exit error,
+// the jobs it had and the last lines it wrote to stderr, which hold the
+// Python traceback
+type CrashDump struct {
+	WorkerID int       `json:"worker_id"`
+	PID      int       `json:"pid"`
+	At       time.Time `json:"at"`
+	Error    string    `json:"error"`
+	Jobs     []string  `json:"jobs,omitempty"`
+	Log      []string  `json:"log"`
+}
+
+// CrashDir is where crash dumps are written
+func (m *Manager) CrashDir() string {
+	return filepath.Join(m.cfg.DataDir, "crashes")
+}
+
+// writeCrashDump records a worker that exited with err, keeping the last
+// maxCrashDumps
+func (m *Manager) writeCrashDump(w *Worker, err error) {
+	m.mu.Lock()
+	dump := CrashDump{
+		WorkerID: w.id,
+		At:       time.Now(),
+		Error:    err.Error(),
+		Jobs:     append([]string(nil), w.jobs...),
+		Log:      w.logs.Lines(),
+	}
+	m.mu.Unlock()
+	if w.cmd.Process != nil {
+		dump.PID = w.cmd.Process.Pid
+	}
+
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		log.Printf("Worker %d: Failed to encode crash dump: %v", w.id, err)
+		return
+	}
+	dir := m.CrashDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Worker %d: Failed to write crash dump: %v", w.id, err)
+		return
+	}
+	// Names sort by time
+	path := filepath.Join(dir, fmt.Sprintf("%s-worker-%d.json", dump.At.UTC().Format("20060102T150405.000000000"), w.id))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Printf("Worker %d: Failed to write crash dump: %v", w.id, err)
+		return
+	}
+	log.Printf("Worker %d: Crash dump written to %s", w.id, path)
+
+	paths := crashDumpPaths(dir)
+	for len(paths) > maxCrashDumps {
+		os.Remove(paths[len(paths)-1])
+		paths = paths[:len(paths)-1]
+	}
+}
+
+// crashDumpPaths lists the dumps in dir, newest first
+func crashDumpPaths(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	return paths
+}
+
+// CrashDumps returns the paths of the kept crash dumps, newest first
+func (m *Manager) CrashDumps() []string {
+	return crashDumpPaths(m.CrashDir())
+}
@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"slices"
+	"testing"
+
+	"github.com/druarnfield/diffbox/internal/config"
+	"github.com/druarnfield/diffbox/internal/logtail"
+)
+
+func TestCrashDump(t *testing.T) {
+	m := NewManager(&config.Config{DataDir: t.TempDir()})
+	if dumps := m.CrashDumps(); len(dumps) != 0 {
+		t.Fatalf("expected no dumps, got %v", dumps)
+	}
+
+	w := &Worker{id: 1, cmd: &exec.Cmd{}, logs: logtail.New(crashLogLines), jobs: []string{"job-1"}}
+	w.logs.Add("Traceback (most recent call last):")
+	w.logs.Add("torch.OutOfMemoryError: CUDA out of memory")
+	m.writeCrashDump(w, errors.New("exit status 1"))
+
+	dumps := m.CrashDumps()
+	if len(dumps) != 1 {
+		t.Fatalf("expected one dump, got %v", dumps)
+	}
+	data, err := os.ReadFile(dumps[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dump CrashDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatal(err)
+	}
+	if dump.WorkerID != 1 || dump.Error != "exit status 1" || !slices.Equal(dump.Jobs, []string{"job-1"}) || len(dump.Log) != 2 {
+		t.Errorf("unexpected dump %+v", dump)
+	}
+
+	// Only the newest are kept
+	first := dumps[0]
+	for i := 0; i < maxCrashDumps; i++ {
+		m.writeCrashDump(w, errors.New("exit status 2"))
+	}
+	dumps = m.CrashDumps()
+	if len(dumps) != maxCrashDumps || slices.Contains(dumps, first) {
+		t.Errorf("expected the %d newest dumps, got %v", maxCrashDumps, dumps)
+	}
+}
+
+func TestWorkerExited(t *testing.T) {
+	m := NewManager(&config.Config{DataDir: t.TempDir()})
+	w := &Worker{id: 2, inFlight: 2, jobs: []string{"job-1", "job-2"}}
+	m.stages["job-1"] = nil
+
+	var lost []string
+	m.SetExitCallback(func(workerID int, jobs []string, err error) {
+		if workerID != 2 || err == nil {
+			t.Errorf("exit callback for worker %d with %v", workerID, err)
+		}
+		lost = jobs
+	})
+	m.workerExited(w, errors.New("signal: killed"))
+
+	if !slices.Equal(lost, []string{"job-1", "job-2"}) {
+		t.Errorf("lost jobs = %v", lost)
+	}
+	if len(w.jobs) != 0 || w.inFlight != 0 || len(m.stages) != 0 {
+		t.Errorf("worker still holds jobs: %v, %d in flight, stages %v", w.jobs, w.inFlight, m.stages)
+	}
+}
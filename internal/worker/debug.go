@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoWorker is returned for a worker ID that doesn't exist or isn't running
+var ErrNoWorker = errors.New("no such running worker")
+
+// DebugRequest is a diagnostic command for a worker, e.g. "vram",
+// "models", "selftest", "gc" or "ping"
+type DebugRequest struct {
+	ID      string                 `json:"id"`
+	Command string                 `json:"command"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+}
+
+// DebugResponse is a worker's answer to a DebugRequest
+type DebugResponse struct {
+	ID     string          `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// WorkerInfo describes a worker process
+type WorkerInfo struct {
+	ID      int  `json:"id"`
+	PID     int  `json:"pid"`
+	Running bool `json:"running"`
+}
+
+var debugCounter uint64
+
+// Workers lists the worker processes
+func (m *Manager) Workers() []WorkerInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	infos := make([]WorkerInfo, 0, len(m.workers))
+	for _, w := range m.workers {
+		info := WorkerInfo{ID: w.id, Running: w.running}
+		if w.cmd.Process != nil {
+			info.PID = w.cmd.Process.Pid
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Debug sends a diagnostic command to one worker and waits for its answer.
+// Workers handle messages in order, so a command waits behind a running job.
+func (m *Manager) Debug(ctx context.Context, workerID int, command string, args map[string]interface{}) (*DebugResponse, error) {
+	req := DebugRequest{
+		ID:      fmt.Sprintf("debug-%d-%d", time.Now().UnixNano(), atomic.AddUint64(&debugCounter, 1)),
+		Command: command,
+		Args:    args,
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal debug request: %w", err)
+	}
+
+	reply := make(chan *DebugResponse, 1)
+	m.debugMu.Lock()
+	m.debugWaiting[req.ID] = reply
+	m.debugMu.Unlock()
+	defer func() {
+		m.debugMu.Lock()
+		delete(m.debugWaiting, req.ID)
+		m.debugMu.Unlock()
+	}()
+
+	if err := m.send(workerID, WorkerMessage{Type: "debug", Data: data}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-reply:
+		return resp, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("worker %d did not answer %q: %w", workerID, command, ctx.Err())
+	}
+}
+
+// send writes a message to a specific worker's stdin
+func (m *Manager) send(workerID int, msg WorkerMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, w := range m.workers {
+		if w.id == workerID && w.running {
+			if err := json.NewEncoder(w.stdin).Encode(msg); err != nil {
+				return fmt.Errorf("send to worker %d: %w", workerID, err)
+			}
+			return nil
+		}
+	}
+	return ErrNoWorker
+}
+
+// deliverDebug hands a worker's debug answer to the waiting caller
+func (m *Manager) deliverDebug(resp *DebugResponse) {
+	m.debugMu.Lock()
+	reply, ok := m.debugWaiting[resp.ID]
+	m.debugMu.Unlock()
+
+	if ok {
+		reply <- resp
+	}
+}
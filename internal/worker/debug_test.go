@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/config"
+)
+
+// fakeWorker wires a Worker to pipes so a test can play the Python side
+func fakeWorker(t *testing.T, m *Manager, id int) (requests *json.Decoder, replies *json.Encoder) {
+	t.Helper()
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	t.Cleanup(func() {
+		stdinW.Close()
+		stdoutW.Close()
+	})
+
+	w := &Worker{id: id, cmd: &exec.Cmd{}, stdin: stdinW, stdout: stdoutR, running: true}
+	m.workers = append(m.workers, w)
+	go m.handleWorkerOutput(w)
+
+	return json.NewDecoder(stdinR), json.NewEncoder(stdoutW)
+}
+
+func TestDebug(t *testing.T) {
+	m := NewManager(&config.Config{})
+	requests, replies := fakeWorker(t, m, 0)
+
+	go func() {
+		var msg WorkerMessage
+		if err := requests.Decode(&msg); err != nil || msg.Type != "debug" {
+			return
+		}
+		var req DebugRequest
+		json.Unmarshal(msg.Data, &req)
+		if req.Command != "vram" {
+			return
+		}
+		data, _ := json.Marshal(DebugResponse{ID: req.ID, Result: json.RawMessage(`{"cuda":false}`)})
+		replies.Encode(WorkerMessage{Type: "debug_result", Data: data})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	resp, err := m.Debug(ctx, 0, "vram", nil)
+	if err != nil {
+		t.Fatalf("Debug failed: %v", err)
+	}
+	if string(resp.Result) != `{"cuda":false}` {
+		t.Errorf("unexpected result %s", resp.Result)
+	}
+}
+
+func TestDebugUnknownWorker(t *testing.T) {
+	m := NewManager(&config.Config{})
+	if _, err := m.Debug(context.Background(), 7, "ping", nil); !errors.Is(err, ErrNoWorker) {
+		t.Errorf("expected ErrNoWorker, got %v", err)
+	}
+}
+
+func TestDebugTimeout(t *testing.T) {
+	m := NewManager(&config.Config{})
+	requests, _ := fakeWorker(t, m, 0)
+
+	// Read the request but never answer, like a worker stuck in a job
+	go func() {
+		var msg WorkerMessage
+		requests.Decode(&msg)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := m.Debug(ctx, 0, "ping", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	if infos := m.Workers(); len(infos) != 1 || !infos[0].Running {
+		t.Errorf("unexpected workers %+v", infos)
+	}
+}
@@ -0,0 +1,53 @@
+package worker
+
+// FairShareCost is the GPU time in seconds charged to a user for each job
+// placed in the fair order. Run times aren't known ahead of time, so every
+// job counts the same; it only has to be large enough that a user's queue
+// position moves after each pick.
+const FairShareCost = 300
+
+// QueuedJob is a queued job and who submitted it
+type QueuedJob struct {
+	ID     string
+	UserID string
+}
+
+// FairOrder interleaves users' queued jobs so one heavy user can't hold
+// the GPU. It repeatedly takes the next job of whichever user has the
+// least usage (GPU seconds), charging cost for each job taken. Ties go to
+// the user whose next job comes first in jobs, and each user's own jobs
+// keep their order. Jobs without a user share one turn.
+func FairOrder(jobs []QueuedJob, usage map[string]float64, cost float64) []string {
+	queues := make(map[string][]int) // user -> indexes into jobs, in order
+	var users []string
+	for i, j := range jobs {
+		if _, ok := queues[j.UserID]; !ok {
+			users = append(users, j.UserID)
+		}
+		queues[j.UserID] = append(queues[j.UserID], i)
+	}
+
+	charged := make(map[string]float64, len(users))
+	for _, u := range users {
+		charged[u] = usage[u]
+	}
+
+	order := make([]string, 0, len(jobs))
+	for len(order) < len(jobs) {
+		next := ""
+		found := false
+		for _, u := range users {
+			if len(queues[u]) == 0 {
+				continue
+			}
+			if !found || charged[u] < charged[next] ||
+				(charged[u] == charged[next] && queues[u][0] < queues[next][0]) {
+				next, found = u, true
+			}
+		}
+		order = append(order, jobs[queues[next][0]].ID)
+		queues[next] = queues[next][1:]
+		charged[next] += cost
+	}
+	return order
+}
@@ -0,0 +1,40 @@
+package worker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFairOrder(t *testing.T) {
+	jobs := []QueuedJob{
+		{"a1", "alice"}, {"a2", "alice"}, {"a3", "alice"},
+		{"b1", "bob"}, {"b2", "bob"},
+		{"c1", "carol"},
+	}
+
+	tests := []struct {
+		name  string
+		usage map[string]float64
+		want  []string
+	}{
+		{"round robin from queue order", nil, []string{"a1", "b1", "c1", "a2", "b2", "a3"}},
+		{"light users first", map[string]float64{"alice": 1000}, []string{"b1", "c1", "b2", "a1", "a2", "a3"}},
+		{"partial head start", map[string]float64{"alice": 100, "bob": 400}, []string{"c1", "a1", "a2", "b1", "a3", "b2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FairOrder(jobs, tt.usage, 300)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFairOrderSingleUser(t *testing.T) {
+	jobs := []QueuedJob{{"j1", ""}, {"j2", ""}, {"j3", ""}}
+	got := FairOrder(jobs, map[string]float64{"": 5000}, 300)
+	if !reflect.DeepEqual(got, []string{"j1", "j2", "j3"}) {
+		t.Errorf("a single user's queue should be unchanged, got %v", got)
+	}
+}
@@ -0,0 +1,58 @@
+package worker
+
+import "sync"
+
+// Limiter caps how many jobs of each type run at once, independently of the
+// worker count, so one workflow can't take all the VRAM. Jobs over the
+// limit wait in the backlog and are dispatched in queue order.
+type Limiter struct {
+	mu      sync.Mutex
+	limits  map[string]int
+	running map[string]int
+	jobs    map[string]string // job ID -> type, for jobs holding a slot
+}
+
+// NewLimiter creates a limiter. Job types missing from limits (or with a
+// limit below 1) are unlimited.
+func NewLimiter(limits map[string]int) *Limiter {
+	return &Limiter{
+		limits:  limits,
+		running: make(map[string]int),
+		jobs:    make(map[string]string),
+	}
+}
+
+// TryAcquire takes a slot for the job if one is free
+func (l *Limiter) TryAcquire(jobID, jobType string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limits[jobType]
+	if limit >= 1 && l.running[jobType] >= limit {
+		return false
+	}
+	l.running[jobType]++
+	l.jobs[jobID] = jobType
+	return true
+}
+
+// Release frees the job's slot. Jobs that don't hold one are ignored, so
+// it's safe to call from every terminal path.
+func (l *Limiter) Release(jobID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	jobType, ok := l.jobs[jobID]
+	if !ok {
+		return
+	}
+	delete(l.jobs, jobID)
+	l.running[jobType]--
+}
+
+// Running returns how many jobs of a type hold a slot
+func (l *Limiter) Running(jobType string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.running[jobType]
+}
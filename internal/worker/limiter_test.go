@@ -0,0 +1,43 @@
+package worker
+
+import "testing"
+
+func TestLimiterUnlimitedTypes(t *testing.T) {
+	l := NewLimiter(map[string]int{"svi": 1})
+
+	for i := 0; i < 5; i++ {
+		if !l.TryAcquire(string(rune('a'+i)), "chat") {
+			t.Fatal("expected unlimited type to always acquire")
+		}
+	}
+}
+
+func TestLimiterEnforcesLimit(t *testing.T) {
+	l := NewLimiter(map[string]int{"qwen": 2})
+
+	if !l.TryAcquire("job-1", "qwen") || !l.TryAcquire("job-2", "qwen") {
+		t.Fatal("expected the first two jobs to acquire")
+	}
+	if l.TryAcquire("job-3", "qwen") {
+		t.Fatal("expected third job to be over the limit")
+	}
+	// Other types are independent
+	if !l.TryAcquire("job-4", "svi") {
+		t.Fatal("expected a different type to acquire")
+	}
+
+	l.Release("job-1")
+	if !l.TryAcquire("job-3", "qwen") {
+		t.Error("expected a released slot to be taken")
+	}
+	if n := l.Running("qwen"); n != 2 {
+		t.Errorf("expected 2 running, got %d", n)
+	}
+
+	// Releasing an unknown or already released job is a no-op
+	l.Release("job-1")
+	l.Release("nope")
+	if n := l.Running("qwen"); n != 2 {
+		t.Errorf("expected 2 running after no-op releases, got %d", n)
+	}
+}
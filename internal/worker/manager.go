@@ -8,10 +8,16 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/druarnfield/diffbox/internal/config"
+	"github.com/druarnfield/diffbox/internal/logtail"
+	"github.com/druarnfield/diffbox/internal/proc"
+	"github.com/druarnfield/diffbox/internal/workflow"
 )
 
 // ProgressCallback is called when a worker reports progress
@@ -23,14 +29,70 @@ type CompleteCallback func(JobResult)
 // ErrorCallback is called when a worker reports an error
 type ErrorCallback func(JobResult)
 
+// JobLogCallback is called with each stderr line a worker writes while it
+// runs a job
+type JobLogCallback func(jobID, line string)
+
+// ExitCallback is called when a worker process exits with the jobs it
+// still had, which will never report back. err is nil for a clean exit.
+type ExitCallback func(workerID int, jobs []string, err error)
+
+// Launcher builds the command for worker id. The environment and pipes
+// are set up by the manager.
+type Launcher func(id int, cfg *config.Config) (*exec.Cmd, error)
+
+// PythonLauncher runs the Python worker with uv
+func PythonLauncher(id int, cfg *config.Config) (*exec.Cmd, error) {
+	cmd := exec.Command("uv", "run", "python", "-m", "worker")
+	cmd.Dir = cfg.PythonPath
+	return cmd, nil
+}
+
+// MockLauncher runs the mock worker built into the running binary, which
+// must dispatch MockWorkerCommand to RunMock. In simulation mode it
+// passes -simulate and -speed.
+func MockLauncher(id int, cfg *config.Config) (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("find own binary: %w", err)
+	}
+	args := []string{MockWorkerCommand}
+	if cfg.Simulate {
+		args = append(args, "-simulate", "-speed", strconv.FormatFloat(cfg.SimulateSpeed, 'g', -1, 64))
+	}
+	return exec.Command(exe, args...), nil
+}
+
 type Manager struct {
 	cfg        *config.Config
+	launch     Launcher
 	workers    []*Worker
 	nextWorker int
 	mu         sync.Mutex
 	onProgress ProgressCallback
 	onComplete CompleteCallback
 	onError    ErrorCallback
+	onJobLog   JobLogCallback
+	onExit     ExitCallback
+
+	env envTracker
+	// startErr is why Start failed, guarded by mu
+	startErr error
+	ready    chan struct{}
+
+	// versions reported by the most recent worker to start
+	versionsMu sync.Mutex
+	versions   map[string]string
+
+	debugMu      sync.Mutex
+	debugWaiting map[string]chan *DebugResponse
+
+	// stages of the jobs sent to workers, by job ID, guarded by mu
+	stages map[string][]workflow.Stage
+
+	// stopping is set once Stop is called, so workers exiting then aren't
+	// taken for crashes
+	stopping atomic.Bool
 }
 
 type Worker struct {
@@ -40,6 +102,17 @@ type Worker struct {
 	stdout  io.ReadCloser
 	stderr  io.ReadCloser
 	running bool
+	// exited is closed once the process has exited
+	exited chan struct{}
+	// logs keeps the last stderr lines for a crash dump
+	logs *logtail.Tail
+
+	// Activity for idle unloading, guarded by Manager.mu
+	inFlight   int
+	lastActive time.Time
+	unloaded   bool
+	// jobs sent to the worker, in the order it will run them
+	jobs []string
 }
 
 type WorkerMessage struct {
@@ -52,6 +125,13 @@ type JobRequest struct {
 	ID     string                 `json:"id"`
 	Type   string                 `json:"type"`
 	Params map[string]interface{} `json:"params"`
+	// ScratchDir is the job's private directory for intermediate files
+	ScratchDir string `json:"scratch_dir,omitempty"`
+	// Workflow carries the template and bindings for custom job types
+	Workflow *workflow.Spec `json:"workflow,omitempty"`
+	// Stages are the job type's stages, for the worker to report progress
+	// through
+	Stages []workflow.Stage `json:"stages,omitempty"`
 }
 
 type ProgressUpdate struct {
@@ -59,19 +139,49 @@ type ProgressUpdate struct {
 	Progress float64 `json:"progress"`
 	Stage    string  `json:"stage"`
 	Preview  string  `json:"preview,omitempty"`
+	// StageID names one of the job's stages and StageProgress is how far
+	// through it the job is, from 0 to 1. When set, the server works out
+	// Progress from the stage weights.
+	StageID       string  `json:"stage_id,omitempty"`
+	StageProgress float64 `json:"stage_progress,omitempty"`
 }
 
 type JobResult struct {
-	JobID  string `json:"job_id"`
-	Status string `json:"status"`
-	Output string `json:"output,omitempty"`
-	Error  string `json:"error,omitempty"`
+	JobID  string    `json:"job_id"`
+	Status string    `json:"status"`
+	Output JobOutput `json:"output,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// JobOutput describes what a finished job produced. Workers report an
+// object, but a bare path string is accepted too.
+type JobOutput struct {
+	Type   string `json:"type,omitempty"` // "video" or "image"
+	Path   string `json:"path"`
+	Frames int    `json:"frames,omitempty"`
+	Seed   *int64 `json:"seed,omitempty"` // the seed actually used
+}
+
+func (o *JobOutput) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*o = JobOutput{Path: path}
+		return nil
+	}
+	type plain JobOutput
+	return json.Unmarshal(data, (*plain)(o))
 }
 
 func NewManager(cfg *config.Config) *Manager {
 	return &Manager{
 		cfg:     cfg,
+		launch:  PythonLauncher,
 		workers: make([]*Worker, 0),
+		env:     envTracker{status: EnvStatus{State: EnvPending, Message: "waiting to start"}},
+		ready:   make(chan struct{}),
+
+		debugWaiting: make(map[string]chan *DebugResponse),
+		stages:       make(map[string][]workflow.Stage),
 	}
 }
 
@@ -84,7 +194,44 @@ func (m *Manager) SetCallbacks(onProgress ProgressCallback, onComplete CompleteC
 	m.onError = onError
 }
 
-func (m *Manager) Start() error {
+// SetLauncher replaces how worker processes are started. It must be
+// called before Start.
+func (m *Manager) SetLauncher(launch Launcher) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.launch = launch
+}
+
+// SetJobLogCallback sets the callback for worker log lines attributed to
+// the job the worker is running
+func (m *Manager) SetJobLogCallback(onJobLog JobLogCallback) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onJobLog = onJobLog
+}
+
+// SetExitCallback sets the callback for worker processes exiting
+func (m *Manager) SetExitCallback(onExit ExitCallback) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onExit = onExit
+}
+
+// Start prepares the Python environment and spawns the workers. It can
+// take minutes on first boot while dependencies install. A failure is
+// kept for StartError.
+func (m *Manager) Start() (err error) {
+	defer func() {
+		if err != nil {
+			m.mu.Lock()
+			m.startErr = err
+			m.mu.Unlock()
+		}
+	}()
+	if err := m.bootstrap(); err != nil {
+		return fmt.Errorf("python environment: %w", err)
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -96,32 +243,80 @@ func (m *Manager) Start() error {
 		m.workers = append(m.workers, worker)
 	}
 
+	close(m.ready)
 	return nil
 }
 
-func (m *Manager) Stop() {
+// StartError returns why Start failed, or nil if it hasn't
+func (m *Manager) StartError() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.startErr
+}
 
+// Ready is closed once the workers have been started
+func (m *Manager) Ready() <-chan struct{} {
+	return m.ready
+}
+
+// Stopping reports whether Stop has been called, so workers exiting are
+// being shut down rather than crashing
+func (m *Manager) Stopping() bool {
+	return m.stopping.Load()
+}
+
+// workerStopTimeout is how long a worker gets to exit after being asked to
+// shut down before it is killed
+const workerStopTimeout = 10 * time.Second
+
+// Stop asks every worker to shut down and waits for them to exit, killing
+// any that are still busy after workerStopTimeout
+func (m *Manager) Stop() {
+	m.stopping.Store(true)
+	m.mu.Lock()
+	workers := make([]*Worker, 0, len(m.workers))
 	for _, worker := range m.workers {
 		if worker.running {
-			// Send shutdown message
-			msg := WorkerMessage{Type: "shutdown"}
-			json.NewEncoder(worker.stdin).Encode(msg)
-			worker.cmd.Wait()
-			worker.running = false
+			workers = append(workers, worker)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, worker := range workers {
+		// Send shutdown message
+		msg := WorkerMessage{Type: "shutdown"}
+		json.NewEncoder(worker.stdin).Encode(msg)
+	}
+
+	// Workers exit in parallel, so they share one deadline
+	deadline := time.After(workerStopTimeout)
+	for _, worker := range workers {
+		if worker.exited == nil {
+			continue
+		}
+		select {
+		case <-worker.exited:
+		case <-deadline:
+			log.Printf("Worker %d did not exit in %s, killing it", worker.id, workerStopTimeout)
+			if worker.cmd.Process != nil {
+				proc.Kill(worker.cmd)
+			}
+			<-worker.exited
 		}
 	}
 }
 
 func (m *Manager) spawnWorker(id int) (*Worker, error) {
-	// Use uv to run the Python worker
-	cmd := exec.Command("uv", "run", "python", "-m", "worker")
-	cmd.Dir = m.cfg.PythonPath
+	cmd, err := m.launch(id, m.cfg)
+	if err != nil {
+		return nil, err
+	}
 	cmd.Env = append(os.Environ(),
 		fmt.Sprintf("DIFFBOX_MODELS_DIR=%s", m.cfg.ModelsDir),
 		fmt.Sprintf("DIFFBOX_OUTPUTS_DIR=%s", m.cfg.OutputsDir),
 		fmt.Sprintf("COMFYUI_URL=%s", m.cfg.ComfyUIURL),
+		// huggingface_hub reads this, so Python downloads use the mirror too
+		fmt.Sprintf("HF_ENDPOINT=%s", m.cfg.HFEndpoint),
 		fmt.Sprintf("WORKER_ID=%d", id),
 	)
 
@@ -135,10 +330,12 @@ func (m *Manager) spawnWorker(id int) (*Worker, error) {
 		return nil, err
 	}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, err
-	}
+	// Wait returns only once everything the worker wrote to stderr has
+	// been read, so a crash dump has the last lines. Children left holding
+	// stderr open get cmd.WaitDelay.
+	stderr, stderrW := io.Pipe()
+	cmd.Stderr = stderrW
+	cmd.WaitDelay = workerStderrDelay
 
 	worker := &Worker{
 		id:      id,
@@ -147,29 +344,48 @@ func (m *Manager) spawnWorker(id int) (*Worker, error) {
 		stdout:  stdout,
 		stderr:  stderr,
 		running: false,
+		logs:    logtail.New(crashLogLines),
 	}
 
+	proc.Prepare(cmd)
 	if err := cmd.Start(); err != nil {
+		stderrW.Close()
 		return nil, err
 	}
+	if err := proc.Attach(cmd); err != nil {
+		log.Printf("Worker %d may outlive diffbox: %v", id, err)
+	}
 
 	worker.running = true
+	worker.exited = make(chan struct{})
 
 	// Handle stdout (JSON messages)
 	go m.handleWorkerOutput(worker)
 
 	// Handle stderr (logs)
-	go m.handleWorkerLogs(worker)
+	logsDone := make(chan struct{})
+	go func() {
+		m.handleWorkerLogs(worker)
+		close(logsDone)
+	}()
 
 	// Monitor worker process health
 	go func() {
 		err := cmd.Wait()
+		stderrW.Close()
+		<-logsDone
+		proc.Release(cmd)
 		worker.running = false
+		close(worker.exited)
 		if err != nil {
 			log.Printf("ERROR - Worker %d exited with error: %v", id, err)
 		} else {
 			log.Printf("Worker %d exited cleanly", id)
 		}
+		if err != nil && !m.stopping.Load() {
+			m.writeCrashDump(worker, err)
+		}
+		m.workerExited(worker, err)
 	}()
 
 	log.Printf("Worker %d started (PID: %d)", id, cmd.Process.Pid)
@@ -201,6 +417,7 @@ func (m *Manager) handleWorkerOutput(w *Worker) {
 				log.Printf("Worker %d: invalid progress data: %v", w.id, err)
 				continue
 			}
+			m.weighProgress(&progress)
 			log.Printf("Worker %d: job %s progress %.1f%% - %s", w.id, progress.JobID, progress.Progress*100, progress.Stage)
 			if m.onProgress != nil {
 				m.onProgress(progress)
@@ -212,7 +429,8 @@ func (m *Manager) handleWorkerOutput(w *Worker) {
 				log.Printf("Worker %d: invalid result data: %v", w.id, err)
 				continue
 			}
-			log.Printf("Worker %d: job %s completed: %s", w.id, result.JobID, result.Output)
+			log.Printf("Worker %d: job %s completed: %s", w.id, result.JobID, result.Output.Path)
+			m.jobDone(w, result.JobID)
 			if m.onComplete != nil {
 				m.onComplete(result)
 			}
@@ -224,12 +442,29 @@ func (m *Manager) handleWorkerOutput(w *Worker) {
 				continue
 			}
 			log.Printf("ERROR - Worker %d: job %s FAILED: %s", w.id, result.JobID, result.Error)
+			m.jobDone(w, result.JobID)
 			if m.onError != nil {
 				m.onError(result)
 			}
 
+		case "debug_result":
+			var resp DebugResponse
+			if err := json.Unmarshal(msg.Data, &resp); err != nil {
+				log.Printf("Worker %d: invalid debug result: %v", w.id, err)
+				continue
+			}
+			m.deliverDebug(&resp)
+
 		case "ready":
 			log.Printf("Worker %d: ready", w.id)
+			var ready struct {
+				Versions map[string]string `json:"versions"`
+			}
+			if len(msg.Data) > 0 && json.Unmarshal(msg.Data, &ready) == nil && len(ready.Versions) > 0 {
+				m.versionsMu.Lock()
+				m.versions = ready.Versions
+				m.versionsMu.Unlock()
+			}
 		}
 	}
 }
@@ -253,6 +488,13 @@ func (m *Manager) handleWorkerLogs(w *Worker) {
 
 		// Log with worker ID prefix
 		log.Printf("Worker %d: %s", w.id, line)
+		if w.logs != nil {
+			w.logs.Add(line)
+		}
+
+		if jobID, onJobLog := m.runningJob(w); jobID != "" && onJobLog != nil {
+			onJobLog(jobID, line)
+		}
 	}
 
 	// Log when stderr closes (worker exited)
@@ -273,13 +515,17 @@ func (m *Manager) SubmitJob(job *JobRequest) error {
 		return fmt.Errorf("no workers available")
 	}
 
+	// Prefer an idle worker, then fall back to round-robin
 	var worker *Worker
-	for i := 0; i < len(m.workers); i++ {
-		idx := (m.nextWorker + i) % len(m.workers)
-		if m.workers[idx].running {
-			worker = m.workers[idx]
-			m.nextWorker = (idx + 1) % len(m.workers)
-			break
+	for pass := 0; pass < 2 && worker == nil; pass++ {
+		for i := 0; i < len(m.workers); i++ {
+			idx := (m.nextWorker + i) % len(m.workers)
+			w := m.workers[idx]
+			if w.running && (pass == 1 || w.inFlight == 0) {
+				worker = w
+				m.nextWorker = (idx + 1) % len(m.workers)
+				break
+			}
 		}
 	}
 	if worker == nil {
@@ -311,6 +557,30 @@ func (m *Manager) SubmitJob(job *JobRequest) error {
 		return fmt.Errorf("send to worker: %w", err)
 	}
 
+	worker.inFlight++
+	worker.jobs = append(worker.jobs, job.ID)
+	if len(job.Stages) > 0 {
+		m.stages[job.ID] = job.Stages
+	}
+	worker.lastActive = time.Now()
+	worker.unloaded = false
+
 	log.Printf("Job %s successfully sent to worker %d", job.ID, worker.id)
 	return nil
 }
+
+// Versions returns the Python and package versions the workers reported
+// when they started, or nil before any worker is ready
+func (m *Manager) Versions() map[string]string {
+	m.versionsMu.Lock()
+	defer m.versionsMu.Unlock()
+
+	if m.versions == nil {
+		return nil
+	}
+	versions := make(map[string]string, len(m.versions))
+	for k, v := range m.versions {
+		versions[k] = v
+	}
+	return versions
+}
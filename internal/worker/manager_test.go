@@ -2,9 +2,12 @@ package worker
 
 import (
 	"encoding/json"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/druarnfield/diffbox/internal/config"
+	"github.com/druarnfield/diffbox/internal/workflow"
 )
 
 func TestNewManager(t *testing.T) {
@@ -154,7 +157,7 @@ func TestJobResultSerialization(t *testing.T) {
 	result := JobResult{
 		JobID:  "job-999",
 		Status: "completed",
-		Output: "/outputs/job-999.mp4",
+		Output: JobOutput{Type: "video", Path: "/outputs/job-999.mp4"},
 	}
 
 	data, err := json.Marshal(result)
@@ -170,7 +173,129 @@ func TestJobResultSerialization(t *testing.T) {
 	if decoded.Status != result.Status {
 		t.Errorf("Status mismatch: got %s, expected %s", decoded.Status, result.Status)
 	}
-	if decoded.Output != result.Output {
-		t.Errorf("Output mismatch: got %s, expected %s", decoded.Output, result.Output)
+	if decoded.Output.Path != result.Output.Path {
+		t.Errorf("Output mismatch: got %s, expected %s", decoded.Output.Path, result.Output.Path)
+	}
+}
+
+func TestJobLogCallback(t *testing.T) {
+	m := NewManager(&config.Config{})
+	requests, replies := fakeWorker(t, m, 0)
+	go func() {
+		var msg WorkerMessage
+		for requests.Decode(&msg) == nil {
+		}
+	}()
+
+	stderrR, stderrW := io.Pipe()
+	defer stderrW.Close()
+	w := m.workers[0]
+	w.stderr = stderrR
+
+	lines := make(chan string, 4)
+	m.SetJobLogCallback(func(jobID, line string) {
+		lines <- jobID + ": " + line
+	})
+	go m.handleWorkerLogs(w)
+
+	if err := m.SubmitJob(&JobRequest{ID: "job-1", Type: "i2v"}); err != nil {
+		t.Fatalf("SubmitJob failed: %v", err)
+	}
+	io.WriteString(stderrW, "step 3/8\n")
+
+	select {
+	case got := <-lines:
+		if got != "job-1: step 3/8" {
+			t.Errorf("unexpected log line %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for job log line")
+	}
+
+	data, _ := json.Marshal(JobResult{JobID: "job-1"})
+	replies.Encode(WorkerMessage{Type: "complete", Data: data})
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if jobID, _ := m.runningJob(w); jobID == "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job still attributed after completion")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Lines written between jobs aren't attributed to any job
+	io.WriteString(stderrW, "idle\n")
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case got := <-lines:
+		t.Errorf("unexpected log line after completion %q", got)
+	default:
+	}
+}
+
+func TestJobResultOutput(t *testing.T) {
+	var result JobResult
+	data := `{"job_id":"job-1","status":"completed","output":{"type":"video","path":"/outputs/job-1.mp4","frames":81,"seed":42}}`
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatalf("failed to parse object output: %v", err)
+	}
+	if result.Output.Path != "/outputs/job-1.mp4" || result.Output.Frames != 81 {
+		t.Errorf("unexpected output %+v", result.Output)
+	}
+	if result.Output.Seed == nil || *result.Output.Seed != 42 {
+		t.Errorf("expected seed 42, got %v", result.Output.Seed)
+	}
+
+	// Older workers reported just the path
+	result = JobResult{}
+	if err := json.Unmarshal([]byte(`{"job_id":"job-2","output":"/outputs/job-2.png"}`), &result); err != nil {
+		t.Fatalf("failed to parse string output: %v", err)
+	}
+	if result.Output.Path != "/outputs/job-2.png" || result.Output.Seed != nil {
+		t.Errorf("unexpected output %+v", result.Output)
+	}
+}
+
+func TestStageWeightedProgress(t *testing.T) {
+	m := NewManager(&config.Config{})
+	requests, replies := fakeWorker(t, m, 0)
+	go func() {
+		var msg WorkerMessage
+		for requests.Decode(&msg) == nil {
+		}
+	}()
+
+	updates := make(chan ProgressUpdate, 4)
+	m.SetCallbacks(func(p ProgressUpdate) { updates <- p }, nil, nil)
+
+	stages := []workflow.Stage{{Name: workflow.StageLoadModels, Weight: 1}, {Name: workflow.StageDenoise, Weight: 3}}
+	if err := m.SubmitJob(&JobRequest{ID: "job-1", Type: "i2v", Stages: stages}); err != nil {
+		t.Fatalf("SubmitJob failed: %v", err)
+	}
+
+	send := func(p ProgressUpdate) ProgressUpdate {
+		t.Helper()
+		data, _ := json.Marshal(p)
+		replies.Encode(WorkerMessage{Type: "progress", JobID: p.JobID, Data: data})
+		select {
+		case got := <-updates:
+			return got
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for progress")
+			return ProgressUpdate{}
+		}
+	}
+
+	if got := send(ProgressUpdate{JobID: "job-1", Progress: 0.9, StageID: workflow.StageDenoise, StageProgress: 0.5}); got.Progress != 0.625 {
+		t.Errorf("weighted progress = %v, want 0.625", got.Progress)
+	}
+	// Without a known stage the worker's own figure stands
+	if got := send(ProgressUpdate{JobID: "job-1", Progress: 0.3, StageID: "upscale", StageProgress: 0.5}); got.Progress != 0.3 {
+		t.Errorf("progress for an unknown stage = %v, want 0.3", got.Progress)
+	}
+	if got := send(ProgressUpdate{JobID: "job-1", Progress: 0.4}); got.Progress != 0.4 {
+		t.Errorf("progress without a stage = %v, want 0.4", got.Progress)
 	}
 }
@@ -0,0 +1,220 @@
+package worker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/workflow"
+)
+
+// MockWorkerCommand is the server subcommand that runs the mock worker.
+// In test mode the manager spawns the server binary itself with it
+// instead of the Python worker.
+const MockWorkerCommand = "mock-worker"
+
+// MockFailMarker in a job's prompt makes the mock worker fail the job
+const MockFailMarker = "mock:fail"
+
+// MockCrashMarker in a job's prompt makes the mock worker exit partway
+// through the job without reporting on it
+const MockCrashMarker = "mock:crash"
+
+var errMockCrash = errors.New("crash requested by job")
+
+// mockStage is a progress update the mock worker sends, after waiting
+// for the simulated time the stage took
+type mockStage struct {
+	progress      float64
+	stage         string
+	stageID       string // The workflow stage, reported with stageProgress
+	stageProgress float64
+	took          time.Duration
+}
+
+// mockStages are the progress updates the mock worker sends for each job
+// when it isn't simulating
+var mockStages = []mockStage{
+	{0.1, "Loading models", workflow.StageLoadModels, 0, 0},
+	{0.5, "Sampling", workflow.StageDenoise, 0.5, 0},
+	{0.9, "Decoding", workflow.StageDecode, 0, 0},
+}
+
+// MockOptions configure the mock worker
+type MockOptions struct {
+	OutputsDir string
+	// Simulate paces each job like the real workflow, reporting every
+	// sampling step, and writes outputs at the requested size
+	Simulate bool
+	// Speed divides the simulated durations
+	Speed float64
+}
+
+// mockPNG is a 1x1 transparent PNG, written as every image output
+var mockPNG, _ = base64.StdEncoding.DecodeString(
+	"iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg==")
+
+// RunMock speaks the worker protocol on in and out without a GPU or
+// Python: every job reports progress and completes with a placeholder
+// output in the outputs dir, unless its prompt contains MockFailMarker or
+// MockCrashMarker.
+// It returns when in closes or a shutdown arrives.
+func RunMock(in io.Reader, out io.Writer, opts MockOptions) error {
+	enc := json.NewEncoder(out)
+	send := func(msgType, jobID string, data interface{}) error {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(WorkerMessage{Type: msgType, JobID: jobID, Data: raw})
+	}
+
+	name := "mock"
+	if opts.Simulate {
+		name = "simulator"
+	}
+	if err := send("ready", "", map[string]interface{}{
+		"versions": map[string]string{"worker": name},
+	}); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(in)
+	for {
+		var msg WorkerMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read message: %w", err)
+		}
+
+		var err error
+		switch msg.Type {
+		case "shutdown":
+			return nil
+		case "debug":
+			err = mockDebug(msg.Data, send)
+		case "job":
+			err = mockJob(msg.Data, opts, send)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// mockDebug answers debug commands: unloading trivially succeeds and
+// anything else isn't supported
+func mockDebug(data json.RawMessage, send func(string, string, interface{}) error) error {
+	var req DebugRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("decode debug request: %w", err)
+	}
+	resp := DebugResponse{ID: req.ID}
+	if req.Command == "unload" {
+		resp.Result = json.RawMessage(`{"unloaded":[]}`)
+	} else {
+		resp.Error = fmt.Sprintf("mock worker has no %q command", req.Command)
+	}
+	return send("debug_result", "", resp)
+}
+
+func mockJob(data json.RawMessage, opts MockOptions, send func(string, string, interface{}) error) error {
+	var job JobRequest
+	if err := json.Unmarshal(data, &job); err != nil {
+		return fmt.Errorf("decode job: %w", err)
+	}
+
+	stages := mockStages
+	if opts.Simulate {
+		stages = simulatedStages(job, opts.Speed)
+	}
+	for _, s := range stages {
+		time.Sleep(s.took)
+		update := ProgressUpdate{
+			JobID:         job.ID,
+			Progress:      s.progress,
+			Stage:         s.stage,
+			StageID:       s.stageID,
+			StageProgress: s.stageProgress,
+		}
+		if err := send("progress", job.ID, update); err != nil {
+			return err
+		}
+	}
+
+	prompt, _ := job.Params["prompt"].(string)
+	if strings.Contains(prompt, MockCrashMarker) {
+		if err := send("progress", job.ID, ProgressUpdate{JobID: job.ID, Progress: 0.5, Stage: "Crashing"}); err != nil {
+			return err
+		}
+		return errMockCrash
+	}
+	if strings.Contains(prompt, MockFailMarker) {
+		return send("error", job.ID, JobResult{JobID: job.ID, Status: "failed", Error: "mock failure requested"})
+	}
+
+	if job.Type == "chat" {
+		// Chat replies travel in the result rather than a file
+		return send("complete", job.ID, JobResult{JobID: job.ID, Status: "completed"})
+	}
+	output, err := writeMockOutput(job, opts)
+	if err != nil {
+		return send("error", job.ID, JobResult{JobID: job.ID, Status: "failed", Error: err.Error()})
+	}
+	return send("complete", job.ID, JobResult{JobID: job.ID, Status: "completed", Output: output})
+}
+
+// writeMockOutput writes the placeholder output of a job: a tiny PNG for
+// image workflows and a stub file for video ones, or when simulating, a
+// pattern at the requested size
+func writeMockOutput(job JobRequest, opts MockOptions) (JobOutput, error) {
+	kind := outputKind(job)
+	seed := int64(42)
+	if s, ok := job.Params["seed"].(float64); ok && s >= 0 {
+		seed = int64(s)
+	}
+
+	ext := ".mp4"
+	if kind == "image" {
+		ext = ".png"
+	}
+	path := filepath.Join(opts.OutputsDir, job.ID+ext)
+	if err := os.MkdirAll(opts.OutputsDir, 0755); err != nil {
+		return JobOutput{}, err
+	}
+
+	output := JobOutput{Type: kind, Path: path, Seed: &seed}
+	var err error
+	switch {
+	case opts.Simulate && kind == "image":
+		err = writeSimulatedImage(path, job, seed)
+	case opts.Simulate:
+		output.Frames, err = writeSimulatedVideo(path, job)
+	case kind == "image":
+		err = os.WriteFile(path, mockPNG, 0644)
+	default:
+		err = os.WriteFile(path, []byte("mock video\n"), 0644)
+	}
+	if err != nil {
+		return JobOutput{}, err
+	}
+	return output, nil
+}
+
+// outputKind is "image" or "video", whichever the job produces
+func outputKind(job JobRequest) string {
+	switch {
+	case job.Workflow != nil:
+		return job.Workflow.Output
+	case job.Type == "qwen":
+		return "image"
+	}
+	return "video"
+}
@@ -0,0 +1,19 @@
+package worker
+
+import "github.com/druarnfield/diffbox/internal/workflow"
+
+// weighProgress sets the overall progress of an update that names a stage
+// from the job's stage weights. Updates without a stage, or naming one the
+// job doesn't have, keep the progress the worker sent.
+func (m *Manager) weighProgress(progress *ProgressUpdate) {
+	if progress.StageID == "" {
+		return
+	}
+	m.mu.Lock()
+	stages := m.stages[progress.JobID]
+	m.mu.Unlock()
+
+	if overall, ok := workflow.Overall(stages, progress.StageID, progress.StageProgress); ok {
+		progress.Progress = overall
+	}
+}
@@ -0,0 +1,166 @@
+package worker
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/workflow"
+)
+
+// simProfile is roughly how long a workflow takes on a 24 GB GPU with warm
+// models: the model load before the first step, each sampling step at the
+// reference size, and decoding the result
+type simProfile struct {
+	load   time.Duration
+	step   time.Duration
+	decode time.Duration
+	steps  int // default sampling steps
+	// width, height and frames the step time was measured at
+	width, height, frames int
+}
+
+var simProfiles = map[string]simProfile{
+	"i2v":  {load: 30 * time.Second, step: 12 * time.Second, decode: 10 * time.Second, steps: 8, width: 832, height: 480, frames: 81},
+	"svi":  {load: 40 * time.Second, step: 15 * time.Second, decode: 20 * time.Second, steps: 8, width: 832, height: 480, frames: 81},
+	"qwen": {load: 20 * time.Second, step: 2 * time.Second, decode: 2 * time.Second, steps: 4, width: 1024, height: 1024},
+}
+
+// defaultSimProfile paces custom workflows
+var defaultSimProfile = simProfile{load: 15 * time.Second, step: 4 * time.Second, decode: 4 * time.Second, steps: 20}
+
+// chatStages are the stages of the chat worker, which doesn't step
+var chatStages = []mockStage{
+	{0.1, "Loading model...", workflow.StageLoadModels, 0, 5 * time.Second},
+	{0.3, "Preparing prompt...", workflow.StageGenerate, 0, 200 * time.Millisecond},
+	{0.5, "Generating response...", workflow.StageGenerate, 0.2, time.Second},
+	{0.9, "Processing output...", workflow.StageGenerate, 0.9, 4 * time.Second},
+}
+
+// simulatedStages lays out the progress updates of a job the way the
+// Python worker reports them, timed from the workflow's profile and scaled
+// by the job's size. Speed divides every duration.
+func simulatedStages(job JobRequest, speed float64) []mockStage {
+	if speed <= 0 {
+		speed = 1
+	}
+	scale := func(d time.Duration) time.Duration {
+		return time.Duration(float64(d) / speed)
+	}
+
+	if job.Type == "chat" {
+		stages := make([]mockStage, len(chatStages))
+		for i, s := range chatStages {
+			stages[i] = s
+			stages[i].took = scale(s.took)
+		}
+		return stages
+	}
+
+	profile, ok := simProfiles[job.Type]
+	if !ok {
+		profile = defaultSimProfile
+	}
+	steps := paramInt(job.Params, "num_inference_steps", profile.steps)
+	step := profile.step
+	if profile.width > 0 {
+		width := paramInt(job.Params, "width", profile.width)
+		height := paramInt(job.Params, "height", profile.height)
+		step = time.Duration(float64(step) * float64(width*height) / float64(profile.width*profile.height))
+	}
+	if profile.frames > 0 {
+		frames := paramInt(job.Params, "num_frames", profile.frames)
+		step = time.Duration(float64(step) * float64(frames) / float64(profile.frames))
+	}
+
+	kind := outputKind(job)
+	stages := []mockStage{
+		{0.05, "Uploading input " + inputKind(job), workflow.StageLoadModels, 0, scale(500 * time.Millisecond)},
+		{0.10, "Building workflow", workflow.StageLoadModels, 0, scale(100 * time.Millisecond)},
+		{0.10, "Starting ComfyUI execution", workflow.StageEncode, 0, scale(profile.load)},
+	}
+	for i := 1; i <= steps; i++ {
+		stages = append(stages, mockStage{
+			progress:      0.10 + 0.85*float64(i)/float64(steps),
+			stage:         fmt.Sprintf("Step %d/%d", i, steps),
+			stageID:       workflow.StageDenoise,
+			stageProgress: float64(i) / float64(steps),
+			took:          scale(step),
+		})
+	}
+	// Videos are encoded after decoding, and both come back as the output
+	last := mockStage{0.95, "Downloading output " + kind, workflow.StageEncodeVideo, 0, scale(profile.decode)}
+	if kind == "image" {
+		last.stageID, last.stageProgress = workflow.StageDecode, 1
+	}
+	return append(stages,
+		mockStage{0.95, "Decoding", workflow.StageDecode, 0, 0},
+		last,
+		mockStage{1.0, "Complete", last.stageID, 1, scale(500 * time.Millisecond)},
+	)
+}
+
+// inputKind names what a job uploads first, as the Python worker does
+func inputKind(job JobRequest) string {
+	if job.Workflow != nil {
+		return "files"
+	}
+	return "image"
+}
+
+// paramInt reads a positive integer job parameter, or returns def
+func paramInt(params map[string]interface{}, key string, def int) int {
+	if v, ok := params[key].(float64); ok && v > 0 {
+		return int(v)
+	}
+	return def
+}
+
+// writeSimulatedImage writes a PNG of the requested size, shaded from the
+// seed so different seeds give visibly different outputs
+func writeSimulatedImage(path string, job JobRequest, seed int64) error {
+	width := min(paramInt(job.Params, "width", 1024), 4096)
+	height := min(paramInt(job.Params, "height", 1024), 4096)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	hue := uint8(seed % 256)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{
+				R: uint8(x * 255 / width),
+				G: uint8(y * 255 / height),
+				B: hue,
+				A: 255,
+			})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// writeSimulatedVideo renders ffmpeg's test pattern at the requested size
+// and length, or writes a stub file if ffmpeg isn't installed. It returns
+// the frame count.
+func writeSimulatedVideo(path string, job JobRequest) (int, error) {
+	width := paramInt(job.Params, "width", 832)
+	height := paramInt(job.Params, "height", 480)
+	frames := paramInt(job.Params, "num_frames", 81)
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return frames, os.WriteFile(path, []byte("simulated video\n"), 0644)
+	}
+	cmd := exec.Command("ffmpeg", "-y", "-loglevel", "error",
+		"-f", "lavfi", "-i", fmt.Sprintf("testsrc2=size=%dx%d:rate=16", width, height),
+		"-frames:v", fmt.Sprint(frames), "-pix_fmt", "yuv420p", path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("ffmpeg: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return frames, nil
+}
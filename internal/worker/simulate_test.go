@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"bufio"
+	"encoding/json"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSimulatedStages(t *testing.T) {
+	job := JobRequest{ID: "a", Type: "i2v", Params: map[string]interface{}{
+		"num_inference_steps": float64(4),
+	}}
+	stages := simulatedStages(job, 1)
+
+	var names []string
+	var total time.Duration
+	for i, s := range stages {
+		names = append(names, s.stage)
+		total += s.took
+		if i > 0 && s.progress < stages[i-1].progress {
+			t.Errorf("progress went backwards at %q", s.stage)
+		}
+	}
+	want := "Uploading input image,Building workflow,Starting ComfyUI execution," +
+		"Step 1/4,Step 2/4,Step 3/4,Step 4/4,Decoding,Downloading output video,Complete"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("stages = %s", got)
+	}
+	if stages[len(stages)-1].progress != 1 {
+		t.Errorf("last stage at %v, want 1", stages[len(stages)-1].progress)
+	}
+
+	// Twice the frames takes twice as long per step, and speed divides it
+	long := simulatedStages(JobRequest{Type: "i2v", Params: map[string]interface{}{
+		"num_inference_steps": float64(4),
+		"num_frames":          float64(162),
+	}}, 1)
+	if long[3].took != 2*stages[3].took {
+		t.Errorf("step at 162 frames took %v, want %v", long[3].took, 2*stages[3].took)
+	}
+	fast := simulatedStages(job, 10)
+	if fast[3].took != stages[3].took/10 {
+		t.Errorf("step at 10x took %v, want %v", fast[3].took, stages[3].took/10)
+	}
+	if total < time.Minute {
+		t.Errorf("an I2V job simulated in %v, which isn't realistic", total)
+	}
+}
+
+func TestSimulatedImageOutput(t *testing.T) {
+	dir := t.TempDir()
+	job := JobRequest{ID: "img", Type: "qwen", Params: map[string]interface{}{
+		"width": float64(96), "height": float64(64), "seed": float64(3),
+	}}
+	output, err := writeMockOutput(job, MockOptions{OutputsDir: dir, Simulate: true})
+	if err != nil {
+		t.Fatalf("writeMockOutput: %v", err)
+	}
+	if output.Type != "image" || output.Path != filepath.Join(dir, "img.png") || *output.Seed != 3 {
+		t.Errorf("unexpected output %+v", output)
+	}
+
+	f, err := os.Open(output.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, err := png.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("output isn't a PNG: %v", err)
+	}
+	if cfg.Width != 96 || cfg.Height != 64 {
+		t.Errorf("output is %dx%d, want 96x64", cfg.Width, cfg.Height)
+	}
+}
+
+func TestRunMockSimulated(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- RunMock(inR, outW, MockOptions{OutputsDir: t.TempDir(), Simulate: true, Speed: 1e6})
+		outW.Close()
+	}()
+
+	enc := json.NewEncoder(inW)
+	go func() {
+		raw, _ := json.Marshal(JobRequest{ID: "chat-1", Type: "chat", Params: map[string]interface{}{}})
+		enc.Encode(WorkerMessage{Type: "job", Data: raw})
+		enc.Encode(WorkerMessage{Type: "shutdown"})
+	}()
+
+	var types []string
+	scanner := bufio.NewScanner(outR)
+	for scanner.Scan() {
+		var msg WorkerMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("bad message %s", scanner.Text())
+		}
+		types = append(types, msg.Type)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("RunMock: %v", err)
+	}
+	want := "ready,progress,progress,progress,progress,complete"
+	if got := strings.Join(types, ","); got != want {
+		t.Errorf("messages = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,146 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// unloadTimeout bounds a single unload, which waits behind any running job
+const unloadTimeout = time.Minute
+
+// Unload asks a worker to drop its loaded pipelines from VRAM. The worker
+// keeps running and reloads models on its next job.
+func (m *Manager) Unload(ctx context.Context, workerID int) (*DebugResponse, error) {
+	resp, err := m.Debug(ctx, workerID, "unload", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Error == "" {
+		m.mu.Lock()
+		for _, w := range m.workers {
+			if w.id == workerID {
+				w.unloaded = true
+			}
+		}
+		m.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// jobDone records that a worker finished a job
+func (m *Manager) jobDone(w *Worker, jobID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if w.inFlight > 0 {
+		w.inFlight--
+	}
+	for i, id := range w.jobs {
+		if id == jobID {
+			w.jobs = append(w.jobs[:i], w.jobs[i+1:]...)
+			break
+		}
+	}
+	w.lastActive = time.Now()
+	delete(m.stages, jobID)
+}
+
+// workerExited forgets the jobs a worker had when it exited and passes
+// them to the exit callback
+func (m *Manager) workerExited(w *Worker, err error) {
+	m.mu.Lock()
+	jobs := w.jobs
+	w.jobs = nil
+	w.inFlight = 0
+	for _, id := range jobs {
+		delete(m.stages, id)
+	}
+	onExit := m.onExit
+	m.mu.Unlock()
+
+	if onExit != nil {
+		onExit(w.id, jobs, err)
+	}
+}
+
+// runningJob returns the job a worker is working on, the oldest one sent
+// to it, and the log callback
+func (m *Manager) runningJob(w *Worker) (string, JobLogCallback) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(w.jobs) == 0 {
+		return "", m.onJobLog
+	}
+	return w.jobs[0], m.onJobLog
+}
+
+// IdleWorkers is the number of running workers without a job
+func (m *Manager) IdleWorkers() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, w := range m.workers {
+		if w.running && w.inFlight == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// idleWorkers returns running workers with no jobs that haven't been used
+// for at least timeout and still hold their models
+func (m *Manager) idleWorkers(timeout time.Duration) []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []int
+	for _, w := range m.workers {
+		if !w.running || w.inFlight > 0 || w.unloaded || w.lastActive.IsZero() {
+			continue
+		}
+		if time.Since(w.lastActive) >= timeout {
+			ids = append(ids, w.id)
+		}
+	}
+	return ids
+}
+
+// RunIdleUnload unloads models from workers that have been idle for
+// timeout until ctx is cancelled. Workers that never ran a job are skipped
+// since they have nothing loaded.
+func (m *Manager) RunIdleUnload(ctx context.Context, timeout time.Duration) {
+	interval := timeout / 4
+	if interval < 5*time.Second {
+		interval = 5 * time.Second
+	}
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, id := range m.idleWorkers(timeout) {
+			unloadCtx, cancel := context.WithTimeout(ctx, unloadTimeout)
+			resp, err := m.Unload(unloadCtx, id)
+			cancel()
+			switch {
+			case err != nil:
+				log.Printf("Worker %d: idle unload failed: %v", id, err)
+			case resp.Error != "":
+				log.Printf("Worker %d: idle unload failed: %s", id, resp.Error)
+			default:
+				log.Printf("Worker %d: unloaded models after %s idle", id, timeout)
+			}
+		}
+	}
+}
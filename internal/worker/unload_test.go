@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/druarnfield/diffbox/internal/config"
+)
+
+func TestIdleWorkers(t *testing.T) {
+	m := NewManager(&config.Config{})
+	m.workers = []*Worker{
+		{id: 0, running: true}, // never ran a job
+		{id: 1, running: true, lastActive: time.Now().Add(-time.Hour)}, // idle
+		{id: 2, running: true, lastActive: time.Now().Add(-time.Hour), inFlight: 1},
+		{id: 3, running: true, lastActive: time.Now().Add(-time.Hour), unloaded: true},
+		{id: 4, running: true, lastActive: time.Now()},
+	}
+
+	ids := m.idleWorkers(30 * time.Minute)
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("expected only worker 1 idle, got %v", ids)
+	}
+}
+
+func TestUnloadMarksWorker(t *testing.T) {
+	m := NewManager(&config.Config{})
+	requests, replies := fakeWorker(t, m, 0)
+	m.workers[0].lastActive = time.Now().Add(-time.Hour)
+
+	go func() {
+		var msg WorkerMessage
+		if err := requests.Decode(&msg); err != nil {
+			return
+		}
+		var req DebugRequest
+		json.Unmarshal(msg.Data, &req)
+		data, _ := json.Marshal(DebugResponse{ID: req.ID, Result: json.RawMessage(`{"unloaded":["svi"]}`)})
+		replies.Encode(WorkerMessage{Type: "debug_result", Data: data})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := m.Unload(ctx, 0); err != nil {
+		t.Fatalf("Unload failed: %v", err)
+	}
+	if ids := m.idleWorkers(time.Minute); len(ids) != 0 {
+		t.Errorf("unloaded worker still reported idle: %v", ids)
+	}
+}
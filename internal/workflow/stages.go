@@ -0,0 +1,115 @@
+package workflow
+
+import "fmt"
+
+// Stage names workers report. A workflow may name others.
+const (
+	StageLoadModels  = "load_models"
+	StageEncode      = "encode" // Text and image conditioning
+	StageDenoise     = "denoise"
+	StageDecode      = "decode"
+	StageEncodeVideo = "encode_video"
+	StageGenerate    = "generate" // Chat token generation
+)
+
+// Stage is a named part of a job with its share of the work. Weights are
+// relative, so a workflow's need not add up to one.
+type Stage struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+}
+
+// builtinStages are the stages of the hand-written workflows, weighted by
+// their typical share of run time
+var builtinStages = map[string][]Stage{
+	"i2v": {
+		{StageLoadModels, 0.15},
+		{StageEncode, 0.05},
+		{StageDenoise, 0.65},
+		{StageDecode, 0.10},
+		{StageEncodeVideo, 0.05},
+	},
+	// SVI denoises and decodes each clip in turn, so its stages repeat
+	"svi": {
+		{StageLoadModels, 0.10},
+		{StageEncode, 0.05},
+		{StageDenoise, 0.70},
+		{StageDecode, 0.10},
+		{StageEncodeVideo, 0.05},
+	},
+	"qwen": {
+		{StageLoadModels, 0.15},
+		{StageEncode, 0.05},
+		{StageDenoise, 0.70},
+		{StageDecode, 0.10},
+	},
+	"chat": {
+		{StageLoadModels, 0.30},
+		{StageGenerate, 0.70},
+	},
+}
+
+// defaultStages are used for custom workflows that don't declare theirs
+var defaultStages = map[string][]Stage{
+	OutputVideo: builtinStages["i2v"],
+	OutputImage: builtinStages["qwen"],
+}
+
+// Stages returns a job type's stages, or nil for job types that only
+// report overall progress
+func (r *Registry) Stages(jobType string) []Stage {
+	if stages, ok := builtinStages[jobType]; ok {
+		return stages
+	}
+	def := r.Get(jobType)
+	if def == nil {
+		return nil
+	}
+	if len(def.Stages) > 0 {
+		return def.Stages
+	}
+	return defaultStages[def.Output]
+}
+
+// Overall is a job's overall progress, from 0 to 1, while it is
+// progress of the way through the named stage: the weights of the stages
+// before it plus its share of this one. It returns false for a stage the
+// workflow doesn't have.
+func Overall(stages []Stage, stage string, progress float64) (float64, bool) {
+	progress = min(max(progress, 0), 1)
+	var total, done float64
+	found := false
+	for _, s := range stages {
+		total += s.Weight
+		switch {
+		case found:
+		case s.Name == stage:
+			done += s.Weight * progress
+			found = true
+		default:
+			done += s.Weight
+		}
+	}
+	if !found || total <= 0 {
+		return 0, false
+	}
+	return done / total, true
+}
+
+// validateStages checks declared stages have distinct names and positive
+// weights
+func validateStages(stages []Stage) error {
+	seen := make(map[string]bool, len(stages))
+	for _, s := range stages {
+		switch {
+		case s.Name == "":
+			return fmt.Errorf("stages: name is required")
+		case seen[s.Name]:
+			return fmt.Errorf("stages: %q is listed twice", s.Name)
+		case s.Weight <= 0:
+			return fmt.Errorf("stages: %s must have a positive weight", s.Name)
+		}
+		seen[s.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package workflow
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestOverall(t *testing.T) {
+	stages := []Stage{{StageLoadModels, 1}, {StageDenoise, 2}, {StageDecode, 1}}
+	tests := []struct {
+		stage    string
+		progress float64
+		want     float64
+	}{
+		{StageLoadModels, 0, 0},
+		{StageLoadModels, 1, 0.25},
+		{StageDenoise, 0.5, 0.5},
+		{StageDecode, 1, 1},
+		{StageDecode, 2, 1}, // Clamped
+	}
+	for _, tt := range tests {
+		got, ok := Overall(stages, tt.stage, tt.progress)
+		if !ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Overall(%s, %v) = %v, %v; want %v", tt.stage, tt.progress, got, ok, tt.want)
+		}
+	}
+	if _, ok := Overall(stages, StageEncodeVideo, 0.5); ok {
+		t.Error("expected an unknown stage to be rejected")
+	}
+	if _, ok := Overall(nil, StageDenoise, 0.5); ok {
+		t.Error("expected no stages to be rejected")
+	}
+}
+
+func TestRegistryStages(t *testing.T) {
+	custom := strings.Replace(testDefinition, `"models": [`, `"stages": [{"name": "denoise", "weight": 3}, {"name": "upscale", "weight": 1}], "models": [`, 1)
+	r, err := Load(writeFiles(t, map[string]string{
+		"sketch.workflow.json": custom,
+		"sketch.json":          testTemplate,
+	}))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if stages := r.Stages("sketch"); len(stages) != 2 || stages[1].Name != "upscale" {
+		t.Errorf("declared stages = %v", stages)
+	}
+	if stages := r.Stages("i2v"); len(stages) == 0 || stages[len(stages)-1].Name != StageEncodeVideo {
+		t.Errorf("i2v stages = %v", stages)
+	}
+	if stages := r.Stages("concat"); stages != nil {
+		t.Errorf("expected no stages for concat, got %v", stages)
+	}
+
+	// Custom workflows without stages get the defaults for their output
+	r.defs["sketch"].Stages = nil
+	if stages := r.Stages("sketch"); len(stages) != len(builtinStages["qwen"]) {
+		t.Errorf("default stages = %v", stages)
+	}
+	var nilRegistry *Registry
+	if stages := nilRegistry.Stages("qwen"); len(stages) == 0 {
+		t.Error("expected built-in stages without a registry")
+	}
+}
@@ -0,0 +1,343 @@
+// Package workflow loads custom workflow definitions: JSON files that
+// declare a job type, its parameter schema and defaults, the models it
+// needs, and a ComfyUI template the parameters are bound into. The server
+// registers a submit endpoint and model manifest entries for each one, so
+// a new pipeline needs a definition file rather than Go changes.
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Param types
+const (
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	TypeImage   = "image" // base64 image, uploaded to ComfyUI by the worker
+	// TypeVideo names a completed chunked upload ("upload:<id>"). The
+	// worker receives its file path and uploads it to ComfyUI.
+	TypeVideo = "video"
+)
+
+// Output kinds
+const (
+	OutputVideo = "video"
+	OutputImage = "image"
+)
+
+// builtinTypes are served by hand-written handlers and can't be redefined
+var builtinTypes = map[string]bool{"i2v": true, "svi": true, "qwen": true, "chat": true}
+
+var typePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,39}$`)
+
+// Param describes one request parameter
+type Param struct {
+	Type        string      `json:"type"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Min         *float64    `json:"min,omitempty"`
+	Max         *float64    `json:"max,omitempty"`
+	MaxLength   int         `json:"max_length,omitempty"`
+	Enum        []string    `json:"enum,omitempty"`
+	// Bind lists the template inputs the value is written to, as
+	// "<node id>.<input name>"
+	Bind []string `json:"bind"`
+}
+
+// Model is a file the workflow needs, added to the download manifest. A
+// URL starting with "/" is relative to the HuggingFace endpoint, so
+// mirrors apply. Mirrors lists other URLs for the same file.
+type Model struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Mirrors []string `json:"mirrors,omitempty"`
+	Size    int64    `json:"size"`
+	SHA256  string   `json:"sha256,omitempty"`
+}
+
+// Definition is one custom workflow
+type Definition struct {
+	Type        string           `json:"type"`
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Output      string           `json:"output"`
+	Params      map[string]Param `json:"params"`
+	Models      []Model          `json:"models,omitempty"`
+	// Stages weight the parts of a job for its overall progress. Without
+	// them the defaults for the output kind apply.
+	Stages []Stage `json:"stages,omitempty"`
+	// TemplateFile is the ComfyUI API-format workflow, relative to the
+	// definition file
+	TemplateFile string `json:"template"`
+
+	// Template is the parsed TemplateFile
+	Template map[string]interface{} `json:"-"`
+	// Source is the definition file it was loaded from
+	Source string `json:"-"`
+}
+
+// Spec is what a worker needs to run a custom job, sent with the job
+type Spec struct {
+	Output   string                 `json:"output"`
+	Template map[string]interface{} `json:"template"`
+	Params   map[string]ParamSpec   `json:"params"`
+}
+
+// ParamSpec is the part of a Param the worker uses
+type ParamSpec struct {
+	Type string   `json:"type"`
+	Bind []string `json:"bind"`
+}
+
+// Spec returns the worker's view of the definition
+func (d *Definition) Spec() *Spec {
+	params := make(map[string]ParamSpec, len(d.Params))
+	for name, p := range d.Params {
+		params[name] = ParamSpec{Type: p.Type, Bind: p.Bind}
+	}
+	return &Spec{Output: d.Output, Template: d.Template, Params: params}
+}
+
+// Registry holds the loaded definitions by job type
+type Registry struct {
+	defs map[string]*Definition
+}
+
+// Load reads every *.json definition in dir. A missing dir is an empty
+// registry. Any invalid definition fails the load, naming the file, so a
+// typo is caught at startup rather than on the first job.
+func Load(dir string) (*Registry, error) {
+	r := &Registry{defs: make(map[string]*Definition)}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.workflow.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		def, err := loadDefinition(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		if other, ok := r.defs[def.Type]; ok {
+			return nil, fmt.Errorf("%s: type %q already defined by %s", filepath.Base(path), def.Type, filepath.Base(other.Source))
+		}
+		r.defs[def.Type] = def
+	}
+	return r, nil
+}
+
+func loadDefinition(path string) (*Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var def Definition
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	def.Source = path
+
+	if def.TemplateFile == "" {
+		return nil, fmt.Errorf("template is required")
+	}
+	templatePath := def.TemplateFile
+	if !filepath.IsAbs(templatePath) {
+		templatePath = filepath.Join(filepath.Dir(path), templatePath)
+	}
+	data, err = os.ReadFile(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	if err := json.Unmarshal(data, &def.Template); err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+
+	if err := def.validate(); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// validate checks a definition is self-consistent and that every binding
+// points at an input the template has
+func (d *Definition) validate() error {
+	switch {
+	case !typePattern.MatchString(d.Type):
+		return fmt.Errorf("type %q must be lowercase letters, digits, - or _", d.Type)
+	case builtinTypes[d.Type]:
+		return fmt.Errorf("type %q is a built-in workflow", d.Type)
+	case d.Output != OutputVideo && d.Output != OutputImage:
+		return fmt.Errorf("output must be %q or %q", OutputVideo, OutputImage)
+	case len(d.Params) == 0:
+		return fmt.Errorf("params is required")
+	}
+	if d.Name == "" {
+		d.Name = d.Type
+	}
+
+	for name, p := range d.Params {
+		switch p.Type {
+		case TypeString, TypeInteger, TypeNumber, TypeBoolean, TypeImage, TypeVideo:
+		default:
+			return fmt.Errorf("param %s: unknown type %q", name, p.Type)
+		}
+		if len(p.Bind) == 0 {
+			return fmt.Errorf("param %s: bind is required", name)
+		}
+		for _, target := range p.Bind {
+			node, input, ok := strings.Cut(target, ".")
+			if !ok {
+				return fmt.Errorf("param %s: bind %q must be <node id>.<input>", name, target)
+			}
+			n, ok := d.Template[node].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("param %s: template has no node %q", name, node)
+			}
+			inputs, _ := n["inputs"].(map[string]interface{})
+			if _, ok := inputs[input]; !ok {
+				return fmt.Errorf("param %s: node %s has no input %q", name, node, input)
+			}
+		}
+		if p.Default != nil {
+			if _, msg := p.check(p.Default); msg != "" {
+				return fmt.Errorf("param %s: default %s", name, msg)
+			}
+		}
+	}
+
+	for _, m := range d.Models {
+		if m.Name == "" || m.URL == "" {
+			return fmt.Errorf("models: name and url are required")
+		}
+	}
+	return validateStages(d.Stages)
+}
+
+// Get returns the definition for a job type, or nil
+func (r *Registry) Get(jobType string) *Definition {
+	if r == nil {
+		return nil
+	}
+	return r.defs[jobType]
+}
+
+// List returns all definitions sorted by type
+func (r *Registry) List() []*Definition {
+	if r == nil {
+		return nil
+	}
+	defs := make([]*Definition, 0, len(r.defs))
+	for _, d := range r.defs {
+		defs = append(defs, d)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Type < defs[j].Type })
+	return defs
+}
+
+// Validate checks request params against the schema and returns them with
+// defaults applied and numbers coerced to their declared type. Unknown
+// params are rejected so typos don't silently do nothing. fieldErrors is
+// nil when the params are valid.
+func (d *Definition) Validate(params map[string]interface{}) (map[string]interface{}, map[string]string) {
+	out := make(map[string]interface{}, len(d.Params))
+	fieldErrors := make(map[string]string)
+
+	for name := range params {
+		if _, ok := d.Params[name]; !ok {
+			fieldErrors[name] = "unknown parameter"
+		}
+	}
+	for name, p := range d.Params {
+		v, ok := params[name]
+		if !ok || v == nil {
+			if p.Default != nil {
+				v, _ = p.check(p.Default)
+				out[name] = v
+			} else if p.Required {
+				fieldErrors[name] = "is required"
+			}
+			continue
+		}
+		v, msg := p.check(v)
+		if msg != "" {
+			fieldErrors[name] = msg
+			continue
+		}
+		out[name] = v
+	}
+
+	if len(fieldErrors) > 0 {
+		return nil, fieldErrors
+	}
+	return out, nil
+}
+
+// check validates one value, returning it normalized or a message saying
+// what's wrong
+func (p Param) check(v interface{}) (interface{}, string) {
+	switch p.Type {
+	case TypeString, TypeImage, TypeVideo:
+		s, ok := v.(string)
+		if !ok {
+			return nil, "must be a string"
+		}
+		if p.MaxLength > 0 && len(s) > p.MaxLength {
+			return nil, fmt.Sprintf("too long (max %d characters)", p.MaxLength)
+		}
+		if len(p.Enum) > 0 && !contains(p.Enum, s) {
+			return nil, "must be one of " + strings.Join(p.Enum, ", ")
+		}
+		if p.Required && s == "" {
+			return nil, "is required"
+		}
+		return s, ""
+	case TypeBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, "must be true or false"
+		}
+		return b, ""
+	case TypeInteger, TypeNumber:
+		f, ok := v.(float64)
+		if !ok {
+			if n, isInt := v.(int); isInt {
+				f, ok = float64(n), true
+			}
+		}
+		if !ok {
+			return nil, "must be a number"
+		}
+		if p.Min != nil && f < *p.Min {
+			return nil, fmt.Sprintf("must be at least %g", *p.Min)
+		}
+		if p.Max != nil && f > *p.Max {
+			return nil, fmt.Sprintf("must be at most %g", *p.Max)
+		}
+		if p.Type == TypeInteger {
+			if f != float64(int64(f)) {
+				return nil, "must be a whole number"
+			}
+			return int64(f), ""
+		}
+		return f, ""
+	}
+	return nil, "has an unknown type"
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package workflow
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testTemplate = `{
+  "1": {"class_type": "CLIPTextEncode", "inputs": {"text": ""}},
+  "2": {"class_type": "KSampler", "inputs": {"seed": 0, "steps": 20, "cfg": 7.0}},
+  "3": {"class_type": "LoadImage", "inputs": {"image": "input.png"}}
+}`
+
+const testDefinition = `{
+  "type": "sketch",
+  "name": "Sketch to image",
+  "output": "image",
+  "template": "sketch.json",
+  "params": {
+    "prompt": {"type": "string", "required": true, "max_length": 100, "bind": ["1.text"]},
+    "steps": {"type": "integer", "default": 20, "min": 1, "max": 50, "bind": ["2.steps"]},
+    "cfg_scale": {"type": "number", "default": 4.5, "bind": ["2.cfg"]},
+    "seed": {"type": "integer", "bind": ["2.seed"]},
+    "sketch": {"type": "image", "required": true, "bind": ["3.image"]},
+    "style": {"type": "string", "enum": ["ink", "pencil"], "bind": ["1.text"]}
+  },
+  "models": [{"name": "sketch.safetensors", "url": "/org/sketch/resolve/main/sketch.safetensors", "size": 1000}]
+}`
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"sketch.workflow.json": testDefinition,
+		"sketch.json":          testTemplate,
+	})
+
+	r, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	def := r.Get("sketch")
+	if def == nil {
+		t.Fatal("sketch not registered")
+	}
+	if len(def.Template) != 3 || len(r.List()) != 1 {
+		t.Errorf("unexpected registry contents: %d nodes, %d definitions", len(def.Template), len(r.List()))
+	}
+	if spec := def.Spec(); spec.Params["prompt"].Bind[0] != "1.text" || spec.Output != OutputImage {
+		t.Errorf("unexpected spec: %+v", spec)
+	}
+
+	empty, err := Load(filepath.Join(dir, "missing"))
+	if err != nil || len(empty.List()) != 0 {
+		t.Errorf("missing dir should load empty, got %v, %v", empty, err)
+	}
+}
+
+func TestLoadRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace [2]string
+		want    string
+	}{
+		{"builtin type", [2]string{`"type": "sketch"`, `"type": "qwen"`}, "built-in"},
+		{"bad output", [2]string{`"output": "image"`, `"output": "audio"`}, "output"},
+		{"unknown node", [2]string{`"bind": ["1.text"]}`, `"bind": ["9.text"]}`}, "no node"},
+		{"unknown input", [2]string{`["2.steps"]`, `["2.denoise"]`}, "no input"},
+		{"bad param type", [2]string{`"type": "number"`, `"type": "float"`}, "unknown type"},
+		{"bad default", [2]string{`"default": 20`, `"default": 99`}, "default"},
+		{"zero stage weight", [2]string{`"models": [`, `"stages": [{"name": "denoise", "weight": 0}], "models": [`}, "positive weight"},
+		{"repeated stage", [2]string{`"models": [`, `"stages": [{"name": "denoise", "weight": 1}, {"name": "denoise", "weight": 1}], "models": [`}, "twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{
+				"sketch.workflow.json": strings.Replace(testDefinition, tt.replace[0], tt.replace[1], 1),
+				"sketch.json":          testTemplate,
+			})
+			_, err := Load(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "sketch.workflow.json") {
+				t.Errorf("error should name the file: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"sketch.workflow.json": testDefinition,
+		"sketch.json":          testTemplate,
+	})
+	r, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := r.Get("sketch")
+
+	params, fieldErrors := def.Validate(map[string]interface{}{
+		"prompt": "a lighthouse",
+		"sketch": "aGVsbG8=",
+		"steps":  float64(30),
+	})
+	if fieldErrors != nil {
+		t.Fatalf("unexpected field errors: %v", fieldErrors)
+	}
+	if params["steps"] != int64(30) || params["cfg_scale"] != 4.5 {
+		t.Errorf("expected coerced steps and default cfg, got %v", params)
+	}
+	if _, ok := params["seed"]; ok {
+		t.Errorf("seed without a default should stay unset")
+	}
+
+	_, fieldErrors = def.Validate(map[string]interface{}{
+		"prompt": strings.Repeat("x", 101),
+		"steps":  2.5,
+		"style":  "oil",
+		"extra":  true,
+	})
+	for _, field := range []string{"prompt", "steps", "style", "extra", "sketch"} {
+		if fieldErrors[field] == "" {
+			t.Errorf("expected an error for %s, got %v", field, fieldErrors)
+		}
+	}
+}
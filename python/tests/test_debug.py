@@ -0,0 +1,71 @@
+"""Tests for the worker debug channel."""
+
+import json
+from io import StringIO
+from unittest.mock import patch
+
+import pytest
+
+from worker.debug import run_debug
+from worker.protocol import send_debug_result
+
+
+def test_ping():
+    """Ping echoes the worker ID."""
+    assert run_debug("ping", {}, {"worker_id": "3"}) == {
+        "pong": True,
+        "worker_id": "3",
+    }
+
+
+def test_models_reports_handlers():
+    """Models lists instantiated handlers and whether they hold a model."""
+
+    class FakeHandler:
+        llm = object()
+
+    result = run_debug("models", {}, {"handlers": {"chat": FakeHandler()}})
+    assert result["handlers"]["chat"] == {
+        "handler": "FakeHandler",
+        "model_loaded": True,
+    }
+
+
+def test_unload_drops_models():
+    """Unload asks each handler to drop its model, skipping ComfyUI."""
+
+    class FakeHandler:
+        def __init__(self, loaded):
+            self.pipeline = object() if loaded else None
+
+        def unload(self):
+            loaded = self.pipeline is not None
+            self.pipeline = None
+            return loaded
+
+    handlers = {"svi": FakeHandler(True), "chat": FakeHandler(False)}
+    result = run_debug("unload", {"comfyui": False}, {"handlers": handlers})
+    assert result["unloaded"] == ["svi"]
+    assert "comfyui" not in result
+    assert handlers["svi"].pipeline is None
+
+
+def test_unknown_command():
+    """Unknown commands list the available ones."""
+    with pytest.raises(ValueError, match="available"):
+        run_debug("rm -rf", {}, {})
+
+
+def test_send_debug_result():
+    """Debug results carry the request ID back to Go."""
+    out = StringIO()
+    with patch("sys.stdout", out):
+        send_debug_result("req-1", result={"pong": True})
+        send_debug_result("req-2", error="boom")
+
+    first, second = [json.loads(line) for line in out.getvalue().splitlines()]
+    assert first == {
+        "type": "debug_result",
+        "data": {"id": "req-1", "result": {"pong": True}},
+    }
+    assert second["data"] == {"id": "req-2", "error": "boom"}
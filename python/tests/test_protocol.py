@@ -4,7 +4,7 @@ import json
 from io import StringIO
 from unittest.mock import patch
 
-from worker.protocol import read_message
+from worker.protocol import read_message, send_ready
 
 
 def test_read_message_valid():
@@ -24,3 +24,14 @@ def test_read_message_empty():
         result = read_message()
 
     assert result is None
+
+
+def test_send_ready_reports_versions():
+    """Test that the ready message carries runtime versions."""
+    out = StringIO()
+    with patch("sys.stdout", out):
+        send_ready()
+
+    msg = json.loads(out.getvalue())
+    assert msg["type"] == "ready"
+    assert "python" in msg["data"]["versions"]
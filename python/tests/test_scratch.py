@@ -0,0 +1,28 @@
+"""Tests for per-job scratch directories."""
+
+import os
+import tempfile
+
+from worker.scratch import scratch_dir
+
+
+def test_scratch_dir_redirects_tempfiles(tmp_path):
+    """Temp files created during a job land in its scratch directory."""
+    job_dir = tmp_path / "job-1"
+    before = tempfile.gettempdir()
+
+    with scratch_dir(str(job_dir)):
+        with tempfile.NamedTemporaryFile(delete=False) as f:
+            created = f.name
+        assert os.environ["TMPDIR"] == str(job_dir)
+
+    assert os.path.dirname(created) == str(job_dir)
+    assert tempfile.gettempdir() == before
+
+
+def test_scratch_dir_none_is_noop():
+    """Jobs without a scratch directory use the normal temp directory."""
+    before = tempfile.gettempdir()
+    with scratch_dir(None) as path:
+        assert path is None
+        assert tempfile.gettempdir() == before
@@ -0,0 +1,48 @@
+"""Tests for job stage reporting."""
+
+import json
+from io import StringIO
+from unittest.mock import patch
+
+from worker import stages
+
+
+def test_node_stage():
+    """Test that ComfyUI node types map to the stages they run in."""
+    assert stages.node_stage("CheckpointLoaderSimple") == stages.LOAD_MODELS
+    assert stages.node_stage("CLIPTextEncode") == stages.ENCODE
+    assert stages.node_stage("WanImageToVideo") == stages.ENCODE
+    assert stages.node_stage("KSamplerAdvanced") == stages.DENOISE
+    assert stages.node_stage("VAEDecodeTiled") == stages.DECODE
+    assert stages.node_stage("VHS_VideoCombine") == stages.ENCODE_VIDEO
+    assert stages.node_stage("LoadImage") is None
+
+
+def test_workflow_stages():
+    """Test that only nodes with a stage are mapped."""
+    workflow = {
+        "1": {"class_type": "UNETLoader", "inputs": {}},
+        "2": {"class_type": "KSampler", "inputs": {}},
+        "3": {"class_type": "PrimitiveNode", "inputs": {}},
+    }
+    assert stages.workflow_stages(workflow) == {
+        "1": stages.LOAD_MODELS,
+        "2": stages.DENOISE,
+    }
+
+
+def test_stage_reporter():
+    """Test that progress is reported within the current stage."""
+    out = StringIO()
+    with patch("sys.stdout", out):
+        reporter = stages.StageReporter("job-1")
+        reporter.on_stage(stages.LOAD_MODELS)
+        reporter.on_stage(stages.DENOISE)
+        reporter.on_progress(0.5, "Step 10/20")
+
+    msgs = [json.loads(line) for line in out.getvalue().splitlines()]
+    # Entering the stage it starts in sends nothing
+    assert [m["data"]["stage_id"] for m in msgs] == [stages.DENOISE] * 2
+    assert msgs[0]["data"]["stage_progress"] == 0.0
+    assert msgs[1]["data"]["stage_progress"] == 0.5
+    assert msgs[1]["data"]["progress"] == 0.10 + 0.5 * 0.85
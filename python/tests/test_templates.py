@@ -0,0 +1,27 @@
+"""Tests for ComfyUI workflow template helpers."""
+
+from worker.comfyui_templates import ComfyUIWorkflowBuilder
+
+
+def test_apply_bindings_writes_bound_inputs():
+    """Param values land in every input they're bound to."""
+    workflow = {
+        "1": {"class_type": "CLIPTextEncode", "inputs": {"text": ""}},
+        "2": {"class_type": "KSampler", "inputs": {"seed": 0, "steps": 20}},
+        "3": {"class_type": "KSampler", "inputs": {"seed": 0, "steps": 20}},
+    }
+    params = {
+        "prompt": {"type": "string", "bind": ["1.text"]},
+        "seed": {"type": "integer", "bind": ["2.seed", "3.seed"]},
+        "steps": {"type": "integer", "bind": ["2.steps"]},
+    }
+
+    ComfyUIWorkflowBuilder().apply_bindings(
+        workflow, params, {"prompt": "a lighthouse", "seed": 42}
+    )
+
+    assert workflow["1"]["inputs"]["text"] == "a lighthouse"
+    assert workflow["2"]["inputs"]["seed"] == 42
+    assert workflow["3"]["inputs"]["seed"] == 42
+    # Unset params keep the template's value
+    assert workflow["2"]["inputs"]["steps"] == 20
@@ -18,7 +18,15 @@ logger = logging.getLogger("worker")
 # Add parent directory to path for diffsynth import
 sys.path.insert(0, os.path.dirname(os.path.dirname(os.path.abspath(__file__))))
 
-from worker.protocol import read_message, send_ready, send_complete, send_error  # noqa: E402
+from worker.protocol import (  # noqa: E402
+    read_message,
+    send_ready,
+    send_complete,
+    send_error,
+    send_debug_result,
+)
+from worker.debug import run_debug  # noqa: E402
+from worker.scratch import scratch_dir  # noqa: E402
 
 
 def main():
@@ -52,6 +60,10 @@ def main():
                 from worker.chat import ChatHandler
 
                 handlers[job_type] = ChatHandler(models_dir, outputs_dir)
+            elif job_type == "custom":
+                from worker.custom import CustomWorkflowHandler
+
+                handlers[job_type] = CustomWorkflowHandler(models_dir, outputs_dir)
             else:
                 raise ValueError(f"Unknown job type: {job_type}")
         return handlers[job_type]
@@ -72,18 +84,38 @@ def main():
                 logger.info(f"Worker {worker_id} shutting down...")
                 break
 
+            elif msg_type == "debug":
+                request = msg.get("data", {})
+                request_id = request.get("id", "")
+                try:
+                    result = run_debug(
+                        request.get("command", ""),
+                        request.get("args", {}),
+                        {"worker_id": worker_id, "handlers": handlers},
+                    )
+                    send_debug_result(request_id, result=result)
+                except Exception as e:
+                    logger.error(f"Debug command failed: {e}", exc_info=True)
+                    send_debug_result(request_id, error=f"{type(e).__name__}: {e}")
+
             elif msg_type == "job":
                 job_data = msg.get("data", {})
                 job_id = job_data.get("id")
                 job_type = job_data.get("type")
                 params = job_data.get("params", {})
+                job_scratch = job_data.get("scratch_dir")
+                # Custom workflows send their template and bindings
+                spec = job_data.get("workflow")
 
                 logger.info(f"Processing job {job_id} ({job_type})")
                 logger.debug(f"Job {job_id} params: {params}")
 
                 try:
-                    handler = get_handler(job_type)
-                    result = handler.run(job_id, params)
+                    with scratch_dir(job_scratch):
+                        if spec:
+                            result = get_handler("custom").run(job_id, params, spec)
+                        else:
+                            result = get_handler(job_type).run(job_id, params)
                     send_complete(job_id, result)
                     logger.info(f"Job {job_id} completed successfully")
                 except Exception as e:
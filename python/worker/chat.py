@@ -5,6 +5,7 @@ Chat handler using vLLM for Dolphin-Mistral model.
 import logging
 from pathlib import Path
 
+from worker import stages
 from worker.protocol import send_progress
 
 logger = logging.getLogger(__name__)
@@ -39,6 +40,14 @@ class ChatHandler:
 
         logger.info("Dolphin-Mistral model loaded successfully")
 
+    def unload(self) -> bool:
+        """Drop the vLLM engine so its VRAM can be reclaimed."""
+        if self.llm is None:
+            return False
+        logger.info("Unloading Dolphin-Mistral model")
+        self.llm = None
+        return True
+
     def run(self, job_id: str, params: dict) -> dict:
         """
         Execute chat inference.
@@ -57,7 +66,7 @@ class ChatHandler:
         """
         from vllm import SamplingParams
 
-        send_progress(job_id, 0.1, "Loading model...")
+        send_progress(job_id, 0.1, "Loading model...", stage_id=stages.LOAD_MODELS)
         self._load_model()
 
         # Extract parameters
@@ -69,14 +78,20 @@ class ChatHandler:
         if not messages:
             raise ValueError("No messages provided")
 
-        send_progress(job_id, 0.3, "Preparing prompt...")
+        send_progress(
+            job_id,
+            0.3,
+            "Preparing prompt...",
+            stage_id=stages.LOAD_MODELS,
+            stage_progress=1.0,
+        )
 
         # Format messages using ChatML format (standard for Mistral-based models)
         prompt = self._format_messages(messages)
 
         logger.info(f"Generated prompt length: {len(prompt)} chars")
 
-        send_progress(job_id, 0.5, "Generating response...")
+        send_progress(job_id, 0.5, "Generating response...", stage_id=stages.GENERATE)
 
         # Configure sampling
         sampling_params = SamplingParams(
@@ -88,7 +103,13 @@ class ChatHandler:
         # Generate
         outputs = self.llm.generate([prompt], sampling_params)
 
-        send_progress(job_id, 0.9, "Processing output...")
+        send_progress(
+            job_id,
+            0.9,
+            "Processing output...",
+            stage_id=stages.GENERATE,
+            stage_progress=1.0,
+        )
 
         # Extract response
         if not outputs or not outputs[0].outputs:
@@ -13,6 +13,8 @@ import aiohttp
 import websockets
 from PIL import Image
 
+from worker.stages import workflow_stages
+
 logger = logging.getLogger(__name__)
 
 
@@ -68,6 +70,42 @@ class ComfyUIClient:
                 logger.info(f"Image uploaded as: {uploaded_name}")
                 return uploaded_name
 
+    async def upload_file(self, path: str, filename: str) -> str:
+        """
+        Upload a file from disk (e.g. a video) to ComfyUI's input directory.
+
+        Args:
+            path: Local path of the file to upload
+            filename: Filename to save as
+
+        Returns:
+            Uploaded filename (may be modified by server)
+        """
+        logger.info(f"Uploading file: {path} as {filename}")
+
+        async with aiohttp.ClientSession() as session:
+            with open(path, "rb") as f:
+                data = aiohttp.FormData()
+                data.add_field(
+                    "image",
+                    f,
+                    filename=filename,
+                    content_type="application/octet-stream",
+                )
+                async with session.post(
+                    f"{self.base_url}/upload/image", data=data
+                ) as resp:
+                    if resp.status != 200:
+                        error_text = await resp.text()
+                        raise RuntimeError(
+                            f"File upload failed ({resp.status}): {error_text}"
+                        )
+
+                    result = await resp.json()
+                    uploaded_name = result.get("name", filename)
+                    logger.info(f"File uploaded as: {uploaded_name}")
+                    return uploaded_name
+
     async def queue_prompt(self, workflow: Dict[str, Any]) -> str:
         """
         Submit a workflow to ComfyUI's queue.
@@ -102,6 +140,8 @@ class ComfyUIClient:
         prompt_id: str,
         on_progress: Optional[Callable[[float, str], None]] = None,
         timeout: int = 600,
+        node_stages: Optional[Dict[str, str]] = None,
+        on_stage: Optional[Callable[[str], None]] = None,
     ) -> Dict[str, Any]:
         """
         Track workflow execution via WebSocket and wait for completion.
@@ -110,6 +150,8 @@ class ComfyUIClient:
             prompt_id: Prompt ID from queue_prompt()
             on_progress: Callback for progress updates (progress: 0.0-1.0, stage: str)
             timeout: Maximum seconds to wait for completion
+            node_stages: Stage each node ID runs in, from workflow_stages()
+            on_stage: Callback when execution reaches a node in node_stages
 
         Returns:
             Execution history with output file paths
@@ -190,6 +232,8 @@ class ComfyUIClient:
                             break
                         else:
                             logger.debug(f"Executing node: {node}")
+                            if on_stage and node_stages and node in node_stages:
+                                on_stage(node_stages[node])
 
                     elif msg_type == "executed":
                         # Node execution finished (may have outputs)
@@ -322,6 +366,7 @@ class ComfyUIClient:
         workflow: Dict[str, Any],
         on_progress: Optional[Callable[[float, str], None]] = None,
         timeout: int = 600,
+        on_stage: Optional[Callable[[str], None]] = None,
     ) -> Dict[str, Any]:
         """
         Execute a complete workflow: queue → track → get outputs.
@@ -330,6 +375,7 @@ class ComfyUIClient:
             workflow: ComfyUI workflow JSON
             on_progress: Progress callback
             timeout: Execution timeout in seconds
+            on_stage: Called with each stage (see worker.stages) execution enters
 
         Returns:
             Dict with 'history' and 'outputs' keys
@@ -338,7 +384,13 @@ class ComfyUIClient:
         prompt_id = await self.queue_prompt(workflow)
 
         # Track execution
-        history = await self.track_progress(prompt_id, on_progress, timeout)
+        history = await self.track_progress(
+            prompt_id,
+            on_progress,
+            timeout,
+            node_stages=workflow_stages(workflow),
+            on_stage=on_stage,
+        )
 
         # Extract output file info
         outputs = self.extract_outputs(history)
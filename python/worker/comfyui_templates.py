@@ -57,6 +57,7 @@ class ComfyUIWorkflowBuilder:
         seed: Optional[int] = None,
         cfg_scale: float = 7.0,
         motion_bucket_id: int = 127,
+        models: Optional[Dict[str, str]] = None,
     ) -> Dict[str, Any]:
         """
         Build I2V (image-to-video) workflow.
@@ -69,6 +70,7 @@ class ComfyUIWorkflowBuilder:
             seed: Random seed (None = random)
             cfg_scale: Classifier-free guidance scale
             motion_bucket_id: Motion strength (0-255)
+            models: Loader input overrides, e.g. {"ckpt_name": "file.safetensors"}
 
         Returns:
             Complete ComfyUI workflow dict
@@ -113,6 +115,7 @@ class ComfyUIWorkflowBuilder:
                 node["inputs"]["frame_rate"] = fps
                 node["inputs"]["format"] = "video/h264-mp4"
 
+        self.apply_models(workflow, models)
         logger.debug(f"I2V workflow built with {len(workflow)} nodes")
         return workflow
 
@@ -124,6 +127,7 @@ class ComfyUIWorkflowBuilder:
         seed: Optional[int] = None,
         cfg_scale: float = 7.0,
         steps: int = 28,
+        models: Optional[Dict[str, str]] = None,
     ) -> Dict[str, Any]:
         """
         Build Qwen image editing workflow.
@@ -135,6 +139,7 @@ class ComfyUIWorkflowBuilder:
             seed: Random seed (None = random)
             cfg_scale: Classifier-free guidance scale
             steps: Number of diffusion steps
+            models: Loader input overrides, e.g. {"ckpt_name": "file.safetensors"}
 
         Returns:
             Complete ComfyUI workflow dict
@@ -172,9 +177,59 @@ class ComfyUIWorkflowBuilder:
             if class_type == "KSampler" and mask_path:
                 node["inputs"]["denoise"] = 1.0  # Full denoise for masked areas
 
+        self.apply_models(workflow, models)
         logger.debug(f"Qwen workflow built with {len(workflow)} nodes")
         return workflow
 
+    def apply_models(
+        self, workflow: Dict[str, Any], models: Optional[Dict[str, str]]
+    ) -> None:
+        """
+        Point loader nodes at different model files.
+
+        Args:
+            workflow: ComfyUI workflow dict, modified in place
+            models: Loader input name to filename. Aliases are resolved by
+                the Go backend before the job reaches the worker.
+        """
+        if not models:
+            return
+
+        applied = set()
+        for node_id, node in workflow.items():
+            inputs = node.get("inputs", {})
+            for input_name, filename in models.items():
+                if input_name in inputs:
+                    logger.info(f"Node {node_id}: {input_name} -> {filename}")
+                    inputs[input_name] = filename
+                    applied.add(input_name)
+
+        for input_name in models.keys() - applied:
+            logger.warning(f"No loader input {input_name}, override ignored")
+
+    def apply_bindings(
+        self,
+        workflow: Dict[str, Any],
+        params: Dict[str, Dict[str, Any]],
+        values: Dict[str, Any],
+    ) -> None:
+        """
+        Write job params into the inputs a custom workflow binds them to.
+
+        Args:
+            workflow: ComfyUI workflow dict, modified in place
+            params: Param name to its spec, with "bind" listing targets as
+                "<node id>.<input name>"
+            values: Param values; params without a value keep the
+                template's input
+        """
+        for name, spec in params.items():
+            if name not in values:
+                continue
+            for target in spec.get("bind", []):
+                node_id, input_name = target.split(".", 1)
+                workflow[node_id]["inputs"][input_name] = values[name]
+
     def validate_workflow(self, workflow: Dict[str, Any]) -> bool:
         """
         Validate workflow structure.
@@ -0,0 +1,140 @@
+"""
+Handler for custom workflows declared by definition files on the Go side.
+
+The job carries the ComfyUI template and the node inputs each param is
+bound to, so any pipeline that fits the template model runs here without
+a dedicated handler.
+"""
+
+import asyncio
+import base64
+import copy
+import logging
+import os
+import random
+import time
+from io import BytesIO
+from pathlib import Path
+from typing import Optional
+
+from PIL import Image
+
+from worker.comfyui_client import ComfyUIClient
+from worker.comfyui_templates import ComfyUIWorkflowBuilder
+from worker import stages
+from worker.protocol import send_progress
+
+logger = logging.getLogger("worker.custom")
+
+# Output file extensions when ComfyUI's filename has none
+DEFAULT_EXTENSIONS = {"video": ".mp4", "image": ".png"}
+
+
+class CustomWorkflowHandler:
+    """Runs jobs for custom workflow definitions via ComfyUI."""
+
+    def __init__(self, models_dir: str, outputs_dir: str):
+        self.models_dir = Path(models_dir)
+        self.outputs_dir = Path(outputs_dir)
+        self.comfyui_url = os.getenv("COMFYUI_URL", "http://localhost:8188")
+        self.client: Optional[ComfyUIClient] = None
+        self.workflow_builder: Optional[ComfyUIWorkflowBuilder] = None
+
+    def _init_client(self):
+        """Initialize ComfyUI client and workflow builder (lazy)."""
+        if self.client is None:
+            logger.info(f"Initializing ComfyUI client: {self.comfyui_url}")
+            self.client = ComfyUIClient(base_url=self.comfyui_url)
+            self.workflow_builder = ComfyUIWorkflowBuilder()
+
+    def run(self, job_id: str, params: dict, spec: dict) -> dict:
+        """Run a custom workflow job described by spec."""
+        start_time = time.time()
+        output_kind = spec["output"]
+        param_specs = spec["params"]
+
+        logger.info(f"Starting custom job {job_id} ({output_kind})")
+        self._init_client()
+
+        values = dict(params)
+        if "seed" in param_specs and values.get("seed") in (None, -1):
+            values["seed"] = random.randint(0, 2**32 - 1)
+        logger.info(f"Using seed: {values.get('seed')}")
+
+        # Images are uploaded and bound by their ComfyUI filename
+        send_progress(job_id, 0.05, "Uploading inputs", stage_id=stages.LOAD_MODELS)
+        for name, param in param_specs.items():
+            if param["type"] != "image" or not values.get(name):
+                continue
+            image = Image.open(BytesIO(base64.b64decode(values[name]))).convert("RGB")
+            values[name] = asyncio.run(
+                self.client.upload_image(image, f"custom_{name}_{job_id}.png")
+            )
+            logger.info(f"Uploaded {name} as {values[name]}")
+
+        # Videos arrive as paths to completed chunked uploads on this host
+        for name, param in param_specs.items():
+            if param["type"] != "video" or not values.get(name):
+                continue
+            path = values[name]
+            values[name] = asyncio.run(
+                self.client.upload_file(
+                    path, f"custom_{name}_{job_id}{Path(path).suffix or '.mp4'}"
+                )
+            )
+            logger.info(f"Uploaded {name} as {values[name]}")
+
+        send_progress(job_id, 0.10, "Building workflow", stage_id=stages.LOAD_MODELS)
+        workflow = copy.deepcopy(spec["template"])
+        self.workflow_builder.apply_bindings(workflow, param_specs, values)
+        self.workflow_builder.apply_models(workflow, params.get("models"))
+        self.workflow_builder.validate_workflow(workflow)
+
+        # Maps 0.0-1.0 to the 10%-95% range
+        reporter = stages.StageReporter(job_id)
+
+        result = asyncio.run(
+            self.client.execute_workflow(
+                workflow=workflow,
+                on_progress=reporter.on_progress,
+                timeout=600,
+                on_stage=reporter.on_stage,
+            )
+        )
+
+        outputs = result["outputs"]
+        if output_kind not in outputs:
+            raise RuntimeError(f"No {output_kind} output found in ComfyUI result")
+        info = outputs[output_kind]
+
+        send_progress(
+            job_id,
+            0.95,
+            f"Downloading output {output_kind}",
+            stage_id=reporter.stage,
+            stage_progress=1.0,
+        )
+        data = asyncio.run(
+            self.client.download_output(
+                filename=info["filename"],
+                subfolder=info.get("subfolder", ""),
+                output_type=info.get("type", "output"),
+            )
+        )
+
+        ext = Path(info["filename"]).suffix or DEFAULT_EXTENSIONS[output_kind]
+        self.outputs_dir.mkdir(parents=True, exist_ok=True)
+        output_path = self.outputs_dir / f"{job_id}{ext}"
+        with open(output_path, "wb") as f:
+            f.write(data)
+
+        logger.info(f"Job {job_id} total time: {time.time() - start_time:.1f}s")
+        send_progress(
+            job_id, 1.0, "Complete", stage_id=reporter.stage, stage_progress=1.0
+        )
+
+        return {
+            "type": output_kind,
+            "path": str(output_path),
+            "seed": values.get("seed"),
+        }
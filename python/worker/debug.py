@@ -0,0 +1,184 @@
+"""
+Diagnostic commands for the admin debug channel.
+
+Commands run between jobs on the worker's main loop and return a JSON-able
+dict. They must be cheap and must not load models.
+"""
+
+import gc
+import json
+import logging
+import os
+import urllib.request
+from typing import Any, Callable, Dict
+
+logger = logging.getLogger(__name__)
+
+
+def _torch():
+    """Import torch if it is installed, otherwise return None."""
+    try:
+        import torch
+
+        return torch
+    except ImportError:
+        return None
+
+
+def _comfyui_url() -> str:
+    return os.getenv("COMFYUI_URL", "http://localhost:8188")
+
+
+def _comfyui_system_stats() -> Dict[str, Any]:
+    """Fetch ComfyUI's device stats, which cover the diffusion workflows."""
+    try:
+        with urllib.request.urlopen(_comfyui_url() + "/system_stats", timeout=5) as resp:
+            return json.loads(resp.read())
+    except Exception as e:
+        return {"error": f"{type(e).__name__}: {e}"}
+
+
+def _comfyui_free() -> Dict[str, Any]:
+    """Ask ComfyUI to unload its models and free cached memory."""
+    body = json.dumps({"unload_models": True, "free_memory": True}).encode()
+    req = urllib.request.Request(
+        _comfyui_url() + "/free",
+        data=body,
+        headers={"Content-Type": "application/json"},
+        method="POST",
+    )
+    try:
+        with urllib.request.urlopen(req, timeout=10):
+            return {"freed": True}
+    except Exception as e:
+        return {"freed": False, "error": f"{type(e).__name__}: {e}"}
+
+
+def cmd_ping(ctx: dict, args: dict) -> dict:
+    return {"pong": True, "worker_id": ctx.get("worker_id")}
+
+
+def cmd_vram(ctx: dict, args: dict) -> dict:
+    """VRAM held by this worker process and by ComfyUI."""
+    result: Dict[str, Any] = {"comfyui": _comfyui_system_stats()}
+
+    torch = _torch()
+    if torch is None or not torch.cuda.is_available():
+        result["worker"] = {"cuda": False}
+        return result
+
+    devices = []
+    for i in range(torch.cuda.device_count()):
+        free, total = torch.cuda.mem_get_info(i)
+        devices.append(
+            {
+                "index": i,
+                "name": torch.cuda.get_device_name(i),
+                "allocated": torch.cuda.memory_allocated(i),
+                "reserved": torch.cuda.memory_reserved(i),
+                "free": free,
+                "total": total,
+            }
+        )
+    result["worker"] = {"cuda": True, "devices": devices}
+    return result
+
+
+def cmd_models(ctx: dict, args: dict) -> dict:
+    """Handlers instantiated in this worker and whether they hold a model."""
+    loaded = {}
+    for job_type, handler in ctx.get("handlers", {}).items():
+        loaded[job_type] = {
+            "handler": type(handler).__name__,
+            "model_loaded": any(
+                getattr(handler, attr, None) is not None
+                for attr in ("llm", "pipe", "pipeline", "client")
+            ),
+        }
+    return {"handlers": loaded}
+
+
+def cmd_selftest(ctx: dict, args: dict) -> dict:
+    """
+    Run a tiny matmul on the GPU and compare it with the CPU result. A
+    mismatch points at a broken driver or failing card rather than a bad
+    workflow.
+    """
+    result: Dict[str, Any] = {}
+
+    torch = _torch()
+    if torch is None:
+        result["torch"] = "not installed"
+    else:
+        size = int(args.get("size", 256))
+        generator = torch.Generator().manual_seed(0)
+        a = torch.randn(size, size, generator=generator)
+        b = torch.randn(size, size, generator=generator)
+        expected = a @ b
+
+        if torch.cuda.is_available():
+            got = (a.cuda() @ b.cuda()).cpu()
+            max_error = (got - expected).abs().max().item()
+            result["device"] = torch.cuda.get_device_name(0)
+            result["max_error"] = max_error
+            result["finite"] = bool(torch.isfinite(got).all().item())
+            result["ok"] = result["finite"] and max_error < 1e-2
+        else:
+            result["device"] = "cpu"
+            result["ok"] = bool(torch.isfinite(expected).all().item())
+
+    stats = _comfyui_system_stats()
+    result["comfyui_reachable"] = "error" not in stats
+    return result
+
+
+def cmd_gc(ctx: dict, args: dict) -> dict:
+    """Collect garbage and release cached CUDA memory."""
+    collected = gc.collect()
+    torch = _torch()
+    if torch is not None and torch.cuda.is_available():
+        torch.cuda.empty_cache()
+    return {"collected": collected}
+
+
+def cmd_unload(ctx: dict, args: dict) -> dict:
+    """
+    Drop loaded pipelines from VRAM. Handlers stay registered and reload
+    their models on the next job.
+    """
+    unloaded = []
+    for job_type, handler in ctx.get("handlers", {}).items():
+        unload = getattr(handler, "unload", None)
+        if unload is not None and unload():
+            unloaded.append(job_type)
+
+    result: Dict[str, Any] = {"unloaded": sorted(unloaded)}
+    if args.get("comfyui", True):
+        result["comfyui"] = _comfyui_free()
+
+    result["collected"] = gc.collect()
+    torch = _torch()
+    if torch is not None and torch.cuda.is_available():
+        torch.cuda.empty_cache()
+    return result
+
+
+COMMANDS: Dict[str, Callable[[dict, dict], dict]] = {
+    "ping": cmd_ping,
+    "vram": cmd_vram,
+    "models": cmd_models,
+    "selftest": cmd_selftest,
+    "gc": cmd_gc,
+    "unload": cmd_unload,
+}
+
+
+def run_debug(command: str, args: dict, ctx: dict) -> dict:
+    """Run a diagnostic command, raising ValueError for unknown ones."""
+    fn = COMMANDS.get(command)
+    if fn is None:
+        raise ValueError(
+            f"Unknown debug command {command!r} (available: {', '.join(sorted(COMMANDS))})"
+        )
+    logger.info(f"Running debug command {command}")
+    return fn(ctx, args or {})
@@ -15,6 +15,7 @@ from PIL import Image
 
 from worker.comfyui_client import ComfyUIClient
 from worker.comfyui_templates import ComfyUIWorkflowBuilder
+from worker import stages
 from worker.protocol import send_progress
 
 logger = logging.getLogger("worker.i2v")
@@ -66,7 +67,9 @@ class I2VHandler:
             raise ValueError("input_image is required for I2V")
 
         # Decode and upload input image
-        send_progress(job_id, 0.05, "Uploading input image")
+        send_progress(
+            job_id, 0.05, "Uploading input image", stage_id=stages.LOAD_MODELS
+        )
         image_data = base64.b64decode(input_image_b64)
         input_image = Image.open(BytesIO(image_data)).convert("RGB")
         logger.info(f"Input image size: {input_image.size}")
@@ -87,8 +90,16 @@ class I2VHandler:
             seed = random.randint(0, 2**32 - 1)
         logger.info(f"Using seed: {seed}")
 
+        # Resolved by the server from camera_direction or camera_path
+        camera_motion = params.get("camera_motion")
+        if camera_motion:
+            logger.warning(
+                "Template has no camera conditioning; ignoring camera motion "
+                f"with {len(camera_motion.get('keyframes', []))} keyframes"
+            )
+
         # Build workflow from template
-        send_progress(job_id, 0.10, "Building workflow")
+        send_progress(job_id, 0.10, "Building workflow", stage_id=stages.LOAD_MODELS)
         workflow = self.workflow_builder.build_i2v(
             prompt=prompt,
             image_path=uploaded_filename,
@@ -97,25 +108,29 @@ class I2VHandler:
             seed=seed,
             cfg_scale=cfg_scale,
             motion_bucket_id=motion_bucket_id,
+            models=params.get("models"),
         )
 
         # Validate workflow
         self.workflow_builder.validate_workflow(workflow)
         logger.info(f"Workflow built with {len(workflow)} nodes")
 
-        # Progress callback for ComfyUI execution
-        def on_progress(progress: float, stage: str):
-            # Map 0.0-1.0 to 10%-95% range
-            mapped_progress = 0.10 + (progress * 0.85)
-            send_progress(job_id, mapped_progress, stage)
+        # Progress callbacks for ComfyUI execution, mapping 0.0-1.0 to the
+        # 10%-95% range
+        reporter = stages.StageReporter(job_id)
 
         # Execute workflow
-        send_progress(job_id, 0.10, "Starting ComfyUI execution")
+        send_progress(
+            job_id, 0.10, "Starting ComfyUI execution", stage_id=stages.LOAD_MODELS
+        )
         inference_start = time.time()
 
         result = asyncio.run(
             self.client.execute_workflow(
-                workflow=workflow, on_progress=on_progress, timeout=600
+                workflow=workflow,
+                on_progress=reporter.on_progress,
+                timeout=600,
+                on_stage=reporter.on_stage,
             )
         )
 
@@ -131,7 +146,9 @@ class I2VHandler:
         logger.info(f"Output video: {video_info}")
 
         # Download output video
-        send_progress(job_id, 0.95, "Downloading output video")
+        send_progress(
+            job_id, 0.95, "Downloading output video", stage_id=stages.ENCODE_VIDEO
+        )
         video_bytes = asyncio.run(
             self.client.download_output(
                 filename=video_info["filename"],
@@ -152,7 +169,9 @@ class I2VHandler:
         total_duration = time.time() - start_time
         logger.info(f"Job {job_id} total time: {total_duration:.1f}s")
 
-        send_progress(job_id, 1.0, "Complete")
+        send_progress(
+            job_id, 1.0, "Complete", stage_id=stages.ENCODE_VIDEO, stage_progress=1.0
+        )
 
         return {
             "type": "video",
@@ -27,15 +27,38 @@ def read_message() -> Optional[dict]:
     return json.loads(line.strip())
 
 
+def runtime_versions() -> dict:
+    """Versions of Python and the worker's key packages, for repro reports."""
+    import platform
+    from importlib import metadata
+
+    versions = {"python": platform.python_version()}
+    for package in ("diffbox-worker", "torch", "transformers", "safetensors"):
+        try:
+            versions[package] = metadata.version(package)
+        except metadata.PackageNotFoundError:
+            continue
+    return versions
+
+
 def send_ready():
     """Signal that worker is ready to accept jobs."""
-    send_message("ready")
+    send_message("ready", data={"versions": runtime_versions()})
 
 
 def send_progress(
-    job_id: str, progress: float, stage: str, preview: Optional[str] = None
+    job_id: str,
+    progress: float,
+    stage: str,
+    preview: Optional[str] = None,
+    stage_id: Optional[str] = None,
+    stage_progress: Optional[float] = None,
 ):
-    """Send job progress update."""
+    """
+    Send job progress update. stage_id names the stage the job is in (see
+    worker.stages) and stage_progress is how far through it, from which
+    the server works out overall progress.
+    """
     data = {
         "job_id": job_id,
         "progress": progress,
@@ -43,6 +66,9 @@ def send_progress(
     }
     if preview:
         data["preview"] = preview
+    if stage_id:
+        data["stage_id"] = stage_id
+        data["stage_progress"] = stage_progress or 0.0
     send_message("progress", job_id=job_id, data=data)
 
 
@@ -56,6 +82,18 @@ def send_complete(job_id: str, output: dict):
     send_message("complete", job_id=job_id, data=data)
 
 
+def send_debug_result(
+    request_id: str, result: Optional[dict] = None, error: Optional[str] = None
+):
+    """Send the response to a debug command."""
+    data: dict = {"id": request_id}
+    if error:
+        data["error"] = error
+    else:
+        data["result"] = result
+    send_message("debug_result", data=data)
+
+
 def send_error(job_id: str, error: str):
     """Send job error."""
     data = {
@@ -15,6 +15,7 @@ from PIL import Image
 
 from worker.comfyui_client import ComfyUIClient
 from worker.comfyui_templates import ComfyUIWorkflowBuilder
+from worker import stages
 from worker.protocol import send_progress
 
 logger = logging.getLogger("worker.qwen")
@@ -64,7 +65,9 @@ class QwenHandler:
         if not edit_images_b64:
             raise ValueError("At least one edit_image is required for Qwen Image Edit")
 
-        send_progress(job_id, 0.05, "Uploading input image")
+        send_progress(
+            job_id, 0.05, "Uploading input image", stage_id=stages.LOAD_MODELS
+        )
         image_data = base64.b64decode(edit_images_b64[0])
         input_image = Image.open(BytesIO(image_data)).convert("RGB")
         logger.info(f"Input image size: {input_image.size}")
@@ -86,7 +89,7 @@ class QwenHandler:
         logger.info(f"Using seed: {seed}")
 
         # Build workflow from template
-        send_progress(job_id, 0.10, "Building workflow")
+        send_progress(job_id, 0.10, "Building workflow", stage_id=stages.LOAD_MODELS)
         workflow = self.workflow_builder.build_qwen(
             instruction=instruction,
             image_path=uploaded_filename,
@@ -94,25 +97,29 @@ class QwenHandler:
             seed=seed,
             cfg_scale=cfg_scale,
             steps=steps,
+            models=params.get("models"),
         )
 
         # Validate workflow
         self.workflow_builder.validate_workflow(workflow)
         logger.info(f"Workflow built with {len(workflow)} nodes")
 
-        # Progress callback for ComfyUI execution
-        def on_progress(progress: float, stage: str):
-            # Map 0.0-1.0 to 10%-95% range
-            mapped_progress = 0.10 + (progress * 0.85)
-            send_progress(job_id, mapped_progress, stage)
+        # Progress callbacks for ComfyUI execution, mapping 0.0-1.0 to the
+        # 10%-95% range
+        reporter = stages.StageReporter(job_id)
 
         # Execute workflow
-        send_progress(job_id, 0.10, "Starting ComfyUI execution")
+        send_progress(
+            job_id, 0.10, "Starting ComfyUI execution", stage_id=stages.LOAD_MODELS
+        )
         inference_start = time.time()
 
         result = asyncio.run(
             self.client.execute_workflow(
-                workflow=workflow, on_progress=on_progress, timeout=600
+                workflow=workflow,
+                on_progress=reporter.on_progress,
+                timeout=600,
+                on_stage=reporter.on_stage,
             )
         )
 
@@ -128,7 +135,13 @@ class QwenHandler:
         logger.info(f"Output image: {image_info}")
 
         # Download output image
-        send_progress(job_id, 0.95, "Downloading output image")
+        send_progress(
+            job_id,
+            0.95,
+            "Downloading output image",
+            stage_id=stages.DECODE,
+            stage_progress=1.0,
+        )
         image_bytes = asyncio.run(
             self.client.download_output(
                 filename=image_info["filename"],
@@ -149,7 +162,9 @@ class QwenHandler:
         total_duration = time.time() - start_time
         logger.info(f"Job {job_id} total time: {total_duration:.1f}s")
 
-        send_progress(job_id, 1.0, "Complete")
+        send_progress(
+            job_id, 1.0, "Complete", stage_id=stages.DECODE, stage_progress=1.0
+        )
 
         return {
             "type": "image",
@@ -0,0 +1,33 @@
+"""Per-job scratch directories.
+
+The Go backend creates a private directory for each job and removes it
+after the job finishes. Routing Python's temp files there keeps
+intermediate frames from piling up in the system temp directory.
+"""
+
+import os
+import tempfile
+from contextlib import contextmanager
+
+
+@contextmanager
+def scratch_dir(path: str | None):
+    """Make `path` the temp directory for the duration of a job."""
+    if not path:
+        yield None
+        return
+
+    os.makedirs(path, exist_ok=True)
+    previous_tempdir = tempfile.tempdir
+    previous_env = os.environ.get("TMPDIR")
+
+    tempfile.tempdir = path
+    os.environ["TMPDIR"] = path
+    try:
+        yield path
+    finally:
+        tempfile.tempdir = previous_tempdir
+        if previous_env is None:
+            os.environ.pop("TMPDIR", None)
+        else:
+            os.environ["TMPDIR"] = previous_env
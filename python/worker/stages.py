@@ -0,0 +1,86 @@
+"""
+Job stages reported alongside progress, so the server can weight each
+stage by its share of the job. Names match internal/workflow/stages.go.
+"""
+
+from typing import Any, Dict, Optional
+
+from worker.protocol import send_progress
+
+LOAD_MODELS = "load_models"
+ENCODE = "encode"  # Text and image conditioning
+DENOISE = "denoise"
+DECODE = "decode"
+ENCODE_VIDEO = "encode_video"
+GENERATE = "generate"  # Chat token generation
+
+# Substrings of ComfyUI node class types, checked in order
+_NODE_STAGES = [
+    ("VideoCombine", ENCODE_VIDEO),
+    ("SaveVideo", ENCODE_VIDEO),
+    ("CreateVideo", ENCODE_VIDEO),
+    ("VAEDecode", DECODE),
+    ("Sampler", DENOISE),
+    ("VAEEncode", ENCODE),
+    ("TextEncode", ENCODE),
+    ("VisionEncode", ENCODE),
+    ("ImageToVideo", ENCODE),
+    ("Loader", LOAD_MODELS),
+]
+
+
+def node_stage(class_type: str) -> Optional[str]:
+    """Stage a ComfyUI node runs in, or None for nodes that don't start one."""
+    for fragment, stage in _NODE_STAGES:
+        if fragment in class_type:
+            return stage
+    return None
+
+
+def workflow_stages(workflow: Dict[str, Any]) -> Dict[str, str]:
+    """Map a workflow's node IDs to the stages they run in."""
+    stages = {}
+    for node_id, node in workflow.items():
+        stage = node_stage(node.get("class_type", ""))
+        if stage:
+            stages[node_id] = stage
+    return stages
+
+
+class StageReporter:
+    """
+    Sends progress within the current stage. Overall progress is still
+    sent, mapped into [start, start + span], for servers that don't weight
+    stages.
+    """
+
+    def __init__(self, job_id: str, start: float = 0.10, span: float = 0.85):
+        self.job_id = job_id
+        self.start = start
+        self.span = span
+        self.stage = LOAD_MODELS
+        self.overall = start
+
+    def on_stage(self, stage: str):
+        """Enter a stage as ComfyUI reaches its first node."""
+        if stage == self.stage:
+            return
+        self.stage = stage
+        send_progress(
+            self.job_id,
+            self.overall,
+            stage.replace("_", " ").capitalize(),
+            stage_id=stage,
+            stage_progress=0.0,
+        )
+
+    def on_progress(self, progress: float, message: str):
+        """Report progress within the current stage."""
+        self.overall = self.start + progress * self.span
+        send_progress(
+            self.job_id,
+            self.overall,
+            message,
+            stage_id=self.stage,
+            stage_progress=progress,
+        )
@@ -4,7 +4,9 @@ Wan 2.2 SVI 2.0 Pro (Stable Video Infinity) handler.
 
 import sys
 from pathlib import Path
+from typing import Dict, Optional
 
+from worker import stages
 from worker.protocol import send_progress
 
 
@@ -15,13 +17,22 @@ class SVIHandler:
         self.models_dir = Path(models_dir)
         self.outputs_dir = Path(outputs_dir)
         self.pipeline = None
-
-    def _load_pipeline(self):
-        """Lazy load the pipeline."""
-        if self.pipeline is not None:
+        self.checkpoint: Optional[str] = None
+
+    def _load_pipeline(self, models: Optional[Dict[str, str]] = None):
+        """
+        Lazy load the pipeline, reloading it when a job overrides the
+        checkpoint. Overrides use the i2v loader input names.
+        """
+        checkpoint = (models or {}).get("ckpt_name")
+        if self.pipeline is not None and checkpoint == self.checkpoint:
             return
+        self.checkpoint = checkpoint
 
-        print("Loading SVI 2.0 Pro pipeline...", file=sys.stderr)
+        print(
+            f"Loading SVI 2.0 Pro pipeline ({checkpoint or 'default checkpoint'})...",
+            file=sys.stderr,
+        )
 
         # TODO: Implement actual pipeline loading
         # from diffsynth.pipelines import WanVideoSviProPipeline, ModelConfig
@@ -29,9 +40,17 @@ class SVIHandler:
 
         print("Pipeline loaded.", file=sys.stderr)
 
+    def unload(self) -> bool:
+        """Drop the pipeline so its VRAM can be reclaimed."""
+        if self.pipeline is None:
+            return False
+        print("Unloading SVI 2.0 Pro pipeline...", file=sys.stderr)
+        self.pipeline = None
+        return True
+
     def run(self, job_id: str, params: dict) -> dict:
         """Run SVI inference."""
-        self._load_pipeline()
+        self._load_pipeline(params.get("models"))
 
         # Extract parameters (prefixed with _ as stub - will be used when implemented)
         _prompts = params.get("prompts", [params.get("prompt", "")])
@@ -48,7 +67,9 @@ class SVIHandler:
         _infinite_mode = params.get("infinite_mode", False)
         _loras = params.get("loras", [])
 
-        send_progress(job_id, 0.0, "Starting SVI generation...")
+        send_progress(
+            job_id, 0.0, "Starting SVI generation...", stage_id=stages.LOAD_MODELS
+        )
 
         # TODO: Implement actual SVI inference with clip-by-clip generation
         # For now, simulate progress
@@ -59,7 +80,13 @@ class SVIHandler:
             for step in range(5):  # Simulate steps per clip
                 progress = (clip_idx * 5 + step + 1) / (total_clips * 5)
                 stage = f"Clip {clip_idx + 1}/{total_clips} - Step {step + 1}/5"
-                send_progress(job_id, progress, stage)
+                send_progress(
+                    job_id,
+                    progress,
+                    stage,
+                    stage_id=stages.DENOISE,
+                    stage_progress=progress,
+                )
                 time.sleep(0.2)
 
         # Generate output path
@@ -0,0 +1,30 @@
+import { apiError } from "./errors";
+
+const API_BASE = "/api";
+
+// Also sent over the WebSocket as "system:alert" when one fires or resolves
+export interface Alert {
+  kind: "disk" | "vram";
+  // The directory, or the GPU as "gpu<index>"
+  target: string;
+  state: "firing" | "resolved";
+  free_pct: number;
+  threshold_pct: number;
+  free_bytes: number;
+  total_bytes: number;
+  message: string;
+  since: string;
+  at: string;
+}
+
+// Alerts still firing, for clients that connected after they were broadcast
+export async function fetchAlerts(): Promise<Alert[]> {
+  const response = await fetch(`${API_BASE}/system/alerts`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch alerts");
+  }
+
+  const data: { alerts: Alert[] } = await response.json();
+  return data.alerts;
+}
@@ -0,0 +1,68 @@
+import { apiError } from "./errors";
+
+const API_BASE = "/api";
+
+export interface BenchmarkResult {
+  name: string;
+  workflow: string;
+  job_id?: string;
+  status: string;
+  wait_seconds?: number;
+  run_seconds?: number;
+  error?: string;
+  finished_at?: string;
+  // From the latest earlier run that completed the same case; negative is faster
+  baseline_run_id?: string;
+  baseline_seconds?: number;
+  change_pct?: number;
+}
+
+export interface BenchmarkRun {
+  id: string;
+  label?: string;
+  status: "running" | "completed";
+  environment: {
+    gpus: string[];
+    driver?: string;
+    variant: string;
+    version: string;
+    commit?: string;
+  };
+  created_at: string;
+  results: BenchmarkResult[];
+}
+
+// Without workflows, every workflow enabled in setup is benchmarked
+export async function startBenchmark(request: { label?: string; workflows?: string[] } = {}): Promise<BenchmarkRun> {
+  const response = await fetch(`${API_BASE}/admin/benchmark`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(request),
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to start benchmark");
+  }
+
+  return response.json();
+}
+
+export async function fetchBenchmarks(): Promise<BenchmarkRun[]> {
+  const response = await fetch(`${API_BASE}/admin/benchmarks`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch benchmarks");
+  }
+
+  return response.json();
+}
+
+export async function fetchBenchmark(id: string): Promise<BenchmarkRun> {
+  const response = await fetch(`${API_BASE}/admin/benchmarks/${id}`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch benchmark");
+  }
+
+  return response.json();
+}
@@ -0,0 +1,76 @@
+// Stable error codes returned in the "code" field of API errors
+export type ApiErrorCode =
+  | "INVALID_REQUEST"
+  | "VALIDATION_FAILED"
+  | "NOT_FOUND"
+  | "METHOD_NOT_ALLOWED"
+  | "CONFLICT"
+  | "MODEL_MISSING"
+  | "QUEUE_FULL"
+  | "QUOTA_EXCEEDED"
+  | "INSUFFICIENT_VRAM"
+  | "INSUFFICIENT_DISK"
+  | "MAINTENANCE"
+  | "SHUTTING_DOWN"
+  | "WORKER_UNAVAILABLE"
+  | "WORKER_TIMEOUT"
+  | "FFMPEG_MISSING"
+  | "UNAUTHORIZED"
+  | "FORBIDDEN"
+  | "RATE_LIMITED"
+  | "TIMEOUT"
+  | "INTERNAL";
+
+// The resource a job was refused for by admission control
+export interface ApiErrorResource {
+  name: "vram" | "disk" | "queue" | "quota";
+  required: number;
+  available: number;
+  unit: "MB" | "bytes" | "jobs";
+}
+
+export class ApiError extends Error {
+  status: number;
+  code: ApiErrorCode;
+  fieldErrors: Record<string, string>;
+  jobId?: string;
+  resource?: ApiErrorResource;
+
+  constructor(
+    status: number,
+    code: ApiErrorCode,
+    message: string,
+    fieldErrors: Record<string, string> = {},
+    jobId?: string,
+    resource?: ApiErrorResource,
+  ) {
+    super(message);
+    this.name = "ApiError";
+    this.status = status;
+    this.code = code;
+    this.fieldErrors = fieldErrors;
+    this.jobId = jobId;
+    this.resource = resource;
+  }
+}
+
+// Turns a failed response into an ApiError, falling back to a generic
+// message when the body isn't the JSON error envelope (e.g. a proxy error)
+export async function apiError(
+  response: Response,
+  fallback: string,
+): Promise<ApiError> {
+  try {
+    const body = await response.json();
+    return new ApiError(
+      response.status,
+      body.code ?? "INTERNAL",
+      body.message || fallback,
+      body.field_errors ?? {},
+      body.job_id,
+      body.resource,
+    );
+  } catch {
+    return new ApiError(response.status, "INTERNAL", fallback);
+  }
+}
@@ -0,0 +1,83 @@
+import { apiError } from "./errors";
+
+const API_BASE = "/api";
+
+export interface InputImage {
+  hash: string;
+  // Pass in place of base64 in any job image field
+  ref: string;
+  url: string;
+  format: string;
+  width: number;
+  height: number;
+  size: number;
+  jobs: number;
+  created_at: string;
+  last_used_at?: string;
+  deduplicated?: boolean;
+}
+
+export interface InputUse {
+  job_id?: string;
+  field: string;
+  hash?: string;
+}
+
+export interface InputImageDetail extends InputImage {
+  used_by: InputUse[];
+}
+
+export async function fetchInputs(unused = false): Promise<InputImage[]> {
+  const response = await fetch(`${API_BASE}/inputs${unused ? "?unused=true" : ""}`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch input images");
+  }
+
+  return response.json();
+}
+
+export async function fetchInput(hash: string): Promise<InputImageDetail> {
+  const response = await fetch(`${API_BASE}/inputs/${hash}`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch input image");
+  }
+
+  return response.json();
+}
+
+// Uploads an image file; identical images come back with deduplicated set
+export async function uploadInput(file: Blob): Promise<InputImage> {
+  const response = await fetch(`${API_BASE}/inputs`, {
+    method: "POST",
+    headers: { "Content-Type": file.type || "image/png" },
+    body: file,
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to upload image");
+  }
+
+  return response.json();
+}
+
+export async function deleteInput(hash: string): Promise<void> {
+  const response = await fetch(`${API_BASE}/inputs/${hash}`, {
+    method: "DELETE",
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to delete input image");
+  }
+}
+
+export async function pruneInputs(): Promise<{ deleted: number; freed_bytes: number }> {
+  const response = await fetch(`${API_BASE}/inputs/prune`, { method: "POST" });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to prune input images");
+  }
+
+  return response.json();
+}
@@ -0,0 +1,125 @@
+import { apiError } from "./errors";
+
+const API_BASE = "/api";
+
+// A {{name}} placeholder used in a preset's params. Without a default the
+// variable is required when submitting with the preset.
+export interface PresetVariable {
+  name: string;
+  description?: string;
+  default?: unknown;
+}
+
+export interface Preset {
+  id?: string;
+  name: string;
+  workflow: string;
+  params: Record<string, unknown>;
+  variables?: PresetVariable[];
+}
+
+export interface SharedPreset {
+  diffbox_preset: number;
+  name: string;
+  workflow: string;
+  params: Record<string, unknown>;
+  variables?: PresetVariable[];
+}
+
+// Added to any workflow submission: params from the preset fill in what the
+// submission leaves out, then {{name}} placeholders are replaced from variables
+export interface TemplateFields {
+  preset_id?: string;
+  variables?: Record<string, unknown>;
+}
+
+export interface PresetExport {
+  preset: SharedPreset;
+  encoded: string;
+  url: string;
+}
+
+export interface PresetWarning {
+  field: string;
+  model: string;
+  message: string;
+}
+
+export interface PresetImportResult {
+  preset: Preset;
+  saved: boolean;
+  warnings: PresetWarning[];
+}
+
+export async function fetchPresets(workflow?: string): Promise<Preset[]> {
+  const params = new URLSearchParams();
+  if (workflow) params.set("workflow", workflow);
+
+  const response = await fetch(`${API_BASE}/presets?${params}`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch presets");
+  }
+
+  return response.json();
+}
+
+export async function savePreset(preset: Preset): Promise<Preset> {
+  const response = await fetch(`${API_BASE}/presets`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(preset),
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to save preset");
+  }
+
+  return response.json();
+}
+
+export async function deletePreset(id: string): Promise<void> {
+  const response = await fetch(`${API_BASE}/presets/${id}`, {
+    method: "DELETE",
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to delete preset");
+  }
+}
+
+export async function exportPreset(id: string): Promise<PresetExport> {
+  const response = await fetch(`${API_BASE}/presets/${id}/export`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to export preset");
+  }
+
+  return response.json();
+}
+
+// importPreset accepts a preset object, or the encoded blob or share link
+// from an export
+export async function importPreset(
+  source: SharedPreset | string,
+  options: { name?: string; dryRun?: boolean } = {},
+): Promise<PresetImportResult> {
+  const body =
+    typeof source === "string" ? { encoded: source } : { preset: source };
+
+  const response = await fetch(`${API_BASE}/presets/import`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({
+      ...body,
+      name: options.name,
+      dry_run: options.dryRun ?? false,
+    }),
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to import preset");
+  }
+
+  return response.json();
+}
@@ -0,0 +1,84 @@
+import { apiError } from "./errors";
+
+const API_BASE = "/api";
+
+export interface SavedPrompt {
+  id: string;
+  name: string;
+  text: string;
+  negative_prompt?: string;
+  tags: string[];
+  use_count: number;
+  last_used_at?: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface SavedPromptInput {
+  name: string;
+  text: string;
+  negative_prompt?: string;
+  tags?: string[];
+}
+
+export interface PromptTag {
+  tag: string;
+  count: number;
+}
+
+export async function fetchPrompts(
+  query?: string,
+  tags: string[] = [],
+): Promise<SavedPrompt[]> {
+  const params = new URLSearchParams();
+  if (query) params.set("q", query);
+  for (const tag of tags) params.append("tag", tag);
+
+  const response = await fetch(`${API_BASE}/prompts?${params}`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch prompts");
+  }
+
+  return response.json();
+}
+
+export async function fetchPromptTags(): Promise<PromptTag[]> {
+  const response = await fetch(`${API_BASE}/prompts/tags`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch prompt tags");
+  }
+
+  return response.json();
+}
+
+export async function savePrompt(
+  prompt: SavedPromptInput,
+  id?: string,
+): Promise<SavedPrompt> {
+  const response = await fetch(
+    id ? `${API_BASE}/prompts/${id}` : `${API_BASE}/prompts`,
+    {
+      method: id ? "PUT" : "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(prompt),
+    },
+  );
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to save prompt");
+  }
+
+  return response.json();
+}
+
+export async function deletePrompt(id: string): Promise<void> {
+  const response = await fetch(`${API_BASE}/prompts/${id}`, {
+    method: "DELETE",
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to delete prompt");
+  }
+}
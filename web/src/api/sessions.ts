@@ -0,0 +1,118 @@
+import { apiError } from "./errors";
+import type { ArchiveFilter, Job } from "./workflows";
+
+const API_BASE = "/api";
+
+// Header naming the session a submitted job belongs to
+export const SESSION_HEADER = "X-Diffbox-Session";
+
+export interface Session {
+  id: string;
+  name: string;
+  created_at: string;
+  updated_at: string;
+  archived_at?: string;
+  job_count: number;
+  // Jobs in the session by status
+  job_counts: Record<string, number>;
+}
+
+export interface SessionDetail extends Session {
+  // Oldest first, archived or not
+  jobs: Job[];
+}
+
+let currentSession: string | null = null;
+
+// New submissions go into the current session until it is cleared
+export function setCurrentSession(id: string | null): void {
+  currentSession = id;
+}
+
+export function getCurrentSession(): string | null {
+  return currentSession;
+}
+
+export function sessionHeaders(): Record<string, string> {
+  return currentSession ? { [SESSION_HEADER]: currentSession } : {};
+}
+
+export async function fetchSessions(
+  archived: ArchiveFilter = "exclude",
+): Promise<Session[]> {
+  const response = await fetch(`${API_BASE}/sessions?archived=${archived}`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch sessions");
+  }
+
+  return response.json();
+}
+
+export async function fetchSession(id: string): Promise<SessionDetail> {
+  const response = await fetch(`${API_BASE}/sessions/${id}`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch session");
+  }
+
+  return response.json();
+}
+
+// The name defaults to the date and time
+export async function createSession(name?: string): Promise<Session> {
+  const response = await fetch(`${API_BASE}/sessions`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ name: name ?? "" }),
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to create session");
+  }
+
+  return response.json();
+}
+
+export async function renameSession(
+  id: string,
+  name: string,
+): Promise<Session> {
+  const response = await fetch(`${API_BASE}/sessions/${id}`, {
+    method: "PATCH",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ name }),
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to rename session");
+  }
+
+  return response.json();
+}
+
+// Archiving a session archives its jobs too; it fails while any of them
+// is queued or running
+export async function archiveSession(id: string): Promise<Session> {
+  const response = await fetch(`${API_BASE}/sessions/${id}/archive`, {
+    method: "POST",
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to archive session");
+  }
+
+  return response.json();
+}
+
+export async function unarchiveSession(id: string): Promise<Session> {
+  const response = await fetch(`${API_BASE}/sessions/${id}/unarchive`, {
+    method: "POST",
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to restore session");
+  }
+
+  return response.json();
+}
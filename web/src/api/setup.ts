@@ -0,0 +1,78 @@
+import { apiError } from "./errors";
+
+const API_BASE = "/api";
+
+export type ModelVariant = "full" | "fp8";
+
+export interface SetupWorkflow {
+  name: string;
+  enabled: boolean;
+  download_bytes: Record<ModelVariant, number>;
+}
+
+export interface SetupDirectory {
+  name: "models" | "outputs";
+  path: string;
+  // Chosen in setup, used from the next start
+  pending?: string;
+  // Pinned by env_var, so setup can't change it
+  locked: boolean;
+  env_var: string;
+}
+
+export interface TokenState {
+  configured: boolean;
+  valid?: boolean;
+  username?: string;
+  error?: string;
+  checked_at?: string;
+}
+
+export interface SetupStatus {
+  completed: boolean;
+  completed_at?: string;
+  variant: ModelVariant;
+  recommended_variant: ModelVariant;
+  workflows: SetupWorkflow[];
+  directories: SetupDirectory[];
+  hardware: {
+    gpus: { index: number; name: string; memory_mb: number }[];
+    cpus: number;
+    disks: { dir: string; free_bytes: number; total_bytes: number }[];
+  };
+  tokens: Record<"huggingface" | "civitai", TokenState>;
+}
+
+// Empty variant, tokens or directories keep the recommendation or current values
+export interface SetupRequest {
+  workflows: string[];
+  variant?: ModelVariant;
+  tokens?: { huggingface?: string; civitai?: string };
+  models_dir?: string;
+  outputs_dir?: string;
+}
+
+export async function fetchSetup(): Promise<SetupStatus> {
+  const response = await fetch(`${API_BASE}/setup`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch setup");
+  }
+
+  return response.json();
+}
+
+// Saves the choices and starts the model download
+export async function completeSetup(request: SetupRequest): Promise<SetupStatus> {
+  const response = await fetch(`${API_BASE}/setup`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(request),
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to save setup");
+  }
+
+  return response.json();
+}
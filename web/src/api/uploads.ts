@@ -0,0 +1,101 @@
+import { apiError } from "./errors";
+
+const API_BASE = "/api";
+
+export interface UploadStatus {
+  id: string;
+  filename: string;
+  size: number;
+  chunk_size: number;
+  chunks: number;
+  received: number;
+  missing: number[];
+  completed: boolean;
+  // Pass to custom workflow video params once completed
+  ref?: string;
+  created_at: string;
+  updated_at: string;
+  completed_at?: string;
+}
+
+export async function createUpload(
+  filename: string,
+  size: number,
+  sha256?: string
+): Promise<UploadStatus> {
+  const response = await fetch(`${API_BASE}/uploads`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ filename, size, sha256 }),
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to start upload");
+  }
+
+  return response.json();
+}
+
+export async function fetchUpload(id: string): Promise<UploadStatus> {
+  const response = await fetch(`${API_BASE}/uploads/${id}`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch upload");
+  }
+
+  return response.json();
+}
+
+export async function uploadChunk(id: string, index: number, chunk: Blob): Promise<UploadStatus> {
+  const response = await fetch(`${API_BASE}/uploads/${id}/chunks/${index}`, {
+    method: "PUT",
+    headers: { "Content-Type": "application/octet-stream" },
+    body: chunk,
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, `Failed to upload chunk ${index}`);
+  }
+
+  return response.json();
+}
+
+export async function completeUpload(id: string): Promise<UploadStatus> {
+  const response = await fetch(`${API_BASE}/uploads/${id}/complete`, {
+    method: "POST",
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to complete upload");
+  }
+
+  return response.json();
+}
+
+export async function deleteUpload(id: string): Promise<void> {
+  const response = await fetch(`${API_BASE}/uploads/${id}`, {
+    method: "DELETE",
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to delete upload");
+  }
+}
+
+// Uploads a file in chunks, sending only what the server is missing, so
+// passing the id of an interrupted upload resumes it
+export async function uploadFile(
+  file: File,
+  onProgress?: (received: number, chunks: number) => void,
+  resumeId?: string
+): Promise<UploadStatus> {
+  let status = resumeId ? await fetchUpload(resumeId) : await createUpload(file.name, file.size);
+
+  for (const index of status.missing) {
+    const start = index * status.chunk_size;
+    status = await uploadChunk(status.id, index, file.slice(start, start + status.chunk_size));
+    onProgress?.(status.received, status.chunks);
+  }
+
+  return completeUpload(status.id);
+}
@@ -0,0 +1,67 @@
+import { apiError } from "./errors";
+
+const API_BASE = "/api";
+
+// Zero means unlimited
+export interface QuotaLimits {
+  max_queued_jobs: number;
+  gpu_minutes_per_day: number;
+  storage_bytes: number;
+}
+
+export interface UserUsage {
+  user_id: string;
+  enforced: boolean;
+  limits: QuotaLimits;
+  usage: {
+    active_jobs: number;
+    gpu_minutes: number;
+    storage_bytes: number;
+  };
+}
+
+// Null fields fall back to the server defaults
+export interface UserQuota {
+  user_id: string;
+  max_queued_jobs: number | null;
+  gpu_minutes_per_day: number | null;
+  storage_bytes: number | null;
+  effective: QuotaLimits;
+}
+
+export async function fetchMyUsage(): Promise<UserUsage> {
+  const response = await fetch(`${API_BASE}/users/me/usage`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch usage");
+  }
+
+  return response.json();
+}
+
+export async function fetchUserQuota(userId: string): Promise<UserQuota> {
+  const response = await fetch(`${API_BASE}/users/${encodeURIComponent(userId)}/quota`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch quota");
+  }
+
+  return response.json();
+}
+
+export async function setUserQuota(
+  userId: string,
+  quota: Pick<UserQuota, "max_queued_jobs" | "gpu_minutes_per_day" | "storage_bytes">,
+): Promise<UserQuota> {
+  const response = await fetch(`${API_BASE}/users/${encodeURIComponent(userId)}/quota`, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(quota),
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to save quota");
+  }
+
+  return response.json();
+}
@@ -1,3 +1,6 @@
+import { apiError } from "./errors";
+import { sessionHeaders } from "./sessions";
+
 const API_BASE = "/api";
 
 export interface I2VParams {
@@ -7,10 +10,31 @@ export interface I2VParams {
   seed?: number;
   height?: number;
   width?: number;
+  snap_resolution?: boolean; // Use the nearest preset for unsupported sizes
   num_frames?: number;
   num_inference_steps?: number;
   cfg_scale?: number;
   denoising_strength?: number;
+  camera_direction?: string; // Motion name from fetchCameraMotions
+  camera_speed?: number;
+  camera_path?: CameraPath; // Keyframed motion, instead of a direction
+  prompt_id?: string; // Saved prompt the prompt text came from
+}
+
+// Poses are relative to the first frame; at runs from 0 to 1 over the clip
+export interface CameraKeyframe {
+  at: number;
+  x?: number; // Frame widths, positive right
+  y?: number; // Frame heights, positive up
+  zoom?: number; // Added magnification, 0.5 is 1.5x
+  pan?: number; // Degrees, positive right
+  tilt?: number; // Degrees, positive up
+  roll?: number; // Degrees clockwise
+}
+
+export interface CameraPath {
+  keyframes: CameraKeyframe[];
+  easing?: "linear" | "ease-in-out";
 }
 
 export interface QwenParams {
@@ -19,8 +43,10 @@ export interface QwenParams {
   seed?: number;
   height?: number;
   width?: number;
+  snap_resolution?: boolean;
   num_inference_steps?: number;
   cfg_scale?: number;
+  prompt_id?: string;
 }
 
 export interface ChatMessage {
@@ -38,6 +64,7 @@ export interface ChatParams {
 export interface JobResponse {
   id: string;
   status: string;
+  warnings?: string[]; // Requested params the job was queued without
 }
 
 export interface JobOutput {
@@ -52,18 +79,53 @@ export interface Job {
   status: string;
   progress: number;
   stage: string;
+  label?: string;
+  notes?: string;
   params: Record<string, unknown>;
   output?: JobOutput;
   error?: string;
   created_at: string;
   updated_at: string;
+  queue_position?: number;
+  estimated_start?: string;
+  starts_in_seconds?: number;
+  archived_at?: string;
+  session_id?: string;
+  // Library images the job used; only on single-job fetches
+  inputs?: { field: string; hash: string }[];
+}
+
+export interface JobAnnotations {
+  label?: string;
+  notes?: string;
+}
+
+export type ArchiveFilter = "exclude" | "include" | "only";
+
+export async function fetchJobs(
+  archived: ArchiveFilter = "exclude",
+): Promise<Job[]> {
+  const response = await fetch(`${API_BASE}/jobs?archived=${archived}`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch jobs");
+  }
+
+  return response.json();
 }
 
-export async function fetchJobs(): Promise<Job[]> {
-  const response = await fetch(`${API_BASE}/jobs`);
+export async function updateJob(
+  id: string,
+  annotations: JobAnnotations,
+): Promise<Job> {
+  const response = await fetch(`${API_BASE}/jobs/${id}`, {
+    method: "PATCH",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(annotations),
+  });
 
   if (!response.ok) {
-    throw new Error("Failed to fetch jobs");
+    throw await apiError(response, "Failed to update job");
   }
 
   return response.json();
@@ -72,13 +134,12 @@ export async function fetchJobs(): Promise<Job[]> {
 export async function submitI2V(params: I2VParams): Promise<JobResponse> {
   const response = await fetch(`${API_BASE}/workflows/i2v`, {
     method: "POST",
-    headers: { "Content-Type": "application/json" },
+    headers: { "Content-Type": "application/json", ...sessionHeaders() },
     body: JSON.stringify(params),
   });
 
   if (!response.ok) {
-    const error = await response.text();
-    throw new Error(error || "Failed to submit I2V job");
+    throw await apiError(response, "Failed to submit I2V job");
   }
 
   return response.json();
@@ -87,13 +148,12 @@ export async function submitI2V(params: I2VParams): Promise<JobResponse> {
 export async function submitQwen(params: QwenParams): Promise<JobResponse> {
   const response = await fetch(`${API_BASE}/workflows/qwen`, {
     method: "POST",
-    headers: { "Content-Type": "application/json" },
+    headers: { "Content-Type": "application/json", ...sessionHeaders() },
     body: JSON.stringify(params),
   });
 
   if (!response.ok) {
-    const error = await response.text();
-    throw new Error(error || "Failed to submit Qwen job");
+    throw await apiError(response, "Failed to submit Qwen job");
   }
 
   return response.json();
@@ -102,13 +162,109 @@ export async function submitQwen(params: QwenParams): Promise<JobResponse> {
 export async function submitChat(params: ChatParams): Promise<JobResponse> {
   const response = await fetch(`${API_BASE}/workflows/chat`, {
     method: "POST",
-    headers: { "Content-Type": "application/json" },
+    headers: { "Content-Type": "application/json", ...sessionHeaders() },
     body: JSON.stringify(params),
   });
 
   if (!response.ok) {
-    const error = await response.text();
-    throw new Error(error || "Failed to submit Chat job");
+    throw await apiError(response, "Failed to submit Chat job");
+  }
+
+  return response.json();
+}
+
+export interface CustomWorkflowParam {
+  type: "string" | "integer" | "number" | "boolean" | "image" | "video";
+  description?: string;
+  required?: boolean;
+  default?: unknown;
+  min?: number;
+  max?: number;
+  max_length?: number;
+  enum?: string[];
+}
+
+export interface CustomWorkflow {
+  type: string;
+  name: string;
+  description?: string;
+  output: "video" | "image";
+  params: Record<string, CustomWorkflowParam>;
+  models: string[];
+}
+
+export interface ResolutionPreset {
+  width: number;
+  height: number;
+  aspect: string;
+  label: string;
+}
+
+export interface ResolutionCatalog {
+  workflow: string;
+  default: ResolutionPreset;
+  presets: ResolutionPreset[];
+}
+
+export async function fetchResolutions(
+  workflow: "i2v" | "svi" | "qwen",
+): Promise<ResolutionCatalog> {
+  const response = await fetch(`${API_BASE}/workflows/${workflow}/resolutions`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch resolutions");
+  }
+
+  return response.json();
+}
+
+export interface CameraMotion {
+  name: string;
+  label: string;
+  description: string;
+  aliases?: string[];
+}
+
+export interface CameraMotions {
+  workflow: string;
+  default_speed: number;
+  max_speed: number;
+  max_keyframes: number;
+  motions: CameraMotion[];
+}
+
+export async function fetchCameraMotions(workflow: "i2v" | "svi"): Promise<CameraMotions> {
+  const response = await fetch(`${API_BASE}/workflows/${workflow}/camera-motions`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch camera motions");
+  }
+
+  return response.json();
+}
+
+export async function fetchCustomWorkflows(): Promise<CustomWorkflow[]> {
+  const response = await fetch(`${API_BASE}/workflows/custom`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch custom workflows");
+  }
+
+  return response.json();
+}
+
+export async function submitCustom(
+  type: string,
+  params: Record<string, unknown>,
+): Promise<JobResponse> {
+  const response = await fetch(`${API_BASE}/workflows/custom/${type}`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json", ...sessionHeaders() },
+    body: JSON.stringify(params),
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, `Failed to submit ${type} job`);
   }
 
   return response.json();
@@ -120,6 +276,195 @@ export async function cancelJob(jobId: string): Promise<void> {
   });
 
   if (!response.ok) {
-    throw new Error("Failed to cancel job");
+    throw await apiError(response, "Failed to cancel job");
   }
 }
+
+// Archived jobs are hidden from the job list but can be restored until
+// they are purged
+export async function archiveJob(jobId: string): Promise<Job> {
+  const response = await fetch(`${API_BASE}/jobs/${jobId}/archive`, {
+    method: "POST",
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to archive job");
+  }
+
+  return response.json();
+}
+
+export async function unarchiveJob(jobId: string): Promise<Job> {
+  const response = await fetch(`${API_BASE}/jobs/${jobId}/unarchive`, {
+    method: "POST",
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to restore job");
+  }
+
+  return response.json();
+}
+
+export interface PurgeJobsResult {
+  purged: string[];
+  files_removed: number;
+}
+
+// Permanently deletes archived jobs (all of them if ids is empty)
+export async function purgeJobs(
+  ids: string[] = [],
+  deleteFiles = false,
+): Promise<PurgeJobsResult> {
+  const response = await fetch(`${API_BASE}/jobs/purge`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ ids, delete_files: deleteFiles }),
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to purge jobs");
+  }
+
+  return response.json();
+}
+
+export interface ReproModel {
+  name: string;
+  role: string;
+  sha256?: string;
+  source?: string;
+}
+
+export interface ReproReport {
+  job_id: string;
+  type: string;
+  status: string;
+  params: Record<string, unknown>;
+  seed?: number;
+  models: ReproModel[];
+  versions: {
+    diffbox: string;
+    commit?: string;
+    worker?: Record<string, string>;
+  };
+  recorded_at?: string;
+}
+
+export async function fetchRepro(jobId: string): Promise<ReproReport> {
+  const response = await fetch(`${API_BASE}/jobs/${jobId}/repro`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to fetch repro report");
+  }
+
+  return response.json();
+}
+
+// Queues a new job with the exact params and seed of jobId. Fails with a
+// CONFLICT error if model files changed since, unless force is set.
+export async function resubmitRepro(
+  jobId: string,
+  force = false,
+): Promise<JobResponse> {
+  const response = await fetch(
+    `${API_BASE}/jobs/${jobId}/repro${force ? "?force=true" : ""}`,
+    { method: "POST" },
+  );
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to resubmit job");
+  }
+
+  return response.json();
+}
+
+export interface ConcatRequest {
+  // Finished video jobs, joined in this order
+  job_ids: string[];
+  // Seconds each clip overlaps the next
+  crossfade?: number;
+  // Re-encodes with these settings; clips that match are otherwise copied
+  encoding?: {
+    codec?: "h264" | "h265";
+    crf?: number;
+    preset?: string;
+    fps?: number;
+  };
+}
+
+// Joins video outputs into a new "concat" job, reported over the
+// WebSocket like any other. Fails with FFMPEG_MISSING if the server has no
+// ffmpeg.
+export async function concatOutputs(request: ConcatRequest): Promise<JobResponse> {
+  const response = await fetch(`${API_BASE}/outputs/concat`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(request),
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to join videos");
+  }
+
+  return response.json();
+}
+
+// Queues a new job from jobId's params with overrides merged over them.
+// Nested objects merge key by key and null resets a param to its default.
+export async function resubmitJob(
+  jobId: string,
+  overrides: Record<string, unknown>,
+): Promise<JobResponse> {
+  const response = await fetch(`${API_BASE}/jobs/${jobId}/resubmit`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(overrides),
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to resubmit job");
+  }
+
+  return response.json();
+}
+
+export interface ParamChange {
+  key: string;
+  a?: unknown;
+  b?: unknown;
+}
+
+export interface ComparedJob {
+  id: string;
+  type: string;
+  status: string;
+  label?: string;
+  output?: JobOutput;
+  seed?: number;
+  created_at: string;
+  duration_seconds?: number;
+}
+
+export interface JobComparison {
+  a: ComparedJob;
+  b: ComparedJob;
+  params: {
+    changed: ParamChange[];
+    added: ParamChange[];
+    removed: ParamChange[];
+    unchanged: number;
+  };
+  duration_delta_seconds?: number;
+}
+
+export async function compareJobs(a: string, b: string): Promise<JobComparison> {
+  const params = new URLSearchParams({ a, b });
+  const response = await fetch(`${API_BASE}/jobs/compare?${params}`);
+
+  if (!response.ok) {
+    throw await apiError(response, "Failed to compare jobs");
+  }
+
+  return response.json();
+}
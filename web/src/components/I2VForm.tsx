@@ -361,7 +361,12 @@ export function I2VForm({ className }: I2VFormProps) {
         {activeJob &&
           (activeJob.status === "running" ||
             activeJob.status === "pending") && (
-            <Progress value={activeJob.progress} stage={activeJob.stage} />
+            <Progress
+              value={activeJob.progress}
+              stage={activeJob.stage}
+              etaSeconds={activeJob.etaSeconds}
+              logs={activeJob.logs}
+            />
           )}
 
         {activeJob?.status === "completed" && activeJob.output && (
@@ -1,4 +1,5 @@
 import { cn } from '@/lib/utils'
+import { archiveJob } from '@/api/workflows'
 import { Job, useJobStore } from '@/stores/jobStore'
 import { Progress, JobStatus } from './Progress'
 
@@ -38,7 +39,13 @@ export function OutputGallery({ className }: OutputGalleryProps) {
             job={job}
             isActive={job.id === activeJobId}
             onSelect={() => setActiveJob(job.id)}
-            onRemove={() => removeJob(job.id)}
+            onRemove={() => {
+              // Finished jobs are archived so they don't come back on reload
+              if (job.status !== 'pending' && job.status !== 'running') {
+                archiveJob(job.id).catch((err) => console.error(err))
+              }
+              removeJob(job.id)
+            }}
           />
         ))}
       </div>
@@ -106,7 +113,7 @@ function JobCard({ job, isActive, onSelect, onRemove }: JobCardProps) {
         <div className="flex-1 min-w-0">
           <div className="flex items-center justify-between gap-2">
             <span className="text-sm font-medium truncate">
-              {job.type === 'i2v' ? 'Image to Video' : 'Image Edit'}
+              {job.label || (job.type === 'i2v' ? 'Image to Video' : 'Image Edit')}
             </span>
             <JobStatus status={job.status} />
           </div>
@@ -120,6 +127,15 @@ function JobCard({ job, isActive, onSelect, onRemove }: JobCardProps) {
             />
           )}
 
+          {job.status === 'pending' && job.queuePosition && (
+            <p className="text-xs text-muted-foreground mt-1">
+              #{job.queuePosition} in queue
+              {job.startsInSeconds === 0 && ', starting now'}
+              {!!job.startsInSeconds &&
+                `, starts in about ${Math.max(1, Math.round(job.startsInSeconds / 60))} min`}
+            </p>
+          )}
+
           {job.status === 'failed' && (
             <p className="text-xs text-destructive mt-1 truncate">
               {job.error}
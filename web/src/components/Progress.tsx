@@ -3,15 +3,25 @@ import { cn } from '@/lib/utils'
 interface ProgressProps {
   value: number
   stage?: string
+  etaSeconds?: number
   className?: string
   showLabel?: boolean
+  logs?: string[]
+}
+
+function formatETA(seconds: number) {
+  if (seconds < 60) return 'less than a minute left'
+  const minutes = Math.round(seconds / 60)
+  return minutes === 1 ? 'about 1 minute left' : `about ${minutes} minutes left`
 }
 
 export function Progress({
   value,
   stage,
+  etaSeconds,
   className,
   showLabel = true,
+  logs,
 }: ProgressProps) {
   const percentage = Math.round(value * 100)
 
@@ -22,7 +32,12 @@ export function Progress({
           <span className="text-muted-foreground truncate max-w-[70%]">
             {stage || 'Waiting...'}
           </span>
-          <span className="font-mono text-primary tabular-nums">{percentage}%</span>
+          <span className="font-mono text-primary tabular-nums">
+            {etaSeconds ? (
+              <span className="text-muted-foreground mr-2">{formatETA(etaSeconds)}</span>
+            ) : null}
+            {percentage}%
+          </span>
         </div>
       )}
       <div className="progress-bar">
@@ -31,12 +46,22 @@ export function Progress({
           style={{ width: `${percentage}%` }}
         />
       </div>
+      {logs && logs.length > 0 && <JobLogTail lines={logs} />}
     </div>
   )
 }
 
+// Show the last few worker log lines, newest at the bottom
+function JobLogTail({ lines }: { lines: string[] }) {
+  return (
+    <pre className="max-h-32 overflow-y-auto rounded bg-muted p-2 text-xs font-mono text-muted-foreground whitespace-pre-wrap break-all">
+      {lines.slice(-20).join('\n')}
+    </pre>
+  )
+}
+
 interface JobStatusProps {
-  status: 'pending' | 'running' | 'completed' | 'failed'
+  status: 'pending' | 'waiting_models' | 'running' | 'completed' | 'failed' | 'interrupted'
   className?: string
 }
 
@@ -47,6 +72,11 @@ export function JobStatus({ status, className }: JobStatusProps) {
       color: 'text-muted-foreground',
       bg: 'bg-muted',
     },
+    waiting_models: {
+      label: 'Waiting for models',
+      color: 'text-yellow-400',
+      bg: 'bg-yellow-500/20',
+    },
     running: {
       label: 'Running',
       color: 'text-primary',
@@ -62,6 +92,11 @@ export function JobStatus({ status, className }: JobStatusProps) {
       color: 'text-destructive',
       bg: 'bg-destructive/20',
     },
+    interrupted: {
+      label: 'Interrupted',
+      color: 'text-yellow-400',
+      bg: 'bg-yellow-500/20',
+    },
   }
 
   const { label, color, bg } = config[status]
@@ -541,7 +541,12 @@ export function QwenForm({ className }: QwenFormProps) {
         {activeJob &&
           (activeJob.status === "running" ||
             activeJob.status === "pending") && (
-            <Progress value={activeJob.progress} stage={activeJob.stage} />
+            <Progress
+              value={activeJob.progress}
+              stage={activeJob.stage}
+              etaSeconds={activeJob.etaSeconds}
+              logs={activeJob.logs}
+            />
           )}
 
         {activeJob?.status === "completed" && activeJob.output && (
@@ -11,6 +11,7 @@ interface JobProgress {
   progress: number
   stage: string
   preview?: string
+  eta_seconds?: number
 }
 
 interface JobComplete {
@@ -27,19 +28,39 @@ interface JobError {
   error: string
 }
 
+interface JobLog {
+  job_id: string
+  line: string
+}
+
 export function useWebSocket() {
   const wsRef = useRef<WebSocket | null>(null)
   const reconnectTimeoutRef = useRef<ReturnType<typeof setTimeout> | null>(null)
+  // Job whose worker log lines are streamed, resent after reconnecting
+  const logJobRef = useRef<string | null>(null)
+  const activeJobId = useJobStore((state) => state.activeJobId)
 
-  const subscribe = useCallback((jobIds: string[]) => {
+  const send = useCallback((type: string, data: unknown) => {
     if (wsRef.current?.readyState === WebSocket.OPEN) {
-      wsRef.current.send(JSON.stringify({
-        type: 'subscribe',
-        data: { job_ids: jobIds }
-      }))
+      wsRef.current.send(JSON.stringify({ type, data }))
     }
   }, [])
 
+  const subscribe = useCallback((jobIds: string[], options?: { logs?: boolean }) => {
+    send('subscribe', { job_ids: jobIds, logs: options?.logs })
+  }, [send])
+
+  // Stream logs for the job the user is looking at
+  useEffect(() => {
+    if (logJobRef.current && logJobRef.current !== activeJobId) {
+      send('unsubscribe', { job_ids: [logJobRef.current] })
+    }
+    logJobRef.current = activeJobId
+    if (activeJobId) {
+      subscribe([activeJobId], { logs: true })
+    }
+  }, [activeJobId, send, subscribe])
+
   useEffect(() => {
     const connect = () => {
       if (wsRef.current?.readyState === WebSocket.OPEN) return
@@ -52,18 +73,29 @@ export function useWebSocket() {
 
       ws.onopen = () => {
         console.log('WebSocket connected')
+        if (logJobRef.current) {
+          ws.send(JSON.stringify({
+            type: 'subscribe',
+            data: { job_ids: [logJobRef.current], logs: true }
+          }))
+        }
       }
 
       ws.onmessage = (event) => {
         try {
           const message: WSMessage = JSON.parse(event.data)
           // Get latest store actions directly to avoid stale closure
-          const { updateJobProgress, completeJob, failJob } = useJobStore.getState()
+          const { updateJobProgress, appendJobLog, completeJob, failJob } = useJobStore.getState()
 
           switch (message.type) {
             case 'job:progress': {
               const data = message.data as JobProgress
-              updateJobProgress(data.job_id, data.progress, data.stage, data.preview)
+              updateJobProgress(data.job_id, data.progress, data.stage, data.preview, data.eta_seconds)
+              break
+            }
+            case 'job:log': {
+              const data = message.data as JobLog
+              appendJobLog(data.job_id, data.line)
               break
             }
             case 'job:complete': {
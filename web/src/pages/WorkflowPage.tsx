@@ -7,7 +7,7 @@ import { ChatForm } from "@/components/ChatForm";
 import { OutputGallery } from "@/components/OutputGallery";
 import { useWebSocket } from "@/hooks/useWebSocket";
 import { fetchJobs } from "@/api/workflows";
-import { useJobStore } from "@/stores/jobStore";
+import { useJobStore, type Job } from "@/stores/jobStore";
 
 type WorkflowType = "i2v" | "qwen" | "chat";
 
@@ -103,9 +103,13 @@ export default function WorkflowPage() {
         const jobs = apiJobs.map((j) => ({
           id: j.id,
           type: j.type as "i2v" | "qwen" | "chat",
-          status: j.status as "pending" | "running" | "completed" | "failed",
+          status: j.status as Job["status"],
           progress: j.progress,
           stage: j.stage,
+          label: j.label,
+          notes: j.notes,
+          queuePosition: j.queue_position,
+          startsInSeconds: j.starts_in_seconds,
           params: j.params,
           output: j.output
             ? {
@@ -13,10 +13,16 @@ export interface JobOutput {
 export interface Job {
   id: string;
   type: "i2v" | "qwen" | "chat";
-  status: "pending" | "running" | "completed" | "failed";
+  status: "pending" | "running" | "completed" | "failed" | "interrupted";
   progress: number;
   stage: string;
+  label?: string;
+  notes?: string;
+  etaSeconds?: number;
+  queuePosition?: number; // Place in the queue while waiting for a worker
+  startsInSeconds?: number;
   preview?: string;
+  logs?: string[]; // Recent worker log lines, streamed while running
   output?: JobOutput;
   error?: string;
   params: Record<string, unknown>;
@@ -33,7 +39,9 @@ interface JobStore {
     progress: number,
     stage: string,
     preview?: string,
+    etaSeconds?: number,
   ) => void;
+  appendJobLog: (jobId: string, line: string) => void;
   completeJob: (jobId: string, output: JobOutput) => void;
   failJob: (jobId: string, error: string) => void;
   removeJob: (jobId: string) => void;
@@ -42,6 +50,9 @@ interface JobStore {
   getJob: (jobId: string) => Job | undefined;
 }
 
+// Keep only the tail of each job's log so long runs don't grow unbounded
+const MAX_JOB_LOG_LINES = 200;
+
 export const useJobStore = create<JobStore>((set, get) => ({
   jobs: [],
   activeJobId: null,
@@ -53,11 +64,21 @@ export const useJobStore = create<JobStore>((set, get) => ({
     }));
   },
 
-  updateJobProgress: (jobId, progress, stage, preview) => {
+  updateJobProgress: (jobId, progress, stage, preview, etaSeconds) => {
+    set((state) => ({
+      jobs: state.jobs.map((job) =>
+        job.id === jobId
+          ? { ...job, status: "running", progress, stage, preview, etaSeconds }
+          : job,
+      ),
+    }));
+  },
+
+  appendJobLog: (jobId, line) => {
     set((state) => ({
       jobs: state.jobs.map((job) =>
         job.id === jobId
-          ? { ...job, status: "running", progress, stage, preview }
+          ? { ...job, logs: [...(job.logs ?? []), line].slice(-MAX_JOB_LOG_LINES) }
           : job,
       ),
     }));